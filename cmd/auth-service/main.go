@@ -20,6 +20,8 @@ import (
 	"github.com/jareynolds/ubecode/internal/auth"
 	"github.com/jareynolds/ubecode/pkg/database"
 	"github.com/jareynolds/ubecode/pkg/middleware"
+	"github.com/jareynolds/ubecode/pkg/notification"
+	"github.com/jareynolds/ubecode/pkg/repository"
 )
 
 func main() {
@@ -56,7 +58,63 @@ func main() {
 
 	// Initialize service and handler
 	authService := auth.NewService(db.DB, jwtSecret)
+	authService.SetTokenLifetimes(durationEnv("ACCESS_TOKEN_TTL"), durationEnv("REFRESH_TOKEN_TTL"))
+	authService.SetPasswordPolicy(auth.PasswordPolicyFromEnv())
+	authService.SetLockoutPolicy(auth.LockoutPolicyFromEnv())
+	// Client IPs for throttling and sessions come from proxy headers only when the peer
+	// is one of TRUSTED_PROXIES
+	proxies, err := auth.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	authService.SetTrustedProxies(proxies)
+	if key := os.Getenv("MFA_ENCRYPTION_KEY"); key != "" {
+		authService.SetMFAEncryptionKey(key)
+	} else {
+		log.Println("MFA_ENCRYPTION_KEY not set; TOTP secrets are encrypted with a key derived from JWT_SECRET")
+	}
+
+	// Password reset emails go through the same SMTP settings as notifications
+	mailCfg := notification.ConfigFromEnv()
+	if mailCfg.SMTPHost != "" {
+		from := mailCfg.SMTPFrom
+		if from == "" {
+			from = "ubecode@localhost"
+		}
+		baseURL := mailCfg.AppBaseURL
+		if baseURL == "" {
+			baseURL = "http://localhost:6173"
+		}
+		authService.SetMailer(notification.NewEmailSender(mailCfg.SMTPHost, mailCfg.SMTPPort, mailCfg.SMTPUsername, mailCfg.SMTPPassword, from), baseURL)
+		log.Printf("Password reset email configured via %s", mailCfg.SMTPHost)
+	} else {
+		log.Println("Password reset email not configured (missing SMTP_HOST)")
+	}
+	// SCIM provisioning maps identity provider groups onto roles; deprovisioned users'
+	// pending approvals move to their manager
+	rbacRepo := repository.NewRBACRepository(db.DB)
+	scimConfig := auth.SCIMConfigFromEnv()
+	for _, m := range scimConfig.RoleMappings {
+		if _, err := rbacRepo.GetRoleByName(m.Role); err != nil {
+			log.Printf("SCIM group %q maps to unknown role %q", m.Group, m.Role)
+		}
+	}
+	authService.SetSCIMConfig(scimConfig)
+	authService.SetApprovalRepository(repository.NewApprovalRepository(db.DB))
+
 	authHandler := auth.NewHandler(authService)
+	authHandler.SetRBACRepository(rbacRepo)
+
+	// Periodically drop expired sessions, revocation entries and pending login steps
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := authService.PurgeExpired(); err != nil {
+				log.Printf("Failed to purge expired sessions: %v", err)
+			}
+		}
+	}()
 
 	// Configure OAuth if credentials are provided
 	if googleClientID != "" && googleClientSecret != "" {
@@ -67,6 +125,26 @@ func main() {
 		log.Println("Google OAuth not configured (missing client ID or secret)")
 	}
 
+	// Configure generic OIDC single sign-on providers; a provider whose issuer
+	// cannot be reached is skipped so password login keeps working
+	ssoConfigs, err := auth.LoadSSOProviderConfigs()
+	if err != nil {
+		log.Fatalf("Invalid SSO configuration: %v", err)
+	}
+	var ssoProviders []*auth.OIDCProvider
+	for _, cfg := range ssoConfigs {
+		discoveryCtx, cancelDiscovery := context.WithTimeout(context.Background(), 10*time.Second)
+		provider, err := auth.NewOIDCProvider(discoveryCtx, cfg)
+		cancelDiscovery()
+		if err != nil {
+			log.Printf("SSO provider %s not configured: %v", cfg.ID, err)
+			continue
+		}
+		ssoProviders = append(ssoProviders, provider)
+		log.Printf("SSO provider %s configured (%s)", cfg.ID, cfg.Issuer)
+	}
+	authHandler.SetSSOProviders(ssoProviders)
+
 	// Setup routes
 	mux := http.NewServeMux()
 
@@ -77,14 +155,39 @@ func main() {
 	})
 	mux.HandleFunc("POST /api/auth/login", authHandler.Login)
 	mux.HandleFunc("GET /api/auth/verify", authHandler.VerifyToken)
+	mux.HandleFunc("POST /api/auth/refresh", authHandler.Refresh)
+	mux.HandleFunc("GET /api/auth/password/policy", authHandler.GetPasswordPolicy)
+	mux.HandleFunc("POST /api/auth/password/forgot", authHandler.ForgotPassword)
+	mux.HandleFunc("POST /api/auth/password/reset", authHandler.ResetPassword)
+	mux.HandleFunc("POST /api/auth/mfa/verify", authHandler.VerifyMFA)
+
+	// MFA enrollment accepts either a session token or the MFA token of a login that requires enrollment
+	mux.HandleFunc("POST /api/auth/mfa/setup", authHandler.SetupMFA)
+	mux.HandleFunc("POST /api/auth/mfa/enable", authHandler.EnableMFA)
 
 	// OAuth endpoints
 	mux.HandleFunc("GET /api/auth/google/login", authHandler.GoogleLogin)
 	mux.HandleFunc("GET /api/auth/google/callback", authHandler.GoogleCallback)
+	mux.HandleFunc("GET /api/auth/sso/providers", authHandler.ListSSOProviders)
+	mux.HandleFunc("GET /api/auth/sso/{provider}/login", authHandler.SSOLogin)
+	mux.HandleFunc("GET /api/auth/sso/{provider}/callback", authHandler.SSOCallback)
 
 	// Protected endpoints (require authentication)
 	authMiddleware := middleware.AuthMiddleware(authService)
 	mux.Handle("GET /api/auth/me", authMiddleware(http.HandlerFunc(authHandler.GetMe)))
+	mux.Handle("POST /api/auth/logout", authMiddleware(http.HandlerFunc(authHandler.Logout)))
+	mux.Handle("POST /api/auth/logout-all", authMiddleware(http.HandlerFunc(authHandler.LogoutAll)))
+	mux.Handle("GET /api/auth/sessions", authMiddleware(http.HandlerFunc(authHandler.ListSessions)))
+	mux.Handle("DELETE /api/auth/sessions/{id}", authMiddleware(http.HandlerFunc(authHandler.RevokeSession)))
+	mux.HandleFunc("GET /api/auth/scopes", authHandler.ListScopes)
+	mux.Handle("GET /api/auth/tokens", authMiddleware(http.HandlerFunc(authHandler.ListAPITokens)))
+	mux.Handle("POST /api/auth/tokens", authMiddleware(http.HandlerFunc(authHandler.CreateAPIToken)))
+	mux.Handle("DELETE /api/auth/tokens/{tokenId}", authMiddleware(http.HandlerFunc(authHandler.RevokeAPIToken)))
+	mux.Handle("GET /api/auth/access", authMiddleware(http.HandlerFunc(authHandler.GetAccess)))
+	mux.Handle("GET /api/auth/mfa", authMiddleware(http.HandlerFunc(authHandler.GetMFAStatus)))
+	mux.Handle("POST /api/auth/mfa/disable", authMiddleware(http.HandlerFunc(authHandler.DisableMFA)))
+	mux.Handle("POST /api/auth/mfa/recovery-codes", authMiddleware(http.HandlerFunc(authHandler.RegenerateRecoveryCodes)))
+	mux.HandleFunc("GET /api/permissions", authHandler.ListPermissions)
 
 	// Admin-only endpoints
 	adminOnly := middleware.AdminOnlyMiddleware
@@ -92,6 +195,43 @@ func main() {
 	mux.Handle("POST /api/users", authMiddleware(adminOnly(http.HandlerFunc(authHandler.CreateUser))))
 	mux.Handle("PUT /api/users/{id}", authMiddleware(adminOnly(http.HandlerFunc(authHandler.UpdateUser))))
 	mux.Handle("DELETE /api/users/{id}", authMiddleware(adminOnly(http.HandlerFunc(authHandler.DeleteUser))))
+	mux.Handle("GET /api/users/{id}/sessions", authMiddleware(adminOnly(http.HandlerFunc(authHandler.ListUserSessions))))
+	mux.Handle("POST /api/users/{id}/revoke-sessions", authMiddleware(adminOnly(http.HandlerFunc(authHandler.RevokeUserSessions))))
+	mux.Handle("POST /api/users/{id}/unlock", authMiddleware(adminOnly(http.HandlerFunc(authHandler.UnlockUser))))
+	mux.Handle("DELETE /api/users/{id}/mfa", authMiddleware(adminOnly(http.HandlerFunc(authHandler.ResetUserMFA))))
+	mux.Handle("GET /api/auth/events", authMiddleware(adminOnly(http.HandlerFunc(authHandler.ListAuthEvents))))
+	mux.Handle("GET /api/service-accounts", authMiddleware(adminOnly(http.HandlerFunc(authHandler.ListServiceAccounts))))
+	mux.Handle("POST /api/service-accounts", authMiddleware(adminOnly(http.HandlerFunc(authHandler.CreateServiceAccount))))
+	mux.Handle("GET /api/service-accounts/{id}/tokens", authMiddleware(adminOnly(http.HandlerFunc(authHandler.ListServiceAccountTokens))))
+	mux.Handle("POST /api/service-accounts/{id}/tokens", authMiddleware(adminOnly(http.HandlerFunc(authHandler.CreateServiceAccountToken))))
+	mux.Handle("DELETE /api/service-accounts/{id}/tokens/{tokenId}", authMiddleware(adminOnly(http.HandlerFunc(authHandler.RevokeServiceAccountToken))))
+	mux.Handle("GET /api/roles", authMiddleware(adminOnly(http.HandlerFunc(authHandler.ListRoles))))
+	mux.Handle("POST /api/roles", authMiddleware(adminOnly(http.HandlerFunc(authHandler.CreateRole))))
+	mux.Handle("PUT /api/roles/{id}", authMiddleware(adminOnly(http.HandlerFunc(authHandler.UpdateRole))))
+	mux.Handle("DELETE /api/roles/{id}", authMiddleware(adminOnly(http.HandlerFunc(authHandler.DeleteRole))))
+	mux.Handle("GET /api/workspaces/{id}/members", authMiddleware(adminOnly(http.HandlerFunc(authHandler.ListWorkspaceMembers))))
+	mux.Handle("PUT /api/workspaces/{id}/members", authMiddleware(adminOnly(http.HandlerFunc(authHandler.SetWorkspaceMember))))
+	mux.Handle("DELETE /api/workspaces/{id}/members/{userId}", authMiddleware(adminOnly(http.HandlerFunc(authHandler.RemoveWorkspaceMember))))
+
+	// SCIM 2.0 provisioning; used by identity providers with an admin service account token
+	// holding the users:provision scope
+	scim := func(h http.HandlerFunc) http.Handler {
+		return authMiddleware(middleware.RequireAdminScope(auth.ScopeUsersProvision)(h))
+	}
+	mux.Handle("GET /scim/v2/ServiceProviderConfig", scim(authHandler.SCIMServiceProviderConfig))
+	mux.Handle("GET /scim/v2/ResourceTypes", scim(authHandler.SCIMResourceTypes))
+	mux.Handle("GET /scim/v2/Users", scim(authHandler.SCIMListUsers))
+	mux.Handle("POST /scim/v2/Users", scim(authHandler.SCIMCreateUser))
+	mux.Handle("GET /scim/v2/Users/{id}", scim(authHandler.SCIMGetUser))
+	mux.Handle("PUT /scim/v2/Users/{id}", scim(authHandler.SCIMReplaceUser))
+	mux.Handle("PATCH /scim/v2/Users/{id}", scim(authHandler.SCIMPatchUser))
+	mux.Handle("DELETE /scim/v2/Users/{id}", scim(authHandler.SCIMDeleteUser))
+	mux.Handle("GET /scim/v2/Groups", scim(authHandler.SCIMListGroups))
+	mux.Handle("POST /scim/v2/Groups", scim(authHandler.SCIMCreateGroup))
+	mux.Handle("GET /scim/v2/Groups/{id}", scim(authHandler.SCIMGetGroup))
+	mux.Handle("PUT /scim/v2/Groups/{id}", scim(authHandler.SCIMReplaceGroup))
+	mux.Handle("PATCH /scim/v2/Groups/{id}", scim(authHandler.SCIMPatchGroup))
+	mux.Handle("DELETE /scim/v2/Groups/{id}", scim(authHandler.SCIMDeleteGroup))
 
 	// Apply CORS middleware
 	handler := middleware.CORS(mux)
@@ -129,3 +269,17 @@ func main() {
 
 	log.Println("Server exited")
 }
+
+// durationEnv reads a duration such as "15m" from the environment, returning 0 if unset or invalid
+func durationEnv(key string) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Ignoring invalid %s %q: %v", key, value, err)
+		return 0
+	}
+	return d
+}
@@ -0,0 +1,208 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jareynolds/ubecode/internal/auth"
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/jareynolds/ubecode/pkg/repository"
+)
+
+// defaultUserID is used for requests that carry no token
+const defaultUserID = 1
+
+// pathRecordTypes maps the first path segment of /{resource}/{id}/... routes to the record
+// whose workspace governs access
+var pathRecordTypes = map[string]string{
+	"capabilities": repository.RecordCapability,
+	"enablers":     repository.RecordEnabler,
+	"requirements": repository.RecordRequirement,
+	"criteria":     repository.RecordCriteria,
+	"approvals":    repository.RecordApproval,
+}
+
+// tokenAuth verifies bearer tokens (JWTs or personal access tokens), enforces API token
+// scopes and role permissions, and stores the caller's access grant in the request context.
+// Without an auth service requests run as the default user with full access (legacy
+// anonymous mode); with one, requests without a token hold no permissions and are rejected
+// by any route that needs one, or by every route when requireAuth is set.
+func tokenAuth(authService *auth.Service, rbacRepo *repository.RBACRepository, requireAuth bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if r.Method == http.MethodOptions || r.URL.Path == "/health" || authService == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Error responses still need CORS headers for the browser to read them
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		if header == "" && !requireAuth {
+			if auth.PermissionForRequest(r.Method, r.URL.Path) != "" {
+				http.Error(w, "Authorization required", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "access", &models.AccessGrant{})))
+			return
+		}
+
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			http.Error(w, "Authorization required", http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := authService.VerifyToken(token)
+		if err != nil {
+			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+			return
+		}
+
+		if scope := auth.ScopeForRequest(r.Method, r.URL.Path); !claims.HasScope(scope) {
+			http.Error(w, fmt.Sprintf("Token lacks required scope: %s", scope), http.StatusForbidden)
+			return
+		}
+
+		grant, err := rbacRepo.GetAccessGrant(claims.UserID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to load permissions: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		permission := auth.PermissionForRequest(r.Method, r.URL.Path)
+		if !grant.CanAnywhere(permission) {
+			http.Error(w, fmt.Sprintf("Missing permission: %s", permission), http.StatusForbidden)
+			return
+		}
+
+		// Routes addressing a single record are checked against the record's workspace
+		segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if recordType, ok := pathRecordTypes[segments[0]]; ok && len(segments) > 1 {
+			if id, err := strconv.Atoi(segments[1]); err == nil {
+				workspaceID, found, err := rbacRepo.RecordWorkspace(recordType, id)
+				if err != nil {
+					http.Error(w, fmt.Sprintf("Failed to check access: %v", err), http.StatusInternalServerError)
+					return
+				}
+				if found && !grant.CanInWorkspace(permission, workspaceID) {
+					http.Error(w, fmt.Sprintf("Missing permission in this workspace: %s", permission), http.StatusForbidden)
+					return
+				}
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), "claims", claims)
+		ctx = context.WithValue(ctx, "access", grant)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestUserID returns the authenticated user, or the default user in legacy anonymous mode
+func requestUserID(r *http.Request) int {
+	if claims, ok := r.Context().Value("claims").(*auth.Claims); ok {
+		return claims.UserID
+	}
+	return defaultUserID
+}
+
+// requireMFA responds with 403 unless the caller's session was started with a second factor.
+// Anonymous callers in legacy mode are not restricted, as with the other checks.
+func requireMFA(w http.ResponseWriter, r *http.Request, action string) bool {
+	claims, ok := r.Context().Value("claims").(*auth.Claims)
+	if !ok || claims.MFA {
+		return true
+	}
+	http.Error(w, fmt.Sprintf("%s requires signing in with multi-factor authentication", action), http.StatusForbidden)
+	return false
+}
+
+// requestGrant returns the caller's access grant, or nil when access is unrestricted, which
+// is only the case in legacy anonymous mode
+func requestGrant(r *http.Request) *models.AccessGrant {
+	grant, _ := r.Context().Value("access").(*models.AccessGrant)
+	return grant
+}
+
+// canInWorkspace reports whether the caller holds permission for records in workspaceID
+func canInWorkspace(r *http.Request, permission string, workspaceID *int) bool {
+	grant := requestGrant(r)
+	return grant == nil || grant.CanInWorkspace(permission, workspaceID)
+}
+
+// authorizeRecord checks permission on the workspace of a record named in a request body,
+// responding with 403 when it is missing
+func (s *Server) authorizeRecord(w http.ResponseWriter, r *http.Request, recordType string, id int, permission string) bool {
+	if requestGrant(r) == nil {
+		return true
+	}
+
+	workspaceID, found, err := s.rbacRepo.RecordWorkspace(recordType, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check access: %v", err), http.StatusInternalServerError)
+		return false
+	}
+	if found && !canInWorkspace(r, permission, workspaceID) {
+		http.Error(w, fmt.Sprintf("Missing permission in this workspace: %s", permission), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// recordFilter returns a predicate telling whether the caller holds permission for a
+// capability, enabler or requirement, for filtering lists
+func (s *Server) recordFilter(r *http.Request, permission string) (func(entityType string, id int) bool, error) {
+	grant := requestGrant(r)
+	if grant == nil {
+		return func(string, int) bool { return true }, nil
+	}
+
+	records, err := s.rbacRepo.GetRecordWorkspaces()
+	if err != nil {
+		return nil, err
+	}
+	return func(entityType string, id int) bool {
+		return grant.CanInWorkspace(permission, records.EntityWorkspace(entityType, id))
+	}, nil
+}
+
+// searchRestrictions limits a search to the workspaces the caller may search
+func (s *Server) searchRestrictions(r *http.Request, query *models.SearchQuery) error {
+	grant := requestGrant(r)
+	if grant == nil {
+		return nil
+	}
+
+	keys, err := s.rbacRepo.WorkspaceSearchKeys()
+	if err != nil {
+		return err
+	}
+
+	// Without the global permission only explicitly granted workspaces are searchable;
+	// otherwise spec folders that no workspace claims stay visible
+	if !grant.Can(models.PermSearchRead) {
+		query.OnlyWorkspaces = []string{}
+		for _, id := range grant.WorkspaceIDsWith(models.PermSearchRead) {
+			query.OnlyWorkspaces = append(query.OnlyWorkspaces, keys[id])
+		}
+		return nil
+	}
+	for id, key := range keys {
+		workspaceID := id
+		if !grant.CanInWorkspace(models.PermSearchRead, &workspaceID) {
+			query.HiddenWorkspaces = append(query.HiddenWorkspaces, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/jareynolds/ubecode/pkg/repository"
+	"github.com/jareynolds/ubecode/pkg/workflow"
+)
+
+// evaluateReadiness gathers a capability's enablers, criteria and assets and runs the stage gates
+func (s *Server) evaluateReadiness(capabilityID int, stage, phase string) (*models.ReadinessReport, error) {
+	capability, err := s.capRepo.GetByID(capabilityID)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := s.gateRepo.GetRules(stage)
+	if err != nil {
+		return nil, err
+	}
+
+	enablers, err := s.enablerRepo.GetByCapabilityID(capabilityID)
+	if err != nil {
+		return nil, err
+	}
+
+	in := workflow.GateInput{
+		Capability: capability,
+		Enablers:   enablers,
+	}
+
+	// Criteria may be attached to the capability itself or to any of its enablers
+	entities := []struct {
+		entityType string
+		id         int
+	}{{models.EntityTypeCapability, capabilityID}}
+	for _, e := range enablers {
+		entities = append(entities, struct {
+			entityType string
+			id         int
+		}{models.EntityTypeEnabler, e.ID})
+	}
+
+	for _, entity := range entities {
+		criteria, err := s.criteriaRepo.GetByEntity(entity.entityType, entity.id)
+		if err != nil {
+			return nil, err
+		}
+		in.Criteria = append(in.Criteria, criteria...)
+
+		summary, err := s.criteriaRepo.GetSummary(entity.entityType, entity.id)
+		if err != nil {
+			return nil, err
+		}
+		in.Summaries = append(in.Summaries, *summary)
+	}
+
+	report := workflow.EvaluateReadiness(rules, stage, phase, in)
+	return &report, nil
+}
+
+// respondNotReady writes a 422 with the readiness report listing unmet conditions
+func respondNotReady(w http.ResponseWriter, message string, report *models.ReadinessReport) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":     message,
+		"readiness": report,
+	})
+}
+
+// Stage Gate Handlers
+
+func (s *Server) handleGetReadiness(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid capability ID", http.StatusBadRequest)
+		return
+	}
+
+	stage := r.URL.Query().Get("stage")
+	if !models.IsValidStage(stage) {
+		http.Error(w, "Invalid stage. Must be one of: specification, definition, design, execution", http.StatusBadRequest)
+		return
+	}
+
+	phase := r.URL.Query().Get("phase")
+	if phase == "" {
+		phase = models.GatePhaseRequest
+	}
+	if phase != models.GatePhaseRequest && phase != models.GatePhaseApproval {
+		http.Error(w, "Invalid phase. Must be one of: request, approval", http.StatusBadRequest)
+		return
+	}
+
+	report, err := s.evaluateReadiness(id, stage, phase)
+	if err != nil {
+		writeReadinessError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// writeReadinessError responds to a failed readiness evaluation: 404 when the capability
+// does not exist, 500 otherwise
+func writeReadinessError(w http.ResponseWriter, err error) {
+	if errors.Is(err, repository.ErrCapabilityNotFound) {
+		http.Error(w, "Capability not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, fmt.Sprintf("Failed to evaluate readiness: %v", err), http.StatusInternalServerError)
+}
+
+func (s *Server) handleGetGateRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := s.gateRepo.GetRules(r.URL.Query().Get("stage"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get stage gate rules: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"rules": rules,
+	})
+}
+
+func (s *Server) handleCreateGateRule(w http.ResponseWriter, r *http.Request) {
+	var req models.SaveStageGateRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if msg := validateGateRule(&req); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	rule, err := s.gateRepo.Create(req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create stage gate rule: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule)
+}
+
+func (s *Server) handleUpdateGateRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.SaveStageGateRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if msg := validateGateRule(&req); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	rule, err := s.gateRepo.Update(id, req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update stage gate rule: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+}
+
+func (s *Server) handleDeleteGateRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.gateRepo.Delete(id); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to delete stage gate rule: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Stage gate rule deleted successfully",
+	})
+}
+
+// validateGateRule checks a rule request and fills in the default phase
+func validateGateRule(req *models.SaveStageGateRuleRequest) string {
+	if !models.IsValidStage(req.Stage) {
+		return "Invalid stage. Must be one of: specification, definition, design, execution"
+	}
+	if !models.IsValidGateCheckType(req.CheckType) {
+		return "Invalid check_type"
+	}
+	if req.AppliesTo == "" {
+		req.AppliesTo = models.GatePhaseBoth
+	}
+	if req.AppliesTo != models.GatePhaseRequest && req.AppliesTo != models.GatePhaseApproval && req.AppliesTo != models.GatePhaseBoth {
+		return "Invalid applies_to. Must be one of: request, approval, both"
+	}
+	if len(req.Params) > 0 && !json.Valid(req.Params) {
+		return "params must be valid JSON"
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jareynolds/ubecode/pkg/repository"
+)
+
+// emptyDriver is a database whose queries all return no rows
+type emptyDriver struct{}
+
+func (emptyDriver) Open(string) (driver.Conn, error) { return emptyConn{}, nil }
+
+type emptyConn struct{}
+
+func (emptyConn) Prepare(string) (driver.Stmt, error) { return emptyStmt{}, nil }
+func (emptyConn) Close() error                        { return nil }
+func (emptyConn) Begin() (driver.Tx, error)           { return nil, driver.ErrSkip }
+
+type emptyStmt struct{}
+
+func (emptyStmt) Close() error                               { return nil }
+func (emptyStmt) NumInput() int                              { return -1 }
+func (emptyStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(0), nil }
+func (emptyStmt) Query([]driver.Value) (driver.Rows, error)  { return emptyRows{}, nil }
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string         { return nil }
+func (emptyRows) Close() error              { return nil }
+func (emptyRows) Next([]driver.Value) error { return io.EOF }
+
+func init() {
+	sql.Register("empty", emptyDriver{})
+}
+
+func TestReadinessMissingCapability(t *testing.T) {
+	db, err := sql.Open("empty", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s := &Server{capRepo: repository.NewCapabilityRepository(db)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /capabilities/{id}/readiness", s.handleGetReadiness)
+	mux.HandleFunc("POST /approvals/request", s.handleRequestApproval)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"readiness", "GET", "/capabilities/99/readiness?stage=design", ""},
+		{"approval request", "POST", "/approvals/request", `{"capability_id":99,"stage":"design"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("expected status %d, got %d (%s)", http.StatusNotFound, rec.Code, strings.TrimSpace(rec.Body.String()))
+			}
+		})
+	}
+}
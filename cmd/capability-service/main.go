@@ -11,6 +11,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -21,9 +22,12 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/jareynolds/ubecode/internal/auth"
 	"github.com/jareynolds/ubecode/pkg/database"
 	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/jareynolds/ubecode/pkg/notification"
 	"github.com/jareynolds/ubecode/pkg/repository"
+	"github.com/jareynolds/ubecode/pkg/workflow"
 )
 
 type Server struct {
@@ -31,6 +35,11 @@ type Server struct {
 	approvalRepo *repository.ApprovalRepository
 	enablerRepo  *repository.EnablerRepository
 	criteriaRepo *repository.AcceptanceCriteriaRepository
+	notifRepo    *repository.NotificationRepository
+	notifier     *notification.Notifier
+	gateRepo     *repository.StageGateRepository
+	searchRepo   *repository.SearchRepository
+	rbacRepo     *repository.RBACRepository
 }
 
 func main() {
@@ -69,12 +78,39 @@ func main() {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
+	notifRepo := repository.NewNotificationRepository(db.DB)
+
 	server := &Server{
 		capRepo:      repository.NewCapabilityRepository(db.DB),
 		approvalRepo: repository.NewApprovalRepository(db.DB),
 		enablerRepo:  repository.NewEnablerRepository(db.DB),
 		criteriaRepo: repository.NewAcceptanceCriteriaRepository(db.DB),
+		notifRepo:    notifRepo,
+		notifier:     notification.NewNotifier(notifRepo, notification.ConfigFromEnv()),
+		gateRepo:     repository.NewStageGateRepository(db.DB),
+		searchRepo:   repository.NewSearchRepository(db.DB),
+		rbacRepo:     repository.NewRBACRepository(db.DB),
+	}
+
+	// Daily digest of pending approvals, sent at NOTIFICATION_DIGEST_HOUR (local time, default 8)
+	digestHour := 8
+	if h, err := strconv.Atoi(os.Getenv("NOTIFICATION_DIGEST_HOUR")); err == nil && h >= 0 && h < 24 {
+		digestHour = h
+	}
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	go notification.RunDaily(bgCtx, digestHour, func(ctx context.Context) {
+		if err := server.sendApprovalDigest(ctx); err != nil {
+			log.Printf("Approval digest failed: %v", err)
+		}
+	})
+
+	// Approval SLA reminders and escalation, checked every APPROVAL_SLA_CHECK_INTERVAL (default 15m)
+	slaInterval := 15 * time.Minute
+	if d, err := time.ParseDuration(os.Getenv("APPROVAL_SLA_CHECK_INTERVAL")); err == nil && d > 0 {
+		slaInterval = d
 	}
+	go server.runSLAScheduler(bgCtx, slaInterval)
 
 	mux := http.NewServeMux()
 
@@ -204,6 +240,20 @@ func main() {
 		w.WriteHeader(http.StatusOK)
 	}))
 
+	// Approval SLA endpoints
+	mux.HandleFunc("GET /approvals/sla-rules", corsMiddleware(server.handleGetSLARules))
+	mux.HandleFunc("POST /approvals/sla-check", corsMiddleware(server.handleRunSLACheck))
+	mux.HandleFunc("PUT /approvals/sla-rules/{stage}", corsMiddleware(server.handleUpdateSLARule))
+	mux.HandleFunc("OPTIONS /approvals/sla-rules", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	mux.HandleFunc("OPTIONS /approvals/sla-check", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	mux.HandleFunc("OPTIONS /approvals/sla-rules/{stage}", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
 	// Role permissions endpoint - separate path to avoid conflict with /approvals/{id}
 	mux.HandleFunc("GET /approval-permissions/{role}", corsMiddleware(server.handleGetUserPermissions))
 	mux.HandleFunc("OPTIONS /approval-permissions/{role}", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
@@ -228,6 +278,22 @@ func main() {
 		w.WriteHeader(http.StatusOK)
 	}))
 
+	// Stage gate endpoints
+	mux.HandleFunc("GET /capabilities/{id}/readiness", corsMiddleware(server.handleGetReadiness))
+	mux.HandleFunc("OPTIONS /capabilities/{id}/readiness", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	mux.HandleFunc("GET /stage-gates", corsMiddleware(server.handleGetGateRules))
+	mux.HandleFunc("POST /stage-gates", corsMiddleware(server.handleCreateGateRule))
+	mux.HandleFunc("OPTIONS /stage-gates", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	mux.HandleFunc("PUT /stage-gates/{id}", corsMiddleware(server.handleUpdateGateRule))
+	mux.HandleFunc("DELETE /stage-gates/{id}", corsMiddleware(server.handleDeleteGateRule))
+	mux.HandleFunc("OPTIONS /stage-gates/{id}", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
 	mux.HandleFunc("GET /capabilities/{id}/approvals", corsMiddleware(server.handleGetApprovalHistory))
 	mux.HandleFunc("GET /capabilities/{id}/audit-log", corsMiddleware(server.handleGetAuditLog))
 	mux.HandleFunc("OPTIONS /capabilities/{id}/approvals", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
@@ -237,9 +303,68 @@ func main() {
 		w.WriteHeader(http.StatusOK)
 	}))
 
+	// Notification endpoints
+	mux.HandleFunc("GET /notifications", corsMiddleware(server.handleGetNotifications))
+	mux.HandleFunc("OPTIONS /notifications", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	mux.HandleFunc("POST /notifications/read-all", corsMiddleware(server.handleMarkAllNotificationsRead))
+	mux.HandleFunc("OPTIONS /notifications/read-all", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	mux.HandleFunc("GET /notifications/preferences", corsMiddleware(server.handleGetNotificationPreferences))
+	mux.HandleFunc("PUT /notifications/preferences", corsMiddleware(server.handleUpdateNotificationPreference))
+	mux.HandleFunc("OPTIONS /notifications/preferences", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	mux.HandleFunc("POST /notifications/events", corsMiddleware(server.handlePublishNotificationEvent))
+	mux.HandleFunc("OPTIONS /notifications/events", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	mux.HandleFunc("POST /notifications/digest", corsMiddleware(server.handleSendApprovalDigest))
+	mux.HandleFunc("OPTIONS /notifications/digest", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	mux.HandleFunc("POST /notifications/{id}/read", corsMiddleware(server.handleMarkNotificationRead))
+	mux.HandleFunc("OPTIONS /notifications/{id}/read", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Search endpoints
+	mux.HandleFunc("GET /search", corsMiddleware(server.handleSearch))
+	mux.HandleFunc("OPTIONS /search", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	mux.HandleFunc("POST /search/documents", corsMiddleware(server.handleIndexDocuments))
+	mux.HandleFunc("OPTIONS /search/documents", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	mux.HandleFunc("POST /search/reindex", corsMiddleware(server.handleReindexRecords))
+	mux.HandleFunc("OPTIONS /search/reindex", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Bearer tokens are verified against the shared users and tokens tables when JWT_SECRET is set
+	var authService *auth.Service
+	if jwtSecret := os.Getenv("JWT_SECRET"); jwtSecret != "" {
+		authService = auth.NewService(db.DB, jwtSecret)
+	} else {
+		log.Println("JWT_SECRET not set; bearer tokens will not be verified")
+	}
+
+	// Every request needs a token unless REQUIRE_AUTH=false; anonymous requests then hold no
+	// permissions, or act as the default user in legacy mode without JWT_SECRET
+	requireAuth := os.Getenv("REQUIRE_AUTH") != "false"
+	if requireAuth && authService == nil {
+		log.Fatal("REQUIRE_AUTH needs JWT_SECRET to verify tokens; set REQUIRE_AUTH=false for legacy anonymous access")
+	}
+	if authService == nil {
+		log.Println("Legacy anonymous mode: requests are not authenticated")
+	}
+
 	httpServer := &http.Server{
 		Addr:         fmt.Sprintf(":%s", port),
-		Handler:      mux,
+		Handler:      tokenAuth(authService, server.rbacRepo, requireAuth, mux),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -257,6 +382,7 @@ func main() {
 	<-quit
 
 	log.Println("Server is shutting down...")
+	stopBackground()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -274,12 +400,19 @@ func main() {
 }
 
 func (s *Server) handleGetCapabilities(w http.ResponseWriter, r *http.Request) {
-	capabilities, err := s.capRepo.GetAll()
+	all, err := s.capRepo.GetAll()
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to get capabilities: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	capabilities := []models.Capability{}
+	for _, c := range all {
+		if canInWorkspace(r, models.PermCapabilitiesRead, c.WorkspaceID) {
+			capabilities = append(capabilities, c)
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"capabilities": capabilities,
@@ -295,6 +428,10 @@ func (s *Server) handleGetCapability(w http.ResponseWriter, r *http.Request) {
 	}
 
 	capability, err := s.capRepo.GetByID(id)
+	if errors.Is(err, repository.ErrCapabilityNotFound) {
+		http.Error(w, "Capability not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to get capability: %v", err), http.StatusInternalServerError)
 		return
@@ -311,15 +448,19 @@ func (s *Server) handleCreateCapability(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// For now, use a default user ID (1 = admin)
-	// In production, this should come from authentication middleware
-	userID := 1
+	if !canInWorkspace(r, models.PermCapabilitiesWrite, req.WorkspaceID) {
+		http.Error(w, "Missing permission in this workspace: "+models.PermCapabilitiesWrite, http.StatusForbidden)
+		return
+	}
+
+	userID := requestUserID(r)
 
 	capability, err := s.capRepo.Create(req, userID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to create capability: %v", err), http.StatusInternalServerError)
 		return
 	}
+	s.indexRecord(repository.SearchRecordCapability, capability.ID)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -345,6 +486,7 @@ func (s *Server) handleUpdateCapability(w http.ResponseWriter, r *http.Request)
 		http.Error(w, fmt.Sprintf("Failed to update capability: %v", err), http.StatusInternalServerError)
 		return
 	}
+	s.indexRecord(repository.SearchRecordCapability, id)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(capability)
@@ -362,6 +504,7 @@ func (s *Server) handleDeleteCapability(w http.ResponseWriter, r *http.Request)
 		http.Error(w, fmt.Sprintf("Failed to delete capability: %v", err), http.StatusInternalServerError)
 		return
 	}
+	s.indexRecord(repository.SearchRecordCapability, id)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
@@ -384,9 +527,22 @@ func (s *Server) handleRequestApproval(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// For now, use a default user ID (1 = admin)
-	// In production, this should come from authentication middleware
-	userID := 1
+	if !s.authorizeRecord(w, r, repository.RecordCapability, req.CapabilityID, models.PermApprovalsWrite) {
+		return
+	}
+
+	// Stage gates must be met before the request is accepted
+	readiness, err := s.evaluateReadiness(req.CapabilityID, req.Stage, models.GatePhaseRequest)
+	if err != nil {
+		writeReadinessError(w, err)
+		return
+	}
+	if !readiness.Ready {
+		respondNotReady(w, "Capability is not ready for this stage", readiness)
+		return
+	}
+
+	userID := requestUserID(r)
 
 	approval, err := s.approvalRepo.RequestApproval(req.CapabilityID, req.Stage, userID)
 	if err != nil {
@@ -394,6 +550,8 @@ func (s *Server) handleRequestApproval(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.notifyApprovalRequested(approval)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(approval)
@@ -406,34 +564,56 @@ func (s *Server) handleGetPendingApprovals(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Calculate counts by stage
-	byStage := make(map[string]int)
-	for _, a := range approvals {
-		byStage[string(a.Stage)]++
+	// Optional filters: ?min_age_hours=48 and/or ?breached=true|false
+	minAgeHours, _ := strconv.ParseFloat(r.URL.Query().Get("min_age_hours"), 64)
+	var breached *bool
+	if v, err := strconv.ParseBool(r.URL.Query().Get("breached")); err == nil {
+		breached = &v
 	}
 
+	slaRules, err := s.approvalRepo.GetSLARules()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get SLA rules: %v", err), http.StatusInternalServerError)
+		return
+	}
+	byStageRule := workflow.IndexSLARules(slaRules)
+	now := time.Now()
+
 	response := models.PendingApprovalsResponse{
-		Approvals:  make([]models.ApprovalResponse, len(approvals)),
-		TotalCount: len(approvals),
-		ByStage:    byStage,
+		Approvals: []models.ApprovalResponse{},
+		ByStage:   make(map[string]int),
 	}
 
-	// Enrich each approval with capability name and permissions
+	// Enrich each approval with capability name, permissions and SLA standing
 	for i, a := range approvals {
+		sla := workflow.EvaluateSLA(a, byStageRule[string(a.Stage)], now)
+		if !workflow.MatchesAgeFilter(sla, minAgeHours, breached) {
+			continue
+		}
+
 		cap, _ := s.capRepo.GetByID(a.CapabilityID)
 		capName := ""
+		var workspaceID *int
 		if cap != nil {
 			capName = cap.Name
+			workspaceID = cap.WorkspaceID
+		}
+		if !canInWorkspace(r, models.PermApprovalsRead, workspaceID) {
+			continue
 		}
+		canDecide := canInWorkspace(r, models.PermApprovalsWrite, workspaceID)
 
-		response.Approvals[i] = models.ApprovalResponse{
+		response.Approvals = append(response.Approvals, models.ApprovalResponse{
 			Approval:       &approvals[i],
 			CapabilityName: capName,
-			CanApprove:     true,  // Would check user permissions in production
-			CanReject:      true,  // Would check user permissions in production
+			CanApprove:     canDecide,
+			CanReject:      canDecide,
 			CanWithdraw:    false, // Only requester can withdraw
-		}
+			SLA:            &sla,
+		})
+		response.ByStage[string(a.Stage)]++
 	}
+	response.TotalCount = len(response.Approvals)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -474,8 +654,27 @@ func (s *Server) handleApprove(w http.ResponseWriter, r *http.Request) {
 		req = models.ApprovalDecisionRequest{}
 	}
 
-	// For now, use a default user ID (1 = admin)
-	userID := 1
+	// Stage gates are re-checked at decision time, since criteria may have changed since the request
+	pending, err := s.approvalRepo.GetApprovalByID(id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get approval: %v", err), http.StatusNotFound)
+		return
+	}
+	// Execution sign-off releases work, so compliance requires a second factor
+	if pending.Stage == models.StageExecution && !requireMFA(w, r, "Execution approval") {
+		return
+	}
+	readiness, err := s.evaluateReadiness(pending.CapabilityID, string(pending.Stage), models.GatePhaseApproval)
+	if err != nil {
+		writeReadinessError(w, err)
+		return
+	}
+	if !readiness.Ready {
+		respondNotReady(w, "Capability does not meet the stage gate for approval", readiness)
+		return
+	}
+
+	userID := requestUserID(r)
 
 	approval, err := s.approvalRepo.Approve(id, userID, req.Feedback)
 	if err != nil {
@@ -483,6 +682,9 @@ func (s *Server) handleApprove(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.notifyApprovalDecided(approval)
+	s.indexRecord(repository.SearchRecordCapability, approval.CapabilityID)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(approval)
 }
@@ -509,8 +711,7 @@ func (s *Server) handleReject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// For now, use a default user ID (1 = admin)
-	userID := 1
+	userID := requestUserID(r)
 
 	approval, err := s.approvalRepo.Reject(id, userID, req.Feedback)
 	if err != nil {
@@ -518,6 +719,9 @@ func (s *Server) handleReject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.notifyApprovalDecided(approval)
+	s.indexRecord(repository.SearchRecordCapability, approval.CapabilityID)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(approval)
 }
@@ -533,8 +737,7 @@ func (s *Server) handleWithdraw(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// For now, use a default user ID (1 = admin)
-	userID := 1
+	userID := requestUserID(r)
 
 	approval, err := s.approvalRepo.Withdraw(id, userID)
 	if err != nil {
@@ -651,12 +854,24 @@ func extractIDFromPath(path, prefix string) string {
 // =====================================================
 
 func (s *Server) handleGetEnablers(w http.ResponseWriter, r *http.Request) {
-	enablers, err := s.enablerRepo.GetAll()
+	all, err := s.enablerRepo.GetAll()
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to get enablers: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	visible, err := s.recordFilter(r, models.PermCapabilitiesRead)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check access: %v", err), http.StatusInternalServerError)
+		return
+	}
+	enablers := []models.Enabler{}
+	for _, e := range all {
+		if visible(repository.RecordEnabler, e.ID) {
+			enablers = append(enablers, e)
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"enablers": enablers,
@@ -688,13 +903,18 @@ func (s *Server) handleCreateEnabler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID := 1 // Default user ID
+	if !s.authorizeRecord(w, r, repository.RecordCapability, req.CapabilityID, models.PermCapabilitiesWrite) {
+		return
+	}
+
+	userID := requestUserID(r)
 
 	enabler, err := s.enablerRepo.Create(req, userID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to create enabler: %v", err), http.StatusInternalServerError)
 		return
 	}
+	s.indexRecord(repository.SearchRecordEnabler, enabler.ID)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -720,6 +940,7 @@ func (s *Server) handleUpdateEnabler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("Failed to update enabler: %v", err), http.StatusInternalServerError)
 		return
 	}
+	s.indexRecord(repository.SearchRecordEnabler, id)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(enabler)
@@ -737,6 +958,7 @@ func (s *Server) handleDeleteEnabler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("Failed to delete enabler: %v", err), http.StatusInternalServerError)
 		return
 	}
+	s.indexRecord(repository.SearchRecordEnabler, id)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
@@ -811,13 +1033,14 @@ func (s *Server) handleCreateRequirement(w http.ResponseWriter, r *http.Request)
 	}
 
 	req.EnablerID = enablerID
-	userID := 1 // Default user ID
+	userID := requestUserID(r)
 
 	requirement, err := s.enablerRepo.CreateRequirement(req, userID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to create requirement: %v", err), http.StatusInternalServerError)
 		return
 	}
+	s.indexRecord(repository.SearchRecordRequirement, requirement.ID)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -861,6 +1084,7 @@ func (s *Server) handleUpdateRequirement(w http.ResponseWriter, r *http.Request)
 		http.Error(w, fmt.Sprintf("Failed to update requirement: %v", err), http.StatusInternalServerError)
 		return
 	}
+	s.indexRecord(repository.SearchRecordRequirement, id)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(requirement)
@@ -878,6 +1102,7 @@ func (s *Server) handleDeleteRequirement(w http.ResponseWriter, r *http.Request)
 		http.Error(w, fmt.Sprintf("Failed to delete requirement: %v", err), http.StatusInternalServerError)
 		return
 	}
+	s.indexRecord(repository.SearchRecordRequirement, id)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
@@ -901,13 +1126,14 @@ func (s *Server) handleVerifyRequirement(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	userID := 1 // Default user ID
+	userID := requestUserID(r)
 
 	requirement, err := s.enablerRepo.VerifyRequirement(id, userID, req)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to verify requirement: %v", err), http.StatusInternalServerError)
 		return
 	}
+	s.indexRecord(repository.SearchRecordRequirement, id)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(requirement)
@@ -921,12 +1147,24 @@ func (s *Server) handleGetAllCriteria(w http.ResponseWriter, r *http.Request) {
 	entityType := r.URL.Query().Get("entity_type")
 	status := r.URL.Query().Get("status")
 
-	criteria, err := s.criteriaRepo.GetAll(entityType, status)
+	all, err := s.criteriaRepo.GetAll(entityType, status)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to get criteria: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	visible, err := s.recordFilter(r, models.PermCapabilitiesRead)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check access: %v", err), http.StatusInternalServerError)
+		return
+	}
+	criteria := []models.AcceptanceCriteria{}
+	for _, c := range all {
+		if visible(c.EntityType, c.EntityID) {
+			criteria = append(criteria, c)
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"criteria": criteria,
@@ -970,6 +1208,7 @@ func (s *Server) handleUpdateCriteria(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("Failed to update criteria: %v", err), http.StatusInternalServerError)
 		return
 	}
+	s.indexRecord(repository.SearchRecordCriteria, id)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(criteria)
@@ -987,6 +1226,7 @@ func (s *Server) handleDeleteCriteria(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("Failed to delete criteria: %v", err), http.StatusInternalServerError)
 		return
 	}
+	s.indexRecord(repository.SearchRecordCriteria, id)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
@@ -1010,13 +1250,18 @@ func (s *Server) handleVerifyCriteria(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID := 1 // Default user ID
+	userID := requestUserID(r)
 
 	criteria, err := s.criteriaRepo.Verify(id, userID, req)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to verify criteria: %v", err), http.StatusInternalServerError)
 		return
 	}
+	s.indexRecord(repository.SearchRecordCriteria, id)
+
+	if criteria.Status == "failed" {
+		s.notifyCriteriaFailed(criteria)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(criteria)
@@ -1066,13 +1311,14 @@ func (s *Server) handleCreateCapabilityCriteria(w http.ResponseWriter, r *http.R
 
 	req.EntityType = "capability"
 	req.EntityID = capabilityID
-	userID := 1 // Default user ID
+	userID := requestUserID(r)
 
 	criteria, err := s.criteriaRepo.Create(req, userID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to create criteria: %v", err), http.StatusInternalServerError)
 		return
 	}
+	s.indexRecord(repository.SearchRecordCriteria, criteria.ID)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -1123,13 +1369,14 @@ func (s *Server) handleCreateEnablerCriteria(w http.ResponseWriter, r *http.Requ
 
 	req.EntityType = "enabler"
 	req.EntityID = enablerID
-	userID := 1 // Default user ID
+	userID := requestUserID(r)
 
 	criteria, err := s.criteriaRepo.Create(req, userID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to create criteria: %v", err), http.StatusInternalServerError)
 		return
 	}
+	s.indexRecord(repository.SearchRecordCriteria, criteria.ID)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -0,0 +1,288 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/jareynolds/ubecode/pkg/notification"
+)
+
+// Notification Handlers
+
+func (s *Server) handleGetNotifications(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	notifications, err := s.notifRepo.GetByUser(userID, unreadOnly, limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get notifications: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	unread, err := s.notifRepo.CountUnread(userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to count notifications: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.NotificationListResponse{
+		Notifications: notifications,
+		UnreadCount:   unread,
+	})
+}
+
+func (s *Server) handleMarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid notification ID", http.StatusBadRequest)
+		return
+	}
+
+	userID := requestUserID(r)
+
+	if err := s.notifRepo.MarkRead(id, userID); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to mark notification as read: %v", err), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Notification marked as read",
+	})
+}
+
+func (s *Server) handleMarkAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	count, err := s.notifRepo.MarkAllRead(userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to mark notifications as read: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Notifications marked as read",
+		"count":   count,
+	})
+}
+
+func (s *Server) handleGetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	userID := requestUserID(r)
+
+	prefs, err := s.notifRepo.GetPreferences(userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get notification preferences: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"preferences": prefs,
+	})
+}
+
+func (s *Server) handleUpdateNotificationPreference(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateNotificationPreferenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if !models.IsValidNotificationEventType(req.EventType) {
+		http.Error(w, "Invalid event type", http.StatusBadRequest)
+		return
+	}
+
+	userID := requestUserID(r)
+
+	pref := models.NotificationPreference{
+		UserID:       userID,
+		EventType:    models.NotificationEventType(req.EventType),
+		InAppEnabled: req.InAppEnabled,
+		EmailEnabled: req.EmailEnabled,
+		SlackEnabled: req.SlackEnabled,
+		TeamsEnabled: req.TeamsEnabled,
+	}
+	if err := s.notifRepo.SavePreference(pref); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to save notification preference: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pref)
+}
+
+// handlePublishNotificationEvent lets other services (e.g. integration-service) raise events.
+// Events go to whichever users and roles they name, so tokenAuth only lets callers holding
+// notifications:publish (admins and the service accounts given it) through.
+func (s *Server) handlePublishNotificationEvent(w http.ResponseWriter, r *http.Request) {
+	var event models.NotificationEvent
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if !models.IsValidNotificationEventType(string(event.Type)) || event.Type == models.EventApprovalDigest {
+		http.Error(w, "Invalid event type", http.StatusBadRequest)
+		return
+	}
+	if len(event.UserIDs) == 0 && len(event.Roles) == 0 {
+		http.Error(w, "At least one of user_ids or roles is required", http.StatusBadRequest)
+		return
+	}
+
+	s.notifier.PublishAsync(event)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Notification event accepted",
+	})
+}
+
+func (s *Server) handleSendApprovalDigest(w http.ResponseWriter, r *http.Request) {
+	if err := s.sendApprovalDigest(r.Context()); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to send approval digest: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Approval digest sent",
+	})
+}
+
+// sendApprovalDigest emails every approver role the list of approvals waiting on it
+func (s *Server) sendApprovalDigest(ctx context.Context) error {
+	rules, err := s.approvalRepo.GetWorkflowRules()
+	if err != nil {
+		return err
+	}
+
+	approvals, err := s.approvalRepo.GetPendingApprovals()
+	if err != nil {
+		return err
+	}
+	if len(approvals) == 0 {
+		return nil
+	}
+
+	pending := make([]models.ApprovalResponse, len(approvals))
+	for i := range approvals {
+		pending[i] = models.ApprovalResponse{
+			Approval:       &approvals[i],
+			CapabilityName: s.capabilityName(approvals[i].CapabilityID),
+		}
+	}
+
+	return s.notifier.SendApprovalDigest(ctx, rules, pending)
+}
+
+// notifyApprovalRequested tells every role that can approve the stage
+func (s *Server) notifyApprovalRequested(approval *models.CapabilityApproval) {
+	rules, err := s.approvalRepo.GetWorkflowRules()
+	if err != nil {
+		log.Printf("Failed to load workflow rules for notification: %v", err)
+		return
+	}
+
+	s.notifier.PublishAsync(models.NotificationEvent{
+		Type:       models.EventApprovalRequested,
+		Roles:      notification.ApproverRoles(rules, string(approval.Stage)),
+		EntityType: "approval",
+		EntityID:   approval.ID,
+		Link:       "/approvals",
+		Data: map[string]interface{}{
+			"approval_id":     approval.ID,
+			"capability_id":   approval.CapabilityID,
+			"capability_name": s.capabilityName(approval.CapabilityID),
+			"stage":           string(approval.Stage),
+			"requester_name":  approval.RequesterName,
+		},
+	})
+}
+
+// notifyApprovalDecided tells the requester that their approval was approved or rejected
+func (s *Server) notifyApprovalDecided(approval *models.CapabilityApproval) {
+	feedback := ""
+	if approval.Feedback != nil {
+		feedback = *approval.Feedback
+	}
+
+	s.notifier.PublishAsync(models.NotificationEvent{
+		Type:       models.EventApprovalDecided,
+		UserIDs:    []int{approval.RequestedBy},
+		EntityType: "capability",
+		EntityID:   approval.CapabilityID,
+		Link:       fmt.Sprintf("/capabilities/%d", approval.CapabilityID),
+		Data: map[string]interface{}{
+			"approval_id":     approval.ID,
+			"capability_id":   approval.CapabilityID,
+			"capability_name": s.capabilityName(approval.CapabilityID),
+			"stage":           string(approval.Stage),
+			"decision":        string(approval.Status),
+			"decider_name":    approval.DeciderName,
+			"feedback":        feedback,
+		},
+	})
+}
+
+// notifyCriteriaFailed tells the author of the criteria, and the capability owner, about a failure
+func (s *Server) notifyCriteriaFailed(criteria *models.AcceptanceCriteria) {
+	var userIDs []int
+	if criteria.CreatedBy != nil {
+		userIDs = append(userIDs, *criteria.CreatedBy)
+	}
+	if criteria.EntityType == "capability" {
+		if cap, err := s.capRepo.GetByID(criteria.EntityID); err == nil && cap.CreatedBy != nil {
+			userIDs = append(userIDs, *cap.CreatedBy)
+		}
+	}
+	if len(userIDs) == 0 {
+		return
+	}
+
+	notes := ""
+	if criteria.VerificationNotes != nil {
+		notes = *criteria.VerificationNotes
+	}
+
+	s.notifier.PublishAsync(models.NotificationEvent{
+		Type:       models.EventCriteriaFailed,
+		UserIDs:    userIDs,
+		EntityType: criteria.EntityType,
+		EntityID:   criteria.EntityID,
+		Link:       fmt.Sprintf("/%ss/%d", criteria.EntityType, criteria.EntityID),
+		Data: map[string]interface{}{
+			"criteria_id":        criteria.CriteriaID,
+			"criteria_title":     criteria.Title,
+			"verification_notes": notes,
+		},
+	})
+}
+
+// capabilityName resolves a capability's display name, or "" if it cannot be loaded
+func (s *Server) capabilityName(id int) string {
+	cap, err := s.capRepo.GetByID(id)
+	if err != nil || cap == nil {
+		return ""
+	}
+	return cap.Name
+}
@@ -0,0 +1,160 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/jareynolds/ubecode/pkg/search"
+)
+
+// indexRecord refreshes a record's search entry after a write. Failures are logged rather
+// than failing the request; POST /search/reindex repairs any drift.
+func (s *Server) indexRecord(recordType string, id int) {
+	if err := s.searchRepo.IndexRecord(recordType, id); err != nil {
+		log.Printf("Failed to update search index: %v", err)
+	}
+}
+
+// Search Handlers
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := models.SearchQuery{
+		Text:      params.Get("q"),
+		Source:    params.Get("source"),
+		Workspace: params.Get("workspace"),
+		Filters:   map[string][]string{},
+	}
+	query.Limit, _ = strconv.Atoi(params.Get("limit"))
+	query.Offset, _ = strconv.Atoi(params.Get("offset"))
+
+	if query.Source != "" && query.Source != models.SearchSourceSpec && query.Source != models.SearchSourceDB {
+		http.Error(w, "Invalid source. Must be one of: spec, db", http.StatusBadRequest)
+		return
+	}
+
+	// Facet filters accept repeated or comma-separated values: ?status=draft&status=approved or ?status=draft,approved
+	for _, facet := range models.SearchFacetFields {
+		for _, raw := range params[facet] {
+			for _, value := range strings.Split(raw, ",") {
+				if value = strings.TrimSpace(value); value != "" {
+					query.Filters[facet] = append(query.Filters[facet], value)
+				}
+			}
+		}
+	}
+
+	if err := s.searchRestrictions(r, &query); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check access: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	results, err := s.searchRepo.Search(query)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to search: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+func (s *Server) handleIndexDocuments(w http.ResponseWriter, r *http.Request) {
+	var req models.IndexDocumentsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	for _, doc := range req.Documents {
+		if doc.Ref == "" || doc.DocType == "" {
+			http.Error(w, "Each document requires ref and doc_type", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// search:write in one workspace must not let the caller rewrite another's spec index
+	if grant := requestGrant(r); grant != nil {
+		for _, folder := range specChangeFolders(req) {
+			if folder == "" && !grant.Can(models.PermSearchWrite) {
+				http.Error(w, fmt.Sprintf("Missing permission: %s", models.PermSearchWrite), http.StatusForbidden)
+				return
+			}
+			if folder != "" && !grant.CanInFolder(models.PermSearchWrite, folder) {
+				http.Error(w, fmt.Sprintf("Missing permission in workspace %s: %s", folder, models.PermSearchWrite), http.StatusForbidden)
+				return
+			}
+		}
+	}
+
+	if err := s.searchRepo.ApplySpecChanges(req); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update search index: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"indexed": len(req.Documents),
+		"removed": len(req.RemoveRefs),
+	})
+}
+
+// specChangeFolders returns the workspace folders a spec index change touches: those of
+// replace_workspace, of every removed ref, and of every document's workspace and ref. Refs
+// outside any workspace are reported as "", which only the global permission covers.
+func specChangeFolders(req models.IndexDocumentsRequest) []string {
+	folders := []string{}
+	seen := map[string]bool{}
+	add := func(folder string) {
+		if !seen[folder] {
+			seen[folder] = true
+			folders = append(folders, folder)
+		}
+	}
+
+	if req.ReplaceWorkspace != "" {
+		add(req.ReplaceWorkspace)
+	}
+	for _, ref := range req.RemoveRefs {
+		add(search.WorkspaceFromRef(ref))
+	}
+	for _, doc := range req.Documents {
+		add(doc.Workspace)
+		add(search.WorkspaceFromRef(doc.Ref))
+	}
+	return folders
+}
+
+// handleReindexRecords rebuilds the index of every workspace's records, so it needs
+// search:write globally rather than in some workspace
+func (s *Server) handleReindexRecords(w http.ResponseWriter, r *http.Request) {
+	if grant := requestGrant(r); grant != nil && !grant.Can(models.PermSearchWrite) {
+		http.Error(w, fmt.Sprintf("Missing permission: %s", models.PermSearchWrite), http.StatusForbidden)
+		return
+	}
+
+	count, err := s.searchRepo.ReindexRecords()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to reindex records: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Search index rebuilt",
+		"indexed": count,
+	})
+}
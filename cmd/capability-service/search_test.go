@@ -0,0 +1,85 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+// workspaceWriter holds search:write in workspace acme only
+var workspaceWriter = &models.AccessGrant{
+	UserID: 7,
+	Workspaces: []models.WorkspaceAccess{
+		{WorkspaceID: 1, Folder: "acme", Permissions: []string{models.PermSearchRead, models.PermSearchWrite}},
+		{WorkspaceID: 2, Folder: "globex", Permissions: []string{models.PermSearchRead}},
+	},
+	KnownFolders: []string{"acme", "globex"},
+}
+
+func TestSpecChangeFolders(t *testing.T) {
+	req := models.IndexDocumentsRequest{
+		ReplaceWorkspace: "acme",
+		RemoveRefs:       []string{"workspaces/acme/specifications/CAP-1.md", "notes/CAP-2.md"},
+		Documents: []models.SearchDocument{
+			{Ref: "workspaces/acme/specifications/CAP-3.md", DocType: "capability", Workspace: "acme"},
+			{Ref: "workspaces/globex/specifications/CAP-4.md", DocType: "capability", Workspace: "acme"},
+		},
+	}
+
+	want := []string{"acme", "", "globex"}
+	if got := specChangeFolders(req); !reflect.DeepEqual(got, want) {
+		t.Errorf("specChangeFolders = %v, want %v", got, want)
+	}
+}
+
+func TestIndexDocumentsOtherWorkspace(t *testing.T) {
+	// Every request is refused before the index is touched, so no repository is needed
+	s := &Server{}
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"replace workspace", `{"replace_workspace":"globex"}`},
+		{"remove refs", `{"remove_refs":["workspaces/acme/specifications/CAP-1.md","workspaces/globex/specifications/CAP-2.md"]}`},
+		{"document workspace", `{"documents":[{"ref":"workspaces/acme/specifications/CAP-1.md","doc_type":"capability","workspace":"globex"}]}`},
+		{"document ref", `{"documents":[{"ref":"workspaces/globex/specifications/CAP-1.md","doc_type":"capability","workspace":"acme"}]}`},
+		{"document outside workspaces", `{"documents":[{"ref":"specifications/CAP-1.md","doc_type":"capability"}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), "access", workspaceWriter)
+			req := httptest.NewRequest("POST", "/search/documents", strings.NewReader(tt.body)).WithContext(ctx)
+			rec := httptest.NewRecorder()
+			s.handleIndexDocuments(rec, req)
+			if rec.Code != http.StatusForbidden {
+				t.Errorf("expected status %d, got %d (%s)", http.StatusForbidden, rec.Code, strings.TrimSpace(rec.Body.String()))
+			}
+		})
+	}
+}
+
+func TestReindexRecordsNeedsGlobalPermission(t *testing.T) {
+	s := &Server{}
+	ctx := context.WithValue(context.Background(), "access", workspaceWriter)
+	req := httptest.NewRequest("POST", "/search/reindex", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	s.handleReindexRecords(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, got %d", http.StatusForbidden, rec.Code)
+	}
+}
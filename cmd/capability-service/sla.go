@@ -0,0 +1,214 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/jareynolds/ubecode/pkg/notification"
+	"github.com/jareynolds/ubecode/pkg/workflow"
+)
+
+// SLAReport summarises one run of the SLA scheduler
+type SLAReport struct {
+	Checked   int `json:"checked"`
+	Reminded  int `json:"reminded"`
+	Escalated int `json:"escalated"`
+	Errors    int `json:"errors"`
+}
+
+// runSLAScheduler checks pending approvals against their stage SLAs every interval
+func (s *Server) runSLAScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := s.checkApprovalSLAs(time.Now())
+			if err != nil {
+				log.Printf("Approval SLA check failed: %v", err)
+				continue
+			}
+			if report.Reminded > 0 || report.Escalated > 0 || report.Errors > 0 {
+				log.Printf("Approval SLA check: %d checked, %d reminded, %d escalated, %d errors",
+					report.Checked, report.Reminded, report.Escalated, report.Errors)
+			}
+		}
+	}
+}
+
+// checkApprovalSLAs sends due reminders and escalates approvals that have breached their SLA
+func (s *Server) checkApprovalSLAs(now time.Time) (*SLAReport, error) {
+	rules, err := s.approvalRepo.GetSLARules()
+	if err != nil {
+		return nil, err
+	}
+	byStage := workflow.IndexSLARules(rules)
+
+	approvals, err := s.approvalRepo.GetPendingApprovals()
+	if err != nil {
+		return nil, err
+	}
+
+	var workflowRules []models.ApprovalWorkflowRule
+	report := &SLAReport{Checked: len(approvals)}
+
+	for _, a := range approvals {
+		rule := byStage[string(a.Stage)]
+		status := workflow.EvaluateSLA(a, rule, now)
+
+		switch workflow.NextSLAAction(a, rule, now) {
+		case workflow.SLAActionRemind:
+			if workflowRules == nil {
+				if workflowRules, err = s.approvalRepo.GetWorkflowRules(); err != nil {
+					return report, err
+				}
+			}
+			if err := s.approvalRepo.RecordReminder(a.ID); err != nil {
+				log.Printf("Failed to record reminder for approval %d: %v", a.ID, err)
+				report.Errors++
+				continue
+			}
+			s.notifier.PublishAsync(models.NotificationEvent{
+				Type:       models.EventApprovalReminder,
+				Roles:      notification.ApproverRoles(workflowRules, string(a.Stage)),
+				EntityType: "approval",
+				EntityID:   a.ID,
+				Link:       "/approvals",
+				Data:       s.slaEventData(a, status),
+			})
+			report.Reminded++
+
+		case workflow.SLAActionEscalate:
+			details := map[string]interface{}{
+				"sla_hours": rule.SLAHours,
+				"age_hours": status.AgeHours,
+			}
+			if rule.EscalationRole != "" {
+				details["escalated_to_role"] = rule.EscalationRole
+			}
+			if rule.EscalationUserID != nil {
+				details["escalated_to_user_id"] = *rule.EscalationUserID
+			}
+
+			escalated, err := s.approvalRepo.Escalate(a.ID, rule.EscalationRole, rule.EscalationUserID, details)
+			if err != nil {
+				log.Printf("Failed to escalate approval %d: %v", a.ID, err)
+				report.Errors++
+				continue
+			}
+			escalated.RequesterName = a.RequesterName
+
+			event := models.NotificationEvent{
+				Type:       models.EventApprovalEscalated,
+				EntityType: "approval",
+				EntityID:   a.ID,
+				Link:       "/approvals",
+				Data:       s.slaEventData(*escalated, status),
+			}
+			if rule.EscalationUserID != nil {
+				event.UserIDs = []int{*rule.EscalationUserID}
+			} else if rule.EscalationRole != "" {
+				event.Roles = []string{rule.EscalationRole}
+			}
+			if len(event.UserIDs) > 0 || len(event.Roles) > 0 {
+				s.notifier.PublishAsync(event)
+			}
+			report.Escalated++
+		}
+	}
+
+	return report, nil
+}
+
+// slaEventData builds the template data shared by reminder and escalation notifications
+func (s *Server) slaEventData(a models.CapabilityApproval, status models.ApprovalSLAStatus) map[string]interface{} {
+	data := map[string]interface{}{
+		"approval_id":     a.ID,
+		"capability_id":   a.CapabilityID,
+		"capability_name": s.capabilityName(a.CapabilityID),
+		"stage":           string(a.Stage),
+		"requester_name":  a.RequesterName,
+		"age_hours":       status.AgeHours,
+		"sla_hours":       status.SLAHours,
+	}
+	if status.DueAt != nil {
+		data["due_at"] = status.DueAt.Format("2006-01-02 15:04")
+	}
+	return data
+}
+
+// SLA Handlers
+
+func (s *Server) handleGetSLARules(w http.ResponseWriter, r *http.Request) {
+	rules, err := s.approvalRepo.GetSLARules()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get SLA rules: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"rules": rules,
+	})
+}
+
+func (s *Server) handleUpdateSLARule(w http.ResponseWriter, r *http.Request) {
+	stage := r.PathValue("stage")
+	if !models.IsValidStage(stage) {
+		http.Error(w, "Invalid stage. Must be one of: specification, definition, design, execution", http.StatusBadRequest)
+		return
+	}
+
+	var req models.UpdateApprovalSLARuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if req.SLAHours <= 0 {
+		http.Error(w, "sla_hours must be greater than zero", http.StatusBadRequest)
+		return
+	}
+	for _, h := range req.ReminderHours {
+		if h <= 0 || h >= req.SLAHours {
+			http.Error(w, "reminder_hours must be between zero and sla_hours", http.StatusBadRequest)
+			return
+		}
+	}
+
+	rule, err := s.approvalRepo.SaveSLARule(stage, req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to save SLA rule: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+}
+
+func (s *Server) handleRunSLACheck(w http.ResponseWriter, r *http.Request) {
+	report, err := s.checkApprovalSLAs(time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check approval SLAs: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
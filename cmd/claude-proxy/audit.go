@@ -0,0 +1,55 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// auditEntry is one line of the audit log, written for every request to /execute
+type auditEntry struct {
+	Time         time.Time `json:"time"`
+	RequestID    string    `json:"request_id"`
+	Remote       string    `json:"remote"`
+	Client       string    `json:"client,omitempty"`       // Authenticated identity
+	RequestedBy  string    `json:"requested_by,omitempty"` // User the integration service acted for
+	Workspace    string    `json:"workspace,omitempty"`
+	SessionID    string    `json:"session_id,omitempty"`
+	Resumed      bool      `json:"resumed,omitempty"` // The request continued an earlier session
+	PromptSHA256 string    `json:"prompt_sha256,omitempty"`
+	PromptLength int       `json:"prompt_length"`
+	Status       int       `json:"status"`
+	ExitCode     *int      `json:"exit_code,omitempty"`
+	QueuedMS     int64     `json:"queued_ms"`
+	DurationMS   int64     `json:"duration_ms"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// auditLog appends JSON lines to a writer
+type auditLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (a *auditLog) record(entry auditEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Failed to marshal audit entry: %v", err)
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.w.Write(append(line, '\n')); err != nil {
+		log.Printf("Failed to write audit entry: %v", err)
+	}
+}
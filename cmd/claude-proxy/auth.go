@@ -0,0 +1,116 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/client"
+)
+
+// maxClockSkew is how far a signed request's timestamp may be from the proxy's clock
+const maxClockSkew = 5 * time.Minute
+
+// authenticator checks that a request came from the integration service: by client
+// certificate when mTLS is on, and by shared-secret signature when a secret is set
+type authenticator struct {
+	secret string
+	mtls   bool
+	now    func() time.Time
+
+	mu   sync.Mutex
+	seen map[string]time.Time // Signatures accepted within the skew window, to reject replays
+}
+
+func newAuthenticator(secret string, mtls bool) *authenticator {
+	return &authenticator{secret: secret, mtls: mtls, now: time.Now, seen: make(map[string]time.Time)}
+}
+
+// authenticate returns the caller's identity for the audit log
+func (a *authenticator) authenticate(r *http.Request, body []byte) (string, error) {
+	identity := ""
+	if a.mtls {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			return "", errors.New("client certificate required")
+		}
+		identity = "cert:" + r.TLS.PeerCertificates[0].Subject.CommonName
+	}
+
+	if a.secret != "" {
+		if err := a.verifySignature(r, body); err != nil {
+			return "", err
+		}
+		if identity == "" {
+			identity = "shared-secret"
+		}
+	}
+	return identity, nil
+}
+
+func (a *authenticator) verifySignature(r *http.Request, body []byte) error {
+	timestamp := r.Header.Get(client.ProxyTimestampHeader)
+	signature := r.Header.Get(client.ProxySignatureHeader)
+	if timestamp == "" || signature == "" {
+		return errors.New("missing request signature")
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("invalid request timestamp")
+	}
+	now := a.now()
+	sent := time.Unix(unix, 0)
+	if sent.Before(now.Add(-maxClockSkew)) || sent.After(now.Add(maxClockSkew)) {
+		return errors.New("request timestamp outside the allowed window")
+	}
+
+	expected := client.SignProxyRequest(a.secret, timestamp, r.Method, r.URL.Path, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errors.New("invalid request signature")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for sig, at := range a.seen {
+		if now.Sub(at) > 2*maxClockSkew {
+			delete(a.seen, sig)
+		}
+	}
+	if _, ok := a.seen[signature]; ok {
+		return errors.New("request already used")
+	}
+	a.seen[signature] = now
+	return nil
+}
+
+// serverTLSConfig requires clients to present a certificate signed by clientCAFile
+func serverTLSConfig(clientCAFile string) (*tls.Config, error) {
+	caPEM, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in %s", clientCAFile)
+	}
+	return &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
@@ -7,163 +7,403 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/client"
 )
 
-const defaultPort = "9085"
+const (
+	defaultPort          = "9085"
+	defaultTimeout       = 15 * time.Minute
+	defaultMaxConcurrent = 2
+	defaultQueueSize     = 16
+	defaultAuditLog      = "logs/claude-proxy-audit.log"
+	defaultSessionsFile  = "logs/claude-proxy-sessions.json"
+	defaultSessionTTL    = 7 * 24 * time.Hour
+	minSecretLength      = 32
+	maxRequestBody       = 4 << 20
+)
 
 // Request represents an incoming CLI execution request
 type Request struct {
 	WorkspacePath    string `json:"workspacePath"`
 	Command          string `json:"command"`
 	AdditionalPrompt string `json:"additionalPrompt,omitempty"`
+	RequestedBy      string `json:"requestedBy,omitempty"`
+	SessionID        string `json:"sessionId,omitempty"` // Resume this CLI session
 }
 
 // Response represents the CLI execution response
 type Response struct {
-	Response string `json:"response,omitempty"`
-	Error    string `json:"error,omitempty"`
+	Response  string `json:"response,omitempty"`
+	SessionID string `json:"sessionId,omitempty"`
+	Error     string `json:"error,omitempty"`
 }
 
-func main() {
+// config is read from CLAUDE_PROXY_* environment variables
+type config struct {
+	listen        string
+	root          string
+	secret        string
+	tlsCert       string
+	tlsKey        string
+	clientCA      string
+	timeout       time.Duration
+	maxConcurrent int
+	queueSize     int
+	auditLog      string
+	sessionsFile  string
+	sessionTTL    time.Duration
+}
+
+func loadConfig() (*config, error) {
 	port := os.Getenv("CLAUDE_PROXY_PORT")
 	if port == "" {
 		port = defaultPort
 	}
+	cfg := &config{
+		listen:       os.Getenv("CLAUDE_PROXY_LISTEN"),
+		root:         os.Getenv("CLAUDE_PROXY_ROOT"),
+		secret:       os.Getenv("CLAUDE_PROXY_SECRET"),
+		tlsCert:      os.Getenv("CLAUDE_PROXY_TLS_CERT"),
+		tlsKey:       os.Getenv("CLAUDE_PROXY_TLS_KEY"),
+		clientCA:     os.Getenv("CLAUDE_PROXY_CLIENT_CA"),
+		auditLog:     os.Getenv("CLAUDE_PROXY_AUDIT_LOG"),
+		sessionsFile: os.Getenv("CLAUDE_PROXY_SESSIONS"),
+	}
+	if cfg.listen == "" {
+		cfg.listen = "127.0.0.1:" + port
+	}
+	if cfg.root == "" {
+		cfg.root = "workspaces"
+	}
+	if cfg.auditLog == "" {
+		cfg.auditLog = defaultAuditLog
+	}
+	if cfg.sessionsFile == "" {
+		cfg.sessionsFile = defaultSessionsFile
+	}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/execute", corsMiddleware(handleExecute))
-	mux.HandleFunc("/health", corsMiddleware(handleHealth))
+	if cfg.secret != "" && len(cfg.secret) < minSecretLength {
+		return nil, fmt.Errorf("CLAUDE_PROXY_SECRET must be at least %d characters", minSecretLength)
+	}
+	if (cfg.tlsCert != "") != (cfg.tlsKey != "") || (cfg.clientCA != "" && cfg.tlsCert == "") {
+		return nil, errors.New("mTLS needs CLAUDE_PROXY_TLS_CERT, CLAUDE_PROXY_TLS_KEY and CLAUDE_PROXY_CLIENT_CA together")
+	}
+	if cfg.secret == "" && cfg.clientCA == "" {
+		return nil, errors.New("refusing to start without authentication: set CLAUDE_PROXY_SECRET or configure mTLS")
+	}
+
+	var err error
+	if cfg.timeout, err = durationEnv("CLAUDE_PROXY_TIMEOUT", defaultTimeout); err != nil {
+		return nil, err
+	}
+	if cfg.sessionTTL, err = durationEnv("CLAUDE_PROXY_SESSION_TTL", defaultSessionTTL); err != nil {
+		return nil, err
+	}
+	if cfg.maxConcurrent, err = positiveIntEnv("CLAUDE_PROXY_MAX_CONCURRENT", defaultMaxConcurrent); err != nil {
+		return nil, err
+	}
+	if cfg.queueSize, err = positiveIntEnv("CLAUDE_PROXY_QUEUE_SIZE", defaultQueueSize); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
 
-	// Handle OPTIONS for CORS preflight
-	mux.HandleFunc("OPTIONS /execute", corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-	}))
+func durationEnv(name string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration such as 15m", name)
+	}
+	return d, nil
+}
+
+func positiveIntEnv(name string, fallback int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%s must be a positive integer", name)
+	}
+	return n, nil
+}
+
+// server handles /execute and /health
+type server struct {
+	root     string // Allow-listed workspace root with symlinks resolved
+	baseDir  string // Relative workspace paths are resolved against this directory
+	auth     *authenticator
+	runner   *runner
+	audit    *auditLog
+	sessions *sessionStore
+}
+
+func main() {
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		log.Fatalf("Failed to get working directory: %v", err)
+	}
+	root, err := filepath.Abs(cfg.root)
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		log.Fatalf("Workspace root %s is not accessible: %v", cfg.root, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cfg.auditLog), 0755); err != nil {
+		log.Fatalf("Failed to create audit log directory: %v", err)
+	}
+	auditFile, err := os.OpenFile(cfg.auditLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer auditFile.Close()
+
+	if err := os.MkdirAll(filepath.Dir(cfg.sessionsFile), 0755); err != nil {
+		log.Fatalf("Failed to create sessions directory: %v", err)
+	}
+	sessions, err := loadSessions(cfg.sessionsFile, cfg.sessionTTL)
+	if err != nil {
+		log.Fatalf("Failed to load sessions: %v", err)
+	}
+
+	s := &server{
+		root:     root,
+		baseDir:  cwd,
+		auth:     newAuthenticator(cfg.secret, cfg.clientCA != ""),
+		runner:   newRunner(cfg.queueSize, cfg.maxConcurrent, cfg.timeout),
+		audit:    &auditLog{w: auditFile},
+		sessions: sessions,
+	}
+
+	srv := &http.Server{
+		Addr:              cfg.listen,
+		Handler:           s.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
 
-	addr := ":" + port
-	log.Printf("Claude CLI Proxy starting on %s", addr)
+	log.Printf("Claude CLI Proxy starting on %s", cfg.listen)
 	log.Printf("This service must run on the host machine (not in Docker)")
-	log.Printf("It executes Claude CLI commands on behalf of Docker containers")
+	log.Printf("Workspace root: %s; timeout %s; %d concurrent, queue of %d", root, cfg.timeout, cfg.maxConcurrent, cfg.queueSize)
+	log.Printf("Audit log: %s; sessions: %s, kept for %s", cfg.auditLog, cfg.sessionsFile, cfg.sessionTTL)
 
-	if err := http.ListenAndServe(addr, mux); err != nil {
+	if cfg.tlsCert != "" {
+		if cfg.clientCA != "" {
+			if srv.TLSConfig, err = serverTLSConfig(cfg.clientCA); err != nil {
+				log.Fatalf("Failed to configure mTLS: %v", err)
+			}
+		}
+		err = srv.ListenAndServeTLS(cfg.tlsCert, cfg.tlsKey)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
 
-func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		next(w, r)
-	}
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /execute", s.handleExecute)
+	mux.HandleFunc("GET /health", handleHealth)
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
 }
 
 func handleHealth(w http.ResponseWriter, r *http.Request) {
 	// Check if claude CLI is available
-	claudePath, err := findClaudeCLI()
-	if err != nil {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		json.NewEncoder(w).Encode(Response{Error: err.Error()})
+	if _, err := findClaudeCLI(); err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, Response{Error: err.Error()})
 		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"status":     "healthy",
-		"claudePath": claudePath,
-	})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "healthy"})
 }
 
-func handleExecute(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+func (s *server) handleExecute(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	entry := auditEntry{Time: start.UTC(), RequestID: newRequestID(), Remote: r.RemoteAddr}
+	w.Header().Set("X-Request-ID", entry.RequestID)
+	defer func() {
+		entry.DurationMS = time.Since(start).Milliseconds()
+		s.audit.record(entry)
+	}()
+
+	// Once a stream has started, failures are reported as its last event
+	var stream *eventStream
+	if wantsEventStream(r) {
+		stream = newEventStream(w)
+	}
+	fail := func(status int, msg string) {
+		entry.Status = status
+		entry.Error = msg
+		if stream != nil && stream.started {
+			stream.send(client.ClaudeProxyEvent{Type: client.ProxyEventError, SessionID: entry.SessionID, Error: msg, Status: status})
+			return
+		}
+		writeJSON(w, status, Response{SessionID: entry.SessionID, Error: msg})
 	}
 
-	var req Request
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(Response{Error: "Invalid request body: " + err.Error()})
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	if err != nil {
+		fail(http.StatusRequestEntityTooLarge, "request body too large")
 		return
 	}
 
-	// Validate workspace path
-	workspacePath := req.WorkspacePath
-	if workspacePath == "" {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(Response{Error: "No workspace path provided"})
+	identity, err := s.auth.authenticate(r, body)
+	if err != nil {
+		log.Printf("Rejected request from %s: %v", r.RemoteAddr, err)
+		fail(http.StatusUnauthorized, "unauthorized")
 		return
 	}
+	entry.Client = identity
 
-	// Make path absolute if needed
-	if !filepath.IsAbs(workspacePath) {
-		cwd, _ := os.Getwd()
-		workspacePath = filepath.Join(cwd, workspacePath)
+	var req Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		fail(http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
 	}
+	entry.RequestedBy = req.RequestedBy
+	entry.Workspace = req.WorkspacePath
 
-	// Verify workspace exists
-	info, err := os.Stat(workspacePath)
-	if err != nil || !info.IsDir() {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(Response{Error: fmt.Sprintf("Workspace folder not found: %s", workspacePath)})
+	workspacePath, err := resolveWorkspace(s.root, s.baseDir, req.WorkspacePath)
+	if err != nil {
+		fail(http.StatusBadRequest, err.Error())
 		return
 	}
+	entry.Workspace = workspacePath
+
+	if req.SessionID != "" {
+		if err := s.sessions.check(req.SessionID, workspacePath); err != nil {
+			fail(http.StatusNotFound, err.Error())
+			return
+		}
+		entry.Resumed = true
+	}
 
 	// Build the full prompt
 	fullPrompt := req.Command
 	if req.AdditionalPrompt != "" {
 		fullPrompt += "\n\n## ADDITIONAL INSTRUCTIONS\n\n" + req.AdditionalPrompt
 	}
+	sum := sha256.Sum256([]byte(fullPrompt))
+	entry.PromptSHA256 = hex.EncodeToString(sum[:])
+	entry.PromptLength = len(fullPrompt)
 
-	// Find claude CLI
-	claudePath, err := findClaudeCLI()
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(Response{Error: err.Error()})
-		return
+	var out runOutput
+	onLine := func(line []byte) {
+		for _, event := range translateLine(line, workspacePath) {
+			out.add(event)
+			if stream != nil {
+				stream.send(event)
+			}
+		}
 	}
 
-	// Execute claude CLI with --dangerously-skip-permissions for automation
-	// This allows Claude to write files without interactive permission prompts
-	log.Printf("Executing Claude CLI in directory: %s", workspacePath)
-	log.Printf("Command: %s -p --dangerously-skip-permissions <prompt of %d chars>", claudePath, len(fullPrompt))
-
-	cmd := exec.Command(claudePath, "-p", "--dangerously-skip-permissions", fullPrompt)
-	cmd.Dir = workspacePath
-
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	log.Printf("[%s] Executing Claude CLI in %s (prompt of %d chars, session %q)", entry.RequestID, workspacePath, len(fullPrompt), req.SessionID)
+	res, err := s.runner.run(r.Context(), workspacePath, cliArgs(fullPrompt, req.SessionID), onLine)
+	entry.ExitCode = res.exitCode
+	entry.QueuedMS = res.queued.Milliseconds()
+	entry.SessionID = out.sessionID
+	if out.sessionID != "" {
+		s.sessions.record(out.sessionID, workspacePath, req.RequestedBy)
+	}
+	if err == nil && out.result != nil && out.result.IsError {
+		err = fmt.Errorf("Claude CLI error: %s", out.result.Text)
+	}
 
-	err = cmd.Run()
-	if err != nil {
-		errOutput := stderr.String()
-		if errOutput == "" {
-			errOutput = err.Error()
-		}
-		log.Printf("Claude CLI error: %s", errOutput)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(Response{Error: fmt.Sprintf("Claude CLI error: %s", errOutput)})
+	switch {
+	case errors.Is(err, errQueueFull):
+		w.Header().Set("Retry-After", "30")
+		fail(http.StatusServiceUnavailable, "Claude CLI proxy is busy, try again later")
+		return
+	case errors.Is(err, errTimeout):
+		fail(http.StatusGatewayTimeout, err.Error())
+		return
+	case errors.Is(err, context.Canceled):
+		fail(http.StatusServiceUnavailable, "request cancelled")
+		return
+	case err != nil:
+		log.Printf("[%s] %v", entry.RequestID, err)
+		fail(http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	response := stdout.String()
+	response := out.response()
 	if response == "" {
 		response = "Claude CLI completed but returned no output."
 	}
+	log.Printf("[%s] Claude CLI completed successfully, response length: %d chars", entry.RequestID, len(response))
 
-	log.Printf("Claude CLI completed successfully, response length: %d chars", len(response))
+	entry.Status = http.StatusOK
+	if stream == nil {
+		writeJSON(w, http.StatusOK, Response{Response: response, SessionID: out.sessionID})
+	} else if out.result == nil || out.result.Text == "" {
+		stream.send(client.ClaudeProxyEvent{Type: client.ProxyEventResult, SessionID: out.sessionID, Text: response})
+	}
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(Response{Response: response})
+// resolveWorkspace returns the real path of a workspace folder, which must be a directory
+// strictly inside root once symlinks are resolved
+func resolveWorkspace(root, baseDir, requested string) (string, error) {
+	if requested == "" {
+		return "", errors.New("No workspace path provided")
+	}
+	path := requested
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("Workspace folder not found: %s", requested)
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("Workspace folder is outside the allowed root: %s", requested)
+	}
+	info, err := os.Stat(resolved)
+	if err != nil || !info.IsDir() {
+		return "", fmt.Errorf("Workspace folder not found: %s", requested)
+	}
+	return resolved, nil
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
 
 // findClaudeCLI locates the claude CLI executable
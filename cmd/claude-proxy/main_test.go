@@ -0,0 +1,511 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+//go:build !windows
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/client"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// stubClaude is put on PATH in place of the real CLI. It logs start and end to
+// events.log in the workspace and, in stream-json, writes notes.md and echoes its prompt.
+// A new session is named after the process ID; --resume keeps the given one.
+const stubClaude = `#!/bin/sh
+echo start >> events.log
+session="sess-$$"
+prev=""
+for arg; do
+  if [ "$prev" = "--resume" ]; then session="$arg"; fi
+  prev="$arg"
+done
+printf '{"type":"system","subtype":"init","session_id":"%s","cwd":"%s"}\n' "$session" "$(pwd)"
+if [ -n "$STUB_CLAUDE_PIDFILE" ]; then
+  sleep 30 &
+  echo $! > "$STUB_CLAUDE_PIDFILE"
+  wait
+fi
+sleep "${STUB_CLAUDE_SLEEP:-0}"
+echo end >> events.log
+printf '{"type":"assistant","session_id":"%s","message":{"content":[{"type":"text","text":"Writing notes"},{"type":"tool_use","id":"tu1","name":"Write","input":{"file_path":"%s/notes.md","content":"x"}}]}}\n' "$session" "$(pwd)"
+printf '{"type":"user","session_id":"%s","message":{"content":[{"type":"tool_result","tool_use_id":"tu1","content":"ok"}]}}\n' "$session"
+printf '{"type":"result","subtype":"success","session_id":"%s","result":"ran in %s: %s","is_error":false,"num_turns":1}\n' "$session" "$(pwd)" "$prev"
+`
+
+func installStubClaude(t *testing.T) {
+	t.Helper()
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "claude"), []byte(stubClaude), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// newTestServer returns a proxy whose root holds the workspaces "acme" and "billing"
+func newTestServer(t *testing.T, r *runner) (*server, *bytes.Buffer) {
+	t.Helper()
+	installStubClaude(t)
+	base, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(base, "workspaces")
+	for _, name := range []string{"acme", "billing"} {
+		if err := os.MkdirAll(filepath.Join(root, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r == nil {
+		r = newRunner(4, 2, time.Minute)
+	}
+	sessions, err := loadSessions("", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var audit bytes.Buffer
+	return &server{
+		root:     root,
+		baseDir:  base,
+		auth:     newAuthenticator(testSecret, false),
+		runner:   r,
+		audit:    &auditLog{w: &audit},
+		sessions: sessions,
+	}, &audit
+}
+
+func auditEntries(t *testing.T, buf *bytes.Buffer) []auditEntry {
+	t.Helper()
+	var entries []auditEntry
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var e auditEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("bad audit line %q: %v", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestExecute(t *testing.T) {
+	s, audit := newTestServer(t, nil)
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	resp, err := client.NewClaudeProxyClient(ts.URL, testSecret).Execute(context.Background(), client.ClaudeProxyRequest{
+		WorkspacePath: "workspaces/acme",
+		Command:       "build it",
+		RequestedBy:   "7",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "ran in " + filepath.Join(s.root, "acme") + ": build it"
+	if resp.Error != "" || resp.Response != want || !strings.HasPrefix(resp.SessionID, "sess-") {
+		t.Fatalf("response = %+v, want %q with a session", resp, want)
+	}
+
+	entries := auditEntries(t, audit)
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 audit entry, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.Status != http.StatusOK || e.Client != "shared-secret" || e.RequestedBy != "7" ||
+		e.Workspace != filepath.Join(s.root, "acme") || e.PromptLength != len("build it") ||
+		len(e.PromptSHA256) != 64 || e.ExitCode == nil || *e.ExitCode != 0 || e.SessionID != resp.SessionID || e.Resumed {
+		t.Errorf("unexpected audit entry: %+v", e)
+	}
+	if strings.Contains(audit.String(), "build it") {
+		t.Error("the audit log should not contain the prompt")
+	}
+}
+
+func TestExecuteStreamsEvents(t *testing.T) {
+	s, _ := newTestServer(t, nil)
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	var events []client.ClaudeProxyEvent
+	resp, err := client.NewClaudeProxyClient(ts.URL, testSecret).Stream(context.Background(), client.ClaudeProxyRequest{
+		WorkspacePath: "workspaces/acme",
+		Command:       "build it",
+	}, func(e client.ClaudeProxyEvent) { events = append(events, e) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error != "" || !strings.HasSuffix(resp.Response, ": build it") || resp.SessionID == "" {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+
+	var types []string
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	want := []string{"session", "text", "tool_use", "file_edit", "tool_result", "result"}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Fatalf("events = %v, want %v", types, want)
+	}
+	if events[3].Path != "notes.md" || events[2].Input != "notes.md" || events[2].Tool != "Write" {
+		t.Errorf("file paths should be relative to the workspace: %+v %+v", events[2], events[3])
+	}
+}
+
+func TestExecuteResumesSession(t *testing.T) {
+	s, audit := newTestServer(t, nil)
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+	c := client.NewClaudeProxyClient(ts.URL, testSecret)
+	ctx := context.Background()
+
+	first, err := c.Execute(ctx, client.ClaudeProxyRequest{WorkspacePath: "workspaces/acme", Command: "start"})
+	if err != nil || first.Error != "" {
+		t.Fatalf("first run: %+v, %v", first, err)
+	}
+
+	tests := []struct {
+		name      string
+		workspace string
+		sessionID string
+		wantError bool
+	}{
+		{"same workspace", "workspaces/acme", first.SessionID, false},
+		{"other workspace", "workspaces/billing", first.SessionID, true},
+		{"unknown session", "workspaces/acme", "sess-unknown", true},
+		{"invalid session", "workspaces/acme", "--help", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := c.Execute(ctx, client.ClaudeProxyRequest{WorkspacePath: tt.workspace, Command: "continue", SessionID: tt.sessionID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantError {
+				if resp.Error != errUnknownSession.Error() {
+					t.Errorf("expected %q, got %+v", errUnknownSession, resp)
+				}
+				return
+			}
+			if resp.Error != "" || resp.SessionID != first.SessionID {
+				t.Errorf("expected to resume %s, got %+v", first.SessionID, resp)
+			}
+		})
+	}
+
+	entries := auditEntries(t, audit)
+	if !entries[1].Resumed || entries[1].SessionID != first.SessionID {
+		t.Errorf("resumed run not audited: %+v", entries[1])
+	}
+}
+
+func TestTranslateLine(t *testing.T) {
+	workspace := "/ws/acme"
+	tests := []struct {
+		name string
+		line string
+		want []client.ClaudeProxyEvent
+	}{
+		{"blank", "  ", nil},
+		{"plain text", "hello", []client.ClaudeProxyEvent{{Type: "text", Text: "hello"}}},
+		{"init", `{"type":"system","subtype":"init","session_id":"abc"}`, []client.ClaudeProxyEvent{{Type: "session", SessionID: "abc"}}},
+		{"other system message", `{"type":"system","subtype":"compact"}`, nil},
+		{"bash", `{"type":"assistant","message":{"content":[{"type":"tool_use","id":"t1","name":"Bash","input":{"command":"go test ./..."}}]}}`,
+			[]client.ClaudeProxyEvent{{Type: "tool_use", Tool: "Bash", ToolUseID: "t1", Input: "go test ./..."}}},
+		{"edit outside workspace", `{"type":"assistant","message":{"content":[{"type":"tool_use","id":"t2","name":"Edit","input":{"file_path":"/tmp/x.go"}}]}}`,
+			[]client.ClaudeProxyEvent{{Type: "tool_use", Tool: "Edit", ToolUseID: "t2", Input: "/tmp/x.go"}, {Type: "file_edit", Tool: "Edit", ToolUseID: "t2", Path: "/tmp/x.go"}}},
+		{"failed tool", `{"type":"user","message":{"content":[{"type":"tool_result","tool_use_id":"t1","is_error":true,"content":[{"type":"text","text":"exit 1"}]}]}}`,
+			[]client.ClaudeProxyEvent{{Type: "tool_result", ToolUseID: "t1", Text: "exit 1", IsError: true}}},
+		{"string content", `{"type":"user","message":{"content":"just text"}}`, nil},
+		{"result", `{"type":"result","session_id":"abc","result":"done","is_error":false,"total_cost_usd":0.25,"num_turns":3}`,
+			[]client.ClaudeProxyEvent{{Type: "result", SessionID: "abc", Text: "done", CostUSD: 0.25, Turns: 3}}},
+		{"result with usage", `{"type":"result","result":"done","total_cost_usd":0.1,"num_turns":1,"usage":{"input_tokens":10,"output_tokens":20,"cache_read_input_tokens":5}}`,
+			[]client.ClaudeProxyEvent{{Type: "result", Text: "done", CostUSD: 0.1, Turns: 1, Usage: &client.ClaudeProxyUsage{InputTokens: 10, OutputTokens: 20, CacheReadInputTokens: 5}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := translateLine([]byte(tt.line), workspace)
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(tt.want)
+			if string(gotJSON) != string(wantJSON) {
+				t.Errorf("got %s, want %s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+func TestSessionStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	store, err := loadSessions(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	store.now = func() time.Time { return now.Add(-2 * time.Hour) }
+	store.record("old", "/ws/acme", "")
+	store.now = func() time.Time { return now }
+	store.record("new", "/ws/acme", "7")
+
+	reloaded, err := loadSessions(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reloaded.check("new", "/ws/acme"); err != nil {
+		t.Errorf("session lost on reload: %v", err)
+	}
+	if err := reloaded.check("old", "/ws/acme"); err == nil {
+		t.Error("expired session should be dropped")
+	}
+	if err := reloaded.check("new", "/ws/billing"); err == nil {
+		t.Error("a session must not resume in another workspace")
+	}
+}
+
+func TestExecuteRequiresSignature(t *testing.T) {
+	s, audit := newTestServer(t, nil)
+	ts := httptest.NewServer(s.routes())
+	defer ts.Close()
+
+	body := []byte(`{"workspacePath":"workspaces/acme","command":"hi"}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	replayed := client.SignProxyRequest(testSecret, now, "POST", "/execute", body)
+
+	tests := []struct {
+		name       string
+		timestamp  string
+		signature  string
+		wantStatus int
+	}{
+		{"unsigned", "", "", http.StatusUnauthorized},
+		{"wrong secret", now, client.SignProxyRequest("not-the-secret", now, "POST", "/execute", body), http.StatusUnauthorized},
+		{"other path", now, client.SignProxyRequest(testSecret, now, "POST", "/health", body), http.StatusUnauthorized},
+		{"stale timestamp", stale, client.SignProxyRequest(testSecret, stale, "POST", "/execute", body), http.StatusUnauthorized},
+		{"valid", now, replayed, http.StatusOK},
+		{"replayed", now, replayed, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", ts.URL+"/execute", bytes.NewReader(body))
+			if tt.timestamp != "" {
+				req.Header.Set(client.ProxyTimestampHeader, tt.timestamp)
+				req.Header.Set(client.ProxySignatureHeader, tt.signature)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+
+	if got := len(auditEntries(t, audit)); got != len(tests) {
+		t.Errorf("expected an audit entry per request, got %d", got)
+	}
+
+	resp, err := http.Get(ts.URL + "/execute")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("GET /execute: status %d, CORS %q", resp.StatusCode, resp.Header.Get("Access-Control-Allow-Origin"))
+	}
+}
+
+func TestResolveWorkspace(t *testing.T) {
+	s, _ := newTestServer(t, nil)
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(s.root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(s.root, "notes.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{"relative", "workspaces/acme", false},
+		{"absolute", filepath.Join(s.root, "billing"), false},
+		{"empty", "", true},
+		{"root itself", "workspaces", true},
+		{"parent traversal", "workspaces/../..", true},
+		{"absolute outside", outside, true},
+		{"symlink out of root", "workspaces/escape", true},
+		{"missing", "workspaces/nope", true},
+		{"file", "workspaces/notes.txt", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveWorkspace(s.root, s.baseDir, tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveWorkspace(%q) = %q, %v; wantErr %v", tt.path, got, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// processAlive reports whether pid is running; zombies awaiting a reaper count as dead
+func processAlive(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return true
+	}
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	return len(fields) == 0 || fields[0] != "Z"
+}
+
+func TestCliArgs(t *testing.T) {
+	tests := []struct {
+		name      string
+		prompt    string
+		sessionID string
+		want      []string
+	}{
+		{"new session", "build it", "", []string{"--", "build it"}},
+		{"resumed", "continue", "sess-1", []string{"--resume", "sess-1", "--", "continue"}},
+		{"flag-like prompt", "--add-dir=/", "", []string{"--", "--add-dir=/"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := cliArgs(tt.prompt, tt.sessionID)
+			got := args[len(args)-len(tt.want):]
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("expected args ending in %q, got %q", tt.want, args)
+			}
+		})
+	}
+}
+
+func TestRunnerTimeoutKillsProcessGroup(t *testing.T) {
+	s, _ := newTestServer(t, newRunner(4, 2, 200*time.Millisecond))
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+	t.Setenv("STUB_CLAUDE_PIDFILE", pidFile)
+
+	start := time.Now()
+	_, err := s.runner.run(context.Background(), filepath.Join(s.root, "acme"), cliArgs("hang", ""), nil)
+	if !errors.Is(err, errTimeout) {
+		t.Fatalf("expected errTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("run took %s to time out", elapsed)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	deadline := time.Now().Add(2 * time.Second)
+	for processAlive(pid) && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if processAlive(pid) {
+		syscall.Kill(pid, syscall.SIGKILL)
+		t.Error("child of the CLI survived the timeout")
+	}
+}
+
+// waitForFile polls until path exists
+func waitForFile(t *testing.T, path string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%s never appeared", path)
+}
+
+func TestRunnerQueueFull(t *testing.T) {
+	s, _ := newTestServer(t, newRunner(1, 1, time.Minute))
+	t.Setenv("STUB_CLAUDE_SLEEP", "30")
+	acme := filepath.Join(s.root, "acme")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.runner.run(ctx, acme, cliArgs("slow", ""), nil)
+		done <- err
+	}()
+	waitForFile(t, filepath.Join(acme, "events.log"))
+
+	if _, err := s.runner.run(context.Background(), filepath.Join(s.root, "billing"), cliArgs("next", ""), nil); !errors.Is(err, errQueueFull) {
+		t.Errorf("expected errQueueFull, got %v", err)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("cancelled run returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelling the request did not stop the CLI")
+	}
+}
+
+func TestRunnerSerializesWorkspace(t *testing.T) {
+	s, _ := newTestServer(t, newRunner(4, 4, time.Minute))
+	t.Setenv("STUB_CLAUDE_SLEEP", "0.2")
+	acme := filepath.Join(s.root, "acme")
+
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, err := s.runner.run(context.Background(), acme, cliArgs("job", ""), nil)
+			errs <- err
+		}()
+	}
+	for i := 0; i < 3; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events, err := os.ReadFile(filepath.Join(acme, "events.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(events), strings.Repeat("start\nend\n", 3); got != want {
+		t.Errorf("jobs in one workspace overlapped:\n%s", got)
+	}
+	if len(s.runner.locks) != 0 {
+		t.Errorf("workspace locks not released: %v", s.runner.locks)
+	}
+}
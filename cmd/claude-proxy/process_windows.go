@@ -0,0 +1,16 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+//go:build windows
+
+package main
+
+import "os/exec"
+
+// killProcessGroup is a no-op on Windows, where cancellation kills only the CLI process
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,189 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+var (
+	errQueueFull = errors.New("job queue is full")
+	errTimeout   = errors.New("claude CLI timed out")
+)
+
+// result is the outcome of one CLI run
+type result struct {
+	exitCode *int // Nil when the CLI never ran
+	queued   time.Duration
+}
+
+// runner executes Claude CLI jobs through a bounded queue, with a cap on concurrent
+// processes and one job at a time per workspace
+type runner struct {
+	queue   chan struct{} // One token per queued or running job
+	slots   chan struct{} // One token per running process
+	timeout time.Duration
+
+	mu    sync.Mutex
+	locks map[string]*workspaceLock
+}
+
+// workspaceLock serialises jobs in one workspace; refs counts jobs holding or waiting on it
+type workspaceLock struct {
+	ch   chan struct{}
+	refs int
+}
+
+func newRunner(queueSize, maxConcurrent int, timeout time.Duration) *runner {
+	return &runner{
+		queue:   make(chan struct{}, queueSize),
+		slots:   make(chan struct{}, maxConcurrent),
+		timeout: timeout,
+		locks:   make(map[string]*workspaceLock),
+	}
+}
+
+// cliArgs returns the CLI arguments for a prompt, resuming sessionID when it is set.
+// --dangerously-skip-permissions lets Claude write files without interactive prompts; the
+// workspace root allow-list is what keeps it confined. The prompt follows "--" so one
+// starting with a dash, e.g. "--add-dir=/", cannot be read as a flag.
+func cliArgs(prompt, sessionID string) []string {
+	args := []string{"-p", "--output-format", "stream-json", "--verbose", "--dangerously-skip-permissions"}
+	if sessionID != "" {
+		args = append(args, "--resume", sessionID)
+	}
+	return append(args, "--", prompt)
+}
+
+// run executes the CLI with args in dir, passing each line of its output to onLine as it
+// arrives. It fails fast with errQueueFull when the queue has no room, and kills the whole
+// process group on timeout or when ctx is cancelled.
+func (r *runner) run(ctx context.Context, dir string, args []string, onLine func([]byte)) (result, error) {
+	var res result
+	select {
+	case r.queue <- struct{}{}:
+		defer func() { <-r.queue }()
+	default:
+		return res, errQueueFull
+	}
+
+	start := time.Now()
+	lock := r.lockFor(dir)
+	defer r.release(dir, lock)
+	select {
+	case lock.ch <- struct{}{}:
+		defer func() { <-lock.ch }()
+	case <-ctx.Done():
+		return res, ctx.Err()
+	}
+
+	select {
+	case r.slots <- struct{}{}:
+		defer func() { <-r.slots }()
+	case <-ctx.Done():
+		return res, ctx.Err()
+	}
+	res.queued = time.Since(start)
+
+	claudePath, err := findClaudeCLI()
+	if err != nil {
+		return res, err
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(runCtx, claudePath, args...)
+	cmd.Dir = dir
+	killProcessGroup(cmd)
+	cmd.WaitDelay = 5 * time.Second
+
+	stdout := &lineWriter{fn: onLine}
+	var stderr bytes.Buffer
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	stdout.flush()
+	if cmd.ProcessState != nil {
+		code := cmd.ProcessState.ExitCode()
+		res.exitCode = &code
+	}
+
+	if errors.Is(runCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		return res, fmt.Errorf("%w after %s", errTimeout, r.timeout)
+	}
+	if ctx.Err() != nil {
+		return res, ctx.Err()
+	}
+	if err != nil {
+		errOutput := stderr.String()
+		if errOutput == "" {
+			errOutput = err.Error()
+		}
+		return res, fmt.Errorf("Claude CLI error: %s", errOutput)
+	}
+	return res, nil
+}
+
+func (r *runner) lockFor(dir string) *workspaceLock {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	lock, ok := r.locks[dir]
+	if !ok {
+		lock = &workspaceLock{ch: make(chan struct{}, 1)}
+		r.locks[dir] = lock
+	}
+	lock.refs++
+	return lock
+}
+
+func (r *runner) release(dir string, lock *workspaceLock) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	lock.refs--
+	if lock.refs == 0 {
+		delete(r.locks, dir)
+	}
+}
+
+// lineWriter calls fn with each complete line written to it
+type lineWriter struct {
+	fn  func([]byte)
+	buf []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if w.fn != nil {
+			w.fn(w.buf[:i])
+		}
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush passes on a last line that had no newline
+func (w *lineWriter) flush() {
+	if len(w.buf) > 0 && w.fn != nil {
+		w.fn(w.buf)
+	}
+	w.buf = nil
+}
@@ -0,0 +1,147 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var errUnknownSession = errors.New("Unknown or expired session for this workspace")
+
+// sessionIDPattern matches the session IDs the CLI hands out
+var sessionIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,127}$`)
+
+// session is a CLI conversation the proxy can resume. It stays bound to the workspace it
+// started in.
+type session struct {
+	ID          string    `json:"id"`
+	Workspace   string    `json:"workspace"`
+	RequestedBy string    `json:"requested_by,omitempty"`
+	Runs        int       `json:"runs"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastUsedAt  time.Time `json:"last_used_at"`
+}
+
+// sessionStore remembers sessions for ttl after their last run, in a JSON file when path
+// is set so they survive restarts
+type sessionStore struct {
+	path string
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+func loadSessions(path string, ttl time.Duration) (*sessionStore, error) {
+	s := &sessionStore{path: path, ttl: ttl, now: time.Now, sessions: make(map[string]*session)}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sessions: %w", err)
+	}
+	var list []*session
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse sessions: %w", err)
+	}
+	for _, sess := range list {
+		if !s.expired(sess) {
+			s.sessions[sess.ID] = sess
+		}
+	}
+	return s, nil
+}
+
+func (s *sessionStore) expired(sess *session) bool {
+	return s.now().Sub(sess.LastUsedAt) > s.ttl
+}
+
+// check returns errUnknownSession unless id is a live session of workspace
+func (s *sessionStore) check(id, workspace string) error {
+	if !sessionIDPattern.MatchString(id) {
+		return errUnknownSession
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok || s.expired(sess) || sess.Workspace != workspace {
+		return errUnknownSession
+	}
+	return nil
+}
+
+// record notes a run of session id in workspace
+func (s *sessionStore) record(id, workspace, requestedBy string) {
+	if !sessionIDPattern.MatchString(id) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	sess, ok := s.sessions[id]
+	if !ok || sess.Workspace != workspace {
+		sess = &session{ID: id, Workspace: workspace, CreatedAt: now}
+		s.sessions[id] = sess
+	}
+	if requestedBy != "" {
+		sess.RequestedBy = requestedBy
+	}
+	sess.Runs++
+	sess.LastUsedAt = now
+
+	for sid, other := range s.sessions {
+		if s.expired(other) {
+			delete(s.sessions, sid)
+		}
+	}
+	if err := s.save(); err != nil {
+		log.Printf("Failed to save sessions: %v", err)
+	}
+}
+
+// save writes the sessions atomically; the caller holds s.mu
+func (s *sessionStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	list := make([]*session, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		list = append(list, sess)
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".sessions-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,262 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jareynolds/ubecode/pkg/client"
+)
+
+const (
+	maxToolOutput = 2000 // Characters of tool output relayed per event
+	maxToolInput  = 200  // Characters of a tool input summary
+)
+
+// fileEditTools are the CLI tools that write files
+var fileEditTools = map[string]bool{
+	"Edit":         true,
+	"MultiEdit":    true,
+	"Write":        true,
+	"NotebookEdit": true,
+}
+
+// cliMessage is a line of the CLI's --output-format stream-json output
+type cliMessage struct {
+	Type      string `json:"type"` // system, assistant, user or result
+	Subtype   string `json:"subtype"`
+	SessionID string `json:"session_id"`
+	Message   struct {
+		Content json.RawMessage `json:"content"`
+	} `json:"message"`
+	Result   string  `json:"result"`
+	IsError  bool    `json:"is_error"`
+	CostUSD  float64 `json:"total_cost_usd"`
+	NumTurns int     `json:"num_turns"`
+	Usage    *struct {
+		InputTokens              int `json:"input_tokens"`
+		OutputTokens             int `json:"output_tokens"`
+		CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+		CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	} `json:"usage"`
+}
+
+// cliContent is a block of an assistant or user message
+type cliContent struct {
+	Type      string          `json:"type"` // text, tool_use or tool_result
+	Text      string          `json:"text"`
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+	ToolUseID string          `json:"tool_use_id"`
+	Content   json.RawMessage `json:"content"`
+	IsError   bool            `json:"is_error"`
+}
+
+// translateLine turns a line of CLI output into the events relayed to callers. Lines that
+// are not stream-json are passed on as text.
+func translateLine(line []byte, workspace string) []client.ClaudeProxyEvent {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return nil
+	}
+	var msg cliMessage
+	if line[0] != '{' || json.Unmarshal(line, &msg) != nil {
+		return []client.ClaudeProxyEvent{{Type: client.ProxyEventText, Text: string(line)}}
+	}
+
+	var events []client.ClaudeProxyEvent
+	switch msg.Type {
+	case "system":
+		if msg.Subtype == "init" && msg.SessionID != "" {
+			events = append(events, client.ClaudeProxyEvent{Type: client.ProxyEventSession, SessionID: msg.SessionID})
+		}
+	case "assistant":
+		for _, block := range contentBlocks(msg.Message.Content) {
+			switch block.Type {
+			case "text":
+				if strings.TrimSpace(block.Text) != "" {
+					events = append(events, client.ClaudeProxyEvent{Type: client.ProxyEventText, Text: block.Text})
+				}
+			case "tool_use":
+				input := summarizeInput(block.Input)
+				events = append(events, client.ClaudeProxyEvent{
+					Type:      client.ProxyEventToolUse,
+					Tool:      block.Name,
+					ToolUseID: block.ID,
+					Input:     workspaceRelative(workspace, input),
+				})
+				if fileEditTools[block.Name] && input != "" {
+					events = append(events, client.ClaudeProxyEvent{
+						Type:      client.ProxyEventFileEdit,
+						Tool:      block.Name,
+						ToolUseID: block.ID,
+						Path:      workspaceRelative(workspace, input),
+					})
+				}
+			}
+		}
+	case "user":
+		for _, block := range contentBlocks(msg.Message.Content) {
+			if block.Type == "tool_result" {
+				events = append(events, client.ClaudeProxyEvent{
+					Type:      client.ProxyEventToolResult,
+					ToolUseID: block.ToolUseID,
+					Text:      truncate(blockText(block.Content), maxToolOutput),
+					IsError:   block.IsError,
+				})
+			}
+		}
+	case "result":
+		result := client.ClaudeProxyEvent{
+			Type:      client.ProxyEventResult,
+			SessionID: msg.SessionID,
+			Text:      msg.Result,
+			IsError:   msg.IsError,
+			CostUSD:   msg.CostUSD,
+			Turns:     msg.NumTurns,
+		}
+		if msg.Usage != nil {
+			result.Usage = &client.ClaudeProxyUsage{
+				InputTokens:              msg.Usage.InputTokens,
+				OutputTokens:             msg.Usage.OutputTokens,
+				CacheCreationInputTokens: msg.Usage.CacheCreationInputTokens,
+				CacheReadInputTokens:     msg.Usage.CacheReadInputTokens,
+			}
+		}
+		events = append(events, result)
+	}
+	return events
+}
+
+// contentBlocks decodes message content, which is either a list of blocks or plain text
+func contentBlocks(raw json.RawMessage) []cliContent {
+	var blocks []cliContent
+	if json.Unmarshal(raw, &blocks) == nil {
+		return blocks
+	}
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return []cliContent{{Type: "text", Text: text}}
+	}
+	return nil
+}
+
+// blockText flattens tool result content, which is a string or a list of text blocks
+func blockText(raw json.RawMessage) string {
+	var parts []string
+	for _, block := range contentBlocks(raw) {
+		if block.Text != "" {
+			parts = append(parts, block.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// summarizeInput picks what a tool acted on out of its input
+func summarizeInput(raw json.RawMessage) string {
+	var input map[string]interface{}
+	if json.Unmarshal(raw, &input) != nil {
+		return ""
+	}
+	for _, key := range []string{"file_path", "notebook_path", "path", "command", "pattern", "url", "description"} {
+		if value, ok := input[key].(string); ok && value != "" {
+			return truncate(value, maxToolInput)
+		}
+	}
+	return ""
+}
+
+// workspaceRelative shortens absolute paths inside the workspace
+func workspaceRelative(workspace, path string) string {
+	if !filepath.IsAbs(path) {
+		return path
+	}
+	rel, err := filepath.Rel(workspace, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return rel
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max] + "…"
+}
+
+// runOutput collects what a run's events say about its outcome
+type runOutput struct {
+	sessionID string
+	text      []string
+	result    *client.ClaudeProxyEvent
+}
+
+func (o *runOutput) add(event client.ClaudeProxyEvent) {
+	if event.SessionID != "" {
+		o.sessionID = event.SessionID
+	}
+	switch event.Type {
+	case client.ProxyEventText:
+		o.text = append(o.text, event.Text)
+	case client.ProxyEventResult:
+		o.result = &event
+	}
+}
+
+// response is the final result text, or all assistant text when the CLI gave none
+func (o *runOutput) response() string {
+	if o.result != nil && o.result.Text != "" {
+		return o.result.Text
+	}
+	return strings.Join(o.text, "\n")
+}
+
+// eventStream writes events as Server-Sent Events. Headers go out with the first event, so
+// a request that fails before the CLI produces output still gets a plain error status.
+type eventStream struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	started bool
+}
+
+func newEventStream(w http.ResponseWriter) *eventStream {
+	return &eventStream{w: w, rc: http.NewResponseController(w)}
+}
+
+func (s *eventStream) send(event client.ClaudeProxyEvent) {
+	if !s.started {
+		s.started = true
+		s.w.Header().Set("Content-Type", "text/event-stream")
+		s.w.Header().Set("Cache-Control", "no-cache")
+		s.w.Header().Set("X-Accel-Buffering", "no")
+		s.w.WriteHeader(http.StatusOK)
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event.Type, data)
+	s.rc.Flush()
+}
+
+// wantsEventStream reports whether the caller asked for a streamed response
+func wantsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
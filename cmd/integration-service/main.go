@@ -15,10 +15,20 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/jareynolds/ubecode/internal/integration"
+	"github.com/jareynolds/ubecode/pkg/aicache"
+	"github.com/jareynolds/ubecode/pkg/client"
+	"github.com/jareynolds/ubecode/pkg/database"
+	"github.com/jareynolds/ubecode/pkg/jobs"
+	"github.com/jareynolds/ubecode/pkg/repository"
+	"github.com/jareynolds/ubecode/pkg/prompts"
+	"github.com/jareynolds/ubecode/pkg/retrieval"
+	"github.com/jareynolds/ubecode/pkg/templates"
 )
 
 func main() {
@@ -37,12 +47,195 @@ func main() {
 	service := integration.NewService(figmaToken)
 	handler := integration.NewHandler(service)
 
+	// Publish AI generation events to the capability service's notification inbox, with a
+	// service account token holding notifications:publish when the service checks tokens
+	if notificationURL := os.Getenv("NOTIFICATION_SERVICE_URL"); notificationURL != "" {
+		service.EnableNotifications(client.NewNotificationClient(notificationURL, os.Getenv("NOTIFICATION_SERVICE_TOKEN")))
+	}
+
+	// Index workspace spec files in the capability service's search index
+	if searchURL := os.Getenv("SEARCH_SERVICE_URL"); searchURL != "" {
+		service.EnableSearchIndex(client.NewSearchIndexClient(searchURL))
+		go service.ReindexAllWorkspaces(context.Background())
+	}
+
+	// Run Claude CLI code generation through the proxy on the host, signing requests with
+	// the shared secret and presenting a client certificate when mTLS is configured
+	proxyURL := os.Getenv("CLAUDE_PROXY_URL")
+	if proxyURL == "" {
+		proxyURL = "http://host.docker.internal:9085"
+	}
+	claudeProxy := client.NewClaudeProxyClient(proxyURL, os.Getenv("CLAUDE_PROXY_SECRET"))
+	if certFile := os.Getenv("CLAUDE_PROXY_CLIENT_CERT"); certFile != "" {
+		if err := claudeProxy.EnableTLS(certFile, os.Getenv("CLAUDE_PROXY_CLIENT_KEY"), os.Getenv("CLAUDE_PROXY_CA")); err != nil {
+			log.Fatalf("Failed to configure Claude CLI proxy TLS: %v", err)
+		}
+	} else if os.Getenv("CLAUDE_PROXY_SECRET") == "" {
+		log.Println("Warning: CLAUDE_PROXY_SECRET not set. The Claude CLI proxy will reject code generation requests.")
+	}
+	service.EnableClaudeProxy(claudeProxy)
+
+	// Register workspaces in the database so APIs can address them by ID, run AI
+	// generation and analysis as background jobs persisted there, store AI chat threads,
+	// record AI usage against budgets, and audit AI changes against AI policy presets
+	var workspaceRepo *repository.WorkspaceRepository
+	var jobManager *jobs.Manager
+	var conversationRepo *repository.ConversationRepository
+	var usageRepo *repository.AIUsageRepository
+	var auditRepo *repository.AIAuditRepository
+	var cacheStore aicache.Store
+	var vectorStore retrieval.Store
+	if databaseURL := os.Getenv("DATABASE_URL"); databaseURL != "" {
+		db, err := database.NewPostgresDB(databaseURL)
+		if err != nil {
+			log.Fatalf("Failed to connect to database: %v", err)
+		}
+		defer db.Close()
+
+		workspaceRepo = repository.NewWorkspaceRepository(db.DB)
+		service.EnableWorkspaceRegistry(workspaceRepo)
+		service.SyncWorkspaceRegistry()
+
+		workers := 4
+		if value := os.Getenv("JOB_WORKERS"); value != "" {
+			if workers, err = strconv.Atoi(value); err != nil {
+				log.Fatalf("Invalid JOB_WORKERS: %v", err)
+			}
+		}
+		jobRepo := repository.NewJobRepository(db.DB)
+		jobManager = jobs.NewManager(jobRepo, workers)
+		service.EnableJobs(jobManager, jobRepo)
+		jobManager.Start()
+
+		conversationRepo = repository.NewConversationRepository(db.DB)
+		service.EnableConversations(conversationRepo)
+
+		usageRepo = repository.NewAIUsageRepository(db.DB)
+		service.EnableUsage(usageRepo)
+
+		auditRepo = repository.NewAIAuditRepository(db.DB)
+		service.EnableAIAudit(auditRepo)
+
+		if os.Getenv("AI_CACHE_STORE") == "postgres" {
+			cacheStore = repository.NewAICacheRepository(db.DB)
+		}
+
+		// Keep retrieval vectors in Postgres when asked to and pgvector is installed
+		if os.Getenv("RETRIEVAL_STORE") == "pgvector" {
+			chunkRepo := repository.NewChunkRepository(db.DB)
+			if err := chunkRepo.Check(); err != nil {
+				log.Printf("Warning: %v. Retrieval vectors are kept on disk instead.", err)
+			} else {
+				vectorStore = chunkRepo
+			}
+		}
+	} else {
+		log.Println("Warning: DATABASE_URL not set. Workspaces are addressed by folder path only, AI jobs run inside their requests, AI chats are not stored, AI usage is neither recorded nor budgeted, and AI changes are not audited.")
+	}
+
+	// Embed workspace specs and code so AI endpoints can send the passages relevant to a
+	// request. Embeddings come from an OpenAI-compatible API when EMBEDDING_API_URL is set
+	// and from offline feature hashing otherwise; RETRIEVAL_STORE=off disables retrieval.
+	retrievalEnabled := os.Getenv("RETRIEVAL_STORE") != "off"
+	if retrievalEnabled {
+		var embedder retrieval.Embedder = retrieval.NewHashEmbedder(0)
+		if embeddingURL := os.Getenv("EMBEDDING_API_URL"); embeddingURL != "" {
+			model := os.Getenv("EMBEDDING_MODEL")
+			if model == "" {
+				model = "text-embedding-3-small"
+			}
+			embedder = retrieval.NewHTTPEmbedder(embeddingURL, model, os.Getenv("EMBEDDING_API_KEY"))
+		}
+		if vectorStore == nil {
+			indexDir := os.Getenv("RETRIEVAL_INDEX_DIR")
+			if indexDir == "" {
+				indexDir = filepath.Join("workspaces", ".retrieval")
+			}
+			vectorStore = retrieval.NewDiskStore(indexDir)
+		}
+		service.EnableRetrieval(retrieval.NewIndex(embedder, vectorStore))
+		go service.IndexAllWorkspacesForRetrieval(context.Background())
+	}
+
+	// Workspace watchers follow fsnotify events; polling is for volumes that deliver none
+	if interval := os.Getenv("WATCH_POLL_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil || d <= 0 {
+			log.Fatalf("Invalid WATCH_POLL_INTERVAL %q", interval)
+		}
+		service.EnableWatcherPolling(d)
+		log.Printf("Workspace watchers poll every %s", d)
+	}
+
+	// Follow edits made outside the UI in the search and retrieval indexes
+	if os.Getenv("SEARCH_SERVICE_URL") != "" || retrievalEnabled {
+		service.WatchAllWorkspaces()
+	}
+
+	// Scaffold new workspaces from the template catalog
+	templatesDir := os.Getenv("WORKSPACE_TEMPLATES_DIR")
+	if templatesDir == "" {
+		templatesDir = "templates"
+	}
+	service.EnableTemplates(templates.NewCatalog(templatesDir))
+
+	// Prompt versions saved at runtime, on top of the builtin prompts
+	promptsDir := os.Getenv("PROMPTS_DIR")
+	if promptsDir == "" {
+		promptsDir = "prompts"
+	}
+	service.EnablePrompts(prompts.NewLibrary(promptsDir))
+
+	// Answer deterministic AI calls repeated on unchanged inputs from a cache, kept on disk
+	// or, with AI_CACHE_STORE=postgres, in the database; AI_CACHE_STORE=off disables it
+	var aiCache *aicache.Cache
+	if os.Getenv("AI_CACHE_STORE") != "off" {
+		ttl := aicache.DefaultTTL
+		if value := os.Getenv("AI_CACHE_TTL"); value != "" {
+			var err error
+			if ttl, err = time.ParseDuration(value); err != nil || ttl <= 0 {
+				log.Fatalf("Invalid AI_CACHE_TTL %q: must be a positive duration such as 168h", value)
+			}
+		}
+		if cacheStore == nil {
+			if os.Getenv("AI_CACHE_STORE") == "postgres" {
+				log.Println("Warning: AI_CACHE_STORE=postgres needs DATABASE_URL. AI answers are cached on disk instead.")
+			}
+			cacheDir := os.Getenv("AI_CACHE_DIR")
+			if cacheDir == "" {
+				cacheDir = filepath.Join("workspaces", ".ai-cache")
+			}
+			cacheStore = aicache.NewDiskStore(cacheDir)
+		}
+		aiCache = aicache.New(cacheStore, ttl)
+		service.EnableAICache(aiCache)
+		go func() {
+			if n, err := aiCache.Purge(); err != nil {
+				log.Printf("Warning: %v", err)
+			} else if n > 0 {
+				log.Printf("Removed %d expired AI cache entries", n)
+			}
+		}()
+	}
+
+	// Run the AI chat's run_tests tool in containers without network access, or else as
+	// local processes of a separate unprivileged user. With neither, the tool is not offered:
+	// tests running as the service's user could read its secrets.
+	if image := os.Getenv("AGENT_TEST_IMAGE"); image != "" {
+		service.EnableTestContainers(image)
+	} else if testUser := os.Getenv("AGENT_TEST_USER"); testUser != "" {
+		if err := service.EnableTestUser(testUser); err != nil {
+			log.Fatalf("Invalid AGENT_TEST_USER: %v", err)
+		}
+	}
+
 	// CORS middleware
 	corsMiddleware := func(next http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
 			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Prefer, Last-Event-ID, Cache-Control")
+			w.Header().Set("Access-Control-Expose-Headers", "Location, X-Job-ID, X-AI-Budget-Warning, X-AI-Cache")
 
 			if r.Method == "OPTIONS" {
 				w.WriteHeader(http.StatusOK)
@@ -117,6 +310,12 @@ func main() {
 	mux.HandleFunc("OPTIONS /stop-app", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
 	mux.HandleFunc("POST /activate-ai-preset", corsMiddleware(handler.HandleActivateAIPreset))
 	mux.HandleFunc("OPTIONS /activate-ai-preset", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+	mux.HandleFunc("GET /workspace-events", corsMiddleware(handler.HandleWorkspaceEvents))
+	mux.HandleFunc("OPTIONS /workspace-events", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+	mux.HandleFunc("POST /search/reindex-workspace", corsMiddleware(handler.HandleReindexWorkspace))
+	mux.HandleFunc("OPTIONS /search/reindex-workspace", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+	mux.HandleFunc("GET /search/semantic", corsMiddleware(handler.HandleSemanticSearch))
+	mux.HandleFunc("OPTIONS /search/semantic", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
 	mux.HandleFunc("POST /save-specifications", corsMiddleware(handler.HandleSaveSpecifications))
 	mux.HandleFunc("OPTIONS /save-specifications", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
 	mux.HandleFunc("POST /read-specification", corsMiddleware(handler.HandleReadSpecification))
@@ -160,11 +359,139 @@ func main() {
 	mux.HandleFunc("GET /workspace-config", corsMiddleware(handler.HandleGetWorkspaceConfig))
 	mux.HandleFunc("OPTIONS /workspace-config", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
 
+	// Workspace template routes
+	mux.HandleFunc("GET /templates", corsMiddleware(handler.HandleListTemplates))
+	mux.HandleFunc("OPTIONS /templates", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+	mux.HandleFunc("POST /templates/import", corsMiddleware(handler.HandleImportTemplate))
+	mux.HandleFunc("OPTIONS /templates/import", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+	mux.HandleFunc("GET /templates/{id}", corsMiddleware(handler.HandleGetTemplate))
+	mux.HandleFunc("OPTIONS /templates/{id}", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+
+	// AI prompt template endpoints
+	mux.HandleFunc("GET /prompts", corsMiddleware(handler.HandleListPrompts))
+	mux.HandleFunc("OPTIONS /prompts", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+	mux.HandleFunc("GET /prompts/{name}", corsMiddleware(handler.HandleGetPrompt))
+	mux.HandleFunc("OPTIONS /prompts/{name}", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+	mux.HandleFunc("POST /prompts/{name}/versions", corsMiddleware(handler.HandleSavePromptVersion))
+	mux.HandleFunc("OPTIONS /prompts/{name}/versions", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+
+	// AI policy rules of a workspace
+	mux.HandleFunc("GET /ai-governance", corsMiddleware(handler.HandleGetAIGovernance))
+	mux.HandleFunc("OPTIONS /ai-governance", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+
+	// Workspace registry routes
+	if workspaceRepo != nil {
+		mux.HandleFunc("GET /workspaces", corsMiddleware(handler.HandleListWorkspaces))
+		mux.HandleFunc("POST /workspaces", corsMiddleware(handler.HandleCreateWorkspace))
+		mux.HandleFunc("OPTIONS /workspaces", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+		mux.HandleFunc("POST /workspaces/reconcile", corsMiddleware(handler.HandleReconcileWorkspaces))
+		mux.HandleFunc("OPTIONS /workspaces/reconcile", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+		mux.HandleFunc("POST /workspaces/import", corsMiddleware(handler.HandleImportWorkspace))
+		mux.HandleFunc("OPTIONS /workspaces/import", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+		mux.HandleFunc("GET /workspaces/{id}", corsMiddleware(handler.HandleGetWorkspace))
+		mux.HandleFunc("PUT /workspaces/{id}", corsMiddleware(handler.HandleUpdateWorkspace))
+		mux.HandleFunc("DELETE /workspaces/{id}", corsMiddleware(handler.HandleDeleteWorkspace))
+		mux.HandleFunc("OPTIONS /workspaces/{id}", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+		mux.HandleFunc("POST /workspaces/{id}/archive", corsMiddleware(handler.HandleArchiveWorkspace))
+		mux.HandleFunc("OPTIONS /workspaces/{id}/archive", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+		mux.HandleFunc("POST /workspaces/{id}/restore", corsMiddleware(handler.HandleRestoreWorkspace))
+		mux.HandleFunc("OPTIONS /workspaces/{id}/restore", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+		mux.HandleFunc("PUT /workspaces/{id}/owner", corsMiddleware(handler.HandleTransferWorkspace))
+		mux.HandleFunc("OPTIONS /workspaces/{id}/owner", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+		mux.HandleFunc("GET /workspaces/{id}/export", corsMiddleware(handler.HandleExportWorkspace))
+		mux.HandleFunc("OPTIONS /workspaces/{id}/export", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+		mux.HandleFunc("GET /workspaces/{id}/integrations", corsMiddleware(handler.HandleListWorkspaceIntegrations))
+		mux.HandleFunc("POST /workspaces/{id}/integrations", corsMiddleware(handler.HandleLinkWorkspaceIntegration))
+		mux.HandleFunc("OPTIONS /workspaces/{id}/integrations", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+		mux.HandleFunc("DELETE /workspaces/{id}/integrations/{linkId}", corsMiddleware(handler.HandleUnlinkWorkspaceIntegration))
+		mux.HandleFunc("OPTIONS /workspaces/{id}/integrations/{linkId}", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+	}
+
+	// Background job routes
+	if jobManager != nil {
+		mux.HandleFunc("GET /jobs", corsMiddleware(handler.HandleListJobs))
+		mux.HandleFunc("OPTIONS /jobs", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+		mux.HandleFunc("GET /jobs/{id}", corsMiddleware(handler.HandleGetJob))
+		mux.HandleFunc("OPTIONS /jobs/{id}", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+		mux.HandleFunc("GET /jobs/{id}/logs", corsMiddleware(handler.HandleJobLogs))
+		mux.HandleFunc("OPTIONS /jobs/{id}/logs", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+		mux.HandleFunc("GET /jobs/{id}/events", corsMiddleware(handler.HandleJobEvents))
+		mux.HandleFunc("OPTIONS /jobs/{id}/events", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+		mux.HandleFunc("POST /jobs/{id}/cancel", corsMiddleware(handler.HandleCancelJob))
+		mux.HandleFunc("OPTIONS /jobs/{id}/cancel", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+	}
+
+	// AI conversation routes
+	if conversationRepo != nil {
+		mux.HandleFunc("GET /conversations", corsMiddleware(handler.HandleListConversations))
+		mux.HandleFunc("POST /conversations", corsMiddleware(handler.HandleCreateConversation))
+		mux.HandleFunc("OPTIONS /conversations", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+		mux.HandleFunc("GET /conversations/{id}", corsMiddleware(handler.HandleGetConversation))
+		mux.HandleFunc("DELETE /conversations/{id}", corsMiddleware(handler.HandleDeleteConversation))
+		mux.HandleFunc("OPTIONS /conversations/{id}", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+		mux.HandleFunc("POST /conversations/{id}/fork", corsMiddleware(handler.HandleForkConversation))
+		mux.HandleFunc("OPTIONS /conversations/{id}/fork", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+	}
+
+	// AI usage reporting and budget routes
+	if usageRepo != nil {
+		mux.HandleFunc("GET /ai-usage", corsMiddleware(handler.HandleAIUsage))
+		mux.HandleFunc("OPTIONS /ai-usage", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+		mux.HandleFunc("GET /ai-budgets", corsMiddleware(handler.HandleListAIBudgets))
+		mux.HandleFunc("PUT /ai-budgets", corsMiddleware(handler.HandleSetAIBudget))
+		mux.HandleFunc("OPTIONS /ai-budgets", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+		mux.HandleFunc("DELETE /ai-budgets/{id}", corsMiddleware(handler.HandleDeleteAIBudget))
+		mux.HandleFunc("OPTIONS /ai-budgets/{id}", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+	}
+
+	// AI change audit routes
+	if auditRepo != nil {
+		mux.HandleFunc("GET /ai-audit", corsMiddleware(handler.HandleListAIAudit))
+		mux.HandleFunc("OPTIONS /ai-audit", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+		mux.HandleFunc("POST /ai-audit/{id}/review", corsMiddleware(handler.HandleReviewAIAudit))
+		mux.HandleFunc("OPTIONS /ai-audit/{id}/review", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+	}
+
+	// AI response cache routes
+	if aiCache != nil {
+		mux.HandleFunc("GET /ai-cache", corsMiddleware(handler.HandleAICacheStats))
+		mux.HandleFunc("DELETE /ai-cache", corsMiddleware(handler.HandleClearAICache))
+		mux.HandleFunc("OPTIONS /ai-cache", corsMiddleware(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+	}
+
 	// Create server
 	// Note: WriteTimeout increased to 5 minutes for long-running AI analysis
+	// Verify bearer tokens with the auth service so API tokens are held to their scopes and
+	// users to their role permissions
+	var verifier integration.TokenVerifier
+	if authURL := os.Getenv("AUTH_SERVICE_URL"); authURL != "" {
+		verifier = client.NewAuthClient(authURL)
+	}
+
+	// Every request needs a token unless REQUIRE_AUTH=false; anonymous requests then hold no
+	// permissions, or are not checked at all in legacy mode without AUTH_SERVICE_URL
+	requireAuth := os.Getenv("REQUIRE_AUTH") != "false"
+	if requireAuth && verifier == nil {
+		log.Fatal("REQUIRE_AUTH needs AUTH_SERVICE_URL to verify tokens; set REQUIRE_AUTH=false for legacy anonymous access")
+	}
+	if verifier == nil {
+		log.Println("Legacy anonymous mode: requests are not authenticated")
+	}
+
+	// Attribute AI calls to their workspace and user, inside the middleware that resolves them
+	var routes http.Handler = mux
+	if usageRepo != nil {
+		routes = integration.MeterUsage(service, routes)
+	}
+
+	// Resolve workspace IDs to registered workspaces and keep client paths inside them
+	if workspaceRepo != nil {
+		routes = integration.WorkspaceScope(workspaceRepo, routes)
+	}
+
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%s", port),
-		Handler:      mux,
+		Handler:      integration.TokenAuth(verifier, requireAuth, routes),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 5 * time.Minute,
 		IdleTimeout:  60 * time.Second,
@@ -194,5 +521,10 @@ func main() {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	// Interrupted jobs are requeued for the next start when they have attempts left
+	if jobManager != nil {
+		jobManager.Stop()
+	}
+
 	log.Println("Server exited")
 }
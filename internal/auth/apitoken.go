@@ -0,0 +1,228 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// APITokenPrefix marks personal access tokens so they can be told apart from JWTs
+const APITokenPrefix = "ubc_"
+
+// Token lifetime limits, in days
+const (
+	DefaultAPITokenDays = 90
+	MaxAPITokenDays     = 365
+)
+
+// serviceAccountDomain is used to give service accounts a unique, non-routable email
+const serviceAccountDomain = "service-accounts.ubecode.local"
+
+var (
+	ErrAPITokenNotFound   = errors.New("api token not found")
+	ErrNotServiceAccount  = errors.New("user is not a service account")
+	ErrInvalidTokenExpiry = fmt.Errorf("expiresInDays must be between 1 and %d", MaxAPITokenDays)
+)
+
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// CreateAPIToken mints a personal access token for userID. createdBy is the user who asked
+// for it, which differs from userID when an admin creates a service account token.
+func (s *Service) CreateAPIToken(userID, createdBy int, req *CreateAPITokenRequest) (*CreateAPITokenResponse, error) {
+	if err := ValidateScopes(req.Scopes); err != nil {
+		return nil, err
+	}
+
+	days := req.ExpiresInDays
+	if days == 0 {
+		days = DefaultAPITokenDays
+	}
+	if days < 1 || days > MaxAPITokenDays {
+		return nil, ErrInvalidTokenExpiry
+	}
+
+	secret, err := newOpaqueToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := APITokenPrefix + secret
+	prefix := token[:len(APITokenPrefix)+8]
+
+	var t APIToken
+	err = s.db.QueryRow(`
+		INSERT INTO api_tokens (user_id, name, token_prefix, token_hash, scopes, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, user_id, name, token_prefix, scopes, expires_at, last_used_at, created_by, created_at
+	`, userID, req.Name, prefix, hashToken(token), pq.Array(req.Scopes), time.Now().AddDate(0, 0, days), createdBy).Scan(
+		&t.ID, &t.UserID, &t.Name, &t.Prefix, pq.Array(&t.Scopes), &t.ExpiresAt, &t.LastUsedAt, &t.CreatedBy, &t.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return &CreateAPITokenResponse{APIToken: t, Token: token}, nil
+}
+
+// ListAPITokens returns a user's unrevoked tokens, including expired ones
+func (s *Service) ListAPITokens(userID int) ([]APIToken, error) {
+	rows, err := s.db.Query(`
+		SELECT id, user_id, name, token_prefix, scopes, expires_at, last_used_at, created_by, created_at
+		FROM api_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		var t APIToken
+		err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, pq.Array(&t.Scopes), &t.ExpiresAt, &t.LastUsedAt, &t.CreatedBy, &t.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan error: %w", err)
+		}
+		tokens = append(tokens, t)
+	}
+
+	return tokens, nil
+}
+
+// RevokeAPIToken revokes one of a user's tokens
+func (s *Service) RevokeAPIToken(userID, tokenID int) error {
+	result, err := s.db.Exec(`
+		UPDATE api_tokens SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, tokenID, userID)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrAPITokenNotFound
+	}
+	return nil
+}
+
+// verifyAPIToken resolves a personal access token to claims carrying its scopes
+func (s *Service) verifyAPIToken(token string) (*Claims, error) {
+	claims := &Claims{}
+	var expiresAt time.Time
+	err := s.db.QueryRow(`
+		SELECT t.id, t.scopes, t.expires_at, u.id, u.email, u.role
+		FROM api_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = $1
+		  AND t.revoked_at IS NULL
+		  AND t.expires_at > CURRENT_TIMESTAMP
+		  AND u.is_active = true
+	`, hashToken(token)).Scan(&claims.TokenID, pq.Array(&claims.Scopes), &expiresAt, &claims.UserID, &claims.Email, &claims.Role)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if claims.Scopes == nil {
+		claims.Scopes = []string{}
+	}
+
+	// Record usage at most once a minute to keep busy CI tokens from writing on every call
+	_, err = s.db.Exec(`
+		UPDATE api_tokens SET last_used_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute')
+	`, claims.TokenID)
+	if err != nil {
+		log.Printf("Warning: failed to update token last use: %v", err)
+	}
+
+	return claims, nil
+}
+
+// CreateServiceAccount creates a non-human user that can only authenticate with API tokens
+func (s *Service) CreateServiceAccount(req *CreateServiceAccountRequest, createdBy int) (*ServiceAccount, error) {
+	role := req.Role
+	if role == "" {
+		role = "user"
+	}
+
+	slug := strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(req.Name), "-"), "-")
+	if slug == "" {
+		return nil, fmt.Errorf("name must contain letters or digits")
+	}
+	email := fmt.Sprintf("%s@%s", slug, serviceAccountDomain)
+
+	// An empty password hash never matches, so service accounts cannot log in
+	var account ServiceAccount
+	err := s.db.QueryRow(`
+		INSERT INTO users (email, password_hash, name, role, is_active, is_service_account, created_by)
+		VALUES ($1, '', $2, $3, true, true, $4)
+		RETURNING id, name, email, role, is_active, created_by, created_at
+	`, email, req.Name, role, createdBy).Scan(
+		&account.ID, &account.Name, &account.Email, &account.Role, &account.IsActive, &account.CreatedBy, &account.CreatedAt,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "users_email_key") {
+			return nil, ErrUserExists
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return &account, nil
+}
+
+// ListServiceAccounts returns all service accounts
+func (s *Service) ListServiceAccounts() ([]ServiceAccount, error) {
+	rows, err := s.db.Query(`
+		SELECT id, name, email, role, is_active, created_by, created_at
+		FROM users
+		WHERE is_service_account = true
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := []ServiceAccount{}
+	for rows.Next() {
+		var account ServiceAccount
+		err := rows.Scan(&account.ID, &account.Name, &account.Email, &account.Role, &account.IsActive, &account.CreatedBy, &account.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan error: %w", err)
+		}
+		accounts = append(accounts, account)
+	}
+
+	return accounts, nil
+}
+
+// requireServiceAccount checks that id refers to a service account
+func (s *Service) requireServiceAccount(id int) error {
+	var isServiceAccount bool
+	err := s.db.QueryRow("SELECT is_service_account FROM users WHERE id = $1", id).Scan(&isServiceAccount)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if !isServiceAccount {
+		return ErrNotServiceAccount
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package auth
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// ListScopes returns the scopes a token can be granted
+func (h *Handler) ListScopes(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, AllScopes)
+}
+
+// ListAPITokens returns the caller's personal access tokens
+func (h *Handler) ListAPITokens(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	tokens, err := h.service.ListAPITokens(claims.UserID)
+	if err != nil {
+		log.Printf("List API tokens error: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, tokens)
+}
+
+// CreateAPIToken mints a personal access token for the caller
+func (h *Handler) CreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	// A leaked token must not be able to mint replacements for itself
+	if claims.IsAPIToken() {
+		respondError(w, http.StatusForbidden, "API tokens cannot create other tokens")
+		return
+	}
+
+	h.createAPIToken(w, r, claims.UserID, claims.UserID)
+}
+
+// RevokeAPIToken revokes one of the caller's personal access tokens
+func (h *Handler) RevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	h.revokeAPIToken(w, r, claims.UserID)
+}
+
+// ListServiceAccounts returns all service accounts (admin only)
+func (h *Handler) ListServiceAccounts(w http.ResponseWriter, r *http.Request) {
+	accounts, err := h.service.ListServiceAccounts()
+	if err != nil {
+		log.Printf("List service accounts error: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, accounts)
+}
+
+// CreateServiceAccount creates a service account (admin only)
+func (h *Handler) CreateServiceAccount(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	var req CreateServiceAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Name == "" {
+		respondError(w, http.StatusBadRequest, "Name is required")
+		return
+	}
+
+	account, err := h.service.CreateServiceAccount(&req, claims.UserID)
+	if err == ErrUserExists {
+		respondError(w, http.StatusConflict, "A service account with this name already exists")
+		return
+	}
+	if err != nil {
+		log.Printf("Create service account error: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, account)
+}
+
+// ListServiceAccountTokens returns a service account's tokens (admin only)
+func (h *Handler) ListServiceAccountTokens(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.serviceAccountID(w, r)
+	if !ok {
+		return
+	}
+
+	tokens, err := h.service.ListAPITokens(id)
+	if err != nil {
+		log.Printf("List service account tokens error: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, tokens)
+}
+
+// CreateServiceAccountToken mints a token for a service account (admin only)
+func (h *Handler) CreateServiceAccountToken(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	id, ok := h.serviceAccountID(w, r)
+	if !ok {
+		return
+	}
+
+	h.createAPIToken(w, r, id, claims.UserID)
+}
+
+// RevokeServiceAccountToken revokes a service account token (admin only)
+func (h *Handler) RevokeServiceAccountToken(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.serviceAccountID(w, r)
+	if !ok {
+		return
+	}
+
+	h.revokeAPIToken(w, r, id)
+}
+
+// serviceAccountID parses the {id} path value and checks it is a service account
+func (h *Handler) serviceAccountID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid service account ID")
+		return 0, false
+	}
+
+	err = h.service.requireServiceAccount(id)
+	if err == ErrUserNotFound || err == ErrNotServiceAccount {
+		respondError(w, http.StatusNotFound, "Service account not found")
+		return 0, false
+	}
+	if err != nil {
+		log.Printf("Service account lookup error: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return 0, false
+	}
+
+	return id, true
+}
+
+func (h *Handler) createAPIToken(w http.ResponseWriter, r *http.Request, userID, createdBy int) {
+	var req CreateAPITokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Name == "" {
+		respondError(w, http.StatusBadRequest, "Name is required")
+		return
+	}
+	if err := ValidateScopes(req.Scopes); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	token, err := h.service.CreateAPIToken(userID, createdBy, &req)
+	if err == ErrInvalidTokenExpiry {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Create API token error: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, token)
+}
+
+func (h *Handler) revokeAPIToken(w http.ResponseWriter, r *http.Request, userID int) {
+	tokenID, err := strconv.Atoi(r.PathValue("tokenId"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid token ID")
+		return
+	}
+
+	err = h.service.RevokeAPIToken(userID, tokenID)
+	if err == ErrAPITokenNotFound {
+		respondError(w, http.StatusNotFound, "Token not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Revoke API token error: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
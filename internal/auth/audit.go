@@ -0,0 +1,105 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Authentication audit events
+const (
+	EventLoginSucceeded         = "login_succeeded"
+	EventLoginFailed            = "login_failed"
+	EventAccountLocked          = "account_locked"
+	EventPasswordResetRequested = "password_reset_requested"
+	EventPasswordReset          = "password_reset"
+	EventMFAEnabled             = "mfa_enabled"
+	EventMFADisabled            = "mfa_disabled"
+	EventMFAFailed              = "mfa_failed"
+	EventRecoveryCodeUsed       = "recovery_code_used"
+	EventRecoveryCodesRenewed   = "recovery_codes_regenerated"
+	EventUserProvisioned        = "user_provisioned"
+	EventUserDeprovisioned      = "user_deprovisioned"
+)
+
+// AuthEvent is an entry in the authentication audit log
+type AuthEvent struct {
+	ID        int                    `json:"id"`
+	UserID    *int                   `json:"userId,omitempty"`
+	Email     string                 `json:"email"`
+	Event     string                 `json:"event"`
+	IPAddress string                 `json:"ipAddress"`
+	UserAgent string                 `json:"userAgent"`
+	Details   map[string]interface{} `json:"details"`
+	CreatedAt time.Time              `json:"createdAt"`
+}
+
+// recordAuthEvent writes an audit entry; userID 0 means the account is unknown.
+// Failures are logged rather than returned so auditing never blocks a login.
+func (s *Service) recordAuthEvent(userID int, email, event string, client ClientInfo, details map[string]interface{}) {
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	detailsJSON, _ := json.Marshal(details)
+
+	var uid sql.NullInt64
+	if userID != 0 {
+		uid = sql.NullInt64{Int64: int64(userID), Valid: true}
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO auth_events (user_id, email, event, ip_address, user_agent, details)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, uid, email, event, client.IPAddress, client.UserAgent, detailsJSON)
+	if err != nil {
+		log.Printf("Failed to record auth event %s: %v", event, err)
+	}
+}
+
+// ListAuthEvents returns the newest audit entries, optionally for one user
+func (s *Service) ListAuthEvents(userID int, limit int) ([]AuthEvent, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	query := `
+		SELECT id, user_id, COALESCE(email, ''), event, COALESCE(ip_address, ''), COALESCE(user_agent, ''), details, created_at
+		FROM auth_events`
+	args := []interface{}{}
+	if userID != 0 {
+		query += ` WHERE user_id = $1`
+		args = append(args, userID)
+	}
+	query += fmt.Sprintf(` ORDER BY created_at DESC, id DESC LIMIT %d`, limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	defer rows.Close()
+
+	events := []AuthEvent{}
+	for rows.Next() {
+		var e AuthEvent
+		var uid sql.NullInt64
+		var details []byte
+		if err := rows.Scan(&e.ID, &uid, &e.Email, &e.Event, &e.IPAddress, &e.UserAgent, &details, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan error: %w", err)
+		}
+		if uid.Valid {
+			id := int(uid.Int64)
+			e.UserID = &id
+		}
+		json.Unmarshal(details, &e.Details)
+		events = append(events, e)
+	}
+	return events, nil
+}
@@ -14,12 +14,18 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+
+	"github.com/jareynolds/ubecode/pkg/repository"
 )
 
 // Handler handles HTTP requests for authentication
 type Handler struct {
 	service     *Service
 	oauthConfig *OAuthConfig
+	rbac        *repository.RBACRepository
+
+	ssoProviders map[string]*OIDCProvider
+	ssoOrder     []string
 }
 
 // NewHandler creates a new auth handler
@@ -27,6 +33,11 @@ func NewHandler(service *Service) *Handler {
 	return &Handler{service: service}
 }
 
+// SetRBACRepository enables the role and workspace membership endpoints
+func (h *Handler) SetRBACRepository(repo *repository.RBACRepository) {
+	h.rbac = repo
+}
+
 // SetOAuthConfig sets the OAuth configuration for the handler
 func (h *Handler) SetOAuthConfig(config *OAuthConfig) {
 	h.oauthConfig = config
@@ -57,14 +68,17 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, err := h.service.Authenticate(req.Email, req.Password)
+	resp, challenge, err := h.service.Authenticate(req.Email, req.Password, h.service.ClientInfo(r))
 	if err == ErrInvalidCredentials {
 		respondError(w, http.StatusUnauthorized, "Invalid email or password")
 		return
 	}
 	if err != nil {
-		log.Printf("Login error: %v", err)
-		respondError(w, http.StatusInternalServerError, "Internal server error")
+		respondLoginError(w, "Login", err)
+		return
+	}
+	if challenge != nil {
+		respondJSON(w, http.StatusOK, challenge)
 		return
 	}
 
@@ -99,8 +113,9 @@ func (h *Handler) VerifyToken(w http.ResponseWriter, r *http.Request) {
 	}
 
 	respondJSON(w, http.StatusOK, VerifyTokenResponse{
-		Valid: true,
-		User:  *user,
+		Valid:  true,
+		User:   *user,
+		Scopes: claims.Scopes,
 	})
 }
 
@@ -141,12 +156,18 @@ func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "Email, password, and name are required")
 		return
 	}
+	if req.Role != "" && !h.roleExists(w, req.Role) {
+		return
+	}
 
 	user, err := h.service.CreateUser(&req)
 	if err == ErrUserExists {
 		respondError(w, http.StatusConflict, "User with this email already exists")
 		return
 	}
+	if respondPasswordError(w, err) {
+		return
+	}
 	if err != nil {
 		log.Printf("Create user error: %v", err)
 		respondError(w, http.StatusInternalServerError, "Internal server error")
@@ -170,12 +191,18 @@ func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
+	if req.Role != nil && !h.roleExists(w, *req.Role) {
+		return
+	}
 
 	user, err := h.service.UpdateUser(id, &req)
 	if err == ErrUserNotFound {
 		respondError(w, http.StatusNotFound, "User not found")
 		return
 	}
+	if respondPasswordError(w, err) {
+		return
+	}
 	if err != nil {
 		log.Printf("Update user error: %v", err)
 		respondError(w, http.StatusInternalServerError, "Internal server error")
@@ -185,6 +212,24 @@ func (h *Handler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, user)
 }
 
+// roleExists checks that a global role is defined, responding with an error if not
+func (h *Handler) roleExists(w http.ResponseWriter, name string) bool {
+	if h.rbac == nil {
+		return true
+	}
+	_, err := h.rbac.GetRoleByName(name)
+	if err == repository.ErrRoleNotFound {
+		respondError(w, http.StatusBadRequest, "Unknown role: "+name)
+		return false
+	}
+	if err != nil {
+		log.Printf("Get role error: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return false
+	}
+	return true
+}
+
 // DeleteUser deletes a user (admin only)
 func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	idStr := r.PathValue("id")
@@ -215,16 +260,15 @@ func (h *Handler) GoogleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	state, err := h.oauthConfig.GenerateStateToken()
+	st, err := h.service.CreateSSOState(GoogleProviderConfig.ID)
 	if err != nil {
-		log.Printf("Failed to generate state token: %v", err)
+		log.Printf("Failed to create login state: %v", err)
 		respondError(w, http.StatusInternalServerError, "Failed to initiate OAuth flow")
 		return
 	}
 
-	url := h.oauthConfig.GoogleConfig.AuthCodeURL(state)
 	respondJSON(w, http.StatusOK, map[string]string{
-		"url": url,
+		"url": h.oauthConfig.AuthCodeURL(st),
 	})
 }
 
@@ -245,57 +289,19 @@ func (h *Handler) GoogleCallback(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate state to prevent CSRF
-	if !h.oauthConfig.ValidateState(state) {
-		respondError(w, http.StatusUnauthorized, "Invalid state parameter")
+	st, err := h.service.ConsumeSSOState(GoogleProviderConfig.ID, state)
+	if err != nil {
+		h.respondSSOError(w, err)
 		return
 	}
 
 	// Get user info from Google
-	userInfo, err := h.oauthConfig.GetGoogleUserInfo(r.Context(), code)
+	userInfo, err := h.oauthConfig.GetGoogleUserInfo(r.Context(), code, st.CodeVerifier)
 	if err != nil {
 		log.Printf("Failed to get user info: %v", err)
 		respondError(w, http.StatusInternalServerError, "Failed to get user information")
 		return
 	}
 
-	// Check if user exists, create if not
-	user, err := h.service.GetUserByEmail(userInfo.Email)
-	if err == ErrUserNotFound {
-		// Create new user from Google info
-		createReq := &CreateUserRequest{
-			Email: userInfo.Email,
-			Name:  userInfo.Name,
-			// For OAuth users, we don't store a password
-			Password: "",
-			Role:     "user",
-		}
-		user, err = h.service.CreateOAuthUser(createReq, "google", userInfo.ID)
-		if err != nil {
-			log.Printf("Failed to create OAuth user: %v", err)
-			respondError(w, http.StatusInternalServerError, "Failed to create user")
-			return
-		}
-	} else if err != nil {
-		log.Printf("Failed to get user: %v", err)
-		respondError(w, http.StatusInternalServerError, "Internal server error")
-		return
-	}
-
-	// Generate JWT token
-	token, err := h.service.GenerateTokenFromCredentials(user.ID, user.Email, user.Role)
-	if err != nil {
-		log.Printf("Failed to generate token: %v", err)
-		respondError(w, http.StatusInternalServerError, "Failed to generate token")
-		return
-	}
-
-	// Update last login
-	if err := h.service.UpdateLastLogin(user.ID); err != nil {
-		log.Printf("Failed to update last login: %v", err)
-	}
-
-	respondJSON(w, http.StatusOK, &LoginResponse{
-		Token: token,
-		User:  *user,
-	})
+	h.completeSSOLogin(w, r, &GoogleProviderConfig, userInfo.Identity())
 }
@@ -0,0 +1,166 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+var ErrTooManyAttempts = errors.New("too many failed login attempts from this address")
+
+// AccountLockedError is returned while an account is locked after repeated failures
+type AccountLockedError struct {
+	Until time.Time
+}
+
+func (e *AccountLockedError) Error() string {
+	return "account is temporarily locked after repeated failed logins"
+}
+
+// LockoutPolicy controls progressive account lockout and per-address throttling
+type LockoutPolicy struct {
+	// Threshold is the number of consecutive failures that locks the account
+	Threshold int
+	// BaseDelay is the first lock duration; every further failure doubles it
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// IPLimit caps failed logins from one address within IPWindow, across all accounts
+	IPLimit  int
+	IPWindow time.Duration
+}
+
+// DefaultLockoutPolicy is used when no LOCKOUT_* variables are set
+var DefaultLockoutPolicy = LockoutPolicy{
+	Threshold: 5,
+	BaseDelay: time.Minute,
+	MaxDelay:  time.Hour,
+	IPLimit:   50,
+	IPWindow:  15 * time.Minute,
+}
+
+// LockoutPolicyFromEnv reads the policy from LOCKOUT_THRESHOLD, LOCKOUT_BASE_DELAY,
+// LOCKOUT_MAX_DELAY, LOGIN_IP_LIMIT and LOGIN_IP_WINDOW
+func LockoutPolicyFromEnv() LockoutPolicy {
+	p := DefaultLockoutPolicy
+	if n, err := strconv.Atoi(os.Getenv("LOCKOUT_THRESHOLD")); err == nil && n > 0 {
+		p.Threshold = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("LOCKOUT_BASE_DELAY")); err == nil && d > 0 {
+		p.BaseDelay = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("LOCKOUT_MAX_DELAY")); err == nil && d > 0 {
+		p.MaxDelay = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("LOGIN_IP_LIMIT")); err == nil && n > 0 {
+		p.IPLimit = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("LOGIN_IP_WINDOW")); err == nil && d > 0 {
+		p.IPWindow = d
+	}
+	return p
+}
+
+// LockDuration returns how long to lock an account after the given number of
+// consecutive failures, or 0 when it stays unlocked
+func (p LockoutPolicy) LockDuration(failures int) time.Duration {
+	if failures < p.Threshold {
+		return 0
+	}
+	d := p.BaseDelay
+	for i := p.Threshold; i < failures && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+// SetLockoutPolicy replaces the lockout policy
+func (s *Service) SetLockoutPolicy(policy LockoutPolicy) {
+	s.lockout = policy
+}
+
+// checkAddressThrottle rejects logins from an address with too many recent failures
+func (s *Service) checkAddressThrottle(client ClientInfo) error {
+	if client.IPAddress == "" || s.lockout.IPLimit <= 0 {
+		return nil
+	}
+	var failures int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*) FROM auth_events
+		WHERE ip_address = $1 AND event IN ($2, $3) AND created_at > $4
+	`, client.IPAddress, EventLoginFailed, EventMFAFailed, time.Now().Add(-s.lockout.IPWindow)).Scan(&failures)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if failures >= s.lockout.IPLimit {
+		return ErrTooManyAttempts
+	}
+	return nil
+}
+
+// checkAccountLock returns an AccountLockedError while the user is locked out
+func (s *Service) checkAccountLock(userID int) error {
+	var lockedUntil *time.Time
+	if err := s.db.QueryRow(`SELECT locked_until FROM users WHERE id = $1`, userID).Scan(&lockedUntil); err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if lockedUntil != nil && time.Now().Before(*lockedUntil) {
+		return &AccountLockedError{Until: *lockedUntil}
+	}
+	return nil
+}
+
+// registerFailedLogin counts a failed password or second-factor attempt and locks the
+// account once the policy threshold is reached
+func (s *Service) registerFailedLogin(userID int, email, event string, client ClientInfo, reason string) {
+	s.recordAuthEvent(userID, email, event, client, map[string]interface{}{"reason": reason})
+
+	var failures int
+	err := s.db.QueryRow(`
+		UPDATE users SET failed_login_count = failed_login_count + 1 WHERE id = $1
+		RETURNING failed_login_count
+	`, userID).Scan(&failures)
+	if err != nil {
+		log.Printf("Failed to count failed login: %v", err)
+		return
+	}
+
+	lock := s.lockout.LockDuration(failures)
+	if lock == 0 {
+		return
+	}
+	until := time.Now().Add(lock)
+	if _, err := s.db.Exec(`UPDATE users SET locked_until = $1 WHERE id = $2`, until, userID); err != nil {
+		log.Printf("Failed to lock account: %v", err)
+		return
+	}
+	s.recordAuthEvent(userID, email, EventAccountLocked, client, map[string]interface{}{
+		"failures":    failures,
+		"lockedUntil": until,
+	})
+}
+
+// UnlockUser clears a user's lockout (admin only)
+func (s *Service) UnlockUser(userID int) error {
+	result, err := s.db.Exec(`UPDATE users SET failed_login_count = 0, locked_until = NULL WHERE id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
@@ -0,0 +1,588 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	totpPeriod           = 30 // Seconds per code, as used by authenticator apps
+	totpDigits           = 6
+	totpSkew             = 1 // Steps accepted either side of now, for clock drift
+	recoveryCodeCount    = 10
+	mfaChallengeTTL      = 5 * time.Minute
+	maxChallengeAttempts = 5
+	mfaIssuer            = "UbeCode"
+)
+
+// MFA challenge purposes
+const (
+	mfaPurposeVerify = "verify"
+	mfaPurposeEnroll = "enroll"
+)
+
+var (
+	ErrInvalidMFAToken   = errors.New("invalid or expired MFA token")
+	ErrInvalidMFACode    = errors.New("invalid authentication code")
+	ErrMFANotPending     = errors.New("no MFA enrollment in progress")
+	ErrMFANotEnabled     = errors.New("MFA is not enabled")
+	ErrMFARequiredByRole = errors.New("MFA is required for this role")
+	ErrMFAAlreadyEnabled = errors.New("MFA is already enabled")
+	base32NoPadding      = base32.StdEncoding.WithPadding(base32.NoPadding)
+	recoveryCodeEncoding = base32.NewEncoding("abcdefghijkmnpqrstuvwxyz23456789").WithPadding(base32.NoPadding)
+)
+
+// MFAChallengeResponse is returned instead of tokens when a login needs a second factor
+type MFAChallengeResponse struct {
+	MFARequired        bool      `json:"mfaRequired"`
+	EnrollmentRequired bool      `json:"enrollmentRequired,omitempty"` // The role requires MFA but the user has not set it up
+	MFAToken           string    `json:"mfaToken"`
+	ExpiresAt          time.Time `json:"expiresAt"`
+}
+
+// MFASetupResponse carries a new TOTP secret for the user's authenticator app
+type MFASetupResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauthUrl"`
+}
+
+// MFAEnableResponse carries recovery codes, shown once, and the session when
+// enrollment completed a login
+type MFAEnableResponse struct {
+	RecoveryCodes []string       `json:"recoveryCodes"`
+	Login         *LoginResponse `json:"login,omitempty"`
+}
+
+// MFAStatus describes a user's second factor
+type MFAStatus struct {
+	Enabled                bool `json:"enabled"`
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recoveryCodesRemaining"`
+}
+
+// totpCode computes the RFC 6238 code for a time step
+func totpCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// verifyTOTP checks a code around now and returns its time step. Steps at or before
+// lastStep are rejected so an intercepted code cannot be replayed.
+func verifyTOTP(secret []byte, code string, now time.Time, lastStep int64) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// otpauthURL builds the URL authenticator apps import, usually shown as a QR code
+func otpauthURL(email string, secret []byte) string {
+	v := url.Values{}
+	v.Set("secret", base32NoPadding.EncodeToString(secret))
+	v.Set("issuer", mfaIssuer)
+	v.Set("digits", fmt.Sprint(totpDigits))
+	v.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + url.PathEscape(mfaIssuer+":"+email) + "?" + v.Encode()
+}
+
+// generateRecoveryCodes returns codes formatted as xxxxx-xxxxx
+func generateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		s := recoveryCodeEncoding.EncodeToString(b)[:10]
+		codes[i] = s[:5] + "-" + s[5:]
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode accepts codes typed with or without the dash and in any case
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	if len(code) != 10 {
+		return code
+	}
+	return code[:5] + "-" + code[5:]
+}
+
+// SetMFAEncryptionKey sets the key protecting stored TOTP secrets. It defaults to one
+// derived from the JWT secret; set it explicitly so JWT_SECRET can be rotated.
+func (s *Service) SetMFAEncryptionKey(key string) {
+	sum := sha256.Sum256([]byte(key))
+	s.mfaKey = sum[:]
+}
+
+func (s *Service) encryptSecret(secret []byte) (string, error) {
+	block, err := aes.NewCipher(s.mfaKey)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, secret, nil)), nil
+}
+
+func (s *Service) decryptSecret(stored string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(stored)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(s.mfaKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("stored MFA secret is corrupt")
+	}
+	secret, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt MFA secret (was MFA_ENCRYPTION_KEY changed?): %w", err)
+	}
+	return secret, nil
+}
+
+// roleRequiresMFA reports whether admins require a second factor for a role
+func (s *Service) roleRequiresMFA(role string) (bool, error) {
+	var required bool
+	err := s.db.QueryRow(`SELECT require_mfa FROM roles WHERE name = $1`, role).Scan(&required)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("database error: %w", err)
+	}
+	return required, nil
+}
+
+// GetMFAStatus returns whether a user has MFA enabled and whether their role requires it
+func (s *Service) GetMFAStatus(userID int) (*MFAStatus, error) {
+	var status MFAStatus
+	var role string
+	err := s.db.QueryRow(`
+		SELECT u.mfa_enabled, u.role,
+		       (SELECT COUNT(*) FROM mfa_recovery_codes c WHERE c.user_id = u.id AND c.used_at IS NULL)
+		FROM users u WHERE u.id = $1
+	`, userID).Scan(&status.Enabled, &role, &status.RecoveryCodesRemaining)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if status.Required, err = s.roleRequiresMFA(role); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// createMFAChallenge stores the pending second step of a login
+func (s *Service) createMFAChallenge(userID int, purpose string) (*MFAChallengeResponse, error) {
+	token, err := newOpaqueToken(32)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(mfaChallengeTTL)
+	_, err = s.db.Exec(`
+		INSERT INTO mfa_challenges (token_hash, user_id, purpose, expires_at) VALUES ($1, $2, $3, $4)
+	`, hashToken(token), userID, purpose, expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store MFA challenge: %w", err)
+	}
+	return &MFAChallengeResponse{
+		MFARequired:        true,
+		EnrollmentRequired: purpose == mfaPurposeEnroll,
+		MFAToken:           token,
+		ExpiresAt:          expiresAt,
+	}, nil
+}
+
+// useMFAChallenge counts an attempt against a challenge and returns its user.
+// Challenges are dropped once expired or out of attempts.
+func (s *Service) useMFAChallenge(token, purpose string) (int, error) {
+	var userID, attempts int
+	err := s.db.QueryRow(`
+		UPDATE mfa_challenges SET attempts = attempts + 1
+		WHERE token_hash = $1 AND purpose = $2 AND expires_at > CURRENT_TIMESTAMP
+		RETURNING user_id, attempts
+	`, hashToken(token), purpose).Scan(&userID, &attempts)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidMFAToken
+	}
+	if err != nil {
+		return 0, fmt.Errorf("database error: %w", err)
+	}
+	if attempts > maxChallengeAttempts {
+		s.db.Exec(`DELETE FROM mfa_challenges WHERE token_hash = $1`, hashToken(token))
+		return 0, ErrInvalidMFAToken
+	}
+	return userID, nil
+}
+
+// consumeMFAChallenge deletes a challenge, failing if another request already used it
+func (s *Service) consumeMFAChallenge(token string) error {
+	result, err := s.db.Exec(`DELETE FROM mfa_challenges WHERE token_hash = $1`, hashToken(token))
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrInvalidMFAToken
+	}
+	return nil
+}
+
+// MFAChallengeUser returns the user an enrollment challenge belongs to
+func (s *Service) MFAChallengeUser(token string) (int, error) {
+	return s.useMFAChallenge(token, mfaPurposeEnroll)
+}
+
+// checkSecondFactor accepts a current TOTP code or an unused recovery code
+func (s *Service) checkSecondFactor(userID int, code string) (usedRecoveryCode bool, err error) {
+	var enabled bool
+	var stored sql.NullString
+	var lastStep int64
+	err = s.db.QueryRow(`
+		SELECT mfa_enabled, mfa_secret, mfa_last_step FROM users WHERE id = $1
+	`, userID).Scan(&enabled, &stored, &lastStep)
+	if err != nil {
+		return false, fmt.Errorf("database error: %w", err)
+	}
+	if !enabled || !stored.Valid {
+		return false, ErrMFANotEnabled
+	}
+
+	secret, err := s.decryptSecret(stored.String)
+	if err != nil {
+		return false, err
+	}
+	if step, ok := verifyTOTP(secret, code, time.Now(), lastStep); ok {
+		// The conditional update makes a code usable once even under concurrent requests
+		result, err := s.db.Exec(`UPDATE users SET mfa_last_step = $1 WHERE id = $2 AND mfa_last_step < $1`, step, userID)
+		if err != nil {
+			return false, fmt.Errorf("database error: %w", err)
+		}
+		if rows, _ := result.RowsAffected(); rows == 1 {
+			return false, nil
+		}
+		return false, ErrInvalidMFACode
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE mfa_recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, fmt.Errorf("database error: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 1 {
+		return true, nil
+	}
+	return false, ErrInvalidMFACode
+}
+
+// VerifyMFALogin completes a login that passed the password step
+func (s *Service) VerifyMFALogin(mfaToken, code string, client ClientInfo) (*LoginResponse, error) {
+	if err := s.checkAddressThrottle(client); err != nil {
+		return nil, err
+	}
+	userID, err := s.useMFAChallenge(mfaToken, mfaPurposeVerify)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, ErrInvalidMFAToken
+	}
+	if err := s.checkAccountLock(userID); err != nil {
+		return nil, err
+	}
+
+	usedRecoveryCode, err := s.checkSecondFactor(userID, code)
+	if err == ErrInvalidMFACode {
+		s.registerFailedLogin(userID, user.Email, EventMFAFailed, client, "bad_mfa_code")
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if usedRecoveryCode {
+		s.recordAuthEvent(userID, user.Email, EventRecoveryCodeUsed, client, nil)
+	}
+
+	if err := s.consumeMFAChallenge(mfaToken); err != nil {
+		return nil, err
+	}
+	return s.finishLogin(user, client, true, "password+mfa")
+}
+
+// BeginMFAEnrollment creates a TOTP secret that becomes active once a code is confirmed
+func (s *Service) BeginMFAEnrollment(userID int) (*MFASetupResponse, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	status, err := s.GetMFAStatus(userID)
+	if err != nil {
+		return nil, err
+	}
+	if status.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	encrypted, err := s.encryptSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.db.Exec(`UPDATE users SET mfa_pending_secret = $1 WHERE id = $2`, encrypted, userID); err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return &MFASetupResponse{
+		Secret:     base32NoPadding.EncodeToString(secret),
+		OTPAuthURL: otpauthURL(user.Email, secret),
+	}, nil
+}
+
+// ConfirmMFAEnrollment enables MFA once the user proves their app produces valid codes,
+// and returns fresh recovery codes
+func (s *Service) ConfirmMFAEnrollment(userID int, code string, client ClientInfo) ([]string, error) {
+	var pending sql.NullString
+	var email string
+	err := s.db.QueryRow(`SELECT mfa_pending_secret, email FROM users WHERE id = $1`, userID).Scan(&pending, &email)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if !pending.Valid {
+		return nil, ErrMFANotPending
+	}
+
+	secret, err := s.decryptSecret(pending.String)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := verifyTOTP(secret, code, time.Now(), 0)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE users SET mfa_secret = mfa_pending_secret, mfa_pending_secret = NULL, mfa_enabled = true, mfa_last_step = $1
+		WHERE id = $2
+	`, step, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable MFA: %w", err)
+	}
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	s.recordAuthEvent(userID, email, EventMFAEnabled, client, nil)
+	return codes, nil
+}
+
+// CompleteMFAEnrollment confirms enrollment for a login whose role requires MFA and
+// starts the session
+func (s *Service) CompleteMFAEnrollment(mfaToken, code string, client ClientInfo) (*MFAEnableResponse, error) {
+	userID, err := s.useMFAChallenge(mfaToken, mfaPurposeEnroll)
+	if err != nil {
+		return nil, err
+	}
+	codes, err := s.ConfirmMFAEnrollment(userID, code, client)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.consumeMFAChallenge(mfaToken); err != nil {
+		return nil, err
+	}
+
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	login, err := s.finishLogin(user, client, true, "password+mfa_enrollment")
+	if err != nil {
+		return nil, err
+	}
+	return &MFAEnableResponse{RecoveryCodes: codes, Login: login}, nil
+}
+
+// DisableMFA turns off MFA after checking a current code. Users whose role requires MFA
+// cannot turn it off.
+func (s *Service) DisableMFA(userID int, code string, client ClientInfo) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	required, err := s.roleRequiresMFA(user.Role)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrMFARequiredByRole
+	}
+	if _, err := s.checkSecondFactor(userID, code); err != nil {
+		if err == ErrInvalidMFACode {
+			s.registerFailedLogin(userID, user.Email, EventMFAFailed, client, "bad_mfa_code")
+		}
+		return err
+	}
+	if err := s.clearMFA(userID); err != nil {
+		return err
+	}
+	s.recordAuthEvent(userID, user.Email, EventMFADisabled, client, nil)
+	return nil
+}
+
+// ResetMFA removes a user's second factor so they can enroll again (admin only)
+func (s *Service) ResetMFA(userID, adminID int, client ClientInfo) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := s.clearMFA(userID); err != nil {
+		return err
+	}
+	s.recordAuthEvent(userID, user.Email, EventMFADisabled, client, map[string]interface{}{"resetBy": adminID})
+	return nil
+}
+
+func (s *Service) clearMFA(userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE users SET mfa_enabled = false, mfa_secret = NULL, mfa_pending_secret = NULL, mfa_last_step = 0
+		WHERE id = $1
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to disable MFA: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	return tx.Commit()
+}
+
+// RegenerateRecoveryCodes replaces a user's recovery codes after checking a current code
+func (s *Service) RegenerateRecoveryCodes(userID int, code string, client ClientInfo) ([]string, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.checkSecondFactor(userID, code); err != nil {
+		if err == ErrInvalidMFACode {
+			s.registerFailedLogin(userID, user.Email, EventMFAFailed, client, "bad_mfa_code")
+		}
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	defer tx.Rollback()
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	s.recordAuthEvent(userID, user.Email, EventRecoveryCodesRenewed, client, nil)
+	return codes, nil
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int) ([]string, error) {
+	codes, err := generateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	for _, code := range codes {
+		if _, err := tx.Exec(`INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hashToken(code)); err != nil {
+			return nil, fmt.Errorf("failed to store recovery code: %w", err)
+		}
+	}
+	return codes, nil
+}
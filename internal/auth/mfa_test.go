@@ -0,0 +1,117 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package auth
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B vectors for SHA-1, truncated to six digits
+	secret := []byte("12345678901234567890")
+	tests := []struct {
+		unix     int64
+		expected string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			if got := totpCode(secret, tt.unix/totpPeriod); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1234567890, 0)
+	step := now.Unix() / totpPeriod
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		ok       bool
+	}{
+		{"current code", totpCode(secret, step), 0, true},
+		{"code with spaces", "005 924", 0, true},
+		{"previous step within skew", totpCode(secret, step-1), 0, true},
+		{"code outside skew", totpCode(secret, step-2), 0, false},
+		{"replayed code", totpCode(secret, step), step, false},
+		{"wrong length", "12345", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := verifyTOTP(secret, tt.code, now, tt.lastStep); ok != tt.ok {
+				t.Errorf("expected %v, got %v", tt.ok, ok)
+			}
+		})
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := generateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	format := regexp.MustCompile(`^[a-z2-9]{5}-[a-z2-9]{5}$`)
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if !format.MatchString(code) {
+			t.Errorf("unexpected code format %q", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate code %q", code)
+		}
+		seen[code] = true
+
+		typed := strings.ToUpper(strings.ReplaceAll(code, "-", ""))
+		if got := normalizeRecoveryCode(typed); got != code {
+			t.Errorf("normalize(%q): expected %q, got %q", typed, code, got)
+		}
+	}
+}
+
+func TestMFASecretEncryption(t *testing.T) {
+	s := NewService(nil, "secret")
+	secret := []byte("12345678901234567890")
+
+	stored, err := s.encryptSecret(secret)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	decrypted, err := s.decryptSecret(stored)
+	if err != nil || string(decrypted) != string(secret) {
+		t.Fatalf("round trip failed: %q, %v", decrypted, err)
+	}
+
+	s.SetMFAEncryptionKey("another key")
+	if _, err := s.decryptSecret(stored); err == nil {
+		t.Error("expected decryption with a different key to fail")
+	}
+}
+
+func TestOTPAuthURL(t *testing.T) {
+	url := otpauthURL("ada@example.com", []byte("12345678901234567890"))
+	expected := "otpauth://totp/UbeCode:ada@example.com?digits=6&issuer=UbeCode&period=30&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	if url != expected {
+		t.Errorf("expected %q, got %q", expected, url)
+	}
+}
@@ -31,10 +31,82 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
-// LoginResponse represents a login response with JWT token
+// LoginResponse represents a login response with a short-lived access token and the
+// refresh token used to obtain the next one
 type LoginResponse struct {
+	Token        string    `json:"token"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+	RefreshToken string    `json:"refreshToken"`
+	SessionID    string    `json:"sessionId"`
+	User         User      `json:"user"`
+}
+
+// RefreshRequest exchanges a refresh token for a new token pair
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// Session represents a login session as shown to its owner or an admin
+type Session struct {
+	SessionID  string     `json:"sessionId"`
+	UserID     int        `json:"userId"`
+	UserAgent  string     `json:"userAgent"`
+	Device     string     `json:"device"`
+	IPAddress  string     `json:"ipAddress"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt time.Time  `json:"lastUsedAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	Current    bool       `json:"current"`
+}
+
+// ClientInfo identifies the device a session was started from
+type ClientInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+// APIToken represents a personal access token; the token itself is only returned at creation
+type APIToken struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"userId"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	CreatedBy  *int       `json:"createdBy,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// CreateAPITokenRequest represents a request to mint a personal access token
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expiresInDays,omitempty"`
+}
+
+// CreateAPITokenResponse carries the new token, which cannot be retrieved again
+type CreateAPITokenResponse struct {
+	APIToken
 	Token string `json:"token"`
-	User  User   `json:"user"`
+}
+
+// ServiceAccount represents a non-human user for automation such as CI pipelines
+type ServiceAccount struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	IsActive  bool      `json:"isActive"`
+	CreatedBy *int      `json:"createdBy,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// CreateServiceAccountRequest represents a request to create a service account
+type CreateServiceAccountRequest struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
 }
 
 // CreateUserRequest represents a request to create a new user
@@ -56,8 +128,9 @@ type UpdateUserRequest struct {
 
 // VerifyTokenResponse represents the response from token verification
 type VerifyTokenResponse struct {
-	Valid bool `json:"valid"`
-	User  User `json:"user,omitempty"`
+	Valid  bool     `json:"valid"`
+	User   User     `json:"user,omitempty"`
+	Scopes []string `json:"scopes,omitempty"` // Set for personal access tokens
 }
 
 // ErrorResponse represents an error response
@@ -10,22 +10,19 @@ package auth
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"time"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 )
 
-// OAuthConfig holds OAuth configuration
+// OAuthConfig holds OAuth configuration. Login state is kept in the database (see
+// CreateSSOState) so any auth-service replica can complete a login.
 type OAuthConfig struct {
 	GoogleConfig *oauth2.Config
-	StateStore   map[string]time.Time // In production, use Redis or similar
 }
 
 // GoogleUserInfo represents the user info from Google
@@ -39,6 +36,14 @@ type GoogleUserInfo struct {
 	Picture       string `json:"picture"`
 }
 
+// GoogleProviderConfig governs sign-in and provisioning for Google accounts
+var GoogleProviderConfig = SSOProviderConfig{
+	ID:            "google",
+	Name:          "Google",
+	DefaultRole:   "user",
+	AutoProvision: true,
+}
+
 // NewOAuthConfig creates a new OAuth configuration
 func NewOAuthConfig(clientID, clientSecret, redirectURL string) *OAuthConfig {
 	return &OAuthConfig{
@@ -52,63 +57,24 @@ func NewOAuthConfig(clientID, clientSecret, redirectURL string) *OAuthConfig {
 			},
 			Endpoint: google.Endpoint,
 		},
-		StateStore: make(map[string]time.Time),
-	}
-}
-
-// GenerateStateToken generates a random state token for OAuth
-func (oc *OAuthConfig) GenerateStateToken() (string, error) {
-	b := make([]byte, 32)
-	if _, err := rand.Read(b); err != nil {
-		return "", err
-	}
-	state := base64.URLEncoding.EncodeToString(b)
-
-	// Store state with expiration (5 minutes)
-	oc.StateStore[state] = time.Now().Add(5 * time.Minute)
-
-	// Clean up expired states
-	go oc.cleanupExpiredStates()
-
-	return state, nil
-}
-
-// ValidateState validates the OAuth state token
-func (oc *OAuthConfig) ValidateState(state string) bool {
-	expiration, exists := oc.StateStore[state]
-	if !exists {
-		return false
 	}
-
-	if time.Now().After(expiration) {
-		delete(oc.StateStore, state)
-		return false
-	}
-
-	delete(oc.StateStore, state)
-	return true
 }
 
-// cleanupExpiredStates removes expired state tokens
-func (oc *OAuthConfig) cleanupExpiredStates() {
-	now := time.Now()
-	for state, expiration := range oc.StateStore {
-		if now.After(expiration) {
-			delete(oc.StateStore, state)
-		}
-	}
+// AuthCodeURL returns the Google login URL for a stored login state
+func (oc *OAuthConfig) AuthCodeURL(st *SSOState) string {
+	return oc.GoogleConfig.AuthCodeURL(st.State, oauth2.S256ChallengeOption(st.CodeVerifier))
 }
 
 // GetGoogleUserInfo retrieves user information from Google
-func (oc *OAuthConfig) GetGoogleUserInfo(ctx context.Context, code string) (*GoogleUserInfo, error) {
+func (oc *OAuthConfig) GetGoogleUserInfo(ctx context.Context, code, verifier string) (*GoogleUserInfo, error) {
 	// Exchange code for token
-	token, err := oc.GoogleConfig.Exchange(ctx, code)
+	token, err := oc.GoogleConfig.Exchange(ctx, code, oauth2.VerifierOption(verifier))
 	if err != nil {
 		return nil, fmt.Errorf("code exchange failed: %w", err)
 	}
 
 	// Get user info from Google
-	response, err := http.Get("https://www.googleapis.com/oauth2/v2/userinfo?access_token=" + token.AccessToken)
+	response, err := oc.GoogleConfig.Client(ctx, token).Get("https://www.googleapis.com/oauth2/v2/userinfo")
 	if err != nil {
 		return nil, fmt.Errorf("failed getting user info: %w", err)
 	}
@@ -126,3 +92,14 @@ func (oc *OAuthConfig) GetGoogleUserInfo(ctx context.Context, code string) (*Goo
 
 	return &userInfo, nil
 }
+
+// Identity converts Google user info to an SSO identity
+func (u *GoogleUserInfo) Identity() *SSOIdentity {
+	return &SSOIdentity{
+		Provider:      "google",
+		Subject:       u.ID,
+		Email:         u.Email,
+		EmailVerified: u.VerifiedEmail,
+		Name:          u.Name,
+	}
+}
@@ -0,0 +1,213 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIssuer is a minimal OpenID Connect issuer whose token endpoint returns idClaims
+type mockIssuer struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	issuer   string // Reported in discovery; defaults to the server URL
+	idClaims jwt.MapClaims
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	m := &mockIssuer{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer := m.issuer
+		if issuer == "" {
+			issuer = m.server.URL
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("GET /keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "good-code" || r.FormValue("code_verifier") == "" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, m.idClaims)
+		token.Header["kid"] = "test-key"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   300,
+			"id_token":     signed,
+		})
+	})
+
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockIssuer) claims(nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            m.server.URL,
+		"aud":            "ubecode",
+		"sub":            "00u123",
+		"email":          "ada@example.com",
+		"email_verified": true,
+		"name":           "Ada Lovelace",
+		"groups":         []string{"Everyone", "UbeCode Engineers"},
+		"nonce":          nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	}
+}
+
+func TestOIDCProviderExchange(t *testing.T) {
+	m := newMockIssuer(t)
+	provider, err := NewOIDCProvider(context.Background(), SSOProviderConfig{
+		ID:       "okta",
+		Issuer:   m.server.URL,
+		ClientID: "ubecode",
+	})
+	if err != nil {
+		t.Fatalf("discovery failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		mutate  func(jwt.MapClaims)
+		nonce   string
+		wantErr bool
+	}{
+		{"valid token", func(jwt.MapClaims) {}, "n-1", false},
+		{"wrong nonce", func(c jwt.MapClaims) { c["nonce"] = "other" }, "n-1", true},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "someone-else" }, "n-1", true},
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, "n-1", true},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, "n-1", true},
+		{"issued to another client", func(c jwt.MapClaims) { c["azp"] = "someone-else" }, "n-1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m.idClaims = m.claims("n-1")
+			tt.mutate(m.idClaims)
+
+			id, err := provider.Exchange(context.Background(), "good-code", "verifier", tt.nonce)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidIDToken) {
+					t.Fatalf("expected ErrInvalidIDToken, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if id.Provider != "okta" || id.Subject != "00u123" || id.Email != "ada@example.com" || !id.EmailVerified {
+				t.Errorf("unexpected identity: %+v", id)
+			}
+			if len(id.Groups) != 2 || id.Groups[1] != "UbeCode Engineers" {
+				t.Errorf("unexpected groups: %v", id.Groups)
+			}
+		})
+	}
+}
+
+func TestNewOIDCProviderIssuerMismatch(t *testing.T) {
+	m := newMockIssuer(t)
+	m.issuer = "https://other-tenant.example.com"
+
+	_, err := NewOIDCProvider(context.Background(), SSOProviderConfig{
+		ID:       "okta",
+		Issuer:   m.server.URL,
+		ClientID: "ubecode",
+	})
+	if err == nil {
+		t.Fatal("expected an error for a mismatched issuer")
+	}
+}
+
+func TestSSOProviderConfigMapping(t *testing.T) {
+	cfg := &SSOProviderConfig{
+		RoleMappings: []RoleMapping{
+			{Group: "ubecode-admins", Role: "admin"},
+			{Group: "ubecode engineers", Role: "engineer"},
+		},
+		DefaultRole:    "user",
+		AllowedDomains: []string{"example.com"},
+	}
+	strict := &SSOProviderConfig{RoleMappings: cfg.RoleMappings}
+
+	tests := []struct {
+		name     string
+		got      string
+		expected string
+	}{
+		{"first matching mapping wins", cfg.MapRole([]string{"UbeCode Engineers", "ubecode-admins"}), "admin"},
+		{"group names ignore case", cfg.MapRole([]string{"UbeCode Engineers"}), "engineer"},
+		{"default role", cfg.MapRole([]string{"Everyone"}), "user"},
+		{"no default denies", strict.MapRole(nil), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, tt.got)
+			}
+		})
+	}
+
+	emails := map[string]bool{
+		"ada@example.com": true,
+		"ada@EXAMPLE.COM": true,
+		"ada@evil.com":    false,
+		"not-an-email":    false,
+	}
+	for email, expected := range emails {
+		if got := cfg.AllowsEmail(email); got != expected {
+			t.Errorf("AllowsEmail(%q): expected %v, got %v", email, expected, got)
+		}
+	}
+}
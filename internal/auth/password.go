@@ -0,0 +1,281 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/jareynolds/ubecode/pkg/notification"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultPasswordResetTTL is how long an emailed reset link stays valid
+const DefaultPasswordResetTTL = time.Hour
+
+// maxPasswordLength is where bcrypt stops reading input
+const maxPasswordLength = 72
+
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+// commonPasswords are rejected regardless of the policy's character rules
+var commonPasswords = map[string]bool{
+	"password": true, "password1": true, "password123": true, "passw0rd": true,
+	"123456789": true, "1234567890": true, "qwerty123": true, "qwertyuiop": true,
+	"iloveyou": true, "admin123": true, "letmein123": true, "welcome123": true,
+	"changeme": true, "changeme123": true, "ubecode123": true,
+}
+
+// PasswordPolicy describes the passwords users may choose
+type PasswordPolicy struct {
+	MinLength     int  `json:"minLength"`
+	RequireUpper  bool `json:"requireUpper"`
+	RequireLower  bool `json:"requireLower"`
+	RequireDigit  bool `json:"requireDigit"`
+	RequireSymbol bool `json:"requireSymbol"`
+}
+
+// DefaultPasswordPolicy is used when no PASSWORD_* variables are set
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:    10,
+	RequireUpper: true,
+	RequireLower: true,
+	RequireDigit: true,
+}
+
+// PasswordPolicyFromEnv reads the policy from PASSWORD_MIN_LENGTH and PASSWORD_REQUIRE_*
+func PasswordPolicyFromEnv() PasswordPolicy {
+	p := DefaultPasswordPolicy
+	if n, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH")); err == nil && n > 0 {
+		p.MinLength = n
+	}
+	boolEnv := func(key string, target *bool) {
+		if v, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+			*target = v
+		}
+	}
+	boolEnv("PASSWORD_REQUIRE_UPPER", &p.RequireUpper)
+	boolEnv("PASSWORD_REQUIRE_LOWER", &p.RequireLower)
+	boolEnv("PASSWORD_REQUIRE_DIGIT", &p.RequireDigit)
+	boolEnv("PASSWORD_REQUIRE_SYMBOL", &p.RequireSymbol)
+	return p
+}
+
+// PasswordPolicyError lists every rule a password breaks
+type PasswordPolicyError struct {
+	Problems []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password " + strings.Join(e.Problems, ", ")
+}
+
+// Validate checks a password against the policy; email is used to reject passwords
+// built from the user's own address
+func (p PasswordPolicy) Validate(password, email string) error {
+	var problems []string
+	if len(password) < p.MinLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters", p.MinLength))
+	}
+	if len(password) > maxPasswordLength {
+		problems = append(problems, fmt.Sprintf("must be at most %d bytes", maxPasswordLength))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsDigit(c):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		problems = append(problems, "must contain an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		problems = append(problems, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		problems = append(problems, "must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		problems = append(problems, "must contain a symbol")
+	}
+
+	lowered := strings.ToLower(password)
+	if commonPasswords[lowered] {
+		problems = append(problems, "is too common")
+	}
+	if local, _, ok := strings.Cut(strings.ToLower(email), "@"); ok && len(local) >= 4 && strings.Contains(lowered, local) {
+		problems = append(problems, "must not contain your email address")
+	}
+
+	if len(problems) > 0 {
+		return &PasswordPolicyError{Problems: problems}
+	}
+	return nil
+}
+
+// SetPasswordPolicy replaces the policy enforced when passwords are set
+func (s *Service) SetPasswordPolicy(policy PasswordPolicy) {
+	s.passwordPolicy = policy
+}
+
+// PasswordPolicy returns the policy enforced when passwords are set
+func (s *Service) PasswordPolicy() PasswordPolicy {
+	return s.passwordPolicy
+}
+
+// Mailer delivers account emails such as password reset links
+type Mailer interface {
+	Send(ctx context.Context, to models.NotificationRecipient, msg notification.Message) error
+}
+
+// SetMailer enables password reset emails; appBaseURL prefixes the reset link
+func (s *Service) SetMailer(mailer Mailer, appBaseURL string) {
+	s.mailer = mailer
+	s.appBaseURL = strings.TrimSuffix(appBaseURL, "/")
+}
+
+// MailerConfigured reports whether password reset emails can be sent
+func (s *Service) MailerConfigured() bool {
+	return s.mailer != nil
+}
+
+// RequestPasswordReset emails a single-use reset link to an active user. Unknown
+// addresses are not reported, so the endpoint cannot be used to discover accounts.
+func (s *Service) RequestPasswordReset(ctx context.Context, email string, client ClientInfo) error {
+	if s.mailer == nil {
+		return fmt.Errorf("password reset email is not configured")
+	}
+
+	user, err := s.GetUserByEmail(email)
+	if err == ErrUserNotFound {
+		s.recordAuthEvent(0, email, EventPasswordResetRequested, client, map[string]interface{}{"known": false})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !user.IsActive {
+		s.recordAuthEvent(user.ID, email, EventPasswordResetRequested, client, map[string]interface{}{"inactive": true})
+		return nil
+	}
+
+	token, err := newOpaqueToken(32)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Only the newest link works
+	if _, err := tx.Exec(`DELETE FROM password_reset_tokens WHERE user_id = $1 AND used_at IS NULL`, user.ID); err != nil {
+		return fmt.Errorf("failed to clear reset tokens: %w", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO password_reset_tokens (token_hash, user_id, expires_at, requested_ip)
+		VALUES ($1, $2, $3, $4)
+	`, hashToken(token), user.ID, time.Now().Add(s.resetTTL), client.IPAddress)
+	if err != nil {
+		return fmt.Errorf("failed to store reset token: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	link := s.appBaseURL + "/reset-password?token=" + token
+	msg := notification.Message{
+		Subject: "Reset your UbeCode password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your UbeCode account. "+
+			"Use the link below within %d minutes to choose a new password:\n\n%s\n\n"+
+			"If you did not ask for this, you can ignore this email; your password has not changed.",
+			user.Name, int(s.resetTTL.Minutes()), link),
+	}
+	if err := s.mailer.Send(ctx, models.NotificationRecipient{UserID: user.ID, Email: user.Email, Name: user.Name}, msg); err != nil {
+		return err
+	}
+
+	s.recordAuthEvent(user.ID, email, EventPasswordResetRequested, client, nil)
+	return nil
+}
+
+// ResetPassword sets a new password using an emailed token. The account is unlocked and
+// all sessions are revoked, since a reset usually means the old password is compromised.
+func (s *Service) ResetPassword(token, password string, client ClientInfo) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	defer tx.Rollback()
+
+	var userID int
+	var email string
+	var expiresAt time.Time
+	err = tx.QueryRow(`
+		UPDATE password_reset_tokens t SET used_at = CURRENT_TIMESTAMP
+		FROM users u
+		WHERE t.token_hash = $1 AND t.used_at IS NULL AND u.id = t.user_id AND u.is_active = true
+		RETURNING t.user_id, u.email, t.expires_at
+	`, hashToken(token)).Scan(&userID, &email, &expiresAt)
+	if err == sql.ErrNoRows {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if time.Now().After(expiresAt) {
+		return ErrInvalidResetToken
+	}
+
+	if err := s.passwordPolicy.Validate(password, email); err != nil {
+		return err
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE users
+		SET password_hash = $1, password_changed_at = CURRENT_TIMESTAMP, failed_login_count = 0,
+		    locked_until = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2
+	`, hashed, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	if _, err := s.RevokeAllSessions(userID, "password_reset"); err != nil {
+		log.Printf("Failed to revoke sessions after password reset: %v", err)
+	}
+	s.recordAuthEvent(userID, email, EventPasswordReset, client, nil)
+	return nil
+}
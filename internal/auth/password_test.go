@@ -0,0 +1,78 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	strict := DefaultPasswordPolicy
+	strict.RequireSymbol = true
+
+	tests := []struct {
+		name     string
+		policy   PasswordPolicy
+		password string
+		problems int
+	}{
+		{"valid", DefaultPasswordPolicy, "Correct9Horse", 0},
+		{"too short", DefaultPasswordPolicy, "Ab1", 1},
+		{"missing classes", DefaultPasswordPolicy, "alllowercase", 2},
+		{"missing symbol", strict, "Correct9Horse", 1},
+		{"symbol present", strict, "Correct9Horse!", 0},
+		{"common password", PasswordPolicy{MinLength: 6}, "Password123", 1},
+		{"contains email", DefaultPasswordPolicy, "Ada.lovelace99X", 1},
+		{"too long", PasswordPolicy{}, string(make([]byte, 73)), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate(tt.password, "ada.lovelace@example.com")
+			if tt.problems == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			var policyErr *PasswordPolicyError
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("expected PasswordPolicyError, got %v", err)
+			}
+			if len(policyErr.Problems) != tt.problems {
+				t.Errorf("expected %d problems, got %v", tt.problems, policyErr.Problems)
+			}
+		})
+	}
+}
+
+func TestLockDuration(t *testing.T) {
+	policy := LockoutPolicy{Threshold: 5, BaseDelay: time.Minute, MaxDelay: 10 * time.Minute}
+
+	tests := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{0, 0},
+		{4, 0},
+		{5, time.Minute},
+		{6, 2 * time.Minute},
+		{8, 8 * time.Minute},
+		{9, 10 * time.Minute},
+		{100, 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := policy.LockDuration(tt.failures); got != tt.expected {
+			t.Errorf("LockDuration(%d): expected %v, got %v", tt.failures, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package auth
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+// PermissionForRequest returns the role permission needed to call an endpoint of the
+// capability or integration service. It matches the token scope except for workflow
+// settings, which need approvals:manage, and AI budgets, prompt versions and clearing the
+// AI cache, which need workspaces:admin.
+func PermissionForRequest(method, path string) string {
+	path = "/" + strings.Trim(path, "/")
+	readOnly := method == http.MethodGet || method == http.MethodHead
+
+	switch {
+	case strings.HasPrefix(path, "/stage-gates") && !readOnly,
+		strings.HasPrefix(path, "/approvals/sla-rules") && !readOnly,
+		path == "/approvals/sla-check",
+		path == "/notifications/digest" && !readOnly:
+		return models.PermApprovalsManage
+	case strings.HasPrefix(path, "/ai-budgets") && !readOnly,
+		path == "/ai-cache" && !readOnly,
+		strings.HasPrefix(path, "/prompts") && !readOnly:
+		return models.PermWorkspacesAdmin
+	}
+
+	return ScopeForRequest(method, path)
+}
@@ -0,0 +1,233 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/jareynolds/ubecode/pkg/repository"
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,49}$`)
+
+// GetAccess returns the caller's effective permissions. Services check a token's scopes on
+// top of these.
+func (h *Handler) GetAccess(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	grant, err := h.rbac.GetAccessGrant(claims.UserID)
+	if err != nil {
+		log.Printf("Get access grant error: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, grant)
+}
+
+// ListPermissions returns the permissions a role can hold
+func (h *Handler) ListPermissions(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, models.AllPermissions)
+}
+
+// ListRoles returns all roles (admin only)
+func (h *Handler) ListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.rbac.ListRoles()
+	if err != nil {
+		log.Printf("List roles error: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, roles)
+}
+
+// CreateRole creates a custom role (admin only)
+func (h *Handler) CreateRole(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeRoleRequest(w, r, true)
+	if !ok {
+		return
+	}
+
+	if _, err := h.rbac.GetRoleByName(req.Name); err == nil {
+		respondError(w, http.StatusConflict, "A role with this name already exists")
+		return
+	}
+
+	role, err := h.rbac.CreateRole(*req)
+	if err != nil {
+		log.Printf("Create role error: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, role)
+}
+
+// UpdateRole replaces a role's description and permissions (admin only)
+func (h *Handler) UpdateRole(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid role ID")
+		return
+	}
+
+	req, ok := decodeRoleRequest(w, r, false)
+	if !ok {
+		return
+	}
+
+	role, err := h.rbac.UpdateRole(id, *req)
+	if err != nil {
+		respondRBACError(w, "Update role", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, role)
+}
+
+// DeleteRole deletes an unused custom role (admin only)
+func (h *Handler) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid role ID")
+		return
+	}
+
+	if err := h.rbac.DeleteRole(id); err != nil {
+		respondRBACError(w, "Delete role", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Role deleted successfully"})
+}
+
+// ListWorkspaceMembers returns a workspace's members (admin only)
+func (h *Handler) ListWorkspaceMembers(w http.ResponseWriter, r *http.Request) {
+	workspaceID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid workspace ID")
+		return
+	}
+
+	members, err := h.rbac.ListMembers(workspaceID)
+	if err != nil {
+		respondRBACError(w, "List workspace members", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, members)
+}
+
+// SetWorkspaceMember adds a user to a workspace or changes their role there (admin only)
+func (h *Handler) SetWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	workspaceID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid workspace ID")
+		return
+	}
+
+	var req models.WorkspaceMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.UserID == 0 || req.Role == "" {
+		respondError(w, http.StatusBadRequest, "user_id and role are required")
+		return
+	}
+
+	if _, err := h.service.GetUserByID(req.UserID); err == ErrUserNotFound {
+		respondError(w, http.StatusNotFound, "User not found")
+		return
+	} else if err != nil {
+		log.Printf("Get user error: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	member, err := h.rbac.SetMember(workspaceID, req, claims.UserID)
+	if err != nil {
+		respondRBACError(w, "Set workspace member", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, member)
+}
+
+// RemoveWorkspaceMember removes a user from a workspace (admin only)
+func (h *Handler) RemoveWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	workspaceID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid workspace ID")
+		return
+	}
+	userID, err := strconv.Atoi(r.PathValue("userId"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if err := h.rbac.RemoveMember(workspaceID, userID); err != nil {
+		respondRBACError(w, "Remove workspace member", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Member removed successfully"})
+}
+
+// decodeRoleRequest reads and validates a role body. The name is optional on update.
+func decodeRoleRequest(w http.ResponseWriter, r *http.Request, requireName bool) (*models.RoleRequest, bool) {
+	var req models.RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return nil, false
+	}
+
+	if req.Name == "" && requireName {
+		respondError(w, http.StatusBadRequest, "Name is required")
+		return nil, false
+	}
+	if req.Name != "" && !roleNamePattern.MatchString(req.Name) {
+		respondError(w, http.StatusBadRequest, "Name must be lowercase letters, digits and underscores")
+		return nil, false
+	}
+	for _, p := range req.Permissions {
+		if !models.IsKnownPermission(p) {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("unknown permission %q", p))
+			return nil, false
+		}
+	}
+	if req.Permissions == nil {
+		req.Permissions = []string{}
+	}
+
+	return &req, true
+}
+
+// respondRBACError maps repository errors to responses
+func respondRBACError(w http.ResponseWriter, action string, err error) {
+	switch err {
+	case repository.ErrRoleNotFound, repository.ErrWorkspaceNotFound, repository.ErrMemberNotFound:
+		respondError(w, http.StatusNotFound, err.Error())
+	case repository.ErrSystemRole, repository.ErrRoleInUse:
+		respondError(w, http.StatusConflict, err.Error())
+	default:
+		log.Printf("%s error: %v", action, err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
@@ -0,0 +1,87 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package auth
+
+import (
+	"testing"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+func TestPermissionForRequest(t *testing.T) {
+	tests := []struct {
+		method   string
+		path     string
+		expected string
+	}{
+		{"GET", "/stage-gates", models.PermApprovalsRead},
+		{"PUT", "/stage-gates/3", models.PermApprovalsManage},
+		{"GET", "/approvals/sla-rules", models.PermApprovalsRead},
+		{"PUT", "/approvals/sla-rules/design", models.PermApprovalsManage},
+		{"POST", "/approvals/sla-check", models.PermApprovalsManage},
+		{"POST", "/notifications/digest", models.PermApprovalsManage},
+		{"POST", "/notifications/events", models.PermNotificationsPublish},
+		{"PUT", "/notifications/preferences", models.PermNotificationsWrite},
+		{"POST", "/approvals/7/approve", models.PermApprovalsWrite},
+		{"POST", "/capabilities", models.PermCapabilitiesWrite},
+		{"POST", "/save-capability", models.PermSpecificationsWrite},
+		{"GET", "/ai-budgets", models.PermAIGenerate},
+		{"PUT", "/ai-budgets", models.PermWorkspacesAdmin},
+		{"DELETE", "/ai-budgets/2", models.PermWorkspacesAdmin},
+		{"DELETE", "/ai-cache", models.PermWorkspacesAdmin},
+		{"POST", "/ai-audit/4/review", models.PermApprovalsWrite},
+		{"GET", "/prompts", models.PermSpecificationsRead},
+		{"POST", "/prompts/chat-system/versions", models.PermWorkspacesAdmin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			if got := PermissionForRequest(tt.method, tt.path); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestAccessGrant(t *testing.T) {
+	acme, internal, other := 1, 2, 3
+	grant := &models.AccessGrant{
+		Permissions: []string{models.PermCapabilitiesRead},
+		Workspaces: []models.WorkspaceAccess{
+			{WorkspaceID: acme, Folder: "acme", Permissions: []string{models.PermCapabilitiesRead, models.PermCapabilitiesWrite}},
+			{WorkspaceID: internal, Folder: "internal", Permissions: []string{}},
+		},
+		KnownFolders: []string{"acme", "internal", "secret"},
+	}
+
+	tests := []struct {
+		name     string
+		got      bool
+		expected bool
+	}{
+		{"global permission", grant.Can(models.PermCapabilitiesRead), true},
+		{"workspace-only permission globally", grant.Can(models.PermCapabilitiesWrite), false},
+		{"workspace-only permission anywhere", grant.CanAnywhere(models.PermCapabilitiesWrite), true},
+		{"record outside workspaces", grant.CanInWorkspace(models.PermCapabilitiesRead, nil), true},
+		{"member workspace", grant.CanInWorkspace(models.PermCapabilitiesWrite, &acme), true},
+		{"workspace without the permission", grant.CanInWorkspace(models.PermCapabilitiesRead, &internal), false},
+		{"workspace not granted", grant.CanInWorkspace(models.PermCapabilitiesRead, &other), false},
+		{"member folder", grant.CanInFolder(models.PermCapabilitiesWrite, "acme"), true},
+		{"registered folder not granted", grant.CanInFolder(models.PermCapabilitiesRead, "secret"), false},
+		{"unregistered folder uses global role", grant.CanInFolder(models.PermCapabilitiesRead, "scratch"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, tt.got)
+			}
+		})
+	}
+}
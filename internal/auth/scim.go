@@ -0,0 +1,696 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/jareynolds/ubecode/pkg/repository"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrGroupNotFound = errors.New("group not found")
+
+// SCIMRoleMapping maps an identity provider group to a global role, or to a role inside one
+// workspace when Workspace (the workspace folder name) is set
+type SCIMRoleMapping struct {
+	Group     string `json:"group"`
+	Role      string `json:"role"`
+	Workspace string `json:"workspace,omitempty"`
+}
+
+// SCIMConfig controls how provisioned users and groups map onto roles
+type SCIMConfig struct {
+	// DefaultRole is given to new users and to users in no mapped group
+	DefaultRole string
+	// RoleMappings are tried in order; the first matching group decides the global role and
+	// the role in each workspace. Without mappings, groups do not change anyone's access.
+	RoleMappings []SCIMRoleMapping
+}
+
+// SCIMConfigFromEnv reads SCIM_DEFAULT_ROLE and SCIM_ROLE_MAPPINGS, a list such as
+// "UbeCode Admins=admin,Project X=workspace_editor@project-x"
+func SCIMConfigFromEnv() SCIMConfig {
+	cfg := SCIMConfig{DefaultRole: envOr("SCIM_DEFAULT_ROLE", "user")}
+	for _, pair := range strings.Split(os.Getenv("SCIM_ROLE_MAPPINGS"), ",") {
+		group, target, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		role, workspace, _ := strings.Cut(target, "@")
+		cfg.RoleMappings = append(cfg.RoleMappings, SCIMRoleMapping{
+			Group:     strings.TrimSpace(group),
+			Role:      strings.TrimSpace(role),
+			Workspace: strings.TrimSpace(workspace),
+		})
+	}
+	return cfg
+}
+
+// mappedAccess returns the global role and workspace roles for members of groups
+func (c SCIMConfig) mappedAccess(groups []string) (string, map[string]string) {
+	role := ""
+	workspaces := map[string]string{}
+	for _, m := range c.RoleMappings {
+		for _, g := range groups {
+			if !strings.EqualFold(g, m.Group) {
+				continue
+			}
+			if m.Workspace == "" && role == "" {
+				role = m.Role
+			} else if _, ok := workspaces[m.Workspace]; m.Workspace != "" && !ok {
+				workspaces[m.Workspace] = m.Role
+			}
+		}
+	}
+	if role == "" {
+		role = c.DefaultRole
+	}
+	return role, workspaces
+}
+
+// SetSCIMConfig replaces the provisioning configuration
+func (s *Service) SetSCIMConfig(cfg SCIMConfig) {
+	if cfg.DefaultRole == "" {
+		cfg.DefaultRole = "user"
+	}
+	s.scim = cfg
+}
+
+// SCIMConfig returns the provisioning configuration
+func (s *Service) SCIMConfig() SCIMConfig {
+	return s.scim
+}
+
+// SetApprovalRepository lets deprovisioning reassign the user's pending approvals
+func (s *Service) SetApprovalRepository(repo *repository.ApprovalRepository) {
+	s.approvals = repo
+}
+
+// deprovisionUser deactivates a user, ends their sessions and hands their pending
+// approvals to their manager, or to the stage's escalation role when they have none
+func (s *Service) deprovisionUser(userID int, reason string, client ClientInfo) error {
+	var email string
+	var managerID *int
+	err := s.db.QueryRow(`
+		UPDATE users u SET is_active = false, deprovisioned_at = CURRENT_TIMESTAMP
+		WHERE u.id = $1
+		RETURNING u.email, (SELECT m.id FROM users m WHERE m.id = u.manager_id AND m.is_active = true)
+	`, userID).Scan(&email, &managerID)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	revoked, err := s.RevokeAllSessions(userID, reason)
+	if err != nil {
+		return err
+	}
+
+	details := map[string]interface{}{"reason": reason, "sessionsRevoked": revoked}
+	if s.approvals != nil {
+		moved, err := s.approvals.ReassignPendingApprovals(userID, managerID, reason)
+		if err != nil {
+			return err
+		}
+		details["approvalsReassigned"] = moved
+		if managerID != nil {
+			details["reassignedTo"] = *managerID
+		}
+	}
+
+	s.recordAuthEvent(userID, email, EventUserDeprovisioned, client, details)
+	return nil
+}
+
+// scimUserColumns are the filterable User attributes
+var scimUserColumns = map[string]scimColumn{
+	"id":                {Expr: "u.id::text", CaseExact: true},
+	"username":          {Expr: "u.email"},
+	"emails":            {Expr: "u.email"},
+	"emails.value":      {Expr: "u.email"},
+	"emails.type":       {Expr: "'work'"},
+	"emails.primary":    {Expr: "true", Kind: scimKindBool},
+	"externalid":        {Expr: "u.external_id", CaseExact: true},
+	"displayname":       {Expr: "u.name"},
+	"name.formatted":    {Expr: "u.name"},
+	"name.givenname":    {Expr: "u.given_name"},
+	"name.familyname":   {Expr: "u.family_name"},
+	"active":            {Expr: "u.is_active", Kind: scimKindBool},
+	"roles":             {Expr: "u.role"},
+	"roles.value":       {Expr: "u.role"},
+	"manager":           {Expr: "u.manager_id::text", CaseExact: true},
+	"manager.value":     {Expr: "u.manager_id::text", CaseExact: true},
+	"meta.created":      {Expr: "u.created_at", Kind: scimKindTime},
+	"meta.lastmodified": {Expr: "u.updated_at", Kind: scimKindTime},
+	"groups":            {Expr: "gm.group_id::text", CaseExact: true, Exists: "SELECT 1 FROM scim_group_members gm WHERE gm.user_id = u.id AND %s"},
+	"groups.value":      {Expr: "gm.group_id::text", CaseExact: true, Exists: "SELECT 1 FROM scim_group_members gm WHERE gm.user_id = u.id AND %s"},
+	"groups.display":    {Expr: "sg.display_name", Exists: "SELECT 1 FROM scim_group_members gm JOIN scim_groups sg ON sg.id = gm.group_id WHERE gm.user_id = u.id AND %s"},
+	"meta.resourcetype": {Expr: "'User'"},
+}
+
+// scimGroupColumns are the filterable Group attributes
+var scimGroupColumns = map[string]scimColumn{
+	"id":                {Expr: "g.id::text", CaseExact: true},
+	"displayname":       {Expr: "g.display_name"},
+	"externalid":        {Expr: "g.external_id", CaseExact: true},
+	"members":           {Expr: "gm.user_id::text", CaseExact: true, Exists: "SELECT 1 FROM scim_group_members gm WHERE gm.group_id = g.id AND %s"},
+	"members.value":     {Expr: "gm.user_id::text", CaseExact: true, Exists: "SELECT 1 FROM scim_group_members gm WHERE gm.group_id = g.id AND %s"},
+	"meta.created":      {Expr: "g.created_at", Kind: scimKindTime},
+	"meta.lastmodified": {Expr: "g.updated_at", Kind: scimKindTime},
+	"meta.resourcetype": {Expr: "'Group'"},
+}
+
+// Provisioned users exclude service accounts and users deleted through SCIM
+const scimUserScope = `u.is_service_account = false AND u.scim_deleted_at IS NULL`
+
+const scimUserSelect = `
+	SELECT u.id, u.email, u.name, COALESCE(u.given_name, ''), COALESCE(u.family_name, ''), u.role, u.is_active,
+	       COALESCE(u.external_id, ''), u.manager_id, u.created_at, u.updated_at,
+	       COALESCE(array_agg(g.id ORDER BY g.id) FILTER (WHERE g.id IS NOT NULL), '{}'),
+	       COALESCE(array_agg(g.display_name ORDER BY g.id) FILTER (WHERE g.id IS NOT NULL), '{}')
+	FROM users u
+	LEFT JOIN scim_group_members m ON m.user_id = u.id
+	LEFT JOIN scim_groups g ON g.id = m.group_id`
+
+func scanSCIMUser(row interface{ Scan(...interface{}) error }) (*scimUserRecord, error) {
+	var u scimUserRecord
+	err := row.Scan(&u.ID, &u.Email, &u.Name, &u.GivenName, &u.FamilyName, &u.Role, &u.Active,
+		&u.ExternalID, &u.ManagerID, &u.CreatedAt, &u.UpdatedAt,
+		(*pq.Int64Array)(&u.GroupIDs), pq.Array(&u.GroupNames))
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// scimWhere compiles an optional filter and prepends the scope
+func scimWhere(scope string, filter scimFilter, columns map[string]scimColumn) (string, []interface{}, error) {
+	if filter == nil {
+		return scope, nil, nil
+	}
+	c := &scimSQL{columns: columns}
+	clause, err := c.compile(filter)
+	if err != nil {
+		return "", nil, &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidFilter", Detail: err.Error()}
+	}
+	return scope + " AND " + clause, c.args, nil
+}
+
+// listSCIMUsers returns a page of users matching filter; startIndex is 1-based
+func (s *Service) listSCIMUsers(filter scimFilter, startIndex, count int) ([]*scimUserRecord, int, error) {
+	where, args, err := scimWhere(scimUserScope, filter, scimUserColumns)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM users u WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("database error: %w", err)
+	}
+	users := []*scimUserRecord{}
+	if count == 0 {
+		return users, total, nil
+	}
+
+	args = append(args, count, startIndex-1)
+	rows, err := s.db.Query(fmt.Sprintf(`%s WHERE %s GROUP BY u.id ORDER BY u.id LIMIT $%d OFFSET $%d`,
+		scimUserSelect, where, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("database error: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		u, err := scanSCIMUser(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("scan error: %w", err)
+		}
+		users = append(users, u)
+	}
+	return users, total, rows.Err()
+}
+
+// getSCIMUser returns a provisioned user
+func (s *Service) getSCIMUser(id int) (*scimUserRecord, error) {
+	u, err := scanSCIMUser(s.db.QueryRow(scimUserSelect+` WHERE `+scimUserScope+` AND u.id = $1 GROUP BY u.id`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return u, nil
+}
+
+// scimUniqueError turns unique violations into SCIM uniqueness errors
+func scimUniqueError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return &SCIMError{Status: http.StatusConflict, SCIMType: "uniqueness", Detail: "a resource with this userName, externalId or displayName already exists"}
+	}
+	return fmt.Errorf("database error: %w", err)
+}
+
+// scimPasswordHash validates and hashes a provisioned password. Users provisioned without
+// one can only sign in through single sign-on or a password reset.
+func (s *Service) scimPasswordHash(u *scimUserRecord) (string, error) {
+	if u.Password == nil {
+		return "", nil
+	}
+	if err := s.passwordPolicy.Validate(*u.Password, u.Email); err != nil {
+		return "", scimInvalidValue("%s", err.Error())
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(*u.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// checkSCIMManager rejects managers that do not exist or are the user themselves
+func (s *Service) checkSCIMManager(u *scimUserRecord) error {
+	if u.ManagerID == nil {
+		return nil
+	}
+	if *u.ManagerID == u.ID {
+		return scimInvalidValue("a user cannot be their own manager")
+	}
+	var exists bool
+	if err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, *u.ManagerID).Scan(&exists); err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if !exists {
+		return scimInvalidValue("manager %d does not exist", *u.ManagerID)
+	}
+	return nil
+}
+
+// createSCIMUser provisions a user with the default role. A user previously deleted
+// through SCIM is restored when the provider creates them again.
+func (s *Service) createSCIMUser(u *scimUserRecord, client ClientInfo) (*scimUserRecord, error) {
+	if err := s.checkSCIMManager(u); err != nil {
+		return nil, err
+	}
+	hash, err := s.scimPasswordHash(u)
+	if err != nil {
+		return nil, err
+	}
+
+	var id int
+	err = s.db.QueryRow(`
+		UPDATE users SET name = $2, given_name = NULLIF($3, ''), family_name = NULLIF($4, ''),
+			is_active = $5, external_id = NULLIF($6, ''), manager_id = $7, password_hash = $8,
+			role = $9, scim_deleted_at = NULL, deprovisioned_at = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE LOWER(email) = LOWER($1) AND scim_deleted_at IS NOT NULL
+		RETURNING id
+	`, u.Email, u.Name, u.GivenName, u.FamilyName, u.Active, u.ExternalID, u.ManagerID, hash, s.scim.DefaultRole).Scan(&id)
+	if err == sql.ErrNoRows {
+		err = s.db.QueryRow(`
+			INSERT INTO users (email, password_hash, name, given_name, family_name, role, is_active,
+				external_id, manager_id, password_changed_at)
+			VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7, NULLIF($8, ''), $9,
+				CASE WHEN $2 = '' THEN NULL ELSE CURRENT_TIMESTAMP END)
+			RETURNING id
+		`, u.Email, hash, u.Name, u.GivenName, u.FamilyName, s.scim.DefaultRole, u.Active, u.ExternalID, u.ManagerID).Scan(&id)
+	}
+	if err != nil {
+		return nil, scimUniqueError(err)
+	}
+
+	s.recordAuthEvent(id, u.Email, EventUserProvisioned, client, map[string]interface{}{"externalId": u.ExternalID})
+	return s.getSCIMUser(id)
+}
+
+// saveSCIMUser writes an updated user. Deactivating a user deprovisions them.
+func (s *Service) saveSCIMUser(before, after *scimUserRecord, client ClientInfo) (*scimUserRecord, error) {
+	if after.Email == "" {
+		return nil, scimInvalidValue("userName or a primary email must be an email address")
+	}
+	if err := s.checkSCIMManager(after); err != nil {
+		return nil, err
+	}
+
+	query := `UPDATE users SET email = $1, name = $2, given_name = NULLIF($3, ''), family_name = NULLIF($4, ''),
+		is_active = $5, external_id = NULLIF($6, ''), manager_id = $7, updated_at = CURRENT_TIMESTAMP`
+	args := []interface{}{after.Email, after.Name, after.GivenName, after.FamilyName, after.Active, after.ExternalID, after.ManagerID}
+	if after.Active {
+		query += ", deprovisioned_at = NULL"
+	}
+	if after.Password != nil {
+		hash, err := s.scimPasswordHash(after)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, hash)
+		query += fmt.Sprintf(", password_hash = $%d, password_changed_at = CURRENT_TIMESTAMP, failed_login_count = 0, locked_until = NULL", len(args))
+	}
+	args = append(args, after.ID)
+	query += fmt.Sprintf(" WHERE id = $%d", len(args))
+
+	if _, err := s.db.Exec(query, args...); err != nil {
+		return nil, scimUniqueError(err)
+	}
+
+	if before.Active && !after.Active {
+		if err := s.deprovisionUser(after.ID, "scim_deprovisioned", client); err != nil {
+			return nil, err
+		}
+	}
+	return s.getSCIMUser(after.ID)
+}
+
+// deleteSCIMUser deprovisions a user and hides them from the provider. The row is kept so
+// approvals and history still resolve the user.
+func (s *Service) deleteSCIMUser(id int, client ClientInfo) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE users u SET scim_deleted_at = CURRENT_TIMESTAMP, external_id = NULL
+		WHERE u.id = $1 AND `+scimUserScope, id)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrUserNotFound
+	}
+	if _, err := tx.Exec(`DELETE FROM scim_group_members WHERE user_id = $1`, id); err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if err := s.syncSCIMAccess(tx, id); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	return s.deprovisionUser(id, "scim_deleted", client)
+}
+
+// syncSCIMAccess applies the role mappings to a user after their groups changed. Workspace
+// memberships added by hand are left alone.
+func (s *Service) syncSCIMAccess(tx *sql.Tx, userID int) error {
+	if len(s.scim.RoleMappings) == 0 {
+		return nil
+	}
+
+	var groups []string
+	err := tx.QueryRow(`
+		SELECT COALESCE(array_agg(g.display_name), '{}')
+		FROM scim_group_members m JOIN scim_groups g ON g.id = m.group_id
+		WHERE m.user_id = $1
+	`, userID).Scan(pq.Array(&groups))
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	role, workspaces := s.scim.mappedAccess(groups)
+
+	if _, err := tx.Exec(`UPDATE users SET role = $1 WHERE id = $2 AND role <> $1`, role, userID); err != nil {
+		return fmt.Errorf("failed to sync role: %w", err)
+	}
+
+	folders := make([]string, 0, len(workspaces))
+	for folder, wsRole := range workspaces {
+		folders = append(folders, folder)
+		_, err := tx.Exec(`
+			INSERT INTO workspace_members (workspace_id, user_id, role_id, scim_managed)
+			SELECT w.id, $1, r.id, true FROM workspaces w, roles r
+			WHERE w.folder_name = $2 AND r.name = $3
+			ON CONFLICT (workspace_id, user_id) DO UPDATE SET role_id = EXCLUDED.role_id
+			WHERE workspace_members.scim_managed
+		`, userID, folder, wsRole)
+		if err != nil {
+			return fmt.Errorf("failed to sync workspace membership: %w", err)
+		}
+	}
+	_, err = tx.Exec(`
+		DELETE FROM workspace_members wm USING workspaces w
+		WHERE wm.workspace_id = w.id AND wm.user_id = $1 AND wm.scim_managed
+		  AND NOT (COALESCE(w.folder_name, '') = ANY($2))
+	`, userID, pq.Array(folders))
+	if err != nil {
+		return fmt.Errorf("failed to sync workspace membership: %w", err)
+	}
+	return nil
+}
+
+// listSCIMGroups returns a page of groups matching filter; startIndex is 1-based
+func (s *Service) listSCIMGroups(filter scimFilter, startIndex, count int, withMembers bool) ([]*scimGroupRecord, int, error) {
+	where, args, err := scimWhere("true", filter, scimGroupColumns)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM scim_groups g WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("database error: %w", err)
+	}
+	groups := []*scimGroupRecord{}
+	if count == 0 {
+		return groups, total, nil
+	}
+
+	args = append(args, count, startIndex-1)
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT g.id, g.display_name, COALESCE(g.external_id, ''), g.created_at, g.updated_at
+		FROM scim_groups g WHERE %s ORDER BY g.id LIMIT $%d OFFSET $%d
+	`, where, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("database error: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var g scimGroupRecord
+		if err := rows.Scan(&g.ID, &g.DisplayName, &g.ExternalID, &g.CreatedAt, &g.UpdatedAt); err != nil {
+			return nil, 0, fmt.Errorf("scan error: %w", err)
+		}
+		groups = append(groups, &g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("database error: %w", err)
+	}
+
+	if withMembers {
+		if err := s.loadSCIMMembers(groups); err != nil {
+			return nil, 0, err
+		}
+	}
+	return groups, total, nil
+}
+
+func (s *Service) loadSCIMMembers(groups []*scimGroupRecord) error {
+	if len(groups) == 0 {
+		return nil
+	}
+	byID := make(map[int]*scimGroupRecord, len(groups))
+	ids := make([]int64, 0, len(groups))
+	for _, g := range groups {
+		byID[g.ID] = g
+		ids = append(ids, int64(g.ID))
+	}
+
+	rows, err := s.db.Query(`
+		SELECT m.group_id, u.id, u.email
+		FROM scim_group_members m JOIN users u ON u.id = m.user_id
+		WHERE m.group_id = ANY($1)
+		ORDER BY u.id
+	`, pq.Int64Array(ids))
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var groupID int
+		var m scimMember
+		if err := rows.Scan(&groupID, &m.UserID, &m.Email); err != nil {
+			return fmt.Errorf("scan error: %w", err)
+		}
+		byID[groupID].Members = append(byID[groupID].Members, m)
+	}
+	return rows.Err()
+}
+
+// getSCIMGroup returns a group
+func (s *Service) getSCIMGroup(id int, withMembers bool) (*scimGroupRecord, error) {
+	var g scimGroupRecord
+	err := s.db.QueryRow(`
+		SELECT id, display_name, COALESCE(external_id, ''), created_at, updated_at
+		FROM scim_groups WHERE id = $1
+	`, id).Scan(&g.ID, &g.DisplayName, &g.ExternalID, &g.CreatedAt, &g.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if withMembers {
+		if err := s.loadSCIMMembers([]*scimGroupRecord{&g}); err != nil {
+			return nil, err
+		}
+	}
+	return &g, nil
+}
+
+// setSCIMMembers replaces a group's members and re-syncs the access of everyone affected
+func (s *Service) setSCIMMembers(tx *sql.Tx, groupID int, before, after []int, syncAll bool) error {
+	want := map[int]bool{}
+	for _, id := range after {
+		want[id] = true
+	}
+	had := map[int]bool{}
+	for _, id := range before {
+		had[id] = true
+	}
+
+	var added, removed []int64
+	for id := range want {
+		if !had[id] {
+			added = append(added, int64(id))
+		}
+	}
+	for id := range had {
+		if !want[id] {
+			removed = append(removed, int64(id))
+		}
+	}
+
+	if len(added) > 0 {
+		var known int
+		err := tx.QueryRow(`SELECT COUNT(*) FROM users u WHERE u.id = ANY($1) AND `+scimUserScope, pq.Int64Array(added)).Scan(&known)
+		if err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+		if known != len(added) {
+			return scimInvalidValue("members must reference provisioned users")
+		}
+		_, err = tx.Exec(`
+			INSERT INTO scim_group_members (group_id, user_id)
+			SELECT $1, unnest($2::int[]) ON CONFLICT DO NOTHING
+		`, groupID, pq.Int64Array(added))
+		if err != nil {
+			return fmt.Errorf("failed to add members: %w", err)
+		}
+	}
+	if len(removed) > 0 {
+		if _, err := tx.Exec(`DELETE FROM scim_group_members WHERE group_id = $1 AND user_id = ANY($2)`, groupID, pq.Int64Array(removed)); err != nil {
+			return fmt.Errorf("failed to remove members: %w", err)
+		}
+	}
+
+	affected := append(added, removed...)
+	if syncAll {
+		// A renamed or deleted group can change the mapping for every member
+		affected = affected[:0]
+		for id := range had {
+			affected = append(affected, int64(id))
+		}
+		for _, id := range added {
+			affected = append(affected, id)
+		}
+	}
+	for _, id := range affected {
+		if err := s.syncSCIMAccess(tx, int(id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createSCIMGroup creates a group with its initial members
+func (s *Service) createSCIMGroup(g *scimGroupRecord, members []int) (*scimGroupRecord, error) {
+	if strings.TrimSpace(g.DisplayName) == "" {
+		return nil, scimInvalidValue("displayName is required")
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO scim_groups (display_name, external_id) VALUES ($1, NULLIF($2, '')) RETURNING id
+	`, g.DisplayName, g.ExternalID).Scan(&id)
+	if err != nil {
+		return nil, scimUniqueError(err)
+	}
+	if err := s.setSCIMMembers(tx, id, nil, members, false); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return s.getSCIMGroup(id, true)
+}
+
+// saveSCIMGroup writes a group's name and members
+func (s *Service) saveSCIMGroup(before, after *scimGroupRecord, members []int) (*scimGroupRecord, error) {
+	if strings.TrimSpace(after.DisplayName) == "" {
+		return nil, scimInvalidValue("displayName is required")
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE scim_groups SET display_name = $1, external_id = NULLIF($2, '') WHERE id = $3
+	`, after.DisplayName, after.ExternalID, after.ID)
+	if err != nil {
+		return nil, scimUniqueError(err)
+	}
+	renamed := !strings.EqualFold(before.DisplayName, after.DisplayName)
+	if err := s.setSCIMMembers(tx, after.ID, before.memberIDs(), members, renamed); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return s.getSCIMGroup(after.ID, true)
+}
+
+// deleteSCIMGroup removes a group and the access it granted
+func (s *Service) deleteSCIMGroup(id int) error {
+	g, err := s.getSCIMGroup(id, true)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM scim_groups WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	for _, userID := range g.memberIDs() {
+		if err := s.syncSCIMAccess(tx, userID); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	log.Printf("SCIM group %q deleted", g.DisplayName)
+	return nil
+}
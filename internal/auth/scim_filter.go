@@ -0,0 +1,410 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scimFilter is a parsed SCIM filter expression (RFC 7644 section 3.4.2.2)
+type scimFilter interface{}
+
+// scimLogical joins two filters with "and" or "or"
+type scimLogical struct {
+	Op          string
+	Left, Right scimFilter
+}
+
+// scimNot negates a filter
+type scimNot struct {
+	Filter scimFilter
+}
+
+// scimCompare is "attr op value", or "attr pr" with a nil value
+type scimCompare struct {
+	Attr  string // Lowercase, without schema URN, e.g. "emails.value"
+	Op    string
+	Value interface{} // string, float64, bool or nil
+}
+
+var scimCompareOps = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true,
+	"gt": true, "ge": true, "lt": true, "le": true, "pr": true,
+}
+
+// scimAttrPath lowercases an attribute path and strips a schema URN prefix, so
+// "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.value" becomes
+// "manager.value"
+func scimAttrPath(path string) string {
+	path = strings.ToLower(strings.TrimSpace(path))
+	if strings.HasPrefix(path, "urn:") {
+		path = path[strings.LastIndex(path, ":")+1:]
+	}
+	return path
+}
+
+// parseSCIMFilter parses a filter such as `userName eq "bjensen" and active eq true`
+func parseSCIMFilter(input string) (scimFilter, error) {
+	tokens, err := tokenizeSCIMFilter(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &scimFilterParser{tokens: tokens}
+	f, err := p.parseOr("")
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return f, nil
+}
+
+type scimToken struct {
+	text   string
+	quoted bool // A JSON string literal; text holds the decoded value
+}
+
+func tokenizeSCIMFilter(input string) ([]scimToken, error) {
+	var tokens []scimToken
+	for i := 0; i < len(input); {
+		switch c := input[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')' || c == '[' || c == ']':
+			tokens = append(tokens, scimToken{text: string(c)})
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(input) && input[end] != '"' {
+				if input[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(input) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			var s string
+			if err := json.Unmarshal([]byte(input[i:end+1]), &s); err != nil {
+				return nil, fmt.Errorf("invalid string %s", input[i:end+1])
+			}
+			tokens = append(tokens, scimToken{text: s, quoted: true})
+			i = end + 1
+		default:
+			end := i
+			for end < len(input) && !strings.ContainsRune(" \t\n\r()[]\"", rune(input[end])) {
+				end++
+			}
+			tokens = append(tokens, scimToken{text: input[i:end]})
+			i = end
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty filter")
+	}
+	return tokens, nil
+}
+
+type scimFilterParser struct {
+	tokens []scimToken
+	pos    int
+}
+
+func (p *scimFilterParser) peek() (scimToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return scimToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *scimFilterParser) keyword(word string) bool {
+	t, ok := p.peek()
+	if ok && !t.quoted && strings.EqualFold(t.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *scimFilterParser) expect(text string) error {
+	if !p.keyword(text) {
+		return fmt.Errorf("expected %q", text)
+	}
+	return nil
+}
+
+// parseOr parses or-joined terms. prefix is the parent attribute inside a value path.
+func (p *scimFilterParser) parseOr(prefix string) (scimFilter, error) {
+	left, err := p.parseAnd(prefix)
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd(prefix)
+		if err != nil {
+			return nil, err
+		}
+		left = &scimLogical{Op: "or", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseAnd(prefix string) (scimFilter, error) {
+	left, err := p.parseTerm(prefix)
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseTerm(prefix)
+		if err != nil {
+			return nil, err
+		}
+		left = &scimLogical{Op: "and", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseTerm(prefix string) (scimFilter, error) {
+	if p.keyword("not") {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		f, err := p.parseOr(prefix)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return &scimNot{Filter: f}, nil
+	}
+	if p.keyword("(") {
+		f, err := p.parseOr(prefix)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+
+	t, ok := p.peek()
+	if !ok || t.quoted {
+		return nil, fmt.Errorf("expected an attribute")
+	}
+	p.pos++
+	attr := scimAttrPath(t.text)
+	if prefix != "" {
+		attr = prefix + "." + attr
+	}
+
+	// Value path: emails[type eq "work" and value co "@example.com"]
+	if p.keyword("[") {
+		f, err := p.parseOr(attr)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+
+	opTok, ok := p.peek()
+	if !ok || opTok.quoted || !scimCompareOps[strings.ToLower(opTok.text)] {
+		return nil, fmt.Errorf("expected an operator after %q", t.text)
+	}
+	p.pos++
+	op := strings.ToLower(opTok.text)
+	if op == "pr" {
+		return &scimCompare{Attr: attr, Op: op}, nil
+	}
+
+	valTok, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("expected a value after %q", opTok.text)
+	}
+	p.pos++
+	value, err := scimFilterValue(valTok)
+	if err != nil {
+		return nil, err
+	}
+	return &scimCompare{Attr: attr, Op: op, Value: value}, nil
+}
+
+func scimFilterValue(t scimToken) (interface{}, error) {
+	if t.quoted {
+		return t.text, nil
+	}
+	switch strings.ToLower(t.text) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	n, err := strconv.ParseFloat(t.text, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q", t.text)
+	}
+	return n, nil
+}
+
+// scimAttrKind is the SQL type an attribute is compared as
+type scimAttrKind int
+
+const (
+	scimKindString scimAttrKind = iota
+	scimKindBool
+	scimKindTime
+)
+
+// scimColumn maps a filterable attribute to a SQL expression
+type scimColumn struct {
+	Expr      string
+	Kind      scimAttrKind
+	CaseExact bool
+	// Exists, when set, wraps the comparison in EXISTS (...); %s is replaced by it
+	Exists string
+}
+
+// scimSQL compiles a filter to a WHERE clause over the given columns. Placeholders are
+// numbered after the args already present.
+type scimSQL struct {
+	columns map[string]scimColumn
+	args    []interface{}
+}
+
+func (c *scimSQL) compile(f scimFilter) (string, error) {
+	switch f := f.(type) {
+	case *scimLogical:
+		left, err := c.compile(f.Left)
+		if err != nil {
+			return "", err
+		}
+		right, err := c.compile(f.Right)
+		if err != nil {
+			return "", err
+		}
+		return "(" + left + " " + strings.ToUpper(f.Op) + " " + right + ")", nil
+	case *scimNot:
+		inner, err := c.compile(f.Filter)
+		if err != nil {
+			return "", err
+		}
+		return "NOT " + inner, nil
+	case *scimCompare:
+		col, ok := c.columns[f.Attr]
+		if !ok {
+			return "", fmt.Errorf("filtering on %q is not supported", f.Attr)
+		}
+		pred, err := c.compare(col, f)
+		if err != nil {
+			return "", err
+		}
+		if col.Exists != "" {
+			return "EXISTS (" + fmt.Sprintf(col.Exists, pred) + ")", nil
+		}
+		return pred, nil
+	}
+	return "", fmt.Errorf("invalid filter")
+}
+
+func (c *scimSQL) placeholder(v interface{}) string {
+	c.args = append(c.args, v)
+	return fmt.Sprintf("$%d", len(c.args))
+}
+
+func (c *scimSQL) compare(col scimColumn, f *scimCompare) (string, error) {
+	expr := col.Expr
+	if f.Op == "pr" {
+		if col.Kind == scimKindString {
+			return fmt.Sprintf("(%s IS NOT NULL AND %s <> '')", expr, expr), nil
+		}
+		return expr + " IS NOT NULL", nil
+	}
+	if f.Value == nil {
+		switch f.Op {
+		case "eq":
+			return expr + " IS NULL", nil
+		case "ne":
+			return expr + " IS NOT NULL", nil
+		}
+		return "", fmt.Errorf("null can only be compared with eq or ne")
+	}
+
+	switch col.Kind {
+	case scimKindBool:
+		b, ok := f.Value.(bool)
+		if !ok || (f.Op != "eq" && f.Op != "ne") {
+			return "", fmt.Errorf("%q only supports eq and ne with true or false", f.Attr)
+		}
+		if f.Op == "ne" {
+			return expr + " IS DISTINCT FROM " + c.placeholder(b), nil
+		}
+		return expr + " = " + c.placeholder(b), nil
+
+	case scimKindTime:
+		s, ok := f.Value.(string)
+		if !ok {
+			return "", fmt.Errorf("%q must be compared with a date string", f.Attr)
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return "", fmt.Errorf("invalid date %q", s)
+		}
+		op, ok := map[string]string{"eq": "=", "ne": "<>", "gt": ">", "ge": ">=", "lt": "<", "le": "<="}[f.Op]
+		if !ok {
+			return "", fmt.Errorf("%q does not support %s", f.Attr, f.Op)
+		}
+		return expr + " " + op + " " + c.placeholder(t.UTC()), nil
+	}
+
+	var s string
+	switch v := f.Value.(type) {
+	case string:
+		s = v
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return "", fmt.Errorf("%q must be compared with a string", f.Attr)
+	}
+	if !col.CaseExact {
+		expr = "LOWER(" + expr + ")"
+		s = strings.ToLower(s)
+	}
+
+	switch f.Op {
+	case "eq":
+		return expr + " = " + c.placeholder(s), nil
+	case "ne":
+		return expr + " IS DISTINCT FROM " + c.placeholder(s), nil
+	case "co", "sw", "ew":
+		pattern := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+		switch f.Op {
+		case "co":
+			pattern = "%" + pattern + "%"
+		case "sw":
+			pattern += "%"
+		case "ew":
+			pattern = "%" + pattern
+		}
+		return expr + " LIKE " + c.placeholder(pattern), nil
+	default:
+		op := map[string]string{"gt": ">", "ge": ">=", "lt": "<", "le": "<="}[f.Op]
+		return expr + " " + op + " " + c.placeholder(s), nil
+	}
+}
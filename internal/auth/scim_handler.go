@@ -0,0 +1,439 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	scimDefaultCount = 100
+	scimMaxCount     = 200
+)
+
+// respondSCIM sends a SCIM JSON response
+func respondSCIM(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+// respondSCIMError sends an error in the SCIM error format
+func respondSCIMError(w http.ResponseWriter, err error) {
+	var scimErr *SCIMError
+	var policyErr *PasswordPolicyError
+	switch {
+	case errors.As(err, &scimErr):
+	case err == ErrUserNotFound:
+		scimErr = &SCIMError{Status: http.StatusNotFound, Detail: "User not found"}
+	case err == ErrGroupNotFound:
+		scimErr = &SCIMError{Status: http.StatusNotFound, Detail: "Group not found"}
+	case errors.As(err, &policyErr):
+		scimErr = scimInvalidValue("%s", policyErr.Error())
+	default:
+		log.Printf("SCIM error: %v", err)
+		scimErr = &SCIMError{Status: http.StatusInternalServerError, Detail: "Internal server error"}
+	}
+	respondSCIM(w, scimErr.Status, map[string]interface{}{
+		"schemas":  []string{SCIMSchemaError},
+		"status":   strconv.Itoa(scimErr.Status),
+		"scimType": scimErr.SCIMType,
+		"detail":   scimErr.Detail,
+	})
+}
+
+// scimBaseURL is the SCIM endpoint root as seen by the client
+func scimBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	host := r.Host
+	if forwarded := r.Header.Get("X-Forwarded-Host"); forwarded != "" {
+		host = forwarded
+	}
+	return scheme + "://" + host + "/scim/v2"
+}
+
+// scimListParams reads filter, startIndex and count from the query string
+func scimListParams(r *http.Request) (scimFilter, int, int, error) {
+	q := r.URL.Query()
+	var filter scimFilter
+	if raw := q.Get("filter"); raw != "" {
+		f, err := parseSCIMFilter(raw)
+		if err != nil {
+			return nil, 0, 0, &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidFilter", Detail: err.Error()}
+		}
+		filter = f
+	}
+
+	startIndex, count := 1, scimDefaultCount
+	if v, err := strconv.Atoi(q.Get("startIndex")); err == nil && v > 1 {
+		startIndex = v
+	}
+	if v, err := strconv.Atoi(q.Get("count")); err == nil {
+		count = max(0, min(v, scimMaxCount))
+	}
+	return filter, startIndex, count, nil
+}
+
+// scimID parses the {id} path value
+func scimID(r *http.Request, notFound error) (int, error) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		return 0, notFound
+	}
+	return id, nil
+}
+
+// scimWithMembers reports whether the client asked to leave out group members
+func scimWithMembers(r *http.Request) bool {
+	for _, attr := range strings.Split(r.URL.Query().Get("excludedAttributes"), ",") {
+		if scimAttrPath(attr) == "members" {
+			return false
+		}
+	}
+	return true
+}
+
+func decodeSCIM(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidSyntax", Detail: "Invalid request body"}
+	}
+	return nil
+}
+
+// scimGroupMembers reads member references from a Group resource
+func scimGroupMembers(values []SCIMValue) ([]int, error) {
+	ids := make([]int, 0, len(values))
+	for _, v := range values {
+		id, err := strconv.Atoi(v.Value)
+		if err != nil {
+			return nil, scimInvalidValue("unknown member %q", v.Value)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// SCIMServiceProviderConfig describes the supported SCIM features
+func (h *Handler) SCIMServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	respondSCIM(w, http.StatusOK, map[string]interface{}{
+		"schemas":          []string{"urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"},
+		"documentationUri": "https://github.com/jareynolds/ubecode/blob/main/docs/AUTHENTICATION.md",
+		"patch":            map[string]bool{"supported": true},
+		"bulk":             map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":           map[string]interface{}{"supported": true, "maxResults": scimMaxCount},
+		"changePassword":   map[string]bool{"supported": true},
+		"sort":             map[string]bool{"supported": false},
+		"etag":             map[string]bool{"supported": false},
+		"authenticationSchemes": []map[string]interface{}{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "A personal access token of an admin service account with the users:provision scope",
+			"primary":     true,
+		}},
+		"meta": map[string]string{"resourceType": "ServiceProviderConfig", "location": scimBaseURL(r) + "/ServiceProviderConfig"},
+	})
+}
+
+// SCIMResourceTypes lists the User and Group resource types
+func (h *Handler) SCIMResourceTypes(w http.ResponseWriter, r *http.Request) {
+	base := scimBaseURL(r)
+	types := []map[string]interface{}{
+		{
+			"schemas":          []string{"urn:ietf:params:scim:schemas:core:2.0:ResourceType"},
+			"id":               "User",
+			"name":             "User",
+			"endpoint":         "/Users",
+			"schema":           SCIMSchemaUser,
+			"schemaExtensions": []map[string]interface{}{{"schema": SCIMSchemaEnterprise, "required": false}},
+			"meta":             map[string]string{"resourceType": "ResourceType", "location": base + "/ResourceTypes/User"},
+		},
+		{
+			"schemas":  []string{"urn:ietf:params:scim:schemas:core:2.0:ResourceType"},
+			"id":       "Group",
+			"name":     "Group",
+			"endpoint": "/Groups",
+			"schema":   SCIMSchemaGroup,
+			"meta":     map[string]string{"resourceType": "ResourceType", "location": base + "/ResourceTypes/Group"},
+		},
+	}
+	respondSCIM(w, http.StatusOK, SCIMListResponse{
+		Schemas:      []string{SCIMSchemaList},
+		TotalResults: len(types),
+		StartIndex:   1,
+		ItemsPerPage: len(types),
+		Resources:    types,
+	})
+}
+
+// SCIMListUsers lists provisioned users, optionally filtered
+func (h *Handler) SCIMListUsers(w http.ResponseWriter, r *http.Request) {
+	filter, startIndex, count, err := scimListParams(r)
+	if err != nil {
+		respondSCIMError(w, err)
+		return
+	}
+	users, total, err := h.service.listSCIMUsers(filter, startIndex, count)
+	if err != nil {
+		respondSCIMError(w, err)
+		return
+	}
+
+	base := scimBaseURL(r)
+	resources := make([]SCIMUser, 0, len(users))
+	for _, u := range users {
+		resources = append(resources, u.toSCIM(base))
+	}
+	respondSCIM(w, http.StatusOK, SCIMListResponse{
+		Schemas:      []string{SCIMSchemaList},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// SCIMGetUser returns one user
+func (h *Handler) SCIMGetUser(w http.ResponseWriter, r *http.Request) {
+	id, err := scimID(r, ErrUserNotFound)
+	if err != nil {
+		respondSCIMError(w, err)
+		return
+	}
+	user, err := h.service.getSCIMUser(id)
+	if err != nil {
+		respondSCIMError(w, err)
+		return
+	}
+	respondSCIM(w, http.StatusOK, user.toSCIM(scimBaseURL(r)))
+}
+
+// SCIMCreateUser provisions a user
+func (h *Handler) SCIMCreateUser(w http.ResponseWriter, r *http.Request) {
+	var in SCIMUser
+	if err := decodeSCIM(r, &in); err != nil {
+		respondSCIMError(w, err)
+		return
+	}
+	var record scimUserRecord
+	if err := record.replaceFromSCIM(&in); err != nil {
+		respondSCIMError(w, err)
+		return
+	}
+	user, err := h.service.createSCIMUser(&record, h.service.ClientInfo(r))
+	if err != nil {
+		respondSCIMError(w, err)
+		return
+	}
+	resource := user.toSCIM(scimBaseURL(r))
+	w.Header().Set("Location", resource.Meta.Location)
+	respondSCIM(w, http.StatusCreated, resource)
+}
+
+// SCIMReplaceUser replaces a user's attributes (PUT)
+func (h *Handler) SCIMReplaceUser(w http.ResponseWriter, r *http.Request) {
+	h.updateSCIMUser(w, r, func(u *scimUserRecord) error {
+		var in SCIMUser
+		if err := decodeSCIM(r, &in); err != nil {
+			return err
+		}
+		return u.replaceFromSCIM(&in)
+	})
+}
+
+// SCIMPatchUser applies PATCH operations to a user; identity providers deprovision
+// users by setting active to false
+func (h *Handler) SCIMPatchUser(w http.ResponseWriter, r *http.Request) {
+	h.updateSCIMUser(w, r, func(u *scimUserRecord) error {
+		var req SCIMPatchRequest
+		if err := decodeSCIM(r, &req); err != nil {
+			return err
+		}
+		return applyUserPatch(u, req.Operations)
+	})
+}
+
+func (h *Handler) updateSCIMUser(w http.ResponseWriter, r *http.Request, apply func(*scimUserRecord) error) {
+	id, err := scimID(r, ErrUserNotFound)
+	if err != nil {
+		respondSCIMError(w, err)
+		return
+	}
+	before, err := h.service.getSCIMUser(id)
+	if err != nil {
+		respondSCIMError(w, err)
+		return
+	}
+	after := *before
+	if err := apply(&after); err != nil {
+		respondSCIMError(w, err)
+		return
+	}
+	user, err := h.service.saveSCIMUser(before, &after, h.service.ClientInfo(r))
+	if err != nil {
+		respondSCIMError(w, err)
+		return
+	}
+	respondSCIM(w, http.StatusOK, user.toSCIM(scimBaseURL(r)))
+}
+
+// SCIMDeleteUser deprovisions a user and removes them from SCIM
+func (h *Handler) SCIMDeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, err := scimID(r, ErrUserNotFound)
+	if err != nil {
+		respondSCIMError(w, err)
+		return
+	}
+	if err := h.service.deleteSCIMUser(id, h.service.ClientInfo(r)); err != nil {
+		respondSCIMError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SCIMListGroups lists groups, optionally filtered
+func (h *Handler) SCIMListGroups(w http.ResponseWriter, r *http.Request) {
+	filter, startIndex, count, err := scimListParams(r)
+	if err != nil {
+		respondSCIMError(w, err)
+		return
+	}
+	withMembers := scimWithMembers(r)
+	groups, total, err := h.service.listSCIMGroups(filter, startIndex, count, withMembers)
+	if err != nil {
+		respondSCIMError(w, err)
+		return
+	}
+
+	base := scimBaseURL(r)
+	resources := make([]SCIMGroup, 0, len(groups))
+	for _, g := range groups {
+		resources = append(resources, g.toSCIM(base, withMembers))
+	}
+	respondSCIM(w, http.StatusOK, SCIMListResponse{
+		Schemas:      []string{SCIMSchemaList},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// SCIMGetGroup returns one group
+func (h *Handler) SCIMGetGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := scimID(r, ErrGroupNotFound)
+	if err != nil {
+		respondSCIMError(w, err)
+		return
+	}
+	withMembers := scimWithMembers(r)
+	group, err := h.service.getSCIMGroup(id, withMembers)
+	if err != nil {
+		respondSCIMError(w, err)
+		return
+	}
+	respondSCIM(w, http.StatusOK, group.toSCIM(scimBaseURL(r), withMembers))
+}
+
+// SCIMCreateGroup creates a group
+func (h *Handler) SCIMCreateGroup(w http.ResponseWriter, r *http.Request) {
+	var in SCIMGroup
+	if err := decodeSCIM(r, &in); err != nil {
+		respondSCIMError(w, err)
+		return
+	}
+	members, err := scimGroupMembers(in.Members)
+	if err != nil {
+		respondSCIMError(w, err)
+		return
+	}
+	group, err := h.service.createSCIMGroup(&scimGroupRecord{DisplayName: in.DisplayName, ExternalID: in.ExternalID}, members)
+	if err != nil {
+		respondSCIMError(w, err)
+		return
+	}
+	resource := group.toSCIM(scimBaseURL(r), true)
+	w.Header().Set("Location", resource.Meta.Location)
+	respondSCIM(w, http.StatusCreated, resource)
+}
+
+// SCIMReplaceGroup replaces a group's name and members (PUT)
+func (h *Handler) SCIMReplaceGroup(w http.ResponseWriter, r *http.Request) {
+	h.updateSCIMGroup(w, r, func(g *scimGroupRecord) ([]int, error) {
+		var in SCIMGroup
+		if err := decodeSCIM(r, &in); err != nil {
+			return nil, err
+		}
+		g.DisplayName, g.ExternalID = in.DisplayName, in.ExternalID
+		return scimGroupMembers(in.Members)
+	})
+}
+
+// SCIMPatchGroup applies PATCH operations to a group
+func (h *Handler) SCIMPatchGroup(w http.ResponseWriter, r *http.Request) {
+	h.updateSCIMGroup(w, r, func(g *scimGroupRecord) ([]int, error) {
+		var req SCIMPatchRequest
+		if err := decodeSCIM(r, &req); err != nil {
+			return nil, err
+		}
+		return applyGroupPatch(g, req.Operations)
+	})
+}
+
+func (h *Handler) updateSCIMGroup(w http.ResponseWriter, r *http.Request, apply func(*scimGroupRecord) ([]int, error)) {
+	id, err := scimID(r, ErrGroupNotFound)
+	if err != nil {
+		respondSCIMError(w, err)
+		return
+	}
+	before, err := h.service.getSCIMGroup(id, true)
+	if err != nil {
+		respondSCIMError(w, err)
+		return
+	}
+	after := *before
+	members, err := apply(&after)
+	if err != nil {
+		respondSCIMError(w, err)
+		return
+	}
+	group, err := h.service.saveSCIMGroup(before, &after, members)
+	if err != nil {
+		respondSCIMError(w, err)
+		return
+	}
+
+	// PATCH may answer 204, but most providers expect the updated resource
+	withMembers := scimWithMembers(r)
+	respondSCIM(w, http.StatusOK, group.toSCIM(scimBaseURL(r), withMembers))
+}
+
+// SCIMDeleteGroup deletes a group
+func (h *Handler) SCIMDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := scimID(r, ErrGroupNotFound)
+	if err != nil {
+		respondSCIMError(w, err)
+		return
+	}
+	if err := h.service.deleteSCIMGroup(id); err != nil {
+		respondSCIMError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,720 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SCIM schema URNs (RFC 7643, RFC 7644)
+const (
+	SCIMSchemaUser       = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SCIMSchemaGroup      = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SCIMSchemaEnterprise = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+	SCIMSchemaList       = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SCIMSchemaPatch      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SCIMSchemaError      = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// SCIMError is a SCIM protocol error with its HTTP status and scimType
+type SCIMError struct {
+	Status   int
+	SCIMType string // e.g. invalidFilter, uniqueness, invalidValue, mutability
+	Detail   string
+}
+
+func (e *SCIMError) Error() string {
+	return e.Detail
+}
+
+func scimInvalidValue(format string, args ...interface{}) *SCIMError {
+	return &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidValue", Detail: fmt.Sprintf(format, args...)}
+}
+
+// SCIMName is the components of a user's name
+type SCIMName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// SCIMValue is an entry of a multi-valued attribute such as emails or members
+type SCIMValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// SCIMManager references a user's manager in the enterprise extension
+type SCIMManager struct {
+	Value       string `json:"value"`
+	Ref         string `json:"$ref,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+// SCIMEnterpriseUser is the enterprise extension; only the manager is stored
+type SCIMEnterpriseUser struct {
+	Manager *SCIMManager `json:"manager,omitempty"`
+}
+
+// SCIMMeta describes a resource
+type SCIMMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+}
+
+// SCIMUser is a User resource. Groups and roles are read-only; password is write-only.
+type SCIMUser struct {
+	Schemas     []string            `json:"schemas"`
+	ID          string              `json:"id,omitempty"`
+	ExternalID  string              `json:"externalId,omitempty"`
+	UserName    string              `json:"userName"`
+	Name        *SCIMName           `json:"name,omitempty"`
+	DisplayName string              `json:"displayName,omitempty"`
+	Emails      []SCIMValue         `json:"emails,omitempty"`
+	Active      *bool               `json:"active,omitempty"`
+	Password    string              `json:"password,omitempty"`
+	Groups      []SCIMValue         `json:"groups,omitempty"`
+	Roles       []SCIMValue         `json:"roles,omitempty"`
+	Enterprise  *SCIMEnterpriseUser `json:"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User,omitempty"`
+	Meta        *SCIMMeta           `json:"meta,omitempty"`
+}
+
+// SCIMGroup is a Group resource
+type SCIMGroup struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	DisplayName string      `json:"displayName"`
+	Members     []SCIMValue `json:"members,omitempty"`
+	Meta        *SCIMMeta   `json:"meta,omitempty"`
+}
+
+// SCIMListResponse is a page of query results
+type SCIMListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int         `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+// SCIMPatchOp is one operation of a PATCH request
+type SCIMPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// SCIMPatchRequest is the body of a PATCH request
+type SCIMPatchRequest struct {
+	Schemas    []string      `json:"schemas"`
+	Operations []SCIMPatchOp `json:"Operations"`
+}
+
+// scimUserRecord is a user as stored for SCIM
+type scimUserRecord struct {
+	ID         int
+	Email      string
+	Name       string
+	GivenName  string
+	FamilyName string
+	Role       string
+	Active     bool
+	ExternalID string
+	ManagerID  *int
+	Password   *string // Set when the provider supplies a new password
+	GroupIDs   []int64
+	GroupNames []string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// scimMember is a user in a group
+type scimMember struct {
+	UserID int
+	Email  string
+}
+
+// scimGroupRecord is a group as stored for SCIM
+type scimGroupRecord struct {
+	ID          int
+	DisplayName string
+	ExternalID  string
+	Members     []scimMember
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (g *scimGroupRecord) memberIDs() []int {
+	ids := make([]int, len(g.Members))
+	for i, m := range g.Members {
+		ids[i] = m.UserID
+	}
+	return ids
+}
+
+// toSCIM renders the user; baseURL is the SCIM endpoint root
+func (u *scimUserRecord) toSCIM(baseURL string) SCIMUser {
+	id := strconv.Itoa(u.ID)
+	active := u.Active
+	user := SCIMUser{
+		Schemas:     []string{SCIMSchemaUser, SCIMSchemaEnterprise},
+		ID:          id,
+		ExternalID:  u.ExternalID,
+		UserName:    u.Email,
+		Name:        &SCIMName{Formatted: u.Name, GivenName: u.GivenName, FamilyName: u.FamilyName},
+		DisplayName: u.Name,
+		Emails:      []SCIMValue{{Value: u.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Roles:       []SCIMValue{{Value: u.Role, Primary: true}},
+		Meta: &SCIMMeta{
+			ResourceType: "User",
+			Created:      u.CreatedAt,
+			LastModified: u.UpdatedAt,
+			Location:     baseURL + "/Users/" + id,
+		},
+	}
+	for i, gid := range u.GroupIDs {
+		value := strconv.FormatInt(gid, 10)
+		user.Groups = append(user.Groups, SCIMValue{Value: value, Display: u.GroupNames[i], Ref: baseURL + "/Groups/" + value})
+	}
+	if u.ManagerID != nil {
+		value := strconv.Itoa(*u.ManagerID)
+		user.Enterprise = &SCIMEnterpriseUser{Manager: &SCIMManager{Value: value, Ref: baseURL + "/Users/" + value}}
+	}
+	return user
+}
+
+// toSCIM renders the group; members are omitted when withMembers is false
+func (g *scimGroupRecord) toSCIM(baseURL string, withMembers bool) SCIMGroup {
+	id := strconv.Itoa(g.ID)
+	group := SCIMGroup{
+		Schemas:     []string{SCIMSchemaGroup},
+		ID:          id,
+		ExternalID:  g.ExternalID,
+		DisplayName: g.DisplayName,
+		Meta: &SCIMMeta{
+			ResourceType: "Group",
+			Created:      g.CreatedAt,
+			LastModified: g.UpdatedAt,
+			Location:     baseURL + "/Groups/" + id,
+		},
+	}
+	if withMembers {
+		group.Members = []SCIMValue{}
+		for _, m := range g.Members {
+			value := strconv.Itoa(m.UserID)
+			group.Members = append(group.Members, SCIMValue{Value: value, Display: m.Email, Ref: baseURL + "/Users/" + value})
+		}
+	}
+	return group
+}
+
+// replaceFromSCIM applies a full User resource (POST or PUT) to the record
+func (u *scimUserRecord) replaceFromSCIM(in *SCIMUser) error {
+	u.Email = scimEmail(in)
+	if u.Email == "" {
+		return scimInvalidValue("userName or a primary email must be an email address")
+	}
+	u.ExternalID = in.ExternalID
+	u.GivenName, u.FamilyName = "", ""
+	u.Name = in.DisplayName
+	if in.Name != nil {
+		u.GivenName, u.FamilyName = in.Name.GivenName, in.Name.FamilyName
+		if in.Name.Formatted != "" {
+			u.Name = in.Name.Formatted
+		}
+	}
+	if u.Name == "" {
+		u.Name = strings.TrimSpace(u.GivenName + " " + u.FamilyName)
+	}
+	if u.Name == "" {
+		u.Name = u.Email
+	}
+	u.Active = in.Active == nil || *in.Active
+	u.ManagerID = nil
+	if in.Enterprise != nil && in.Enterprise.Manager != nil && in.Enterprise.Manager.Value != "" {
+		id, err := strconv.Atoi(in.Enterprise.Manager.Value)
+		if err != nil {
+			return scimInvalidValue("manager must reference a user id")
+		}
+		u.ManagerID = &id
+	}
+	if in.Password != "" {
+		u.Password = &in.Password
+	}
+	return nil
+}
+
+// scimEmail picks the sign-in email: the userName when it is an address, otherwise the
+// primary (or first) email
+func scimEmail(in *SCIMUser) string {
+	if strings.Contains(in.UserName, "@") {
+		return strings.TrimSpace(in.UserName)
+	}
+	return primaryValue(in.Emails)
+}
+
+func primaryValue(values []SCIMValue) string {
+	for _, v := range values {
+		if v.Primary {
+			return strings.TrimSpace(v.Value)
+		}
+	}
+	if len(values) > 0 {
+		return strings.TrimSpace(values[0].Value)
+	}
+	return ""
+}
+
+// scimPatchPath splits a PATCH path such as `emails[type eq "work"].value` into the
+// attribute, an optional value filter and an optional sub-attribute
+func scimPatchPath(path string) (attr string, filter scimFilter, sub string, err error) {
+	open := strings.Index(path, "[")
+	if open < 0 {
+		return scimAttrPath(path), nil, "", nil
+	}
+	end := strings.LastIndex(path, "]")
+	if end < open {
+		return "", nil, "", &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidPath", Detail: "invalid path " + path}
+	}
+	attr = scimAttrPath(path[:open])
+	filter, err = parseSCIMFilter(path[open+1 : end])
+	if err != nil {
+		return "", nil, "", &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidPath", Detail: err.Error()}
+	}
+	sub = strings.ToLower(strings.TrimPrefix(path[end+1:], "."))
+	return attr, filter, sub, nil
+}
+
+func scimPatchOpName(op SCIMPatchOp) (string, error) {
+	name := strings.ToLower(op.Op)
+	if name != "add" && name != "replace" && name != "remove" {
+		return "", &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidSyntax", Detail: "unknown PATCH op " + op.Op}
+	}
+	return name, nil
+}
+
+// splitSCIMObject turns a path-less PATCH value into attribute paths. Keys naming a schema
+// (such as the enterprise extension) contribute their nested attributes.
+func splitSCIMObject(raw json.RawMessage) (map[string]json.RawMessage, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, scimInvalidValue("a PATCH without a path needs an object value")
+	}
+	out := map[string]json.RawMessage{}
+	for key, value := range obj {
+		lower := strings.ToLower(key)
+		if lower == strings.ToLower(SCIMSchemaEnterprise) || lower == strings.ToLower(SCIMSchemaUser) || lower == strings.ToLower(SCIMSchemaGroup) {
+			var nested map[string]json.RawMessage
+			if err := json.Unmarshal(value, &nested); err != nil {
+				return nil, scimInvalidValue("%s must be an object", key)
+			}
+			for k, v := range nested {
+				out[scimAttrPath(k)] = v
+			}
+			continue
+		}
+		out[scimAttrPath(key)] = value
+	}
+	return out, nil
+}
+
+// scimString reads a string value; some providers send numbers and booleans as JSON strings
+// and vice versa
+func scimString(raw json.RawMessage) (string, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return "", scimInvalidValue("invalid value")
+	}
+	switch v := v.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case map[string]interface{}:
+		// Complex attributes such as manager are referenced by their value
+		if s, ok := v["value"].(string); ok {
+			return s, nil
+		}
+	}
+	return "", scimInvalidValue("expected a string value")
+}
+
+func scimBool(raw json.RawMessage) (bool, error) {
+	s, err := scimString(raw)
+	if err != nil {
+		return false, err
+	}
+	b, err := strconv.ParseBool(strings.ToLower(s))
+	if err != nil {
+		return false, scimInvalidValue("expected true or false")
+	}
+	return b, nil
+}
+
+// applyUserPatch applies PATCH operations to a user. Attributes UbeCode does not store
+// are ignored so providers can send their full attribute mapping.
+func applyUserPatch(u *scimUserRecord, ops []SCIMPatchOp) error {
+	nameSet, partsSet := false, false
+	set := func(op, attr string, raw json.RawMessage) error {
+		remove := op == "remove"
+		switch attr {
+		case "active":
+			if remove {
+				return scimInvalidValue("active cannot be removed")
+			}
+			b, err := scimBool(raw)
+			if err != nil {
+				return err
+			}
+			u.Active = b
+		case "username", "emails", "emails.value":
+			if remove {
+				return scimInvalidValue("%s cannot be removed", attr)
+			}
+			var values []SCIMValue
+			if json.Unmarshal(raw, &values) == nil {
+				u.Email = primaryValue(values)
+				break
+			}
+			s, err := scimString(raw)
+			if err != nil {
+				return err
+			}
+			u.Email = strings.TrimSpace(s)
+		case "displayname", "name.formatted":
+			s := ""
+			if !remove {
+				var err error
+				if s, err = scimString(raw); err != nil {
+					return err
+				}
+			}
+			u.Name, nameSet = s, s != ""
+		case "name.givenname", "name.familyname":
+			s := ""
+			if !remove {
+				var err error
+				if s, err = scimString(raw); err != nil {
+					return err
+				}
+			}
+			if attr == "name.givenname" {
+				u.GivenName = s
+			} else {
+				u.FamilyName = s
+			}
+			partsSet = true
+		case "name":
+			if remove {
+				u.GivenName, u.FamilyName = "", ""
+				partsSet = true
+				break
+			}
+			var name SCIMName
+			if err := json.Unmarshal(raw, &name); err != nil {
+				return scimInvalidValue("name must be an object")
+			}
+			if name.GivenName != "" {
+				u.GivenName, partsSet = name.GivenName, true
+			}
+			if name.FamilyName != "" {
+				u.FamilyName, partsSet = name.FamilyName, true
+			}
+			if name.Formatted != "" {
+				u.Name, nameSet = name.Formatted, true
+			}
+		case "externalid":
+			if remove {
+				u.ExternalID = ""
+				break
+			}
+			s, err := scimString(raw)
+			if err != nil {
+				return err
+			}
+			u.ExternalID = s
+		case "password":
+			if remove {
+				return scimInvalidValue("password cannot be removed")
+			}
+			s, err := scimString(raw)
+			if err != nil {
+				return err
+			}
+			u.Password = &s
+		case "manager", "manager.value":
+			if remove {
+				u.ManagerID = nil
+				break
+			}
+			s, err := scimString(raw)
+			if err != nil {
+				return err
+			}
+			if s == "" {
+				u.ManagerID = nil
+				break
+			}
+			id, err := strconv.Atoi(s)
+			if err != nil {
+				return scimInvalidValue("manager must reference a user id")
+			}
+			u.ManagerID = &id
+		case "groups", "roles":
+			return &SCIMError{Status: http.StatusBadRequest, SCIMType: "mutability", Detail: attr + " is read-only; change group membership through Groups"}
+		}
+		return nil
+	}
+
+	for _, op := range ops {
+		name, err := scimPatchOpName(op)
+		if err != nil {
+			return err
+		}
+		if op.Path == "" {
+			if name == "remove" {
+				return &SCIMError{Status: http.StatusBadRequest, SCIMType: "noTarget", Detail: "remove needs a path"}
+			}
+			attrs, err := splitSCIMObject(op.Value)
+			if err != nil {
+				return err
+			}
+			for attr, raw := range attrs {
+				if err := set(name, attr, raw); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		attr, _, sub, err := scimPatchPath(op.Path)
+		if err != nil {
+			return err
+		}
+		// There is a single email, so emails[type eq "work"].value addresses it
+		if sub != "" {
+			attr += "." + sub
+		}
+		if err := set(name, attr, op.Value); err != nil {
+			return err
+		}
+	}
+
+	if partsSet && !nameSet {
+		if full := strings.TrimSpace(u.GivenName + " " + u.FamilyName); full != "" {
+			u.Name = full
+		}
+	}
+	return nil
+}
+
+// scimMemberIDs reads a members value: a list of {"value": "<user id>"}
+func scimMemberIDs(raw json.RawMessage) ([]int, error) {
+	var values []SCIMValue
+	if err := json.Unmarshal(raw, &values); err != nil {
+		var single SCIMValue
+		if err := json.Unmarshal(raw, &single); err != nil {
+			return nil, scimInvalidValue("members must be a list of {\"value\": id}")
+		}
+		values = []SCIMValue{single}
+	}
+	ids := make([]int, 0, len(values))
+	for _, v := range values {
+		id, err := strconv.Atoi(v.Value)
+		if err != nil {
+			return nil, scimInvalidValue("unknown member %q", v.Value)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// matchSCIMMember evaluates a value filter such as `value eq "12"` against a member
+func matchSCIMMember(f scimFilter, userID int) (bool, error) {
+	switch f := f.(type) {
+	case *scimLogical:
+		left, err := matchSCIMMember(f.Left, userID)
+		if err != nil {
+			return false, err
+		}
+		right, err := matchSCIMMember(f.Right, userID)
+		if err != nil {
+			return false, err
+		}
+		if f.Op == "and" {
+			return left && right, nil
+		}
+		return left || right, nil
+	case *scimNot:
+		m, err := matchSCIMMember(f.Filter, userID)
+		return !m, err
+	case *scimCompare:
+		if f.Attr != "value" && f.Attr != "members.value" {
+			return false, &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidFilter", Detail: "members can only be selected by value"}
+		}
+		var value string
+		switch v := f.Value.(type) {
+		case string:
+			value = v
+		case float64:
+			value = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		switch f.Op {
+		case "eq":
+			return value == strconv.Itoa(userID), nil
+		case "ne":
+			return value != strconv.Itoa(userID), nil
+		case "pr":
+			return true, nil
+		}
+		return false, &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidFilter", Detail: "members can only be selected with eq or ne"}
+	}
+	return false, &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidFilter", Detail: "invalid member filter"}
+}
+
+// applyGroupPatch applies PATCH operations to a group, returning the new member IDs
+func applyGroupPatch(g *scimGroupRecord, ops []SCIMPatchOp) ([]int, error) {
+	members := g.memberIDs()
+	has := func(id int) bool {
+		for _, m := range members {
+			if m == id {
+				return true
+			}
+		}
+		return false
+	}
+	add := func(ids []int) {
+		for _, id := range ids {
+			if !has(id) {
+				members = append(members, id)
+			}
+		}
+	}
+	without := func(keep func(int) (bool, error)) error {
+		kept := members[:0:0]
+		for _, id := range members {
+			ok, err := keep(id)
+			if err != nil {
+				return err
+			}
+			if ok {
+				kept = append(kept, id)
+			}
+		}
+		members = kept
+		return nil
+	}
+
+	set := func(op, attr string, raw json.RawMessage) error {
+		switch attr {
+		case "displayname":
+			if op == "remove" {
+				return scimInvalidValue("displayName cannot be removed")
+			}
+			s, err := scimString(raw)
+			if err != nil {
+				return err
+			}
+			g.DisplayName = s
+		case "externalid":
+			if op == "remove" {
+				g.ExternalID = ""
+				return nil
+			}
+			s, err := scimString(raw)
+			if err != nil {
+				return err
+			}
+			g.ExternalID = s
+		case "members":
+			if op == "remove" && (len(raw) == 0 || string(raw) == "null") {
+				members = nil
+				return nil
+			}
+			ids, err := scimMemberIDs(raw)
+			if err != nil {
+				return err
+			}
+			switch op {
+			case "add":
+				add(ids)
+			case "replace":
+				members = nil
+				add(ids)
+			case "remove":
+				drop := map[int]bool{}
+				for _, id := range ids {
+					drop[id] = true
+				}
+				return without(func(id int) (bool, error) { return !drop[id], nil })
+			}
+		}
+		return nil
+	}
+
+	for _, op := range ops {
+		name, err := scimPatchOpName(op)
+		if err != nil {
+			return nil, err
+		}
+		if op.Path == "" {
+			if name == "remove" {
+				return nil, &SCIMError{Status: http.StatusBadRequest, SCIMType: "noTarget", Detail: "remove needs a path"}
+			}
+			attrs, err := splitSCIMObject(op.Value)
+			if err != nil {
+				return nil, err
+			}
+			for attr, raw := range attrs {
+				if err := set(name, attr, raw); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		attr, filter, _, err := scimPatchPath(op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if filter != nil {
+			// members[value eq "12"] selects members to remove
+			if attr != "members" || name != "remove" {
+				return nil, &SCIMError{Status: http.StatusBadRequest, SCIMType: "invalidPath", Detail: "only members can be removed by filter"}
+			}
+			if err := without(func(id int) (bool, error) {
+				m, err := matchSCIMMember(filter, id)
+				return !m, err
+			}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := set(name, attr, op.Value); err != nil {
+			return nil, err
+		}
+	}
+	return members, nil
+}
@@ -0,0 +1,200 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package auth
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSCIMFilterSQL(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  string
+		want    string
+		args    []interface{}
+		wantErr bool
+	}{
+		{"username eq", `userName eq "Ada@Example.com"`, "LOWER(u.email) = $1", []interface{}{"ada@example.com"}, false},
+		{"case exact", `externalId eq "00uAbC"`, "u.external_id = $1", []interface{}{"00uAbC"}, false},
+		{"bool and", `active eq true and userName sw "a_"`, `(u.is_active = $1 AND LOWER(u.email) LIKE $2)`, []interface{}{true, `a\_%`}, false},
+		{"or not", `not (name.givenName pr) or displayName co "x"`, `(NOT (u.given_name IS NOT NULL AND u.given_name <> '') OR LOWER(u.name) LIKE $1)`, []interface{}{"%x%"}, false},
+		{"value path", `emails[type eq "work" and value ew "@acme.com"]`, `(LOWER('work') = $1 AND LOWER(u.email) LIKE $2)`, []interface{}{"work", "%@acme.com"}, false},
+		{"schema urn", `urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager.value eq "7"`, "u.manager_id::text = $1", []interface{}{"7"}, false},
+		{"null", `externalId eq null`, "u.external_id IS NULL", nil, false},
+		{"group membership", `groups.value eq "3"`, "EXISTS (SELECT 1 FROM scim_group_members gm WHERE gm.user_id = u.id AND gm.group_id::text = $1)", []interface{}{"3"}, false},
+		{"unknown attribute", `nickName eq "ada"`, "", nil, true},
+		{"bool with co", `active co "t"`, "", nil, true},
+		{"bad date", `meta.created gt "yesterday"`, "", nil, true},
+		{"trailing tokens", `userName eq "a" "b"`, "", nil, true},
+		{"unterminated string", `userName eq "a`, "", nil, true},
+		{"missing operator", `userName`, "", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &scimSQL{columns: scimUserColumns}
+			f, err := parseSCIMFilter(tt.filter)
+			var got string
+			if err == nil {
+				got, err = c.compile(f)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(c.args, tt.args) {
+				t.Errorf("args = %#v, want %#v", c.args, tt.args)
+			}
+		})
+	}
+}
+
+func TestApplyUserPatch(t *testing.T) {
+	manager := 9
+	tests := []struct {
+		name    string
+		ops     string
+		check   func(u *scimUserRecord) bool
+		wantErr bool
+	}{
+		{"deactivate", `[{"op":"replace","path":"active","value":false}]`,
+			func(u *scimUserRecord) bool { return !u.Active }, false},
+		{"azure string bool", `[{"op":"Replace","path":"active","value":"False"}]`,
+			func(u *scimUserRecord) bool { return !u.Active }, false},
+		{"object without path", `[{"op":"replace","value":{"active":false,"displayName":"Ada L"}}]`,
+			func(u *scimUserRecord) bool { return !u.Active && u.Name == "Ada L" }, false},
+		{"email value path", `[{"op":"replace","path":"emails[type eq \"work\"].value","value":"ada@new.com"}]`,
+			func(u *scimUserRecord) bool { return u.Email == "ada@new.com" }, false},
+		{"given name composes name", `[{"op":"replace","path":"name.givenName","value":"Augusta"}]`,
+			func(u *scimUserRecord) bool { return u.Name == "Augusta Lovelace" }, false},
+		{"enterprise manager", `[{"op":"add","path":"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:manager","value":{"value":"9"}}]`,
+			func(u *scimUserRecord) bool { return u.ManagerID != nil && *u.ManagerID == manager }, false},
+		{"remove manager", `[{"op":"remove","path":"manager"}]`,
+			func(u *scimUserRecord) bool { return u.ManagerID == nil }, false},
+		{"unknown attribute ignored", `[{"op":"add","path":"title","value":"Countess"}]`,
+			func(u *scimUserRecord) bool { return u.Email == "ada@example.com" }, false},
+		{"groups are read-only", `[{"op":"add","path":"groups","value":[{"value":"1"}]}]`, nil, true},
+		{"bad op", `[{"op":"move","path":"active","value":true}]`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &scimUserRecord{ID: 1, Email: "ada@example.com", Name: "Ada Lovelace",
+				GivenName: "Ada", FamilyName: "Lovelace", Active: true, ManagerID: &manager}
+			var ops []SCIMPatchOp
+			if err := json.Unmarshal([]byte(tt.ops), &ops); err != nil {
+				t.Fatal(err)
+			}
+			err := applyUserPatch(u, ops)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.check(u) {
+				t.Errorf("unexpected result: %+v", u)
+			}
+		})
+	}
+}
+
+func TestApplyGroupPatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		ops     string
+		want    []int
+		wantErr bool
+	}{
+		{"add members", `[{"op":"add","path":"members","value":[{"value":"3"},{"value":"1"}]}]`, []int{1, 2, 3}, false},
+		{"remove by filter", `[{"op":"remove","path":"members[value eq \"2\"]"}]`, []int{1}, false},
+		{"remove listed", `[{"op":"remove","path":"members","value":[{"value":"1"}]}]`, []int{2}, false},
+		{"remove all", `[{"op":"remove","path":"members"}]`, []int{}, false},
+		{"replace", `[{"op":"replace","path":"members","value":[{"value":"5"}]}]`, []int{5}, false},
+		{"rename", `[{"op":"replace","value":{"displayName":"Engineers"}}]`, []int{1, 2}, false},
+		{"bad member", `[{"op":"add","path":"members","value":[{"value":"ada"}]}]`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &scimGroupRecord{ID: 1, DisplayName: "Admins", Members: []scimMember{{UserID: 1}, {UserID: 2}}}
+			var ops []SCIMPatchOp
+			if err := json.Unmarshal([]byte(tt.ops), &ops); err != nil {
+				t.Fatal(err)
+			}
+			got, err := applyGroupPatch(g, ops)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("members = %v, want %v", got, tt.want)
+			}
+			seen := map[int]bool{}
+			for _, id := range got {
+				seen[id] = true
+			}
+			for _, id := range tt.want {
+				if !seen[id] {
+					t.Errorf("members = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSCIMMappedAccess(t *testing.T) {
+	cfg := SCIMConfig{DefaultRole: "user", RoleMappings: []SCIMRoleMapping{
+		{Group: "Admins", Role: "admin"},
+		{Group: "Engineers", Role: "engineer"},
+		{Group: "Project X", Role: "workspace_editor", Workspace: "project-x"},
+		{Group: "Engineers", Role: "viewer", Workspace: "project-x"},
+	}}
+
+	tests := []struct {
+		name       string
+		groups     []string
+		role       string
+		workspaces map[string]string
+	}{
+		{"no groups", nil, "user", map[string]string{}},
+		{"first match wins", []string{"engineers", "Admins"}, "admin", map[string]string{"project-x": "viewer"}},
+		{"workspace only", []string{"Project X", "Engineers"}, "engineer", map[string]string{"project-x": "workspace_editor"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role, workspaces := cfg.mappedAccess(tt.groups)
+			if role != tt.role {
+				t.Errorf("role = %q, want %q", role, tt.role)
+			}
+			if !reflect.DeepEqual(workspaces, tt.workspaces) {
+				t.Errorf("workspaces = %v, want %v", workspaces, tt.workspaces)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// API token scopes, written as <resource>:<action>
+const (
+	ScopeCapabilitiesRead     = "capabilities:read"
+	ScopeCapabilitiesWrite    = "capabilities:write"
+	ScopeApprovalsRead        = "approvals:read"
+	ScopeApprovalsWrite       = "approvals:write"
+	ScopeNotificationsRead    = "notifications:read"
+	ScopeNotificationsWrite   = "notifications:write"
+	ScopeNotificationsPublish = "notifications:publish"
+	ScopeSearchRead           = "search:read"
+	ScopeSearchWrite          = "search:write"
+	ScopeSpecificationsRead   = "specifications:read"
+	ScopeSpecificationsWrite  = "specifications:write"
+	ScopeAIGenerate           = "ai:generate"
+	ScopeUsersProvision       = "users:provision"
+	ScopeAdmin                = "admin"
+)
+
+// AllScopes lists every scope a token can be granted
+var AllScopes = []string{
+	ScopeCapabilitiesRead, ScopeCapabilitiesWrite,
+	ScopeApprovalsRead, ScopeApprovalsWrite,
+	ScopeNotificationsRead, ScopeNotificationsWrite, ScopeNotificationsPublish,
+	ScopeSearchRead, ScopeSearchWrite,
+	ScopeSpecificationsRead, ScopeSpecificationsWrite,
+	ScopeAIGenerate,
+	ScopeUsersProvision,
+	ScopeAdmin,
+}
+
+// ValidateScopes checks that scopes is non-empty and only contains known scopes
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		known := false
+		for _, s := range AllScopes {
+			if s == scope {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	return nil
+}
+
+// HasScope reports whether the token behind the claims grants scope. Session tokens carry no
+// scopes and act with the user's full access; a write scope implies read on the same resource.
+func (c *Claims) HasScope(scope string) bool {
+	if c.Scopes == nil || scope == "" {
+		return true
+	}
+	for _, granted := range c.Scopes {
+		if granted == scope || granted == ScopeAdmin {
+			return true
+		}
+		if resource, ok := strings.CutSuffix(scope, ":read"); ok && granted == resource+":write" {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAPIToken reports whether the claims came from a personal access token
+func (c *Claims) IsAPIToken() bool {
+	return c.TokenID != 0
+}
+
+// capability-service resources by first path segment
+var resourceScopes = map[string][2]string{
+	"capabilities":         {ScopeCapabilitiesRead, ScopeCapabilitiesWrite},
+	"enablers":             {ScopeCapabilitiesRead, ScopeCapabilitiesWrite},
+	"requirements":         {ScopeCapabilitiesRead, ScopeCapabilitiesWrite},
+	"criteria":             {ScopeCapabilitiesRead, ScopeCapabilitiesWrite},
+	"approvals":            {ScopeApprovalsRead, ScopeApprovalsWrite},
+	"approval-permissions": {ScopeApprovalsRead, ScopeApprovalsWrite},
+	"stage-gates":          {ScopeApprovalsRead, ScopeApprovalsWrite},
+	"notifications":        {ScopeNotificationsRead, ScopeNotificationsWrite},
+	"search":               {ScopeSearchRead, ScopeSearchWrite},
+}
+
+// integration-service endpoints that run an AI model
+var aiEndpoints = map[string]bool{
+	"/analyze-integration":             true,
+	"/suggest-resources":               true,
+	"/specifications/analyze":          true,
+	"/specifications/generate-diagram": true,
+	"/analyze-application":             true,
+	"/analyze-storyboard":              true,
+	"/analyze-capabilities":            true,
+	"/ai-chat":                         true,
+	"/generate-code":                   true,
+	"/generate-code-cli":               true,
+}
+
+// IsAIEndpoint reports whether an integration-service endpoint runs an AI model
+func IsAIEndpoint(path string) bool {
+	return aiEndpoints["/"+strings.Trim(path, "/")]
+}
+
+// ScopeForRequest returns the scope an API token needs to call an endpoint of the capability
+// or integration service
+func ScopeForRequest(method, path string) string {
+	path = "/" + strings.Trim(path, "/")
+	if path == "/health" {
+		return ""
+	}
+
+	// Jobs are the AI endpoints' runs, so following or cancelling one needs the same scope
+	if aiEndpoints[path] || path == "/jobs" || strings.HasPrefix(path, "/jobs/") {
+		return ScopeAIGenerate
+	}
+
+	// AI conversations can be read like specs, e.g. by reviewers; changing them is AI work
+	if path == "/conversations" || strings.HasPrefix(path, "/conversations/") {
+		if method == http.MethodGet || method == http.MethodHead {
+			return ScopeSpecificationsRead
+		}
+		return ScopeAIGenerate
+	}
+
+	// AI spend and cache savings are visible to those who can run AI; budgets are set and
+	// the cache cleared by admins
+	if path == "/ai-usage" || path == "/ai-cache" || path == "/ai-budgets" || strings.HasPrefix(path, "/ai-budgets/") {
+		if method == http.MethodGet || method == http.MethodHead {
+			return ScopeAIGenerate
+		}
+		return ScopeAdmin
+	}
+
+	// Reviewing AI changes held for review is approval work
+	if path == "/ai-audit" || strings.HasPrefix(path, "/ai-audit/") {
+		if method == http.MethodGet || method == http.MethodHead {
+			return ScopeApprovalsRead
+		}
+		return ScopeApprovalsWrite
+	}
+
+	// Prompt templates are read like specs; a new version changes every AI call using it
+	if path == "/prompts" || strings.HasPrefix(path, "/prompts/") {
+		if method == http.MethodGet || method == http.MethodHead {
+			return ScopeSpecificationsRead
+		}
+		return ScopeAdmin
+	}
+
+	// Events name their recipients, so only services and admins may raise them
+	if path == "/notifications/events" && method != http.MethodGet && method != http.MethodHead {
+		return ScopeNotificationsPublish
+	}
+
+	segment, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if scopes, ok := resourceScopes[segment]; ok {
+		if method == http.MethodGet || method == http.MethodHead {
+			return scopes[0]
+		}
+		return scopes[1]
+	}
+
+	// The integration service lists and reads workspace files through POST endpoints
+	base := path[strings.LastIndex(path, "/")+1:]
+	if method == http.MethodGet || strings.HasSuffix(base, "-files") ||
+		strings.HasPrefix(base, "read-") || strings.HasPrefix(base, "fetch-") {
+		return ScopeSpecificationsRead
+	}
+	return ScopeSpecificationsWrite
+}
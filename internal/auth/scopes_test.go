@@ -0,0 +1,106 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package auth
+
+import "testing"
+
+func TestScopeForRequest(t *testing.T) {
+	tests := []struct {
+		method   string
+		path     string
+		expected string
+	}{
+		{"GET", "/health", ""},
+		{"GET", "/capabilities", ScopeCapabilitiesRead},
+		{"POST", "/capabilities/12/criteria", ScopeCapabilitiesWrite},
+		{"POST", "/criteria/4/verify", ScopeCapabilitiesWrite},
+		{"GET", "/approvals/pending", ScopeApprovalsRead},
+		{"POST", "/approvals/request", ScopeApprovalsWrite},
+		{"POST", "/notifications/read-all", ScopeNotificationsWrite},
+		{"POST", "/notifications/events", ScopeNotificationsPublish},
+		{"PUT", "/stage-gates/3", ScopeApprovalsWrite},
+		{"GET", "/search", ScopeSearchRead},
+		{"GET", "/search/semantic", ScopeSearchRead},
+		{"POST", "/search/reindex-workspace", ScopeSearchWrite},
+		{"POST", "/ai-chat", ScopeAIGenerate},
+		{"POST", "/generate-code-cli", ScopeAIGenerate},
+		{"POST", "/specifications/analyze", ScopeAIGenerate},
+		{"GET", "/jobs", ScopeAIGenerate},
+		{"POST", "/jobs/7/cancel", ScopeAIGenerate},
+		{"GET", "/conversations", ScopeSpecificationsRead},
+		{"GET", "/conversations/3", ScopeSpecificationsRead},
+		{"POST", "/conversations", ScopeAIGenerate},
+		{"POST", "/conversations/3/fork", ScopeAIGenerate},
+		{"DELETE", "/conversations/3", ScopeAIGenerate},
+		{"GET", "/ai-usage", ScopeAIGenerate},
+		{"GET", "/ai-budgets", ScopeAIGenerate},
+		{"PUT", "/ai-budgets", ScopeAdmin},
+		{"DELETE", "/ai-budgets/2", ScopeAdmin},
+		{"GET", "/ai-cache", ScopeAIGenerate},
+		{"DELETE", "/ai-cache", ScopeAdmin},
+		{"GET", "/ai-audit", ScopeApprovalsRead},
+		{"POST", "/ai-audit/4/review", ScopeApprovalsWrite},
+		{"GET", "/ai-governance", ScopeSpecificationsRead},
+		{"GET", "/prompts", ScopeSpecificationsRead},
+		{"GET", "/prompts/chat-system", ScopeSpecificationsRead},
+		{"POST", "/prompts/chat-system/versions", ScopeAdmin},
+		{"GET", "/specifications/list", ScopeSpecificationsRead},
+		{"POST", "/capability-files", ScopeSpecificationsRead},
+		{"POST", "/read-specification", ScopeSpecificationsRead},
+		{"POST", "/save-capability", ScopeSpecificationsWrite},
+		{"POST", "/folders/create", ScopeSpecificationsWrite},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			if got := ScopeForRequest(tt.method, tt.path); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestClaimsHasScope(t *testing.T) {
+	tests := []struct {
+		name     string
+		scopes   []string
+		scope    string
+		expected bool
+	}{
+		{"session token", nil, ScopeAIGenerate, true},
+		{"exact scope", []string{ScopeApprovalsWrite}, ScopeApprovalsWrite, true},
+		{"write implies read", []string{ScopeCapabilitiesWrite}, ScopeCapabilitiesRead, true},
+		{"read does not imply write", []string{ScopeCapabilitiesRead}, ScopeCapabilitiesWrite, false},
+		{"other resource", []string{ScopeApprovalsWrite}, ScopeCapabilitiesRead, false},
+		{"admin grants all", []string{ScopeAdmin}, ScopeAIGenerate, true},
+		{"token without scopes", []string{}, ScopeSearchRead, false},
+		{"public endpoint", []string{}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := &Claims{Scopes: tt.scopes}
+			if got := claims.HasScope(tt.scope); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestValidateScopes(t *testing.T) {
+	if err := ValidateScopes([]string{ScopeCapabilitiesRead, ScopeAIGenerate}); err != nil {
+		t.Errorf("expected known scopes to validate, got %v", err)
+	}
+	if err := ValidateScopes(nil); err == nil {
+		t.Error("expected an error for no scopes")
+	}
+	if err := ValidateScopes([]string{"capabilities:delete"}); err == nil {
+		t.Error("expected an error for an unknown scope")
+	}
+}
@@ -0,0 +1,348 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ForgotPasswordRequest asks for a password reset email
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest sets a new password with an emailed token
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// MFACodeRequest carries a TOTP or recovery code, and the MFA token during login
+type MFACodeRequest struct {
+	MFAToken string `json:"mfaToken,omitempty"`
+	Code     string `json:"code"`
+}
+
+// respondLoginError maps lockout, throttling and MFA errors shared by the login steps
+func respondLoginError(w http.ResponseWriter, action string, err error) {
+	var locked *AccountLockedError
+	switch {
+	case errors.As(err, &locked):
+		retry := int(math.Ceil(time.Until(locked.Until).Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(retry))
+		respondError(w, http.StatusTooManyRequests, "Account is temporarily locked after repeated failed logins. Try again later or reset your password.")
+	case err == ErrTooManyAttempts:
+		respondError(w, http.StatusTooManyRequests, "Too many failed login attempts. Try again later.")
+	case err == ErrInvalidMFAToken:
+		respondError(w, http.StatusUnauthorized, "MFA session expired, please sign in again")
+	case err == ErrInvalidMFACode:
+		respondError(w, http.StatusUnauthorized, "Invalid authentication code")
+	case err == ErrMFANotPending:
+		respondError(w, http.StatusBadRequest, "Start MFA setup first")
+	case err == ErrMFANotEnabled:
+		respondError(w, http.StatusBadRequest, "MFA is not enabled")
+	case err == ErrMFAAlreadyEnabled:
+		respondError(w, http.StatusConflict, "MFA is already enabled")
+	case err == ErrMFARequiredByRole:
+		respondError(w, http.StatusForbidden, "MFA is required for your role and cannot be turned off")
+	default:
+		log.Printf("%s error: %v", action, err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
+// respondPasswordError reports policy violations as bad requests
+func respondPasswordError(w http.ResponseWriter, err error) bool {
+	var policyErr *PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		respondError(w, http.StatusBadRequest, strings.ToUpper(policyErr.Error()[:1])+policyErr.Error()[1:])
+		return true
+	}
+	return false
+}
+
+// GetPasswordPolicy returns the rules new passwords must follow
+func (h *Handler) GetPasswordPolicy(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, h.service.PasswordPolicy())
+}
+
+// ForgotPassword emails a password reset link. The response is the same whether or
+// not the account exists.
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		respondError(w, http.StatusBadRequest, "Email is required")
+		return
+	}
+	if !h.service.MailerConfigured() {
+		respondError(w, http.StatusServiceUnavailable, "Password reset email is not configured")
+		return
+	}
+
+	if err := h.service.RequestPasswordReset(r.Context(), req.Email, h.service.ClientInfo(r)); err != nil {
+		log.Printf("Password reset error: %v", err)
+	}
+
+	respondJSON(w, http.StatusAccepted, map[string]string{
+		"message": "If an account exists for this email, a reset link has been sent",
+	})
+}
+
+// ResetPassword sets a new password using an emailed token
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Token == "" || req.Password == "" {
+		respondError(w, http.StatusBadRequest, "Token and password are required")
+		return
+	}
+
+	err := h.service.ResetPassword(req.Token, req.Password, h.service.ClientInfo(r))
+	if err == ErrInvalidResetToken {
+		respondError(w, http.StatusBadRequest, "Reset link is invalid or has expired")
+		return
+	}
+	if respondPasswordError(w, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Reset password error: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// VerifyMFA completes a login with a TOTP or recovery code
+func (h *Handler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.MFAToken == "" || req.Code == "" {
+		respondError(w, http.StatusBadRequest, "MFA token and code are required")
+		return
+	}
+
+	resp, err := h.service.VerifyMFALogin(req.MFAToken, req.Code, h.service.ClientInfo(r))
+	if err != nil {
+		respondLoginError(w, "Verify MFA", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// mfaSetupUser identifies who is enrolling: a signed-in user, or a user whose login
+// is waiting on enrollment because their role requires MFA
+func (h *Handler) mfaSetupUser(r *http.Request, mfaToken string) (int, error) {
+	if mfaToken != "" {
+		return h.service.MFAChallengeUser(mfaToken)
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return 0, ErrUnauthorized
+	}
+	claims, err := h.service.VerifyToken(token)
+	// Personal access tokens cannot change how their owner signs in
+	if err != nil || claims.SessionID == "" {
+		return 0, ErrUnauthorized
+	}
+	return claims.UserID, nil
+}
+
+// SetupMFA creates a TOTP secret for the caller's authenticator app
+func (h *Handler) SetupMFA(w http.ResponseWriter, r *http.Request) {
+	var req MFACodeRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	userID, err := h.mfaSetupUser(r, req.MFAToken)
+	if err == ErrUnauthorized {
+		respondError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	if err != nil {
+		respondLoginError(w, "Setup MFA", err)
+		return
+	}
+
+	setup, err := h.service.BeginMFAEnrollment(userID)
+	if err != nil {
+		respondLoginError(w, "Setup MFA", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, setup)
+}
+
+// EnableMFA confirms enrollment with a code from the app and returns recovery codes.
+// During a login that required enrollment, the response also carries the new session.
+func (h *Handler) EnableMFA(w http.ResponseWriter, r *http.Request) {
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Code == "" {
+		respondError(w, http.StatusBadRequest, "Code is required")
+		return
+	}
+	client := h.service.ClientInfo(r)
+
+	if req.MFAToken != "" {
+		resp, err := h.service.CompleteMFAEnrollment(req.MFAToken, req.Code, client)
+		if err != nil {
+			respondLoginError(w, "Enable MFA", err)
+			return
+		}
+		respondJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	userID, err := h.mfaSetupUser(r, "")
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	codes, err := h.service.ConfirmMFAEnrollment(userID, req.Code, client)
+	if err != nil {
+		respondLoginError(w, "Enable MFA", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, MFAEnableResponse{RecoveryCodes: codes})
+}
+
+// GetMFAStatus returns the caller's MFA status
+func (h *Handler) GetMFAStatus(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	status, err := h.service.GetMFAStatus(claims.UserID)
+	if err != nil {
+		respondLoginError(w, "Get MFA status", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, status)
+}
+
+// DisableMFA turns off the caller's second factor
+func (h *Handler) DisableMFA(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		respondError(w, http.StatusBadRequest, "Code is required")
+		return
+	}
+
+	if err := h.service.DisableMFA(claims.UserID, req.Code, h.service.ClientInfo(r)); err != nil {
+		respondLoginError(w, "Disable MFA", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces the caller's recovery codes
+func (h *Handler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	var req MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		respondError(w, http.StatusBadRequest, "Code is required")
+		return
+	}
+
+	codes, err := h.service.RegenerateRecoveryCodes(claims.UserID, req.Code, h.service.ClientInfo(r))
+	if err != nil {
+		respondLoginError(w, "Regenerate recovery codes", err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, MFAEnableResponse{RecoveryCodes: codes})
+}
+
+// ResetUserMFA removes a user's second factor so they can enroll again (admin only)
+func (h *Handler) ResetUserMFA(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	err = h.service.ResetMFA(id, claims.UserID, h.service.ClientInfo(r))
+	if err == ErrUserNotFound {
+		respondError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Reset MFA error: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnlockUser lifts a lockout caused by failed logins (admin only)
+func (h *Handler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	err = h.service.UnlockUser(id)
+	if err == ErrUserNotFound {
+		respondError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Unlock user error: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListAuthEvents returns the authentication audit log, optionally filtered by userId (admin only)
+func (h *Handler) ListAuthEvents(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(r.URL.Query().Get("userId"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	events, err := h.service.ListAuthEvents(userID, limit)
+	if err != nil {
+		log.Printf("List auth events error: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, events)
+}
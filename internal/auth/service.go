@@ -12,9 +12,13 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"log"
+	"net"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/jareynolds/ubecode/pkg/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -28,31 +32,63 @@ var (
 
 // Service handles authentication operations
 type Service struct {
-	db        *sql.DB
-	jwtSecret []byte
+	db             *sql.DB
+	jwtSecret      []byte
+	accessTTL      time.Duration
+	refreshTTL     time.Duration
+	passwordPolicy PasswordPolicy
+	lockout        LockoutPolicy
+	resetTTL       time.Duration
+	mailer         Mailer
+	appBaseURL     string
+	mfaKey         []byte
+	scim           SCIMConfig
+	approvals      *repository.ApprovalRepository
+	trustedProxies []*net.IPNet
 }
 
 // NewService creates a new auth service
 func NewService(db *sql.DB, jwtSecret string) *Service {
-	return &Service{
-		db:        db,
-		jwtSecret: []byte(jwtSecret),
-	}
+	s := &Service{
+		db:             db,
+		jwtSecret:      []byte(jwtSecret),
+		accessTTL:      DefaultAccessTokenTTL,
+		refreshTTL:     DefaultRefreshTokenTTL,
+		passwordPolicy: DefaultPasswordPolicy,
+		lockout:        DefaultLockoutPolicy,
+		resetTTL:       DefaultPasswordResetTTL,
+		scim:           SCIMConfig{DefaultRole: "user"},
+	}
+	s.SetMFAEncryptionKey("mfa:" + jwtSecret)
+	return s
 }
 
 // Claims represents JWT claims
 type Claims struct {
-	UserID int    `json:"userId"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
+	UserID    int    `json:"userId"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid"`
+	// Set only for personal access tokens
+	Scopes  []string `json:"scopes,omitempty"`
+	TokenID int      `json:"-"`
+	// MFA is set when the session was started with a second factor
+	MFA bool `json:"mfa,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// Authenticate authenticates a user and returns a JWT token
-func (s *Service) Authenticate(email, password string) (*LoginResponse, error) {
+// Authenticate checks a user's password. It returns a session, or an MFA challenge when
+// the user must still present (or enroll) a second factor. Repeated failures lock the
+// account progressively and are recorded in the audit log.
+func (s *Service) Authenticate(email, password string, client ClientInfo) (*LoginResponse, *MFAChallengeResponse, error) {
+	if err := s.checkAddressThrottle(client); err != nil {
+		return nil, nil, err
+	}
+
 	var user User
+	var lockedUntil *time.Time
 	err := s.db.QueryRow(`
-		SELECT id, email, password_hash, name, role, created_at, updated_at, last_login, is_active
+		SELECT id, email, password_hash, name, role, created_at, updated_at, last_login, is_active, locked_until
 		FROM users
 		WHERE email = $1 AND is_active = true
 	`, email).Scan(
@@ -65,58 +101,107 @@ func (s *Service) Authenticate(email, password string) (*LoginResponse, error) {
 		&user.UpdatedAt,
 		&user.LastLogin,
 		&user.IsActive,
+		&lockedUntil,
 	)
 
 	if err == sql.ErrNoRows {
-		return nil, ErrInvalidCredentials
+		s.recordAuthEvent(0, email, EventLoginFailed, client, map[string]interface{}{"reason": "unknown_user"})
+		return nil, nil, ErrInvalidCredentials
 	}
 	if err != nil {
-		return nil, fmt.Errorf("database error: %w", err)
+		return nil, nil, fmt.Errorf("database error: %w", err)
+	}
+
+	// A locked account is rejected before the password is checked, so guessing stops paying off
+	if lockedUntil != nil && time.Now().Before(*lockedUntil) {
+		s.recordAuthEvent(user.ID, email, EventLoginFailed, client, map[string]interface{}{"reason": "locked"})
+		return nil, nil, &AccountLockedError{Until: *lockedUntil}
 	}
 
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return nil, ErrInvalidCredentials
+		s.registerFailedLogin(user.ID, email, EventLoginFailed, client, "bad_password")
+		return nil, nil, ErrInvalidCredentials
 	}
 
-	// Update last login
-	_, err = s.db.Exec("UPDATE users SET last_login = $1 WHERE id = $2", time.Now(), user.ID)
-	if err != nil {
-		// Log error but don't fail authentication
-		fmt.Printf("Warning: failed to update last login: %v\n", err)
+	return s.beginLogin(&user, client, false, "password")
+}
+
+// beginLogin starts a session for a user who passed the first factor, or returns an MFA
+// challenge when the user has MFA enabled or their role requires it. mfaVerified is set
+// when the identity provider already performed a second factor.
+func (s *Service) beginLogin(user *User, client ClientInfo, mfaVerified bool, method string) (*LoginResponse, *MFAChallengeResponse, error) {
+	if !mfaVerified {
+		status, err := s.GetMFAStatus(user.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if status.Enabled {
+			challenge, err := s.createMFAChallenge(user.ID, mfaPurposeVerify)
+			return nil, challenge, err
+		}
+		if status.Required {
+			challenge, err := s.createMFAChallenge(user.ID, mfaPurposeEnroll)
+			return nil, challenge, err
+		}
 	}
 
-	// Generate JWT token
-	token, err := s.GenerateToken(&user)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate token: %w", err)
+	resp, err := s.finishLogin(user, client, mfaVerified, method)
+	return resp, nil, err
+}
+
+// finishLogin resets the failure counter, records the login and starts the session
+func (s *Service) finishLogin(user *User, client ClientInfo, mfaVerified bool, method string) (*LoginResponse, error) {
+	if _, err := s.db.Exec(`UPDATE users SET failed_login_count = 0, locked_until = NULL WHERE id = $1`, user.ID); err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if err := s.UpdateLastLogin(user.ID); err != nil {
+		// Log error but don't fail authentication
+		log.Printf("Warning: %v", err)
 	}
+	s.recordAuthEvent(user.ID, user.Email, EventLoginSucceeded, client, map[string]interface{}{"method": method, "mfa": mfaVerified})
 
-	return &LoginResponse{
-		Token: token,
-		User:  user,
-	}, nil
+	return s.startSession(user, client, mfaVerified)
 }
 
-// GenerateToken generates a JWT token for a user
-func (s *Service) GenerateToken(user *User) (string, error) {
+// GenerateToken generates a short-lived JWT access token bound to a session
+func (s *Service) GenerateToken(user *User, sessionID string, mfa bool) (string, time.Time, error) {
+	jti, err := newOpaqueToken(16)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(s.accessTTL)
 	claims := &Claims{
-		UserID: user.ID,
-		Email:  user.Email,
-		Role:   user.Role,
+		UserID:    user.ID,
+		Email:     user.Email,
+		Role:      user.Role,
+		SessionID: sessionID,
+		MFA:       mfa,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.jwtSecret)
+	signed, err := token.SignedString(s.jwtSecret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
 }
 
-// VerifyToken verifies a JWT token and returns the claims
+// VerifyToken verifies a JWT or personal access token and returns the claims. Tokens of
+// revoked sessions, revoked tokens and tokens of deactivated users are rejected.
 func (s *Service) VerifyToken(tokenString string) (*Claims, error) {
+	if strings.HasPrefix(tokenString, APITokenPrefix) {
+		return s.verifyAPIToken(tokenString)
+	}
+
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
@@ -128,11 +213,16 @@ func (s *Service) VerifyToken(tokenString string) (*Claims, error) {
 		return nil, ErrInvalidToken
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	if err := s.checkRevocation(claims); err != nil {
+		return nil, err
 	}
 
-	return nil, ErrInvalidToken
+	return claims, nil
 }
 
 // GetUserByID retrieves a user by ID
@@ -200,6 +290,10 @@ func (s *Service) ListUsers() ([]User, error) {
 
 // CreateUser creates a new user (admin only)
 func (s *Service) CreateUser(req *CreateUserRequest) (*User, error) {
+	if err := s.passwordPolicy.Validate(req.Password, req.Email); err != nil {
+		return nil, err
+	}
+
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -214,8 +308,8 @@ func (s *Service) CreateUser(req *CreateUserRequest) (*User, error) {
 
 	var user User
 	err = s.db.QueryRow(`
-		INSERT INTO users (email, password_hash, name, role, is_active)
-		VALUES ($1, $2, $3, $4, true)
+		INSERT INTO users (email, password_hash, name, role, is_active, password_changed_at)
+		VALUES ($1, $2, $3, $4, true, CURRENT_TIMESTAMP)
 		RETURNING id, email, name, role, created_at, updated_at, last_login, is_active
 	`, req.Email, hashedPassword, req.Name, role).Scan(
 		&user.ID,
@@ -240,6 +334,18 @@ func (s *Service) CreateUser(req *CreateUserRequest) (*User, error) {
 
 // UpdateUser updates a user (admin only)
 func (s *Service) UpdateUser(id int, req *UpdateUserRequest) (*User, error) {
+	if req.Password != nil {
+		email := ""
+		if req.Email != nil {
+			email = *req.Email
+		} else if existing, err := s.GetUserByID(id); err == nil {
+			email = existing.Email
+		}
+		if err := s.passwordPolicy.Validate(*req.Password, email); err != nil {
+			return nil, err
+		}
+	}
+
 	// Build dynamic update query
 	query := "UPDATE users SET updated_at = CURRENT_TIMESTAMP"
 	args := []interface{}{}
@@ -270,7 +376,8 @@ func (s *Service) UpdateUser(id int, req *UpdateUserRequest) (*User, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to hash password: %w", err)
 		}
-		query += fmt.Sprintf(", password_hash = $%d", argCount)
+		// A new password also lifts any lockout
+		query += fmt.Sprintf(", password_hash = $%d, password_changed_at = CURRENT_TIMESTAMP, failed_login_count = 0, locked_until = NULL", argCount)
 		args = append(args, hashedPassword)
 		argCount++
 	}
@@ -297,6 +404,14 @@ func (s *Service) UpdateUser(id int, req *UpdateUserRequest) (*User, error) {
 		return nil, fmt.Errorf("database error: %w", err)
 	}
 
+	// Deactivated users lose access immediately, not when their tokens expire, and their
+	// pending approvals move to their manager
+	if req.IsActive != nil && !*req.IsActive {
+		if err := s.deprovisionUser(id, "user_deactivated", ClientInfo{}); err != nil {
+			return nil, err
+		}
+	}
+
 	return &user, nil
 }
 
@@ -348,18 +463,23 @@ func (s *Service) GetUserByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
-// CreateOAuthUser creates a new user from OAuth provider
+// CreateOAuthUser creates a new user from an OAuth or SSO provider and links the
+// provider identity to it
 func (s *Service) CreateOAuthUser(req *CreateUserRequest, provider, providerID string) (*User, error) {
-	// For OAuth users, we don't store a password hash
-	// Instead we store the provider and provider ID
-
+	// OAuth users have no password; they sign in through the provider
 	role := req.Role
 	if role == "" {
 		role = "product_owner"
 	}
 
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	defer tx.Rollback()
+
 	var user User
-	err := s.db.QueryRow(`
+	err = tx.QueryRow(`
 		INSERT INTO users (email, password_hash, name, role, is_active)
 		VALUES ($1, '', $2, $3, true)
 		RETURNING id, email, name, role, created_at, updated_at, last_login, is_active
@@ -381,6 +501,14 @@ func (s *Service) CreateOAuthUser(req *CreateUserRequest, provider, providerID s
 		return nil, fmt.Errorf("database error: %w", err)
 	}
 
+	identity := &SSOIdentity{Provider: provider, Subject: providerID, Email: req.Email}
+	if err := linkIdentity(tx, user.ID, identity); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
 	return &user, nil
 }
 
@@ -392,13 +520,3 @@ func (s *Service) UpdateLastLogin(userID int) error {
 	}
 	return nil
 }
-
-// GenerateTokenFromCredentials generates a JWT token from user credentials
-func (s *Service) GenerateTokenFromCredentials(userID int, email, role string) (string, error) {
-	user := &User{
-		ID:    userID,
-		Email: email,
-		Role:  role,
-	}
-	return s.GenerateToken(user)
-}
@@ -0,0 +1,461 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Default token lifetimes
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var (
+	ErrSessionRevoked     = errors.New("session has been revoked")
+	ErrRefreshTokenReused = errors.New("refresh token has already been used")
+	ErrSessionNotFound    = errors.New("session not found")
+)
+
+// SetTokenLifetimes overrides the access and refresh token lifetimes
+func (s *Service) SetTokenLifetimes(access, refresh time.Duration) {
+	if access > 0 {
+		s.accessTTL = access
+	}
+	if refresh > 0 {
+		s.refreshTTL = refresh
+	}
+}
+
+// newOpaqueToken returns a random URL-safe token of n bytes of entropy
+func newOpaqueToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is how refresh tokens are stored; they are high-entropy, so a fast hash suffices
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseTrustedProxies parses a comma-separated list of proxy addresses, each an IP or a
+// CIDR range
+func ParseTrustedProxies(list string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// SetTrustedProxies sets the proxies whose X-Forwarded-For and X-Real-IP headers are
+// believed. Headers from any other peer are ignored.
+func (s *Service) SetTrustedProxies(proxies []*net.IPNet) {
+	s.trustedProxies = proxies
+}
+
+func (s *Service) trustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range s.trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientInfo extracts the user agent and client IP of a request. Proxy headers are only
+// honoured when the peer is a trusted proxy, as anyone else can set them; the client is
+// then the nearest address in X-Forwarded-For that is not itself a trusted proxy.
+func (s *Service) ClientInfo(r *http.Request) ClientInfo {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+	if s.trustedProxy(ip) {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			hops := strings.Split(forwarded, ",")
+			for i := len(hops) - 1; i >= 0; i-- {
+				ip = strings.TrimSpace(hops[i])
+				if !s.trustedProxy(ip) {
+					break
+				}
+			}
+		} else if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+			ip = strings.TrimSpace(realIP)
+		}
+	}
+
+	return ClientInfo{
+		UserAgent: r.UserAgent(),
+		IPAddress: ip,
+	}
+}
+
+// DescribeDevice turns a user agent into a short label such as "Chrome on macOS"
+func DescribeDevice(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+	ua := strings.ToLower(userAgent)
+
+	client := "Unknown client"
+	switch {
+	case strings.Contains(ua, "curl/"):
+		client = "curl"
+	case strings.Contains(ua, "go-http-client"):
+		client = "Go client"
+	case strings.Contains(ua, "edg/"):
+		client = "Edge"
+	case strings.Contains(ua, "chrome/") && !strings.Contains(ua, "chromium"):
+		client = "Chrome"
+	case strings.Contains(ua, "firefox/"):
+		client = "Firefox"
+	case strings.Contains(ua, "safari/"):
+		client = "Safari"
+	}
+
+	os := ""
+	switch {
+	case strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad"):
+		os = "iOS"
+	case strings.Contains(ua, "android"):
+		os = "Android"
+	case strings.Contains(ua, "mac os x") || strings.Contains(ua, "macintosh"):
+		os = "macOS"
+	case strings.Contains(ua, "windows"):
+		os = "Windows"
+	case strings.Contains(ua, "linux"):
+		os = "Linux"
+	}
+
+	if os == "" {
+		return client
+	}
+	return client + " on " + os
+}
+
+// StartSession creates a session for a user and issues its first token pair
+func (s *Service) StartSession(user *User, client ClientInfo) (*LoginResponse, error) {
+	return s.startSession(user, client, false)
+}
+
+// startSession creates a session, recording whether it was started with a second factor
+func (s *Service) startSession(user *User, client ClientInfo, mfaVerified bool) (*LoginResponse, error) {
+	sessionID, err := newOpaqueToken(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate session id: %w", err)
+	}
+	refreshToken, err := newOpaqueToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO sessions (session_id, user_id, token_hash, user_agent, ip_address, expires_at, is_active, last_used_at, mfa_verified)
+		VALUES ($1, $2, $3, $4, $5, $6, true, CURRENT_TIMESTAMP, $7)
+	`, sessionID, user.ID, hashToken(refreshToken), client.UserAgent, client.IPAddress, time.Now().Add(s.refreshTTL), mfaVerified)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	token, expiresAt, err := s.GenerateToken(user, sessionID, mfaVerified)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	return &LoginResponse{
+		Token:        token,
+		ExpiresAt:    expiresAt,
+		RefreshToken: refreshToken,
+		SessionID:    sessionID,
+		User:         *user,
+	}, nil
+}
+
+// Refresh rotates a refresh token and issues a new access token. Presenting a refresh token
+// that was already rotated out means it leaked, so the whole session is revoked.
+func (s *Service) Refresh(refreshToken string, client ClientInfo) (*LoginResponse, error) {
+	tokenHash := hashToken(refreshToken)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	defer tx.Rollback()
+
+	var sessionID string
+	var expiresAt time.Time
+	var mfaVerified bool
+	var user User
+	err = tx.QueryRow(`
+		SELECT s.session_id, s.expires_at, s.mfa_verified,
+		       u.id, u.email, u.name, u.role, u.created_at, u.updated_at, u.last_login, u.is_active
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.token_hash = $1 AND s.is_active = true
+		FOR UPDATE OF s
+	`, tokenHash).Scan(
+		&sessionID, &expiresAt, &mfaVerified,
+		&user.ID, &user.Email, &user.Name, &user.Role, &user.CreatedAt, &user.UpdatedAt, &user.LastLogin, &user.IsActive,
+	)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return nil, s.checkRefreshReuse(tokenHash)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if !user.IsActive {
+		return nil, ErrSessionRevoked
+	}
+	if time.Now().After(expiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	newRefreshToken, err := newOpaqueToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE sessions
+		SET token_hash = $1, previous_token_hash = $2, last_used_at = CURRENT_TIMESTAMP,
+		    user_agent = COALESCE(NULLIF($3, ''), user_agent), ip_address = COALESCE(NULLIF($4, ''), ip_address)
+		WHERE session_id = $5
+	`, hashToken(newRefreshToken), tokenHash, client.UserAgent, client.IPAddress, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	token, tokenExpiresAt, err := s.GenerateToken(&user, sessionID, mfaVerified)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	return &LoginResponse{
+		Token:        token,
+		ExpiresAt:    tokenExpiresAt,
+		RefreshToken: newRefreshToken,
+		SessionID:    sessionID,
+		User:         user,
+	}, nil
+}
+
+// checkRefreshReuse revokes the session an already-rotated refresh token belonged to
+func (s *Service) checkRefreshReuse(tokenHash string) error {
+	result, err := s.db.Exec(`
+		UPDATE sessions
+		SET is_active = false, revoked_at = CURRENT_TIMESTAMP, revoked_reason = 'refresh_token_reuse'
+		WHERE previous_token_hash = $1 AND is_active = true
+	`, tokenHash)
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows > 0 {
+		return ErrRefreshTokenReused
+	}
+	return ErrInvalidToken
+}
+
+// checkRevocation rejects tokens whose jti was revoked, whose session has ended, or whose
+// user has been deactivated
+func (s *Service) checkRevocation(claims *Claims) error {
+	if claims.SessionID == "" || claims.ID == "" {
+		return ErrInvalidToken
+	}
+
+	var sessionActive, userActive, tokenRevoked bool
+	err := s.db.QueryRow(`
+		SELECT s.is_active AND s.expires_at > CURRENT_TIMESTAMP,
+		       u.is_active,
+		       EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $2)
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.session_id = $1 AND s.user_id = $3
+	`, claims.SessionID, claims.ID, claims.UserID).Scan(&sessionActive, &userActive, &tokenRevoked)
+	if err == sql.ErrNoRows {
+		return ErrSessionRevoked
+	}
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+
+	if !sessionActive || !userActive || tokenRevoked {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+// Logout ends the session behind an access token and revokes the token itself
+func (s *Service) Logout(claims *Claims) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE sessions
+		SET is_active = false, revoked_at = CURRENT_TIMESTAMP, revoked_reason = 'logout'
+		WHERE session_id = $1 AND is_active = true
+	`, claims.SessionID)
+	if err != nil {
+		return fmt.Errorf("failed to end session: %w", err)
+	}
+
+	if err := revokeJTI(tx, claims); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func revokeJTI(tx *sql.Tx, claims *Claims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+	_, err := tx.Exec(`
+		INSERT INTO revoked_tokens (jti, user_id, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (jti) DO NOTHING
+	`, claims.ID, claims.UserID, claims.ExpiresAt.Time)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	return nil
+}
+
+// RevokeAllSessions ends every active session of a user and returns how many were ended.
+// Their access tokens stop working immediately.
+func (s *Service) RevokeAllSessions(userID int, reason string) (int, error) {
+	result, err := s.db.Exec(`
+		UPDATE sessions
+		SET is_active = false, revoked_at = CURRENT_TIMESTAMP, revoked_reason = $2
+		WHERE user_id = $1 AND is_active = true
+	`, userID, reason)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	return int(rows), nil
+}
+
+// RevokeSession ends one session belonging to a user
+func (s *Service) RevokeSession(userID int, sessionID string) error {
+	result, err := s.db.Exec(`
+		UPDATE sessions
+		SET is_active = false, revoked_at = CURRENT_TIMESTAMP, revoked_reason = 'revoked'
+		WHERE session_id = $1 AND user_id = $2 AND is_active = true
+	`, sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// ListSessions returns a user's active sessions, newest activity first. currentSessionID
+// marks the caller's own session.
+func (s *Service) ListSessions(userID int, currentSessionID string) ([]Session, error) {
+	rows, err := s.db.Query(`
+		SELECT session_id, user_id, COALESCE(user_agent, ''), COALESCE(ip_address, ''),
+		       created_at, COALESCE(last_used_at, created_at), expires_at, revoked_at
+		FROM sessions
+		WHERE user_id = $1 AND is_active = true AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY last_used_at DESC NULLS LAST
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(
+			&session.SessionID, &session.UserID, &session.UserAgent, &session.IPAddress,
+			&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt, &session.RevokedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan error: %w", err)
+		}
+		session.Device = DescribeDevice(session.UserAgent)
+		session.Current = session.SessionID == currentSessionID
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+// PurgeExpired deletes revocation entries, sessions and login states that can no longer be used
+func (s *Service) PurgeExpired() error {
+	if _, err := s.db.Exec(`DELETE FROM revoked_tokens WHERE expires_at < CURRENT_TIMESTAMP`); err != nil {
+		return fmt.Errorf("failed to purge revoked tokens: %w", err)
+	}
+	// Keep ended sessions for a week so users can see recent sign-outs in audits
+	if _, err := s.db.Exec(`DELETE FROM sessions WHERE expires_at < CURRENT_TIMESTAMP - INTERVAL '7 days'`); err != nil {
+		return fmt.Errorf("failed to purge sessions: %w", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM sso_states WHERE expires_at < CURRENT_TIMESTAMP`); err != nil {
+		return fmt.Errorf("failed to purge login states: %w", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM mfa_challenges WHERE expires_at < CURRENT_TIMESTAMP`); err != nil {
+		return fmt.Errorf("failed to purge MFA challenges: %w", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM password_reset_tokens WHERE expires_at < CURRENT_TIMESTAMP - INTERVAL '1 day'`); err != nil {
+		return fmt.Errorf("failed to purge password reset tokens: %w", err)
+	}
+	return nil
+}
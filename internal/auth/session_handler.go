@@ -0,0 +1,158 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package auth
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// Refresh exchanges a refresh token for a new access token and refresh token
+func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.RefreshToken == "" {
+		respondError(w, http.StatusBadRequest, "Refresh token is required")
+		return
+	}
+
+	resp, err := h.service.Refresh(req.RefreshToken, h.service.ClientInfo(r))
+	if err == ErrRefreshTokenReused {
+		log.Printf("Refresh token reuse detected; session revoked")
+		respondError(w, http.StatusUnauthorized, "Refresh token reuse detected; please log in again")
+		return
+	}
+	if err == ErrInvalidToken || err == ErrSessionRevoked {
+		respondError(w, http.StatusUnauthorized, "Invalid or expired refresh token")
+		return
+	}
+	if err != nil {
+		log.Printf("Refresh error: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// Logout ends the caller's current session
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	if claims.IsAPIToken() {
+		respondError(w, http.StatusBadRequest, "API tokens are revoked through /api/auth/tokens")
+		return
+	}
+
+	if err := h.service.Logout(claims); err != nil {
+		log.Printf("Logout error: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutAll ends every session of the caller, on all devices
+func (h *Handler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	if claims.IsAPIToken() {
+		respondError(w, http.StatusBadRequest, "API tokens are revoked through /api/auth/tokens")
+		return
+	}
+
+	count, err := h.service.RevokeAllSessions(claims.UserID, "logout_all")
+	if err != nil {
+		log.Printf("Logout all error: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]int{"revokedSessions": count})
+}
+
+// ListSessions returns the caller's active sessions
+func (h *Handler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	sessions, err := h.service.ListSessions(claims.UserID, claims.SessionID)
+	if err != nil {
+		log.Printf("List sessions error: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, sessions)
+}
+
+// RevokeSession ends one of the caller's sessions, e.g. a lost device
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	err := h.service.RevokeSession(claims.UserID, r.PathValue("id"))
+	if err == ErrSessionNotFound {
+		respondError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Revoke session error: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListUserSessions returns a user's active sessions (admin only)
+func (h *Handler) ListUserSessions(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	sessions, err := h.service.ListSessions(id, "")
+	if err != nil {
+		log.Printf("List user sessions error: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, sessions)
+}
+
+// RevokeUserSessions immediately cuts off all of a user's sessions (admin only)
+func (h *Handler) RevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	if _, err := h.service.GetUserByID(id); err == ErrUserNotFound {
+		respondError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	count, err := h.service.RevokeAllSessions(id, "revoked_by_admin")
+	if err != nil {
+		log.Printf("Revoke user sessions error: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]int{"revokedSessions": count})
+}
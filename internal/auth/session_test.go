@@ -0,0 +1,115 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDescribeDevice(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		expected  string
+	}{
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36", "Chrome on macOS"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36 Edg/120.0", "Edge on Windows"},
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0", "Firefox on Linux"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1", "Safari on iOS"},
+		{"curl/8.4.0", "curl"},
+		{"", "Unknown device"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			if got := DescribeDevice(tt.userAgent); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestClientInfo(t *testing.T) {
+	proxies, err := ParseTrustedProxies("172.18.0.2, 10.1.0.0/16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{}
+	s.SetTrustedProxies(proxies)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expectedIP string
+	}{
+		{"remote address", "10.0.0.5:51234", nil, "10.0.0.5"},
+		{"forwarded for", "172.18.0.2:8080", map[string]string{"X-Forwarded-For": "203.0.113.7, 172.18.0.1"}, "172.18.0.1"},
+		{"forwarded through proxies", "172.18.0.2:8080", map[string]string{"X-Forwarded-For": "198.51.100.9, 203.0.113.7, 10.1.4.4"}, "203.0.113.7"},
+		{"real ip", "172.18.0.2:8080", map[string]string{"X-Real-IP": "198.51.100.4"}, "198.51.100.4"},
+		{"spoofed forwarded for", "203.0.113.50:4000", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.50"},
+		{"spoofed real ip", "203.0.113.50:4000", map[string]string{"X-Real-IP": "198.51.100.1"}, "203.0.113.50"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/auth/login", nil)
+			r.RemoteAddr = tt.remoteAddr
+			r.Header.Set("User-Agent", "curl/8.4.0")
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+
+			info := s.ClientInfo(r)
+			if info.IPAddress != tt.expectedIP {
+				t.Errorf("expected IP %q, got %q", tt.expectedIP, info.IPAddress)
+			}
+			if info.UserAgent != "curl/8.4.0" {
+				t.Errorf("expected user agent to be kept, got %q", info.UserAgent)
+			}
+		})
+	}
+
+	if _, err := ParseTrustedProxies("nginx"); err == nil {
+		t.Error("expected an invalid trusted proxy to be rejected")
+	}
+}
+
+func TestHashTokenAndOpaqueTokens(t *testing.T) {
+	a, err := newOpaqueToken(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := newOpaqueToken(32)
+	if a == b {
+		t.Error("expected distinct random tokens")
+	}
+	if hashToken(a) != hashToken(a) || hashToken(a) == hashToken(b) {
+		t.Error("expected a stable, collision-free hash")
+	}
+	if len(hashToken(a)) != 64 {
+		t.Errorf("expected hex sha256, got %d chars", len(hashToken(a)))
+	}
+}
+
+func TestGenerateTokenCarriesSessionAndID(t *testing.T) {
+	s := NewService(nil, "test-secret")
+	token, expiresAt, err := s.GenerateToken(&User{ID: 7, Email: "a@example.com", Role: "admin"}, "sid-1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token == "" || expiresAt.IsZero() {
+		t.Fatal("expected a signed token and expiry")
+	}
+
+	// Tokens without a session are rejected before any database lookup
+	if err := s.checkRevocation(&Claims{UserID: 7}); err != ErrInvalidToken {
+		t.Errorf("expected ErrInvalidToken for sessionless claims, got %v", err)
+	}
+}
@@ -0,0 +1,233 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"golang.org/x/oauth2"
+)
+
+// providerIDPattern keeps provider IDs safe to use in URLs
+var providerIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,49}$`)
+
+// ssoStateTTL is how long a user has to complete a login at the identity provider
+const ssoStateTTL = 10 * time.Minute
+
+var (
+	ErrInvalidSSOState      = errors.New("invalid or expired login state")
+	ErrSSONotProvisioned    = errors.New("no account exists for this user")
+	ErrSSONoRole            = errors.New("user is not in a group that grants access")
+	ErrSSODomainNotAllowed  = errors.New("email domain is not allowed for this provider")
+	ErrSSOEmailNotConfirmed = errors.New("email is not verified by the identity provider")
+)
+
+// SSOState is a pending login created by the login endpoint and consumed by the callback
+type SSOState struct {
+	State        string
+	CodeVerifier string
+	Nonce        string
+}
+
+// CreateSSOState stores a new login attempt with a PKCE verifier and nonce
+func (s *Service) CreateSSOState(provider string) (*SSOState, error) {
+	state, err := newOpaqueToken(32)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := newOpaqueToken(16)
+	if err != nil {
+		return nil, err
+	}
+	st := &SSOState{State: state, CodeVerifier: oauth2.GenerateVerifier(), Nonce: nonce}
+
+	_, err = s.db.Exec(`
+		INSERT INTO sso_states (state_hash, provider, code_verifier, nonce, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, hashToken(state), provider, st.CodeVerifier, st.Nonce, time.Now().Add(ssoStateTTL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store login state: %w", err)
+	}
+	return st, nil
+}
+
+// ConsumeSSOState returns and deletes a pending login, so each state works once
+func (s *Service) ConsumeSSOState(provider, state string) (*SSOState, error) {
+	st := &SSOState{State: state}
+	var nonce sql.NullString
+	var expiresAt time.Time
+	err := s.db.QueryRow(`
+		DELETE FROM sso_states WHERE state_hash = $1 AND provider = $2
+		RETURNING code_verifier, nonce, expires_at
+	`, hashToken(state), provider).Scan(&st.CodeVerifier, &nonce, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidSSOState
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load login state: %w", err)
+	}
+	if time.Now().After(expiresAt) {
+		return nil, ErrInvalidSSOState
+	}
+	st.Nonce = nonce.String
+	return st, nil
+}
+
+// SignInWithIdentity finds or provisions the user for an identity asserted by a provider.
+// Known identities sign in directly; otherwise a verified email links an existing user,
+// and unknown users are created when the provider allows just-in-time provisioning.
+func (s *Service) SignInWithIdentity(cfg *SSOProviderConfig, id *SSOIdentity) (*User, error) {
+	if !cfg.AllowsEmail(id.Email) {
+		return nil, ErrSSODomainNotAllowed
+	}
+
+	user, err := s.userByIdentity(id.Provider, id.Subject)
+	if err == ErrUserNotFound {
+		user, err = s.GetUserByEmail(id.Email)
+		switch {
+		case err == nil && !id.EmailVerified:
+			// Linking on an unverified address would let anyone claim an account
+			return nil, ErrSSOEmailNotConfirmed
+		case err == ErrUserNotFound && cfg.AutoProvision:
+			role := cfg.MapRole(id.Groups)
+			if role == "" {
+				return nil, ErrSSONoRole
+			}
+			return s.CreateOAuthUser(&CreateUserRequest{Email: id.Email, Name: id.Name, Role: role}, id.Provider, id.Subject)
+		case err == ErrUserNotFound:
+			return nil, ErrSSONotProvisioned
+		case err != nil:
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	if cfg.SyncRole {
+		role := cfg.MapRole(id.Groups)
+		if role == "" {
+			return nil, ErrSSONoRole
+		}
+		if role != user.Role {
+			if _, err := s.db.Exec(`UPDATE users SET role = $1 WHERE id = $2`, role, user.ID); err != nil {
+				return nil, fmt.Errorf("failed to sync role: %w", err)
+			}
+			user.Role = role
+		}
+	}
+
+	if err := linkIdentity(s.db, user.ID, id); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *Service) userByIdentity(provider, subject string) (*User, error) {
+	var userID int
+	err := s.db.QueryRow(`
+		SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2
+	`, provider, subject).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return s.GetUserByID(userID)
+}
+
+// dbExecer is satisfied by *sql.DB and *sql.Tx
+type dbExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// linkIdentity records or refreshes a user's identity at a provider
+func linkIdentity(db dbExecer, userID int, id *SSOIdentity) error {
+	_, err := db.Exec(`
+		INSERT INTO user_identities (user_id, provider, subject, email, groups, last_login_at)
+		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
+		ON CONFLICT (provider, subject) DO UPDATE SET
+			email = EXCLUDED.email, groups = EXCLUDED.groups, last_login_at = EXCLUDED.last_login_at
+	`, userID, id.Provider, id.Subject, id.Email, pq.Array(id.Groups))
+	if err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+	return nil
+}
+
+// LoadSSOProviderConfigs reads identity providers from the JSON file named by
+// SSO_PROVIDERS_FILE and from the OIDC_* variables, which describe a single provider
+func LoadSSOProviderConfigs() ([]SSOProviderConfig, error) {
+	var configs []SSOProviderConfig
+
+	if path := os.Getenv("SSO_PROVIDERS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SSO providers file: %w", err)
+		}
+		if err := json.Unmarshal(data, &configs); err != nil {
+			return nil, fmt.Errorf("failed to parse SSO providers file: %w", err)
+		}
+	}
+
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		cfg := SSOProviderConfig{
+			ID:            envOr("OIDC_PROVIDER_ID", "oidc"),
+			Name:          envOr("OIDC_PROVIDER_NAME", "Single Sign-On"),
+			Issuer:        issuer,
+			ClientID:      os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret:  os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:   os.Getenv("OIDC_REDIRECT_URL"),
+			GroupsClaim:   os.Getenv("OIDC_GROUPS_CLAIM"),
+			DefaultRole:   envOr("OIDC_DEFAULT_ROLE", "user"),
+			SyncRole:      os.Getenv("OIDC_SYNC_ROLE") == "true",
+			AutoProvision: os.Getenv("OIDC_AUTO_PROVISION") != "false",
+		}
+		if scopes := os.Getenv("OIDC_SCOPES"); scopes != "" {
+			cfg.Scopes = strings.Fields(strings.ReplaceAll(scopes, ",", " "))
+		}
+		if domains := os.Getenv("OIDC_ALLOWED_DOMAINS"); domains != "" {
+			cfg.AllowedDomains = strings.Split(domains, ",")
+		}
+		// OIDC_ROLE_MAPPINGS is "group=role,group=role", first match wins
+		for _, pair := range strings.Split(os.Getenv("OIDC_ROLE_MAPPINGS"), ",") {
+			if group, role, ok := strings.Cut(pair, "="); ok {
+				cfg.RoleMappings = append(cfg.RoleMappings, RoleMapping{Group: strings.TrimSpace(group), Role: strings.TrimSpace(role)})
+			}
+		}
+		configs = append(configs, cfg)
+	}
+
+	seen := map[string]bool{"google": true}
+	for _, cfg := range configs {
+		if !providerIDPattern.MatchString(cfg.ID) {
+			return nil, fmt.Errorf("SSO provider id %q must be lowercase letters, digits and dashes", cfg.ID)
+		}
+		if seen[cfg.ID] {
+			return nil, fmt.Errorf("duplicate SSO provider id %q", cfg.ID)
+		}
+		seen[cfg.ID] = true
+	}
+	return configs, nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
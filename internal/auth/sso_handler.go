@@ -0,0 +1,146 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package auth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+)
+
+// SSOProviderInfo is the public description of a sign-in option
+type SSOProviderInfo struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// SetSSOProviders enables the generic single sign-on endpoints
+func (h *Handler) SetSSOProviders(providers []*OIDCProvider) {
+	h.ssoProviders = make(map[string]*OIDCProvider, len(providers))
+	h.ssoOrder = h.ssoOrder[:0]
+	for _, p := range providers {
+		h.ssoProviders[p.Config.ID] = p
+		h.ssoOrder = append(h.ssoOrder, p.Config.ID)
+	}
+}
+
+// ListSSOProviders returns the external sign-in options shown on the login page
+func (h *Handler) ListSSOProviders(w http.ResponseWriter, r *http.Request) {
+	providers := []SSOProviderInfo{}
+	if h.oauthConfig != nil {
+		providers = append(providers, SSOProviderInfo{ID: GoogleProviderConfig.ID, Name: GoogleProviderConfig.Name, Type: "google"})
+	}
+	for _, id := range h.ssoOrder {
+		providers = append(providers, SSOProviderInfo{ID: id, Name: h.ssoProviders[id].Config.Name, Type: "oidc"})
+	}
+	respondJSON(w, http.StatusOK, providers)
+}
+
+// SSOLogin starts a login at an OpenID Connect provider
+func (h *Handler) SSOLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.ssoProviders[r.PathValue("provider")]
+	if !ok {
+		respondError(w, http.StatusNotFound, "Unknown SSO provider")
+		return
+	}
+
+	st, err := h.service.CreateSSOState(provider.Config.ID)
+	if err != nil {
+		log.Printf("Failed to create login state: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to initiate SSO flow")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{
+		"url": provider.AuthCodeURL(st.State, st.Nonce, st.CodeVerifier),
+	})
+}
+
+// SSOCallback completes a login at an OpenID Connect provider
+func (h *Handler) SSOCallback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.ssoProviders[r.PathValue("provider")]
+	if !ok {
+		respondError(w, http.StatusNotFound, "Unknown SSO provider")
+		return
+	}
+
+	query := r.URL.Query()
+	if errCode := query.Get("error"); errCode != "" {
+		respondError(w, http.StatusUnauthorized, "Sign-in was rejected by the identity provider: "+errCode)
+		return
+	}
+	code := query.Get("code")
+	state := query.Get("state")
+	if code == "" || state == "" {
+		respondError(w, http.StatusBadRequest, "Missing code or state parameter")
+		return
+	}
+
+	st, err := h.service.ConsumeSSOState(provider.Config.ID, state)
+	if err != nil {
+		h.respondSSOError(w, err)
+		return
+	}
+
+	identity, err := provider.Exchange(r.Context(), code, st.CodeVerifier, st.Nonce)
+	if err != nil {
+		log.Printf("SSO exchange error (%s): %v", provider.Config.ID, err)
+		if errors.Is(err, ErrInvalidIDToken) {
+			respondError(w, http.StatusUnauthorized, "Invalid identity token")
+			return
+		}
+		respondError(w, http.StatusBadGateway, "Failed to complete sign-in with the identity provider")
+		return
+	}
+
+	h.completeSSOLogin(w, r, &provider.Config, identity)
+}
+
+// completeSSOLogin signs in the user for a verified identity and starts a session
+func (h *Handler) completeSSOLogin(w http.ResponseWriter, r *http.Request, cfg *SSOProviderConfig, identity *SSOIdentity) {
+	user, err := h.service.SignInWithIdentity(cfg, identity)
+	if err != nil {
+		h.respondSSOError(w, err)
+		return
+	}
+
+	if !user.IsActive {
+		respondError(w, http.StatusForbidden, "User account is disabled")
+		return
+	}
+
+	// Local MFA still applies unless the identity provider reports it checked a second factor
+	resp, challenge, err := h.service.beginLogin(user, h.service.ClientInfo(r), identity.MFA, cfg.ID)
+	if err != nil {
+		log.Printf("Failed to start session: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+	if challenge != nil {
+		respondJSON(w, http.StatusOK, challenge)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// respondSSOError maps sign-in errors to responses
+func (h *Handler) respondSSOError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidSSOState):
+		respondError(w, http.StatusUnauthorized, "Invalid state parameter")
+	case errors.Is(err, ErrSSODomainNotAllowed), errors.Is(err, ErrSSONoRole),
+		errors.Is(err, ErrSSONotProvisioned), errors.Is(err, ErrSSOEmailNotConfirmed):
+		respondError(w, http.StatusForbidden, err.Error())
+	default:
+		log.Printf("SSO sign-in error: %v", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
@@ -0,0 +1,800 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jareynolds/ubecode/pkg/governance"
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+const (
+	agentModel          = "claude-sonnet-4-20250514"
+	agentMaxSteps       = 25      // Model calls per chat message
+	agentMaxTokens      = 200000  // Input and output tokens per chat message
+	agentTurnTokens     = 4096    // Output tokens per model call
+	maxToolResult       = 30000   // Characters of tool output sent back to the model
+	maxRecordedOutput   = 2000    // Characters of tool output recorded in the response
+	maxReadFileBytes    = 1 << 20 // Largest file read_file and search will open
+	maxSearchMatches    = 100
+	runTestsTimeout     = 5 * time.Minute
+	anthropicMessageURL = "https://api.anthropic.com/v1/messages"
+)
+
+// Stop reasons reported when the agent loop ends early
+const (
+	agentStoppedMaxSteps  = "step_limit"
+	agentStoppedMaxTokens = "token_limit"
+	agentStoppedBudget    = "budget_limit"
+)
+
+// ToolCall records a tool the model used while answering, for review in the chat
+type ToolCall struct {
+	ID       string          `json:"id"`
+	Name     string          `json:"name"`
+	Input    json.RawMessage `json:"input"`
+	Output   string          `json:"output"`
+	IsError  bool            `json:"isError,omitempty"`
+	Duration int64           `json:"durationMs"`
+}
+
+// agentTool is a tool definition sent with every request
+type agentTool struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	InputSchema interface{} `json:"input_schema"` // A JSON Schema object
+}
+
+// agentBlock is a content block of the Messages API: text, tool_use or tool_result
+type agentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+}
+
+type agentRequest struct {
+	Model     string          `json:"model"`
+	MaxTokens int             `json:"max_tokens"`
+	System    string          `json:"system,omitempty"`
+	Messages  []ClaudeMessage `json:"messages"`
+	Tools     []agentTool     `json:"tools,omitempty"`
+}
+
+type agentResponse struct {
+	Content    []agentBlock `json:"content"`
+	StopReason string       `json:"stop_reason"`
+	Usage      ClaudeUsage  `json:"usage"`
+}
+
+// agentResult is the outcome of a chat message
+type agentResult struct {
+	Response     string
+	ToolCalls    []ToolCall
+	FileChanges  []models.FileChange
+	Steps        int
+	Tokens       int
+	InputTokens  int
+	OutputTokens int
+	StopReason   string
+	budgetError  error // Why the loop stopped at a budget
+}
+
+// agent answers a chat message with the Messages API, running the tools the model asks
+// for in the workspace until it stops asking or a limit is reached
+type agent struct {
+	apiKey    string
+	url       string
+	client    *http.Client
+	sandbox   *workspaceSandbox
+	maxSteps  int
+	maxTokens int
+}
+
+func newAgent(apiKey string, sandbox *workspaceSandbox) *agent {
+	return &agent{
+		apiKey:    apiKey,
+		url:       anthropicMessageURL,
+		client:    &http.Client{},
+		sandbox:   sandbox,
+		maxSteps:  agentMaxSteps,
+		maxTokens: agentMaxTokens,
+	}
+}
+
+// run loops until the model ends its turn. The model's text from every step is joined
+// into the response.
+func (a *agent) run(ctx context.Context, system string, messages []ClaudeMessage) (*agentResult, error) {
+	result := &agentResult{ToolCalls: []ToolCall{}}
+	var text []string
+
+	for {
+		if result.Steps >= a.maxSteps {
+			result.StopReason = agentStoppedMaxSteps
+			break
+		}
+		if result.Tokens >= a.maxTokens {
+			result.StopReason = agentStoppedMaxTokens
+			break
+		}
+		result.Steps++
+
+		resp, err := a.call(ctx, agentRequest{
+			Model:     agentModel,
+			MaxTokens: agentTurnTokens,
+			System:    system,
+			Messages:  messages,
+			Tools:     a.sandbox.tools(),
+		})
+		if errors.Is(err, errBudgetExceeded) && result.Steps > 1 {
+			result.Steps--
+			result.StopReason = agentStoppedBudget
+			result.budgetError = err
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		result.InputTokens += resp.Usage.InputTokens
+		result.OutputTokens += resp.Usage.OutputTokens
+		result.Tokens = result.InputTokens + result.OutputTokens
+
+		var uses []agentBlock
+		for _, block := range resp.Content {
+			switch block.Type {
+			case "text":
+				if strings.TrimSpace(block.Text) != "" {
+					text = append(text, block.Text)
+				}
+			case "tool_use":
+				uses = append(uses, block)
+			}
+		}
+		if resp.StopReason != "tool_use" || len(uses) == 0 {
+			result.StopReason = resp.StopReason
+			break
+		}
+
+		messages = append(messages, ClaudeMessage{Role: "assistant", Content: resp.Content})
+		results := make([]agentBlock, 0, len(uses))
+		for _, use := range uses {
+			started := time.Now()
+			output, err := a.sandbox.runTool(ctx, use.Name, use.Input)
+			isError := err != nil
+			if isError {
+				output = err.Error()
+			}
+			output = truncateText(output, maxToolResult)
+			result.ToolCalls = append(result.ToolCalls, ToolCall{
+				ID:       use.ID,
+				Name:     use.Name,
+				Input:    use.Input,
+				Output:   truncateText(output, maxRecordedOutput),
+				IsError:  isError,
+				Duration: time.Since(started).Milliseconds(),
+			})
+			if output == "" {
+				output = "(no output)"
+			}
+			results = append(results, agentBlock{Type: "tool_result", ToolUseID: use.ID, Content: output, IsError: isError})
+		}
+		messages = append(messages, ClaudeMessage{Role: "user", Content: results})
+		if g := a.sandbox.governor; g != nil && g.stopped {
+			result.StopReason = agentStoppedGovernance
+			break
+		}
+	}
+
+	result.Response = strings.Join(text, "\n\n")
+	result.FileChanges = a.sandbox.changes
+	switch result.StopReason {
+	case agentStoppedMaxSteps:
+		result.Response += fmt.Sprintf("\n\n[Stopped after %d steps. Ask me to continue if the task is not finished.]", result.Steps)
+	case agentStoppedMaxTokens:
+		result.Response += fmt.Sprintf("\n\n[Stopped after using %d tokens. Ask me to continue if the task is not finished.]", result.Tokens)
+	case agentStoppedBudget:
+		result.Response += fmt.Sprintf("\n\n[Stopped: %v.]", result.budgetError)
+	case agentStoppedGovernance:
+		result.Response += fmt.Sprintf("\n\n[Stopped: a change broke AI policy preset %d, which ends the run on the first violation.]", a.sandbox.governor.rules.Preset)
+	}
+	return result, nil
+}
+
+// call sends one request to the Messages API and records its usage
+func (a *agent) call(ctx context.Context, req agentRequest) (*agentResponse, error) {
+	if err := checkBudget(ctx); err != nil {
+		return nil, err
+	}
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", a.url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", a.apiKey)
+	httpReq.Header.Set("anthropic-version", "2023-06-01")
+
+	started := time.Now()
+	resp, err := a.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API error (%d): %s", resp.StatusCode, string(body))
+	}
+
+	var out agentResponse
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+	recordUsage(ctx, req.Model, out.Usage, time.Since(started))
+	return &out, nil
+}
+
+// summarize condenses a conversation so it can stand in for the messages it covers.
+// previous is an earlier summary the messages continue from.
+func (a *agent) summarize(ctx context.Context, previous string, messages []ClaudeMessage) (string, error) {
+	var transcript strings.Builder
+	if previous != "" {
+		fmt.Fprintf(&transcript, "Summary of the conversation before this point:\n%s\n\n", previous)
+	}
+	for _, msg := range messages {
+		if content, ok := msg.Content.(string); ok {
+			fmt.Fprintf(&transcript, "%s: %s\n\n", msg.Role, content)
+		}
+	}
+
+	resp, err := a.call(ctx, agentRequest{
+		Model:     agentModel,
+		MaxTokens: agentTurnTokens,
+		System:    "You summarize conversations between a user and an AI assistant working on a software project, so the conversation can continue without the full transcript. Keep decisions, requirements, open questions, file paths and spec IDs. Write only the summary.",
+		Messages:  []ClaudeMessage{{Role: "user", Content: transcript.String()}},
+	})
+	if err != nil {
+		return "", err
+	}
+	var parts []string
+	for _, block := range resp.Content {
+		if block.Type == "text" {
+			parts = append(parts, block.Text)
+		}
+	}
+	summary := strings.TrimSpace(strings.Join(parts, "\n"))
+	if summary == "" {
+		return "", errors.New("empty summary from Claude")
+	}
+	return summary, nil
+}
+
+// agentTools are the tools the chat model can use
+var agentTools = []agentTool{
+	{
+		Name:        "list_dir",
+		Description: "List files and folders in a workspace directory. Hidden files, node_modules and vendor are skipped.",
+		InputSchema: toolSchema(map[string]interface{}{
+			"path":  map[string]interface{}{"type": "string", "description": "Directory relative to the workspace root; defaults to the root"},
+			"depth": map[string]interface{}{"type": "integer", "description": "How many levels to descend, 1 to 5; defaults to 2"},
+		}),
+	},
+	{
+		Name:        "read_file",
+		Description: "Read a text file from the workspace.",
+		InputSchema: toolSchema(map[string]interface{}{
+			"path": map[string]interface{}{"type": "string", "description": "File path relative to the workspace root"},
+		}, "path"),
+	},
+	{
+		Name:        "write_file",
+		Description: "Create or overwrite a file in the workspace with the given content. Missing directories are created.",
+		InputSchema: toolSchema(map[string]interface{}{
+			"path":    map[string]interface{}{"type": "string", "description": "File path relative to the workspace root"},
+			"content": map[string]interface{}{"type": "string", "description": "The complete new content of the file"},
+		}, "path", "content"),
+	},
+	{
+		Name:        "search",
+		Description: "Search workspace files for a regular expression (RE2 syntax). Returns matching lines as path:line: text.",
+		InputSchema: toolSchema(map[string]interface{}{
+			"pattern": map[string]interface{}{"type": "string", "description": "Regular expression to look for"},
+			"path":    map[string]interface{}{"type": "string", "description": "Directory to search, relative to the workspace root; defaults to the root"},
+			"glob":    map[string]interface{}{"type": "string", "description": "Only search files whose name matches this glob, e.g. *.go"},
+		}, "pattern"),
+	},
+	{
+		Name:        "run_tests",
+		Description: "Run the project's test suite (go test, npm test, pytest or cargo test, detected from the project files) and return its output.",
+		InputSchema: toolSchema(map[string]interface{}{
+			"path": map[string]interface{}{"type": "string", "description": "Project directory relative to the workspace root; defaults to the root"},
+		}),
+	},
+	{
+		Name:        "read_spec",
+		Description: "Read a specification from the workspace's specifications folder by its ID, e.g. CAP-123456 or ENB-654321. Without an ID, lists the specification files.",
+		InputSchema: toolSchema(map[string]interface{}{
+			"id": map[string]interface{}{"type": "string", "description": "Specification ID"},
+		}),
+	},
+}
+
+func toolSchema(properties map[string]interface{}, required ...string) map[string]interface{} {
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// workspaceSandbox confines tool calls to a workspace folder
+type workspaceSandbox struct {
+	root     string              // Real path of the workspace, symlinks resolved
+	changes  []models.FileChange // Files written, in order
+	governor *governor           // Checks writes against the workspace's AI policy, if any
+	tests    *testRunner         // Runs run_tests; nil unless the workspace allows it and the service can run tests
+}
+
+// tools are the agent tools the sandbox offers; run_tests only when the workspace allows it
+func (s *workspaceSandbox) tools() []agentTool {
+	if s.tests != nil {
+		return agentTools
+	}
+	tools := make([]agentTool, 0, len(agentTools))
+	for _, tool := range agentTools {
+		if tool.Name != "run_tests" {
+			tools = append(tools, tool)
+		}
+	}
+	return tools
+}
+
+func newWorkspaceSandbox(path string) (*workspaceSandbox, error) {
+	root, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", path)
+	}
+	return &workspaceSandbox{root: root}, nil
+}
+
+var errOutsideWorkspace = errors.New("access denied: path is outside the workspace")
+
+// resolve returns the real path of name inside the workspace. Symlinks are followed as far
+// as the path exists, so neither ".." nor a link can lead out of the workspace. name may
+// also be an absolute path inside the workspace.
+func (s *workspaceSandbox) resolve(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	path := filepath.Join(s.root, filepath.FromSlash(name))
+	if filepath.IsAbs(name) {
+		path = filepath.Clean(name)
+	}
+	if !within(s.root, path) {
+		return "", errOutsideWorkspace
+	}
+
+	existing, rest := path, ""
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			path = filepath.Join(resolved, rest)
+			break
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return "", errOutsideWorkspace
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+	if !within(s.root, path) {
+		return "", errOutsideWorkspace
+	}
+	return path, nil
+}
+
+// rel is the workspace-relative form of a resolved path, as shown to the model
+func (s *workspaceSandbox) rel(path string) string {
+	rel, err := filepath.Rel(s.root, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// within reports whether path is root or inside it
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// runTool executes a tool call. Errors are reported back to the model as the tool result.
+func (s *workspaceSandbox) runTool(ctx context.Context, name string, input json.RawMessage) (string, error) {
+	var args struct {
+		Path    string `json:"path"`
+		Depth   int    `json:"depth"`
+		Content string `json:"content"`
+		Pattern string `json:"pattern"`
+		Glob    string `json:"glob"`
+		ID      string `json:"id"`
+	}
+	if len(input) > 0 {
+		if err := json.Unmarshal(input, &args); err != nil {
+			return "", fmt.Errorf("invalid input: %v", err)
+		}
+	}
+
+	switch name {
+	case "list_dir":
+		return s.listDir(args.Path, args.Depth)
+	case "read_file":
+		return s.readFile(args.Path)
+	case "write_file":
+		return s.writeFile(args.Path, args.Content)
+	case "search":
+		return s.search(args.Pattern, args.Path, args.Glob)
+	case "run_tests":
+		return s.runTests(ctx, args.Path)
+	case "read_spec":
+		return s.readSpec(args.ID)
+	}
+	return "", fmt.Errorf("unknown tool %q", name)
+}
+
+func (s *workspaceSandbox) listDir(name string, depth int) (string, error) {
+	dir, err := s.resolve(name)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", name)
+	}
+	if depth <= 0 {
+		depth = 2
+	} else if depth > 5 {
+		depth = 5
+	}
+
+	files, err := listWorkspaceFiles(dir, depth)
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "(empty directory)", nil
+	}
+	prefix := s.rel(dir)
+	for i, file := range files {
+		if prefix != "." {
+			files[i] = prefix + "/" + filepath.ToSlash(file)
+		} else {
+			files[i] = filepath.ToSlash(file)
+		}
+	}
+	return strings.Join(files, "\n"), nil
+}
+
+func (s *workspaceSandbox) readFile(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("path is required")
+	}
+	path, err := s.resolve(name)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("%s does not exist", name)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory; use list_dir", name)
+	}
+	if info.Size() > maxReadFileBytes {
+		return "", fmt.Errorf("%s is too large to read (%d bytes)", name, info.Size())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if !isText(data) {
+		return "", fmt.Errorf("%s is not a text file", name)
+	}
+	return string(data), nil
+}
+
+func (s *workspaceSandbox) writeFile(name, content string) (string, error) {
+	if name == "" {
+		return "", errors.New("path is required")
+	}
+	path, err := s.resolve(name)
+	if err != nil {
+		return "", err
+	}
+	rel := s.rel(path)
+	if rel == "." || rel == ".git" || strings.HasPrefix(rel, ".git/") {
+		return "", fmt.Errorf("access denied: cannot write %s", name)
+	}
+	action := "create"
+	if info, err := os.Stat(path); err == nil {
+		if info.IsDir() {
+			return "", fmt.Errorf("%s is a directory", name)
+		}
+		action = "modify"
+	}
+	var warnings []models.AIViolation
+	if s.governor != nil {
+		seen := len(s.governor.violations)
+		if err := s.governor.check(governance.Change{Path: rel, Content: content}); err != nil {
+			return "", err
+		}
+		warnings = s.governor.violations[seen:]
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return "", err
+	}
+
+	change := models.FileChange{Path: rel, Action: action, Bytes: len(content)}
+	if strings.HasPrefix(rel, "specifications/") && strings.HasSuffix(rel, ".md") {
+		change.SpecID = specIDOf(content)
+	}
+	s.changes = append(s.changes, change)
+	if len(warnings) > 0 {
+		return fmt.Sprintf("Wrote %d bytes to %s, breaking AI policy rules: %s", len(content), rel, violationMessages(warnings)), nil
+	}
+	return fmt.Sprintf("Wrote %d bytes to %s", len(content), rel), nil
+}
+
+func (s *workspaceSandbox) search(pattern, name, glob string) (string, error) {
+	if pattern == "" {
+		return "", errors.New("pattern is required")
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid pattern: %v", err)
+	}
+	dir, err := s.resolve(name)
+	if err != nil {
+		return "", err
+	}
+
+	var matches []string
+	errEnough := errors.New("enough matches")
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		base := info.Name()
+		if path != dir && (strings.HasPrefix(base, ".") || base == "node_modules" || base == "vendor" || base == "__pycache__") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() || !info.Mode().IsRegular() || info.Size() > maxReadFileBytes {
+			return nil
+		}
+		if glob != "" {
+			if ok, _ := filepath.Match(glob, base); !ok {
+				return nil
+			}
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || !isText(data) {
+			return nil
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), maxReadFileBytes)
+		for line := 1; scanner.Scan(); line++ {
+			if re.Match(scanner.Bytes()) {
+				matches = append(matches, fmt.Sprintf("%s:%d: %s", s.rel(path), line, truncateText(strings.TrimSpace(scanner.Text()), 200)))
+				if len(matches) >= maxSearchMatches {
+					return errEnough
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil && err != errEnough {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "No matches found", nil
+	}
+	if err == errEnough {
+		matches = append(matches, fmt.Sprintf("(stopped after %d matches; narrow the search)", maxSearchMatches))
+	}
+	return strings.Join(matches, "\n"), nil
+}
+
+// testCommand picks the test runner for the project in dir
+func testCommand(dir string) ([]string, error) {
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	}
+	switch {
+	case exists("go.mod"):
+		return []string{"go", "test", "./..."}, nil
+	case exists("package.json"):
+		var pkg struct {
+			Scripts map[string]string `json:"scripts"`
+		}
+		data, _ := os.ReadFile(filepath.Join(dir, "package.json"))
+		if json.Unmarshal(data, &pkg) != nil || pkg.Scripts["test"] == "" {
+			return nil, errors.New("package.json has no test script")
+		}
+		return []string{"npm", "test", "--silent"}, nil
+	case exists("Cargo.toml"):
+		return []string{"cargo", "test"}, nil
+	case exists("pyproject.toml"), exists("pytest.ini"), exists("setup.py"), exists("requirements.txt"):
+		return []string{"python3", "-m", "pytest", "-q"}, nil
+	}
+	return nil, errors.New("no test suite found (looked for go.mod, package.json, Cargo.toml and Python project files)")
+}
+
+func (s *workspaceSandbox) runTests(ctx context.Context, name string) (string, error) {
+	if s.tests == nil {
+		return "", errors.New("run_tests is not enabled for this workspace")
+	}
+	dir, err := s.resolve(name)
+	if err != nil {
+		return "", err
+	}
+	command, err := testCommand(dir)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, runTestsTimeout)
+	defer cancel()
+	cmd, cleanup, err := s.tests.command(ctx, s.root, dir, command)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+	cmd.WaitDelay = 5 * time.Second
+	output, err := cmd.CombinedOutput()
+
+	// Failures are usually at the end of the output
+	out := string(output)
+	if len(out) > maxToolResult {
+		cut := len(out) - maxToolResult
+		for cut < len(out) && !utf8.RuneStart(out[cut]) {
+			cut++
+		}
+		out = "…" + out[cut:]
+	}
+	summary := fmt.Sprintf("$ %s (in %s)\n", strings.Join(command, " "), s.rel(dir))
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return "", fmt.Errorf("%stimed out after %s\n%s", summary, runTestsTimeout, out)
+	case err != nil:
+		return "", fmt.Errorf("%stests failed: %v\n%s", summary, err, out)
+	}
+	return summary + "tests passed\n" + out, nil
+}
+
+func (s *workspaceSandbox) readSpec(id string) (string, error) {
+	specsPath, err := s.resolve("specifications")
+	if err != nil {
+		return "", err
+	}
+	id = strings.TrimSpace(id)
+
+	var names []string
+	var found string
+	err = filepath.Walk(specsPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(info.Name(), ".md") {
+			return nil
+		}
+		if id == "" {
+			names = append(names, s.rel(path))
+			return nil
+		}
+		if strings.HasPrefix(strings.ToUpper(info.Name()), strings.ToUpper(id)) {
+			found = path
+			return filepath.SkipAll
+		}
+		data, err := os.ReadFile(path)
+		if err == nil && specDeclaresID(string(data), id) {
+			found = path
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read specifications: %v", err)
+	}
+
+	if id == "" {
+		if len(names) == 0 {
+			return "", errors.New("no specification files found in ./specifications")
+		}
+		return strings.Join(names, "\n"), nil
+	}
+	if found == "" {
+		return "", fmt.Errorf("no specification with ID %s", id)
+	}
+	data, err := os.ReadFile(found)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("File: %s\n\n%s", s.rel(found), data), nil
+}
+
+// specIDOf returns the value of a spec's **ID** field
+func specIDOf(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(line), "**ID**:"); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// specDeclaresID reports whether a spec's **ID** field is id
+func specDeclaresID(content, id string) bool {
+	declared := specIDOf(content)
+	return declared != "" && strings.EqualFold(declared, id)
+}
+
+// isText reports whether data looks like text rather than a binary file
+func isText(data []byte) bool {
+	sample := data
+	if len(sample) > 8000 {
+		sample = sample[:8000]
+	}
+	return !bytes.Contains(sample, []byte{0})
+}
+
+func truncateText(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max] + "…"
+}
@@ -0,0 +1,345 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+func newTestSandbox(t *testing.T) *workspaceSandbox {
+	t.Helper()
+	base := t.TempDir()
+	root := filepath.Join(base, "acme")
+	files := map[string]string{
+		"specifications/CAP-123456.md":  "# Checkout\n\n**ID**: CAP-123456\n",
+		"specifications/checkout-ui.md": "# Checkout UI\n\n**ID**: ENB-654321\n",
+		"code/main.go":                  "package main\n\nfunc main() {\n\tcheckout()\n}\n",
+		"code/logo.png":                 "\x89PNG\x00\x00",
+		"../secret.txt":                 "top secret",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(base, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	sandbox, err := newWorkspaceSandbox(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sandbox
+}
+
+func TestWorkspaceSandboxResolve(t *testing.T) {
+	sandbox := newTestSandbox(t)
+	tests := []struct {
+		name    string
+		path    string
+		wantRel string
+		wantErr bool
+	}{
+		{"root", "", ".", false},
+		{"file", "code/main.go", "code/main.go", false},
+		{"new file", "code/new/file.go", "code/new/file.go", false},
+		{"cleaned", "code/../specifications/./CAP-123456.md", "specifications/CAP-123456.md", false},
+		{"absolute inside", filepath.Join(sandbox.root, "code"), "code", false},
+		{"parent", "../secret.txt", "", true},
+		{"absolute outside", "/etc/passwd", "", true},
+		{"through symlink", "escape/secret.txt", "", true},
+		{"new file through symlink", "escape/new.txt", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := sandbox.resolve(tt.path)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected %q to be rejected, got %s", tt.path, path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if rel := sandbox.rel(path); rel != tt.wantRel {
+				t.Errorf("expected %s, got %s", tt.wantRel, rel)
+			}
+		})
+	}
+}
+
+func TestWorkspaceSandboxTools(t *testing.T) {
+	tests := []struct {
+		name     string
+		tool     string
+		input    string
+		want     string
+		wantErr  bool
+		wantFile string // Checked after the call, as path=content
+	}{
+		{"list root", "list_dir", `{}`, "specifications/CAP-123456.md", false, ""},
+		{"list subdirectory", "list_dir", `{"path":"code"}`, "code/main.go", false, ""},
+		{"list file", "list_dir", `{"path":"code/main.go"}`, "not a directory", true, ""},
+		{"read", "read_file", `{"path":"code/main.go"}`, "func main()", false, ""},
+		{"read missing", "read_file", `{"path":"code/missing.go"}`, "does not exist", true, ""},
+		{"read binary", "read_file", `{"path":"code/logo.png"}`, "not a text file", true, ""},
+		{"read outside", "read_file", `{"path":"../secret.txt"}`, "outside the workspace", true, ""},
+		{"write", "write_file", `{"path":"code/util/util.go","content":"package util\n"}`, "Wrote 13 bytes to code/util/util.go", false, "code/util/util.go=package util\n"},
+		{"write spec", "write_file", `{"path":"specifications/CAP-123456.md","content":"# Checkout\n\n**ID**: CAP-123456\n"}`, "Wrote 31 bytes", false, ""},
+		{"write git", "write_file", `{"path":".git/hooks/pre-commit","content":"x"}`, "cannot write", true, ""},
+		{"write outside", "write_file", `{"path":"escape/x.txt","content":"x"}`, "outside the workspace", true, ""},
+		{"search", "search", `{"pattern":"check\\w+\\(","glob":"*.go"}`, "code/main.go:4: checkout()", false, ""},
+		{"search no match", "search", `{"pattern":"nothing here"}`, "No matches found", false, ""},
+		{"search bad pattern", "search", `{"pattern":"("}`, "invalid pattern", true, ""},
+		{"spec by file name", "read_spec", `{"id":"cap-123456"}`, "File: specifications/CAP-123456.md", false, ""},
+		{"spec by ID field", "read_spec", `{"id":"ENB-654321"}`, "# Checkout UI", false, ""},
+		{"spec list", "read_spec", `{}`, "specifications/checkout-ui.md", false, ""},
+		{"spec missing", "read_spec", `{"id":"CAP-000000"}`, "no specification", true, ""},
+		{"no test suite", "run_tests", `{}`, "no test suite found", true, ""},
+		{"unknown tool", "delete_file", `{}`, "unknown tool", true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sandbox := newTestSandbox(t)
+			sandbox.tests = &testRunner{}
+			output, err := sandbox.runTool(context.Background(), tt.tool, json.RawMessage(tt.input))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", output)
+				}
+				output = err.Error()
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.Contains(output, tt.want) {
+				t.Errorf("expected output containing %q, got %q", tt.want, output)
+			}
+			if name, content, ok := strings.Cut(tt.wantFile, "="); ok {
+				data, err := os.ReadFile(filepath.Join(sandbox.root, name))
+				if err != nil || string(data) != content {
+					t.Errorf("expected %s to contain %q, got %q (%v)", name, content, data, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRunTestsIsolation(t *testing.T) {
+	sandbox := newTestSandbox(t)
+	for _, tool := range sandbox.tools() {
+		if tool.Name == "run_tests" {
+			t.Error("expected run_tests to be offered only when the workspace allows it")
+		}
+	}
+	if _, err := sandbox.runTool(context.Background(), "run_tests", json.RawMessage(`{}`)); err == nil || !strings.Contains(err.Error(), "not enabled") {
+		t.Errorf("expected run_tests to be refused, got %v", err)
+	}
+
+	if _, _, err := (&testRunner{}).command(context.Background(), sandbox.root, sandbox.root, []string{"env"}); err == nil {
+		t.Error("expected tests to be refused without a container image or test user")
+	}
+	if err := (&Service{}).EnableTestUser("root"); err == nil {
+		t.Error("expected root to be refused as the test user")
+	}
+
+	t.Setenv("ANTHROPIC_API_KEY", "sk-secret")
+	t.Setenv("DATABASE_URL", "postgres://user:password@db/ubecode")
+	scratch := t.TempDir()
+	env := strings.Join(testEnv(scratch), "\n")
+	if strings.Contains(env, "sk-secret") || strings.Contains(env, "password") {
+		t.Errorf("expected the service's secrets to be left out, got %s", env)
+	}
+	if !strings.Contains(env, "HOME="+scratch) || !strings.Contains(env, "PATH=") {
+		t.Errorf("expected a scratch home and the PATH, got %s", env)
+	}
+
+	// Switching users needs root
+	if os.Geteuid() != 0 {
+		t.Skip("not running as root")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not installed")
+	}
+	service := &Service{}
+	if err := service.EnableTestUser("nobody"); err != nil {
+		t.Skipf("no nobody user: %v", err)
+	}
+	cmd, cleanup, err := service.tests.command(context.Background(), sandbox.root, os.TempDir(), []string{"sh", "-c", "id -u && env"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uid, _, _ := strings.Cut(string(output), "\n")
+	if uid == "0" || strings.Contains(string(output), "sk-secret") || !strings.Contains(string(output), "HOME=") {
+		t.Errorf("expected tests to run as the test user without the service's environment, got %s", output)
+	}
+}
+
+func TestWriteFileRecordsChanges(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want models.FileChange
+	}{
+		{"new file", "code/new.go", models.FileChange{Path: "code/new.go", Action: "create", Bytes: 5}},
+		{"existing file", "code/main.go", models.FileChange{Path: "code/main.go", Action: "modify", Bytes: 5}},
+		{"spec", "specifications/CAP-777777.md", models.FileChange{Path: "specifications/CAP-777777.md", Action: "create", Bytes: 5, SpecID: "CAP-777777"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sandbox := newTestSandbox(t)
+			content := "hello"
+			if tt.want.SpecID != "" {
+				content = "**ID**: " + tt.want.SpecID
+				tt.want.Bytes = len(content)
+			}
+			if _, err := sandbox.writeFile(tt.path, content); err != nil {
+				t.Fatal(err)
+			}
+			if len(sandbox.changes) != 1 || sandbox.changes[0] != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, sandbox.changes)
+			}
+		})
+	}
+}
+
+// fakeMessagesAPI replies with the given responses in order and records the requests
+func fakeMessagesAPI(t *testing.T, responses []string) (*httptest.Server, *[]agentRequest) {
+	t.Helper()
+	var requests []agentRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req agentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request: %v", err)
+		}
+		if r.Header.Get("x-api-key") != "sk-test" {
+			t.Errorf("expected the API key to be sent")
+		}
+		requests = append(requests, req)
+		if len(requests) > len(responses) {
+			http.Error(w, "unexpected request", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(responses[len(requests)-1]))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestAgentRunsTools(t *testing.T) {
+	sandbox := newTestSandbox(t)
+	server, requests := fakeMessagesAPI(t, []string{
+		`{"content":[{"type":"text","text":"Let me look."},{"type":"tool_use","id":"tu_1","name":"read_file","input":{"path":"code/main.go"}}],"stop_reason":"tool_use","usage":{"input_tokens":100,"output_tokens":20}}`,
+		`{"content":[{"type":"tool_use","id":"tu_2","name":"write_file","input":{"path":"code/checkout.go","content":"package main\n\nfunc checkout() {}\n"}}],"stop_reason":"tool_use","usage":{"input_tokens":200,"output_tokens":30}}`,
+		`{"content":[{"type":"text","text":"Added checkout()."}],"stop_reason":"end_turn","usage":{"input_tokens":300,"output_tokens":10}}`,
+	})
+	a := newAgent("sk-test", sandbox)
+	a.url = server.URL
+
+	result, err := a.run(context.Background(), "system prompt", []ClaudeMessage{{Role: "user", Content: "Add checkout"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Response != "Let me look.\n\nAdded checkout()." {
+		t.Errorf("unexpected response %q", result.Response)
+	}
+	if result.Steps != 3 || result.Tokens != 660 || result.StopReason != "end_turn" {
+		t.Errorf("unexpected steps %d, tokens %d, stop reason %s", result.Steps, result.Tokens, result.StopReason)
+	}
+	if len(result.ToolCalls) != 2 || result.ToolCalls[0].Name != "read_file" || result.ToolCalls[1].Name != "write_file" {
+		t.Fatalf("unexpected tool calls %+v", result.ToolCalls)
+	}
+	if !strings.Contains(result.ToolCalls[0].Output, "func main()") || result.ToolCalls[0].IsError {
+		t.Errorf("unexpected read_file record %+v", result.ToolCalls[0])
+	}
+	if _, err := os.Stat(filepath.Join(sandbox.root, "code", "checkout.go")); err != nil {
+		t.Errorf("expected write_file to create the file: %v", err)
+	}
+	if len(result.FileChanges) != 1 || result.FileChanges[0] != (models.FileChange{Path: "code/checkout.go", Action: "create", Bytes: 33}) {
+		t.Errorf("unexpected file changes %+v", result.FileChanges)
+	}
+	if result.InputTokens != 600 || result.OutputTokens != 60 {
+		t.Errorf("unexpected token usage %d in, %d out", result.InputTokens, result.OutputTokens)
+	}
+
+	// The file content read by the first tool call goes back to the model
+	if len(*requests) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(*requests))
+	}
+	second := (*requests)[1]
+	if second.System != "system prompt" || len(second.Tools) != len(sandbox.tools()) {
+		t.Errorf("expected the system prompt and tools with every request")
+	}
+	if len(second.Messages) != 3 {
+		t.Fatalf("expected user, assistant and tool result messages, got %d", len(second.Messages))
+	}
+	toolResult, _ := json.Marshal(second.Messages[2].Content)
+	if !strings.Contains(string(toolResult), `"tool_use_id":"tu_1"`) || !strings.Contains(string(toolResult), "func main()") {
+		t.Errorf("expected the read_file result to be sent back, got %s", toolResult)
+	}
+}
+
+func TestAgentLimits(t *testing.T) {
+	loop := `{"content":[{"type":"tool_use","id":"tu","name":"list_dir","input":{}}],"stop_reason":"tool_use","usage":{"input_tokens":500,"output_tokens":50}}`
+	tests := []struct {
+		name       string
+		maxSteps   int
+		maxTokens  int
+		wantSteps  int
+		wantReason string
+	}{
+		{"step limit", 3, agentMaxTokens, 3, agentStoppedMaxSteps},
+		{"token limit", agentMaxSteps, 1000, 2, agentStoppedMaxTokens},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := fakeMessagesAPI(t, []string{loop, loop, loop, loop})
+			a := newAgent("sk-test", newTestSandbox(t))
+			a.url, a.maxSteps, a.maxTokens = server.URL, tt.maxSteps, tt.maxTokens
+
+			result, err := a.run(context.Background(), "", []ClaudeMessage{{Role: "user", Content: "Loop"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Steps != tt.wantSteps || result.StopReason != tt.wantReason {
+				t.Errorf("expected %d steps and %s, got %d and %s", tt.wantSteps, tt.wantReason, result.Steps, result.StopReason)
+			}
+			if len(result.ToolCalls) != tt.wantSteps {
+				t.Errorf("expected a recorded tool call per step, got %d", len(result.ToolCalls))
+			}
+			if !strings.Contains(result.Response, "Stopped after") {
+				t.Errorf("expected the response to say the loop stopped, got %q", result.Response)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/jareynolds/ubecode/pkg/aicache"
+	"github.com/jareynolds/ubecode/pkg/jsonschema"
+)
+
+// EnableAICache answers deterministic AI calls repeated on unchanged inputs from a cache
+func (s *Service) EnableAICache(c *aicache.Cache) {
+	s.aiCache = c
+}
+
+// cachedAICall answers an AI call from the cache when it holds an answer for key, and
+// otherwise makes the call and caches the answer call decodes into out. bypass makes the
+// call anyway and replaces the cached answer. It returns how the call was answered, or ""
+// when there is no cache.
+func (s *Service) cachedAICall(ctx context.Context, key aicache.Key, bypass bool, out interface{}, call func(context.Context) error) (string, error) {
+	if s.aiCache == nil {
+		return "", call(ctx)
+	}
+	if key.Prompt == "" {
+		key.Prompt = promptRef(ctx)
+	}
+
+	status := aicache.StatusMiss
+	if bypass {
+		status = aicache.StatusBypass
+		s.aiCache.Bypass(key)
+	} else if hit, err := s.aiCache.Get(key, out); err != nil {
+		log.Printf("AI cache: %v", err)
+	} else if hit {
+		return aicache.StatusHit, nil
+	}
+
+	// Add up what the call costs, which every later hit saves
+	var cost float64
+	if err := call(context.WithValue(ctx, "cost", &cost)); err != nil {
+		return status, err
+	}
+	if err := s.aiCache.Put(key, out, cost); err != nil {
+		log.Printf("AI cache: %v", err)
+	}
+	return status, nil
+}
+
+// structuredKey is the cache key of a SendStructured call, whose answer also depends on
+// the schema of out
+func structuredKey(req ClaudeRequest, tool string, out interface{}, inputs map[string]string) aicache.Key {
+	return aicache.Key{
+		Model: req.Model,
+		Params: map[string]interface{}{
+			"maxTokens": req.MaxTokens,
+			"tool":      tool,
+			"schema":    jsonschema.For(out),
+		},
+		Inputs: inputs,
+	}
+}
+
+// specificationDigests are the cache key inputs of specification files. Their position is
+// part of the name, as the IDs in answers follow the order of the files.
+func specificationDigests(files []SpecificationFile) map[string]string {
+	inputs := make(map[string]string, len(files))
+	for i, f := range files {
+		inputs[fmt.Sprintf("%d:%s", i+1, f.Filename)] = aicache.Digest(f.Content)
+	}
+	return inputs
+}
+
+// noCache reports whether a request asks for a fresh answer with Cache-Control: no-cache
+func noCache(r *http.Request) bool {
+	return strings.Contains(strings.ToLower(r.Header.Get("Cache-Control")), "no-cache")
+}
+
+// setCacheStatus tells the client how an AI call was answered
+func setCacheStatus(w http.ResponseWriter, status string) {
+	if status != "" {
+		w.Header().Set("X-AI-Cache", status)
+	}
+}
+
+// HandleAICacheStats handles GET /ai-cache
+// Reports the cache's hits, misses and bypasses per prompt template since the service started
+func (h *Handler) HandleAICacheStats(w http.ResponseWriter, r *http.Request) {
+	stats, since := h.service.aiCache.Stats()
+	totals := aicache.Stats{}
+	for _, s := range stats {
+		totals.Hits += s.Hits
+		totals.Misses += s.Misses
+		totals.Bypasses += s.Bypasses
+		totals.SavedUSD += s.SavedUSD
+	}
+	if lookups := totals.Hits + totals.Misses + totals.Bypasses; lookups > 0 {
+		totals.HitRate = float64(totals.Hits) / float64(lookups)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ttl":       h.service.aiCache.TTL().String(),
+		"since":     since,
+		"prompts":   stats,
+		"hits":      totals.Hits,
+		"misses":    totals.Misses,
+		"bypasses":  totals.Bypasses,
+		"hit_rate":  totals.HitRate,
+		"saved_usd": totals.SavedUSD,
+	})
+}
+
+// HandleClearAICache handles DELETE /ai-cache?expired=true
+// Removes every cached answer, or only the expired ones
+func (h *Handler) HandleClearAICache(w http.ResponseWriter, r *http.Request) {
+	if !isUsageAdmin(r) {
+		http.Error(w, "only admins can clear the AI cache", http.StatusForbidden)
+		return
+	}
+	remove := h.service.aiCache.Clear
+	if r.URL.Query().Get("expired") == "true" {
+		remove = h.service.aiCache.Purge
+	}
+	removed, err := remove()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to clear AI cache: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"removed": removed})
+}
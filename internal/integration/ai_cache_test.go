@@ -0,0 +1,83 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/aicache"
+)
+
+func TestCachedAICall(t *testing.T) {
+	s := &Service{}
+	s.EnableAICache(aicache.New(aicache.NewDiskStore(t.TempDir()), time.Hour))
+	ctx := context.WithValue(context.Background(), "prompt", "diagram-generation@v1:abc")
+	files := []SpecificationFile{{Filename: "CAP-1.md", Content: "# Checkout"}}
+
+	calls := 0
+	call := func(answer string, err error) func(*string) func(context.Context) error {
+		return func(out *string) func(context.Context) error {
+			return func(ctx context.Context) error {
+				calls++
+				// A million input tokens of Sonnet cost $3
+				recordUsage(ctx, "claude-sonnet-4-20250514", ClaudeUsage{InputTokens: 1000000}, 0)
+				*out = answer
+				return err
+			}
+		}
+	}
+
+	tests := []struct {
+		name       string
+		files      []SpecificationFile
+		bypass     bool
+		call       func(*string) func(context.Context) error
+		want       string
+		wantStatus string
+		wantCalls  int
+		wantErr    bool
+	}{
+		{"first call", files, false, call("graph TD", nil), "graph TD", aicache.StatusMiss, 1, false},
+		{"repeated", files, false, call("unused", nil), "graph TD", aicache.StatusHit, 1, false},
+		{"bypass", files, true, call("graph LR", nil), "graph LR", aicache.StatusBypass, 2, false},
+		{"after bypass", files, false, call("unused", nil), "graph LR", aicache.StatusHit, 2, false},
+		{"changed file", []SpecificationFile{{Filename: "CAP-1.md", Content: "# Cart"}}, false, call("", errors.New("overloaded")), "", aicache.StatusMiss, 3, true},
+		{"failure not cached", []SpecificationFile{{Filename: "CAP-1.md", Content: "# Cart"}}, false, call("graph BT", nil), "graph BT", aicache.StatusMiss, 4, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			key := aicache.Key{Model: "claude-sonnet-4-20250514", Inputs: specificationDigests(tt.files)}
+			status, err := s.cachedAICall(ctx, key, tt.bypass, &got, tt.call(&got))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if got != tt.want || status != tt.wantStatus || calls != tt.wantCalls {
+				t.Errorf("expected %q (%s) after %d calls, got %q (%s) after %d", tt.want, tt.wantStatus, tt.wantCalls, got, status, calls)
+			}
+		})
+	}
+
+	stats, _ := s.aiCache.Stats()
+	if len(stats) != 1 || stats[0].Prompt != "diagram-generation" || stats[0].Hits != 2 || math.Abs(stats[0].SavedUSD-6) > 1e-9 {
+		t.Errorf("expected 2 hits saving $6 on diagram-generation, got %+v", stats)
+	}
+
+	// Without a cache every call is made
+	var got string
+	status, err := (&Service{}).cachedAICall(ctx, aicache.Key{}, false, &got, call("graph TD", nil)(&got))
+	if status != "" || err != nil || got != "graph TD" {
+		t.Errorf("expected an uncached call, got %q, %v, %q", status, err, got)
+	}
+}
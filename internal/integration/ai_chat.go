@@ -9,16 +9,24 @@
 package integration
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/client"
+	"github.com/jareynolds/ubecode/pkg/governance"
+	"github.com/jareynolds/ubecode/pkg/jobs"
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/jareynolds/ubecode/pkg/retrieval"
 )
 
 // Track running processes
@@ -29,11 +37,14 @@ var (
 
 // ChatRequest represents an incoming chat request
 type ChatRequest struct {
-	Message       string        `json:"message"`
-	WorkspacePath string        `json:"workspacePath"`
-	APIKey        string        `json:"apiKey,omitempty"`
-	History       []ChatMessage `json:"history,omitempty"`
-	AIPreset      int           `json:"aiPreset,omitempty"`
+	Message        string        `json:"message"`
+	WorkspacePath  string        `json:"workspacePath"`
+	APIKey         string        `json:"apiKey,omitempty"`
+	History        []ChatMessage `json:"history,omitempty"` // Ignored for stored conversations
+	AIPreset       int           `json:"aiPreset,omitempty"`
+	ConversationID int           `json:"conversationId,omitempty"` // Stored thread to continue
+	ArtifactType   string        `json:"artifactType,omitempty"`   // capability, enabler or story a new thread is about
+	ArtifactID     string        `json:"artifactId,omitempty"`
 }
 
 // ChatMessage represents a single message in the conversation
@@ -44,9 +55,17 @@ type ChatMessage struct {
 
 // ChatResponse represents the response from Claude
 type ChatResponse struct {
-	Response string   `json:"response"`
-	Files    []string `json:"files,omitempty"`
-	Error    string   `json:"error,omitempty"`
+	Response       string              `json:"response"`
+	Files          []string            `json:"files,omitempty"`
+	ToolCalls      []ToolCall          `json:"toolCalls,omitempty"`      // Tools Claude used, in order
+	FileChanges    []models.FileChange `json:"fileChanges,omitempty"`    // Files Claude created or modified
+	Steps          int                 `json:"steps,omitempty"`          // Model calls made
+	Tokens         int                 `json:"tokens,omitempty"`         // Input and output tokens used
+	StopReason     string              `json:"stopReason,omitempty"`     // Why Claude stopped, e.g. end_turn or step_limit
+	Governance     *GovernanceReport   `json:"governance,omitempty"`     // How the changes fared against the workspace's AI policy
+	ConversationID int                 `json:"conversationId,omitempty"` // Stored thread the message was added to
+	SessionID      string              `json:"sessionId,omitempty"`      // Claude CLI session to continue
+	Error          string              `json:"error,omitempty"`
 }
 
 // HandleAIChat handles AI chat requests with workspace-scoped file access
@@ -74,8 +93,17 @@ func (h *Handler) HandleAIChat(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Continue a stored conversation, or start one in a registered workspace
+	conv, err := h.chatConversation(r, &req)
+	if err != nil {
+		json.NewEncoder(w).Encode(ChatResponse{
+			Error: fmt.Sprintf("Failed to load conversation: %v", err),
+		})
+		return
+	}
+
 	// Validate and resolve workspace path
-	workspacePath := req.WorkspacePath
+	workspacePath := scopedWorkspacePath(r, req.WorkspacePath)
 	if workspacePath == "" {
 		json.NewEncoder(w).Encode(ChatResponse{
 			Error: "No workspace path provided. Please select a workspace with a configured project folder.",
@@ -107,48 +135,96 @@ func (h *Handler) HandleAIChat(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	sandbox, err := newWorkspaceSandbox(workspacePath)
+	if err != nil {
+		json.NewEncoder(w).Encode(ChatResponse{
+			Error: fmt.Sprintf("Workspace folder not found or not accessible: %s", workspacePath),
+		})
+		return
+	}
+
+	// Check the files Claude writes against the workspace's AI policy
+	requestedPreset := 0
+	if req.AIPreset >= 1 && req.AIPreset <= 5 {
+		requestedPreset = req.AIPreset
+	}
+	rules, err := workspaceRules(workspacePath, requestedPreset)
+	if err != nil {
+		json.NewEncoder(w).Encode(ChatResponse{
+			Error: fmt.Sprintf("Failed to load AI policy rules: %v", err),
+		})
+		return
+	}
+	if rules != nil {
+		sandbox.governor = &governor{rules: rules}
+	}
+
+	// Tests run code Claude may have written, so run_tests is only offered in workspaces that
+	// allow it, and only when the service can run tests away from its own user
+	if ws, ok := r.Context().Value("workspace").(*models.Workspace); ok && allowsRunTests(ws) {
+		sandbox.tests = h.service.tests
+	}
+
 	// Get list of files in workspace for context
 	files, err := listWorkspaceFiles(workspacePath, 3) // Max depth of 3
 	if err != nil {
 		files = []string{"Error reading workspace files"}
 	}
 
-	// Build system prompt with workspace context
-	systemPrompt := buildSystemPrompt(workspacePath, files)
+	a := newAgent(apiKey, sandbox)
+	promptCtx, systemPrompt, err := renderPrompt(r.Context(), h.service.promptLibrary(), "chat-system", workspacePath, map[string]interface{}{
+		"WorkspacePath": workspacePath,
+		"Files":         files,
+	})
+	if err != nil {
+		json.NewEncoder(w).Encode(ChatResponse{
+			Error: fmt.Sprintf("Failed to build system prompt: %v", err),
+		})
+		return
+	}
+
+	if rules != nil {
+		systemPrompt += "\n\n" + describeRules(rules)
+	}
+
+	// Point Claude at the passages most relevant to the message up front
+	relevant, err := h.service.retrievedContext(r.Context(), workspacePath, "", req.Message, chatContextTokens)
+	if err != nil {
+		log.Printf("Failed to retrieve chat context: %v", err)
+	}
+	if relevant != "" {
+		systemPrompt += "\n\nWorkspace passages that look relevant to the request (read the files for more):\n\n" + relevant
+	}
 
-	// Build messages for Claude
+	// Build messages for Claude, from the stored conversation when there is one
 	messages := make([]ClaudeMessage, 0)
-	for _, msg := range req.History {
-		messages = append(messages, ClaudeMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
-		})
+	if conv != nil {
+		summary, history, err := h.service.conversationHistory(r.Context(), a, conv)
+		if err != nil {
+			json.NewEncoder(w).Encode(ChatResponse{
+				Error: fmt.Sprintf("Failed to load conversation: %v", err),
+			})
+			return
+		}
+		if summary != "" {
+			systemPrompt += "\n\nSummary of the earlier conversation:\n" + summary
+		}
+		messages = append(messages, history...)
+	} else {
+		for _, msg := range req.History {
+			messages = append(messages, ClaudeMessage{
+				Role:    msg.Role,
+				Content: msg.Content,
+			})
+		}
 	}
 	messages = append(messages, ClaudeMessage{
 		Role:    "user",
 		Content: req.Message,
 	})
 
-	// Prepend system prompt to first message
-	if len(messages) > 0 {
-		if content, ok := messages[0].Content.(string); ok {
-			messages[0].Content = systemPrompt + "\n\n" + content
-		}
-	} else {
-		messages = append(messages, ClaudeMessage{
-			Role:    "user",
-			Content: systemPrompt + "\n\n" + req.Message,
-		})
-	}
-
-	// Call Claude API
-	claudeReq := ClaudeRequest{
-		Model:     "claude-sonnet-4-20250514",
-		MaxTokens: 4096,
-		Messages:  messages,
-	}
-
-	response, err := callClaudeAPIForChat(apiKey, claudeReq)
+	// Let Claude use the workspace tools until it has finished
+	result, err := a.run(promptCtx, systemPrompt, messages)
 	if err != nil {
 		json.NewEncoder(w).Encode(ChatResponse{
 			Error: fmt.Sprintf("Claude API error: %v", err),
@@ -156,45 +232,34 @@ func (h *Handler) HandleAIChat(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Process response - handle file operations if requested
-	processedResponse := processClaudeResponse(response, workspacePath)
+	var report *GovernanceReport
+	if g := sandbox.governor; g != nil {
+		entry := requestAuditEntry(r, workspacePath)
+		entry.Files, entry.Violations = g.finish(result.FileChanges, sandbox.root)
+		entry.Blocked = g.blocked
+		report = h.service.recordAudit(entry, g.rules)
+	}
+
+	conversationID := 0
+	if conv != nil {
+		h.service.recordChat(conv, req.Message, result)
+		conversationID = conv.ID
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(ChatResponse{
-		Response: processedResponse,
-		Files:    files,
+		Response:       result.Response,
+		Files:          files,
+		ToolCalls:      result.ToolCalls,
+		FileChanges:    result.FileChanges,
+		Steps:          result.Steps,
+		Tokens:         result.Tokens,
+		StopReason:     result.StopReason,
+		Governance:     report,
+		ConversationID: conversationID,
 	})
 }
 
-// buildSystemPrompt creates the system prompt with workspace context
-func buildSystemPrompt(workspacePath string, files []string) string {
-	fileList := strings.Join(files, "\n  - ")
-
-	return fmt.Sprintf(`You are an AI assistant for the UbeCode design-driven development platform. You help users with their software projects.
-
-IMPORTANT: You are STRICTLY scoped to work only within this workspace folder:
-%s
-
-Files in this workspace:
-  - %s
-
-You can:
-1. Read files from this workspace by referencing their paths
-2. Create new files in this workspace
-3. Modify existing files in this workspace
-4. Analyze code and provide suggestions
-5. Generate code based on requirements
-
-When you need to read a file, use the format: [READ_FILE: relative/path/to/file]
-When you need to write a file, use the format: [WRITE_FILE: relative/path/to/file]
-<<<content>>>
-[END_FILE]
-
-NEVER access files outside of: %s
-
-Be helpful, concise, and focus on the user's specific requests related to their project.`, workspacePath, fileList, workspacePath)
-}
-
 // listWorkspaceFiles lists files in the workspace directory
 func listWorkspaceFiles(root string, maxDepth int) ([]string, error) {
 	var files []string
@@ -239,135 +304,12 @@ func listWorkspaceFiles(root string, maxDepth int) ([]string, error) {
 }
 
 // callClaudeAPIForChat makes a request to the Claude API for chat
-func callClaudeAPIForChat(apiKey string, req ClaudeRequest) (string, error) {
-	jsonData, err := json.Marshal(req)
+func callClaudeAPIForChat(ctx context.Context, apiKey string, req ClaudeRequest) (string, error) {
+	resp, err := NewAnthropicClient(apiKey).send(ctx, req)
 	if err != nil {
 		return "", err
 	}
-
-	httpReq, err := http.NewRequest("POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", err
-	}
-
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("x-api-key", apiKey)
-	httpReq.Header.Set("anthropic-version", "2023-06-01")
-
-	client := &http.Client{}
-	resp, err := client.Do(httpReq)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-
-	// Check for HTTP error status
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API error (%d): %s", resp.StatusCode, string(body))
-	}
-
-	var claudeResp ClaudeResponse
-	if err := json.Unmarshal(body, &claudeResp); err != nil {
-		return "", fmt.Errorf("failed to parse response: %v", err)
-	}
-
-	if len(claudeResp.Content) > 0 {
-		return claudeResp.Content[0].Text, nil
-	}
-
-	return "", fmt.Errorf("empty response from Claude")
-}
-
-// processClaudeResponse processes the response and handles file operations
-func processClaudeResponse(response string, workspacePath string) string {
-	// Process READ_FILE commands
-	for strings.Contains(response, "[READ_FILE:") {
-		start := strings.Index(response, "[READ_FILE:")
-		end := strings.Index(response[start:], "]")
-		if end == -1 {
-			break
-		}
-
-		filePath := strings.TrimSpace(response[start+11 : start+end])
-		fullPath := filepath.Join(workspacePath, filePath)
-
-		// Security check - ensure path is within workspace
-		if !strings.HasPrefix(fullPath, workspacePath) {
-			response = strings.Replace(response, response[start:start+end+1], "[ERROR: Access denied - file outside workspace]", 1)
-			continue
-		}
-
-		content, err := os.ReadFile(fullPath)
-		if err != nil {
-			response = strings.Replace(response, response[start:start+end+1], fmt.Sprintf("[ERROR: %v]", err), 1)
-		} else {
-			response = strings.Replace(response, response[start:start+end+1], string(content), 1)
-		}
-	}
-
-	// Process WRITE_FILE commands
-	for strings.Contains(response, "[WRITE_FILE:") {
-		start := strings.Index(response, "[WRITE_FILE:")
-		pathEnd := strings.Index(response[start:], "]")
-		if pathEnd == -1 {
-			break
-		}
-
-		filePath := strings.TrimSpace(response[start+12 : start+pathEnd])
-
-		// Find content between <<< and >>> or [END_FILE]
-		contentStart := strings.Index(response[start:], "<<<")
-		contentEnd := strings.Index(response[start:], ">>>")
-		if contentEnd == -1 {
-			contentEnd = strings.Index(response[start:], "[END_FILE]")
-		}
-
-		if contentStart == -1 || contentEnd == -1 {
-			break
-		}
-
-		content := response[start+contentStart+3 : start+contentEnd]
-		content = strings.TrimSpace(content)
-
-		fullPath := filepath.Join(workspacePath, filePath)
-
-		// Security check - ensure path is within workspace
-		if !strings.HasPrefix(fullPath, workspacePath) {
-			endMarker := start + contentEnd + 3
-			if strings.HasPrefix(response[start+contentEnd:], "[END_FILE]") {
-				endMarker = start + contentEnd + 10
-			}
-			response = strings.Replace(response, response[start:endMarker], "[ERROR: Access denied - file outside workspace]", 1)
-			continue
-		}
-
-		// Create directory if needed
-		dir := filepath.Dir(fullPath)
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			endMarker := start + contentEnd + 3
-			response = strings.Replace(response, response[start:endMarker], fmt.Sprintf("[ERROR: %v]", err), 1)
-			continue
-		}
-
-		// Write file
-		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
-			endMarker := start + contentEnd + 3
-			response = strings.Replace(response, response[start:endMarker], fmt.Sprintf("[ERROR: %v]", err), 1)
-		} else {
-			endMarker := start + contentEnd + 3
-			if strings.HasPrefix(response[start+contentEnd:], "[END_FILE]") {
-				endMarker = start + contentEnd + 10
-			}
-			response = strings.Replace(response, response[start:endMarker], fmt.Sprintf("[FILE WRITTEN: %s]", filePath), 1)
-		}
-	}
-
-	return response
+	return resp.Content[0].Text, nil
 }
 
 // GenerateCodeRequest represents a code generation request
@@ -377,6 +319,7 @@ type GenerateCodeRequest struct {
 	AIPreset         int    `json:"aiPreset"`
 	UIFramework      string `json:"uiFramework,omitempty"`
 	AdditionalPrompt string `json:"additionalPrompt,omitempty"`
+	UserID           int    `json:"userId,omitempty"` // Notified when generation finishes
 }
 
 // CodeFilesRequest represents a request to list code files
@@ -411,7 +354,7 @@ func (h *Handler) HandleCodeFiles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	workspacePath := req.WorkspacePath
+	workspacePath := scopedWorkspacePath(r, req.WorkspacePath)
 	if workspacePath == "" {
 		json.NewEncoder(w).Encode(CodeFilesResponse{
 			Error: "No workspace path provided.",
@@ -491,7 +434,7 @@ func (h *Handler) HandleRunApp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	workspacePath := req.WorkspacePath
+	workspacePath := scopedWorkspacePath(r, req.WorkspacePath)
 	if workspacePath == "" {
 		json.NewEncoder(w).Encode(RunAppResponse{
 			Error: "No workspace path provided.",
@@ -575,7 +518,7 @@ func (h *Handler) HandleStopApp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	workspacePath := req.WorkspacePath
+	workspacePath := scopedWorkspacePath(r, req.WorkspacePath)
 	if workspacePath == "" {
 		json.NewEncoder(w).Encode(RunAppResponse{
 			Error: "No workspace path provided.",
@@ -676,7 +619,7 @@ func (h *Handler) HandleGenerateCode(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate workspace path
-	workspacePath := req.WorkspacePath
+	workspacePath := scopedWorkspacePath(r, req.WorkspacePath)
 	if workspacePath == "" {
 		json.NewEncoder(w).Encode(ChatResponse{
 			Error: "No workspace path provided.",
@@ -684,6 +627,38 @@ func (h *Handler) HandleGenerateCode(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The key stays out of the stored job parameters
+	req.WorkspacePath = workspacePath
+	req.APIKey = ""
+	job := h.runJob(w, r, models.JobGenerateCode, workspacePath, req, apiKey)
+	if job == nil {
+		return
+	}
+
+	var resp ChatResponse
+	if err := jobResult(job, &resp); err != nil {
+		resp = ChatResponse{Error: err.Error()}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// generateCode is the generate_code job: it builds a prompt from the workspace's
+// specifications and AI principles, calls Claude and writes the returned files to ./code
+func (s *Service) generateCode(ctx context.Context, t *jobs.Task) (interface{}, error) {
+	var req GenerateCodeRequest
+	if err := t.Params(&req); err != nil {
+		return nil, err
+	}
+	apiKey := t.Secret()
+	if apiKey == "" {
+		apiKey = os.Getenv("ANTHROPIC_API_KEY")
+	}
+	if apiKey == "" {
+		return nil, errSecretUnavailable
+	}
+	workspacePath := req.WorkspacePath
+
 	if !filepath.IsAbs(workspacePath) {
 		cwd, _ := os.Getwd()
 		workspacePath = filepath.Join(cwd, workspacePath)
@@ -691,28 +666,20 @@ func (h *Handler) HandleGenerateCode(w http.ResponseWriter, r *http.Request) {
 
 	info, err := os.Stat(workspacePath)
 	if err != nil || !info.IsDir() {
-		json.NewEncoder(w).Encode(ChatResponse{
-			Error: fmt.Sprintf("Workspace folder not found: %s", workspacePath),
-		})
-		return
+		return nil, jobs.Permanent(fmt.Errorf("Workspace folder not found: %s", workspacePath))
 	}
 
 	// Validate AI preset
 	if req.AIPreset < 1 || req.AIPreset > 5 {
-		json.NewEncoder(w).Encode(ChatResponse{
-			Error: "Invalid AI preset. Must be between 1 and 5.",
-		})
-		return
+		return nil, jobs.Permanent(errors.New("Invalid AI preset. Must be between 1 and 5."))
 	}
 
 	// Read AI Principles Preset file
+	t.Progress(5, "Reading specifications")
 	aiPrinciplesPath := filepath.Join("/root/AI_Principles", fmt.Sprintf("AI_PRINCIPLES_Preset_%d.md", req.AIPreset))
 	aiPrinciplesContent, err := os.ReadFile(aiPrinciplesPath)
 	if err != nil {
-		json.NewEncoder(w).Encode(ChatResponse{
-			Error: fmt.Sprintf("Failed to read AI Principles Preset: %v", err),
-		})
-		return
+		return nil, jobs.Permanent(fmt.Errorf("Failed to read AI Principles Preset: %v", err))
 	}
 
 	// Read all specification files
@@ -735,57 +702,35 @@ func (h *Handler) HandleGenerateCode(w http.ResponseWriter, r *http.Request) {
 	})
 
 	if err != nil || len(specContents) == 0 {
-		json.NewEncoder(w).Encode(ChatResponse{
-			Error: "No specification files found in ./specifications folder.",
-		})
-		return
+		return nil, jobs.Permanent(errors.New("No specification files found in ./specifications folder."))
 	}
 
-	// Build UI Framework section
-	uiFrameworkSection := ""
-	if req.UIFramework != "" {
-		uiFrameworkSection = fmt.Sprintf("\n## UI FRAMEWORK\n\nApply the following UI Framework: %s\n", req.UIFramework)
+	// Cut the specs to what fits the context window
+	specs := strings.Join(specContents, "\n\n---\n\n")
+	if retrieval.EstimateTokens(specs) > specContextTokens {
+		t.Logf("Specifications exceed %d tokens and were cut to fit", specContextTokens)
+		specs = retrieval.Truncate(specs, specContextTokens)
 	}
 
 	// Build the prompt
-	prompt := fmt.Sprintf(`You are following the AI governance principles defined below. Please strictly adhere to these principles while developing the application.
-
-## AI PRINCIPLES PRESET %d
-
-%s
-%s
-## SPECIFICATION FILES
-
-%s
-
-## INSTRUCTION
-
-Claude, please follow the AI_PRINCIPLES_Preset_%d.md and develop the application from all the specification markdown files above, applying the currently active UI Framework for this workspace.
-
-Generate the complete code for the application based on these specifications, following all the governance principles strictly.
-
-IMPORTANT: Output each file using this EXACT format so the system can parse and save them:
-
-[FILE: relative/path/to/filename.ext]
-file content here
-[/FILE]
-
-For example:
-[FILE: src/index.js]
-console.log("Hello");
-[/FILE]
-
-Output all necessary files for the complete application. Each file must be wrapped in [FILE: path] and [/FILE] tags.`,
-		req.AIPreset,
-		string(aiPrinciplesContent),
-		uiFrameworkSection,
-		strings.Join(specContents, "\n\n---\n\n"),
-		req.AIPreset)
+	ctx, prompt, err := renderPrompt(ctx, s.promptLibrary(), "code-generation", workspacePath, map[string]interface{}{
+		"AIPreset":               req.AIPreset,
+		"AIPrinciples":           string(aiPrinciplesContent),
+		"UIFramework":            req.UIFramework,
+		"Specifications":         specs,
+		"AdditionalInstructions": req.AdditionalPrompt,
+	})
+	if err != nil {
+		return nil, jobs.Permanent(err)
+	}
 
-	// Add additional prompt if provided
-	if req.AdditionalPrompt != "" {
-		prompt += "\n\n## ADDITIONAL INSTRUCTIONS\n\n" + req.AdditionalPrompt
+	// Hold the generated files to the workspace's AI policy rules
+	rules, err := workspaceRules(workspacePath, req.AIPreset)
+	if err != nil {
+		return nil, jobs.Permanent(fmt.Errorf("Failed to load AI policy rules: %v", err))
 	}
+	prompt += "\n\n" + describeRules(rules) + "Paths are checked relative to the workspace, so your files are under code/.\n"
+	t.Logf("Using prompt %s", promptRef(ctx))
 
 	// Call Claude API
 	claudeReq := ClaudeRequest{
@@ -796,25 +741,49 @@ Output all necessary files for the complete application. Each file must be wrapp
 		},
 	}
 
-	response, err := callClaudeAPIForChat(apiKey, claudeReq)
+	t.Logf("Sending %d specification file(s) to Claude", len(specContents))
+	t.Progress(20, "Waiting for Claude")
+	response, err := callClaudeAPIForChat(ctx, apiKey, claudeReq)
 	if err != nil {
-		json.NewEncoder(w).Encode(ChatResponse{
-			Error: fmt.Sprintf("Claude API error: %v", err),
-		})
-		return
+		if t.FinalAttempt() {
+			s.NotifyAIGenerationFinished(req.UserID, workspacePath, "Code generation failed.", err.Error())
+		}
+		return nil, fmt.Errorf("Claude API error: %v", err)
+	}
+
+	// Check the files against the AI policy rules before writing any of them
+	files := parseCodeFiles(response)
+	plan := make([]governance.Change, len(files))
+	for i, f := range files {
+		plan[i] = governance.Change{Path: "code/" + filepath.ToSlash(f.Path), Content: f.Content}
+	}
+	audit := s.jobAuditEntry(t.Job, workspacePath)
+	audit.Violations = governance.CheckPlan(rules, plan, workspaceFileExists(workspacePath))
+	for _, v := range audit.Violations {
+		t.Warnf("AI policy: %s", v.Message)
+	}
+	if governance.Blocks(rules) && len(audit.Violations) > 0 {
+		audit.Blocked = true
+		s.recordAudit(audit, rules)
+		err := fmt.Errorf("generated code breaks AI policy preset %d: %s", rules.Preset, violationMessages(audit.Violations))
+		s.NotifyAIGenerationFinished(req.UserID, workspacePath, "Code generation failed.", err.Error())
+		return nil, jobs.Permanent(err)
 	}
 
 	// Create ./code directory
 	codePath := filepath.Join(workspacePath, "code")
 	if err := os.MkdirAll(codePath, 0755); err != nil {
-		json.NewEncoder(w).Encode(ChatResponse{
-			Error: fmt.Sprintf("Failed to create code directory: %v", err),
-		})
-		return
+		return nil, jobs.Permanent(fmt.Errorf("Failed to create code directory: %v", err))
 	}
 
-	// Parse and write files from response
-	filesWritten := parseAndWriteFiles(response, codePath)
+	// Write files from response
+	t.Progress(90, "Writing files")
+	filesWritten := writeCodeFiles(codePath, files)
+	t.Logf("Wrote %d file(s) to ./code", len(filesWritten))
+	for _, f := range filesWritten {
+		audit.Files = append(audit.Files, "code/"+filepath.ToSlash(f))
+	}
+	report := s.recordAudit(audit, rules)
 
 	// Build summary
 	var summary string
@@ -828,15 +797,15 @@ Output all necessary files for the complete application. Each file must be wrapp
 		summary = "No files were parsed from the response. Claude's response:\n\n" + response
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(ChatResponse{
-		Response: summary,
-	})
+	s.NotifyAIGenerationFinished(req.UserID, workspacePath,
+		fmt.Sprintf("Code generation finished: %d file(s) written to ./code.", len(filesWritten)), "")
+
+	return ChatResponse{Response: summary, Governance: report}, nil
 }
 
-// parseAndWriteFiles extracts files from Claude's response and writes them to disk
-func parseAndWriteFiles(response string, codePath string) []string {
-	var filesWritten []string
+// parseCodeFiles extracts the files in Claude's response, with paths relative to ./code
+func parseCodeFiles(response string) []governance.Change {
+	var files []governance.Change
 
 	// Find all [FILE: path] ... [/FILE] blocks
 	remaining := response
@@ -872,34 +841,18 @@ func parseAndWriteFiles(response string, codePath string) []string {
 		// Strip markdown code fences if present (```language ... ```)
 		content = stripCodeFences(content)
 
-		// Write file
-		fullPath := filepath.Join(codePath, filePath)
-
-		// Create parent directories
-		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
-			fmt.Printf("Failed to create directory for %s: %v\n", filePath, err)
-			remaining = remaining[endIdx+7:]
-			continue
-		}
-
-		// Write file
-		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
-			fmt.Printf("Failed to write file %s: %v\n", filePath, err)
-		} else {
-			filesWritten = append(filesWritten, filePath)
-			fmt.Printf("Created file: %s\n", fullPath)
-		}
+		files = append(files, governance.Change{Path: filePath, Content: content})
 
 		// Move past this file block
 		remaining = remaining[endIdx+7:]
 	}
 
 	// If no files were found with [FILE:] format, try alternative markdown format
-	if len(filesWritten) == 0 {
-		filesWritten = parseMarkdownCodeBlocks(response, codePath)
+	if len(files) == 0 {
+		files = parseMarkdownCodeBlocks(response)
 	}
 
-	return filesWritten
+	return files
 }
 
 // stripCodeFences removes markdown code fences from content
@@ -929,8 +882,8 @@ func stripCodeFences(content string) string {
 // parseMarkdownCodeBlocks tries to parse files from markdown format like:
 // **File: path/to/file.js** or ### path/to/file.js
 // followed by code blocks
-func parseMarkdownCodeBlocks(response string, codePath string) []string {
-	var filesWritten []string
+func parseMarkdownCodeBlocks(response string) []governance.Change {
+	var files []governance.Change
 
 	lines := strings.Split(response, "\n")
 	var currentFile string
@@ -944,7 +897,7 @@ func parseMarkdownCodeBlocks(response string, codePath string) []string {
 		if strings.HasPrefix(trimmed, "**File:") && strings.HasSuffix(trimmed, "**") {
 			// Save previous file if any
 			if currentFile != "" && len(currentContent) > 0 {
-				writeCodeFile(codePath, currentFile, strings.Join(currentContent, "\n"), &filesWritten)
+				files = append(files, codeFile(currentFile, currentContent))
 			}
 			// Extract new file path
 			currentFile = strings.TrimSpace(trimmed[7 : len(trimmed)-2])
@@ -953,7 +906,7 @@ func parseMarkdownCodeBlocks(response string, codePath string) []string {
 		} else if strings.HasPrefix(trimmed, "### ") && strings.Contains(trimmed, ".") && !strings.Contains(trimmed, " ") {
 			// Looks like a file path header (### src/index.js)
 			if currentFile != "" && len(currentContent) > 0 {
-				writeCodeFile(codePath, currentFile, strings.Join(currentContent, "\n"), &filesWritten)
+				files = append(files, codeFile(currentFile, currentContent))
 			}
 			currentFile = strings.TrimPrefix(trimmed, "### ")
 			currentContent = nil
@@ -972,7 +925,7 @@ func parseMarkdownCodeBlocks(response string, codePath string) []string {
 					   (strings.HasPrefix(nextTrimmed, "### ") && strings.Contains(nextTrimmed, ".")) {
 						// Write current file
 						if len(currentContent) > 0 {
-							writeCodeFile(codePath, currentFile, strings.Join(currentContent, "\n"), &filesWritten)
+							files = append(files, codeFile(currentFile, currentContent))
 							currentFile = ""
 							currentContent = nil
 						}
@@ -986,29 +939,43 @@ func parseMarkdownCodeBlocks(response string, codePath string) []string {
 
 	// Write last file if any
 	if currentFile != "" && len(currentContent) > 0 {
-		writeCodeFile(codePath, currentFile, strings.Join(currentContent, "\n"), &filesWritten)
+		files = append(files, codeFile(currentFile, currentContent))
 	}
 
-	return filesWritten
+	return files
 }
 
-// writeCodeFile writes a code file to disk
-func writeCodeFile(codePath, filePath, content string, filesWritten *[]string) {
-	fullPath := filepath.Join(codePath, filePath)
+// codeFile is a file parsed from the lines of a markdown code block
+func codeFile(filePath string, lines []string) governance.Change {
+	return governance.Change{Path: filePath, Content: strings.TrimSpace(strings.Join(lines, "\n"))}
+}
 
-	// Create parent directories
-	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
-		fmt.Printf("Failed to create directory for %s: %v\n", filePath, err)
-		return
-	}
+// writeCodeFiles writes parsed files below codePath and returns the paths written.
+// Paths that lead out of codePath are skipped.
+func writeCodeFiles(codePath string, files []governance.Change) []string {
+	var filesWritten []string
+	for _, f := range files {
+		fullPath := filepath.Join(codePath, f.Path)
+		if !within(codePath, fullPath) {
+			fmt.Printf("Skipped file outside ./code: %s\n", f.Path)
+			continue
+		}
 
-	// Write file
-	if err := os.WriteFile(fullPath, []byte(strings.TrimSpace(content)), 0644); err != nil {
-		fmt.Printf("Failed to write file %s: %v\n", filePath, err)
-	} else {
-		*filesWritten = append(*filesWritten, filePath)
-		fmt.Printf("Created file: %s\n", fullPath)
+		// Create parent directories
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			fmt.Printf("Failed to create directory for %s: %v\n", f.Path, err)
+			continue
+		}
+
+		// Write file
+		if err := os.WriteFile(fullPath, []byte(f.Content), 0644); err != nil {
+			fmt.Printf("Failed to write file %s: %v\n", f.Path, err)
+		} else {
+			filesWritten = append(filesWritten, f.Path)
+			fmt.Printf("Created file: %s\n", fullPath)
+		}
 	}
+	return filesWritten
 }
 
 // copyAIPolicyPreset copies the AI Policy Preset file to the workspace implementation folder
@@ -1051,6 +1018,8 @@ type GenerateCodeCLIRequest struct {
 	WorkspacePath    string `json:"workspacePath"`
 	Command          string `json:"command"`
 	AdditionalPrompt string `json:"additionalPrompt,omitempty"`
+	UserID           int    `json:"userId,omitempty"`    // Notified when generation finishes
+	SessionID        string `json:"sessionId,omitempty"` // Continue an earlier run's conversation
 }
 
 // HandleGenerateCodeCLI handles code generation requests using Claude CLI via proxy
@@ -1067,6 +1036,7 @@ func (h *Handler) HandleGenerateCodeCLI(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Validate workspace path
+	req.WorkspacePath = scopedWorkspacePath(r, req.WorkspacePath)
 	if req.WorkspacePath == "" {
 		json.NewEncoder(w).Encode(ChatResponse{
 			Error: "No workspace path provided.",
@@ -1074,48 +1044,151 @@ func (h *Handler) HandleGenerateCodeCLI(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Get proxy URL from environment or use default
-	// When running in Docker, use host.docker.internal to reach the host
-	proxyURL := os.Getenv("CLAUDE_PROXY_URL")
-	if proxyURL == "" {
-		proxyURL = "http://host.docker.internal:9085"
+	if h.service.claudeProxy == nil {
+		json.NewEncoder(w).Encode(ChatResponse{
+			Error: "Claude CLI Proxy is not configured.",
+		})
+		return
 	}
 
-	fmt.Printf("Forwarding request to Claude CLI Proxy at: %s\n", proxyURL)
+	params := generateCodeCLIParams{GenerateCodeCLIRequest: req}
+	if userID := requestUserID(r); userID != nil {
+		params.RequestedBy = fmt.Sprint(*userID)
+	} else if req.UserID != 0 {
+		params.RequestedBy = fmt.Sprint(req.UserID)
+	}
+	job := h.runJob(w, r, models.JobGenerateCodeCLI, req.WorkspacePath, params, "")
+	if job == nil {
+		return
+	}
 
-	// Forward request to the Claude CLI proxy running on the host
-	proxyReq := map[string]string{
-		"workspacePath":    req.WorkspacePath,
-		"command":          req.Command,
-		"additionalPrompt": req.AdditionalPrompt,
+	var resp ChatResponse
+	if err := jobResult(job, &resp); err != nil {
+		resp = ChatResponse{Error: err.Error()}
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
 
-	proxyBody, err := json.Marshal(proxyReq)
-	if err != nil {
-		json.NewEncoder(w).Encode(ChatResponse{
-			Error: fmt.Sprintf("Failed to marshal proxy request: %v", err),
-		})
-		return
+// generateCodeCLIParams are the stored parameters of a generate_code_cli job
+type generateCodeCLIParams struct {
+	GenerateCodeCLIRequest
+	RequestedBy string `json:"requestedBy,omitempty"` // Recorded in the proxy's audit log
+}
+
+// generateCodeCLI is the generate_code_cli job: it runs the Claude CLI through the proxy
+// on the host and logs what the CLI does as it goes. Cancelling the job aborts the request,
+// which kills the CLI.
+func (s *Service) generateCodeCLI(ctx context.Context, t *jobs.Task) (interface{}, error) {
+	var p generateCodeCLIParams
+	if err := t.Params(&p); err != nil {
+		return nil, err
+	}
+	if s.claudeProxy == nil {
+		return nil, jobs.Permanent(errors.New("Claude CLI Proxy is not configured."))
+	}
+
+	if err := checkBudget(ctx); err != nil {
+		return nil, err
 	}
 
-	resp, err := http.Post(proxyURL+"/execute", "application/json", bytes.NewBuffer(proxyBody))
+	// The CLI edits files itself, so its changes can only be checked once it has made them
+	rules, err := workspaceRules(p.WorkspacePath, 0)
 	if err != nil {
-		json.NewEncoder(w).Encode(ChatResponse{
-			Error: fmt.Sprintf("Failed to connect to Claude CLI Proxy at %s. Make sure the proxy is running on the host. Error: %v", proxyURL, err),
-		})
-		return
+		return nil, jobs.Permanent(fmt.Errorf("Failed to load AI policy rules: %v", err))
+	}
+	additionalPrompt := p.AdditionalPrompt
+	if rules != nil {
+		additionalPrompt = strings.TrimSpace(additionalPrompt + "\n\n" + describeRules(rules))
+	}
+
+	t.Progress(10, "Running Claude CLI")
+	var edited []string
+	seen := map[string]bool{}
+	started := time.Now()
+	result, err := s.claudeProxy.Stream(ctx, client.ClaudeProxyRequest{
+		WorkspacePath:    p.WorkspacePath,
+		Command:          p.Command,
+		AdditionalPrompt: additionalPrompt,
+		RequestedBy:      p.RequestedBy,
+		SessionID:        p.SessionID,
+	}, func(e client.ClaudeProxyEvent) {
+		switch e.Type {
+		case client.ProxyEventFileEdit:
+			if !seen[e.Path] {
+				seen[e.Path] = true
+				edited = append(edited, e.Path)
+			}
+			t.Progress(10, fmt.Sprintf("Claude CLI has edited %d file(s)", len(edited)))
+		case client.ProxyEventResult:
+			recordCLIUsage(ctx, e, time.Since(started))
+		}
+		logProxyEvent(t, e)
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("Failed to reach Claude CLI Proxy. Make sure the proxy is running on the host. Error: %v", err)
+	}
+	if result.Error != "" {
+		s.NotifyAIGenerationFinished(p.UserID, p.WorkspacePath, "Claude CLI generation failed.", result.Error)
+		return nil, jobs.Permanent(errors.New(result.Error))
 	}
-	defer resp.Body.Close()
 
-	// Read and forward the response
-	var proxyResp ChatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&proxyResp); err != nil {
-		json.NewEncoder(w).Encode(ChatResponse{
-			Error: fmt.Sprintf("Failed to decode proxy response: %v", err),
-		})
-		return
+	var report *GovernanceReport
+	if rules != nil {
+		audit := s.jobAuditEntry(t.Job, p.WorkspacePath)
+		audit.Files = edited
+		audit.Violations = checkEditedFiles(rules, p.WorkspacePath, edited)
+		for _, v := range audit.Violations {
+			t.Warnf("AI policy: %s", v.Message)
+		}
+		report = s.recordAudit(audit, rules)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(proxyResp)
+	s.NotifyAIGenerationFinished(p.UserID, p.WorkspacePath, "Claude CLI generation finished.", "")
+	return ChatResponse{Response: result.Response, SessionID: result.SessionID, Governance: report}, nil
+}
+
+// checkEditedFiles checks the files the Claude CLI edited against rules. Files that cannot
+// be read here, because they were deleted or the workspace is only on the proxy's host,
+// are checked by path alone.
+func checkEditedFiles(rules *models.AIRuleSet, workspacePath string, edited []string) []models.AIViolation {
+	var violations []models.AIViolation
+	plan := make([]governance.Change, len(edited))
+	for i, p := range edited {
+		data, err := os.ReadFile(filepath.Join(workspacePath, filepath.FromSlash(p)))
+		plan[i] = governance.Change{Path: p, Content: string(data)}
+		for _, v := range governance.CheckFile(rules, plan[i]) {
+			if err == nil || v.Rule == models.AIRuleForbiddenPath {
+				violations = append(violations, v)
+			}
+		}
+	}
+	return append(violations, governance.CheckCoverage(rules, plan, workspaceFileExists(workspacePath))...)
+}
+
+// logProxyEvent copies a Claude CLI event into the job log, which /jobs/{id}/events relays
+func logProxyEvent(t *jobs.Task, e client.ClaudeProxyEvent) {
+	switch e.Type {
+	case client.ProxyEventSession:
+		t.Logf("Claude CLI session %s", e.SessionID)
+	case client.ProxyEventText:
+		t.Logf("%s", e.Text)
+	case client.ProxyEventToolUse:
+		t.Logf("%s %s", e.Tool, e.Input)
+	case client.ProxyEventFileEdit:
+		t.Logf("Edited %s", e.Path)
+	case client.ProxyEventToolResult:
+		if e.IsError {
+			t.Warnf("Tool failed: %s", e.Text)
+		}
+	case client.ProxyEventResult:
+		if e.CostUSD > 0 {
+			t.Logf("Finished after %d turn(s), $%.4f", e.Turns, e.CostUSD)
+		}
+	case client.ProxyEventError:
+		t.Warnf("%s", e.Error)
+	}
 }
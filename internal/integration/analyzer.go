@@ -15,19 +15,26 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/prompts"
 )
 
 // AnthropicClient handles communication with Anthropic API
 type AnthropicClient struct {
 	apiKey     string
+	url        string
 	httpClient *http.Client
+	prompts    *prompts.Library
 }
 
 // NewAnthropicClient creates a new Anthropic API client
 func NewAnthropicClient(apiKey string) *AnthropicClient {
 	return &AnthropicClient{
 		apiKey:     apiKey,
+		url:        anthropicMessageURL,
 		httpClient: &http.Client{},
+		prompts:    builtinPrompts,
 	}
 }
 
@@ -59,34 +66,13 @@ func (ac *AnthropicClient) AnalyzeIntegrationAPI(ctx context.Context, providerUR
 		return nil, fmt.Errorf("failed to fetch API documentation: %w", err)
 	}
 
-	// Prepare the prompt for Claude
-	prompt := fmt.Sprintf(`You are an API integration analyst. Analyze the following API documentation for %s and provide a structured analysis.
-
-API Documentation:
-%s
-
-Please analyze this API and provide a JSON response with the following structure:
-{
-  "integration_name": "Name of the integration",
-  "description": "Brief description of what this integration does",
-  "auth_method": "Authentication method (e.g., 'API Key', 'OAuth 2.0', 'Bearer Token')",
-  "required_fields": [
-    {
-      "name": "field_name",
-      "type": "string|number|boolean|array",
-      "description": "What this field is for",
-      "example": "example value",
-      "required": true
-    }
-  ],
-  "optional_fields": [similar structure],
-  "capabilities": ["List of things this integration can do"],
-  "sample_endpoints": {
-    "endpoint_name": "endpoint_url"
-  }
-}
-
-Focus on practical configuration needs. For authentication, identify what credentials are needed. For capabilities, list what data can be retrieved or actions can be performed.`, providerName, apiDoc)
+	ctx, prompt, err := renderPrompt(ctx, ac.prompts, "integration-analysis", "", map[string]interface{}{
+		"ProviderName":  providerName,
+		"Documentation": apiDoc,
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	// Call Claude API
 	analysis, err := ac.callClaudeAPI(ctx, prompt, providerName)
@@ -126,9 +112,17 @@ func (ac *AnthropicClient) fetchAPIDocumentation(ctx context.Context, url string
 
 // ClaudeRequest represents a request to the Anthropic API
 type ClaudeRequest struct {
-	Model     string          `json:"model"`
-	MaxTokens int             `json:"max_tokens"`
-	Messages  []ClaudeMessage `json:"messages"`
+	Model      string          `json:"model"`
+	MaxTokens  int             `json:"max_tokens"`
+	Messages   []ClaudeMessage `json:"messages"`
+	Tools      []agentTool     `json:"tools,omitempty"`
+	ToolChoice *toolChoice     `json:"tool_choice,omitempty"`
+}
+
+// toolChoice tells the model which tool to use; {"type": "tool", "name": ...} forces one
+type toolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
 }
 
 // ClaudeMessage represents a message in the conversation
@@ -153,24 +147,25 @@ type ImageSource struct {
 
 // ClaudeResponse represents the response from Anthropic API
 type ClaudeResponse struct {
-	ID      string `json:"id"`
-	Content []struct {
-		Type string `json:"type"`
-		Text string `json:"text"`
-	} `json:"content"`
+	ID         string       `json:"id"`
+	Content    []agentBlock `json:"content"`
+	StopReason string       `json:"stop_reason"`
+	Usage      ClaudeUsage  `json:"usage"`
 }
 
-// callClaudeAPI makes a request to the Anthropic Claude API
-func (ac *AnthropicClient) callClaudeAPI(ctx context.Context, prompt string, providerName string) (*IntegrationAnalysis, error) {
-	reqBody := ClaudeRequest{
-		Model:     "claude-3-haiku-20240307",
-		MaxTokens: 4096,
-		Messages: []ClaudeMessage{
-			{
-				Role:    "user",
-				Content: prompt,
-			},
-		},
+// ClaudeUsage is the token usage the Anthropic API reports for a request
+type ClaudeUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// send posts a request to the Messages API and records its usage for the request or job
+// in ctx. It refuses to call the API once an AI budget of that request or job is spent.
+func (ac *AnthropicClient) send(ctx context.Context, reqBody ClaudeRequest) (*ClaudeResponse, error) {
+	if err := checkBudget(ctx); err != nil {
+		return nil, err
 	}
 
 	jsonData, err := json.Marshal(reqBody)
@@ -178,7 +173,7 @@ func (ac *AnthropicClient) callClaudeAPI(ctx context.Context, prompt string, pro
 		return nil, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", ac.url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, err
 	}
@@ -187,6 +182,7 @@ func (ac *AnthropicClient) callClaudeAPI(ctx context.Context, prompt string, pro
 	req.Header.Set("x-api-key", ac.apiKey)
 	req.Header.Set("anthropic-version", "2023-06-01")
 
+	started := time.Now()
 	resp, err := ac.httpClient.Do(req)
 	if err != nil {
 		return nil, err
@@ -202,24 +198,31 @@ func (ac *AnthropicClient) callClaudeAPI(ctx context.Context, prompt string, pro
 	if err := json.NewDecoder(resp.Body).Decode(&claudeResp); err != nil {
 		return nil, err
 	}
+	recordUsage(ctx, reqBody.Model, claudeResp.Usage, time.Since(started))
 
-	// Extract the JSON from Claude's response
 	if len(claudeResp.Content) == 0 {
 		return nil, fmt.Errorf("no content in Claude response")
 	}
+	return &claudeResp, nil
+}
 
-	responseText := claudeResp.Content[0].Text
-
-	// Try to extract JSON from markdown first (Claude often wraps responses)
-	extractedJSON := extractJSONFromMarkdown(responseText)
+// callClaudeAPI makes a request to the Anthropic Claude API
+func (ac *AnthropicClient) callClaudeAPI(ctx context.Context, prompt string, providerName string) (*IntegrationAnalysis, error) {
+	reqBody := ClaudeRequest{
+		Model:     "claude-3-haiku-20240307",
+		MaxTokens: 4096,
+		Messages: []ClaudeMessage{
+			{
+				Role:    "user",
+				Content: prompt,
+			},
+		},
+	}
 
-	// Parse the JSON response
 	var analysis IntegrationAnalysis
-	if err := json.Unmarshal([]byte(extractedJSON), &analysis); err != nil {
-		// Log the response for debugging
-		fmt.Printf("DEBUG: Failed to parse Claude response. Raw text (first 500 chars):\n%s\n", responseText[:min(500, len(responseText))])
-		fmt.Printf("DEBUG: Extracted JSON (first 500 chars):\n%s\n", extractedJSON[:min(500, len(extractedJSON))])
-		return nil, fmt.Errorf("failed to parse Claude response: %w", err)
+	if err := ac.SendStructured(ctx, reqBody, "record_integration_analysis",
+		"Record the analysis of the integration's API", &analysis); err != nil {
+		return nil, err
 	}
 
 	// Post-process: Add team_url field for Figma integration
@@ -259,38 +262,15 @@ func (ac *AnthropicClient) SuggestResources(ctx context.Context, req SuggestReso
 		return nil, err
 	}
 
-	prompt := fmt.Sprintf(`You are an integration recommendation assistant. Based on the workspace context and available resources, suggest which resources should be integrated.
-
-Workspace Name: %s
-Workspace Description: %s
-Integration: %s
-
-Available Resources:
-%s
-
-Please analyze these resources and suggest which ones are most relevant for this workspace. Consider:
-1. Resource names and descriptions that match the workspace purpose
-2. Recently updated resources (more likely to be active)
-3. Resources that would provide the most value for collaboration
-
-Provide your response in the following JSON format:
-{
-  "suggestions": [
-    {
-      "resource_id": "resource identifier",
-      "resource_name": "resource name",
-      "reason": "why this resource is relevant",
-      "confidence": 0.85
-    }
-  ],
-  "reasoning": "Overall explanation of the suggestions"
-}
-
-The confidence should be between 0.0 and 1.0, where 1.0 means highly confident this resource should be integrated.`,
-		req.WorkspaceName,
-		req.WorkspaceDesc,
-		req.IntegrationName,
-		string(resourcesJSON))
+	ctx, prompt, err := renderPrompt(ctx, ac.prompts, "resource-suggestion", "", map[string]interface{}{
+		"WorkspaceName":        req.WorkspaceName,
+		"WorkspaceDescription": req.WorkspaceDesc,
+		"IntegrationName":      req.IntegrationName,
+		"Resources":            string(resourcesJSON),
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	// Call Claude API
 	reqBody := ClaudeRequest{
@@ -304,50 +284,10 @@ The confidence should be between 0.0 and 1.0, where 1.0 means highly confident t
 		},
 	}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return nil, err
-	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, err
-	}
-
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("x-api-key", ac.apiKey)
-	httpReq.Header.Set("anthropic-version", "2023-06-01")
-
-	resp, err := ac.httpClient.Do(httpReq)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("Claude API request failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
-	var claudeResp ClaudeResponse
-	if err := json.NewDecoder(resp.Body).Decode(&claudeResp); err != nil {
-		return nil, err
-	}
-
-	if len(claudeResp.Content) == 0 {
-		return nil, fmt.Errorf("no content in Claude response")
-	}
-
-	responseText := claudeResp.Content[0].Text
-
-	// Extract JSON from response
-	extractedJSON := extractJSONFromMarkdown(responseText)
-
 	var suggestions SuggestResourcesResponse
-	if err := json.Unmarshal([]byte(extractedJSON), &suggestions); err != nil {
-		fmt.Printf("DEBUG: Failed to parse suggestions. Raw text (first 500 chars):\n%s\n", responseText[:min(500, len(responseText))])
-		fmt.Printf("DEBUG: Extracted JSON (first 500 chars):\n%s\n", extractedJSON[:min(500, len(extractedJSON))])
-		return nil, fmt.Errorf("failed to parse Claude response: %w", err)
+	if err := ac.SendStructured(ctx, reqBody, "record_resource_suggestions",
+		"Record the resources suggested for the workspace", &suggestions); err != nil {
+		return nil, err
 	}
 
 	return &suggestions, nil
@@ -445,9 +385,9 @@ func findMatchingBrace(data []byte, startIdx int) int {
 	return -1
 }
 
-// SendMessage sends a simple message to Claude and returns the text response
-func (ac *AnthropicClient) SendMessage(ctx context.Context, prompt string) (string, error) {
-	reqBody := ClaudeRequest{
+// messageRequest is the request SendMessage makes for a prompt
+func messageRequest(prompt string) ClaudeRequest {
+	return ClaudeRequest{
 		Model:     "claude-sonnet-4-20250514",
 		MaxTokens: 8192, // Increased for detailed analysis output
 		Messages: []ClaudeMessage{
@@ -457,40 +397,16 @@ func (ac *AnthropicClient) SendMessage(ctx context.Context, prompt string) (stri
 			},
 		},
 	}
+}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", err
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", err
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", ac.apiKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
+// SendMessage sends a simple message to Claude and returns the text response
+func (ac *AnthropicClient) SendMessage(ctx context.Context, prompt string) (string, error) {
+	reqBody := messageRequest(prompt)
 
-	resp, err := ac.httpClient.Do(req)
+	claudeResp, err := ac.send(ctx, reqBody)
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("Claude API request failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
-	var claudeResp ClaudeResponse
-	if err := json.NewDecoder(resp.Body).Decode(&claudeResp); err != nil {
-		return "", err
-	}
-
-	if len(claudeResp.Content) == 0 {
-		return "", fmt.Errorf("no content in Claude response")
-	}
 
 	return claudeResp.Content[0].Text, nil
 }
@@ -534,39 +450,10 @@ func (ac *AnthropicClient) SendMessageWithImages(ctx context.Context, prompt str
 		},
 	}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", err
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", err
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", ac.apiKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
-
-	resp, err := ac.httpClient.Do(req)
+	claudeResp, err := ac.send(ctx, reqBody)
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("Claude API request failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
-	var claudeResp ClaudeResponse
-	if err := json.NewDecoder(resp.Body).Decode(&claudeResp); err != nil {
-		return "", err
-	}
-
-	if len(claudeResp.Content) == 0 {
-		return "", fmt.Errorf("no content in Claude response")
-	}
 
 	return claudeResp.Content[0].Text, nil
 }
@@ -0,0 +1,271 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/jareynolds/ubecode/internal/auth"
+	"github.com/jareynolds/ubecode/pkg/client"
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/jareynolds/ubecode/pkg/search"
+)
+
+// maxInspectedBody caps how much of a JSON body is read to find the workspaces it touches
+const maxInspectedBody = 32 << 20
+
+// TokenVerifier resolves a bearer token to the user behind it
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (*client.TokenInfo, error)
+}
+
+// TokenAuth verifies bearer tokens with the auth service, enforces API token scopes (e.g.
+// ai:generate for the AI endpoints) and checks the caller's role permissions in every
+// workspace the request names, by folder or by ID. Without a verifier nothing is checked
+// (legacy anonymous mode); with one, requests without a token hold no permissions and are
+// rejected by any route that needs one, or by every route when requireAuth is set.
+func TokenAuth(verifier TokenVerifier, requireAuth bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if verifier == nil || r.Method == http.MethodOptions || r.URL.Path == "/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Error responses still need CORS headers for the browser to read them
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		if header == "" && !requireAuth {
+			if auth.PermissionForRequest(r.Method, r.URL.Path) != "" {
+				http.Error(w, "authorization required", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "access", &models.AccessGrant{})))
+			return
+		}
+
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			http.Error(w, "authorization required", http.StatusUnauthorized)
+			return
+		}
+
+		info, err := verifier.Verify(r.Context(), token)
+		if errors.Is(err, client.ErrTokenRejected) {
+			http.Error(w, "invalid or expired token", http.StatusUnauthorized)
+			return
+		}
+		if err != nil || info.Access == nil {
+			log.Printf("Token verification failed: %v", err)
+			http.Error(w, "failed to verify token", http.StatusServiceUnavailable)
+			return
+		}
+
+		claims := &auth.Claims{
+			UserID: info.UserID,
+			Email:  info.Email,
+			Role:   info.Role,
+			Scopes: info.Scopes,
+		}
+		if scope := auth.ScopeForRequest(r.Method, r.URL.Path); !claims.HasScope(scope) {
+			http.Error(w, fmt.Sprintf("token lacks required scope: %s", scope), http.StatusForbidden)
+			return
+		}
+
+		refs, err := requestWorkspaces(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Requests that name no workspace need the permission globally; the workspace list
+		// is filtered by the handler, so a grant in any workspace will do there
+		permission := auth.PermissionForRequest(r.Method, r.URL.Path)
+		if len(refs.folders) == 0 && len(refs.ids) == 0 && !info.Access.Can(permission) &&
+			!(isWorkspaceList(r) && info.Access.CanAnywhere(permission)) {
+			http.Error(w, fmt.Sprintf("missing permission: %s", permission), http.StatusForbidden)
+			return
+		}
+		for _, id := range refs.ids {
+			if !info.Access.CanInWorkspace(permission, &id) {
+				http.Error(w, fmt.Sprintf("missing permission in workspace %d: %s", id, permission), http.StatusForbidden)
+				return
+			}
+		}
+		for _, folder := range refs.folders {
+			if !info.Access.CanInFolder(permission, folder) {
+				http.Error(w, fmt.Sprintf("missing permission in workspace %s: %s", folder, permission), http.StatusForbidden)
+				return
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), "claims", claims)
+		ctx = context.WithValue(ctx, "access", info.Access)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// workspaceRefs are the workspaces a request names, by folder or by registry ID, and the
+// filesystem paths and workspace-relative names it carries
+type workspaceRefs struct {
+	folders []string
+	ids     []int
+	paths   []string // Values of keys naming a path, e.g. workspacePath or filePath
+	names   []string // Values of keys naming something inside the workspace, e.g. fileName
+}
+
+// workspaceRelativeKeys are the lowercased keys whose values are resolved inside the
+// workspace folder by the handlers
+var workspaceRelativeKeys = map[string]bool{"subfolder": true, "filename": true, "relpath": true}
+
+// addField records a query parameter or JSON string by the key holding it
+func (refs *workspaceRefs) addField(key, value string) {
+	lower := strings.ToLower(key)
+	if lower == "relpath" {
+		refs.names = append(refs.names, value)
+	} else if strings.Contains(lower, "path") {
+		refs.paths = append(refs.paths, value)
+	} else if workspaceRelativeKeys[lower] {
+		refs.names = append(refs.names, value)
+	}
+}
+
+func (refs *workspaceRefs) addID(id int) {
+	for _, existing := range refs.ids {
+		if existing == id {
+			return
+		}
+	}
+	refs.ids = append(refs.ids, id)
+}
+
+// isWorkspaceList reports whether r lists the workspace registry
+func isWorkspaceList(r *http.Request) bool {
+	return r.Method == http.MethodGet && strings.TrimSuffix(r.URL.Path, "/") == "/workspaces"
+}
+
+// requestWorkspaces returns the workspaces a request names: folders under workspaces/ in the
+// query string or in path-like fields of a JSON body, and registry IDs in a workspaceId
+// query parameter or body field or in a /workspaces/{id} path. The paths and
+// workspace-relative names it carries are collected too. The body is restored for the
+// handler.
+func requestWorkspaces(r *http.Request) (*workspaceRefs, error) {
+	refs := &workspaceRefs{folders: []string{}, ids: []int{}}
+	seen := map[string]bool{}
+	add := func(value string) {
+		if folder := workspaceFolder(value); folder != "" && !seen[folder] {
+			seen[folder] = true
+			refs.folders = append(refs.folders, folder)
+		}
+	}
+	addField := func(key, value string) {
+		refs.addField(key, value)
+		lower := strings.ToLower(key)
+		if strings.Contains(lower, "path") || strings.Contains(lower, "folder") || strings.Contains(lower, "workspace") {
+			add(value)
+		}
+	}
+
+	if rest, ok := strings.CutPrefix(r.URL.Path, "/workspaces/"); ok {
+		segment, _, _ := strings.Cut(rest, "/")
+		if id, err := strconv.Atoi(segment); err == nil {
+			refs.addID(id)
+		}
+	}
+
+	for key, values := range r.URL.Query() {
+		for _, v := range values {
+			if key == "workspaceId" {
+				id, err := strconv.Atoi(v)
+				if err != nil {
+					return nil, fmt.Errorf("invalid workspaceId: %s", v)
+				}
+				refs.addID(id)
+				continue
+			}
+			refs.addField(key, v)
+			add(v)
+		}
+	}
+
+	if r.Body == nil || !strings.Contains(r.Header.Get("Content-Type"), "json") {
+		return refs, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxInspectedBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %v", err)
+	}
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+
+	var decoded interface{}
+	if json.Unmarshal(body, &decoded) != nil {
+		return refs, nil
+	}
+	if fields, ok := decoded.(map[string]interface{}); ok {
+		if value, ok := fields["workspaceId"]; ok && value != nil {
+			id, err := workspaceIDValue(value)
+			if err != nil {
+				return nil, err
+			}
+			refs.addID(id)
+		}
+	}
+	collectFields(decoded, "", addField)
+	return refs, nil
+}
+
+// workspaceIDValue accepts a workspace ID sent as a JSON number or string
+func workspaceIDValue(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	case string:
+		if id, err := strconv.Atoi(v); err == nil {
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid workspaceId: %v", value)
+}
+
+// collectFields walks decoded JSON and reports each string with the key holding it;
+// strings in arrays are reported with the array's key
+func collectFields(value interface{}, key string, add func(key, value string)) {
+	switch v := value.(type) {
+	case string:
+		add(key, v)
+	case []interface{}:
+		for _, item := range v {
+			collectFields(item, key, add)
+		}
+	case map[string]interface{}:
+		for k, item := range v {
+			collectFields(item, k, add)
+		}
+	}
+}
+
+// workspaceFolder returns the folder under workspaces/ that a path points into
+func workspaceFolder(value string) string {
+	if !strings.Contains(value, "workspaces/") {
+		return ""
+	}
+	return search.WorkspaceFromRef(path.Clean(strings.ReplaceAll(value, "\\", "/")) + "/")
+}
@@ -0,0 +1,158 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jareynolds/ubecode/pkg/client"
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+type fakeVerifier map[string]*client.TokenInfo
+
+func (f fakeVerifier) Verify(ctx context.Context, token string) (*client.TokenInfo, error) {
+	if info, ok := f[token]; ok {
+		return info, nil
+	}
+	return nil, client.ErrTokenRejected
+}
+
+func TestTokenAuth(t *testing.T) {
+	full := &models.AccessGrant{Permissions: []string{
+		models.PermSpecificationsRead, models.PermSpecificationsWrite, models.PermAIGenerate,
+	}}
+	contractor := &models.AccessGrant{
+		Permissions: []string{models.PermNotificationsRead},
+		Workspaces: []models.WorkspaceAccess{
+			{WorkspaceID: 1, Folder: "acme", Permissions: []string{models.PermSpecificationsRead}},
+		},
+		KnownFolders: []string{"acme", "internal"},
+	}
+	verifier := fakeVerifier{
+		"session":    {UserID: 1, Access: full},
+		"ci":         {UserID: 2, Scopes: []string{"specifications:read"}, Access: full},
+		"ai":         {UserID: 3, Scopes: []string{"ai:generate"}, Access: full},
+		"contractor": {UserID: 4, Access: contractor},
+	}
+	handler := TokenAuth(verifier, false, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		token    string
+		expected int
+	}{
+		{"anonymous", "/ai-chat", "", "", http.StatusUnauthorized},
+		{"session token", "/ai-chat", "", "session", http.StatusOK},
+		{"unknown token", "/ai-chat", "", "bogus", http.StatusUnauthorized},
+		{"missing ai scope", "/ai-chat", "", "ci", http.StatusForbidden},
+		{"ai scope", "/ai-chat", "", "ai", http.StatusOK},
+		{"read scope on read endpoint", "/capability-files", "", "ci", http.StatusOK},
+		{"read scope on write endpoint", "/save-capability", "", "ci", http.StatusForbidden},
+		{"member workspace", "/capability-files", `{"workspacePath":"workspaces/acme"}`, "contractor", http.StatusOK},
+		{"other workspace", "/capability-files", `{"workspacePath":"workspaces/internal"}`, "contractor", http.StatusForbidden},
+		{"traversal out of member workspace", "/read-specification", `{"path":"workspaces/acme/../internal/spec.md"}`, "contractor", http.StatusForbidden},
+		{"unregistered workspace", "/capability-files", `{"workspacePath":"/data/workspaces/scratch"}`, "contractor", http.StatusForbidden},
+		{"no workspace named", "/capability-files", `{}`, "contractor", http.StatusForbidden},
+		{"write in read-only workspace", "/save-capability", `{"path":"workspaces/acme/CAP-1.md"}`, "contractor", http.StatusForbidden},
+		{"query parameter", "/capability-files?workspacePath=workspaces/internal", "", "contractor", http.StatusForbidden},
+		{"member workspace id", "/capability-files", `{"workspaceId":1}`, "contractor", http.StatusOK},
+		{"other workspace id", "/capability-files", `{"workspaceId":2}`, "contractor", http.StatusForbidden},
+		{"workspace id in path", "/workspaces/2/archive", "", "contractor", http.StatusForbidden},
+		{"write by id in read-only workspace", "/workspaces/1/integrations", `{}`, "contractor", http.StatusForbidden},
+		{"invalid workspace id", "/capability-files", `{"workspaceId":"acme"}`, "contractor", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.expected {
+				t.Errorf("expected status %d, got %d", tt.expected, rec.Code)
+			}
+		})
+	}
+}
+
+func TestTokenAuthRequireAuth(t *testing.T) {
+	handler := TokenAuth(fakeVerifier{}, true, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/capability-files", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, rec.Code)
+	}
+}
+
+func TestTokenAuthRestoresBody(t *testing.T) {
+	body := `{"path":"workspaces/acme/CAP-1.md","content":"x"}`
+	verifier := fakeVerifier{"session": {UserID: 1, Access: &models.AccessGrant{
+		Permissions: []string{models.PermSpecificationsWrite},
+	}}}
+
+	var received string
+	handler := TokenAuth(verifier, false, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		received = string(data)
+	}))
+
+	req := httptest.NewRequest("POST", "/save-capability", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer session")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if received != body {
+		t.Errorf("expected handler to receive %q, got %q", body, received)
+	}
+}
+
+func TestTokenAuthWorkspaceList(t *testing.T) {
+	contractor := &models.AccessGrant{
+		Permissions: []string{},
+		Workspaces: []models.WorkspaceAccess{
+			{WorkspaceID: 1, Folder: "acme", Permissions: []string{models.PermSpecificationsRead}},
+		},
+	}
+	handler := TokenAuth(fakeVerifier{"contractor": {UserID: 4, Access: contractor}}, false,
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+
+	tests := []struct {
+		method   string
+		expected int
+	}{
+		{"GET", http.StatusOK},         // Filtered by the handler
+		{"POST", http.StatusForbidden}, // Creating a workspace needs the global permission
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/workspaces", strings.NewReader(`{"name":"New"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer contractor")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.expected {
+			t.Errorf("%s /workspaces: expected status %d, got %d", tt.method, tt.expected, rec.Code)
+		}
+	}
+}
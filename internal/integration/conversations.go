@@ -0,0 +1,398 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jareynolds/ubecode/internal/auth"
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/jareynolds/ubecode/pkg/repository"
+)
+
+const (
+	conversationBudget     = 60000 // Estimated tokens of history sent with a message before older messages are summarized
+	conversationKeepRecent = 6     // Latest messages that are always sent as they are
+	maxConversationTitle   = 80
+)
+
+var artifactTypes = map[string]bool{
+	models.ArtifactCapability: true,
+	models.ArtifactEnabler:    true,
+	models.ArtifactStory:      true,
+}
+
+// EnableConversations stores AI chat threads in the database. Without it the client sends
+// the history with every message.
+func (s *Service) EnableConversations(repo *repository.ConversationRepository) {
+	s.conversations = repo
+}
+
+// conversationTitle names a new thread after the first line of its first message
+func conversationTitle(message string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return "New conversation"
+	}
+	return truncateText(line, maxConversationTitle)
+}
+
+// estimateTokens roughly counts the tokens of messages, at four characters a token
+func estimateTokens(messages []models.ConversationMessage) int {
+	chars := 0
+	for _, m := range messages {
+		chars += len(m.Content)
+	}
+	return chars / 4
+}
+
+// summaryCut returns how many of messages to fold into the summary so that the rest fits
+// budget, or 0 when they already fit. The latest keep messages always stay, and the
+// messages that stay start with a user message as the Messages API requires.
+func summaryCut(messages []models.ConversationMessage, budget, keep int) int {
+	if estimateTokens(messages) <= budget || len(messages) <= keep {
+		return 0
+	}
+	cut := 0
+	for cut < len(messages)-keep && estimateTokens(messages[cut:]) > budget {
+		cut++
+	}
+	for cut < len(messages)-keep && messages[cut].Role != "user" {
+		cut++
+	}
+	for cut > 0 && messages[cut].Role != "user" {
+		cut--
+	}
+	return cut
+}
+
+// unsummarized returns the messages the conversation's summary does not cover
+func unsummarized(conv *models.Conversation, messages []models.ConversationMessage) []models.ConversationMessage {
+	if conv.SummarizedThrough == nil {
+		return messages
+	}
+	for i, m := range messages {
+		if m.ID > *conv.SummarizedThrough {
+			return messages[i:]
+		}
+	}
+	return nil
+}
+
+func chatMessages(messages []models.ConversationMessage) []ClaudeMessage {
+	out := make([]ClaudeMessage, 0, len(messages))
+	for _, m := range messages {
+		out = append(out, ClaudeMessage{Role: m.Role, Content: m.Content})
+	}
+	return out
+}
+
+// conversationHistory returns what the model is sent of a stored conversation: its summary
+// and the messages after it. Once those exceed the budget, the older ones are folded into
+// the summary first.
+func (s *Service) conversationHistory(ctx context.Context, a *agent, conv *models.Conversation) (string, []ClaudeMessage, error) {
+	messages, err := s.conversations.Messages(conv.ID)
+	if err != nil {
+		return "", nil, err
+	}
+	recent := unsummarized(conv, messages)
+
+	if cut := summaryCut(recent, conversationBudget, conversationKeepRecent); cut > 0 {
+		summary, err := a.summarize(ctx, conv.Summary, chatMessages(recent[:cut]))
+		if err != nil {
+			// Better to lose the oldest messages than the whole reply
+			log.Printf("Failed to summarize conversation %d: %v", conv.ID, err)
+		} else if err := s.conversations.SetSummary(conv.ID, summary, recent[cut-1].ID); err != nil {
+			log.Printf("Failed to save conversation %d summary: %v", conv.ID, err)
+		} else {
+			conv.Summary = summary
+			conv.SummarizedThrough = &recent[cut-1].ID
+		}
+		recent = recent[cut:]
+	}
+	return conv.Summary, chatMessages(recent), nil
+}
+
+// chatConversation returns the stored thread a chat message belongs to: the one named by
+// conversationId, or a new one when the request is scoped to a registered workspace. It
+// returns nil when conversations are not stored.
+func (h *Handler) chatConversation(r *http.Request, req *ChatRequest) (*models.Conversation, error) {
+	if h.service.conversations == nil {
+		return nil, nil
+	}
+	ws, _ := r.Context().Value("workspace").(*models.Workspace)
+
+	if req.ConversationID != 0 {
+		conv, err := h.service.conversations.Get(req.ConversationID)
+		if errors.Is(err, repository.ErrConversationNotFound) ||
+			(err == nil && (!conversationVisible(r, conv) || (ws != nil && ws.ID != conv.WorkspaceID))) {
+			return nil, fmt.Errorf("conversation %d not found", req.ConversationID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ws == nil && req.WorkspacePath == "" {
+			if ws, err = h.service.workspaces.Get(conv.WorkspaceID); err != nil {
+				return nil, err
+			}
+			req.WorkspacePath = ws.Path
+		}
+		return conv, nil
+	}
+
+	if ws == nil {
+		return nil, nil
+	}
+	if req.ArtifactType != "" && !artifactTypes[req.ArtifactType] {
+		return nil, fmt.Errorf("invalid artifactType %q", req.ArtifactType)
+	}
+	conv := &models.Conversation{
+		WorkspaceID:  ws.ID,
+		ArtifactType: req.ArtifactType,
+		ArtifactID:   strings.TrimSpace(req.ArtifactID),
+		Title:        conversationTitle(req.Message),
+		Model:        agentModel,
+		CreatedBy:    requestUserID(r),
+	}
+	if err := h.service.conversations.Create(conv); err != nil {
+		return nil, err
+	}
+	return conv, nil
+}
+
+// recordChat stores a message and the reply to it
+func (s *Service) recordChat(conv *models.Conversation, message string, result *agentResult) {
+	toolCalls, err := json.Marshal(result.ToolCalls)
+	if err != nil {
+		log.Printf("Failed to encode tool calls: %v", err)
+		toolCalls = nil
+	}
+	err = s.conversations.AppendMessages(conv.ID,
+		&models.ConversationMessage{Role: "user", Content: message},
+		&models.ConversationMessage{
+			Role:         "assistant",
+			Content:      result.Response,
+			ToolCalls:    toolCalls,
+			FileChanges:  result.FileChanges,
+			Model:        agentModel,
+			InputTokens:  result.InputTokens,
+			OutputTokens: result.OutputTokens,
+		})
+	if err != nil {
+		log.Printf("Failed to save conversation %d: %v", conv.ID, err)
+	}
+}
+
+// conversationVisible reports whether the caller holds the endpoint's permission in the
+// conversation's workspace. Anonymous requests only get this far when authentication is
+// not required.
+func conversationVisible(r *http.Request, conv *models.Conversation) bool {
+	access, ok := r.Context().Value("access").(*models.AccessGrant)
+	if !ok {
+		return true
+	}
+	return access.CanInWorkspace(auth.PermissionForRequest(r.Method, r.URL.Path), &conv.WorkspaceID)
+}
+
+// loadConversation returns the conversation named in the path, writing an error response
+// when the caller cannot see it
+func (h *Handler) loadConversation(w http.ResponseWriter, r *http.Request) *models.Conversation {
+	if h.service.conversations == nil {
+		http.Error(w, "conversations are not configured", http.StatusServiceUnavailable)
+		return nil
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid conversation id", http.StatusBadRequest)
+		return nil
+	}
+	conv, err := h.service.conversations.Get(id)
+	if err == nil {
+		ws, ok := r.Context().Value("workspace").(*models.Workspace)
+		if !conversationVisible(r, conv) || (ok && ws.ID != conv.WorkspaceID) {
+			err = repository.ErrConversationNotFound
+		}
+	}
+	if errors.Is(err, repository.ErrConversationNotFound) {
+		http.Error(w, "conversation not found", http.StatusNotFound)
+		return nil
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get conversation: %v", err), http.StatusInternalServerError)
+		return nil
+	}
+	return conv
+}
+
+// HandleListConversations handles GET /conversations?workspaceId=&artifactType=&artifactId=&q=&limit=
+// artifactId also finds the threads that wrote the spec with that ID; q searches titles,
+// summaries and messages.
+func (h *Handler) HandleListConversations(w http.ResponseWriter, r *http.Request) {
+	if h.service.conversations == nil {
+		http.Error(w, "conversations are not configured", http.StatusServiceUnavailable)
+		return
+	}
+	ws, ok := r.Context().Value("workspace").(*models.Workspace)
+	if !ok {
+		http.Error(w, "workspaceId is required", http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+	filter := models.ConversationFilter{
+		WorkspaceID:  ws.ID,
+		ArtifactType: query.Get("artifactType"),
+		ArtifactID:   strings.TrimSpace(query.Get("artifactId")),
+		Query:        query.Get("q"),
+	}
+	if filter.ArtifactType != "" && !artifactTypes[filter.ArtifactType] {
+		http.Error(w, "invalid artifactType", http.StatusBadRequest)
+		return
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+
+	list, err := h.service.conversations.List(filter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to list conversations: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"conversations": list})
+}
+
+// HandleCreateConversation handles POST /conversations
+// It starts an empty thread in a workspace, optionally about a capability, enabler or story.
+func (h *Handler) HandleCreateConversation(w http.ResponseWriter, r *http.Request) {
+	if h.service.conversations == nil {
+		http.Error(w, "conversations are not configured", http.StatusServiceUnavailable)
+		return
+	}
+	var req models.CreateConversationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	ws, ok := r.Context().Value("workspace").(*models.Workspace)
+	if !ok {
+		http.Error(w, "workspaceId is required", http.StatusBadRequest)
+		return
+	}
+	if req.ArtifactType != "" && !artifactTypes[req.ArtifactType] {
+		http.Error(w, "invalid artifactType", http.StatusBadRequest)
+		return
+	}
+	req.ArtifactID = strings.TrimSpace(req.ArtifactID)
+	if (req.ArtifactType == "") != (req.ArtifactID == "") {
+		http.Error(w, "artifactType and artifactId go together", http.StatusBadRequest)
+		return
+	}
+
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		title = conversationTitle(req.ArtifactID)
+	}
+	conv := &models.Conversation{
+		WorkspaceID:  ws.ID,
+		ArtifactType: req.ArtifactType,
+		ArtifactID:   req.ArtifactID,
+		Title:        truncateText(title, maxConversationTitle),
+		CreatedBy:    requestUserID(r),
+	}
+	if err := h.service.conversations.Create(conv); err != nil {
+		http.Error(w, fmt.Sprintf("failed to create conversation: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, conv)
+}
+
+// HandleGetConversation handles GET /conversations/{id}
+// The conversation comes with its messages, including each reply's tool calls and file changes.
+func (h *Handler) HandleGetConversation(w http.ResponseWriter, r *http.Request) {
+	conv := h.loadConversation(w, r)
+	if conv == nil {
+		return
+	}
+	messages, err := h.service.conversations.Messages(conv.ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get conversation messages: %v", err), http.StatusInternalServerError)
+		return
+	}
+	conv.Messages = messages
+	writeJSON(w, http.StatusOK, conv)
+}
+
+// HandleForkConversation handles POST /conversations/{id}/fork
+// The fork belongs to the caller and keeps the messages up to messageId, or all of them.
+func (h *Handler) HandleForkConversation(w http.ResponseWriter, r *http.Request) {
+	conv := h.loadConversation(w, r)
+	if conv == nil {
+		return
+	}
+	var req models.ForkConversationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	fork, err := h.service.conversations.Fork(conv.ID, req.MessageID, truncateText(strings.TrimSpace(req.Title), maxConversationTitle), requestUserID(r))
+	if errors.Is(err, repository.ErrMessageNotFound) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to fork conversation: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, fork)
+}
+
+// HandleDeleteConversation handles DELETE /conversations/{id}
+// Its creator or whoever may manage the workspace can delete a conversation.
+func (h *Handler) HandleDeleteConversation(w http.ResponseWriter, r *http.Request) {
+	conv := h.loadConversation(w, r)
+	if conv == nil {
+		return
+	}
+	userID := requestUserID(r)
+	if userID != nil && (conv.CreatedBy == nil || *conv.CreatedBy != *userID) {
+		ws, err := h.service.workspaces.Get(conv.WorkspaceID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to get workspace: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if !canManageWorkspace(r, ws) {
+			http.Error(w, "only the creator or a workspace manager can delete this conversation", http.StatusForbidden)
+			return
+		}
+	}
+
+	if err := h.service.conversations.Delete(conv.ID); err != nil {
+		if errors.Is(err, repository.ErrConversationNotFound) {
+			http.Error(w, "conversation not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("failed to delete conversation: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
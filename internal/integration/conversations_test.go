@@ -0,0 +1,98 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+// thread builds alternating user and assistant messages of the given lengths
+func thread(lengths ...int) []models.ConversationMessage {
+	messages := make([]models.ConversationMessage, len(lengths))
+	for i, n := range lengths {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		messages[i] = models.ConversationMessage{ID: int64(i + 1), Role: role, Content: strings.Repeat("x", n)}
+	}
+	return messages
+}
+
+func TestSummaryCut(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []models.ConversationMessage
+		budget   int
+		keep     int
+		want     int
+	}{
+		{"fits", thread(400, 400, 400, 400), 1000, 2, 0},
+		{"too few messages to fold", thread(4000, 4000), 1000, 2, 0},
+		{"folds the oldest", thread(2000, 2000, 400, 400), 1000, 2, 2},
+		{"keeps the latest", thread(400, 400, 4000, 4000), 1000, 2, 2},
+		{"stays on a user message", thread(2000, 400, 400, 400, 400), 600, 2, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := summaryCut(tt.messages, tt.budget, tt.keep)
+			if got != tt.want {
+				t.Errorf("expected to fold %d messages, got %d", tt.want, got)
+			}
+			if got > 0 && tt.messages[got].Role != "user" {
+				t.Errorf("the kept messages must start with a user message")
+			}
+		})
+	}
+}
+
+func TestUnsummarized(t *testing.T) {
+	messages := thread(1, 1, 1, 1)
+	through := func(id int64) *int64 { return &id }
+	tests := []struct {
+		name    string
+		through *int64
+		want    int
+	}{
+		{"no summary", nil, 4},
+		{"partly summarized", through(2), 2},
+		{"fully summarized", through(4), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := unsummarized(&models.Conversation{SummarizedThrough: tt.through}, messages)
+			if len(got) != tt.want {
+				t.Errorf("expected %d messages, got %d", tt.want, len(got))
+			}
+		})
+	}
+}
+
+func TestConversationTitle(t *testing.T) {
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{"Add a checkout page", "Add a checkout page"},
+		{"  Refactor payments\nand add tests", "Refactor payments"},
+		{"", "New conversation"},
+		{strings.Repeat("a", 100), strings.Repeat("a", maxConversationTitle) + "…"},
+	}
+
+	for _, tt := range tests {
+		if got := conversationTitle(tt.message); got != tt.want {
+			t.Errorf("conversationTitle(%q) = %q, want %q", tt.message, got, tt.want)
+		}
+	}
+}
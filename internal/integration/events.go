@@ -0,0 +1,184 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+// sseKeepAlive is how often an idle event stream sends a comment to keep proxies from closing it
+const sseKeepAlive = 25 * time.Second
+
+// errNotWorkspaceRoot rejects folders that are not a workspace under workspaces/
+var errNotWorkspaceRoot = errors.New("not a workspace folder")
+
+// resolveWorkspaceRoot turns a workspace path from a request into an absolute folder,
+// handling Docker host paths the same way as the listing endpoints
+func resolveWorkspaceRoot(workspacePath string) (string, error) {
+	if idx := strings.Index(workspacePath, "workspaces/"); idx != -1 {
+		workspacePath = workspacePath[idx:]
+	}
+	if !filepath.IsAbs(workspacePath) {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		workspacePath = filepath.Join(cwd, workspacePath)
+	}
+	return filepath.Clean(workspacePath), nil
+}
+
+// watchableRoot resolves the folder of a workspace to watch, which must lie directly under
+// workspaces/ so a request cannot have the whole filesystem walked
+func watchableRoot(workspacePath string) (string, error) {
+	root, err := resolveWorkspaceRoot(workspacePath)
+	if err != nil {
+		return "", err
+	}
+	dir, err := filepath.Abs(models.WorkspacesDir)
+	if err != nil {
+		return "", err
+	}
+	if filepath.Dir(root) != dir {
+		return "", fmt.Errorf("%w: %s", errNotWorkspaceRoot, workspacePath)
+	}
+	return root, nil
+}
+
+// EnableWatcherPolling makes workspace watchers poll every interval instead of following
+// fsnotify events, for bind mounts and network volumes that deliver none
+func (s *Service) EnableWatcherPolling(interval time.Duration) {
+	s.watchHub.SetPollInterval(interval)
+}
+
+// onWorkspaceChange keeps the search and retrieval indexes in step with edits made outside the UI
+func (s *Service) onWorkspaceChange(e ChangeEvent) {
+	if e.Type == ChangeDeleted {
+		s.SpecFilesChanged(nil, []string{e.Path})
+	} else {
+		s.SpecFilesChanged([]string{e.Path}, nil)
+	}
+	s.retrievalFileChanged(e)
+}
+
+// WatchAllWorkspaces keeps a watcher running for every workspace so the search and
+// retrieval indexes follow external edits even when no client is connected. With a
+// workspace registry only registered folders are watched, else every folder under workspaces/.
+func (s *Service) WatchAllWorkspaces() {
+	var paths []string
+	if s.workspaces != nil {
+		registered, err := s.workspaces.List(true)
+		if err != nil {
+			log.Printf("Workspace watcher: failed to list workspaces: %v", err)
+			return
+		}
+		for _, ws := range registered {
+			if ws.FolderName != "" {
+				paths = append(paths, ws.Path)
+			}
+		}
+	} else {
+		entries, err := os.ReadDir(models.WorkspacesDir)
+		if err != nil {
+			log.Printf("Workspace watcher: failed to list workspaces: %v", err)
+			return
+		}
+		for _, entry := range entries {
+			if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+				paths = append(paths, filepath.Join(models.WorkspacesDir, entry.Name()))
+			}
+		}
+	}
+
+	for _, p := range paths {
+		root, err := watchableRoot(p)
+		if err != nil {
+			continue
+		}
+		s.watchHub.Retain(root)
+	}
+}
+
+// HandleWorkspaceEvents handles GET /workspace-events?workspaceId=...
+// It streams typed change events as Server-Sent Events. Each message uses the event name
+// "<kind>.<type>" (e.g. "capability.modified") and carries a ChangeEvent as JSON data.
+// Only registered workspaces can be followed; without a registry, folders under workspaces/.
+func (h *Handler) HandleWorkspaceEvents(w http.ResponseWriter, r *http.Request) {
+	if _, ok := r.Context().Value("workspace").(*models.Workspace); !ok && h.service.workspaces != nil {
+		http.Error(w, "workspaceId is required", http.StatusBadRequest)
+		return
+	}
+	workspacePath := scopedWorkspacePath(r, r.URL.Query().Get("workspacePath"))
+	if workspacePath == "" {
+		http.Error(w, "workspacePath is required", http.StatusBadRequest)
+		return
+	}
+
+	root, err := watchableRoot(workspacePath)
+	if errors.Is(err, errNotWorkspaceRoot) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to resolve workspace: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		http.Error(w, "workspace not found", http.StatusNotFound)
+		return
+	}
+
+	// The stream outlives the server's WriteTimeout
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	events, cancel := h.service.watchHub.Subscribe(root)
+	defer cancel()
+
+	fmt.Fprintf(w, "event: ready\ndata: {\"workspace\":%q}\n\n", filepath.Base(root))
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case e := <-events:
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s.%s\ndata: %s\n\n", e.Kind, e.Type, data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,374 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jareynolds/ubecode/pkg/governance"
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/jareynolds/ubecode/pkg/repository"
+)
+
+// agentStoppedGovernance is the stop reason of a chat stopped by a zero-tolerance preset
+const agentStoppedGovernance = "governance_violation"
+
+// EnableAIAudit records every AI change made under an AI policy preset, with the rules it
+// broke, in the AI audit log
+func (s *Service) EnableAIAudit(repo *repository.AIAuditRepository) {
+	s.audit = repo
+}
+
+// workspaceRules returns the rule set AI changes to a workspace are checked against: the
+// stricter of the workspace's active AI preset and the one the request names, tightened
+// by the workspace's .ubegovernance.json. It returns nil when no preset applies.
+func workspaceRules(workspacePath string, requested int) (*models.AIRuleSet, error) {
+	preset := requested
+	config, err := readWorkspaceConfig(workspacePath)
+	if err != nil {
+		return nil, err
+	}
+	if config != nil && config.ActiveAIPreset > preset {
+		preset = config.ActiveAIPreset
+	}
+
+	var extra models.AIRuleSet
+	data, err := os.ReadFile(filepath.Join(workspacePath, governance.RulesFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &extra); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", governance.RulesFile, err)
+		}
+		if extra.Preset > preset {
+			preset = extra.Preset
+		}
+	}
+	if preset == 0 {
+		return nil, nil
+	}
+
+	rules, err := governance.Preset(preset)
+	if err != nil {
+		return nil, err
+	}
+	governance.Tighten(rules, extra)
+	return rules, nil
+}
+
+// describeRules tells the model the rules its changes are checked against
+func describeRules(rules *models.AIRuleSet) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "This workspace enforces AI policy preset %d (%s). ", rules.Preset, rules.Name)
+	if governance.Blocks(rules) {
+		b.WriteString("File changes that break these rules are refused:\n")
+	} else {
+		b.WriteString("File changes that break these rules are recorded for review:\n")
+	}
+	fmt.Fprintf(&b, "- Never write files matching: %s\n", strings.Join(append([]string{".git/**", governance.RulesFile}, rules.ForbiddenPaths...), ", "))
+	if rules.MaxFileBytes > 0 {
+		fmt.Fprintf(&b, "- Keep every file under %d bytes\n", rules.MaxFileBytes)
+	}
+	if rules.LicenseHeader != "" {
+		fmt.Fprintf(&b, "- Start every code file with a license header comment containing %q\n", rules.LicenseHeader)
+	}
+	if len(rules.BannedDependencies) > 0 {
+		fmt.Fprintf(&b, "- Do not add these dependencies: %s\n", strings.Join(rules.BannedDependencies, ", "))
+	}
+	if rules.MinTestCoverage > 0 {
+		fmt.Fprintf(&b, "- Write tests for at least %.0f%% of the code files you create or change\n", rules.MinTestCoverage*100)
+	}
+	if rules.HumanReview {
+		b.WriteString("- Your changes will be reviewed by a person before they are accepted\n")
+	}
+	return b.String()
+}
+
+// governor checks the files an AI run writes as it writes them
+type governor struct {
+	rules      *models.AIRuleSet
+	violations []models.AIViolation
+	blocked    bool // A change was refused
+	stopped    bool // A zero-tolerance preset ended the run
+}
+
+// check returns an error when a file change breaks a rule the preset enforces. Rules
+// that only advise are recorded and the change is allowed.
+func (g *governor) check(change governance.Change) error {
+	violations := governance.CheckFile(g.rules, change)
+	if len(violations) == 0 {
+		return nil
+	}
+	g.violations = append(g.violations, violations...)
+	if !governance.Blocks(g.rules) {
+		return nil
+	}
+	g.blocked = true
+	g.stopped = g.rules.Enforcement == models.AIEnforcementTerminate
+	return fmt.Errorf("refused by AI policy preset %d: %s", g.rules.Preset, violationMessages(violations))
+}
+
+// finish adds the test coverage of the files written to the violations found as they were
+// written, and returns the files written once each
+func (g *governor) finish(changes []models.FileChange, root string) ([]string, []models.AIViolation) {
+	var files []string
+	var plan []governance.Change
+	seen := map[string]bool{}
+	for _, c := range changes {
+		if !seen[c.Path] {
+			seen[c.Path] = true
+			files = append(files, c.Path)
+			plan = append(plan, governance.Change{Path: c.Path})
+		}
+	}
+	violations := append(g.violations, governance.CheckCoverage(g.rules, plan, workspaceFileExists(root))...)
+	return files, violations
+}
+
+func violationMessages(violations []models.AIViolation) string {
+	messages := make([]string, len(violations))
+	for i, v := range violations {
+		messages[i] = v.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// GovernanceReport is how an AI run fared against the workspace's AI policy rules
+type GovernanceReport struct {
+	Preset         int                  `json:"preset"`
+	Enforcement    string               `json:"enforcement"`
+	Violations     []models.AIViolation `json:"violations"`
+	Blocked        bool                 `json:"blocked,omitempty"`
+	ReviewRequired bool                 `json:"reviewRequired,omitempty"`
+	AuditID        int64                `json:"auditId,omitempty"`
+}
+
+// recordAudit completes an audit entry for an AI run under rules and stores it when the
+// run changed or tried to change files. Presets that require human review leave the
+// entry pending.
+func (s *Service) recordAudit(e *models.AIAuditEntry, rules *models.AIRuleSet) *GovernanceReport {
+	e.Preset = rules.Preset
+	e.Enforcement = rules.Enforcement
+	if rules.HumanReview && len(e.Files) > 0 {
+		e.ReviewStatus = models.AIReviewPending
+	}
+	report := &GovernanceReport{
+		Preset:         e.Preset,
+		Enforcement:    e.Enforcement,
+		Violations:     e.Violations,
+		Blocked:        e.Blocked,
+		ReviewRequired: e.ReviewStatus == models.AIReviewPending,
+	}
+	if report.Violations == nil {
+		report.Violations = []models.AIViolation{}
+	}
+	if s.audit == nil || (len(e.Files) == 0 && len(e.Violations) == 0) {
+		return report
+	}
+	if err := s.audit.Record(e); err != nil {
+		log.Printf("AI audit: %v", err)
+		return report
+	}
+	report.AuditID = e.ID
+	return report
+}
+
+// requestAuditEntry starts the audit entry of an AI run made by a request
+func requestAuditEntry(r *http.Request, workspacePath string) *models.AIAuditEntry {
+	e := &models.AIAuditEntry{Endpoint: r.URL.Path, UserID: requestUserID(r), WorkspacePath: workspacePath}
+	if ws, ok := r.Context().Value("workspace").(*models.Workspace); ok {
+		id := ws.ID
+		e.WorkspaceID = &id
+	}
+	return e
+}
+
+// jobAuditEntry starts the audit entry of an AI run made by a background job
+func (s *Service) jobAuditEntry(job *models.Job, workspacePath string) *models.AIAuditEntry {
+	return &models.AIAuditEntry{
+		Endpoint:      job.Kind,
+		UserID:        job.CreatedBy,
+		WorkspaceID:   s.jobWorkspaceID(job),
+		WorkspacePath: workspacePath,
+	}
+}
+
+// workspaceFileExists reports whether a slash-separated path exists in a workspace
+func workspaceFileExists(root string) func(string) bool {
+	return func(p string) bool {
+		_, err := os.Stat(filepath.Join(root, filepath.FromSlash(p)))
+		return err == nil
+	}
+}
+
+// HandleGetAIGovernance handles GET /ai-governance?workspacePath=...
+// Returns the rule set AI changes to a workspace are checked against
+func (h *Handler) HandleGetAIGovernance(w http.ResponseWriter, r *http.Request) {
+	workspacePath := scopedWorkspacePath(r, r.URL.Query().Get("workspacePath"))
+	if workspacePath == "" {
+		http.Error(w, "workspacePath is required", http.StatusBadRequest)
+		return
+	}
+	preset := 0
+	if value := r.URL.Query().Get("preset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 5 {
+			http.Error(w, "preset must be between 1 and 5", http.StatusBadRequest)
+			return
+		}
+		preset = n
+	}
+
+	rules, err := workspaceRules(workspacePath, preset)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to load AI policy rules: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"rules": rules})
+}
+
+// HandleListAIAudit handles GET /ai-audit?workspaceId=...&userId=...&reviewStatus=...&violations=true&limit=...
+// Lists audited AI changes, newest first. Admins see every entry and workspace owners
+// their workspace's; everyone else sees their own.
+func (h *Handler) HandleListAIAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.AIAuditFilter{
+		ReviewStatus:   query.Get("reviewStatus"),
+		WithViolations: query.Get("violations") == "true",
+	}
+	switch filter.ReviewStatus {
+	case "", models.AIReviewPending, models.AIReviewApproved, models.AIReviewRejected:
+	default:
+		http.Error(w, "reviewStatus must be pending, approved or rejected", http.StatusBadRequest)
+		return
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 500 {
+			http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+	var err error
+	if filter.WorkspaceID, err = queryID(r, "workspaceId"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.UserID, err = queryID(r, "userId"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !isUsageAdmin(r) {
+		ws, err := h.auditWorkspace(filter.WorkspaceID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to look up workspace: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if ws == nil || !canManageWorkspace(r, ws) {
+			userID := requestUserID(r)
+			if filter.UserID != nil && *filter.UserID != *userID {
+				http.Error(w, "you can only see your own AI changes", http.StatusForbidden)
+				return
+			}
+			filter.UserID = userID
+		}
+	}
+
+	entries, err := h.service.audit.List(filter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to list AI audit entries: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// HandleReviewAIAudit handles POST /ai-audit/{id}/review
+// Approves or rejects an AI change that waits for human review. Reviewers must be able to
+// manage the workspace and may not review changes they asked for.
+func (h *Handler) HandleReviewAIAudit(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid audit entry ID", http.StatusBadRequest)
+		return
+	}
+	var req models.ReviewAIAuditRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Status != models.AIReviewApproved && req.Status != models.AIReviewRejected {
+		http.Error(w, "status must be approved or rejected", http.StatusBadRequest)
+		return
+	}
+
+	entry, err := h.service.audit.Get(id)
+	if errors.Is(err, repository.ErrAuditEntryNotFound) {
+		http.Error(w, "audit entry not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get audit entry: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if entry.ReviewStatus == "" {
+		http.Error(w, "this AI change does not require review", http.StatusConflict)
+		return
+	}
+	if entry.ReviewStatus != models.AIReviewPending {
+		http.Error(w, fmt.Sprintf("this AI change was already %s", entry.ReviewStatus), http.StatusConflict)
+		return
+	}
+
+	userID := requestUserID(r)
+	if userID != nil && entry.UserID != nil && *entry.UserID == *userID {
+		http.Error(w, "you cannot review AI changes you asked for", http.StatusForbidden)
+		return
+	}
+	if !isUsageAdmin(r) {
+		ws, err := h.auditWorkspace(entry.WorkspaceID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to look up workspace: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if ws == nil || !canManageWorkspace(r, ws) {
+			http.Error(w, "only the workspace owner or an admin can review AI changes", http.StatusForbidden)
+			return
+		}
+	}
+
+	entry, err = h.service.audit.Review(id, req.Status, req.Comment, userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to review audit entry: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
+
+// auditWorkspace looks up the registered workspace of an audit filter or entry
+func (h *Handler) auditWorkspace(id *int) (*models.Workspace, error) {
+	if id == nil || h.service.workspaces == nil {
+		return nil, nil
+	}
+	ws, err := h.service.workspaces.Get(*id)
+	if errors.Is(err, repository.ErrWorkspaceNotFound) {
+		return nil, nil
+	}
+	return ws, err
+}
@@ -0,0 +1,165 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jareynolds/ubecode/pkg/governance"
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+func TestWorkspaceRules(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     string // .ubeworkspace
+		rulesFile  string // .ubegovernance.json
+		requested  int
+		wantPreset int // 0 for no rules
+		wantErr    bool
+	}{
+		{"no preset", "", "", 0, 0, false},
+		{"requested", "", "", 2, 2, false},
+		{"workspace preset", `{"activeAIPreset": 3}`, "", 0, 3, false},
+		{"stricter request", `{"activeAIPreset": 3}`, "", 4, 4, false},
+		{"looser request", `{"activeAIPreset": 3}`, "", 1, 3, false},
+		{"rules file", "", `{"preset": 5, "forbiddenPaths": ["migrations/**"]}`, 2, 5, false},
+		{"rules file without preset", `{"activeAIPreset": 2}`, `{"forbiddenPaths": ["migrations/**"]}`, 0, 2, false},
+		{"invalid rules file", "", `{"preset": `, 2, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.config != "" {
+				os.WriteFile(filepath.Join(dir, workspaceConfigFile), []byte(tt.config), 0644)
+			}
+			if tt.rulesFile != "" {
+				os.WriteFile(filepath.Join(dir, governance.RulesFile), []byte(tt.rulesFile), 0644)
+			}
+
+			rules, err := workspaceRules(dir, tt.requested)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", rules)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantPreset == 0 {
+				if rules != nil {
+					t.Errorf("expected no rules, got %+v", rules)
+				}
+				return
+			}
+			if rules == nil || rules.Preset != tt.wantPreset {
+				t.Fatalf("expected preset %d, got %+v", tt.wantPreset, rules)
+			}
+			if tt.rulesFile != "" && governance.ForbiddenPath(rules, "migrations/020.sql") == "" {
+				t.Errorf("expected the rules file to add its forbidden paths, got %v", rules.ForbiddenPaths)
+			}
+		})
+	}
+}
+
+func TestAgentGovernance(t *testing.T) {
+	writeSecret := `{"content":[{"type":"tool_use","id":"tu_1","name":"write_file","input":{"path":"code/.env","content":"KEY=1"}}],"stop_reason":"tool_use","usage":{"input_tokens":100,"output_tokens":20}}`
+	done := `{"content":[{"type":"text","text":"Done."}],"stop_reason":"end_turn","usage":{"input_tokens":100,"output_tokens":10}}`
+	tests := []struct {
+		name        string
+		preset      int
+		wantWritten bool
+		wantError   bool
+		wantSteps   int
+		wantReason  string
+	}{
+		{"advisory", 2, true, false, 2, "end_turn"},
+		{"block", 3, false, true, 2, "end_turn"},
+		{"terminate", 5, false, true, 1, agentStoppedGovernance},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sandbox := newTestSandbox(t)
+			rules, _ := governance.Preset(tt.preset)
+			sandbox.governor = &governor{rules: rules}
+			server, _ := fakeMessagesAPI(t, []string{writeSecret, done})
+			a := newAgent("sk-test", sandbox)
+			a.url = server.URL
+
+			result, err := a.run(context.Background(), "", []ClaudeMessage{{Role: "user", Content: "Add a key"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, statErr := os.Stat(filepath.Join(sandbox.root, "code", ".env"))
+			if written := statErr == nil; written != tt.wantWritten {
+				t.Errorf("expected the file to be written: %v", tt.wantWritten)
+			}
+			if call := result.ToolCalls[0]; call.IsError != tt.wantError || !strings.Contains(call.Output, "forbidden path .env") {
+				t.Errorf("expected the model to hear of the violation, got %+v", call)
+			}
+			if result.Steps != tt.wantSteps || result.StopReason != tt.wantReason {
+				t.Errorf("expected %d steps and %s, got %d and %s", tt.wantSteps, tt.wantReason, result.Steps, result.StopReason)
+			}
+
+			files, violations := sandbox.governor.finish(result.FileChanges, sandbox.root)
+			if len(violations) != 1 || violations[0].Rule != models.AIRuleForbiddenPath {
+				t.Errorf("expected the forbidden path to be recorded, got %+v", violations)
+			}
+			if sandbox.governor.blocked == tt.wantWritten || len(files) != len(result.FileChanges) {
+				t.Errorf("unexpected blocked %v and files %v", sandbox.governor.blocked, files)
+			}
+		})
+	}
+}
+
+func TestParseCodeFiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     []governance.Change
+	}{
+		{
+			"file blocks",
+			"Here you go.\n[FILE: src/app.js]\n```js\nconsole.log(1)\n```\n[/FILE]\n[FILE: README.md]\n# App\n[/FILE]",
+			[]governance.Change{{Path: "src/app.js", Content: "console.log(1)"}, {Path: "README.md", Content: "# App"}},
+		},
+		{
+			"markdown",
+			"**File: src/app.js**\n```js\nconsole.log(1)\n```\n**File: src/util.js**\n```js\nexport {}\n```\n",
+			[]governance.Change{{Path: "src/app.js", Content: "console.log(1)"}, {Path: "src/util.js", Content: "export {}"}},
+		},
+		{"none", "Nothing to write.", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseCodeFiles(tt.response); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+
+	// Files that lead out of ./code are not written
+	codePath := filepath.Join(t.TempDir(), "code")
+	written := writeCodeFiles(codePath, []governance.Change{
+		{Path: "src/app.js", Content: "console.log(1)"},
+		{Path: "../.ubegovernance.json", Content: "{}"},
+	})
+	if !reflect.DeepEqual(written, []string{"src/app.js"}) {
+		t.Errorf("expected only src/app.js to be written, got %v", written)
+	}
+}
@@ -9,8 +9,10 @@
 package integration
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -20,6 +22,13 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/jareynolds/ubecode/pkg/aicache"
+	"github.com/jareynolds/ubecode/pkg/jobs"
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/jareynolds/ubecode/pkg/repository"
+	"github.com/jareynolds/ubecode/pkg/retrieval"
+	"github.com/jareynolds/ubecode/pkg/templates"
 )
 
 // Handler handles HTTP requests for the integration service
@@ -109,7 +118,7 @@ func (h *Handler) HandleAnalyzeIntegration(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Create Anthropic client with the provided API key
-	client := NewAnthropicClient(req.AnthropicKey)
+	client := h.service.anthropicClient(req.AnthropicKey)
 
 	// Analyze the integration
 	analysis, err := client.AnalyzeIntegrationAPI(r.Context(), req.ProviderURL, req.ProviderName)
@@ -171,7 +180,7 @@ type ResourceSuggestion struct {
 	ResourceID  string  `json:"resource_id"`
 	ResourceName string `json:"resource_name"`
 	Reason      string  `json:"reason"`
-	Confidence  float64 `json:"confidence"` // 0.0 to 1.0
+	Confidence  float64 `json:"confidence" jsonschema:"minimum=0,maximum=1"`
 }
 
 // HandleSuggestResources handles POST /suggest-resources
@@ -198,7 +207,7 @@ func (h *Handler) HandleSuggestResources(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Create Anthropic client
-	client := NewAnthropicClient(req.AnthropicKey)
+	client := h.service.anthropicClient(req.AnthropicKey)
 
 	// Generate AI suggestions
 	suggestions, err := client.SuggestResources(r.Context(), req)
@@ -390,8 +399,10 @@ func (h *Handler) HandleListSpecifications(w http.ResponseWriter, r *http.Reques
 
 // AnalyzeSpecificationsRequest represents the request for analyzing specifications
 type AnalyzeSpecificationsRequest struct {
-	Files        []SpecificationFile `json:"files"`
-	AnthropicKey string              `json:"anthropic_key"`
+	Files         []SpecificationFile `json:"files"`
+	AnthropicKey  string              `json:"anthropic_key"`
+	WorkspacePath string              `json:"workspacePath,omitempty"` // Selects the workspace's prompt overrides
+	NoCache       bool                `json:"noCache,omitempty"`       // Ask Claude even when the AI cache has an answer
 }
 
 // CapabilitySpec represents a parsed capability
@@ -444,6 +455,37 @@ func (h *Handler) HandleAnalyzeSpecifications(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	// The key stays out of the stored job parameters
+	apiKey := req.AnthropicKey
+	req.AnthropicKey = ""
+	req.WorkspacePath = scopedWorkspacePath(r, req.WorkspacePath)
+	req.NoCache = req.NoCache || noCache(r)
+	job := h.runJob(w, r, models.JobAnalyzeSpecifications, req.WorkspacePath, req, apiKey)
+	if job == nil {
+		return
+	}
+
+	var result AnalyzeSpecificationsResponse
+	if err := jobResult(job, &result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// analyzeSpecifications is the analyze_specifications job: it turns specification files
+// into capabilities and enablers, using Claude for the relationships between them
+func (s *Service) analyzeSpecifications(ctx context.Context, t *jobs.Task) (interface{}, error) {
+	var req AnalyzeSpecificationsRequest
+	if err := t.Params(&req); err != nil {
+		return nil, err
+	}
+	apiKey := t.Secret()
+	if apiKey == "" {
+		return nil, errSecretUnavailable
+	}
+
 	// Pre-process files to deterministically create capabilities and enablers
 	// based on filename prefixes (CAP*, ENB*)
 	var preCapabilities []CapabilitySpec
@@ -520,102 +562,62 @@ func (h *Handler) HandleAnalyzeSpecifications(w http.ResponseWriter, r *http.Req
 	// If we have pre-created items, use AI only for relationships
 	// Otherwise, fall back to full AI analysis
 	if len(preCapabilities) > 0 || len(preEnablers) > 0 {
-		// Build a simpler prompt just for relationships
-		var filesContent strings.Builder
-		filesContent.WriteString("Analyze these specification files and determine relationships between capabilities and enablers.\n\n")
-
-		filesContent.WriteString("EXISTING CAPABILITIES:\n")
-		for _, cap := range preCapabilities {
-			filesContent.WriteString(fmt.Sprintf("- %s: %s\n", cap.ID, cap.Name))
-		}
-		filesContent.WriteString("\nEXISTING ENABLERS:\n")
-		for _, enb := range preEnablers {
-			filesContent.WriteString(fmt.Sprintf("- %s: %s\n", enb.ID, enb.Name))
-		}
-		filesContent.WriteString("\nFILE CONTENTS:\n\n")
-
-		for _, file := range req.Files {
-			filesContent.WriteString(fmt.Sprintf("=== File: %s ===\n", file.Filename))
-			filesContent.WriteString(file.Content)
-			filesContent.WriteString("\n\n")
-		}
-
-		filesContent.WriteString("\nAnalyze the content and return a JSON object with relationships:\n")
-		filesContent.WriteString(`{
-  "relationships": {
-    "capabilityDependencies": [
-      {"from": "CAP-001", "to": "CAP-002"}
-    ],
-    "enablerAssignments": [
-      {"enablerId": "ENB-001", "capabilityId": "CAP-001"}
-    ]
-  }
-}
-
-Rules:
-1. capabilityDependencies: List which capabilities depend on other capabilities (from depends on to)
-2. enablerAssignments: Assign each enabler to its parent capability based on content
-3. Look for mentions of dependencies, relationships, or parent capabilities in the content
-
-Return ONLY the JSON object.`)
+		// A simpler prompt just for relationships
+		ctx, prompt, err := renderPrompt(ctx, s.promptLibrary(), "specification-relationships", req.WorkspacePath, map[string]interface{}{
+			"Capabilities": preCapabilities,
+			"Enablers":     preEnablers,
+			"Files":        req.Files,
+		})
+		if err != nil {
+			return nil, jobs.Permanent(err)
+		}
+		t.Logf("Using prompt %s", promptRef(ctx))
 
 		// Create Anthropic client and call API for relationships
-		client := NewAnthropicClient(req.AnthropicKey)
-		response, err := client.SendMessage(r.Context(), filesContent.String())
+		t.Progress(30, "Waiting for Claude to relate capabilities and enablers")
+		client := NewAnthropicClient(apiKey)
+		var relResult specificationRelationships
+		claudeReq := messageRequest(prompt)
+		key := structuredKey(claudeReq, "record_relationships", &relResult, specificationDigests(req.Files))
+		status, err := s.cachedAICall(ctx, key, req.NoCache, &relResult, func(ctx context.Context) error {
+			return client.SendStructured(ctx, claudeReq, "record_relationships",
+				"Record how the capabilities and enablers relate", &relResult)
+		})
+		if status == aicache.StatusHit {
+			t.Logf("Relationships answered from the AI cache")
+		}
 		if err != nil {
 			// If AI fails, return pre-created items without relationships
 			fmt.Printf("[Analyze] AI relationship analysis failed: %v, returning pre-created items\n", err)
+			t.Warnf("Relationship analysis failed, returning capabilities and enablers without relationships: %v", err)
 			result := AnalyzeSpecificationsResponse{
 				Capabilities: preCapabilities,
 				Enablers:     preEnablers,
 			}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(result)
-			return
+			return result, nil
 		}
 
-		// Parse relationships from AI response
-		jsonStart := strings.Index(response, "{")
-		jsonEnd := strings.LastIndex(response, "}")
-		if jsonStart != -1 && jsonEnd != -1 && jsonEnd > jsonStart {
-			jsonStr := response[jsonStart : jsonEnd+1]
-			var relResult struct {
-				Relationships struct {
-					CapabilityDependencies []struct {
-						From string `json:"from"`
-						To   string `json:"to"`
-					} `json:"capabilityDependencies"`
-					EnablerAssignments []struct {
-						EnablerID    string `json:"enablerId"`
-						CapabilityID string `json:"capabilityId"`
-					} `json:"enablerAssignments"`
-				} `json:"relationships"`
-			}
-
-			if err := json.Unmarshal([]byte(jsonStr), &relResult); err == nil {
-				// Apply dependencies to capabilities
-				for _, dep := range relResult.Relationships.CapabilityDependencies {
-					for i := range preCapabilities {
-						if preCapabilities[i].ID == dep.From {
-							preCapabilities[i].DownstreamImpacts = append(preCapabilities[i].DownstreamImpacts, dep.To)
-						}
-						if preCapabilities[i].ID == dep.To {
-							preCapabilities[i].UpstreamDependencies = append(preCapabilities[i].UpstreamDependencies, dep.From)
-						}
-					}
+		// Apply dependencies to capabilities
+		for _, dep := range relResult.Relationships.CapabilityDependencies {
+			for i := range preCapabilities {
+				if preCapabilities[i].ID == dep.From {
+					preCapabilities[i].DownstreamImpacts = append(preCapabilities[i].DownstreamImpacts, dep.To)
 				}
+				if preCapabilities[i].ID == dep.To {
+					preCapabilities[i].UpstreamDependencies = append(preCapabilities[i].UpstreamDependencies, dep.From)
+				}
+			}
+		}
 
-				// Apply enabler assignments
-				for _, assign := range relResult.Relationships.EnablerAssignments {
-					for i := range preEnablers {
-						if preEnablers[i].ID == assign.EnablerID {
-							preEnablers[i].CapabilityID = assign.CapabilityID
-							// Also add to capability's enablers list
-							for j := range preCapabilities {
-								if preCapabilities[j].ID == assign.CapabilityID {
-									preCapabilities[j].Enablers = append(preCapabilities[j].Enablers, assign.EnablerID)
-								}
-							}
+		// Apply enabler assignments
+		for _, assign := range relResult.Relationships.EnablerAssignments {
+			for i := range preEnablers {
+				if preEnablers[i].ID == assign.EnablerID {
+					preEnablers[i].CapabilityID = assign.CapabilityID
+					// Also add to capability's enablers list
+					for j := range preCapabilities {
+						if preCapabilities[j].ID == assign.CapabilityID {
+							preCapabilities[j].Enablers = append(preCapabilities[j].Enablers, assign.EnablerID)
 						}
 					}
 				}
@@ -630,92 +632,36 @@ Return ONLY the JSON object.`)
 
 		fmt.Printf("[Analyze] Final result: %d capabilities, %d enablers\n", len(result.Capabilities), len(result.Enablers))
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(result)
-		return
+		return result, nil
 	}
 
 	// Fall back to original full AI analysis if no CAP/ENB files found
 	// Create Anthropic client
-	client := NewAnthropicClient(req.AnthropicKey)
+	client := NewAnthropicClient(apiKey)
 
 	// Prepare the prompt for Claude
-	var filesContent strings.Builder
-	filesContent.WriteString("Analyze the following specification files. IMPORTANT: Create a capability entry for EACH file provided.\n\n")
-	filesContent.WriteString("Each markdown file represents either a capability, feature, or enabler.\n\n")
-
-	// List all files first
-	filesContent.WriteString("FILES TO PROCESS (create one capability/enabler for each):\n")
-	for i, file := range req.Files {
-		filesContent.WriteString(fmt.Sprintf("%d. %s\n", i+1, file.Filename))
-	}
-	filesContent.WriteString("\n")
-
-	for _, file := range req.Files {
-		filesContent.WriteString(fmt.Sprintf("=== File: %s ===\n", file.Filename))
-		filesContent.WriteString(file.Content)
-		filesContent.WriteString("\n\n")
-	}
-
-	filesContent.WriteString(fmt.Sprintf("\nIMPORTANT: You MUST create exactly %d capabilities/enablers - one for each file listed above.\n\n", len(req.Files)))
-	filesContent.WriteString("Please extract and return a JSON object with the following structure:\n")
-	filesContent.WriteString(`{
-  "capabilities": [
-    {
-      "id": "CAP-XXXXXX",
-      "name": "Capability Name (from file title or first heading)",
-      "status": "Implemented/Planned/In Progress/etc",
-      "type": "Capability",
-      "enablers": ["ENB-XXXXXX", ...],
-      "upstreamDependencies": ["CAP-XXXXXX", ...],
-      "downstreamImpacts": ["CAP-XXXXXX", ...]
-    }
-  ],
-  "enablers": [
-    {
-      "id": "ENB-XXXXXX",
-      "name": "Enabler Name",
-      "capabilityId": "CAP-XXXXXX",
-      "status": "Implemented/Planned/etc",
-      "type": "Enabler"
-    }
-  ]
-}
-
-Rules:
-1. Create ONE entry for EACH file - do not skip any files
-2. If a file has "enabler" in the name or content, add it to enablers array
-3. Otherwise, add it to capabilities array
-4. Extract the name from the first # heading or the filename
-5. Extract status from metadata if present, otherwise use "Planned"
-6. Look for dependencies and enablers mentioned in the content
-7. Generate unique IDs like CAP-001, CAP-002 for capabilities and ENB-001, ENB-002 for enablers
-
-Return ONLY the JSON object, no additional text.`)
-
-	// Call Claude API
-	response, err := client.SendMessage(r.Context(), filesContent.String())
+	ctx, prompt, err := renderPrompt(ctx, s.promptLibrary(), "specification-analysis", req.WorkspacePath, map[string]interface{}{
+		"Files": req.Files,
+	})
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to analyze specifications: %v", err), http.StatusInternalServerError)
-		return
+		return nil, jobs.Permanent(err)
 	}
+	t.Logf("Using prompt %s", promptRef(ctx))
 
-	// Parse Claude's response as JSON
+	// Call Claude API
+	t.Progress(30, "Waiting for Claude")
 	var analysisResult AnalyzeSpecificationsResponse
-	if err := json.Unmarshal([]byte(response), &analysisResult); err != nil {
-		// If direct parsing fails, try to extract JSON from the response
-		jsonStart := strings.Index(response, "{")
-		jsonEnd := strings.LastIndex(response, "}")
-		if jsonStart != -1 && jsonEnd != -1 && jsonEnd > jsonStart {
-			jsonStr := response[jsonStart : jsonEnd+1]
-			if err := json.Unmarshal([]byte(jsonStr), &analysisResult); err != nil {
-				http.Error(w, fmt.Sprintf("failed to parse Claude response: %v", err), http.StatusInternalServerError)
-				return
-			}
-		} else {
-			http.Error(w, fmt.Sprintf("failed to parse Claude response: %v", err), http.StatusInternalServerError)
-			return
-		}
+	claudeReq := messageRequest(prompt)
+	key := structuredKey(claudeReq, "record_specifications", &analysisResult, specificationDigests(req.Files))
+	status, err := s.cachedAICall(ctx, key, req.NoCache, &analysisResult, func(ctx context.Context) error {
+		return client.SendStructured(ctx, claudeReq, "record_specifications",
+			"Record a capability or enabler for every specification file", &analysisResult)
+	})
+	if status == aicache.StatusHit {
+		t.Logf("Specifications answered from the AI cache")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to analyze specifications: %v", err)
 	}
 
 	// Fallback: Ensure all files are represented as capabilities
@@ -781,16 +727,17 @@ Return ONLY the JSON object, no additional text.`)
 	fmt.Printf("[Analyze] Final result: %d capabilities, %d enablers from %d files\n",
 		len(analysisResult.Capabilities), len(analysisResult.Enablers), len(req.Files))
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(analysisResult)
+	return analysisResult, nil
 }
 
 // GenerateDiagramRequest represents the request for generating diagrams
 type GenerateDiagramRequest struct {
-	Files        []SpecificationFile `json:"files"`
-	AnthropicKey string              `json:"anthropic_key"`
-	DiagramType  string              `json:"diagram_type"`
-	Prompt       string              `json:"prompt"`
+	Files         []SpecificationFile `json:"files"`
+	AnthropicKey  string              `json:"anthropic_key"`
+	DiagramType   string              `json:"diagram_type"`
+	Prompt        string              `json:"prompt"`
+	WorkspacePath string              `json:"workspacePath,omitempty"` // Selects the workspace's prompt overrides
+	NoCache       bool                `json:"noCache,omitempty"`       // Ask Claude even when the AI cache has an answer
 }
 
 // GenerateDiagramResponse represents the generated diagram
@@ -832,24 +779,34 @@ func (h *Handler) HandleGenerateDiagram(w http.ResponseWriter, r *http.Request)
 	client := NewAnthropicClient(req.AnthropicKey)
 
 	// Prepare the prompt for Claude
-	var filesContent strings.Builder
-	filesContent.WriteString("Here are the specification files for a software system:\n\n")
-
-	for _, file := range req.Files {
-		filesContent.WriteString(fmt.Sprintf("=== File: %s ===\n", file.Filename))
-		filesContent.WriteString(file.Content)
-		filesContent.WriteString("\n\n")
+	ctx, prompt, err := renderPrompt(r.Context(), h.service.promptLibrary(), "diagram-generation",
+		scopedWorkspacePath(r, req.WorkspacePath), map[string]interface{}{
+			"Files":        req.Files,
+			"DiagramType":  req.DiagramType,
+			"Instructions": req.Prompt,
+		})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to build prompt: %v", err), http.StatusInternalServerError)
+		return
 	}
 
-	filesContent.WriteString("\n")
-	filesContent.WriteString(req.Prompt)
-
-	// Call Claude API
-	response, err := client.SendMessage(r.Context(), filesContent.String())
+	// Call Claude API, unless the same files and instructions were drawn before
+	var response string
+	key := aicache.Key{
+		Model:  messageRequest(prompt).Model,
+		Params: map[string]interface{}{"diagramType": req.DiagramType, "instructions": req.Prompt},
+		Inputs: specificationDigests(req.Files),
+	}
+	status, err := h.service.cachedAICall(ctx, key, req.NoCache || noCache(r), &response, func(ctx context.Context) error {
+		var err error
+		response, err = client.SendMessage(ctx, prompt)
+		return err
+	})
 	if err != nil {
 		http.Error(w, fmt.Sprintf("failed to generate diagram: %v", err), http.StatusInternalServerError)
 		return
 	}
+	setCacheStatus(w, status)
 
 	// Clean up the response - extract just the Mermaid code
 	diagram := response
@@ -918,6 +875,7 @@ func (h *Handler) HandleAnalyzeApplication(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	req.WorkspacePath = scopedWorkspacePath(r, req.WorkspacePath)
 	if req.WorkspacePath == "" {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(AnalyzeApplicationResponse{Error: "workspacePath is required"})
@@ -936,6 +894,35 @@ func (h *Handler) HandleAnalyzeApplication(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// The key stays out of the stored job parameters
+	apiKey := req.APIKey
+	req.APIKey = ""
+	job := h.runJob(w, r, models.JobAnalyzeApplication, req.WorkspacePath, req, apiKey)
+	if job == nil {
+		return
+	}
+
+	var resp AnalyzeApplicationResponse
+	if err := jobResult(job, &resp); err != nil {
+		resp = AnalyzeApplicationResponse{Error: err.Error()}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// analyzeApplication is the analyze_application job: it sends the workspace's
+// specifications and images to Claude with the user's prompt and creates the files and
+// folders Claude asks for
+func (s *Service) analyzeApplication(ctx context.Context, t *jobs.Task) (interface{}, error) {
+	var req AnalyzeApplicationRequest
+	if err := t.Params(&req); err != nil {
+		return nil, err
+	}
+	apiKey := t.Secret()
+	if apiKey == "" {
+		return nil, errSecretUnavailable
+	}
+
 	// Read specification files from the workspace
 	specsPath := filepath.Join(req.WorkspacePath, "specifications")
 	assetsPath := filepath.Join(req.WorkspacePath, "assets")
@@ -959,6 +946,7 @@ func (h *Handler) HandleAnalyzeApplication(w http.ResponseWriter, r *http.Reques
 
 	// Collect images from specifications and assets folders
 	var images []ImageData
+	imageBytes, skippedImages := 0, 0
 	imageExtensions := map[string]string{
 		".png":  "image/png",
 		".jpg":  "image/jpeg",
@@ -979,12 +967,19 @@ func (h *Handler) HandleAnalyzeApplication(w http.ResponseWriter, r *http.Reques
 			ext := strings.ToLower(filepath.Ext(info.Name()))
 			if mediaType, ok := imageExtensions[ext]; ok {
 				imgData, readErr := os.ReadFile(path)
-				if readErr == nil && len(imgData) < 20*1024*1024 { // Max 20MB per image
-					images = append(images, ImageData{
-						MediaType: mediaType,
-						Data:      base64.StdEncoding.EncodeToString(imgData),
-					})
+				if readErr != nil || len(imgData) >= 20*1024*1024 { // Max 20MB per image
+					return nil
+				}
+				// Keep the request within the API's size limit
+				if len(images) >= maxPromptImages || imageBytes+len(imgData) > maxPromptImageBytes {
+					skippedImages++
+					return nil
 				}
+				imageBytes += len(imgData)
+				images = append(images, ImageData{
+					MediaType: mediaType,
+					Data:      base64.StdEncoding.EncodeToString(imgData),
+				})
 			}
 			return nil
 		})
@@ -997,42 +992,42 @@ func (h *Handler) HandleAnalyzeApplication(w http.ResponseWriter, r *http.Reques
 	// Get workspace name from path
 	workspaceName := filepath.Base(req.WorkspacePath)
 
-	// Add format instructions for file creation
-	formatInstructions := fmt.Sprintf(`
 
-IMPORTANT: To create files and folders, use these exact XML tags:
-- To create a folder: <create_folder>./%s/path/to/folder</create_folder>
-- To create a file: <create_file path="./%s/path/to/file.md">file content here</create_file>
+	// Large workspaces send only the spec passages most relevant to the prompt
+	specs := s.fitContext(ctx, req.WorkspacePath, retrieval.KindSpec, req.Prompt, specsContent.String(), specContextTokens)
 
-The current workspace is "%s". All paths should be relative and include the workspace name.
-For example:
-- Specifications go in: ./%s/specifications/
-- Code goes in: ./%s/code/
-- Assets go in: ./%s/assets/
-
-Create all necessary markdown files for capabilities, storyboards, dependencies, etc.
-`, workspaceName, workspaceName, workspaceName, workspaceName, workspaceName, workspaceName)
-
-	// Build the full prompt
-	fullPrompt := fmt.Sprintf("%s%s\n\n%s", req.Prompt, formatInstructions, specsContent.String())
+	// Build the full prompt, with the instructions for creating files and folders
+	ctx, fullPrompt, err := renderPrompt(ctx, s.promptLibrary(), "application-analysis", req.WorkspacePath, map[string]interface{}{
+		"Prompt":         req.Prompt,
+		"WorkspaceName":  workspaceName,
+		"Specifications": specs,
+	})
+	if err != nil {
+		return nil, jobs.Permanent(err)
+	}
+	t.Logf("Using prompt %s", promptRef(ctx))
 
 	// Create Anthropic client and send request
-	client := NewAnthropicClient(req.APIKey)
+	if skippedImages > 0 {
+		t.Logf("Left out %d image(s) to stay within the request size limit", skippedImages)
+	}
+	t.Logf("Sending the specifications with %d image(s)", len(images))
+	t.Progress(30, "Waiting for Claude")
+	client := NewAnthropicClient(apiKey)
 	var response string
 	if len(images) > 0 {
 		// Use multimodal API with images
-		response, err = client.SendMessageWithImages(r.Context(), fullPrompt, images)
+		response, err = client.SendMessageWithImages(ctx, fullPrompt, images)
 	} else {
 		// Use text-only API
-		response, err = client.SendMessage(r.Context(), fullPrompt)
+		response, err = client.SendMessage(ctx, fullPrompt)
 	}
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(AnalyzeApplicationResponse{Error: fmt.Sprintf("failed to analyze application: %v", err)})
-		return
+		return nil, fmt.Errorf("failed to analyze application: %v", err)
 	}
 
 	// Parse and execute file operations from Claude's response
+	t.Progress(90, "Writing files")
 	filesCreated := 0
 	foldersCreated := 0
 
@@ -1082,8 +1077,8 @@ Create all necessary markdown files for capabilities, storyboards, dependencies,
 	summary := fmt.Sprintf("\n\n--- Analysis Complete ---\nFolders created: %d\nFiles created: %d", foldersCreated, filesCreated)
 	response = response + summary
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(AnalyzeApplicationResponse{Response: response})
+	t.Logf("Created %d folder(s) and %d file(s)", foldersCreated, filesCreated)
+	return AnalyzeApplicationResponse{Response: response}, nil
 }
 
 // ExportIdeationRequest represents the request for exporting ideation to markdown
@@ -1133,6 +1128,7 @@ func (h *Handler) HandleExportIdeation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	req.WorkspacePath = scopedWorkspacePath(r, req.WorkspacePath)
 	if req.WorkspacePath == "" {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(ExportIdeationResponse{Error: "workspacePath is required"})
@@ -1419,6 +1415,43 @@ type EnsureWorkspaceStructureResponse struct {
 	ExistingFolders []string `json:"existing_folders"`
 }
 
+// workspaceSubfolders are the folders every workspace is expected to have
+var workspaceSubfolders = []string{
+	"conception",
+	"definition",
+	"design",
+	"implementation",
+	"assets",
+	"code",
+	"deploy",
+	"scripts",
+	"AI_Principles",
+	"UI_Design",
+	"specifications", // Keep specifications folder as it was already being created
+}
+
+// ensureWorkspaceStructure creates a workspace folder and any missing subfolders
+func ensureWorkspaceStructure(root string) (created, existing []string, err error) {
+	// Ensure the main workspace folder exists
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create workspace folder: %v", err)
+	}
+
+	// Create each subfolder if it doesn't exist
+	for _, folder := range workspaceSubfolders {
+		folderPath := filepath.Join(root, folder)
+		if _, err := os.Stat(folderPath); os.IsNotExist(err) {
+			if err := os.MkdirAll(folderPath, 0755); err != nil {
+				return nil, nil, fmt.Errorf("failed to create folder %s: %v", folder, err)
+			}
+			created = append(created, folder)
+		} else {
+			existing = append(existing, folder)
+		}
+	}
+	return created, existing, nil
+}
+
 // HandleEnsureWorkspaceStructure handles POST /folders/ensure-workspace-structure
 // Creates all required workspace subfolders if they don't exist
 func (h *Handler) HandleEnsureWorkspaceStructure(w http.ResponseWriter, r *http.Request) {
@@ -1439,47 +1472,12 @@ func (h *Handler) HandleEnsureWorkspaceStructure(w http.ResponseWriter, r *http.
 		return
 	}
 
-	// Define the required workspace subfolders
-	requiredFolders := []string{
-		"conception",
-		"definition",
-		"design",
-		"implementation",
-		"assets",
-		"code",
-		"deploy",
-		"scripts",
-		"AI_Principles",
-		"UI_Design",
-		"specifications", // Keep specifications folder as it was already being created
-	}
-
-	var createdFolders []string
-	var existingFolders []string
-
-	// Ensure the main workspace folder exists
-	if err := os.MkdirAll(req.Path, 0755); err != nil {
-		http.Error(w, fmt.Sprintf("failed to create workspace folder: %v", err), http.StatusInternalServerError)
+	createdFolders, existingFolders, err := ensureWorkspaceStructure(req.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Create each subfolder if it doesn't exist
-	for _, folder := range requiredFolders {
-		folderPath := filepath.Join(req.Path, folder)
-
-		// Check if folder exists
-		if _, err := os.Stat(folderPath); os.IsNotExist(err) {
-			// Create the folder
-			if err := os.MkdirAll(folderPath, 0755); err != nil {
-				http.Error(w, fmt.Sprintf("failed to create folder %s: %v", folder, err), http.StatusInternalServerError)
-				return
-			}
-			createdFolders = append(createdFolders, folder)
-		} else {
-			existingFolders = append(existingFolders, folder)
-		}
-	}
-
 	response := EnsureWorkspaceStructureResponse{
 		Success:        true,
 		Path:           req.Path,
@@ -1515,6 +1513,7 @@ func (h *Handler) HandleCapabilityFiles(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	req.WorkspacePath = scopedWorkspacePath(r, req.WorkspacePath)
 	if req.WorkspacePath == "" {
 		http.Error(w, "workspacePath is required", http.StatusBadRequest)
 		return
@@ -1652,6 +1651,7 @@ func (h *Handler) HandleEnablerFiles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	req.WorkspacePath = scopedWorkspacePath(r, req.WorkspacePath)
 	if req.WorkspacePath == "" {
 		http.Error(w, "workspacePath is required", http.StatusBadRequest)
 		return
@@ -1893,6 +1893,7 @@ func (h *Handler) HandleSaveCapability(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("failed to save file: %v", err), http.StatusInternalServerError)
 		return
 	}
+	h.service.SpecFilesChanged([]string{req.Path}, nil)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -1930,6 +1931,7 @@ func (h *Handler) HandleDeleteCapability(w http.ResponseWriter, r *http.Request)
 		http.Error(w, fmt.Sprintf("failed to delete file: %v", err), http.StatusInternalServerError)
 		return
 	}
+	h.service.SpecFilesChanged(nil, []string{req.Path})
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -2247,6 +2249,7 @@ func (h *Handler) HandleStoryFiles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	req.WorkspacePath = scopedWorkspacePath(r, req.WorkspacePath)
 	if req.WorkspacePath == "" {
 		http.Error(w, "workspacePath is required", http.StatusBadRequest)
 		return
@@ -2588,6 +2591,7 @@ func (h *Handler) HandleIdeationFiles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	req.WorkspacePath = scopedWorkspacePath(r, req.WorkspacePath)
 	if req.WorkspacePath == "" {
 		http.Error(w, "workspacePath is required", http.StatusBadRequest)
 		return
@@ -2777,7 +2781,7 @@ type AnalyzedCard struct {
 	ID          string `json:"id"`
 	Title       string `json:"title"`
 	Description string `json:"description"`
-	Status      string `json:"status"`
+	Status      string `json:"status" jsonschema:"enum=pending|in-progress|completed"`
 	X           int    `json:"x"`
 	Y           int    `json:"y"`
 }
@@ -2800,6 +2804,7 @@ func (h *Handler) HandleAnalyzeStoryboard(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	req.WorkspacePath = scopedWorkspacePath(r, req.WorkspacePath)
 	if req.WorkspacePath == "" {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(StoryboardAnalysisResult{
@@ -2841,6 +2846,7 @@ func (h *Handler) HandleAnalyzeStoryboard(w http.ResponseWriter, r *http.Request
 
 	// Read the relevant markdown files
 	var filesContent strings.Builder
+	inputs := map[string]string{}
 	filesToRead := []string{
 		"storyboards.md", "storyboard.md", "stories.md",
 		"dependencies.md", "dependency.md",
@@ -2853,6 +2859,7 @@ func (h *Handler) HandleAnalyzeStoryboard(w http.ResponseWriter, r *http.Request
 		content, err := os.ReadFile(filePath)
 		if err == nil {
 			filesContent.WriteString(fmt.Sprintf("\n=== %s ===\n%s\n", filename, string(content)))
+			inputs[filename] = aicache.Digest(string(content))
 			filesFound++
 		}
 	}
@@ -2866,6 +2873,8 @@ func (h *Handler) HandleAnalyzeStoryboard(w http.ResponseWriter, r *http.Request
 			content, err := os.ReadFile(path)
 			if err == nil {
 				filesContent.WriteString(fmt.Sprintf("\n=== %s ===\n%s\n", info.Name(), string(content)))
+				rel, _ := filepath.Rel(specsPath, path)
+				inputs[filepath.ToSlash(rel)] = aicache.Digest(string(content))
 				filesFound++
 			}
 		}
@@ -2890,94 +2899,36 @@ func (h *Handler) HandleAnalyzeStoryboard(w http.ResponseWriter, r *http.Request
 	}
 
 	// Build the prompt for Claude
-	prompt := fmt.Sprintf(`Analyze the following markdown files and create a comprehensive storyboard diagram structure.
-
-Your task is to:
-1. Identify all distinct stories, features, or user flows
-2. Determine the dependencies and relationships between them
-3. Assign appropriate positions (x, y) for a clean flow diagram layout
-4. Determine the status of each item (pending, in-progress, or completed)
-
-IMPORTANT: Return ONLY valid JSON, no other text. The JSON must follow this exact structure:
-
-{
-  "cards": [
-    {
-      "id": "card-1",
-      "title": "Story Title",
-      "description": "Brief description of this story/feature",
-      "status": "pending",
-      "x": 100,
-      "y": 100
-    }
-  ],
-  "connections": [
-    {
-      "id": "conn-1-2",
-      "from": "card-1",
-      "to": "card-2"
-    }
-  ]
-}
-
-Layout Guidelines:
-- Start positions at x=100, y=100
-- Space cards horizontally by 400px for related items
-- Space cards vertically by 200px for sequential flow
-- Create a logical left-to-right, top-to-bottom flow
-- Group related features together
-- Entry points should be at the top/left
-- Terminal states should be at the bottom/right
-
-Status Guidelines:
-- "completed" - if marked as done/implemented
-- "in-progress" - if partially done or being worked on
-- "pending" - default for new/planned items
-
-Connection Guidelines:
-- Connect items that have dependencies
-- Connect sequential user flow steps
-- Connect parent features to child features
-- A connection means "from" must be done before "to" can start
-
-Here are the files to analyze:
-%s
-
-Remember: Return ONLY the JSON object, nothing else.`, filesContent.String())
-
-	// Call Claude API
-	client := NewAnthropicClient(req.APIKey)
-	response, err := client.SendMessage(r.Context(), prompt)
+	ctx, prompt, err := renderPrompt(r.Context(), h.service.promptLibrary(), "storyboard-analysis", req.WorkspacePath, map[string]interface{}{
+		"Files": filesContent.String(),
+	})
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(StoryboardAnalysisResult{
-			Error: fmt.Sprintf("Failed to analyze with Claude: %v", err),
-		})
-		return
-	}
-
-	// Parse the JSON response from Claude
-	// Find the JSON in the response (in case Claude adds extra text)
-	jsonStart := strings.Index(response, "{")
-	jsonEnd := strings.LastIndex(response, "}")
-	if jsonStart == -1 || jsonEnd == -1 {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(StoryboardAnalysisResult{
-			Error: "Claude did not return valid JSON",
+			Error: fmt.Sprintf("Failed to build prompt: %v", err),
 		})
 		return
 	}
 
-	jsonStr := response[jsonStart : jsonEnd+1]
-
-	var result StoryboardAnalysisResult
-	if err := json.Unmarshal([]byte(jsonStr), &result); err != nil {
+	// Call Claude API, unless the same files were analyzed before. ForceRegenerate asks
+	// Claude again.
+	client := NewAnthropicClient(req.APIKey)
+	var layout storyboardLayout
+	claudeReq := messageRequest(prompt)
+	key := structuredKey(claudeReq, "record_storyboard", &layout, inputs)
+	status, err := h.service.cachedAICall(ctx, key, req.ForceRegenerate || noCache(r), &layout, func(ctx context.Context) error {
+		return client.SendStructured(ctx, claudeReq, "record_storyboard",
+			"Record the storyboard's cards and the connections between them", &layout)
+	})
+	setCacheStatus(w, status)
+	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(StoryboardAnalysisResult{
-			Error: fmt.Sprintf("Failed to parse Claude response: %v", err),
+			Error: fmt.Sprintf("Failed to analyze with Claude: %v", err),
 		})
 		return
 	}
+	result := StoryboardAnalysisResult{Cards: layout.Cards, Connections: layout.Connections}
 
 	// Save the result to storyboards-full.md
 	var fullContent strings.Builder
@@ -3030,6 +2981,7 @@ func (h *Handler) HandleSaveImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	req.WorkspacePath = scopedWorkspacePath(r, req.WorkspacePath)
 	if req.WorkspacePath == "" {
 		http.Error(w, "workspacePath is required", http.StatusBadRequest)
 		return
@@ -3079,6 +3031,7 @@ func (h *Handler) HandleActivateAIPreset(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	req.WorkspacePath = scopedWorkspacePath(r, req.WorkspacePath)
 	if req.WorkspacePath == "" {
 		http.Error(w, "workspacePath is required", http.StatusBadRequest)
 		return
@@ -3095,10 +3048,32 @@ func (h *Handler) HandleActivateAIPreset(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Record the preset in .ubeworkspace so AI changes to the workspace are held to it
+	config, err := readWorkspaceConfig(req.WorkspacePath)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read workspace config: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if config != nil {
+		config.ActiveAIPreset = req.PresetNumber
+		config.ProjectFolder = req.WorkspacePath
+		config.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+		if err := writeWorkspaceConfig(*config); err != nil {
+			http.Error(w, fmt.Sprintf("failed to save workspace config: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	rules, err := workspaceRules(req.WorkspacePath, req.PresetNumber)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to load AI policy rules: %v", err), http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
 		"message": fmt.Sprintf("AI Preset %d activated and copied to implementation folder", req.PresetNumber),
+		"rules":   rules,
 	})
 }
 
@@ -3107,13 +3082,14 @@ type AnalyzeCapabilitiesRequest struct {
 	Files                []SpecificationFile `json:"files"`
 	AnthropicKey         string              `json:"anthropic_key"`
 	ExistingCapabilities []string            `json:"existingCapabilities"`
+	WorkspacePath        string              `json:"workspacePath,omitempty"` // Selects the workspace's prompt overrides
 }
 
 // CapabilitySuggestion represents a suggested capability
 type CapabilitySuggestion struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
-	Type        string `json:"type"` // capability, feature, or enabler
+	Type        string `json:"type" jsonschema:"enum=capability|feature|enabler"`
 	Rationale   string `json:"rationale"`
 }
 
@@ -3135,124 +3111,43 @@ func (h *Handler) HandleAnalyzeCapabilities(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Combine all file contents
-	var allContent strings.Builder
-	allContent.WriteString("# Existing Specification Files\n\n")
+	// Combine all file contents, cut to what fits the context window
+	var files strings.Builder
 	for _, file := range req.Files {
-		allContent.WriteString(fmt.Sprintf("## File: %s\n\n%s\n\n---\n\n", file.Filename, file.Content))
-	}
-
-	// Add existing capabilities
-	if len(req.ExistingCapabilities) > 0 {
-		allContent.WriteString("# Existing Capabilities\n\n")
-		for _, cap := range req.ExistingCapabilities {
-			allContent.WriteString(fmt.Sprintf("- %s\n", cap))
-		}
-		allContent.WriteString("\n")
+		files.WriteString(fmt.Sprintf("## File: %s\n\n%s\n\n---\n\n", file.Filename, file.Content))
 	}
 
 	// Create prompt for Claude
-	prompt := fmt.Sprintf(`Analyze the following specification files and suggest new capabilities, features, or enablers that should be added based on the content.
-
-%s
-
-Based on your analysis, suggest 3-5 new items that are NOT already in the existing capabilities list. For each suggestion, provide:
-1. A clear name
-2. A description of what it does
-3. The type (capability, feature, or enabler)
-4. A rationale for why it should be added
-
-Return your response as a JSON array with this exact format:
-{
-  "suggestions": [
-    {
-      "name": "Example Name",
-      "description": "What this capability/feature/enabler does",
-      "type": "capability",
-      "rationale": "Why this should be added based on the specifications"
-    }
-  ]
-}
-
-Only return the JSON, no other text.`, allContent.String())
+	ctx, prompt, err := renderPrompt(r.Context(), h.service.promptLibrary(), "capability-suggestion",
+		scopedWorkspacePath(r, req.WorkspacePath), map[string]interface{}{
+			"Specifications":       retrieval.Truncate(files.String(), capabilityContextTokens),
+			"ExistingCapabilities": req.ExistingCapabilities,
+		})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to build prompt: %v", err), http.StatusInternalServerError)
+		return
+	}
 
 	// Call Claude API
-	requestBody := map[string]interface{}{
-		"model":      "claude-sonnet-4-20250514",
-		"max_tokens": 4096,
-		"messages": []map[string]string{
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	var result capabilitySuggestions
+	err = NewAnthropicClient(req.AnthropicKey).SendStructured(ctx, ClaudeRequest{
+		Model:     "claude-sonnet-4-20250514",
+		MaxTokens: 4096,
+		Messages: []ClaudeMessage{
 			{
-				"role":    "user",
-				"content": prompt,
+				Role:    "user",
+				Content: prompt,
 			},
 		},
-	}
-
-	jsonBody, err := json.Marshal(requestBody)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to marshal request: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	httpReq, err := http.NewRequest("POST", "https://api.anthropic.com/v1/messages", strings.NewReader(string(jsonBody)))
-	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to create request: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("x-api-key", req.AnthropicKey)
-	httpReq.Header.Set("anthropic-version", "2023-06-01")
-
-	client := &http.Client{Timeout: 60 * time.Second}
-	resp, err := client.Do(httpReq)
+	}, "record_suggestions", "Record the suggested capabilities, features and enablers", &result)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to call Claude API: %v", err), http.StatusInternalServerError)
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		http.Error(w, fmt.Sprintf("Claude API error: %s", string(body)), resp.StatusCode)
-		return
-	}
-
-	var claudeResp struct {
-		Content []struct {
-			Text string `json:"text"`
-		} `json:"content"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&claudeResp); err != nil {
-		http.Error(w, fmt.Sprintf("failed to decode Claude response: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	if len(claudeResp.Content) == 0 {
-		http.Error(w, "empty response from Claude", http.StatusInternalServerError)
-		return
-	}
-
-	// Parse the JSON response from Claude
-	responseText := claudeResp.Content[0].Text
-
-	// Extract JSON from response (in case there's extra text)
-	jsonStart := strings.Index(responseText, "{")
-	jsonEnd := strings.LastIndex(responseText, "}")
-	if jsonStart == -1 || jsonEnd == -1 {
-		http.Error(w, "invalid JSON in Claude response", http.StatusInternalServerError)
-		return
-	}
-
-	jsonStr := responseText[jsonStart : jsonEnd+1]
-
-	var result struct {
-		Suggestions []CapabilitySuggestion `json:"suggestions"`
-	}
-
-	if err := json.Unmarshal([]byte(jsonStr), &result); err != nil {
-		http.Error(w, fmt.Sprintf("failed to parse suggestions: %v", err), http.StatusInternalServerError)
+		status := http.StatusInternalServerError
+		if errors.Is(err, errBudgetExceeded) {
+			status = http.StatusPaymentRequired
+		}
+		http.Error(w, fmt.Sprintf("failed to call Claude API: %v", err), status)
 		return
 	}
 
@@ -3268,6 +3163,7 @@ func (h *Handler) HandleSaveSpecifications(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	req.WorkspacePath = scopedWorkspacePath(r, req.WorkspacePath)
 	if req.WorkspacePath == "" {
 		http.Error(w, "workspacePath is required", http.StatusBadRequest)
 		return
@@ -3310,6 +3206,7 @@ func (h *Handler) HandleSaveSpecifications(w http.ResponseWriter, r *http.Reques
 
 	// Save all files
 	savedFiles := []string{}
+	savedPaths := []string{}
 	for _, file := range req.Files {
 		if file.FileName == "" || file.Content == "" {
 			continue
@@ -3320,7 +3217,9 @@ func (h *Handler) HandleSaveSpecifications(w http.ResponseWriter, r *http.Reques
 			return
 		}
 		savedFiles = append(savedFiles, fmt.Sprintf("%s/%s", targetSubfolder, file.FileName))
+		savedPaths = append(savedPaths, filePath)
 	}
+	h.service.SpecFilesChanged(savedPaths, nil)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -3377,6 +3276,7 @@ func (h *Handler) HandleDeleteSpecification(w http.ResponseWriter, r *http.Reque
 		http.Error(w, fmt.Sprintf("failed to delete file: %v", err), http.StatusInternalServerError)
 		return
 	}
+	h.service.SpecFilesChanged(nil, []string{absolutePath})
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -3400,6 +3300,7 @@ func (h *Handler) HandleReadSpecification(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	req.WorkspacePath = scopedWorkspacePath(r, req.WorkspacePath)
 	if req.WorkspacePath == "" {
 		http.Error(w, "workspacePath is required", http.StatusBadRequest)
 		return
@@ -3475,6 +3376,7 @@ func (h *Handler) HandleReadStoryboardFiles(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	req.WorkspacePath = scopedWorkspacePath(r, req.WorkspacePath)
 	if req.WorkspacePath == "" {
 		http.Error(w, "workspacePath is required", http.StatusBadRequest)
 		return
@@ -3585,6 +3487,7 @@ func (h *Handler) HandleEpicFiles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	req.WorkspacePath = scopedWorkspacePath(r, req.WorkspacePath)
 	if req.WorkspacePath == "" {
 		http.Error(w, "workspacePath is required", http.StatusBadRequest)
 		return
@@ -3833,6 +3736,7 @@ func (h *Handler) HandleSaveEpic(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("failed to save file: %v", err), http.StatusInternalServerError)
 		return
 	}
+	h.service.SpecFilesChanged([]string{req.Path}, nil)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -3868,6 +3772,7 @@ func (h *Handler) HandleDeleteEpic(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("failed to delete file: %v", err), http.StatusInternalServerError)
 		return
 	}
+	h.service.SpecFilesChanged(nil, []string{req.Path})
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -3903,6 +3808,7 @@ func (h *Handler) HandleThemeFiles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	req.WorkspacePath = scopedWorkspacePath(r, req.WorkspacePath)
 	if req.WorkspacePath == "" {
 		http.Error(w, "workspacePath is required", http.StatusBadRequest)
 		return
@@ -4143,6 +4049,7 @@ func (h *Handler) HandleSaveTheme(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("failed to save file: %v", err), http.StatusInternalServerError)
 		return
 	}
+	h.service.SpecFilesChanged([]string{req.Path}, nil)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -4178,6 +4085,7 @@ func (h *Handler) HandleDeleteTheme(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("failed to delete file: %v", err), http.StatusInternalServerError)
 		return
 	}
+	h.service.SpecFilesChanged(nil, []string{req.Path})
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -4214,6 +4122,7 @@ func (h *Handler) HandleFeatureFiles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	req.WorkspacePath = scopedWorkspacePath(r, req.WorkspacePath)
 	if req.WorkspacePath == "" {
 		http.Error(w, "workspacePath is required", http.StatusBadRequest)
 		return
@@ -4412,6 +4321,7 @@ func (h *Handler) HandleSaveFeature(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("failed to save file: %v", err), http.StatusInternalServerError)
 		return
 	}
+	h.service.SpecFilesChanged([]string{req.Path}, nil)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -4447,6 +4357,7 @@ func (h *Handler) HandleDeleteFeature(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("failed to delete file: %v", err), http.StatusInternalServerError)
 		return
 	}
+	h.service.SpecFilesChanged(nil, []string{req.Path})
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -4473,6 +4384,7 @@ type WorkspaceConfig struct {
 	UpdatedAt        string                 `json:"updatedAt"`
 	Version          string                 `json:"version"`
 	CustomSettings   map[string]interface{} `json:"customSettings,omitempty"`
+	Template         *templates.Ref         `json:"template,omitempty"`
 }
 
 // SaveWorkspaceConfigRequest represents the request to save workspace config
@@ -4505,6 +4417,29 @@ func (h *Handler) HandleSaveWorkspaceConfig(w http.ResponseWriter, r *http.Reque
 		req.Config.Version = "1.0"
 	}
 
+	// Keep the registry row in step with the file; registered workspaces guard sharing and
+	// archival like PUT /workspaces/{id}
+	var registeredWorkspace *models.Workspace
+	folder := workspaceFolder(req.Config.ProjectFolder)
+	if h.service.workspaces != nil && folder != "" {
+		ws, err := h.service.workspaces.GetByFolder(folder)
+		switch {
+		case err == nil:
+			if ws.IsArchived() {
+				http.Error(w, "workspace is archived", http.StatusConflict)
+				return
+			}
+			if req.Config.IsShared != ws.IsShared && !canManageWorkspace(r, ws) {
+				http.Error(w, "only the workspace owner can change sharing", http.StatusForbidden)
+				return
+			}
+			registeredWorkspace = ws
+		case !errors.Is(err, repository.ErrWorkspaceNotFound):
+			http.Error(w, fmt.Sprintf("failed to look up workspace: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// Ensure the workspace folder exists
 	if err := os.MkdirAll(req.Config.ProjectFolder, 0755); err != nil {
 		http.Error(w, fmt.Sprintf("failed to create workspace folder: %v", err), http.StatusInternalServerError)
@@ -4527,11 +4462,27 @@ func (h *Handler) HandleSaveWorkspaceConfig(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	workspaceID := 0
+	if h.service.workspaces != nil && folder != "" {
+		var err error
+		if registeredWorkspace != nil {
+			registeredWorkspace, _, err = h.service.syncWorkspaceConfig(registeredWorkspace, &req.Config)
+		} else {
+			registeredWorkspace, err = h.service.registerWorkspaceFolder(folder, &req.Config, requestUserID(r))
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to update workspace registry: %v", err), http.StatusInternalServerError)
+			return
+		}
+		workspaceID = registeredWorkspace.ID
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"path":    configPath,
-		"message": "Workspace configuration saved successfully",
+		"success":     true,
+		"path":        configPath,
+		"workspaceId": workspaceID,
+		"message":     "Workspace configuration saved successfully",
 	})
 }
 
@@ -4541,6 +4492,7 @@ type ScannedWorkspace struct {
 	FolderPath string          `json:"folderPath"`
 	Config     *WorkspaceConfig `json:"config,omitempty"`
 	HasConfig  bool            `json:"hasConfig"`
+	WorkspaceID int            `json:"workspaceId,omitempty"` // Registry ID, once registered
 }
 
 // ScanWorkspacesResponse represents the response from scanning workspaces
@@ -4572,6 +4524,19 @@ func (h *Handler) HandleScanWorkspaces(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Report registry IDs so clients can address workspaces by ID
+	registered := map[string]int{}
+	if h.service.workspaces != nil {
+		rows, err := h.service.workspaces.List(true)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to list workspaces: %v", err), http.StatusInternalServerError)
+			return
+		}
+		for _, ws := range rows {
+			registered[ws.FolderName] = ws.ID
+		}
+	}
+
 	var workspaces []ScannedWorkspace
 
 	for _, entry := range entries {
@@ -4592,6 +4557,7 @@ func (h *Handler) HandleScanWorkspaces(w http.ResponseWriter, r *http.Request) {
 			FolderName: entry.Name(),
 			FolderPath: folderPath,
 			HasConfig:  false,
+			WorkspaceID: registered[entry.Name()],
 		}
 
 		// Check if .ubeworkspace file exists
@@ -0,0 +1,340 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/jobs"
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/jareynolds/ubecode/pkg/repository"
+)
+
+// jobEventPoll is how often a job event stream checks the database for changes
+const jobEventPoll = time.Second
+
+// errSecretUnavailable fails a job whose API key was lost, e.g. because the service restarted
+var errSecretUnavailable = jobs.Permanent(errors.New("the API key for this job is no longer available; submit it again"))
+
+// EnableJobs runs AI generation and analysis as background jobs on the given manager.
+// Without it they run inline in the request.
+func (s *Service) EnableJobs(m *jobs.Manager, repo *repository.JobRepository) {
+	for _, kind := range s.jobKinds() {
+		m.Register(kind)
+	}
+	s.jobs = m
+	s.jobRepo = repo
+}
+
+// jobKinds lists the operations that run as jobs. Direct API calls are retried; the Claude
+// CLI is not, because a failed run may already have changed the workspace.
+func (s *Service) jobKinds() []jobs.Kind {
+	return []jobs.Kind{
+		{Name: models.JobGenerateCode, Run: s.metered(s.generateCode), Retry: jobs.RetryPolicy{MaxAttempts: 3, Backoff: 30 * time.Second}},
+		{Name: models.JobGenerateCodeCLI, Run: s.metered(s.generateCodeCLI), Retry: jobs.RetryPolicy{MaxAttempts: 1}},
+		{Name: models.JobAnalyzeApplication, Run: s.metered(s.analyzeApplication), Retry: jobs.RetryPolicy{MaxAttempts: 2, Backoff: 15 * time.Second}},
+		{Name: models.JobAnalyzeSpecifications, Run: s.metered(s.analyzeSpecifications), Retry: jobs.RetryPolicy{MaxAttempts: 2, Backoff: 15 * time.Second}},
+	}
+}
+
+// runJob submits a job for the request and waits for it to finish. It returns nil once it
+// has written the response itself: for clients that asked for an asynchronous reply
+// (Prefer: respond-async or ?async=true), which get 202 with the queued job, on errors, and
+// when the client went away (the job keeps running). secret is an API key that must not
+// be stored with the job.
+func (h *Handler) runJob(w http.ResponseWriter, r *http.Request, kind, workspacePath string, params interface{}, secret string) *models.Job {
+	data, err := json.Marshal(params)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to encode job parameters: %v", err), http.StatusInternalServerError)
+		return nil
+	}
+	job := &models.Job{
+		Kind:          kind,
+		WorkspacePath: workspacePath,
+		CreatedBy:     requestUserID(r),
+		Params:        data,
+	}
+
+	if h.service.jobs == nil {
+		h.service.runJobInline(r, job, secret)
+		return job
+	}
+
+	if err := h.service.jobs.Submit(job, secret); err != nil {
+		http.Error(w, fmt.Sprintf("failed to submit job: %v", err), http.StatusInternalServerError)
+		return nil
+	}
+	if preferAsync(r) {
+		w.Header().Set("Location", fmt.Sprintf("/jobs/%d", job.ID))
+		writeJSON(w, http.StatusAccepted, job)
+		return nil
+	}
+
+	w.Header().Set("X-Job-ID", strconv.Itoa(job.ID))
+	finished, err := h.service.jobs.Await(r.Context(), job.ID)
+	if err != nil {
+		if r.Context().Err() == nil {
+			http.Error(w, fmt.Sprintf("failed to wait for job: %v", err), http.StatusInternalServerError)
+		}
+		return nil
+	}
+	return finished
+}
+
+// runJobInline runs a job within the request when background jobs are not configured
+func (s *Service) runJobInline(r *http.Request, job *models.Job, secret string) {
+	job.Status = models.JobFailed
+	job.Attempts, job.MaxAttempts = 1, 1
+	for _, kind := range s.jobKinds() {
+		if kind.Name != job.Kind {
+			continue
+		}
+		result, err := kind.Run(r.Context(), jobs.NewTask(job, secret))
+		if err != nil {
+			job.Error = err.Error()
+			return
+		}
+		if job.Result, err = json.Marshal(result); err != nil {
+			job.Error = fmt.Sprintf("failed to encode result: %v", err)
+			return
+		}
+		job.Status = models.JobSucceeded
+		return
+	}
+	job.Error = fmt.Sprintf("unknown job kind %q", job.Kind)
+}
+
+// preferAsync reports whether the client asked not to wait for the job
+func preferAsync(r *http.Request) bool {
+	if async, _ := strconv.ParseBool(r.URL.Query().Get("async")); async {
+		return true
+	}
+	for _, pref := range strings.Split(r.Header.Get("Prefer"), ",") {
+		if strings.EqualFold(strings.TrimSpace(pref), "respond-async") {
+			return true
+		}
+	}
+	return false
+}
+
+// jobResult decodes a finished job's result into v, or returns the reason it did not succeed
+func jobResult(job *models.Job, v interface{}) error {
+	if job.Status != models.JobSucceeded {
+		if job.Error == "" {
+			return fmt.Errorf("job %s", job.Status)
+		}
+		return errors.New(job.Error)
+	}
+	return json.Unmarshal(job.Result, v)
+}
+
+// canAccessJob reports whether the caller may see or cancel a job: its creator or a user
+// with workspaces:admin. Anonymous requests only get this far when authentication is not
+// required.
+func canAccessJob(r *http.Request, job *models.Job) bool {
+	userID := requestUserID(r)
+	if userID == nil {
+		return true
+	}
+	if job.CreatedBy != nil && *job.CreatedBy == *userID {
+		return true
+	}
+	access, ok := r.Context().Value("access").(*models.AccessGrant)
+	return ok && access.Can(models.PermWorkspacesAdmin)
+}
+
+// loadJob returns the job named in the path, writing an error response when the caller
+// cannot see it
+func (h *Handler) loadJob(w http.ResponseWriter, r *http.Request) *models.Job {
+	if h.service.jobRepo == nil {
+		http.Error(w, "background jobs are not configured", http.StatusServiceUnavailable)
+		return nil
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid job id", http.StatusBadRequest)
+		return nil
+	}
+	job, err := h.service.jobRepo.Get(id)
+	if errors.Is(err, repository.ErrJobNotFound) || (err == nil && !canAccessJob(r, job)) {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return nil
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get job: %v", err), http.StatusInternalServerError)
+		return nil
+	}
+	return job
+}
+
+// HandleListJobs handles GET /jobs?status=&kind=&limit=
+// Users see their own jobs; workspaces:admin sees everyone's.
+func (h *Handler) HandleListJobs(w http.ResponseWriter, r *http.Request) {
+	if h.service.jobRepo == nil {
+		http.Error(w, "background jobs are not configured", http.StatusServiceUnavailable)
+		return
+	}
+	query := r.URL.Query()
+	filter := models.JobFilter{Status: query.Get("status"), Kind: query.Get("kind")}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+	if userID := requestUserID(r); userID != nil {
+		access, ok := r.Context().Value("access").(*models.AccessGrant)
+		if !ok || !access.Can(models.PermWorkspacesAdmin) {
+			filter.CreatedBy = userID
+		}
+	}
+
+	list, err := h.service.jobRepo.List(filter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to list jobs: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"jobs": list})
+}
+
+// HandleGetJob handles GET /jobs/{id}
+func (h *Handler) HandleGetJob(w http.ResponseWriter, r *http.Request) {
+	if job := h.loadJob(w, r); job != nil {
+		writeJSON(w, http.StatusOK, job)
+	}
+}
+
+// HandleJobLogs handles GET /jobs/{id}/logs?after=<log id>
+func (h *Handler) HandleJobLogs(w http.ResponseWriter, r *http.Request) {
+	job := h.loadJob(w, r)
+	if job == nil {
+		return
+	}
+	var after int64
+	if value := r.URL.Query().Get("after"); value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid after", http.StatusBadRequest)
+			return
+		}
+		after = n
+	}
+
+	logs, err := h.service.jobRepo.Logs(job.ID, after)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get job logs: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"logs": logs})
+}
+
+// HandleCancelJob handles POST /jobs/{id}/cancel
+func (h *Handler) HandleCancelJob(w http.ResponseWriter, r *http.Request) {
+	job := h.loadJob(w, r)
+	if job == nil {
+		return
+	}
+	if job.Finished() {
+		http.Error(w, fmt.Sprintf("job is already %s", job.Status), http.StatusConflict)
+		return
+	}
+
+	job, err := h.service.jobs.Cancel(job.ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to cancel job: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// HandleJobEvents handles GET /jobs/{id}/events
+// It streams a job as Server-Sent Events: "log" for each log line (its ID is the event ID,
+// so reconnecting with Last-Event-ID resumes after it), "progress" when progress changes
+// and "status" with the whole job when its status changes. The stream ends once the job
+// has finished.
+func (h *Handler) HandleJobEvents(w http.ResponseWriter, r *http.Request) {
+	job := h.loadJob(w, r)
+	if job == nil {
+		return
+	}
+	lastLogID, _ := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64)
+
+	// The stream outlives the server's WriteTimeout
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	lastWrite := time.Now()
+	send := func(event string, v interface{}) {
+		data, err := json.Marshal(v)
+		if err == nil {
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+			lastWrite = time.Now()
+		}
+	}
+
+	send("status", job)
+	status, progress, message := job.Status, job.Progress, job.ProgressMessage
+
+	poll := time.NewTicker(jobEventPoll)
+	defer poll.Stop()
+
+	for {
+		logs, err := h.service.jobRepo.Logs(job.ID, lastLogID)
+		if err != nil {
+			return
+		}
+		for _, l := range logs {
+			fmt.Fprintf(w, "id: %d\n", l.ID)
+			send("log", l)
+			lastLogID = l.ID
+		}
+		if job.Progress != progress || job.ProgressMessage != message {
+			progress, message = job.Progress, job.ProgressMessage
+			send("progress", map[string]interface{}{"progress": progress, "message": message})
+		}
+		if job.Status != status {
+			status = job.Status
+			send("status", job)
+		}
+		if job.Finished() && len(logs) == 0 {
+			rc.Flush()
+			return
+		}
+
+		if time.Since(lastWrite) >= sseKeepAlive {
+			fmt.Fprint(w, ": keep-alive\n\n")
+			lastWrite = time.Now()
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-poll.C:
+		}
+		if job, err = h.service.jobRepo.Get(job.ID); err != nil {
+			return
+		}
+	}
+}
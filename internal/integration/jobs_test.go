@@ -0,0 +1,42 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPreferAsync(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		prefer   string
+		expected bool
+	}{
+		{"default", "/generate-code", "", false},
+		{"query", "/generate-code?async=true", "", true},
+		{"query false", "/generate-code?async=false", "", false},
+		{"header", "/generate-code", "respond-async", true},
+		{"header among preferences", "/generate-code", "return=minimal, Respond-Async", true},
+		{"other preference", "/generate-code", "wait=10", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", tt.url, nil)
+			if tt.prefer != "" {
+				r.Header.Set("Prefer", tt.prefer)
+			}
+			if got := preferAsync(r); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
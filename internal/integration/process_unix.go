@@ -0,0 +1,31 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+//go:build !windows
+
+package integration
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// canRunAsUser reports whether local test runs can switch to another user
+const canRunAsUser = true
+
+// runAsUser starts cmd as the given user in its own process group and kills the whole group
+// on cancellation, so processes a test suite spawned do not outlive it
+func runAsUser(cmd *exec.Cmd, uid, gid uint32) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid:    true,
+		Credential: &syscall.Credential{Uid: uid, Gid: gid, Groups: []uint32{}},
+	}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,20 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+//go:build windows
+
+package integration
+
+import "os/exec"
+
+// canRunAsUser reports whether local test runs can switch to another user; Windows has no
+// equivalent of setuid, so local tests are not available there
+const canRunAsUser = false
+
+// runAsUser is never called on Windows, where EnableTestUser fails
+func runAsUser(cmd *exec.Cmd, uid, gid uint32) {}
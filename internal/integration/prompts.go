@@ -0,0 +1,198 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/jareynolds/ubecode/pkg/jsonschema"
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/jareynolds/ubecode/pkg/prompts"
+)
+
+// maxPromptSize caps a prompt file sent to POST /prompts/{name}/versions
+const maxPromptSize = 256 * 1024
+
+// builtinPrompts is the library used when no prompt directory is configured
+var builtinPrompts = prompts.NewLibrary("")
+
+// EnablePrompts reads prompt templates from a library directory as well as the builtin ones,
+// so prompts can be changed without rebuilding the service
+func (s *Service) EnablePrompts(lib *prompts.Library) {
+	s.prompts = lib
+}
+
+// promptLibrary returns the service's prompt library
+func (s *Service) promptLibrary() *prompts.Library {
+	if s.prompts == nil {
+		return builtinPrompts
+	}
+	return s.prompts
+}
+
+// anthropicClient creates an Anthropic client rendering its prompts from the service's library
+func (s *Service) anthropicClient(apiKey string) *AnthropicClient {
+	c := NewAnthropicClient(apiKey)
+	c.prompts = s.promptLibrary()
+	return c
+}
+
+// renderPrompt renders the prompt a workspace uses for name ("" for the library's newest
+// version). The returned context carries the prompt's ref so the AI usage recorded for the
+// call names the template version.
+func renderPrompt(ctx context.Context, lib *prompts.Library, name, workspacePath string, data map[string]interface{}) (context.Context, string, error) {
+	p, err := lib.Resolve(name, workspacePath)
+	if err != nil {
+		return ctx, "", fmt.Errorf("failed to load prompt %s: %w", name, err)
+	}
+	text, err := p.Render(data)
+	if err != nil {
+		return ctx, "", err
+	}
+	return context.WithValue(ctx, "prompt", p.Ref()), text, nil
+}
+
+// promptRef returns the ref of the prompt template an AI call was built from, or ""
+func promptRef(ctx context.Context) string {
+	ref, _ := ctx.Value("prompt").(string)
+	return ref
+}
+
+// promptSummary is a prompt in the GET /prompts listing
+type promptSummary struct {
+	*prompts.Prompt
+	Versions []string `json:"versions"` // Library versions, newest first
+}
+
+// newPromptSummary describes a prompt with its versions. Prompts answered through a
+// structured call show the schema the answer is validated against.
+func newPromptSummary(p *prompts.Prompt, versions []*prompts.Prompt) promptSummary {
+	if out, ok := structuredOutputs[p.Name]; ok {
+		withSchema := *p
+		withSchema.OutputSchema, _ = json.Marshal(jsonschema.For(out))
+		p = &withSchema
+	}
+	summary := promptSummary{Prompt: p, Versions: make([]string, len(versions))}
+	for i, v := range versions {
+		summary.Versions[i] = v.Version
+	}
+	return summary
+}
+
+// HandleListPrompts handles GET /prompts?workspacePath=...
+// Lists every prompt as the version a workspace would use, or the newest library version
+func (h *Handler) HandleListPrompts(w http.ResponseWriter, r *http.Request) {
+	lib := h.service.promptLibrary()
+	workspacePath := scopedWorkspacePath(r, r.URL.Query().Get("workspacePath"))
+
+	names, err := lib.Names()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to list prompts: %v", err), http.StatusInternalServerError)
+		return
+	}
+	list := make([]promptSummary, 0, len(names))
+	for _, name := range names {
+		versions, err := lib.Versions(name)
+		if errors.Is(err, prompts.ErrPromptNotFound) {
+			continue // Only unparseable versions
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to list prompts: %v", err), http.StatusInternalServerError)
+			return
+		}
+		effective, err := lib.Resolve(name, workspacePath)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to load prompt %s: %v", name, err), http.StatusInternalServerError)
+			return
+		}
+		list = append(list, newPromptSummary(effective, versions))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"prompts": list})
+}
+
+// HandleGetPrompt handles GET /prompts/{name}?workspacePath=...&version=...
+// Returns one version of a prompt, by default the one a workspace would use, with the
+// list of library versions
+func (h *Handler) HandleGetPrompt(w http.ResponseWriter, r *http.Request) {
+	lib := h.service.promptLibrary()
+	name := r.PathValue("name")
+	query := r.URL.Query()
+
+	versions, err := lib.Versions(name)
+	if errors.Is(err, prompts.ErrPromptNotFound) {
+		http.Error(w, fmt.Sprintf("prompt %s not found", name), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to load prompt: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	var p *prompts.Prompt
+	if version := query.Get("version"); version != "" {
+		p, err = lib.Get(name, version)
+	} else {
+		p, err = lib.Resolve(name, scopedWorkspacePath(r, query.Get("workspacePath")))
+	}
+	if errors.Is(err, prompts.ErrPromptNotFound) {
+		http.Error(w, fmt.Sprintf("prompt %s %s not found", name, query.Get("version")), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to load prompt: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newPromptSummary(p, versions))
+}
+
+// HandleSavePromptVersion handles POST /prompts/{name}/versions (workspace admins only)
+// Adds the prompt file sent as the request body as the prompt's next version, which AI
+// calls use from then on
+func (h *Handler) HandleSavePromptVersion(w http.ResponseWriter, r *http.Request) {
+	if access, ok := r.Context().Value("access").(*models.AccessGrant); ok && !access.Can(models.PermWorkspacesAdmin) {
+		http.Error(w, fmt.Sprintf("missing permission: %s", models.PermWorkspacesAdmin), http.StatusForbidden)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxPromptSize+1))
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	if len(data) == 0 {
+		http.Error(w, "prompt template is required", http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxPromptSize {
+		http.Error(w, fmt.Sprintf("prompt template is larger than %d KB", maxPromptSize/1024), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	lib := h.service.promptLibrary()
+	if lib.Dir() == "" {
+		http.Error(w, "no prompt library directory is configured", http.StatusServiceUnavailable)
+		return
+	}
+	p, err := lib.Save(r.PathValue("name"), data)
+	if errors.Is(err, prompts.ErrInvalidPrompt) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to save prompt: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, p)
+}
@@ -0,0 +1,74 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jareynolds/ubecode/pkg/prompts"
+)
+
+func TestRenderPrompt(t *testing.T) {
+	workspace := t.TempDir()
+	os.MkdirAll(filepath.Join(workspace, prompts.WorkspaceDir), 0755)
+	os.WriteFile(filepath.Join(workspace, prompts.WorkspaceDir, "diagram-generation.tmpl"), []byte("{{.Instructions}} for {{len .Files}} files"), 0644)
+
+	tests := []struct {
+		name      string
+		workspace string
+		data      map[string]interface{}
+		want      string
+		wantRef   string
+		wantErr   bool
+	}{
+		{
+			name:    "library version",
+			data:    map[string]interface{}{"Files": []SpecificationFile{{"a.md", "# A"}}, "DiagramType": "state", "Instructions": "Draw it"},
+			want:    "=== File: a.md ===\n# A\n\n\nDraw it",
+			wantRef: "diagram-generation@v1:",
+		},
+		{
+			name:      "workspace override",
+			workspace: workspace,
+			data:      map[string]interface{}{"Files": []SpecificationFile{{"a.md", "# A"}}, "DiagramType": "state", "Instructions": "Draw it"},
+			want:      "Draw it for 1 files",
+			wantRef:   "diagram-generation@workspace:",
+		},
+		{
+			name:    "missing variable",
+			data:    map[string]interface{}{"Files": []SpecificationFile{}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, text, err := renderPrompt(context.Background(), builtinPrompts, "diagram-generation", tt.workspace, tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				if promptRef(ctx) != "" {
+					t.Errorf("expected no prompt ref after an error, got %s", promptRef(ctx))
+				}
+				return
+			}
+			if !strings.HasSuffix(text, tt.want) {
+				t.Errorf("expected prompt to end with %q, got %q", tt.want, text)
+			}
+			if !strings.HasPrefix(promptRef(ctx), tt.wantRef) {
+				t.Errorf("expected ref %s..., got %s", tt.wantRef, promptRef(ctx))
+			}
+		})
+	}
+}
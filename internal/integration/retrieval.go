@@ -0,0 +1,175 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/retrieval"
+)
+
+// Token budgets for workspace context sent to the model
+const (
+	// chatContextTokens is how much retrieved spec and code context an AI chat message gets
+	chatContextTokens = 6000
+	// specContextTokens caps the specs sent to whole-application analysis and generation
+	specContextTokens = 80000
+	// capabilityContextTokens caps the spec files sent for capability suggestions
+	capabilityContextTokens = 60000
+
+	// Images sent with application analysis, kept well under the API's 32MB request limit
+	// once base64 encoded
+	maxPromptImages     = 20
+	maxPromptImageBytes = 20 * 1024 * 1024
+)
+
+// EnableRetrieval indexes workspace specs and code so AI endpoints can send the passages
+// relevant to a request instead of whole workspaces
+func (s *Service) EnableRetrieval(ix *retrieval.Index) {
+	s.retrieval = ix
+}
+
+// IndexWorkspaceForRetrieval brings the embedding index of a workspace up to date
+func (s *Service) IndexWorkspaceForRetrieval(ctx context.Context, workspacePath string) (retrieval.IndexStats, error) {
+	if s.retrieval == nil {
+		return retrieval.IndexStats{}, fmt.Errorf("retrieval is not configured")
+	}
+	root, err := resolveWorkspaceRoot(workspacePath)
+	if err != nil {
+		return retrieval.IndexStats{}, err
+	}
+	return s.retrieval.IndexWorkspace(ctx, filepath.Base(root), root)
+}
+
+// IndexAllWorkspacesForRetrieval updates the embedding index of every folder under workspaces/
+func (s *Service) IndexAllWorkspacesForRetrieval(ctx context.Context) {
+	entries, err := os.ReadDir("workspaces")
+	if err != nil {
+		log.Printf("Retrieval index: failed to list workspaces: %v", err)
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		stats, err := s.IndexWorkspaceForRetrieval(ctx, filepath.Join("workspaces", entry.Name()))
+		if err != nil {
+			log.Printf("Retrieval index: failed to index workspace %s: %v", entry.Name(), err)
+			continue
+		}
+		log.Printf("Retrieval index: embedded %d files (%d chunks), %d unchanged, %d removed in workspace %s",
+			stats.Files, stats.Chunks, stats.Unchanged, stats.Removed, entry.Name())
+	}
+}
+
+// retrievalFileChanged re-embeds a file the watcher saw change
+func (s *Service) retrievalFileChanged(e ChangeEvent) {
+	if s.retrieval == nil || e.RelPath == "" {
+		return
+	}
+	root := strings.TrimSuffix(e.Path, filepath.FromSlash(e.RelPath))
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := s.retrieval.IndexFile(ctx, filepath.Base(filepath.Clean(root)), root, e.RelPath); err != nil {
+			log.Printf("Retrieval index: failed to update %s: %v", e.RelPath, err)
+		}
+	}()
+}
+
+// fitContext returns workspace content for a prompt within budget tokens. full is used as
+// is when it fits; otherwise the chunks of kind ("" for any) most relevant to query are
+// retrieved, or full is truncated when retrieval is not configured or fails.
+func (s *Service) fitContext(ctx context.Context, workspacePath, kind, query, full string, budget int) string {
+	if retrieval.EstimateTokens(full) <= budget {
+		return full
+	}
+	if s.retrieval != nil {
+		retrieved, err := s.retrievedContext(ctx, workspacePath, kind, query, budget)
+		if err == nil && retrieved != "" {
+			return retrieved
+		}
+		if err != nil {
+			log.Printf("Retrieval failed, truncating context instead: %v", err)
+		}
+	}
+	return retrieval.Truncate(full, budget)
+}
+
+// retrievedContext returns the chunks of a workspace most relevant to query within budget
+// tokens, or "" when retrieval is not configured
+func (s *Service) retrievedContext(ctx context.Context, workspacePath, kind, query string, budget int) (string, error) {
+	if s.retrieval == nil || strings.TrimSpace(query) == "" {
+		return "", nil
+	}
+	root, err := resolveWorkspaceRoot(workspacePath)
+	if err != nil {
+		return "", err
+	}
+	return s.retrieval.Context(ctx, filepath.Base(root), kind, query, budget)
+}
+
+// HandleSemanticSearch handles GET /search/semantic?workspacePath=...&q=...&kind=spec&limit=10
+func (h *Handler) HandleSemanticSearch(w http.ResponseWriter, r *http.Request) {
+	if h.service.retrieval == nil {
+		http.Error(w, "retrieval is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	query := r.URL.Query()
+	workspacePath := scopedWorkspacePath(r, query.Get("workspacePath"))
+	if workspacePath == "" {
+		http.Error(w, "workspacePath is required", http.StatusBadRequest)
+		return
+	}
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+	kind := query.Get("kind")
+	if kind != "" && kind != retrieval.KindSpec && kind != retrieval.KindCode {
+		http.Error(w, "kind must be spec or code", http.StatusBadRequest)
+		return
+	}
+	limit := 10
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 100 {
+			http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	root, err := resolveWorkspaceRoot(workspacePath)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to resolve workspace: %v", err), http.StatusInternalServerError)
+		return
+	}
+	matches, err := h.service.retrieval.Search(r.Context(), filepath.Base(root), kind, q, limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to search workspace: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"embedder": h.service.retrieval.Embedder(),
+		"matches":  matches,
+	})
+}
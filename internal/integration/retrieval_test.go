@@ -0,0 +1,59 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jareynolds/ubecode/pkg/retrieval"
+)
+
+func TestFitContext(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "shop")
+	specs := filepath.Join(root, "specifications")
+	if err := os.MkdirAll(specs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(specs, "CAP-001.md"), []byte("# Checkout\n\nCustomers pay for the cart by credit card.\n"), 0644)
+	os.WriteFile(filepath.Join(specs, "CAP-002.md"), []byte("# Catalog\n\nProducts are listed by category with photos.\n"), 0644)
+
+	ix := retrieval.NewIndex(retrieval.NewHashEmbedder(0), retrieval.NewDiskStore(t.TempDir()))
+	if _, err := ix.IndexWorkspace(context.Background(), "shop", root); err != nil {
+		t.Fatal(err)
+	}
+	full := strings.Repeat("filler text that does not fit ", 100)
+
+	tests := []struct {
+		name      string
+		retrieval *retrieval.Index
+		full      string
+		want      string
+	}{
+		{"fits", ix, "short", "short"},
+		{"retrieves the relevant spec", ix, full, "CAP-001.md"},
+		{"truncates without retrieval", nil, full, "[... truncated ...]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{retrieval: tt.retrieval}
+			got := s.fitContext(context.Background(), root, retrieval.KindSpec, "how do customers pay by card", tt.full, 20)
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("expected context to contain %q, got %q", tt.want, got)
+			}
+			if strings.Contains(got, "Catalog") {
+				t.Errorf("expected the unrelated spec to be left out, got %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/client"
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/jareynolds/ubecode/pkg/search"
+)
+
+// EnableSearchIndex pushes spec file changes to the capability service search index
+func (s *Service) EnableSearchIndex(c *client.SearchIndexClient) {
+	s.searchClient = c
+}
+
+// specRef converts an absolute or relative file path into the workspace-relative ref used
+// by the search index (workspaces/<name>/...). It returns "" for paths outside workspaces.
+func specRef(path string) string {
+	path = filepath.ToSlash(path)
+	if idx := strings.Index(path, "workspaces/"); idx != -1 {
+		return path[idx:]
+	}
+	return ""
+}
+
+// SpecFilesChanged re-indexes saved spec files and drops removed ones. It is a no-op when
+// search indexing is not configured; non-spec paths are ignored.
+func (s *Service) SpecFilesChanged(saved, removed []string) {
+	if s.searchClient == nil {
+		return
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		log.Printf("Failed to update search index: %v", err)
+		return
+	}
+
+	req := models.IndexDocumentsRequest{}
+	for _, path := range saved {
+		ref := specRef(path)
+		if ref == "" || !search.IsSpecFile(ref) {
+			continue
+		}
+		doc, err := search.ParseSpecFile(cwd, ref)
+		if err != nil {
+			// Saved and then removed before we got here
+			req.RemoveRefs = append(req.RemoveRefs, ref)
+			continue
+		}
+		req.Documents = append(req.Documents, doc)
+	}
+	for _, path := range removed {
+		if ref := specRef(path); ref != "" && search.IsSpecFile(ref) {
+			req.RemoveRefs = append(req.RemoveRefs, ref)
+		}
+	}
+	if len(req.Documents) == 0 && len(req.RemoveRefs) == 0 {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := s.searchClient.Apply(ctx, req); err != nil {
+			log.Printf("Failed to update search index: %v", err)
+		}
+	}()
+}
+
+// ReindexWorkspace replaces every indexed spec document of a workspace with a fresh parse
+func (s *Service) ReindexWorkspace(ctx context.Context, workspacePath string) (int, error) {
+	if s.searchClient == nil {
+		return 0, fmt.Errorf("search indexing is not configured")
+	}
+
+	ref := specRef(strings.TrimSuffix(workspacePath, "/") + "/")
+	workspace := search.WorkspaceFromRef(ref)
+	if workspace == "" {
+		return 0, fmt.Errorf("workspace path must be within the workspaces directory")
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return 0, err
+	}
+
+	docs, err := search.WalkWorkspace(cwd, filepath.Join("workspaces", workspace))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read workspace: %w", err)
+	}
+
+	err = s.searchClient.Apply(ctx, models.IndexDocumentsRequest{
+		Documents:        docs,
+		ReplaceWorkspace: workspace,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(docs), nil
+}
+
+// ReindexAllWorkspaces rebuilds the spec index for every folder under workspaces/
+func (s *Service) ReindexAllWorkspaces(ctx context.Context) {
+	entries, err := os.ReadDir("workspaces")
+	if err != nil {
+		log.Printf("Search index: failed to list workspaces: %v", err)
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		count, err := s.ReindexWorkspace(ctx, filepath.Join("workspaces", entry.Name()))
+		if err != nil {
+			log.Printf("Search index: failed to index workspace %s: %v", entry.Name(), err)
+			continue
+		}
+		log.Printf("Search index: indexed %d spec files in workspace %s", count, entry.Name())
+	}
+}
+
+// ReindexWorkspaceRequest represents a request to rebuild a workspace's spec index
+type ReindexWorkspaceRequest struct {
+	WorkspacePath string `json:"workspacePath"`
+}
+
+// HandleReindexWorkspace handles POST /search/reindex-workspace
+func (h *Handler) HandleReindexWorkspace(w http.ResponseWriter, r *http.Request) {
+	var req ReindexWorkspaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.WorkspacePath = scopedWorkspacePath(r, req.WorkspacePath)
+	if req.WorkspacePath == "" {
+		http.Error(w, "workspacePath is required", http.StatusBadRequest)
+		return
+	}
+
+	response := map[string]interface{}{"success": true}
+	if h.service.searchClient != nil || h.service.retrieval == nil {
+		count, err := h.service.ReindexWorkspace(r.Context(), req.WorkspacePath)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to reindex workspace: %v", err), http.StatusInternalServerError)
+			return
+		}
+		response["indexed"] = count
+	}
+
+	// Also catch the embedding index up with the workspace
+	if h.service.retrieval != nil {
+		stats, err := h.service.IndexWorkspaceForRetrieval(r.Context(), req.WorkspacePath)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to reindex workspace: %v", err), http.StatusInternalServerError)
+			return
+		}
+		response["embedded"] = stats
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
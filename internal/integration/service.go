@@ -10,21 +10,50 @@ package integration
 
 import (
 	"context"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
 
+	"github.com/jareynolds/ubecode/pkg/aicache"
 	"github.com/jareynolds/ubecode/pkg/client"
+	"github.com/jareynolds/ubecode/pkg/jobs"
 	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/jareynolds/ubecode/pkg/prompts"
+	"github.com/jareynolds/ubecode/pkg/repository"
+	"github.com/jareynolds/ubecode/pkg/retrieval"
+	"github.com/jareynolds/ubecode/pkg/templates"
 )
 
 // Service handles integration operations
 type Service struct {
-	figmaClient *client.FigmaClient
+	figmaClient        *client.FigmaClient
+	notificationClient *client.NotificationClient
+	searchClient       *client.SearchIndexClient
+	claudeProxy        *client.ClaudeProxyClient
+	watchHub           *WatchHub
+	workspaces         *repository.WorkspaceRepository
+	reconcileMu        sync.Mutex
+	templates          *templates.Catalog
+	jobs               *jobs.Manager
+	jobRepo            *repository.JobRepository
+	conversations      *repository.ConversationRepository
+	usage              *usageMeter
+	retrieval          *retrieval.Index
+	prompts            *prompts.Library
+	audit              *repository.AIAuditRepository
+	aiCache            *aicache.Cache
+	tests              *testRunner // Runs the AI chat's run_tests tool; nil leaves the tool out
 }
 
 // NewService creates a new integration service
 func NewService(figmaToken string) *Service {
-	return &Service{
+	s := &Service{
 		figmaClient: client.NewFigmaClient(figmaToken),
+		prompts:     builtinPrompts,
 	}
+	s.watchHub = NewWatchHub(0, 500*time.Millisecond, s.onWorkspaceChange)
+	return s
 }
 
 // GetFigmaFile retrieves a Figma file
@@ -36,3 +65,40 @@ func (s *Service) GetFigmaFile(ctx context.Context, fileKey string) (*models.Fil
 func (s *Service) GetFigmaComments(ctx context.Context, fileKey string) ([]models.Comment, error) {
 	return s.figmaClient.GetComments(ctx, fileKey)
 }
+
+// EnableNotifications publishes AI generation events through the given client
+func (s *Service) EnableNotifications(c *client.NotificationClient) {
+	s.notificationClient = c
+}
+
+// EnableClaudeProxy runs Claude CLI code generation through the given host proxy client
+func (s *Service) EnableClaudeProxy(c *client.ClaudeProxyClient) {
+	s.claudeProxy = c
+}
+
+// NotifyAIGenerationFinished tells a user their generation run is done. It is a no-op
+// when notifications are not configured or the requester is unknown.
+func (s *Service) NotifyAIGenerationFinished(userID int, workspacePath, summary, errMsg string) {
+	if s.notificationClient == nil || userID == 0 {
+		return
+	}
+
+	event := models.NotificationEvent{
+		Type:    models.EventAIGenerationFinished,
+		UserIDs: []int{userID},
+		Data: map[string]interface{}{
+			"workspace":      filepath.Base(workspacePath),
+			"workspace_path": workspacePath,
+			"summary":        summary,
+			"error":          errMsg,
+		},
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		if err := s.notificationClient.Publish(ctx, event); err != nil {
+			log.Printf("Failed to publish AI generation notification: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,125 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jareynolds/ubecode/pkg/jsonschema"
+)
+
+// structuredAttempts is how many answers a structured call asks the model for before it
+// gives up on getting one that matches the schema
+const structuredAttempts = 3
+
+// errInvalidOutput is returned when the model's answers never matched the schema
+var errInvalidOutput = errors.New("invalid structured output")
+
+// structuredOutputs are the Go types the prompts that ask for JSON are answered with, so
+// the prompt API can show their schemas
+var structuredOutputs = map[string]interface{}{
+	"integration-analysis":        IntegrationAnalysis{},
+	"resource-suggestion":         SuggestResourcesResponse{},
+	"specification-relationships": specificationRelationships{},
+	"specification-analysis":      AnalyzeSpecificationsResponse{},
+	"storyboard-analysis":         storyboardLayout{},
+	"capability-suggestion":       capabilitySuggestions{},
+}
+
+// specificationRelationships is the answer to the specification-relationships prompt
+type specificationRelationships struct {
+	Relationships struct {
+		CapabilityDependencies []struct {
+			From string `json:"from"`
+			To   string `json:"to"`
+		} `json:"capabilityDependencies"`
+		EnablerAssignments []struct {
+			EnablerID    string `json:"enablerId"`
+			CapabilityID string `json:"capabilityId"`
+		} `json:"enablerAssignments"`
+	} `json:"relationships"`
+}
+
+// storyboardLayout is the answer to the storyboard-analysis prompt
+type storyboardLayout struct {
+	Cards       []AnalyzedCard       `json:"cards"`
+	Connections []AnalyzedConnection `json:"connections"`
+}
+
+// capabilitySuggestions is the answer to the capability-suggestion prompt
+type capabilitySuggestions struct {
+	Suggestions []CapabilitySuggestion `json:"suggestions"`
+}
+
+// SendStructured asks the model to answer through a tool whose input schema is generated
+// from out's type, and decodes the answer into out. An answer that does not match the
+// schema is sent back with what is wrong, up to structuredAttempts answers in all.
+func (ac *AnthropicClient) SendStructured(ctx context.Context, req ClaudeRequest, tool, description string, out interface{}) error {
+	schema := jsonschema.For(out)
+	req.Tools = []agentTool{{Name: tool, Description: description, InputSchema: schema}}
+	req.ToolChoice = &toolChoice{Type: "tool", Name: tool}
+	req.Messages = append([]ClaudeMessage(nil), req.Messages...)
+
+	var problems []string
+	for attempt := 1; attempt <= structuredAttempts; attempt++ {
+		resp, err := ac.send(ctx, req)
+		if err != nil {
+			return err
+		}
+		if resp.StopReason == "max_tokens" {
+			return fmt.Errorf("%w: the answer to %s was cut off at %d tokens", errInvalidOutput, tool, req.MaxTokens)
+		}
+
+		answer, use := structuredAnswer(resp, tool)
+		problems = jsonschema.Validate(schema, answer)
+		if len(problems) == 0 {
+			err := json.Unmarshal(answer, out)
+			if err == nil {
+				return nil
+			}
+			problems = []string{err.Error()}
+		}
+		log.Printf("Answer %d of %d to %s does not match its schema: %s", attempt, structuredAttempts, tool, strings.Join(problems, "; "))
+
+		// Show the model what is wrong so the next answer can fix it
+		feedback := fmt.Sprintf("The answer does not match the %s schema:\n- %s\n\nCall %s again with the whole corrected answer.",
+			tool, strings.Join(problems, "\n- "), tool)
+		req.Messages = append(req.Messages, ClaudeMessage{Role: "assistant", Content: resp.Content})
+		if use != nil {
+			req.Messages = append(req.Messages, ClaudeMessage{Role: "user", Content: []agentBlock{
+				{Type: "tool_result", ToolUseID: use.ID, Content: feedback, IsError: true},
+			}})
+		} else {
+			req.Messages = append(req.Messages, ClaudeMessage{Role: "user", Content: feedback})
+		}
+	}
+	return fmt.Errorf("%w from %s after %d attempts: %s", errInvalidOutput, tool, structuredAttempts, strings.Join(problems, "; "))
+}
+
+// structuredAnswer returns the input of the answer tool's call, or the JSON in the text
+// when the model answered in text instead
+func structuredAnswer(resp *ClaudeResponse, tool string) ([]byte, *agentBlock) {
+	var text []string
+	for i, block := range resp.Content {
+		switch block.Type {
+		case "tool_use":
+			if block.Name == tool {
+				return block.Input, &resp.Content[i]
+			}
+		case "text":
+			text = append(text, block.Text)
+		}
+	}
+	return []byte(extractJSONFromMarkdown(strings.Join(text, "\n"))), nil
+}
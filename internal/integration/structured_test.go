@@ -0,0 +1,90 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jareynolds/ubecode/pkg/jsonschema"
+)
+
+func TestSendStructured(t *testing.T) {
+	answer := func(input string) string {
+		return `{"content":[{"type":"tool_use","id":"tu","name":"record_suggestions","input":` + input + `}],"stop_reason":"tool_use","usage":{"input_tokens":10,"output_tokens":5}}`
+	}
+	valid := answer(`{"suggestions":[{"name":"Search","type":"capability","description":"Find things","rationale":"Users asked"}]}`)
+	wrongType := answer(`{"suggestions":[{"name":"Search","type":"epic","description":"Find things","rationale":"Users asked"}]}`)
+
+	tests := []struct {
+		name      string
+		responses []string
+		wantErr   bool
+		wantCalls int
+	}{
+		{"valid", []string{valid}, false, 1},
+		{"repaired", []string{wrongType, valid}, false, 2},
+		{"text answer", []string{`{"content":[{"type":"text","text":"` + "```json\\n" + `{\"suggestions\":[]}` + "\\n```" + `"}],"stop_reason":"end_turn"}`}, false, 1},
+		{"never valid", []string{wrongType, wrongType, wrongType}, true, structuredAttempts},
+		{"cut off", []string{`{"content":[{"type":"text","text":"{\"sugg"}],"stop_reason":"max_tokens"}`}, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := fakeMessagesAPI(t, tt.responses)
+			ac := NewAnthropicClient("sk-test")
+			ac.url = server.URL
+
+			var out capabilitySuggestions
+			err := ac.SendStructured(context.Background(), messageRequest("Suggest capabilities"), "record_suggestions", "Record suggestions", &out)
+			if tt.wantErr {
+				if !errors.Is(err, errInvalidOutput) {
+					t.Errorf("expected an invalid output error, got %v", err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if len(*requests) != tt.wantCalls {
+				t.Fatalf("expected %d requests, got %d", tt.wantCalls, len(*requests))
+			}
+			if len((*requests)[0].Tools) != 1 || (*requests)[0].Tools[0].Name != "record_suggestions" {
+				t.Errorf("expected the answer tool to be offered, got %+v", (*requests)[0].Tools)
+			}
+			if !tt.wantErr && tt.name != "text answer" && (len(out.Suggestions) != 1 || out.Suggestions[0].Name != "Search") {
+				t.Errorf("unexpected answer %+v", out)
+			}
+
+			// A rejected answer goes back to the model with what is wrong with it
+			if tt.wantCalls > 1 {
+				retry := (*requests)[1]
+				if len(retry.Messages) != 3 {
+					t.Fatalf("expected user, assistant and tool result messages, got %d", len(retry.Messages))
+				}
+				feedback, _ := json.Marshal(retry.Messages[2].Content)
+				if !strings.Contains(string(feedback), `"is_error":true`) || !strings.Contains(string(feedback), "$.suggestions[0].type: must be one of") {
+					t.Errorf("expected the schema problems to be sent back, got %s", feedback)
+				}
+			}
+		})
+	}
+}
+
+func TestStructuredOutputSchemas(t *testing.T) {
+	for name, out := range structuredOutputs {
+		if _, err := builtinPrompts.Resolve(name, ""); err != nil {
+			t.Errorf("structured output %s has no prompt: %v", name, err)
+		}
+		if s := jsonschema.For(out); s.Type != "object" {
+			t.Errorf("expected %s to be answered with an object, got %q", name, s.Type)
+		}
+	}
+}
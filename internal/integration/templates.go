@@ -0,0 +1,169 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/jareynolds/ubecode/pkg/templates"
+)
+
+// EnableTemplates lets new workspaces be scaffolded from a template catalog
+func (s *Service) EnableTemplates(catalog *templates.Catalog) {
+	s.templates = catalog
+}
+
+// resolveTemplate loads the template a create request names and resolves its parameters,
+// writing an error response when it cannot
+func (h *Handler) resolveTemplate(w http.ResponseWriter, req *models.WorkspaceTemplateRequest, name, folder string) (*templates.Template, map[string]string, bool) {
+	if h.service.templates == nil {
+		http.Error(w, "workspace templates are not configured", http.StatusServiceUnavailable)
+		return nil, nil, false
+	}
+	if req.ID == "" {
+		http.Error(w, "template id is required", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	t, err := h.service.templates.Get(req.ID, req.Version)
+	if errors.Is(err, templates.ErrTemplateNotFound) {
+		http.Error(w, fmt.Sprintf("template %s not found", req.ID), http.StatusNotFound)
+		return nil, nil, false
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to load template: %v", err), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	params, err := t.Params(req.Parameters, name, folder)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, nil, false
+	}
+	return t, params, true
+}
+
+// applyTemplateDefaults fills the parts of a create request the client left out from the
+// template's workspace defaults, and records the template in the workspace settings
+func applyTemplateDefaults(req *models.CreateWorkspaceRequest, t *templates.Template) {
+	defaults := t.Workspace
+	if req.WorkspaceType == "" {
+		req.WorkspaceType = defaults.WorkspaceType
+	}
+	if req.Description == "" {
+		req.Description = defaults.Description
+	}
+
+	settings := map[string]interface{}{}
+	if defaults.AIPreset != 0 {
+		settings["activeAIPreset"] = defaults.AIPreset
+	}
+	if defaults.UIFramework != "" {
+		settings["selectedUIFramework"] = defaults.UIFramework
+	}
+	if defaults.UILayout != "" {
+		settings["selectedUILayout"] = defaults.UILayout
+	}
+	if len(defaults.CustomSettings) > 0 {
+		custom := map[string]interface{}{}
+		for k, v := range defaults.CustomSettings {
+			custom[k] = v
+		}
+		settings["customSettings"] = custom
+	}
+	for k, v := range req.Settings {
+		settings[k] = v
+	}
+	settings["template"] = map[string]interface{}{"id": t.ID, "version": t.Version}
+	req.Settings = settings
+}
+
+// scaffoldWorkspace writes a template's files into a new workspace folder and copies in
+// its AI policy preset
+func scaffoldWorkspace(t *templates.Template, ws *models.Workspace, params map[string]string) error {
+	result, err := t.Scaffold(ws.Path, params)
+	if err != nil {
+		return err
+	}
+	log.Printf("Scaffolded workspace %s from template %s %s: %d files created, %d skipped",
+		ws.FolderName, t.ID, t.Version, len(result.Created), len(result.Skipped))
+
+	// The presets live in a mounted volume that local runs may not have
+	if t.Workspace.AIPreset != 0 {
+		if err := copyAIPolicyPreset(t.Workspace.AIPreset, ws.Path); err != nil {
+			log.Printf("Warning: could not copy AI policy preset for workspace %s: %v", ws.FolderName, err)
+		}
+	}
+	return nil
+}
+
+// HandleListTemplates handles GET /templates
+// Lists every template version in the catalog, newest first within each template
+func (h *Handler) HandleListTemplates(w http.ResponseWriter, r *http.Request) {
+	list, err := h.service.templates.List()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to list templates: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"templates": list})
+}
+
+// HandleGetTemplate handles GET /templates/{id}
+// Returns the newest version of a template, or the one named by ?version=
+func (h *Handler) HandleGetTemplate(w http.ResponseWriter, r *http.Request) {
+	t, err := h.service.templates.Get(r.PathValue("id"), r.URL.Query().Get("version"))
+	if errors.Is(err, templates.ErrTemplateNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to load template: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+// HandleImportTemplate handles POST /templates/import (workspace admins only)
+// Adds a template zip archive, sent as the request body, to the catalog
+func (h *Handler) HandleImportTemplate(w http.ResponseWriter, r *http.Request) {
+	if access, ok := r.Context().Value("access").(*models.AccessGrant); ok && !access.Can(models.PermWorkspacesAdmin) {
+		http.Error(w, fmt.Sprintf("missing permission: %s", models.PermWorkspacesAdmin), http.StatusForbidden)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, templates.MaxZipSize+1))
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	if len(data) == 0 {
+		http.Error(w, "template archive is required", http.StatusBadRequest)
+		return
+	}
+
+	t, err := h.service.templates.Import(data)
+	if errors.Is(err, templates.ErrTemplateExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, templates.ErrInvalidTemplate) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to import template: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, t)
+}
@@ -0,0 +1,151 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+// allowRunTestsSetting is the workspace setting that gives the AI chat the run_tests tool,
+// when the service has somewhere to run tests. It lives in the registry only: .ubeworkspace
+// files, which the AI can write, never set it.
+const allowRunTestsSetting = "allowRunTests"
+
+// testEnvPassthrough are the variables a local test run keeps from the service's
+// environment: where the toolchains are, never credentials
+var testEnvPassthrough = []string{"PATH", "LANG", "LC_ALL", "TZ", "GOROOT", "CARGO_HOME", "RUSTUP_HOME", "JAVA_HOME"}
+
+// EnableTestContainers runs the AI chat's run_tests tool in containers of image, with no
+// network access
+func (s *Service) EnableTestContainers(image string) {
+	s.tests = &testRunner{image: image}
+}
+
+// EnableTestUser runs the AI chat's run_tests tool as local processes of the named user.
+// The user must be unprivileged and not the service's own, since a process of the service's
+// user can read the service's memory, environment and files; the service needs the right to
+// switch users, e.g. by running as root.
+func (s *Service) EnableTestUser(name string) error {
+	if !canRunAsUser {
+		return fmt.Errorf("running tests as another user is not supported on %s", runtime.GOOS)
+	}
+	account, err := user.Lookup(name)
+	if err != nil {
+		return err
+	}
+	uid, err := strconv.ParseUint(account.Uid, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid uid for user %s: %s", name, account.Uid)
+	}
+	gid, err := strconv.ParseUint(account.Gid, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid gid for user %s: %s", name, account.Gid)
+	}
+	if uid == 0 || int(uid) == os.Getuid() {
+		return fmt.Errorf("user %s must be an unprivileged user other than the service's own", name)
+	}
+	s.tests = &testRunner{user: &testUser{uid: uint32(uid), gid: uint32(gid)}}
+	return nil
+}
+
+// allowsRunTests reports whether a registered workspace lets the AI chat run its tests
+func allowsRunTests(ws *models.Workspace) bool {
+	allowed, _ := ws.Settings[allowRunTestsSetting].(bool)
+	return allowed
+}
+
+// testRunner runs a workspace's test suite for the run_tests tool. The tests run code the
+// model may have written, so they never run as the service's user: they run in a container
+// when an image is configured, otherwise as a local process of a separate unprivileged
+// user, with an allow-listed environment, a scratch home directory and its own process
+// group.
+type testRunner struct {
+	image string    // Container image to run tests in
+	user  *testUser // User to run local tests as, when there is no image
+}
+
+// testUser is the account local test runs switch to
+type testUser struct {
+	uid, gid uint32
+}
+
+// command prepares command to run in dir, a folder inside the workspace root. The returned
+// function removes the run's scratch directory.
+func (t *testRunner) command(ctx context.Context, root, dir string, command []string) (*exec.Cmd, func(), error) {
+	if t.image == "" && t.user == nil {
+		return nil, nil, errors.New("no test container image or test user is configured")
+	}
+
+	scratch, err := os.MkdirTemp("", "ubecode-tests-")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() { os.RemoveAll(scratch) }
+
+	if t.image == "" {
+		if err := os.Chown(scratch, int(t.user.uid), int(t.user.gid)); err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("failed to hand the scratch directory to the test user: %w", err)
+		}
+		cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+		cmd.Dir = dir
+		cmd.Env = testEnv(scratch)
+		runAsUser(cmd, t.user.uid, t.user.gid)
+		return cmd, cleanup, nil
+	}
+
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	name := fmt.Sprintf("ubecode-tests-%d", time.Now().UnixNano())
+	args := []string{"run", "--rm", "--name", name, "--network", "none", "--init",
+		"--memory", "2g", "--pids-limit", "512", "--cap-drop", "ALL", "--security-opt", "no-new-privileges",
+		"-v", root + ":/workspace", "-w", filepath.ToSlash(filepath.Join("/workspace", rel)),
+		"-e", "HOME=/tmp", "-e", "CI=true", t.image}
+	cmd := exec.CommandContext(ctx, "docker", append(args, command...)...)
+	cmd.Env = append(testEnv(scratch), "DOCKER_HOST="+os.Getenv("DOCKER_HOST"))
+	// Killing the docker client would leave the container running
+	cmd.Cancel = func() error {
+		exec.Command("docker", "kill", name).Run()
+		return cmd.Process.Kill()
+	}
+	return cmd, cleanup, nil
+}
+
+// testEnv is the environment of a local test run: toolchain locations, and home, temp and
+// cache directories in the run's scratch directory
+func testEnv(scratch string) []string {
+	env := []string{
+		"HOME=" + scratch,
+		"TMPDIR=" + scratch,
+		"GOPATH=" + filepath.Join(scratch, "go"),
+		"GOCACHE=" + filepath.Join(scratch, "go-build"),
+		"npm_config_cache=" + filepath.Join(scratch, "npm"),
+		"CI=true",
+	}
+	for _, name := range testEnvPassthrough {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
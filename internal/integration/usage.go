@@ -0,0 +1,586 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jareynolds/ubecode/internal/auth"
+	"github.com/jareynolds/ubecode/pkg/client"
+	"github.com/jareynolds/ubecode/pkg/jobs"
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/jareynolds/ubecode/pkg/repository"
+)
+
+// maxUsageReportDays caps the period of a usage report
+const maxUsageReportDays = 366
+
+// cliModel is the model recorded for Claude CLI runs, which report a cost but not a model
+const cliModel = "claude-cli"
+
+// errBudgetExceeded is wrapped by the error of an AI call refused because a hard limit
+// has been reached
+var errBudgetExceeded = errors.New("AI budget exceeded")
+
+// modelPrice is what a model costs in USD per million tokens
+type modelPrice struct {
+	Input      float64
+	Output     float64
+	CacheWrite float64
+	CacheRead  float64
+}
+
+// modelPrices are keyed by model name prefix; the longest matching prefix wins
+var modelPrices = map[string]modelPrice{
+	"claude-opus-4":     {Input: 15, Output: 75, CacheWrite: 18.75, CacheRead: 1.50},
+	"claude-sonnet-4":   {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+	"claude-3-7-sonnet": {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+	"claude-3-5-sonnet": {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.30},
+	"claude-3-5-haiku":  {Input: 0.80, Output: 4, CacheWrite: 1, CacheRead: 0.08},
+	"claude-3-haiku":    {Input: 0.25, Output: 1.25, CacheWrite: 0.30, CacheRead: 0.03},
+}
+
+// usageCost prices a model call. Unknown models cost nothing, so they are logged.
+func usageCost(model string, u ClaudeUsage) float64 {
+	var price modelPrice
+	matched := ""
+	for prefix, p := range modelPrices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(matched) {
+			price, matched = p, prefix
+		}
+	}
+	if matched == "" {
+		log.Printf("AI usage: no price for model %s", model)
+		return 0
+	}
+	return (float64(u.InputTokens)*price.Input +
+		float64(u.OutputTokens)*price.Output +
+		float64(u.CacheCreationInputTokens)*price.CacheWrite +
+		float64(u.CacheReadInputTokens)*price.CacheRead) / 1e6
+}
+
+// EnableUsage records the tokens and cost of every AI call and enforces AI budgets
+func (s *Service) EnableUsage(repo *repository.AIUsageRepository) {
+	s.usage = &usageMeter{repo: repo, now: time.Now}
+}
+
+// usageMeter records AI calls and checks spend against budgets
+type usageMeter struct {
+	repo *repository.AIUsageRepository
+	now  func() time.Time
+}
+
+// usageScope is who an AI call is made for. It travels in the context of the request or
+// job making the call.
+type usageScope struct {
+	meter       *usageMeter
+	endpoint    string
+	workspaceID *int
+	userID      *int
+}
+
+func withUsageScope(ctx context.Context, scope *usageScope) context.Context {
+	return context.WithValue(ctx, "usage", scope)
+}
+
+func usageScopeFrom(ctx context.Context) *usageScope {
+	scope, _ := ctx.Value("usage").(*usageScope)
+	return scope
+}
+
+// budgets returns the budgets that apply to a scope with what has been spent against them
+func (m *usageMeter) budgets(scope *usageScope) ([]models.AIBudget, error) {
+	var budgets []models.AIBudget
+	for _, applies := range []struct {
+		scope string
+		id    *int
+	}{
+		{models.BudgetScopeWorkspace, scope.workspaceID},
+		{models.BudgetScopeUser, scope.userID},
+	} {
+		if applies.id == nil {
+			continue
+		}
+		found, err := m.repo.ListBudgets(applies.scope, applies.id)
+		if err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, found...)
+	}
+	return budgets, m.fillSpend(budgets)
+}
+
+// fillSpend sets what has been spent against each budget in its current period
+func (m *usageMeter) fillSpend(budgets []models.AIBudget) error {
+	now := m.now()
+	for i := range budgets {
+		b := &budgets[i]
+		spent, err := m.repo.Spent(b.Scope, b.ScopeID, periodStart(b.Period, now))
+		if err != nil {
+			return err
+		}
+		b.SpentUSD = spent
+		b.Status = budgetStatus(*b)
+	}
+	return nil
+}
+
+// check returns warnings for soft limits that have been reached, or an error wrapping
+// errBudgetExceeded once a hard limit has. Budgets that cannot be read are logged and do
+// not stop AI calls.
+func (m *usageMeter) check(scope *usageScope) ([]string, error) {
+	budgets, err := m.budgets(scope)
+	if err != nil {
+		log.Printf("AI usage: failed to check budgets: %v", err)
+		return nil, nil
+	}
+	var warnings []string
+	for _, b := range budgets {
+		switch b.Status {
+		case models.BudgetExceeded:
+			return nil, fmt.Errorf("%w: %s", errBudgetExceeded, describeBudget(b))
+		case models.BudgetWarning:
+			warnings = append(warnings, describeBudget(b))
+		}
+	}
+	return warnings, nil
+}
+
+// periodStart returns when the budget period containing now began
+func periodStart(period string, now time.Time) time.Time {
+	y, m, d := now.Date()
+	if period == models.BudgetDaily {
+		return time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	}
+	return time.Date(y, m, 1, 0, 0, 0, 0, now.Location())
+}
+
+// budgetStatus compares spend with a budget's limits
+func budgetStatus(b models.AIBudget) string {
+	switch {
+	case b.HardLimitUSD != nil && b.SpentUSD >= *b.HardLimitUSD:
+		return models.BudgetExceeded
+	case b.SoftLimitUSD != nil && b.SpentUSD >= *b.SoftLimitUSD:
+		return models.BudgetWarning
+	}
+	return models.BudgetOK
+}
+
+// describeBudget says where spend stands, e.g. "workspace 3 has spent $12.50 of its $10.00
+// monthly limit"
+func describeBudget(b models.AIBudget) string {
+	limit := b.SoftLimitUSD
+	if b.Status == models.BudgetExceeded {
+		limit = b.HardLimitUSD
+	}
+	if limit == nil {
+		return fmt.Sprintf("%s %d has spent $%.2f this %s", b.Scope, b.ScopeID, b.SpentUSD, periodNoun(b.Period))
+	}
+	return fmt.Sprintf("%s %d has spent $%.2f of its $%.2f %s limit", b.Scope, b.ScopeID, b.SpentUSD, *limit, b.Period)
+}
+
+func periodNoun(period string) string {
+	if period == models.BudgetDaily {
+		return "day"
+	}
+	return "month"
+}
+
+// checkBudget refuses an AI call once a hard limit of the request or job in ctx is reached
+func checkBudget(ctx context.Context) error {
+	scope := usageScopeFrom(ctx)
+	if scope == nil {
+		return nil
+	}
+	_, err := scope.meter.check(scope)
+	return err
+}
+
+// recordUsage stores a Messages API call made for the request or job in ctx, and adds
+// its cost to the tally of a cached AI call in ctx
+func recordUsage(ctx context.Context, model string, u ClaudeUsage, latency time.Duration) {
+	cost := usageCost(model, u)
+	if tally, ok := ctx.Value("cost").(*float64); ok {
+		*tally += cost
+	}
+	recordUsageCost(ctx, model, u, cost, latency)
+}
+
+// recordCLIUsage stores a Claude CLI run, which prices itself
+func recordCLIUsage(ctx context.Context, e client.ClaudeProxyEvent, latency time.Duration) {
+	var u ClaudeUsage
+	if e.Usage != nil {
+		u = ClaudeUsage{
+			InputTokens:              e.Usage.InputTokens,
+			OutputTokens:             e.Usage.OutputTokens,
+			CacheCreationInputTokens: e.Usage.CacheCreationInputTokens,
+			CacheReadInputTokens:     e.Usage.CacheReadInputTokens,
+		}
+	}
+	recordUsageCost(ctx, cliModel, u, e.CostUSD, latency)
+}
+
+func recordUsageCost(ctx context.Context, model string, u ClaudeUsage, cost float64, latency time.Duration) {
+	scope := usageScopeFrom(ctx)
+	if scope == nil {
+		return
+	}
+	err := scope.meter.repo.Record(&models.AIUsage{
+		WorkspaceID:         scope.workspaceID,
+		UserID:              scope.userID,
+		Endpoint:            scope.endpoint,
+		Model:               model,
+		InputTokens:         u.InputTokens,
+		OutputTokens:        u.OutputTokens,
+		CacheCreationTokens: u.CacheCreationInputTokens,
+		CacheReadTokens:     u.CacheReadInputTokens,
+		CostUSD:             cost,
+		LatencyMs:           latency.Milliseconds(),
+		PromptTemplate:      promptRef(ctx),
+	})
+	if err != nil {
+		log.Printf("AI usage: %v", err)
+	}
+}
+
+// MeterUsage attributes the AI calls of a request to its endpoint, user and workspace.
+// Requests to AI endpoints are refused with 402 once a hard limit of the workspace or user
+// is reached, and carry an X-AI-Budget-Warning header past a soft limit. It must run
+// inside WorkspaceScope and TokenAuth, which put the workspace and user in the context.
+func MeterUsage(s *Service, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.usage == nil || r.Method == http.MethodOptions || !auth.IsAIEndpoint(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		scope := &usageScope{meter: s.usage, endpoint: r.URL.Path, userID: requestUserID(r)}
+		if ws, ok := r.Context().Value("workspace").(*models.Workspace); ok {
+			id := ws.ID
+			scope.workspaceID = &id
+		}
+		warnings, err := s.usage.check(scope)
+		if err != nil {
+			// Error responses still need CORS headers for the browser to read them
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			http.Error(w, err.Error(), http.StatusPaymentRequired)
+			return
+		}
+		for _, warning := range warnings {
+			w.Header().Add("X-AI-Budget-Warning", warning)
+		}
+		next.ServeHTTP(w, r.WithContext(withUsageScope(r.Context(), scope)))
+	})
+}
+
+// metered attributes the AI calls of a background job to its kind, creator and workspace.
+// Jobs run inline keep the scope of their request. A job stopped by a budget is not retried.
+func (s *Service) metered(run jobs.Func) jobs.Func {
+	return func(ctx context.Context, t *jobs.Task) (interface{}, error) {
+		if s.usage != nil && usageScopeFrom(ctx) == nil {
+			ctx = withUsageScope(ctx, s.jobUsageScope(t.Job))
+		}
+		result, err := run(ctx, t)
+		if errors.Is(err, errBudgetExceeded) && !jobs.IsPermanent(err) {
+			err = jobs.Permanent(err)
+		}
+		return result, err
+	}
+}
+
+func (s *Service) jobUsageScope(job *models.Job) *usageScope {
+	return &usageScope{meter: s.usage, endpoint: job.Kind, userID: job.CreatedBy, workspaceID: s.jobWorkspaceID(job)}
+}
+
+// jobWorkspaceID returns the ID of the registered workspace a job runs in, or nil
+func (s *Service) jobWorkspaceID(job *models.Job) *int {
+	folder := workspaceFolder(job.WorkspacePath)
+	if folder == "" || s.workspaces == nil {
+		return nil
+	}
+	ws, err := s.workspaces.GetByFolder(folder)
+	if err != nil {
+		if !errors.Is(err, repository.ErrWorkspaceNotFound) {
+			log.Printf("failed to look up workspace of job %d: %v", job.ID, err)
+		}
+		return nil
+	}
+	return &ws.ID
+}
+
+// isUsageAdmin reports whether the caller may see all AI usage and manage budgets: a user
+// with workspaces:admin. Anonymous callers only are in legacy anonymous mode.
+func isUsageAdmin(r *http.Request) bool {
+	if requestUserID(r) == nil {
+		return legacyAnonymous(r)
+	}
+	access, ok := r.Context().Value("access").(*models.AccessGrant)
+	return ok && access.Can(models.PermWorkspacesAdmin)
+}
+
+// queryID parses an optional positive ID from the query string
+func queryID(r *http.Request, name string) (*int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id <= 0 {
+		return nil, fmt.Errorf("invalid %s", name)
+	}
+	return &id, nil
+}
+
+// usageTotals adds up the days of a report per group, most expensive first
+func usageTotals(days []models.AIUsageDay) ([]models.AIUsageDay, float64) {
+	byKey := map[string]*models.AIUsageDay{}
+	var order []string
+	var cost float64
+	for _, d := range days {
+		total, ok := byKey[d.Key]
+		if !ok {
+			total = &models.AIUsageDay{Key: d.Key}
+			byKey[d.Key] = total
+			order = append(order, d.Key)
+		}
+		total.Calls += d.Calls
+		total.InputTokens += d.InputTokens
+		total.OutputTokens += d.OutputTokens
+		total.CacheCreationTokens += d.CacheCreationTokens
+		total.CacheReadTokens += d.CacheReadTokens
+		total.CostUSD += d.CostUSD
+		cost += d.CostUSD
+	}
+	totals := make([]models.AIUsageDay, 0, len(order))
+	for _, key := range order {
+		totals = append(totals, *byKey[key])
+	}
+	sort.SliceStable(totals, func(i, j int) bool { return totals[i].CostUSD > totals[j].CostUSD })
+	return totals, cost
+}
+
+// usagePeriod parses the from and to dates of a report; both are inclusive and default to
+// the current month so far
+func usagePeriod(fromValue, toValue string, now time.Time) (time.Time, time.Time, error) {
+	from := periodStart(models.BudgetMonthly, now)
+	to := periodStart(models.BudgetDaily, now)
+	var err error
+	if fromValue != "" {
+		if from, err = time.ParseInLocation("2006-01-02", fromValue, now.Location()); err != nil {
+			return time.Time{}, time.Time{}, errors.New("from must be a date like 2025-01-31")
+		}
+	}
+	if toValue != "" {
+		if to, err = time.ParseInLocation("2006-01-02", toValue, now.Location()); err != nil {
+			return time.Time{}, time.Time{}, errors.New("to must be a date like 2025-01-31")
+		}
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, errors.New("to is before from")
+	}
+	if to.Sub(from) >= maxUsageReportDays*24*time.Hour {
+		return time.Time{}, time.Time{}, fmt.Errorf("a report may cover at most %d days", maxUsageReportDays)
+	}
+	return from, to, nil
+}
+
+// HandleAIUsage reports AI usage and cost per day, grouped by workspace, user, model,
+// endpoint or prompt. Admins see all usage; workspace owners see their workspace's, everyone else
+// their own.
+func (h *Handler) HandleAIUsage(w http.ResponseWriter, r *http.Request) {
+	meter := h.service.usage
+	query := r.URL.Query()
+
+	from, to, err := usagePeriod(query.Get("from"), query.Get("to"), meter.now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter := models.AIUsageFilter{From: from, To: to.AddDate(0, 0, 1), GroupBy: query.Get("groupBy")}
+	if filter.GroupBy == "" {
+		filter.GroupBy = "workspace"
+	}
+	switch filter.GroupBy {
+	case "workspace", "user", "model", "endpoint", "prompt":
+	default:
+		http.Error(w, "groupBy must be workspace, user, model, endpoint or prompt", http.StatusBadRequest)
+		return
+	}
+	if filter.WorkspaceID, err = queryID(r, "workspaceId"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.UserID, err = queryID(r, "userId"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !isUsageAdmin(r) {
+		userID := requestUserID(r)
+		ownsWorkspace := false
+		if filter.WorkspaceID != nil && h.service.workspaces != nil {
+			ws, err := h.service.workspaces.Get(*filter.WorkspaceID)
+			if err != nil && !errors.Is(err, repository.ErrWorkspaceNotFound) {
+				http.Error(w, fmt.Sprintf("failed to look up workspace: %v", err), http.StatusInternalServerError)
+				return
+			}
+			ownsWorkspace = ws != nil && canManageWorkspace(r, ws)
+		}
+		if !ownsWorkspace {
+			if filter.UserID != nil && *filter.UserID != *userID {
+				http.Error(w, "you can only see your own AI usage", http.StatusForbidden)
+				return
+			}
+			filter.UserID = userID
+		}
+	}
+
+	days, err := meter.repo.Daily(filter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to report AI usage: %v", err), http.StatusInternalServerError)
+		return
+	}
+	totals, cost := usageTotals(days)
+	writeJSON(w, http.StatusOK, models.AIUsageReport{
+		From:    from.Format("2006-01-02"),
+		To:      to.Format("2006-01-02"),
+		GroupBy: filter.GroupBy,
+		Days:    days,
+		Totals:  totals,
+		CostUSD: cost,
+	})
+}
+
+// HandleListAIBudgets lists AI budgets with what has been spent against them this period.
+// Admins see every budget. With a workspaceId, and for everyone else, it lists the budgets
+// that apply to the caller: their own and that of the workspace.
+func (h *Handler) HandleListAIBudgets(w http.ResponseWriter, r *http.Request) {
+	meter := h.service.usage
+	workspaceID, err := queryID(r, "workspaceId")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var budgets []models.AIBudget
+	if isUsageAdmin(r) && workspaceID == nil {
+		scope := r.URL.Query().Get("scope")
+		if budgets, err = meter.repo.ListBudgets(scope, nil); err == nil {
+			err = meter.fillSpend(budgets)
+		}
+	} else {
+		budgets, err = meter.budgets(&usageScope{workspaceID: workspaceID, userID: requestUserID(r)})
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to list AI budgets: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if budgets == nil {
+		budgets = []models.AIBudget{}
+	}
+	writeJSON(w, http.StatusOK, budgets)
+}
+
+// HandleSetAIBudget creates or replaces the budget of a workspace or user
+func (h *Handler) HandleSetAIBudget(w http.ResponseWriter, r *http.Request) {
+	if !isUsageAdmin(r) {
+		http.Error(w, "only admins can set AI budgets", http.StatusForbidden)
+		return
+	}
+
+	var req models.SetAIBudgetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Period == "" {
+		req.Period = models.BudgetMonthly
+	}
+	if err := validateBudget(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Scope == models.BudgetScopeWorkspace && h.service.workspaces != nil {
+		if _, err := h.service.workspaces.Get(req.ScopeID); errors.Is(err, repository.ErrWorkspaceNotFound) {
+			http.Error(w, fmt.Sprintf("workspace %d not found", req.ScopeID), http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, fmt.Sprintf("failed to look up workspace: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	budget := &models.AIBudget{
+		Scope:        req.Scope,
+		ScopeID:      req.ScopeID,
+		Period:       req.Period,
+		SoftLimitUSD: req.SoftLimitUSD,
+		HardLimitUSD: req.HardLimitUSD,
+		CreatedBy:    requestUserID(r),
+	}
+	if err := h.service.usage.repo.SetBudget(budget); err != nil {
+		http.Error(w, fmt.Sprintf("failed to save AI budget: %v", err), http.StatusInternalServerError)
+		return
+	}
+	budgets := []models.AIBudget{*budget}
+	if err := h.service.usage.fillSpend(budgets); err != nil {
+		http.Error(w, fmt.Sprintf("failed to check AI budget: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, budgets[0])
+}
+
+// validateBudget checks a budget request once its period has been defaulted
+func validateBudget(req models.SetAIBudgetRequest) error {
+	switch {
+	case req.Scope != models.BudgetScopeWorkspace && req.Scope != models.BudgetScopeUser:
+		return errors.New("scope must be workspace or user")
+	case req.ScopeID <= 0:
+		return errors.New("scopeId is required")
+	case req.Period != models.BudgetDaily && req.Period != models.BudgetMonthly:
+		return errors.New("period must be daily or monthly")
+	case req.SoftLimitUSD == nil && req.HardLimitUSD == nil:
+		return errors.New("softLimitUsd or hardLimitUsd is required")
+	case req.SoftLimitUSD != nil && *req.SoftLimitUSD < 0, req.HardLimitUSD != nil && *req.HardLimitUSD < 0:
+		return errors.New("limits cannot be negative")
+	case req.SoftLimitUSD != nil && req.HardLimitUSD != nil && *req.SoftLimitUSD > *req.HardLimitUSD:
+		return errors.New("softLimitUsd cannot be above hardLimitUsd")
+	}
+	return nil
+}
+
+// HandleDeleteAIBudget removes a budget
+func (h *Handler) HandleDeleteAIBudget(w http.ResponseWriter, r *http.Request) {
+	if !isUsageAdmin(r) {
+		http.Error(w, "only admins can delete AI budgets", http.StatusForbidden)
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid budget ID", http.StatusBadRequest)
+		return
+	}
+	if err := h.service.usage.repo.DeleteBudget(id); errors.Is(err, repository.ErrBudgetNotFound) {
+		http.Error(w, "AI budget not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("failed to delete AI budget: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,159 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+func TestUsageCost(t *testing.T) {
+	tests := []struct {
+		name  string
+		model string
+		usage ClaudeUsage
+		want  float64
+	}{
+		{"sonnet", "claude-sonnet-4-20250514", ClaudeUsage{InputTokens: 1000000, OutputTokens: 100000}, 4.5},
+		{"haiku", "claude-3-haiku-20240307", ClaudeUsage{InputTokens: 400000, OutputTokens: 40000}, 0.15},
+		{"cache tokens", "claude-sonnet-4-20250514", ClaudeUsage{CacheCreationInputTokens: 1000000, CacheReadInputTokens: 1000000}, 4.05},
+		{"longest prefix wins", "claude-3-5-haiku-20241022", ClaudeUsage{InputTokens: 1000000}, 0.8},
+		{"unknown model", "gpt-4", ClaudeUsage{InputTokens: 1000000}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := usageCost(tt.model, tt.usage); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("expected $%v, got $%v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestBudgetStatus(t *testing.T) {
+	limit := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name   string
+		budget models.AIBudget
+		want   string
+	}{
+		{"under both", models.AIBudget{SoftLimitUSD: limit(80), HardLimitUSD: limit(100), SpentUSD: 50}, models.BudgetOK},
+		{"at soft limit", models.AIBudget{SoftLimitUSD: limit(80), HardLimitUSD: limit(100), SpentUSD: 80}, models.BudgetWarning},
+		{"at hard limit", models.AIBudget{SoftLimitUSD: limit(80), HardLimitUSD: limit(100), SpentUSD: 100}, models.BudgetExceeded},
+		{"soft limit only", models.AIBudget{SoftLimitUSD: limit(10), SpentUSD: 500}, models.BudgetWarning},
+		{"hard limit only", models.AIBudget{HardLimitUSD: limit(10), SpentUSD: 9.99}, models.BudgetOK},
+		{"zero hard limit", models.AIBudget{HardLimitUSD: limit(0)}, models.BudgetExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := budgetStatus(tt.budget); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestUsagePeriod(t *testing.T) {
+	now := time.Date(2025, 3, 14, 15, 9, 26, 0, time.UTC)
+	tests := []struct {
+		name     string
+		from, to string
+		wantFrom string
+		wantTo   string
+		wantErr  bool
+	}{
+		{"defaults to this month", "", "", "2025-03-01", "2025-03-14", false},
+		{"explicit range", "2025-01-01", "2025-01-31", "2025-01-01", "2025-01-31", false},
+		{"single day", "2025-02-10", "2025-02-10", "2025-02-10", "2025-02-10", false},
+		{"reversed", "2025-02-10", "2025-02-01", "", "", true},
+		{"bad date", "March", "", "", "", true},
+		{"too long", "2023-01-01", "2025-01-01", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, err := usagePeriod(tt.from, tt.to, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if got := from.Format("2006-01-02"); got != tt.wantFrom {
+				t.Errorf("expected from %s, got %s", tt.wantFrom, got)
+			}
+			if got := to.Format("2006-01-02"); got != tt.wantTo {
+				t.Errorf("expected to %s, got %s", tt.wantTo, got)
+			}
+		})
+	}
+}
+
+func TestPeriodStart(t *testing.T) {
+	now := time.Date(2025, 3, 14, 15, 9, 26, 0, time.UTC)
+	if got := periodStart(models.BudgetDaily, now); !got.Equal(time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected daily period start %v", got)
+	}
+	if got := periodStart(models.BudgetMonthly, now); !got.Equal(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected monthly period start %v", got)
+	}
+}
+
+func TestUsageTotals(t *testing.T) {
+	days := []models.AIUsageDay{
+		{Day: "2025-03-01", Key: "1", Calls: 2, InputTokens: 100, OutputTokens: 10, CostUSD: 0.5},
+		{Day: "2025-03-01", Key: "2", Calls: 1, InputTokens: 50, OutputTokens: 5, CostUSD: 2},
+		{Day: "2025-03-02", Key: "1", Calls: 3, InputTokens: 300, OutputTokens: 30, CacheReadTokens: 7, CostUSD: 1},
+	}
+
+	totals, cost := usageTotals(days)
+	if cost != 3.5 {
+		t.Errorf("expected total cost 3.5, got %v", cost)
+	}
+	if len(totals) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(totals))
+	}
+	if totals[0].Key != "2" || totals[1].Key != "1" {
+		t.Errorf("expected the most expensive group first, got %s then %s", totals[0].Key, totals[1].Key)
+	}
+	want := models.AIUsageDay{Key: "1", Calls: 5, InputTokens: 400, OutputTokens: 40, CacheReadTokens: 7, CostUSD: 1.5}
+	if totals[1] != want {
+		t.Errorf("expected %+v, got %+v", want, totals[1])
+	}
+}
+
+func TestValidateBudget(t *testing.T) {
+	limit := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name    string
+		req     models.SetAIBudgetRequest
+		wantErr bool
+	}{
+		{"workspace budget", models.SetAIBudgetRequest{Scope: "workspace", ScopeID: 3, Period: "monthly", SoftLimitUSD: limit(80), HardLimitUSD: limit(100)}, false},
+		{"user soft limit only", models.SetAIBudgetRequest{Scope: "user", ScopeID: 7, Period: "daily", SoftLimitUSD: limit(5)}, false},
+		{"unknown scope", models.SetAIBudgetRequest{Scope: "team", ScopeID: 3, Period: "monthly", HardLimitUSD: limit(1)}, true},
+		{"missing scope ID", models.SetAIBudgetRequest{Scope: "user", Period: "monthly", HardLimitUSD: limit(1)}, true},
+		{"unknown period", models.SetAIBudgetRequest{Scope: "user", ScopeID: 7, Period: "weekly", HardLimitUSD: limit(1)}, true},
+		{"no limits", models.SetAIBudgetRequest{Scope: "user", ScopeID: 7, Period: "monthly"}, true},
+		{"negative limit", models.SetAIBudgetRequest{Scope: "user", ScopeID: 7, Period: "monthly", HardLimitUSD: limit(-1)}, true},
+		{"soft above hard", models.SetAIBudgetRequest{Scope: "user", ScopeID: 7, Period: "monthly", SoftLimitUSD: limit(20), HardLimitUSD: limit(10)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateBudget(tt.req); (err != nil) != tt.wantErr {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
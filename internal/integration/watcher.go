@@ -0,0 +1,564 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/jareynolds/ubecode/pkg/search"
+)
+
+// Change operations reported by the workspace watcher
+const (
+	ChangeCreated  = "created"
+	ChangeModified = "modified"
+	ChangeDeleted  = "deleted"
+)
+
+// Artifact kinds, matching the listing endpoints that show them
+const (
+	ArtifactCapability = "capability" // POST /capability-files
+	ArtifactEnabler    = "enabler"    // POST /enabler-files
+	ArtifactStory      = "story"      // POST /story-files
+	ArtifactEpic       = "epic"       // POST /epic-files
+	ArtifactTheme      = "theme"      // POST /theme-files
+	ArtifactFeature    = "feature"    // POST /feature-files
+	ArtifactCode       = "code"       // POST /code-files
+	// ArtifactSpecification covers any other markdown in the spec folders (GET /specifications/list)
+	ArtifactSpecification = "specification"
+)
+
+// ChangeEvent describes one debounced change to a workspace artifact
+type ChangeEvent struct {
+	Type      string `json:"type"` // created, modified, deleted
+	Kind      string `json:"kind"` // capability, enabler, story, epic, theme, feature, code, specification
+	Workspace string `json:"workspace"`
+	Path      string `json:"path"`    // Absolute path, as returned by the listing endpoints
+	RelPath   string `json:"relPath"` // Path relative to the workspace root
+	// Artifact is the re-parsed item in the shape its listing endpoint returns. It is
+	// []FileCapability or []FileStory for multi-item files and nil for deletions.
+	Artifact  interface{} `json:"artifact,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// watcherSkipDirs are never scanned (dependency, build and VCS folders)
+var watcherSkipDirs = map[string]bool{
+	".git": true, "node_modules": true, "vendor": true, "dist": true,
+	"build": true, ".next": true, "__pycache__": true, "target": true,
+}
+
+// hasAnyPrefix reports whether the upper-cased file name starts with one of the prefixes
+func hasAnyPrefix(filenameUpper string, prefixes ...string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(filenameUpper, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// classifyArtifact maps a workspace-relative path to the artifact kind whose listing
+// endpoint would return it, using the same folders and file name patterns as the listers.
+// Other markdown in the spec folders is reported as a specification; "" means the file is not tracked.
+func classifyArtifact(relPath string) string {
+	parts := strings.Split(filepath.ToSlash(relPath), "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	folder := parts[0]
+	if folder == "code" {
+		return ArtifactCode
+	}
+
+	filename := parts[len(parts)-1]
+	if !strings.HasSuffix(strings.ToLower(filename), ".md") {
+		return ""
+	}
+	upper := strings.ToUpper(filename)
+
+	switch folder {
+	case "definition":
+		switch {
+		case hasAnyPrefix(upper, "CAP"):
+			return ArtifactCapability
+		case hasAnyPrefix(upper, "ENB-", "ENABLER"):
+			return ArtifactEnabler
+		case hasAnyPrefix(upper, "EPIC"):
+			return ArtifactEpic
+		}
+	case "conception":
+		switch {
+		case hasAnyPrefix(upper, "STORY", "SB-"):
+			return ArtifactStory
+		case hasAnyPrefix(upper, "VIS-", "STRAT-", "MKT-", "THEME", "VISION"):
+			return ArtifactTheme
+		}
+	case "specifications":
+		if hasAnyPrefix(upper, "FEAT") {
+			return ArtifactFeature
+		}
+	}
+
+	for _, f := range search.SpecFolders {
+		if folder == f {
+			return ArtifactSpecification
+		}
+	}
+	return ""
+}
+
+// parseArtifact re-reads a single changed file with the parser its listing endpoint uses.
+// Unlike the listers it never splits multi-item files, so a watcher has no side effects.
+func parseArtifact(kind, root, relPath string) (interface{}, error) {
+	path := filepath.Join(root, relPath)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	filename := info.Name()
+
+	if kind == ArtifactCode {
+		rel, _ := filepath.Rel(filepath.Join(root, "code"), path)
+		return CodeFile{
+			Name:     filename,
+			Path:     rel,
+			Size:     info.Size(),
+			Modified: info.ModTime().Format("2006-01-02 15:04:05"),
+		}, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	content := string(raw)
+
+	switch kind {
+	case ArtifactCapability:
+		return parseMarkdownCapabilities(filename, path, content), nil
+	case ArtifactEnabler:
+		return parseMarkdownEnabler(filename, path, content), nil
+	case ArtifactStory:
+		return parseMultipleStories(filename, path, content), nil
+	case ArtifactEpic:
+		return parseEpicMarkdown(filename, path, content), nil
+	case ArtifactTheme:
+		return parseThemeMarkdown(filename, path, content), nil
+	case ArtifactFeature:
+		return parseFeatureMarkdown(filename, path, content), nil
+	case ArtifactSpecification:
+		return SpecificationFile{Filename: filename, Content: content}, nil
+	}
+	return nil, nil
+}
+
+// fileState is what the watcher compares between scans
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// pendingChange is a change waiting out the debounce window
+type pendingChange struct {
+	op       string
+	kind     string
+	lastSeen time.Time
+}
+
+// WorkspaceWatcher detects artifact changes in one workspace folder. It follows fsnotify
+// events, watching every subfolder as it appears. With a poll interval it compares file
+// modification times and sizes instead, for bind mounts and network volumes where inotify
+// events are not delivered. Changes to a file are coalesced until it has been quiet for
+// the debounce window, so editor save bursts and git checkouts produce one event per file.
+type WorkspaceWatcher struct {
+	root      string
+	workspace string
+	interval  time.Duration // Poll interval; 0 follows fsnotify events
+	debounce  time.Duration
+	emit      func(ChangeEvent)
+
+	notify  *fsnotify.Watcher
+	files   map[string]fileState
+	pending map[string]*pendingChange
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewWorkspaceWatcher creates a watcher for the workspace at root, polling every interval
+// when it is positive. emit is called from the watcher goroutine for every debounced change.
+func NewWorkspaceWatcher(root string, interval, debounce time.Duration, emit func(ChangeEvent)) *WorkspaceWatcher {
+	return &WorkspaceWatcher{
+		root:      root,
+		workspace: filepath.Base(root),
+		interval:  interval,
+		debounce:  debounce,
+		emit:      emit,
+		files:     map[string]fileState{},
+		pending:   map[string]*pendingChange{},
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start takes the initial snapshot and begins watching
+func (w *WorkspaceWatcher) Start() {
+	w.files = w.snapshot()
+
+	// Without polling the ticker only flushes, so it runs at a fraction of the debounce window
+	tick := w.interval
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	if w.interval <= 0 {
+		tick = max(w.debounce/4, 10*time.Millisecond)
+		notify, err := fsnotify.NewWatcher()
+		if err != nil {
+			log.Printf("Workspace watcher %s: %v (set WATCH_POLL_INTERVAL to poll instead)", w.workspace, err)
+		} else {
+			w.notify = notify
+			w.watchTree(w.root, time.Time{}, false)
+			events, errs = notify.Events, notify.Errors
+		}
+	}
+
+	go func() {
+		defer close(w.done)
+		if w.notify != nil {
+			defer w.notify.Close()
+		}
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case e := <-events:
+				w.handle(e, time.Now())
+			case err := <-errs:
+				log.Printf("Workspace watcher %s: %v", w.workspace, err)
+			case now := <-ticker.C:
+				if w.interval > 0 {
+					w.scan(now)
+				}
+				w.flush(now)
+			}
+		}
+	}()
+}
+
+// Stop ends watching and waits for the watcher goroutine to exit
+func (w *WorkspaceWatcher) Stop() {
+	close(w.stop)
+	<-w.done
+}
+
+// skipDir reports whether a folder below the root is never watched
+func (w *WorkspaceWatcher) skipDir(path, name string) bool {
+	return path != w.root && (watcherSkipDirs[name] || strings.HasPrefix(name, "."))
+}
+
+// walk calls visit for every artifact file under dir outside the skipped folders, and visitDir for
+// every folder including dir
+func (w *WorkspaceWatcher) walk(dir string, visitDir func(path string), visit func(rel string, info fs.FileInfo)) {
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if w.skipDir(path, d.Name()) {
+				return filepath.SkipDir
+			}
+			visitDir(path)
+			return nil
+		}
+		rel, err := filepath.Rel(w.root, path)
+		if err != nil || classifyArtifact(rel) == "" {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			visit(rel, info)
+		}
+		return nil
+	})
+}
+
+// snapshot records the state of every artifact file in the workspace
+func (w *WorkspaceWatcher) snapshot() map[string]fileState {
+	files := map[string]fileState{}
+	w.walk(w.root, func(string) {}, func(rel string, info fs.FileInfo) {
+		files[rel] = fileState{modTime: info.ModTime(), size: info.Size()}
+	})
+	return files
+}
+
+// watchTree adds dir and its subfolders to the fsnotify watcher. Files already in a folder
+// that appeared after the watcher started were created before it could see them, so they
+// are recorded when record is set.
+func (w *WorkspaceWatcher) watchTree(dir string, now time.Time, record bool) {
+	w.walk(dir, func(path string) {
+		if err := w.notify.Add(path); err != nil {
+			log.Printf("Workspace watcher %s: failed to watch %s: %v", w.workspace, path, err)
+		}
+	}, func(rel string, info fs.FileInfo) {
+		if record {
+			w.touch(rel, info, now)
+		}
+	})
+}
+
+// handle records the change an fsnotify event describes
+func (w *WorkspaceWatcher) handle(e fsnotify.Event, now time.Time) {
+	rel, err := filepath.Rel(w.root, e.Name)
+	if err != nil || rel == "." {
+		return
+	}
+
+	switch {
+	case e.Has(fsnotify.Create), e.Has(fsnotify.Write):
+		info, err := os.Stat(e.Name)
+		if err != nil {
+			return
+		}
+		if info.IsDir() {
+			if e.Has(fsnotify.Create) && !w.skipDir(e.Name, info.Name()) {
+				w.watchTree(e.Name, now, true)
+			}
+			return
+		}
+		if classifyArtifact(rel) != "" {
+			w.touch(rel, info, now)
+		}
+	case e.Has(fsnotify.Remove), e.Has(fsnotify.Rename):
+		w.forget(rel, now)
+	}
+}
+
+// touch records a file that was created or written
+func (w *WorkspaceWatcher) touch(rel string, info fs.FileInfo, now time.Time) {
+	_, existed := w.files[rel]
+	w.files[rel] = fileState{modTime: info.ModTime(), size: info.Size()}
+	if existed {
+		w.record(rel, ChangeModified, now)
+	} else {
+		w.record(rel, ChangeCreated, now)
+	}
+}
+
+// forget records the deletion of a file, or of every file in a removed folder
+func (w *WorkspaceWatcher) forget(rel string, now time.Time) {
+	prefix := rel + string(filepath.Separator)
+	for known := range w.files {
+		if known == rel || strings.HasPrefix(known, prefix) {
+			delete(w.files, known)
+			w.record(known, ChangeDeleted, now)
+		}
+	}
+}
+
+// scan diffs a fresh snapshot against the previous one and records pending changes
+func (w *WorkspaceWatcher) scan(now time.Time) {
+	current := w.snapshot()
+
+	for rel, state := range current {
+		prev, existed := w.files[rel]
+		switch {
+		case !existed:
+			w.record(rel, ChangeCreated, now)
+		case !prev.modTime.Equal(state.modTime) || prev.size != state.size:
+			w.record(rel, ChangeModified, now)
+		}
+	}
+	for rel := range w.files {
+		if _, exists := current[rel]; !exists {
+			w.record(rel, ChangeDeleted, now)
+		}
+	}
+
+	w.files = current
+}
+
+// record merges a change into the pending set: created then modified stays created,
+// created then deleted cancels out, deleted then created becomes modified
+func (w *WorkspaceWatcher) record(rel, op string, now time.Time) {
+	p, ok := w.pending[rel]
+	if !ok {
+		w.pending[rel] = &pendingChange{op: op, kind: classifyArtifact(rel), lastSeen: now}
+		return
+	}
+
+	switch {
+	case p.op == ChangeCreated && op == ChangeDeleted:
+		delete(w.pending, rel)
+		return
+	case p.op == ChangeCreated:
+		// still a creation as far as clients are concerned
+	case p.op == ChangeDeleted && op == ChangeCreated:
+		p.op = ChangeModified
+	default:
+		p.op = op
+	}
+	p.lastSeen = now
+}
+
+// flush emits every pending change that has been quiet for the debounce window
+func (w *WorkspaceWatcher) flush(now time.Time) {
+	for rel, p := range w.pending {
+		if now.Sub(p.lastSeen) < w.debounce {
+			continue
+		}
+		delete(w.pending, rel)
+
+		event := ChangeEvent{
+			Type:      p.op,
+			Kind:      p.kind,
+			Workspace: w.workspace,
+			Path:      filepath.Join(w.root, rel),
+			RelPath:   filepath.ToSlash(rel),
+			Timestamp: now,
+		}
+		if p.op != ChangeDeleted {
+			artifact, err := parseArtifact(p.kind, w.root, rel)
+			if err != nil {
+				// Removed between the scan and the parse; the next scan reports the deletion
+				continue
+			}
+			event.Artifact = artifact
+		}
+		w.emit(event)
+	}
+}
+
+// WatchHub runs one watcher per workspace while anything is interested in it and fans
+// events out to subscribers
+type WatchHub struct {
+	mu       sync.Mutex
+	interval time.Duration
+	debounce time.Duration
+	watchers map[string]*hubEntry
+	// onChange is called once per event before it is fanned out (e.g. to update the search index)
+	onChange func(ChangeEvent)
+}
+
+type hubEntry struct {
+	watcher     *WorkspaceWatcher
+	refs        int
+	subscribers map[chan ChangeEvent]struct{}
+}
+
+// NewWatchHub creates a hub whose watchers debounce for debounce. They follow fsnotify
+// events, or poll every interval when it is positive.
+func NewWatchHub(interval, debounce time.Duration, onChange func(ChangeEvent)) *WatchHub {
+	return &WatchHub{
+		interval: interval,
+		debounce: debounce,
+		watchers: map[string]*hubEntry{},
+		onChange: onChange,
+	}
+}
+
+// Retain starts watching root if needed and returns a function that releases it
+func (h *WatchHub) Retain(root string) func() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.retainLocked(root)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { h.release(root) })
+	}
+}
+
+// SetPollInterval makes watchers started from now on poll every interval instead of
+// following fsnotify events
+func (h *WatchHub) SetPollInterval(interval time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.interval = interval
+}
+
+func (h *WatchHub) retainLocked(root string) *hubEntry {
+	entry, ok := h.watchers[root]
+	if !ok {
+		entry = &hubEntry{subscribers: map[chan ChangeEvent]struct{}{}}
+		entry.watcher = NewWorkspaceWatcher(root, h.interval, h.debounce, func(e ChangeEvent) {
+			h.publish(root, e)
+		})
+		entry.watcher.Start()
+		h.watchers[root] = entry
+	}
+	entry.refs++
+	return entry
+}
+
+func (h *WatchHub) release(root string) {
+	h.mu.Lock()
+	entry, ok := h.watchers[root]
+	if !ok {
+		h.mu.Unlock()
+		return
+	}
+	entry.refs--
+	if entry.refs > 0 {
+		h.mu.Unlock()
+		return
+	}
+	delete(h.watchers, root)
+	h.mu.Unlock()
+
+	// Stop outside the lock: the watcher may be blocked publishing
+	entry.watcher.Stop()
+}
+
+// Subscribe returns a channel of change events for the workspace at root and a cancel
+// function that must be called when the subscriber goes away
+func (h *WatchHub) Subscribe(root string) (<-chan ChangeEvent, func()) {
+	ch := make(chan ChangeEvent, 64)
+
+	h.mu.Lock()
+	entry := h.retainLocked(root)
+	entry.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(entry.subscribers, ch)
+			h.mu.Unlock()
+			h.release(root)
+		})
+	}
+}
+
+// publish delivers an event to every subscriber of the workspace. Slow subscribers
+// drop events rather than stall the watcher; clients re-list on reconnect.
+func (h *WatchHub) publish(root string, e ChangeEvent) {
+	if h.onChange != nil {
+		h.onChange(e)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	entry, ok := h.watchers[root]
+	if !ok {
+		return
+	}
+	for ch := range entry.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
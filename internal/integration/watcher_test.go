@@ -0,0 +1,226 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestClassifyArtifact(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"definition/CAP-LOGIN.md", ArtifactCapability},
+		{"definition/nested/capability-auth.md", ArtifactCapability},
+		{"definition/ENB-123.md", ArtifactEnabler},
+		{"definition/EPIC-ONBOARDING.md", ArtifactEpic},
+		{"conception/STORY-LOGIN-1.md", ArtifactStory},
+		{"conception/SB-1.md", ArtifactStory},
+		{"conception/VIS-PRODUCT.md", ArtifactTheme},
+		{"specifications/FEAT-SEARCH.md", ArtifactFeature},
+		{"specifications/CAP-LOGIN.md", ArtifactSpecification},
+		{"code/src/main.go", ArtifactCode},
+		{"definition/notes.txt", ""},
+		{"assets/logo.md", ""},
+		{"README.md", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := classifyArtifact(tt.path); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func writeWorkspaceFile(t *testing.T, root, rel, content string) {
+	t.Helper()
+	path := filepath.Join(root, rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWorkspaceWatcherDebouncesChanges(t *testing.T) {
+	root := t.TempDir()
+	writeWorkspaceFile(t, root, "definition/EPIC-EXISTING.md", "# Existing\n")
+
+	var events []ChangeEvent
+	w := NewWorkspaceWatcher(root, time.Second, 500*time.Millisecond, func(e ChangeEvent) {
+		events = append(events, e)
+	})
+	w.files = w.snapshot()
+
+	start := time.Now()
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	// A new capability saved twice in quick succession yields a single "created" event
+	writeWorkspaceFile(t, root, "definition/CAP-LOGIN.md", "# Login\n")
+	w.scan(at(0))
+	writeWorkspaceFile(t, root, "definition/CAP-LOGIN.md", "# Login\n\n**Status:** Draft\n")
+	w.scan(at(200))
+	w.flush(at(400))
+	if len(events) != 0 {
+		t.Fatalf("expected no events inside the debounce window, got %d", len(events))
+	}
+	w.flush(at(800))
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event after debounce, got %d", len(events))
+	}
+	created := events[0]
+	if created.Type != ChangeCreated || created.Kind != ArtifactCapability || created.RelPath != "definition/CAP-LOGIN.md" {
+		t.Errorf("unexpected event %+v", created)
+	}
+	caps, ok := created.Artifact.([]FileCapability)
+	if !ok || len(caps) != 1 || caps[0].Status != "Draft" {
+		t.Errorf("expected re-parsed capability with latest content, got %#v", created.Artifact)
+	}
+
+	// A file created and removed before the window closes produces nothing
+	writeWorkspaceFile(t, root, "conception/STORY-TEMP.md", "# Temp\n")
+	w.scan(at(1000))
+	os.Remove(filepath.Join(root, "conception/STORY-TEMP.md"))
+	w.scan(at(1100))
+	w.flush(at(2000))
+	if len(events) != 1 {
+		t.Fatalf("expected transient file to be ignored, got %d events", len(events))
+	}
+
+	// Deletions carry no artifact; untracked files are ignored
+	os.Remove(filepath.Join(root, "definition/EPIC-EXISTING.md"))
+	writeWorkspaceFile(t, root, "assets/image.png", "png")
+	w.scan(at(3000))
+	w.flush(at(4000))
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	deleted := events[1]
+	if deleted.Type != ChangeDeleted || deleted.Kind != ArtifactEpic || deleted.Artifact != nil {
+		t.Errorf("unexpected deletion event %+v", deleted)
+	}
+}
+
+func TestWatchHubFansOutToSubscribers(t *testing.T) {
+	root := t.TempDir()
+	hub := NewWatchHub(0, 20*time.Millisecond, nil)
+
+	first, cancelFirst := hub.Subscribe(root)
+	second, cancelSecond := hub.Subscribe(root)
+	defer cancelSecond()
+
+	// Folders created after the watcher started are watched too
+	writeWorkspaceFile(t, root, "specifications/FEAT-SEARCH.md", "# Search\n")
+
+	for _, ch := range []<-chan ChangeEvent{first, second} {
+		select {
+		case e := <-ch:
+			if e.Kind != ArtifactFeature || e.Type != ChangeCreated {
+				t.Errorf("unexpected event %+v", e)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for change event")
+		}
+	}
+
+	writeWorkspaceFile(t, root, "specifications/FEAT-SEARCH.md", "# Search\n\nUpdated\n")
+	select {
+	case e := <-first:
+		if e.Kind != ArtifactFeature || e.Type != ChangeModified {
+			t.Errorf("unexpected event %+v", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for modification event")
+	}
+
+	cancelFirst()
+	hub.mu.Lock()
+	refs := hub.watchers[root].refs
+	hub.mu.Unlock()
+	if refs != 1 {
+		t.Errorf("expected watcher to stay up for the remaining subscriber, refs=%d", refs)
+	}
+
+	cancelSecond()
+	hub.mu.Lock()
+	_, running := hub.watchers[root]
+	hub.mu.Unlock()
+	if running {
+		t.Error("expected watcher to stop after the last subscriber left")
+	}
+}
+
+func TestWatchHubPolling(t *testing.T) {
+	root := t.TempDir()
+	hub := NewWatchHub(0, 20*time.Millisecond, nil)
+	hub.SetPollInterval(10 * time.Millisecond)
+
+	events, cancel := hub.Subscribe(root)
+	defer cancel()
+	hub.mu.Lock()
+	notify := hub.watchers[root].watcher.notify
+	hub.mu.Unlock()
+	if notify != nil {
+		t.Fatal("expected a polling watcher not to use fsnotify")
+	}
+
+	writeWorkspaceFile(t, root, "definition/CAP-LOGIN.md", "# Login\n")
+	select {
+	case e := <-events:
+		if e.Kind != ArtifactCapability || e.Type != ChangeCreated {
+			t.Errorf("unexpected event %+v", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for change event")
+	}
+}
+
+func TestWatchableRoot(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	acme := filepath.Join(cwd, "workspaces", "acme")
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"workspaces/acme", acme},
+		{"/Users/dev/ubecode/workspaces/acme/", acme},
+		{"/", ""},
+		{"/etc", ""},
+		{"workspaces", ""},
+		{"workspaces/acme/definition", ""},
+		{"workspaces/../etc", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := watchableRoot(tt.path)
+			if tt.expected == "" {
+				if !errors.Is(err, errNotWorkspaceRoot) {
+					t.Errorf("expected %s to be rejected, got %q, %v", tt.path, got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.expected {
+				t.Errorf("expected %q, got %q, %v", tt.expected, got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,549 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/jareynolds/ubecode/pkg/repository"
+)
+
+const (
+	archiveManifestFile = "manifest.json"
+	archiveRecordsFile  = "records.json"
+	archiveFilesDir     = "workspace" // Holds the workspace folder tree
+	// maxWorkspaceArchiveSize caps the size of an uploaded workspace archive
+	maxWorkspaceArchiveSize = 500 << 20
+)
+
+var (
+	errInvalidArchive = errors.New("invalid workspace archive")
+	errImportConflict = errors.New("workspace archive conflicts with existing data")
+)
+
+// archivedWorkspace describes a workspace row for an archive manifest, without credentials
+func archivedWorkspace(ws *models.Workspace) (models.CreateWorkspaceRequest, error) {
+	var settings map[string]interface{}
+	data, err := json.Marshal(ws.Settings)
+	if err == nil {
+		err = json.Unmarshal(data, &settings)
+	}
+	if err != nil {
+		return models.CreateWorkspaceRequest{}, err
+	}
+	if settings != nil {
+		models.RedactSecrets(settings)
+	}
+	return models.CreateWorkspaceRequest{
+		Name:          ws.Name,
+		Description:   ws.Description,
+		FolderName:    ws.FolderName,
+		WorkspaceType: ws.WorkspaceType,
+		FigmaFileURL:  ws.FigmaFileURL,
+		IsShared:      ws.IsShared,
+		ConfigID:      ws.ConfigID,
+		Settings:      settings,
+	}, nil
+}
+
+// writeWorkspaceArchive writes a workspace's folder tree and records as a zip archive. The
+// manifest is written last so it can list every other entry with its checksum.
+func writeWorkspaceArchive(w io.Writer, ws *models.Workspace, records *models.WorkspaceRecords) error {
+	workspace, err := archivedWorkspace(ws)
+	if err != nil {
+		return err
+	}
+	manifest := models.WorkspaceArchiveManifest{
+		SchemaVersion: models.WorkspaceArchiveSchemaVersion,
+		ExportedAt:    time.Now().UTC(),
+		Workspace:     workspace,
+		Files:         []models.WorkspaceArchiveFile{},
+		RecordCounts:  map[string]int{},
+	}
+	for table, rows := range records.Tables {
+		manifest.RecordCounts[table] = len(rows)
+	}
+
+	zw := zip.NewWriter(w)
+	add := func(name string, r io.Reader) error {
+		fw, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		hash := sha256.New()
+		size, err := io.Copy(io.MultiWriter(fw, hash), r)
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, models.WorkspaceArchiveFile{
+			Path: name, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil)),
+		})
+		return nil
+	}
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := add(archiveRecordsFile, bytes.NewReader(data)); err != nil {
+		return err
+	}
+
+	// Symlinks and other special files are left out
+	err = filepath.WalkDir(ws.Path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(ws.Path, p)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return add(archiveFilesDir+"/"+filepath.ToSlash(rel), f)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to archive workspace folder: %v", err)
+	}
+
+	fw, err := zw.Create(archiveManifestFile)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(fw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// workspaceArchive is a checked archive ready to import
+type workspaceArchive struct {
+	manifest models.WorkspaceArchiveManifest
+	records  models.WorkspaceRecords
+	files    []*zip.File // Entries under workspace/
+}
+
+// readWorkspaceArchive opens an archive and checks it against its manifest: the schema
+// version, and the size and checksum of every entry
+func readWorkspaceArchive(data []byte) (*workspaceArchive, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not a zip archive: %v", err)
+	}
+
+	archive := &workspaceArchive{}
+	var manifestFile *zip.File
+	for _, f := range zr.File {
+		if f.Name == archiveManifestFile {
+			manifestFile = f
+		}
+	}
+	if manifestFile == nil {
+		return nil, fmt.Errorf("archive has no %s", archiveManifestFile)
+	}
+	if err := readZipJSON(manifestFile, &archive.manifest); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", archiveManifestFile, err)
+	}
+	version := archive.manifest.SchemaVersion
+	if version < 1 || version > models.WorkspaceArchiveSchemaVersion {
+		return nil, fmt.Errorf("unsupported archive schema version %d (this install reads up to %d)",
+			version, models.WorkspaceArchiveSchemaVersion)
+	}
+
+	listed := map[string]models.WorkspaceArchiveFile{}
+	for _, f := range archive.manifest.Files {
+		listed[f.Path] = f
+	}
+	seen := map[string]bool{}
+	for _, f := range zr.File {
+		if f.Name == archiveManifestFile || strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		entry, ok := listed[f.Name]
+		if !ok {
+			return nil, fmt.Errorf("%s is not listed in the manifest", f.Name)
+		}
+		if !fs.ValidPath(f.Name) || !f.Mode().IsRegular() {
+			return nil, fmt.Errorf("invalid archive entry %s", f.Name)
+		}
+		if err := verifyZipEntry(f, entry); err != nil {
+			return nil, err
+		}
+		seen[f.Name] = true
+
+		switch {
+		case f.Name == archiveRecordsFile:
+			if err := readZipJSON(f, &archive.records); err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", archiveRecordsFile, err)
+			}
+		case strings.HasPrefix(f.Name, archiveFilesDir+"/"):
+			archive.files = append(archive.files, f)
+		default:
+			return nil, fmt.Errorf("unexpected archive entry %s", f.Name)
+		}
+	}
+	for name := range listed {
+		if !seen[name] {
+			return nil, fmt.Errorf("%s is listed in the manifest but missing from the archive", name)
+		}
+	}
+	if archive.records.Tables == nil {
+		archive.records.Tables = map[string][]map[string]interface{}{}
+	}
+	return archive, nil
+}
+
+func readZipJSON(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return json.NewDecoder(rc).Decode(v)
+}
+
+// verifyZipEntry checks an entry's size and SHA-256 against the manifest
+func verifyZipEntry(f *zip.File, entry models.WorkspaceArchiveFile) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, rc)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", f.Name, err)
+	}
+	if size != entry.Size || hex.EncodeToString(hash.Sum(nil)) != entry.SHA256 {
+		return fmt.Errorf("checksum mismatch for %s", f.Name)
+	}
+	return nil
+}
+
+// extract writes the archived folder tree into dest. Renamed identifiers are rewritten in
+// markdown files so specifications keep pointing at their records.
+func (a *workspaceArchive) extract(dest string, renamed map[string]string) error {
+	var ids *regexp.Regexp
+	if len(renamed) > 0 {
+		olds := make([]string, 0, len(renamed))
+		for old := range renamed {
+			olds = append(olds, regexp.QuoteMeta(old))
+		}
+		// Longest first so CAP-1234 is not matched inside CAP-12345
+		sort.Slice(olds, func(i, j int) bool { return len(olds[i]) > len(olds[j]) })
+		ids = regexp.MustCompile(`\b(` + strings.Join(olds, "|") + `)\b`)
+	}
+
+	for _, f := range a.files {
+		rel := strings.TrimPrefix(f.Name, archiveFilesDir+"/")
+		target := filepath.Join(dest, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		if ids != nil && strings.EqualFold(filepath.Ext(rel), ".md") {
+			content = ids.ReplaceAllFunc(content, func(id []byte) []byte {
+				return []byte(renamed[string(id)])
+			})
+		}
+		if err := os.WriteFile(target, content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// workspaceFolderTaken reports whether a folder exists on disk or in the registry
+func (s *Service) workspaceFolderTaken(folder string) (bool, error) {
+	if _, err := os.Stat(filepath.Join(models.WorkspacesDir, folder)); err == nil {
+		return true, nil
+	}
+	_, err := s.workspaces.GetByFolder(folder)
+	if errors.Is(err, repository.ErrWorkspaceNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// renameConflicts gives each conflicting identifier a new one with the same prefix, e.g.
+// CAP-582341 becomes CAP-907113, until none clash with this database
+func (s *Service) renameConflicts(records *models.WorkspaceRecords, conflicts []models.WorkspaceImportConflict) (map[string]string, error) {
+	renamed := map[string]string{}
+	for attempt := 0; len(conflicts) > 0; attempt++ {
+		if attempt == 5 {
+			return nil, fmt.Errorf("could not find free identifiers for %d records", len(conflicts))
+		}
+		batch := map[string]string{}
+		for _, c := range conflicts {
+			prefix := c.Value
+			if i := strings.LastIndex(c.Value, "-"); i > 0 {
+				prefix = c.Value[:i]
+			}
+			batch[c.Value] = fmt.Sprintf("%s-%06d", prefix, rand.IntN(1000000))
+		}
+		repository.RenameRecords(records, batch)
+
+		// Follow chains so renamed maps archived values to their final ones
+		for old, current := range renamed {
+			if next, ok := batch[current]; ok {
+				renamed[old] = next
+				delete(batch, current)
+			}
+		}
+		for old, next := range batch {
+			renamed[old] = next
+		}
+
+		var err error
+		if conflicts, err = s.workspaces.RecordConflicts(records); err != nil {
+			return nil, err
+		}
+	}
+	return renamed, nil
+}
+
+// ImportWorkspaceArchive restores an exported workspace as a new workspace owned by the
+// importing user. Archived row IDs are remapped. Identifiers and folders that are already
+// taken fail the import with errImportConflict, or get new values when req.OnConflict is
+// rename. A dry run reports the outcome without changing anything.
+func (s *Service) ImportWorkspaceArchive(data []byte, req models.WorkspaceImportRequest, userID *int) (*models.WorkspaceImportReport, error) {
+	if s.workspaces == nil {
+		return nil, errWorkspaceRegistryDisabled
+	}
+	archive, err := readWorkspaceArchive(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidArchive, err)
+	}
+
+	ws := archive.manifest.Workspace
+	ws.Template = nil
+	if req.Name != "" {
+		ws.Name = req.Name
+	}
+	if req.FolderName != "" {
+		ws.FolderName = req.FolderName
+	}
+	if ws.FolderName == "" {
+		ws.FolderName = workspaceFolderName(ws.Name)
+	}
+	if strings.TrimSpace(ws.Name) == "" {
+		return nil, fmt.Errorf("%w: workspace name is missing", errInvalidArchive)
+	}
+	if !validFolderName.MatchString(ws.FolderName) || strings.Trim(ws.FolderName, "-") == "" {
+		return nil, fmt.Errorf("%w: invalid folder name %q", errInvalidArchive, ws.FolderName)
+	}
+
+	s.reconcileMu.Lock()
+	defer s.reconcileMu.Unlock()
+
+	report := &models.WorkspaceImportReport{
+		DryRun:        req.DryRun,
+		SchemaVersion: archive.manifest.SchemaVersion,
+		Name:          ws.Name,
+		FolderName:    ws.FolderName,
+		Files:         len(archive.files),
+		Records:       map[string]int{},
+		Conflicts:     []models.WorkspaceImportConflict{},
+		Warnings:      []string{},
+	}
+	for table, rows := range archive.records.Tables {
+		report.Records[table] = len(rows)
+	}
+	rename := req.OnConflict == models.ImportConflictRename
+
+	taken, err := s.workspaceFolderTaken(ws.FolderName)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		conflict := models.WorkspaceImportConflict{Table: "workspaces", Column: "folder_name", Value: ws.FolderName}
+		if rename {
+			base := ws.FolderName
+			for i := 2; taken; i++ {
+				ws.FolderName = fmt.Sprintf("%s-%d", base, i)
+				if taken, err = s.workspaceFolderTaken(ws.FolderName); err != nil {
+					return nil, err
+				}
+			}
+			conflict.Resolution = ws.FolderName
+			report.FolderName = ws.FolderName
+		}
+		report.Conflicts = append(report.Conflicts, conflict)
+	}
+
+	conflicts, err := s.workspaces.RecordConflicts(&archive.records)
+	if err != nil {
+		return nil, err
+	}
+	var renamed map[string]string
+	if rename && len(conflicts) > 0 {
+		if renamed, err = s.renameConflicts(&archive.records, conflicts); err != nil {
+			return nil, err
+		}
+		for i := range conflicts {
+			conflicts[i].Resolution = renamed[conflicts[i].Value]
+		}
+	}
+	report.Conflicts = append(report.Conflicts, conflicts...)
+
+	if req.DryRun {
+		return report, nil
+	}
+	if !rename && len(report.Conflicts) > 0 {
+		return report, errImportConflict
+	}
+
+	// Files go to a hidden staging folder, which reconciliation ignores, until the records
+	// are in
+	staging := filepath.Join(models.WorkspacesDir, fmt.Sprintf(".importing-%s-%d", ws.FolderName, time.Now().UnixNano()))
+	if err := archive.extract(staging, renamed); err != nil {
+		os.RemoveAll(staging)
+		return nil, fmt.Errorf("failed to extract workspace files: %v", err)
+	}
+
+	created, counts, warnings, err := s.workspaces.ImportRecords(ws, &archive.records, userID)
+	if err != nil {
+		os.RemoveAll(staging)
+		return nil, err
+	}
+	if err := os.Rename(staging, created.Path); err != nil {
+		os.RemoveAll(staging)
+		if delErr := s.workspaces.Delete(created.ID); delErr != nil {
+			log.Printf("Failed to remove workspace %d: %v", created.ID, delErr)
+		}
+		return nil, fmt.Errorf("failed to move imported workspace into place: %v", err)
+	}
+
+	report.Workspace = created
+	report.Records = counts
+	report.Warnings = append(report.Warnings, warnings...)
+	if _, _, err := ensureWorkspaceStructure(created.Path); err == nil {
+		err = refreshWorkspaceConfig(created)
+	}
+	if err != nil {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("failed to update %s: %v", workspaceConfigFile, err))
+	}
+	return report, nil
+}
+
+// HandleExportWorkspace handles GET /workspaces/{id}/export
+// Downloads the workspace folder tree and its database records as a zip archive
+func (h *Handler) HandleExportWorkspace(w http.ResponseWriter, r *http.Request) {
+	ws, ok := h.loadWorkspace(w, r)
+	if !ok {
+		return
+	}
+	if ws.Path == "" || ws.MissingSince != nil {
+		http.Error(w, "workspace folder is missing", http.StatusConflict)
+		return
+	}
+
+	records, err := h.service.workspaces.ExportRecords(ws.ID)
+	if err != nil {
+		writeWorkspaceError(w, "export workspace", err)
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%s.zip", ws.FolderName, time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if err := writeWorkspaceArchive(w, ws, records); err != nil {
+		// The response has started, so the client sees a truncated archive
+		log.Printf("Failed to export workspace %d: %v", ws.ID, err)
+	}
+}
+
+// HandleImportWorkspace handles POST /workspaces/import (workspace admins only)
+// Restores a workspace archive sent as the request body. ?dry_run=true reports what would
+// happen, ?on_conflict=rename gives taken identifiers new values, and ?name= and
+// ?folder_name= override the archived ones.
+func (h *Handler) HandleImportWorkspace(w http.ResponseWriter, r *http.Request) {
+	if access, ok := r.Context().Value("access").(*models.AccessGrant); ok && !access.Can(models.PermWorkspacesAdmin) {
+		http.Error(w, fmt.Sprintf("missing permission: %s", models.PermWorkspacesAdmin), http.StatusForbidden)
+		return
+	}
+
+	query := r.URL.Query()
+	req := models.WorkspaceImportRequest{
+		Name:       strings.TrimSpace(query.Get("name")),
+		FolderName: query.Get("folder_name"),
+		OnConflict: query.Get("on_conflict"),
+		DryRun:     query.Get("dry_run") == "true",
+	}
+	switch req.OnConflict {
+	case "":
+		req.OnConflict = models.ImportConflictFail
+	case models.ImportConflictFail, models.ImportConflictRename:
+	default:
+		http.Error(w, "on_conflict must be fail or rename", http.StatusBadRequest)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxWorkspaceArchiveSize+1))
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	if len(data) == 0 {
+		http.Error(w, "workspace archive is required", http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxWorkspaceArchiveSize {
+		http.Error(w, fmt.Sprintf("workspace archive exceeds %d MB", maxWorkspaceArchiveSize>>20), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	report, err := h.service.ImportWorkspaceArchive(data, req, requestUserID(r))
+	switch {
+	case errors.Is(err, errInvalidArchive):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errImportConflict):
+		writeJSON(w, http.StatusConflict, report)
+	case repository.IsImportConflict(err):
+		http.Error(w, fmt.Sprintf("workspace archive conflicts with existing data: %v", err), http.StatusConflict)
+	case err != nil:
+		writeWorkspaceError(w, "import workspace", err)
+	case req.DryRun:
+		writeJSON(w, http.StatusOK, report)
+	default:
+		writeJSON(w, http.StatusCreated, report)
+	}
+}
@@ -0,0 +1,195 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+func exportTestWorkspace(t *testing.T) []byte {
+	t.Helper()
+	root := filepath.Join(t.TempDir(), "acme")
+	files := map[string]string{
+		".ubeworkspace":                `{"id":"workspace-1","name":"Acme"}`,
+		"specifications/CAP-123456.md": "# Checkout\n\n**ID**: CAP-123456\n**Enabler**: ENB-654321\n",
+		"conception/VIS-VISION-1.md":   "# Vision\n",
+		"code/main.go":                 "package main // CAP-123456\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ws := &models.Workspace{
+		ID: 1, Name: "Acme", FolderName: "acme", Path: root, WorkspaceType: "new",
+		Settings: map[string]interface{}{
+			"activeAIPreset": 3,
+			"customSettings": map[string]interface{}{"theme": "dark", "githubToken": "ghp_secret"},
+		},
+	}
+	records := &models.WorkspaceRecords{
+		Users: map[string]string{"7": "ada@example.com"},
+		Tables: map[string][]map[string]interface{}{
+			"capabilities": {{"id": 10, "capability_id": "CAP-123456", "name": "Checkout", "created_by": 7}},
+			"enablers":     {{"id": 20, "enabler_id": "ENB-654321", "capability_id": 10}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := writeWorkspaceArchive(&buf, ws, records); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWorkspaceArchiveRoundTrip(t *testing.T) {
+	data := exportTestWorkspace(t)
+
+	archive, err := readWorkspaceArchive(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archive.manifest.SchemaVersion != models.WorkspaceArchiveSchemaVersion {
+		t.Errorf("schema version = %d", archive.manifest.SchemaVersion)
+	}
+	if archive.manifest.Workspace.Name != "Acme" || archive.manifest.Workspace.FolderName != "acme" {
+		t.Errorf("unexpected workspace: %+v", archive.manifest.Workspace)
+	}
+	custom, _ := archive.manifest.Workspace.Settings["customSettings"].(map[string]interface{})
+	if _, ok := custom["githubToken"]; ok || custom["theme"] != "dark" {
+		t.Errorf("credentials should be redacted from settings, got %v", custom)
+	}
+	if len(archive.files) != 4 {
+		t.Errorf("expected 4 files, got %d", len(archive.files))
+	}
+	if got := archive.records.Tables["capabilities"][0]["capability_id"]; got != "CAP-123456" {
+		t.Errorf("capability record not restored: %v", got)
+	}
+	if archive.manifest.RecordCounts["enablers"] != 1 {
+		t.Errorf("record counts = %v", archive.manifest.RecordCounts)
+	}
+
+	dest := t.TempDir()
+	renamed := map[string]string{"CAP-123456": "CAP-900001"}
+	if err := archive.extract(dest, renamed); err != nil {
+		t.Fatal(err)
+	}
+	spec, err := os.ReadFile(filepath.Join(dest, "specifications", "CAP-123456.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(spec), "**ID**: CAP-900001") || !strings.Contains(string(spec), "ENB-654321") {
+		t.Errorf("renamed IDs not rewritten in markdown:\n%s", spec)
+	}
+	code, _ := os.ReadFile(filepath.Join(dest, "code", "main.go"))
+	if !strings.Contains(string(code), "CAP-123456") {
+		t.Errorf("only markdown files should be rewritten, got %q", code)
+	}
+}
+
+// rewriteArchive copies an archive, letting edit change or drop entries
+func rewriteArchive(t *testing.T, data []byte, edit func(name string, content []byte) ([]byte, bool)) []byte {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		content, keep := edit(f.Name, content)
+		if !keep {
+			continue
+		}
+		fw, _ := zw.Create(f.Name)
+		fw.Write(content)
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestReadWorkspaceArchiveRejects(t *testing.T) {
+	data := exportTestWorkspace(t)
+
+	tests := []struct {
+		name string
+		edit func(name string, content []byte) ([]byte, bool)
+	}{
+		{"tampered file", func(name string, content []byte) ([]byte, bool) {
+			if name == "workspace/conception/VIS-VISION-1.md" {
+				return []byte("# Changed\n"), true
+			}
+			return content, true
+		}},
+		{"missing file", func(name string, content []byte) ([]byte, bool) {
+			return content, name != "workspace/code/main.go"
+		}},
+		{"missing manifest", func(name string, content []byte) ([]byte, bool) {
+			return content, name != archiveManifestFile
+		}},
+		{"newer schema", func(name string, content []byte) ([]byte, bool) {
+			if name != archiveManifestFile {
+				return content, true
+			}
+			var manifest map[string]interface{}
+			json.Unmarshal(content, &manifest)
+			manifest["schema_version"] = models.WorkspaceArchiveSchemaVersion + 1
+			out, _ := json.Marshal(manifest)
+			return out, true
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := readWorkspaceArchive(rewriteArchive(t, data, tt.edit)); err == nil {
+				t.Error("expected the archive to be rejected")
+			}
+		})
+	}
+
+	if _, err := readWorkspaceArchive([]byte("not a zip")); err == nil {
+		t.Error("expected a non-zip body to be rejected")
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	values := map[string]interface{}{
+		"url":          "https://github.com/acme/billing",
+		"access_token": "abc",
+		"apiKey":       "def",
+		"nested":       map[string]interface{}{"client_secret": "ghi", "owner": "acme"},
+	}
+	if removed := models.RedactSecrets(values); removed != 3 {
+		t.Errorf("removed %d keys, want 3", removed)
+	}
+	nested := values["nested"].(map[string]interface{})
+	if values["url"] == nil || nested["owner"] != "acme" || len(values) != 2 || len(nested) != 1 {
+		t.Errorf("unexpected result: %v", values)
+	}
+}
@@ -0,0 +1,581 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jareynolds/ubecode/internal/auth"
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/jareynolds/ubecode/pkg/repository"
+	"github.com/jareynolds/ubecode/pkg/templates"
+)
+
+// WorkspaceRegistry looks up registered workspaces
+type WorkspaceRegistry interface {
+	Get(id int) (*models.Workspace, error)
+	GetByFolder(folder string) (*models.Workspace, error)
+}
+
+// WorkspaceScope resolves the workspace a request works in from its workspaceId; its folder
+// comes from the registry only. Requests without one may still name a registered folder by
+// its workspacePath; other requests carrying a filesystem path must name a workspace. Every
+// path must point inside the workspace's folder and every file or subfolder name must stay
+// in it. Unknown IDs and unregistered folders are rejected, as are writes to archived
+// workspaces. The workspace is stored in the request context.
+func WorkspaceScope(registry WorkspaceRegistry, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || !workspaceScoped(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Error responses still need CORS headers for the browser to read them
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		refs, err := requestWorkspaces(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(refs.ids) > 1 {
+			http.Error(w, "a request may name only one workspaceId", http.StatusBadRequest)
+			return
+		}
+		var ws *models.Workspace
+		switch {
+		case len(refs.ids) == 1:
+			if ws, err = registry.Get(refs.ids[0]); errors.Is(err, repository.ErrWorkspaceNotFound) {
+				http.Error(w, fmt.Sprintf("workspace %d not found", refs.ids[0]), http.StatusNotFound)
+				return
+			}
+		case len(refs.folders) > 0:
+			// Deprecated: a registered folder still names its workspace
+			if ws, err = registry.GetByFolder(refs.folders[0]); errors.Is(err, repository.ErrWorkspaceNotFound) {
+				http.Error(w, fmt.Sprintf("workspace folder %s is not registered", refs.folders[0]), http.StatusBadRequest)
+				return
+			}
+		case len(refs.paths) > 0:
+			http.Error(w, "workspaceId is required", http.StatusBadRequest)
+			return
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to look up workspace: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if ws.FolderName == "" {
+			http.Error(w, fmt.Sprintf("workspace %d has no folder yet", ws.ID), http.StatusConflict)
+			return
+		}
+		for _, folder := range refs.folders {
+			if folder != ws.FolderName {
+				http.Error(w, fmt.Sprintf("path is outside workspace %d: %s", ws.ID, folder), http.StatusBadRequest)
+				return
+			}
+		}
+		for _, p := range refs.paths {
+			if p != "" && !insideWorkspace(p, ws) {
+				http.Error(w, fmt.Sprintf("path is outside workspace %d: %s", ws.ID, p), http.StatusBadRequest)
+				return
+			}
+		}
+		for _, name := range refs.names {
+			if name != "" && !filepath.IsLocal(filepath.FromSlash(name)) {
+				http.Error(w, fmt.Sprintf("name is outside workspace %d: %s", ws.ID, name), http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Archived workspaces are read-only
+		if ws.IsArchived() && !strings.HasSuffix(auth.PermissionForRequest(r.Method, r.URL.Path), ":read") {
+			http.Error(w, fmt.Sprintf("workspace %s is archived", ws.Name), http.StatusConflict)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "workspace", ws)))
+	})
+}
+
+// workspaceScoped reports whether an endpoint works inside a workspace. The registry, folder
+// browsing and .ubeworkspace endpoints deal with folders before they are registered; jobs
+// are looked up by ID; AI usage is reported for archived and deleted workspaces too.
+func workspaceScoped(path string) bool {
+	switch {
+	case path == "/health", path == "/workspaces", strings.HasPrefix(path, "/workspaces/"),
+		strings.HasPrefix(path, "/workspace-config"), strings.HasPrefix(path, "/folders/"),
+		path == "/jobs", strings.HasPrefix(path, "/jobs/"),
+		path == "/ai-usage", path == "/ai-budgets", strings.HasPrefix(path, "/ai-budgets/"):
+		return false
+	}
+	return true
+}
+
+// scopedWorkspacePath returns the folder of the workspace named by workspaceId. The
+// client's own path is only used without a workspace registry, when WorkspaceScope does
+// not run; with one, a request carrying a path always names a workspace.
+func scopedWorkspacePath(r *http.Request, clientPath string) string {
+	if ws, ok := r.Context().Value("workspace").(*models.Workspace); ok {
+		return ws.Path
+	}
+	return clientPath
+}
+
+// insideWorkspace reports whether a client path points into a workspace's folder, given
+// relative to the working directory as the handlers resolve it, or absolute
+func insideWorkspace(p string, ws *models.Workspace) bool {
+	root := filepath.FromSlash(ws.Path)
+	p = filepath.Clean(filepath.FromSlash(p))
+	if filepath.IsAbs(p) {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return false
+		}
+		root = abs
+	}
+	return p == root || strings.HasPrefix(p, root+string(filepath.Separator))
+}
+
+// requestUserID returns the caller's user ID, or nil for anonymous requests
+func requestUserID(r *http.Request) *int {
+	if claims, ok := r.Context().Value("claims").(*auth.Claims); ok {
+		id := claims.UserID
+		return &id
+	}
+	return nil
+}
+
+// legacyAnonymous reports whether a request runs in legacy anonymous mode: no token
+// verifier is configured, so TokenAuth put neither a user nor an access grant in the
+// context. Once one is, anonymous callers carry a deny-all grant.
+func legacyAnonymous(r *http.Request) bool {
+	_, hasGrant := r.Context().Value("access").(*models.AccessGrant)
+	return requestUserID(r) == nil && !hasGrant
+}
+
+// canManageWorkspace reports whether the caller may archive, delete, transfer or share a
+// workspace: its owner or a user with workspaces:admin. Anonymous callers only may in
+// legacy anonymous mode.
+func canManageWorkspace(r *http.Request, ws *models.Workspace) bool {
+	userID := requestUserID(r)
+	if userID == nil {
+		return legacyAnonymous(r)
+	}
+	if ws.OwnerID != nil && *ws.OwnerID == *userID {
+		return true
+	}
+	access, ok := r.Context().Value("access").(*models.AccessGrant)
+	return ok && access.Can(models.PermWorkspacesAdmin)
+}
+
+func isWorkspaceType(value string) bool {
+	for _, t := range models.WorkspaceTypes {
+		if t == value {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeWorkspaceError maps registry errors to responses
+func writeWorkspaceError(w http.ResponseWriter, action string, err error) {
+	switch {
+	case errors.Is(err, repository.ErrWorkspaceNotFound), errors.Is(err, repository.ErrIntegrationNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, repository.ErrWorkspaceFolderTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, repository.ErrWorkspaceOwner):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("Failed to %s: %v", action, err)
+		http.Error(w, fmt.Sprintf("failed to %s: %v", action, err), http.StatusInternalServerError)
+	}
+}
+
+// loadWorkspace reads the {id} path value and loads the workspace, writing an error response
+// when it cannot
+func (h *Handler) loadWorkspace(w http.ResponseWriter, r *http.Request) (*models.Workspace, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid workspace id", http.StatusBadRequest)
+		return nil, false
+	}
+	ws, err := h.service.workspaces.Get(id)
+	if err != nil {
+		writeWorkspaceError(w, "get workspace", err)
+		return nil, false
+	}
+	return ws, true
+}
+
+// refreshWorkspaceConfig rewrites a workspace's .ubeworkspace file after a registry change
+func refreshWorkspaceConfig(ws *models.Workspace) error {
+	if ws.Path == "" || ws.MissingSince != nil {
+		return nil
+	}
+	existing, err := readWorkspaceConfig(ws.Path)
+	if err != nil {
+		return err
+	}
+	config := workspaceConfig(ws)
+	if existing != nil && existing.CreatedAt != "" {
+		config.CreatedAt = existing.CreatedAt
+	}
+	return writeWorkspaceConfig(config)
+}
+
+// HandleListWorkspaces handles GET /workspaces
+// Lists the registered workspaces the caller can see; ?archived=true includes archived ones
+func (h *Handler) HandleListWorkspaces(w http.ResponseWriter, r *http.Request) {
+	workspaces, err := h.service.workspaces.List(r.URL.Query().Get("archived") == "true")
+	if err != nil {
+		writeWorkspaceError(w, "list workspaces", err)
+		return
+	}
+
+	if access, ok := r.Context().Value("access").(*models.AccessGrant); ok {
+		visible := map[int]bool{}
+		for _, ws := range access.Workspaces {
+			visible[ws.WorkspaceID] = true
+		}
+		filtered := []models.Workspace{}
+		for _, ws := range workspaces {
+			if visible[ws.ID] {
+				filtered = append(filtered, ws)
+			}
+		}
+		workspaces = filtered
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"workspaces": workspaces})
+}
+
+// HandleCreateWorkspace handles POST /workspaces
+// Registers a workspace owned by the caller and creates its folder and .ubeworkspace file,
+// scaffolding it from a catalog template when the request names one
+func (h *Handler) HandleCreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateWorkspaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if req.FolderName == "" {
+		req.FolderName = workspaceFolderName(req.Name)
+	}
+	if !validFolderName.MatchString(req.FolderName) || strings.Trim(req.FolderName, "-") == "" {
+		http.Error(w, "folder_name may only contain letters, digits, '-' and '_'", http.StatusBadRequest)
+		return
+	}
+
+	var tmpl *templates.Template
+	var params map[string]string
+	if req.Template != nil {
+		var ok bool
+		if tmpl, params, ok = h.resolveTemplate(w, req.Template, req.Name, req.FolderName); !ok {
+			return
+		}
+		applyTemplateDefaults(&req, tmpl)
+	}
+
+	if req.WorkspaceType != "" && !isWorkspaceType(req.WorkspaceType) {
+		http.Error(w, fmt.Sprintf("unknown workspace_type: %s", req.WorkspaceType), http.StatusBadRequest)
+		return
+	}
+
+	ws, err := h.service.workspaces.Create(req, requestUserID(r))
+	if err != nil {
+		writeWorkspaceError(w, "create workspace", err)
+		return
+	}
+
+	_, _, err = ensureWorkspaceStructure(ws.Path)
+	if err == nil && tmpl != nil {
+		err = scaffoldWorkspace(tmpl, ws, params)
+	}
+	if err == nil {
+		err = refreshWorkspaceConfig(ws)
+	}
+	if err != nil {
+		// Don't leave a row behind for a folder that could not be set up
+		if delErr := h.service.workspaces.Delete(ws.ID); delErr != nil {
+			log.Printf("Failed to remove workspace %d: %v", ws.ID, delErr)
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, ws)
+}
+
+// HandleGetWorkspace handles GET /workspaces/{id}
+func (h *Handler) HandleGetWorkspace(w http.ResponseWriter, r *http.Request) {
+	ws, ok := h.loadWorkspace(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, ws)
+}
+
+// HandleUpdateWorkspace handles PUT /workspaces/{id}
+// Changes a workspace and rewrites its .ubeworkspace file; only the owner or a workspace
+// admin may change sharing
+func (h *Handler) HandleUpdateWorkspace(w http.ResponseWriter, r *http.Request) {
+	ws, ok := h.loadWorkspace(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateWorkspaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if ws.IsArchived() {
+		http.Error(w, "workspace is archived", http.StatusConflict)
+		return
+	}
+	if req.Name != nil && strings.TrimSpace(*req.Name) == "" {
+		http.Error(w, "name cannot be empty", http.StatusBadRequest)
+		return
+	}
+	if req.WorkspaceType != nil && !isWorkspaceType(*req.WorkspaceType) {
+		http.Error(w, fmt.Sprintf("unknown workspace_type: %s", *req.WorkspaceType), http.StatusBadRequest)
+		return
+	}
+	if req.IsShared != nil && *req.IsShared != ws.IsShared && !canManageWorkspace(r, ws) {
+		http.Error(w, "only the workspace owner can change sharing", http.StatusForbidden)
+		return
+	}
+	// Only the owner or a workspace admin may let the AI chat run tests; other callers'
+	// settings updates keep the setting as it is
+	if req.Settings != nil && !canManageWorkspace(r, ws) {
+		if requested, ok := (*req.Settings)[allowRunTestsSetting].(bool); ok && requested != allowsRunTests(ws) {
+			http.Error(w, "only the workspace owner can let the AI chat run tests", http.StatusForbidden)
+			return
+		}
+		delete(*req.Settings, allowRunTestsSetting)
+		if allowed, ok := ws.Settings[allowRunTestsSetting]; ok && *req.Settings != nil {
+			(*req.Settings)[allowRunTestsSetting] = allowed
+		}
+	}
+
+	ws, err := h.service.workspaces.Update(ws.ID, req)
+	if err != nil {
+		writeWorkspaceError(w, "update workspace", err)
+		return
+	}
+	if err := refreshWorkspaceConfig(ws); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ws)
+}
+
+// HandleDeleteWorkspace handles DELETE /workspaces/{id}
+// Removes a workspace from the registry. Its folder is moved to workspaces/.deleted so the
+// next reconcile does not register it again.
+func (h *Handler) HandleDeleteWorkspace(w http.ResponseWriter, r *http.Request) {
+	ws, ok := h.loadWorkspace(w, r)
+	if !ok {
+		return
+	}
+	if !canManageWorkspace(r, ws) {
+		http.Error(w, "only the workspace owner can delete it", http.StatusForbidden)
+		return
+	}
+
+	movedTo := ""
+	if _, err := os.Stat(ws.Path); ws.Path != "" && err == nil {
+		trash := filepath.Join(models.WorkspacesDir, ".deleted")
+		movedTo = filepath.Join(trash, fmt.Sprintf("%s-%d", ws.FolderName, time.Now().Unix()))
+		if err := os.MkdirAll(trash, 0755); err != nil {
+			http.Error(w, fmt.Sprintf("failed to move workspace folder: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if err := os.Rename(ws.Path, movedTo); err != nil {
+			http.Error(w, fmt.Sprintf("failed to move workspace folder: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := h.service.workspaces.Delete(ws.ID); err != nil {
+		writeWorkspaceError(w, "delete workspace", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"moved_to": movedTo,
+	})
+}
+
+// HandleArchiveWorkspace handles POST /workspaces/{id}/archive
+func (h *Handler) HandleArchiveWorkspace(w http.ResponseWriter, r *http.Request) {
+	h.setArchived(w, r, true)
+}
+
+// HandleRestoreWorkspace handles POST /workspaces/{id}/restore
+func (h *Handler) HandleRestoreWorkspace(w http.ResponseWriter, r *http.Request) {
+	h.setArchived(w, r, false)
+}
+
+func (h *Handler) setArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	ws, ok := h.loadWorkspace(w, r)
+	if !ok {
+		return
+	}
+	if !canManageWorkspace(r, ws) {
+		http.Error(w, "only the workspace owner can archive or restore it", http.StatusForbidden)
+		return
+	}
+
+	ws, err := h.service.workspaces.SetArchived(ws.ID, archived, requestUserID(r))
+	if err != nil {
+		writeWorkspaceError(w, "archive workspace", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ws)
+}
+
+// HandleTransferWorkspace handles PUT /workspaces/{id}/owner
+func (h *Handler) HandleTransferWorkspace(w http.ResponseWriter, r *http.Request) {
+	ws, ok := h.loadWorkspace(w, r)
+	if !ok {
+		return
+	}
+	if !canManageWorkspace(r, ws) {
+		http.Error(w, "only the workspace owner can transfer it", http.StatusForbidden)
+		return
+	}
+
+	var req models.TransferWorkspaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.OwnerID <= 0 {
+		http.Error(w, "owner_id is required", http.StatusBadRequest)
+		return
+	}
+
+	ws, err := h.service.workspaces.TransferOwnership(ws.ID, req.OwnerID)
+	if err != nil {
+		writeWorkspaceError(w, "transfer workspace", err)
+		return
+	}
+	if err := refreshWorkspaceConfig(ws); err != nil {
+		log.Printf("Failed to update %s for workspace %d: %v", workspaceConfigFile, ws.ID, err)
+	}
+	writeJSON(w, http.StatusOK, ws)
+}
+
+// HandleListWorkspaceIntegrations handles GET /workspaces/{id}/integrations
+func (h *Handler) HandleListWorkspaceIntegrations(w http.ResponseWriter, r *http.Request) {
+	ws, ok := h.loadWorkspace(w, r)
+	if !ok {
+		return
+	}
+	links, err := h.service.workspaces.ListIntegrations(ws.ID)
+	if err != nil {
+		writeWorkspaceError(w, "list workspace integrations", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"integrations": links})
+}
+
+// HandleLinkWorkspaceIntegration handles POST /workspaces/{id}/integrations
+// Links an integration resource (a Figma file, GitHub repository, Jira project, ...) to the
+// workspace, or updates the existing link to it
+func (h *Handler) HandleLinkWorkspaceIntegration(w http.ResponseWriter, r *http.Request) {
+	ws, ok := h.loadWorkspace(w, r)
+	if !ok {
+		return
+	}
+	if ws.IsArchived() {
+		http.Error(w, "workspace is archived", http.StatusConflict)
+		return
+	}
+
+	var req models.WorkspaceIntegrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.IntegrationName == "" || req.ResourceType == "" || req.ResourceID == "" {
+		http.Error(w, "integration_name, resource_type and resource_id are required", http.StatusBadRequest)
+		return
+	}
+
+	link, err := h.service.workspaces.LinkIntegration(ws.ID, req, requestUserID(r))
+	if err != nil {
+		writeWorkspaceError(w, "link integration", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, link)
+}
+
+// HandleUnlinkWorkspaceIntegration handles DELETE /workspaces/{id}/integrations/{linkId}
+func (h *Handler) HandleUnlinkWorkspaceIntegration(w http.ResponseWriter, r *http.Request) {
+	ws, ok := h.loadWorkspace(w, r)
+	if !ok {
+		return
+	}
+	if ws.IsArchived() {
+		http.Error(w, "workspace is archived", http.StatusConflict)
+		return
+	}
+	linkID, err := strconv.Atoi(r.PathValue("linkId"))
+	if err != nil {
+		http.Error(w, "invalid integration link id", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.workspaces.UnlinkIntegration(ws.ID, linkID); err != nil {
+		writeWorkspaceError(w, "unlink integration", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// HandleReconcileWorkspaces handles POST /workspaces/reconcile (workspace admins only)
+func (h *Handler) HandleReconcileWorkspaces(w http.ResponseWriter, r *http.Request) {
+	if access, ok := r.Context().Value("access").(*models.AccessGrant); ok && !access.Can(models.PermWorkspacesAdmin) {
+		http.Error(w, fmt.Sprintf("missing permission: %s", models.PermWorkspacesAdmin), http.StatusForbidden)
+		return
+	}
+
+	result, err := h.service.ReconcileWorkspaces()
+	if err != nil {
+		writeWorkspaceError(w, "reconcile workspaces", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
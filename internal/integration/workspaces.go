@@ -0,0 +1,362 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/jareynolds/ubecode/pkg/repository"
+	"github.com/jareynolds/ubecode/pkg/templates"
+)
+
+// workspaceConfigFile is the file in each workspace folder describing the workspace
+const workspaceConfigFile = ".ubeworkspace"
+
+var errWorkspaceRegistryDisabled = errors.New("workspace registry is not configured")
+
+var (
+	unsafeFolderChars = regexp.MustCompile(`[^a-zA-Z0-9-_]`)
+	repeatedDashes    = regexp.MustCompile(`-+`)
+	validFolderName   = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// workspaceFolderName derives a folder from a workspace name the same way the web UI does
+func workspaceFolderName(name string) string {
+	return repeatedDashes.ReplaceAllString(unsafeFolderChars.ReplaceAllString(name, "-"), "-")
+}
+
+// EnableWorkspaceRegistry keeps the workspaces table in step with the workspace folders
+func (s *Service) EnableWorkspaceRegistry(repo *repository.WorkspaceRepository) {
+	s.workspaces = repo
+}
+
+// readWorkspaceConfig reads a folder's .ubeworkspace file; it returns nil when there is none
+func readWorkspaceConfig(folderPath string) (*WorkspaceConfig, error) {
+	data, err := os.ReadFile(filepath.Join(folderPath, workspaceConfigFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var config WorkspaceConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", workspaceConfigFile, err)
+	}
+	return &config, nil
+}
+
+// writeWorkspaceConfig writes a .ubeworkspace file into the config's project folder
+func writeWorkspaceConfig(config WorkspaceConfig) error {
+	if config.Version == "" {
+		config.Version = "1.0"
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(config.ProjectFolder, workspaceConfigFile), data, 0644); err != nil {
+		return fmt.Errorf("failed to write config file: %v", err)
+	}
+	return nil
+}
+
+// workspaceSettings collects the .ubeworkspace fields the workspaces table has no column for
+func workspaceSettings(config *WorkspaceConfig) map[string]interface{} {
+	settings := map[string]interface{}{}
+	if config.FigmaTeamURL != "" {
+		settings["figmaTeamUrl"] = config.FigmaTeamURL
+	}
+	if config.ActiveAIPreset != 0 {
+		settings["activeAIPreset"] = config.ActiveAIPreset
+	}
+	if config.SelectedUIFramework != "" {
+		settings["selectedUIFramework"] = config.SelectedUIFramework
+	}
+	if config.SelectedUILayout != "" {
+		settings["selectedUILayout"] = config.SelectedUILayout
+	}
+	if len(config.CustomSettings) > 0 {
+		settings["customSettings"] = config.CustomSettings
+	}
+	if config.Template != nil {
+		settings["template"] = map[string]interface{}{"id": config.Template.ID, "version": config.Template.Version}
+	}
+	return settings
+}
+
+// workspaceConfig renders a registered workspace as its .ubeworkspace file
+func workspaceConfig(ws *models.Workspace) WorkspaceConfig {
+	config := WorkspaceConfig{
+		ID:            ws.ConfigID,
+		Name:          ws.Name,
+		Description:   ws.Description,
+		WorkspaceType: ws.WorkspaceType,
+		ProjectFolder: ws.Path,
+		OwnerID:       ws.OwnerEmail,
+		OwnerName:     ws.OwnerName,
+		IsShared:      ws.IsShared,
+		CreatedAt:     ws.CreatedAt.UTC().Format(time.RFC3339),
+		UpdatedAt:     ws.UpdatedAt.UTC().Format(time.RFC3339),
+		Version:       "1.0",
+	}
+	if config.ID == "" {
+		config.ID = "workspace-" + strconv.Itoa(ws.ID)
+	}
+
+	config.FigmaTeamURL, _ = ws.Settings["figmaTeamUrl"].(string)
+	config.SelectedUIFramework, _ = ws.Settings["selectedUIFramework"].(string)
+	config.SelectedUILayout, _ = ws.Settings["selectedUILayout"].(string)
+	switch preset := ws.Settings["activeAIPreset"].(type) {
+	case float64: // Settings read back from JSONB
+		config.ActiveAIPreset = int(preset)
+	case int:
+		config.ActiveAIPreset = preset
+	}
+	if custom, ok := ws.Settings["customSettings"].(map[string]interface{}); ok {
+		config.CustomSettings = custom
+	}
+	if ref, ok := ws.Settings["template"].(map[string]interface{}); ok {
+		config.Template = &templates.Ref{}
+		config.Template.ID, _ = ref["id"].(string)
+		config.Template.Version, _ = ref["version"].(string)
+	}
+	return config
+}
+
+// syncWorkspaceConfig copies a .ubeworkspace file into its registry row. It returns the row
+// and whether it changed.
+func (s *Service) syncWorkspaceConfig(ws *models.Workspace, config *WorkspaceConfig) (*models.Workspace, bool, error) {
+	name := config.Name
+	if name == "" {
+		name = ws.Name
+	}
+	workspaceType := config.WorkspaceType
+	if workspaceType == "" {
+		workspaceType = ws.WorkspaceType
+	}
+
+	// Registry-only settings are not in the file and must survive the sync
+	settings := workspaceSettings(config)
+	if allowed, ok := ws.Settings[allowRunTestsSetting]; ok {
+		settings[allowRunTestsSetting] = allowed
+	}
+
+	changed, err := s.workspaces.SyncFromConfig(ws.ID, name, config.Description, workspaceType,
+		config.ID, config.IsShared, settings)
+	if err != nil || !changed {
+		return ws, changed, err
+	}
+	ws, err = s.workspaces.Get(ws.ID)
+	return ws, true, err
+}
+
+// registerWorkspaceFolder adds an existing folder to the registry, taking its name and
+// settings from the folder's .ubeworkspace file when it has one
+func (s *Service) registerWorkspaceFolder(folder string, config *WorkspaceConfig, ownerID *int) (*models.Workspace, error) {
+	req := models.CreateWorkspaceRequest{Name: folder, FolderName: folder}
+	if config != nil {
+		if config.Name != "" {
+			req.Name = config.Name
+		}
+		req.Description = config.Description
+		req.WorkspaceType = config.WorkspaceType
+		req.IsShared = config.IsShared
+		req.ConfigID = config.ID
+		req.Settings = workspaceSettings(config)
+
+		// The web UI records owners by email
+		if ownerID == nil && strings.Contains(config.OwnerID, "@") {
+			id, err := s.workspaces.UserIDByEmail(config.OwnerID)
+			if err != nil {
+				return nil, err
+			}
+			ownerID = id
+		}
+	}
+
+	ws, err := s.workspaces.Create(req, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		if err := writeWorkspaceConfig(workspaceConfig(ws)); err != nil {
+			return nil, err
+		}
+	}
+	return ws, nil
+}
+
+// ReconcileWorkspaces brings the registry in line with the folders under workspaces/.
+// .ubeworkspace files win for names, descriptions, types, sharing and settings; the
+// registry owns ownership, archival, membership and integration links. Folders without a
+// row are registered, rows without a folder are marked missing, and rows registered
+// without a folder get one.
+func (s *Service) ReconcileWorkspaces() (*models.WorkspaceReconcileResult, error) {
+	if s.workspaces == nil {
+		return nil, errWorkspaceRegistryDisabled
+	}
+	s.reconcileMu.Lock()
+	defer s.reconcileMu.Unlock()
+
+	result := &models.WorkspaceReconcileResult{
+		Registered: []string{},
+		Updated:    []string{},
+		Created:    []string{},
+		Missing:    []string{},
+		Restored:   []string{},
+	}
+	fail := func(folder string, err error) {
+		result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", folder, err))
+	}
+
+	rows, err := s.workspaces.List(true)
+	if err != nil {
+		return nil, err
+	}
+	byFolder := map[string]*models.Workspace{}
+	for i := range rows {
+		if rows[i].FolderName != "" {
+			byFolder[rows[i].FolderName] = &rows[i]
+		}
+	}
+
+	entries, err := os.ReadDir(models.WorkspacesDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read workspaces directory: %v", err)
+	}
+
+	onDisk := map[string]bool{}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		folder := entry.Name()
+		onDisk[folder] = true
+		folderPath := filepath.Join(models.WorkspacesDir, folder)
+
+		config, err := readWorkspaceConfig(folderPath)
+		if err != nil {
+			// Leave a broken file for someone to fix rather than overwrite it
+			fail(folder, err)
+			continue
+		}
+
+		ws, registered := byFolder[folder]
+		if !registered {
+			if _, err := s.registerWorkspaceFolder(folder, config, nil); err != nil {
+				fail(folder, err)
+				continue
+			}
+			result.Registered = append(result.Registered, folder)
+			continue
+		}
+
+		wasMissing := ws.MissingSince != nil
+		changed := false
+		if config != nil {
+			_, changed, err = s.syncWorkspaceConfig(ws, config)
+		} else {
+			if _, err = s.workspaces.SetMissing(ws.ID, false); err == nil {
+				err = writeWorkspaceConfig(workspaceConfig(ws))
+			}
+		}
+		switch {
+		case err != nil:
+			fail(folder, err)
+		case wasMissing:
+			result.Restored = append(result.Restored, folder)
+		case changed:
+			result.Updated = append(result.Updated, folder)
+		}
+	}
+
+	for i := range rows {
+		ws := &rows[i]
+		if ws.FolderName == "" {
+			folder, err := s.assignWorkspaceFolder(ws)
+			if err != nil {
+				fail(ws.Name, err)
+				continue
+			}
+			result.Created = append(result.Created, folder)
+			continue
+		}
+		if onDisk[ws.FolderName] {
+			continue
+		}
+		if _, err := s.workspaces.SetMissing(ws.ID, true); err != nil {
+			fail(ws.FolderName, err)
+			continue
+		}
+		result.Missing = append(result.Missing, ws.FolderName)
+	}
+
+	return result, nil
+}
+
+// assignWorkspaceFolder gives a workspace registered without a folder one derived from its
+// name, creating the folder structure and .ubeworkspace file
+func (s *Service) assignWorkspaceFolder(ws *models.Workspace) (string, error) {
+	base := workspaceFolderName(ws.Name)
+	if strings.Trim(base, "-") == "" {
+		base = "workspace-" + strconv.Itoa(ws.ID)
+	}
+
+	folder := base
+	for i := 2; ; i++ {
+		_, statErr := os.Stat(filepath.Join(models.WorkspacesDir, folder))
+		if os.IsNotExist(statErr) {
+			err := s.workspaces.SetFolder(ws.ID, folder)
+			if err == nil {
+				break
+			}
+			if !errors.Is(err, repository.ErrWorkspaceFolderTaken) {
+				return "", err
+			}
+		}
+		folder = fmt.Sprintf("%s-%d", base, i)
+	}
+
+	ws, err := s.workspaces.Get(ws.ID)
+	if err != nil {
+		return "", err
+	}
+	if _, _, err := ensureWorkspaceStructure(ws.Path); err != nil {
+		return "", err
+	}
+	if err := writeWorkspaceConfig(workspaceConfig(ws)); err != nil {
+		return "", err
+	}
+	return folder, nil
+}
+
+// SyncWorkspaceRegistry reconciles the registry and logs the outcome, for use at startup
+func (s *Service) SyncWorkspaceRegistry() {
+	result, err := s.ReconcileWorkspaces()
+	if err != nil {
+		log.Printf("Failed to reconcile workspaces: %v", err)
+		return
+	}
+	log.Printf("Workspace registry reconciled: %d registered, %d updated, %d created, %d missing, %d restored",
+		len(result.Registered), len(result.Updated), len(result.Created), len(result.Missing), len(result.Restored))
+	for _, e := range result.Errors {
+		log.Printf("Workspace reconcile error: %s", e)
+	}
+}
@@ -0,0 +1,248 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jareynolds/ubecode/internal/auth"
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/jareynolds/ubecode/pkg/repository"
+	"github.com/jareynolds/ubecode/pkg/templates"
+)
+
+func TestWorkspaceFolderName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Default Workspace", "Default-Workspace"},
+		{"Acme: Billing & Payments", "Acme-Billing-Payments"},
+		{"already_safe-name", "already_safe-name"},
+		{"Café", "Caf-"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := workspaceFolderName(tt.name); got != tt.want {
+				t.Errorf("workspaceFolderName(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkspaceConfigRoundTrip(t *testing.T) {
+	config := &WorkspaceConfig{
+		ID:                  "workspace-1700000000000",
+		Name:                "Acme",
+		WorkspaceType:       "refactor",
+		FigmaTeamURL:        "https://www.figma.com/files/team/1",
+		ActiveAIPreset:      3,
+		SelectedUIFramework: "tailwind",
+		CustomSettings:      map[string]interface{}{"theme": "dark"},
+		Template:            &templates.Ref{ID: "starter", Version: "1.0.0"},
+	}
+
+	// Settings are stored as JSONB, so numbers come back as float64
+	data, err := json.Marshal(workspaceSettings(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var settings map[string]interface{}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		t.Fatal(err)
+	}
+
+	owner := 7
+	ws := &models.Workspace{
+		ID: 1, Name: config.Name, FolderName: "acme", Path: "workspaces/acme",
+		WorkspaceType: config.WorkspaceType, ConfigID: config.ID, OwnerID: &owner,
+		OwnerEmail: "ada@example.com", Settings: settings, CreatedAt: time.Now(), UpdatedAt: time.Now(),
+	}
+	got := workspaceConfig(ws)
+
+	if got.ID != config.ID || got.ProjectFolder != "workspaces/acme" || got.OwnerID != "ada@example.com" {
+		t.Errorf("unexpected identity fields: %+v", got)
+	}
+	if got.FigmaTeamURL != config.FigmaTeamURL || got.ActiveAIPreset != 3 || got.SelectedUIFramework != "tailwind" {
+		t.Errorf("settings not restored: %+v", got)
+	}
+	if !reflect.DeepEqual(got.CustomSettings, config.CustomSettings) {
+		t.Errorf("customSettings = %v, want %v", got.CustomSettings, config.CustomSettings)
+	}
+	if got.Template == nil || *got.Template != *config.Template {
+		t.Errorf("template = %v, want %v", got.Template, config.Template)
+	}
+
+	ws.ConfigID = ""
+	if id := workspaceConfig(ws).ID; id != "workspace-1" {
+		t.Errorf("expected a generated config id, got %q", id)
+	}
+}
+
+func TestApplyTemplateDefaults(t *testing.T) {
+	tmpl := &templates.Template{Manifest: templates.Manifest{
+		ID: "starter", Version: "1.0.0",
+		Workspace: templates.WorkspaceDefaults{
+			WorkspaceType: "new", Description: "From the template", AIPreset: 3,
+			UIFramework: "tailwind", CustomSettings: map[string]interface{}{"theme": "dark"},
+		},
+	}}
+	req := models.CreateWorkspaceRequest{
+		Name:          "Acme",
+		WorkspaceType: "refactor",
+		Settings:      map[string]interface{}{"selectedUIFramework": "bootstrap"},
+	}
+
+	applyTemplateDefaults(&req, tmpl)
+
+	if req.WorkspaceType != "refactor" || req.Description != "From the template" {
+		t.Errorf("request fields should win over template defaults: %+v", req)
+	}
+	want := map[string]interface{}{
+		"activeAIPreset":      3,
+		"selectedUIFramework": "bootstrap",
+		"customSettings":      map[string]interface{}{"theme": "dark"},
+		"template":            map[string]interface{}{"id": "starter", "version": "1.0.0"},
+	}
+	if !reflect.DeepEqual(req.Settings, want) {
+		t.Errorf("settings = %v, want %v", req.Settings, want)
+	}
+}
+
+type fakeRegistry map[int]*models.Workspace
+
+func (f fakeRegistry) Get(id int) (*models.Workspace, error) {
+	if ws, ok := f[id]; ok {
+		return ws, nil
+	}
+	return nil, repository.ErrWorkspaceNotFound
+}
+
+func (f fakeRegistry) GetByFolder(folder string) (*models.Workspace, error) {
+	for _, ws := range f {
+		if ws.FolderName == folder {
+			return ws, nil
+		}
+	}
+	return nil, repository.ErrWorkspaceNotFound
+}
+
+func TestWorkspaceScope(t *testing.T) {
+	archivedAt := time.Now()
+	registry := fakeRegistry{
+		1: {ID: 1, Name: "Acme", FolderName: "acme", Path: "workspaces/acme"},
+		2: {ID: 2, Name: "Old", FolderName: "old", Path: "workspaces/old", ArchivedAt: &archivedAt},
+		3: {ID: 3, Name: "Pending"},
+	}
+
+	var resolved string
+	handler := WorkspaceScope(registry, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resolved = scopedWorkspacePath(r, "/etc")
+		if _, ok := r.Context().Value("workspace").(*models.Workspace); !ok {
+			resolved = ""
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name     string
+		path     string
+		body     string
+		expected int
+		resolved string
+	}{
+		{"workspace id", "/capability-files", `{"workspaceId":1}`, http.StatusOK, "workspaces/acme"},
+		{"workspace id as string", "/capability-files", `{"workspaceId":"1"}`, http.StatusOK, "workspaces/acme"},
+		{"workspace id in query", "/workspace-events?workspaceId=1", "", http.StatusOK, "workspaces/acme"},
+		{"registered path without id", "/capability-files", `{"workspacePath":"workspaces/acme"}`, http.StatusOK, "workspaces/acme"},
+		{"registered path with path outside", "/read-specification", `{"workspacePath":"workspaces/acme","path":"/etc/passwd"}`, http.StatusBadRequest, ""},
+		{"registered path with two folders", "/read-specification", `{"workspacePath":"workspaces/acme","path":"workspaces/old/CAP-1.md"}`, http.StatusBadRequest, ""},
+		{"unregistered folder", "/capability-files", `{"workspacePath":"workspaces/scratch"}`, http.StatusBadRequest, ""},
+		{"write archived by path", "/save-capability", `{"path":"workspaces/old/CAP-1.md"}`, http.StatusConflict, ""},
+		{"root path without id", "/capability-files", `{"workspacePath":"/"}`, http.StatusBadRequest, ""},
+		{"id with path inside", "/read-specification", `{"workspaceId":1,"path":"workspaces/acme/specifications/CAP-1.md"}`, http.StatusOK, "workspaces/acme"},
+		{"id with path outside", "/read-specification", `{"workspaceId":1,"path":"workspaces/old/specifications/CAP-1.md"}`, http.StatusBadRequest, ""},
+		{"id with root path", "/capability-files", `{"workspaceId":1,"workspacePath":"/"}`, http.StatusBadRequest, ""},
+		{"id with system path", "/capability-files?workspaceId=1&workspacePath=/etc", "", http.StatusBadRequest, ""},
+		{"id with traversal", "/read-specification", `{"workspaceId":1,"path":"workspaces/acme/../old/CAP-1.md"}`, http.StatusBadRequest, ""},
+		{"id with sibling prefix", "/read-specification", `{"workspaceId":1,"path":"workspaces/acme-old/CAP-1.md"}`, http.StatusBadRequest, ""},
+		{"subfolder traversal", "/read-specification", `{"workspaceId":1,"subfolder":"../old","fileName":"CAP-1.md"}`, http.StatusBadRequest, ""},
+		{"file name traversal", "/save-specifications", `{"workspaceId":1,"files":[{"fileName":"../../etc/passwd"}]}`, http.StatusBadRequest, ""},
+		{"file name inside", "/save-specifications", `{"workspaceId":1,"subfolder":"specifications","files":[{"fileName":"CAP-1.md"}]}`, http.StatusOK, "workspaces/acme"},
+		{"unknown id", "/capability-files", `{"workspaceId":9}`, http.StatusNotFound, ""},
+		{"invalid id", "/capability-files", `{"workspaceId":"acme"}`, http.StatusBadRequest, ""},
+		{"workspace without folder", "/capability-files", `{"workspaceId":3}`, http.StatusConflict, ""},
+		{"read archived", "/capability-files", `{"workspaceId":2}`, http.StatusOK, "workspaces/old"},
+		{"write archived", "/save-capability", `{"workspaceId":2,"path":"workspaces/old/CAP-1.md"}`, http.StatusConflict, ""},
+		{"no workspace", "/analyze-integration", `{}`, http.StatusOK, ""},
+		{"registry endpoints pass through", "/workspaces/9/archive", "", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved = ""
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.expected {
+				t.Errorf("expected status %d, got %d (%s)", tt.expected, rec.Code, strings.TrimSpace(rec.Body.String()))
+			}
+			if resolved != tt.resolved {
+				t.Errorf("resolved workspace path %q, want %q", resolved, tt.resolved)
+			}
+		})
+	}
+}
+
+func TestCanManageWorkspace(t *testing.T) {
+	owner := 7
+	ws := &models.Workspace{ID: 1, OwnerID: &owner}
+
+	tests := []struct {
+		name     string
+		claims   *auth.Claims
+		access   *models.AccessGrant
+		expected bool
+	}{
+		{"legacy anonymous", nil, nil, true},
+		{"anonymous with deny-all grant", nil, &models.AccessGrant{}, false},
+		{"owner", &auth.Claims{UserID: 7}, &models.AccessGrant{}, true},
+		{"other user", &auth.Claims{UserID: 8}, &models.AccessGrant{}, false},
+		{"admin", &auth.Claims{UserID: 8}, &models.AccessGrant{Permissions: []string{models.PermWorkspacesAdmin}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.claims != nil {
+				ctx = context.WithValue(ctx, "claims", tt.claims)
+			}
+			if tt.access != nil {
+				ctx = context.WithValue(ctx, "access", tt.access)
+			}
+			r := httptest.NewRequest("POST", "/workspaces/1/archive", nil).WithContext(ctx)
+			if got := canManageWorkspace(r, ws); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+			wantAdmin := tt.name == "admin" || tt.name == "legacy anonymous"
+			if got := isUsageAdmin(r); got != wantAdmin {
+				t.Errorf("expected usage admin %v, got %v", wantAdmin, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+-- Create notifications table (in-app inbox)
+CREATE TABLE IF NOT EXISTS notifications (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event_type VARCHAR(100) NOT NULL, -- 'approval_requested', 'approval_decided', 'criteria_failed', 'ai_generation_finished', 'approval_digest'
+    title VARCHAR(500) NOT NULL,
+    body TEXT,
+    link VARCHAR(500), -- Frontend route the notification points to
+    entity_type VARCHAR(50), -- 'capability', 'enabler', 'approval', 'workspace'
+    entity_id INTEGER,
+    metadata JSONB,
+    read_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create notification_preferences table (per user, per event type)
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event_type VARCHAR(100) NOT NULL,
+    in_app_enabled BOOLEAN DEFAULT TRUE,
+    email_enabled BOOLEAN DEFAULT TRUE,
+    slack_enabled BOOLEAN DEFAULT FALSE,
+    teams_enabled BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, event_type)
+);
+
+-- Create notification_templates table (overrides for the built-in templates)
+CREATE TABLE IF NOT EXISTS notification_templates (
+    id SERIAL PRIMARY KEY,
+    event_type VARCHAR(100) NOT NULL,
+    channel VARCHAR(50) NOT NULL DEFAULT 'default', -- 'default', 'email', 'slack', 'teams', 'in_app'
+    subject_template TEXT NOT NULL,
+    body_template TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(event_type, channel)
+);
+
+-- Create indexes for better performance
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications(user_id);
+CREATE INDEX IF NOT EXISTS idx_notifications_user_unread ON notifications(user_id) WHERE read_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_notifications_event_type ON notifications(event_type);
+CREATE INDEX IF NOT EXISTS idx_notifications_created_at ON notifications(created_at);
+CREATE INDEX IF NOT EXISTS idx_notification_preferences_user_id ON notification_preferences(user_id);
+
+-- Create triggers for updated_at
+DROP TRIGGER IF EXISTS update_notification_preferences_updated_at ON notification_preferences;
+CREATE TRIGGER update_notification_preferences_updated_at
+    BEFORE UPDATE ON notification_preferences
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+DROP TRIGGER IF EXISTS update_notification_templates_updated_at ON notification_templates;
+CREATE TRIGGER update_notification_templates_updated_at
+    BEFORE UPDATE ON notification_templates
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Add comments for documentation
+COMMENT ON TABLE notifications IS 'In-app notification inbox with read state';
+COMMENT ON TABLE notification_preferences IS 'Per-user channel preferences for each notification event type';
+COMMENT ON TABLE notification_templates IS 'Optional overrides for the built-in notification subject/body templates (Go text/template syntax)';
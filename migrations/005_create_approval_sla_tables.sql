@@ -0,0 +1,44 @@
+-- Create approval_sla_rules table (one SLA definition per workflow stage)
+CREATE TABLE IF NOT EXISTS approval_sla_rules (
+    id SERIAL PRIMARY KEY,
+    stage VARCHAR(50) NOT NULL UNIQUE, -- specification, definition, design, execution
+    sla_hours INTEGER NOT NULL, -- Approval is overdue once it has been pending this long
+    reminder_hours INTEGER[] NOT NULL DEFAULT '{}', -- Send a reminder to approvers at each of these ages
+    escalation_role VARCHAR(50), -- Fallback role notified and recorded when the SLA is breached
+    escalation_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL, -- Fallback user, takes precedence over role
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+DROP TRIGGER IF EXISTS update_approval_sla_rules_updated_at ON approval_sla_rules;
+CREATE TRIGGER update_approval_sla_rules_updated_at
+    BEFORE UPDATE ON approval_sla_rules
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Default SLAs; execution approvals escalate to admins after five days
+INSERT INTO approval_sla_rules (stage, sla_hours, reminder_hours, escalation_role)
+VALUES
+    ('specification', 72, '{24,48}', 'product_owner'),
+    ('definition', 72, '{24,48}', 'product_owner'),
+    ('design', 72, '{24,48}', 'product_owner'),
+    ('execution', 120, '{24,72,96}', 'admin')
+ON CONFLICT (stage) DO NOTHING;
+
+-- Track reminder and escalation state on each approval
+ALTER TABLE capability_approvals
+    ADD COLUMN IF NOT EXISTS reminders_sent INTEGER DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS last_reminder_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS escalated_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS escalated_to_role VARCHAR(50),
+    ADD COLUMN IF NOT EXISTS escalated_to_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_capability_approvals_requested_at ON capability_approvals(requested_at);
+
+-- Escalations are performed by the scheduler rather than a user
+ALTER TABLE approval_audit_log ALTER COLUMN performed_by DROP NOT NULL;
+
+-- Add comments for documentation
+COMMENT ON TABLE approval_sla_rules IS 'Per-stage approval SLAs, reminder thresholds and escalation targets';
+COMMENT ON COLUMN approval_audit_log.action IS 'requested, approved, rejected, withdrawn or escalated';
@@ -0,0 +1,36 @@
+-- Create stage_gate_rules table (readiness conditions a capability must meet for a stage)
+CREATE TABLE IF NOT EXISTS stage_gate_rules (
+    id SERIAL PRIMARY KEY,
+    stage VARCHAR(50) NOT NULL, -- specification, definition, design, execution
+    check_type VARCHAR(50) NOT NULL, -- 'valid_transition', 'min_enablers', 'must_criteria_written', 'ui_assets_linked', 'must_criteria_passed'
+    description TEXT,
+    params JSONB DEFAULT '{}', -- Check-specific parameters, e.g. {"min_count": 1}
+    applies_to VARCHAR(20) NOT NULL DEFAULT 'both', -- 'request', 'approval', or 'both'
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(stage, check_type)
+);
+
+CREATE INDEX IF NOT EXISTS idx_stage_gate_rules_stage ON stage_gate_rules(stage);
+
+DROP TRIGGER IF EXISTS update_stage_gate_rules_updated_at ON stage_gate_rules;
+CREATE TRIGGER update_stage_gate_rules_updated_at
+    BEFORE UPDATE ON stage_gate_rules
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Default SAWai gates
+INSERT INTO stage_gate_rules (stage, check_type, description, params, applies_to)
+VALUES
+    ('definition', 'valid_transition', 'Specification must be approved before entering Definition', '{}', 'request'),
+    ('definition', 'min_enablers', 'At least one enabler is defined', '{"min_count": 1}', 'both'),
+    ('definition', 'must_criteria_written', 'All must-priority acceptance criteria are written', '{"min_count": 1}', 'both'),
+    ('design', 'valid_transition', 'Definition must be approved before entering Design', '{}', 'request'),
+    ('design', 'ui_assets_linked', 'UI design assets are linked to the capability', '{"min_count": 1}', 'both'),
+    ('execution', 'valid_transition', 'Design must be approved before entering Execution', '{}', 'request'),
+    ('execution', 'must_criteria_passed', 'All must-priority acceptance criteria have passed', '{}', 'approval')
+ON CONFLICT (stage, check_type) DO NOTHING;
+
+-- Add comments for documentation
+COMMENT ON TABLE stage_gate_rules IS 'Configurable readiness checks evaluated before approval requests and decisions';
@@ -0,0 +1,41 @@
+-- Create search_documents table (unified full-text index over spec files and database records)
+CREATE TABLE IF NOT EXISTS search_documents (
+    id SERIAL PRIMARY KEY,
+    source VARCHAR(20) NOT NULL, -- 'spec' (workspace markdown file) or 'db' (capability, enabler, requirement, criteria)
+    doc_type VARCHAR(50) NOT NULL, -- capability, enabler, requirement, criteria, story, epic, theme, feature, ...
+    ref VARCHAR(1000) NOT NULL, -- Workspace-relative file path for specs, '<doc_type>:<id>' for records
+    record_id INTEGER, -- Primary key of the source row for db documents
+    workspace VARCHAR(255),
+    external_id VARCHAR(100), -- e.g. CAP-582341, ENB-123, FR-1, AC-7
+    title TEXT NOT NULL DEFAULT '',
+    body TEXT NOT NULL DEFAULT '',
+    status VARCHAR(100),
+    stage VARCHAR(50),
+    priority VARCHAR(50),
+    owner VARCHAR(255),
+    metadata JSONB DEFAULT '{}',
+    search_vector TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('english'::regconfig, coalesce(title, '')), 'A') ||
+        setweight(to_tsvector('english'::regconfig, coalesce(external_id, '') || ' ' || coalesce(doc_type, '')), 'B') ||
+        setweight(to_tsvector('english'::regconfig, coalesce(body, '')), 'C')
+    ) STORED,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(source, ref)
+);
+
+CREATE INDEX IF NOT EXISTS idx_search_documents_search_vector ON search_documents USING GIN(search_vector);
+CREATE INDEX IF NOT EXISTS idx_search_documents_doc_type ON search_documents(doc_type);
+CREATE INDEX IF NOT EXISTS idx_search_documents_workspace ON search_documents(workspace);
+CREATE INDEX IF NOT EXISTS idx_search_documents_status ON search_documents(status);
+CREATE INDEX IF NOT EXISTS idx_search_documents_stage ON search_documents(stage);
+
+DROP TRIGGER IF EXISTS update_search_documents_updated_at ON search_documents;
+CREATE TRIGGER update_search_documents_updated_at
+    BEFORE UPDATE ON search_documents
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Add comments for documentation
+COMMENT ON TABLE search_documents IS 'Full-text search index over workspace spec files and capability/enabler/requirement/criteria records';
+COMMENT ON COLUMN search_documents.search_vector IS 'Weighted tsvector: title (A), identifiers (B), body (C)';
@@ -0,0 +1,46 @@
+-- Migration: Refresh-token sessions and access token revocation
+-- Extends the placeholder sessions table from init-db.sql so each login becomes a session
+-- holding a rotating, hashed refresh token, and adds a revocation list for access tokens.
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    is_active BOOLEAN DEFAULT true
+);
+
+ALTER TABLE sessions
+    ADD COLUMN IF NOT EXISTS session_id VARCHAR(64), -- Public identifier, carried in access tokens as the "sid" claim
+    ADD COLUMN IF NOT EXISTS previous_token_hash VARCHAR(255), -- Last rotated-out refresh token, used to detect reuse
+    ADD COLUMN IF NOT EXISTS user_agent TEXT,
+    ADD COLUMN IF NOT EXISTS ip_address VARCHAR(64),
+    ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS revoked_reason VARCHAR(100);
+
+-- Placeholder rows from before this migration cannot be refreshed
+UPDATE sessions SET session_id = 'legacy-' || id, is_active = false, revoked_at = CURRENT_TIMESTAMP, revoked_reason = 'migration'
+WHERE session_id IS NULL;
+
+ALTER TABLE sessions ALTER COLUMN session_id SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_session_id ON sessions(session_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_token_hash_unique ON sessions(token_hash);
+CREATE INDEX IF NOT EXISTS idx_sessions_previous_token_hash ON sessions(previous_token_hash);
+CREATE INDEX IF NOT EXISTS idx_sessions_active ON sessions(user_id) WHERE is_active = true;
+
+-- Revoked access tokens (by jti) that have not yet expired
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL, -- Entry can be purged once the token would have expired anyway
+    revoked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens(expires_at);
+
+-- Add comments for documentation
+COMMENT ON TABLE sessions IS 'Login sessions with rotating hashed refresh tokens; revoking a session invalidates its access tokens';
+COMMENT ON TABLE revoked_tokens IS 'Access token IDs (jti) revoked before their expiry';
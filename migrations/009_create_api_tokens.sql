@@ -0,0 +1,31 @@
+-- Migration: Personal access tokens and service accounts
+-- Lets users and CI pipelines call the services with scoped, expiring tokens instead of a
+-- browser session. Service accounts are non-human users that cannot log in interactively.
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS is_service_account BOOLEAN DEFAULT false,
+    ADD COLUMN IF NOT EXISTS created_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_users_service_account ON users(is_service_account) WHERE is_service_account = true;
+
+-- Tokens are shown once at creation; only their SHA-256 hash is stored
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    token_prefix VARCHAR(16) NOT NULL, -- First characters of the token, to recognise it in lists
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}', -- e.g. capabilities:read, approvals:write, ai:generate
+    expires_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
+CREATE INDEX IF NOT EXISTS idx_api_tokens_expires_at ON api_tokens(expires_at);
+
+-- Add comments for documentation
+COMMENT ON TABLE api_tokens IS 'Scoped personal access tokens for users and service accounts, stored hashed';
+COMMENT ON COLUMN users.is_service_account IS 'Non-human account used by automation; authenticates only with API tokens';
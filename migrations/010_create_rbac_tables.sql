@@ -0,0 +1,133 @@
+-- Migration: Role-based access control with custom roles and workspace membership
+-- A role is a named set of permissions. A user's global role (users.role) applies to records
+-- outside any workspace and, with workspaces:shared, to shared workspaces. Workspace
+-- membership grants a role inside one workspace only.
+
+CREATE TABLE IF NOT EXISTS roles (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(50) UNIQUE NOT NULL, -- Matches users.role for global roles
+    description TEXT,
+    is_system BOOLEAN DEFAULT false, -- Built-in roles cannot be deleted
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission VARCHAR(100) NOT NULL, -- e.g. capabilities:read, approvals:write, ai:generate
+    PRIMARY KEY (role_id, permission)
+);
+
+CREATE TABLE IF NOT EXISTS workspace_members (
+    id SERIAL PRIMARY KEY,
+    workspace_id INTEGER NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE RESTRICT,
+    added_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(workspace_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_workspace_members_user_id ON workspace_members(user_id);
+
+-- Tie workspaces to their folder under workspaces/ and capabilities to a workspace
+ALTER TABLE workspaces ADD COLUMN IF NOT EXISTS folder_name VARCHAR(255);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workspaces_folder_name ON workspaces(folder_name) WHERE folder_name IS NOT NULL;
+
+ALTER TABLE capabilities ADD COLUMN IF NOT EXISTS workspace_id INTEGER REFERENCES workspaces(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_capabilities_workspace_id ON capabilities(workspace_id);
+
+DROP TRIGGER IF EXISTS update_roles_updated_at ON roles;
+CREATE TRIGGER update_roles_updated_at
+    BEFORE UPDATE ON roles
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+DROP TRIGGER IF EXISTS update_workspace_members_updated_at ON workspace_members;
+CREATE TRIGGER update_workspace_members_updated_at
+    BEFORE UPDATE ON workspace_members
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Built-in roles: the existing global roles plus contractor and workspace roles
+INSERT INTO roles (name, description, is_system) VALUES
+    ('admin', 'Full access to every workspace and setting', true),
+    ('product_owner', 'Manages capabilities, approvals and workflow settings', true),
+    ('designer', 'Works on specifications and designs in shared workspaces', true),
+    ('engineer', 'Works on specifications and code in shared workspaces', true),
+    ('devops', 'Works on code and deployment in shared workspaces', true),
+    ('user', 'Read-only access to shared workspaces', true),
+    ('contractor', 'No access outside the workspaces they are a member of', true),
+    ('workspace_owner', 'Full access within one workspace', true),
+    ('workspace_editor', 'Edit access within one workspace', true),
+    ('workspace_viewer', 'Read-only access within one workspace', true)
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT r.id, p.permission
+FROM roles r
+JOIN (VALUES
+    ('admin', 'capabilities:read'), ('admin', 'capabilities:write'),
+    ('admin', 'approvals:read'), ('admin', 'approvals:write'), ('admin', 'approvals:manage'),
+    ('admin', 'notifications:read'), ('admin', 'notifications:write'),
+    ('admin', 'search:read'), ('admin', 'search:write'),
+    ('admin', 'specifications:read'), ('admin', 'specifications:write'),
+    ('admin', 'ai:generate'), ('admin', 'workspaces:shared'), ('admin', 'workspaces:admin'),
+
+    ('product_owner', 'capabilities:read'), ('product_owner', 'capabilities:write'),
+    ('product_owner', 'approvals:read'), ('product_owner', 'approvals:write'), ('product_owner', 'approvals:manage'),
+    ('product_owner', 'notifications:read'), ('product_owner', 'notifications:write'),
+    ('product_owner', 'search:read'), ('product_owner', 'search:write'),
+    ('product_owner', 'specifications:read'), ('product_owner', 'specifications:write'),
+    ('product_owner', 'ai:generate'), ('product_owner', 'workspaces:shared'),
+
+    ('designer', 'capabilities:read'), ('designer', 'capabilities:write'),
+    ('designer', 'approvals:read'), ('designer', 'approvals:write'),
+    ('designer', 'notifications:read'), ('designer', 'notifications:write'),
+    ('designer', 'search:read'), ('designer', 'search:write'),
+    ('designer', 'specifications:read'), ('designer', 'specifications:write'),
+    ('designer', 'ai:generate'), ('designer', 'workspaces:shared'),
+
+    ('engineer', 'capabilities:read'), ('engineer', 'capabilities:write'),
+    ('engineer', 'approvals:read'), ('engineer', 'approvals:write'),
+    ('engineer', 'notifications:read'), ('engineer', 'notifications:write'),
+    ('engineer', 'search:read'), ('engineer', 'search:write'),
+    ('engineer', 'specifications:read'), ('engineer', 'specifications:write'),
+    ('engineer', 'ai:generate'), ('engineer', 'workspaces:shared'),
+
+    ('devops', 'capabilities:read'), ('devops', 'capabilities:write'),
+    ('devops', 'approvals:read'), ('devops', 'approvals:write'),
+    ('devops', 'notifications:read'), ('devops', 'notifications:write'),
+    ('devops', 'search:read'), ('devops', 'search:write'),
+    ('devops', 'specifications:read'), ('devops', 'specifications:write'),
+    ('devops', 'ai:generate'), ('devops', 'workspaces:shared'),
+
+    ('user', 'capabilities:read'), ('user', 'approvals:read'),
+    ('user', 'notifications:read'), ('user', 'notifications:write'),
+    ('user', 'search:read'), ('user', 'specifications:read'), ('user', 'workspaces:shared'),
+
+    ('contractor', 'notifications:read'), ('contractor', 'notifications:write'),
+
+    ('workspace_owner', 'capabilities:read'), ('workspace_owner', 'capabilities:write'),
+    ('workspace_owner', 'approvals:read'), ('workspace_owner', 'approvals:write'),
+    ('workspace_owner', 'search:read'), ('workspace_owner', 'search:write'),
+    ('workspace_owner', 'specifications:read'), ('workspace_owner', 'specifications:write'),
+    ('workspace_owner', 'ai:generate'),
+
+    ('workspace_editor', 'capabilities:read'), ('workspace_editor', 'capabilities:write'),
+    ('workspace_editor', 'approvals:read'), ('workspace_editor', 'approvals:write'),
+    ('workspace_editor', 'search:read'), ('workspace_editor', 'search:write'),
+    ('workspace_editor', 'specifications:read'), ('workspace_editor', 'specifications:write'),
+    ('workspace_editor', 'ai:generate'),
+
+    ('workspace_viewer', 'capabilities:read'), ('workspace_viewer', 'approvals:read'),
+    ('workspace_viewer', 'search:read'), ('workspace_viewer', 'specifications:read')
+) AS p(role_name, permission) ON p.role_name = r.name
+ON CONFLICT DO NOTHING;
+
+-- Add comments for documentation
+COMMENT ON TABLE roles IS 'Named permission sets, used as global user roles and as workspace membership roles';
+COMMENT ON TABLE role_permissions IS 'Permissions granted by each role';
+COMMENT ON TABLE workspace_members IS 'Grants a user a role within a single workspace';
+COMMENT ON COLUMN workspaces.folder_name IS 'Folder under workspaces/ holding the workspace files';
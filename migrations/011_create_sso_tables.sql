@@ -0,0 +1,32 @@
+-- Migration: Provider-agnostic single sign-on
+-- Login state (with PKCE verifier and OIDC nonce) lives in the database so any auth-service
+-- replica can complete a login, and external identities are linked to users by subject.
+
+CREATE TABLE IF NOT EXISTS sso_states (
+    state_hash VARCHAR(64) PRIMARY KEY, -- SHA-256 of the state parameter
+    provider VARCHAR(100) NOT NULL,
+    code_verifier VARCHAR(128) NOT NULL, -- PKCE verifier
+    nonce VARCHAR(128),
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sso_states_expires_at ON sso_states(expires_at);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(100) NOT NULL, -- 'google' or a configured SSO provider ID
+    subject VARCHAR(255) NOT NULL, -- Stable user ID at the provider (OIDC "sub")
+    email VARCHAR(255),
+    groups TEXT[] DEFAULT '{}', -- Groups reported at the last login
+    last_login_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
+
+-- Add comments for documentation
+COMMENT ON TABLE sso_states IS 'Pending single sign-on logins, consumed once by the callback';
+COMMENT ON TABLE user_identities IS 'Links users to their accounts at external identity providers';
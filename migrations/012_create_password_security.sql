@@ -0,0 +1,81 @@
+-- Migration: Password lifecycle and multi-factor authentication
+-- Adds lockout counters and TOTP enrollment to users, email-token password resets,
+-- login MFA challenges, recovery codes, per-role MFA requirements and an auth audit log.
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS failed_login_count INTEGER NOT NULL DEFAULT 0, -- Consecutive failures since the last success
+    ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS password_changed_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS mfa_enabled BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS mfa_secret TEXT, -- AES-GCM encrypted TOTP secret
+    ADD COLUMN IF NOT EXISTS mfa_pending_secret TEXT, -- Secret shown during enrollment, before the first code is confirmed
+    ADD COLUMN IF NOT EXISTS mfa_last_step BIGINT NOT NULL DEFAULT 0; -- Last accepted TOTP time step, so codes cannot be replayed
+
+ALTER TABLE roles
+    ADD COLUMN IF NOT EXISTS require_mfa BOOLEAN NOT NULL DEFAULT false;
+
+ALTER TABLE sessions
+    ADD COLUMN IF NOT EXISTS mfa_verified BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    token_hash VARCHAR(64) PRIMARY KEY, -- SHA-256 of the emailed token
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    requested_ip VARCHAR(64),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user_id ON password_reset_tokens(user_id);
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_expires_at ON password_reset_tokens(expires_at);
+
+CREATE TABLE IF NOT EXISTS mfa_challenges (
+    token_hash VARCHAR(64) PRIMARY KEY, -- SHA-256 of the token returned after the password step
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose VARCHAR(20) NOT NULL, -- verify, enroll
+    attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_mfa_challenges_expires_at ON mfa_challenges(expires_at);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes(user_id);
+
+CREATE TABLE IF NOT EXISTS auth_events (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    email VARCHAR(255),
+    event VARCHAR(50) NOT NULL, -- login_failed, account_locked, password_reset, mfa_enabled, ...
+    ip_address VARCHAR(64),
+    user_agent TEXT,
+    details JSONB DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_events_user_id ON auth_events(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_auth_events_ip_address ON auth_events(ip_address, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_auth_events_event ON auth_events(event);
+
+-- Approvers of the Execution stage sign off releases and must use a second factor
+DO $$
+BEGIN
+    IF to_regclass('approval_workflow_rules') IS NOT NULL THEN
+        UPDATE roles SET require_mfa = true
+        WHERE name IN (SELECT role FROM approval_workflow_rules WHERE stage = 'execution' AND can_approve = true);
+    END IF;
+END $$;
+
+-- Add comments for documentation
+COMMENT ON TABLE password_reset_tokens IS 'Single-use password reset tokens sent by email';
+COMMENT ON TABLE mfa_challenges IS 'Pending second-factor steps of logins that passed the password check';
+COMMENT ON TABLE mfa_recovery_codes IS 'Hashed single-use recovery codes for users with TOTP enabled';
+COMMENT ON TABLE auth_events IS 'Audit log of authentication events such as failed logins, lockouts and MFA changes';
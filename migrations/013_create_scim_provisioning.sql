@@ -0,0 +1,48 @@
+-- Migration: SCIM 2.0 user and group provisioning
+-- Lets an identity provider create, update and deprovision users and push its groups.
+-- Groups are mapped onto global roles and workspace membership by the auth-service
+-- (SCIM_ROLE_MAPPINGS); deprovisioned users are deactivated rather than deleted.
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS external_id VARCHAR(255), -- The identity provider's ID for the user
+    ADD COLUMN IF NOT EXISTS given_name VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS family_name VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS manager_id INTEGER REFERENCES users(id) ON DELETE SET NULL, -- Receives pending approvals at deprovisioning
+    ADD COLUMN IF NOT EXISTS deprovisioned_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS scim_deleted_at TIMESTAMP; -- Deleted through SCIM; hidden from the provider but kept for history
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_external_id ON users(external_id) WHERE external_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS scim_groups (
+    id SERIAL PRIMARY KEY,
+    display_name VARCHAR(255) UNIQUE NOT NULL, -- Matched against SCIM_ROLE_MAPPINGS
+    external_id VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS scim_group_members (
+    group_id INTEGER NOT NULL REFERENCES scim_groups(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_scim_group_members_user_id ON scim_group_members(user_id);
+
+-- Memberships granted through a mapped group are replaced on every sync; manual ones are kept
+ALTER TABLE workspace_members
+    ADD COLUMN IF NOT EXISTS scim_managed BOOLEAN NOT NULL DEFAULT false;
+
+DROP TRIGGER IF EXISTS update_scim_groups_updated_at ON scim_groups;
+CREATE TRIGGER update_scim_groups_updated_at
+    BEFORE UPDATE ON scim_groups
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Add comments for documentation
+COMMENT ON TABLE scim_groups IS 'Groups pushed by the identity provider over SCIM';
+COMMENT ON TABLE scim_group_members IS 'Users in each SCIM group';
+COMMENT ON COLUMN users.external_id IS 'Identity provider ID set through SCIM';
+COMMENT ON COLUMN workspace_members.scim_managed IS 'Membership granted by a SCIM group mapping';
+COMMENT ON COLUMN approval_audit_log.action IS 'requested, approved, rejected, withdrawn, escalated or reassigned';
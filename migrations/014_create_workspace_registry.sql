@@ -0,0 +1,45 @@
+-- Migration: Workspaces as server-side entities
+-- The workspaces table becomes the registry of workspace folders. The integration-service
+-- reconciles rows against the folders under workspaces/ and their .ubeworkspace files, and
+-- workspace-scoped APIs take a workspace ID instead of a filesystem path.
+
+-- Workspaces found on disk may have no known owner, and deleting a user no longer deletes
+-- the workspaces they owned
+ALTER TABLE workspaces ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE workspaces DROP CONSTRAINT IF EXISTS workspaces_user_id_fkey;
+ALTER TABLE workspaces ADD CONSTRAINT workspaces_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+
+-- The folder is the workspace's identity; names only need to be readable
+ALTER TABLE workspaces DROP CONSTRAINT IF EXISTS workspaces_user_id_name_key;
+
+ALTER TABLE workspaces
+    ADD COLUMN IF NOT EXISTS workspace_type VARCHAR(50) NOT NULL DEFAULT 'new', -- new, refactor, enhance, reverse-engineer
+    ADD COLUMN IF NOT EXISTS config_id VARCHAR(255), -- The id written in .ubeworkspace by the web UI
+    ADD COLUMN IF NOT EXISTS settings JSONB NOT NULL DEFAULT '{}', -- Other .ubeworkspace fields (AI preset, UI framework, ...)
+    ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS archived_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS missing_since TIMESTAMP; -- Folder not found at the last reconcile
+
+CREATE INDEX IF NOT EXISTS idx_workspaces_archived_at ON workspaces(archived_at);
+
+ALTER TABLE workspace_integrations
+    ADD COLUMN IF NOT EXISTS created_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+DROP TRIGGER IF EXISTS update_workspaces_updated_at ON workspaces;
+CREATE TRIGGER update_workspaces_updated_at
+    BEFORE UPDATE ON workspaces
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+DROP TRIGGER IF EXISTS update_workspace_integrations_updated_at ON workspace_integrations;
+CREATE TRIGGER update_workspace_integrations_updated_at
+    BEFORE UPDATE ON workspace_integrations
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Add comments for documentation
+COMMENT ON COLUMN workspaces.user_id IS 'Owner; NULL for workspaces discovered on disk without a known owner';
+COMMENT ON COLUMN workspaces.settings IS '.ubeworkspace settings without a dedicated column';
+COMMENT ON COLUMN workspaces.archived_at IS 'Archived workspaces are read-only and hidden from default listings';
+COMMENT ON COLUMN workspaces.missing_since IS 'Set when reconciliation cannot find the workspace folder';
@@ -0,0 +1,52 @@
+-- Migration: Durable background jobs
+-- Long-running AI and Claude CLI operations run as jobs in the integration-service. A
+-- submission returns at once; workers claim queued jobs, persist progress and logs, and
+-- store the result for later retrieval.
+
+CREATE TABLE IF NOT EXISTS jobs (
+    id SERIAL PRIMARY KEY,
+    kind VARCHAR(50) NOT NULL, -- 'generate_code', 'generate_code_cli', 'analyze_application', 'analyze_specifications'
+    status VARCHAR(20) NOT NULL DEFAULT 'queued', -- 'queued', 'running', 'succeeded', 'failed', 'cancelled'
+    workspace_path VARCHAR(500),
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    params JSONB NOT NULL DEFAULT '{}', -- Never holds API keys
+    result JSONB,
+    error TEXT,
+    progress INTEGER NOT NULL DEFAULT 0,
+    progress_message VARCHAR(500),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 1,
+    run_after TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, -- Retries wait out their backoff
+    cancel_requested BOOLEAN NOT NULL DEFAULT FALSE,
+    worker_id VARCHAR(100),
+    heartbeat_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS job_logs (
+    id BIGSERIAL PRIMARY KEY,
+    job_id INTEGER NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+    level VARCHAR(10) NOT NULL DEFAULT 'info', -- 'info', 'warn', 'error'
+    message TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_queue ON jobs(run_after) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS idx_jobs_running ON jobs(heartbeat_at) WHERE status = 'running';
+CREATE INDEX IF NOT EXISTS idx_jobs_created_by ON jobs(created_by);
+CREATE INDEX IF NOT EXISTS idx_jobs_created_at ON jobs(created_at);
+CREATE INDEX IF NOT EXISTS idx_job_logs_job_id ON job_logs(job_id, id);
+
+DROP TRIGGER IF EXISTS update_jobs_updated_at ON jobs;
+CREATE TRIGGER update_jobs_updated_at
+    BEFORE UPDATE ON jobs
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Add comments for documentation
+COMMENT ON TABLE jobs IS 'Background AI and Claude CLI operations with their progress and results';
+COMMENT ON COLUMN jobs.heartbeat_at IS 'Refreshed by the running worker; stale running jobs are requeued or failed on startup';
+COMMENT ON TABLE job_logs IS 'Log lines written by a job while it runs';
@@ -0,0 +1,50 @@
+-- Migration: Persisted AI conversations
+-- AI chat threads are stored per workspace, optionally tied to the capability, enabler or
+-- story they are about, so they survive reloads, can be shared with the workspace and show
+-- reviewers how a spec came about.
+
+CREATE TABLE IF NOT EXISTS conversations (
+    id SERIAL PRIMARY KEY,
+    workspace_id INTEGER NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    artifact_type VARCHAR(20), -- 'capability', 'enabler', 'story'; NULL for workspace-wide threads
+    artifact_id VARCHAR(100), -- e.g. CAP-123456
+    title VARCHAR(255) NOT NULL,
+    model VARCHAR(100),
+    summary TEXT, -- Summary of the messages up to summarized_through
+    summarized_through BIGINT,
+    forked_from INTEGER REFERENCES conversations(id) ON DELETE SET NULL,
+    message_count INTEGER NOT NULL DEFAULT 0,
+    input_tokens INTEGER NOT NULL DEFAULT 0,
+    output_tokens INTEGER NOT NULL DEFAULT 0,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS conversation_messages (
+    id BIGSERIAL PRIMARY KEY,
+    conversation_id INTEGER NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL, -- 'user', 'assistant'
+    content TEXT NOT NULL,
+    tool_calls JSONB, -- Tools the model used for this reply
+    file_changes JSONB, -- Files the reply created or modified
+    model VARCHAR(100),
+    input_tokens INTEGER NOT NULL DEFAULT 0,
+    output_tokens INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversations_workspace ON conversations(workspace_id, updated_at);
+CREATE INDEX IF NOT EXISTS idx_conversations_artifact ON conversations(workspace_id, artifact_id);
+CREATE INDEX IF NOT EXISTS idx_conversation_messages_conversation ON conversation_messages(conversation_id, id);
+
+DROP TRIGGER IF EXISTS update_conversations_updated_at ON conversations;
+CREATE TRIGGER update_conversations_updated_at
+    BEFORE UPDATE ON conversations
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Add comments for documentation
+COMMENT ON TABLE conversations IS 'AI chat threads scoped to a workspace and optionally to one of its specs';
+COMMENT ON COLUMN conversations.summarized_through IS 'Last message folded into summary; later messages are sent to the model as they are';
+COMMENT ON TABLE conversation_messages IS 'Messages of an AI chat thread with the tool calls, file changes and token usage of each reply';
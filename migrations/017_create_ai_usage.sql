@@ -0,0 +1,47 @@
+-- Migration: AI usage accounting and budgets
+-- Every call to a model is recorded with its tokens, cost and latency and the endpoint,
+-- user and workspace it was made for, so spend can be reported and charged back per
+-- workspace. Budgets cap what a workspace or user may spend per day or month.
+
+CREATE TABLE IF NOT EXISTS ai_usage (
+    id BIGSERIAL PRIMARY KEY,
+    workspace_id INTEGER, -- Kept when the workspace is deleted so past spend still adds up
+    user_id INTEGER,
+    endpoint VARCHAR(100) NOT NULL, -- e.g. /ai-chat, or the job kind for background jobs
+    model VARCHAR(100) NOT NULL,
+    input_tokens INTEGER NOT NULL DEFAULT 0,
+    output_tokens INTEGER NOT NULL DEFAULT 0,
+    cache_creation_tokens INTEGER NOT NULL DEFAULT 0,
+    cache_read_tokens INTEGER NOT NULL DEFAULT 0,
+    cost_usd NUMERIC(12, 6) NOT NULL DEFAULT 0,
+    latency_ms INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS ai_budgets (
+    id SERIAL PRIMARY KEY,
+    scope VARCHAR(20) NOT NULL, -- 'workspace', 'user'
+    scope_id INTEGER NOT NULL, -- Workspace or user ID
+    period VARCHAR(20) NOT NULL DEFAULT 'monthly', -- 'daily', 'monthly'
+    soft_limit_usd NUMERIC(12, 2), -- Warn once spend reaches this
+    hard_limit_usd NUMERIC(12, 2), -- Refuse further AI calls once spend reaches this
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (scope, scope_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ai_usage_workspace ON ai_usage(workspace_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_ai_usage_user ON ai_usage(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_ai_usage_created ON ai_usage(created_at);
+
+DROP TRIGGER IF EXISTS update_ai_budgets_updated_at ON ai_budgets;
+CREATE TRIGGER update_ai_budgets_updated_at
+    BEFORE UPDATE ON ai_budgets
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Add comments for documentation
+COMMENT ON TABLE ai_usage IS 'One row per model call with its token usage, cost at the time of the call and latency';
+COMMENT ON COLUMN ai_usage.cost_usd IS 'Cost priced when the call was made, so later price changes do not rewrite history';
+COMMENT ON TABLE ai_budgets IS 'Per-workspace and per-user AI spending limits with a warning and a hard stop';
@@ -0,0 +1,45 @@
+-- Migration: Embedding index for AI context retrieval
+-- Workspace specs and code are cut into chunks and embedded so AI endpoints can send the
+-- passages relevant to a request instead of whole workspaces. Vectors live here when the
+-- integration-service runs with RETRIEVAL_STORE=pgvector; otherwise they are kept on disk.
+-- The tables need the pgvector extension and are skipped when the server does not have it.
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'vector') THEN
+        RAISE NOTICE 'pgvector is not installed; skipping retrieval tables (use RETRIEVAL_STORE=disk)';
+        RETURN;
+    END IF;
+
+    CREATE EXTENSION IF NOT EXISTS vector;
+
+    CREATE TABLE IF NOT EXISTS retrieval_files (
+        id SERIAL PRIMARY KEY,
+        workspace VARCHAR(255) NOT NULL, -- Workspace folder name
+        embedder VARCHAR(100) NOT NULL, -- Vectors of different embedders are never compared
+        path VARCHAR(1000) NOT NULL, -- Relative to the workspace root
+        content_hash VARCHAR(64) NOT NULL, -- SHA-256, so unchanged files are not embedded again
+        indexed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        UNIQUE (workspace, embedder, path)
+    );
+
+    -- The embedding column has no fixed dimension so any embedding model can be used.
+    -- Searches are exact scans of one workspace, which stay fast at workspace scale.
+    CREATE TABLE IF NOT EXISTS retrieval_chunks (
+        id BIGSERIAL PRIMARY KEY,
+        file_id INTEGER NOT NULL REFERENCES retrieval_files(id) ON DELETE CASCADE,
+        kind VARCHAR(10) NOT NULL, -- 'spec', 'code'
+        heading VARCHAR(500),
+        start_line INTEGER NOT NULL,
+        end_line INTEGER NOT NULL,
+        content TEXT NOT NULL,
+        tokens INTEGER NOT NULL,
+        embedding vector NOT NULL
+    );
+
+    CREATE INDEX IF NOT EXISTS idx_retrieval_chunks_file ON retrieval_chunks(file_id);
+
+    COMMENT ON TABLE retrieval_files IS 'Workspace files in the AI retrieval index, one row per embedder';
+    COMMENT ON TABLE retrieval_chunks IS 'Embedded chunks of workspace specs and code searched by cosine distance';
+END
+$$;
@@ -0,0 +1,9 @@
+-- Migration: Prompt template of each AI call
+-- AI prompts are versioned templates (pkg/prompts). Every call records which template
+-- version built its prompt, so changes in cost or quality can be traced to prompt edits.
+
+ALTER TABLE ai_usage ADD COLUMN IF NOT EXISTS prompt_template VARCHAR(150);
+
+CREATE INDEX IF NOT EXISTS idx_ai_usage_prompt ON ai_usage(prompt_template, created_at);
+
+COMMENT ON COLUMN ai_usage.prompt_template IS 'name@version:hash of the prompt template used; NULL for calls not built from a template';
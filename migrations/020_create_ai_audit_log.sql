@@ -0,0 +1,31 @@
+-- Migration: AI governance audit log
+-- AI policy presets are enforced as rule sets (pkg/governance). Every AI run that changes
+-- workspace files under a rule set is recorded with the files it changed, the rules it
+-- broke and whether its changes were refused. Presets that require human review leave the
+-- entry pending until a reviewer approves or rejects it.
+
+CREATE TABLE IF NOT EXISTS ai_audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    workspace_id INTEGER, -- Kept when the workspace is deleted so the audit trail survives
+    user_id INTEGER,
+    endpoint VARCHAR(100) NOT NULL, -- e.g. /ai-chat, or the job kind for background jobs
+    workspace_path TEXT NOT NULL,
+    preset INTEGER NOT NULL,
+    enforcement VARCHAR(20) NOT NULL, -- 'advisory', 'block', 'terminate'
+    files JSONB NOT NULL DEFAULT '[]',
+    violations JSONB NOT NULL DEFAULT '[]',
+    blocked BOOLEAN NOT NULL DEFAULT false,
+    review_status VARCHAR(20), -- 'pending', 'approved', 'rejected'; NULL when no review is required
+    reviewed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    review_comment TEXT,
+    reviewed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_ai_audit_workspace ON ai_audit_log(workspace_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_ai_audit_user ON ai_audit_log(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_ai_audit_pending ON ai_audit_log(created_at) WHERE review_status = 'pending';
+
+-- Add comments for documentation
+COMMENT ON TABLE ai_audit_log IS 'AI runs that changed workspace files, checked against the rule set of the workspace''s AI policy preset';
+COMMENT ON COLUMN ai_audit_log.violations IS 'Array of {rule, path, message} for every rule the run broke';
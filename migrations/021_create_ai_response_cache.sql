@@ -0,0 +1,23 @@
+-- Migration: AI response cache
+-- Deterministic AI calls (specification analysis, diagrams, storyboard analysis) are
+-- answered from this table when the same prompt template version, model, parameters and
+-- input files were sent before. Entries are keyed by the SHA-256 of all of those, so a
+-- change to any of them is a miss. Used when AI_CACHE_STORE=postgres.
+
+CREATE TABLE IF NOT EXISTS ai_response_cache (
+    cache_key CHAR(64) PRIMARY KEY,
+    prompt VARCHAR(200) NOT NULL, -- Template ref, name@version:hash
+    model VARCHAR(100) NOT NULL,
+    value JSONB NOT NULL, -- The decoded answer
+    cost_usd NUMERIC(12, 6) NOT NULL DEFAULT 0, -- What the call cost, saved again by every hit
+    hits INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    last_hit_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_ai_response_cache_expires ON ai_response_cache(expires_at);
+
+-- Add comments for documentation
+COMMENT ON TABLE ai_response_cache IS 'Answers of deterministic AI calls, keyed by a hash of prompt template version, model, parameters and input digests';
+COMMENT ON COLUMN ai_response_cache.cache_key IS 'SHA-256 of the prompt template ref, model, parameters and input file digests';
@@ -0,0 +1,10 @@
+-- Migration: notifications:publish permission
+-- POST /notifications/events sends to any user or role the event names, so it needs its own
+-- permission instead of notifications:write, which every role holds for its own inbox.
+-- Admins hold it; services publish with a token of an admin service account scoped to it.
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT r.id, 'notifications:publish'
+FROM roles r
+WHERE r.name = 'admin'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,111 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package aicache
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKeyHash(t *testing.T) {
+	base := Key{
+		Prompt: "diagram-generation@v1:abc",
+		Model:  "claude-sonnet-4-20250514",
+		Params: map[string]interface{}{"diagramType": "flow", "maxTokens": 8192},
+		Inputs: map[string]string{"CAP-1.md": Digest("a"), "ENB-1.md": Digest("b")},
+	}
+	hash, err := base.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		key  Key
+		same bool
+	}{
+		{"equal", Key{Prompt: base.Prompt, Model: base.Model,
+			Params: map[string]interface{}{"maxTokens": 8192, "diagramType": "flow"},
+			Inputs: map[string]string{"ENB-1.md": Digest("b"), "CAP-1.md": Digest("a")}}, true},
+		{"template version", Key{Prompt: "diagram-generation@v2:def", Model: base.Model, Params: base.Params, Inputs: base.Inputs}, false},
+		{"model", Key{Prompt: base.Prompt, Model: "claude-opus-4", Params: base.Params, Inputs: base.Inputs}, false},
+		{"params", Key{Prompt: base.Prompt, Model: base.Model, Params: map[string]interface{}{"diagramType": "sequence", "maxTokens": 8192}, Inputs: base.Inputs}, false},
+		{"changed file", Key{Prompt: base.Prompt, Model: base.Model, Params: base.Params,
+			Inputs: map[string]string{"CAP-1.md": Digest("a"), "ENB-1.md": Digest("b!")}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.key.Hash()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (got == hash) != tt.same {
+				t.Errorf("expected equal hashes: %v, got %s and %s", tt.same, hash, got)
+			}
+		})
+	}
+}
+
+func TestCache(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+	c := New(NewDiskStore(dir), time.Hour)
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	key := Key{Prompt: "storyboard-analysis@v1:abc", Model: "m", Inputs: map[string]string{"STORY-1.md": Digest("x")}}
+	type answer struct{ Cards []string }
+
+	var got answer
+	if hit, err := c.Get(key, &got); hit || err != nil {
+		t.Fatalf("expected a miss on an empty cache, got %v, %v", hit, err)
+	}
+	if err := c.Put(key, answer{Cards: []string{"Sign in"}}, 0.25); err != nil {
+		t.Fatal(err)
+	}
+	c.Bypass(key)
+	for i := 0; i < 2; i++ {
+		got = answer{}
+		if hit, err := c.Get(key, &got); !hit || err != nil || len(got.Cards) != 1 || got.Cards[0] != "Sign in" {
+			t.Fatalf("expected a hit, got %v, %v, %+v", hit, err, got)
+		}
+	}
+
+	// A changed input misses
+	other := key
+	other.Inputs = map[string]string{"STORY-1.md": Digest("y")}
+	if hit, _ := c.Get(other, &got); hit {
+		t.Error("expected a changed input to miss")
+	}
+
+	stats, _ := c.Stats()
+	want := Stats{Prompt: "storyboard-analysis", Hits: 2, Misses: 2, Bypasses: 1, HitRate: 0.4, SavedUSD: 0.5}
+	if len(stats) != 1 || stats[0] != want {
+		t.Errorf("expected %+v, got %+v", want, stats)
+	}
+
+	// Answers expire after the TTL and are purged
+	now = now.Add(time.Hour)
+	if hit, _ := c.Get(key, &got); hit {
+		t.Error("expected an expired answer to miss")
+	}
+	if n, err := c.Purge(); n != 1 || err != nil {
+		t.Errorf("expected 1 expired answer purged, got %d, %v", n, err)
+	}
+	if err := c.Put(key, answer{}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := c.Clear(); n != 1 || err != nil {
+		t.Errorf("expected 1 answer cleared, got %d, %v", n, err)
+	}
+	if n, err := NewDiskStore(filepath.Join(dir, "missing")).Clear(); n != 0 || err != nil {
+		t.Errorf("expected clearing a cache never written to succeed, got %d, %v", n, err)
+	}
+}
@@ -0,0 +1,211 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+// Package aicache caches the answers of deterministic AI calls by the content of
+// everything the answer depends on: the prompt template version, the model, the call's
+// parameters and the digests of its input files. A call repeated on unchanged inputs is
+// answered from the cache instead of the model.
+package aicache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How a call was answered
+const (
+	StatusHit    = "hit"    // From the cache
+	StatusMiss   = "miss"   // By the model, as the cache had no answer
+	StatusBypass = "bypass" // By the model, as the caller asked to skip the cache
+)
+
+// DefaultTTL is how long answers are kept unless configured otherwise
+const DefaultTTL = 30 * 24 * time.Hour
+
+// Key identifies the answer to a deterministic AI call. Calls with equal keys get the
+// same answer.
+type Key struct {
+	Prompt string            `json:"prompt"` // Template ref, name@version:hash
+	Model  string            `json:"model"`
+	Params interface{}       `json:"params,omitempty"` // Anything else the answer depends on, e.g. options or its schema
+	Inputs map[string]string `json:"inputs,omitempty"` // Digest of each input, by name
+}
+
+// Digest is the content hash of an input
+func Digest(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// Hash is the key's content address. encoding/json writes map keys in order, so equal
+// keys always hash alike.
+func (k Key) Hash() (string, error) {
+	data, err := json.Marshal(k)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash cache key: %w", err)
+	}
+	return Digest(string(data)), nil
+}
+
+// Entry is a cached answer
+type Entry struct {
+	Key       string          `json:"key"`
+	Prompt    string          `json:"prompt"`
+	Model     string          `json:"model"`
+	Value     json.RawMessage `json:"value"`
+	CostUSD   float64         `json:"cost_usd"` // What the call cost, saved again by every hit
+	Hits      int             `json:"hits"`
+	CreatedAt time.Time       `json:"created_at"`
+	ExpiresAt time.Time       `json:"expires_at"`
+	LastHitAt *time.Time      `json:"last_hit_at,omitempty"`
+}
+
+// Store keeps cached answers; DiskStore and repository.AICacheRepository (Postgres)
+// implement it
+type Store interface {
+	// Hit returns the entry stored under key and counts the hit, or nil when there is
+	// none or it expired before now
+	Hit(key string, now time.Time) (*Entry, error)
+	// Put stores an entry, replacing any under its key
+	Put(e *Entry) error
+	// Purge removes the entries that expired before now and returns how many
+	Purge(now time.Time) (int, error)
+	// Clear removes every entry and returns how many
+	Clear() (int, error)
+}
+
+// Stats are the lookups of one prompt template since the cache started
+type Stats struct {
+	Prompt   string  `json:"prompt"` // Template name
+	Hits     int     `json:"hits"`
+	Misses   int     `json:"misses"`
+	Bypasses int     `json:"bypasses"`
+	HitRate  float64 `json:"hit_rate"` // Hits out of all lookups
+	SavedUSD float64 `json:"saved_usd"`
+}
+
+// Cache answers repeated AI calls from a store and counts how well it does
+type Cache struct {
+	store Store
+	ttl   time.Duration
+	now   func() time.Time
+	since time.Time
+
+	mu    sync.Mutex
+	stats map[string]*Stats
+}
+
+// New creates a cache keeping answers in store for ttl (DefaultTTL when not positive)
+func New(store Store, ttl time.Duration) *Cache {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Cache{store: store, ttl: ttl, now: time.Now, since: time.Now(), stats: map[string]*Stats{}}
+}
+
+// TTL is how long answers are kept
+func (c *Cache) TTL() time.Duration {
+	return c.ttl
+}
+
+// Get decodes the cached answer for key into out and reports whether there was one
+func (c *Cache) Get(key Key, out interface{}) (bool, error) {
+	hash, err := key.Hash()
+	if err != nil {
+		return false, err
+	}
+	e, err := c.store.Hit(hash, c.now())
+	if err != nil {
+		return false, fmt.Errorf("failed to look up cached answer: %w", err)
+	}
+	if e == nil {
+		c.count(key, func(s *Stats) { s.Misses++ })
+		return false, nil
+	}
+	if err := json.Unmarshal(e.Value, out); err != nil {
+		c.count(key, func(s *Stats) { s.Misses++ })
+		return false, fmt.Errorf("failed to decode cached answer: %w", err)
+	}
+	c.count(key, func(s *Stats) {
+		s.Hits++
+		s.SavedUSD += e.CostUSD
+	})
+	return true, nil
+}
+
+// Bypass counts a call that skipped the cache. Its answer is still cached by Put.
+func (c *Cache) Bypass(key Key) {
+	c.count(key, func(s *Stats) { s.Bypasses++ })
+}
+
+// Put caches the answer to key, with what the call that made it cost
+func (c *Cache) Put(key Key, value interface{}, costUSD float64) error {
+	hash, err := key.Hash()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode answer: %w", err)
+	}
+	now := c.now()
+	return c.store.Put(&Entry{
+		Key:       hash,
+		Prompt:    key.Prompt,
+		Model:     key.Model,
+		Value:     data,
+		CostUSD:   costUSD,
+		CreatedAt: now,
+		ExpiresAt: now.Add(c.ttl),
+	})
+}
+
+// Purge removes expired answers
+func (c *Cache) Purge() (int, error) {
+	return c.store.Purge(c.now())
+}
+
+// Clear removes every answer
+func (c *Cache) Clear() (int, error) {
+	return c.store.Clear()
+}
+
+// Stats returns the lookups of each prompt template, by name, and when counting started
+func (c *Cache) Stats() ([]Stats, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := make([]Stats, 0, len(c.stats))
+	for _, s := range c.stats {
+		stat := *s
+		if lookups := stat.Hits + stat.Misses + stat.Bypasses; lookups > 0 {
+			stat.HitRate = float64(stat.Hits) / float64(lookups)
+		}
+		stats = append(stats, stat)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Prompt < stats[j].Prompt })
+	return stats, c.since
+}
+
+func (c *Cache) count(key Key, update func(*Stats)) {
+	name, _, _ := strings.Cut(key.Prompt, "@")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.stats[name]
+	if !ok {
+		s = &Stats{Prompt: name}
+		c.stats[name] = s
+	}
+	update(s)
+}
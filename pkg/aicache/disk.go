@@ -0,0 +1,132 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package aicache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DiskStore keeps each cached answer in a JSON file named by its key
+type DiskStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewDiskStore creates a store that writes its files under dir
+func NewDiskStore(dir string) *DiskStore {
+	return &DiskStore{dir: dir}
+}
+
+// file returns where the entry of a key is kept, spread over directories by its first
+// two characters
+func (s *DiskStore) file(key string) string {
+	if len(key) < 2 {
+		return filepath.Join(s.dir, key+".json")
+	}
+	return filepath.Join(s.dir, key[:2], key+".json")
+}
+
+func (s *DiskStore) read(path string) (*Entry, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cached answer: %w", err)
+	}
+	var e Entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("failed to parse cached answer %s: %w", path, err)
+	}
+	return &e, nil
+}
+
+func (s *DiskStore) write(e *Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cached answer: %w", err)
+	}
+	path := s.file(e.Key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	// Write then rename so a crash never leaves a truncated entry behind
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("failed to write cached answer: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to write cached answer: %w", err)
+	}
+	return nil
+}
+
+// Hit implements Store
+func (s *DiskStore) Hit(key string, now time.Time) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, err := s.read(s.file(key))
+	if err != nil || e == nil || !now.Before(e.ExpiresAt) {
+		return nil, err
+	}
+	e.Hits++
+	e.LastHitAt = &now
+	return e, s.write(e)
+}
+
+// Put implements Store
+func (s *DiskStore) Put(e *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(e)
+}
+
+// Purge implements Store
+func (s *DiskStore) Purge(now time.Time) (int, error) {
+	return s.remove(func(e *Entry) bool { return !now.Before(e.ExpiresAt) })
+}
+
+// Clear implements Store
+func (s *DiskStore) Clear() (int, error) {
+	return s.remove(func(*Entry) bool { return true })
+}
+
+// remove deletes the entries drop selects. Files that cannot be parsed are deleted too.
+func (s *DiskStore) remove(drop func(*Entry) bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	err := filepath.WalkDir(s.dir, func(path string, d os.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return filepath.SkipDir
+		}
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".json") {
+			return err
+		}
+		if e, err := s.read(path); err == nil && e != nil && !drop(e) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	if err != nil {
+		return removed, fmt.Errorf("failed to remove cached answers: %w", err)
+	}
+	return removed, nil
+}
@@ -0,0 +1,146 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+// ErrTokenRejected is returned when the auth service does not accept a token
+var ErrTokenRejected = errors.New("token rejected by auth service")
+
+// verifyCacheTTL bounds how long a revoked token can keep working in other services
+const verifyCacheTTL = 30 * time.Second
+
+// TokenInfo describes the user behind a verified token
+type TokenInfo struct {
+	UserID int
+	Email  string
+	Role   string
+	Scopes []string // Nil for session tokens
+	Access *models.AccessGrant
+}
+
+// AuthClient verifies bearer tokens against the auth service, caching results briefly
+type AuthClient struct {
+	baseURL    string
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]cachedToken
+}
+
+type cachedToken struct {
+	info    *TokenInfo
+	expires time.Time
+}
+
+// NewAuthClient creates a new auth client for the given auth-service URL
+func NewAuthClient(baseURL string) *AuthClient {
+	return &AuthClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		cache: make(map[[sha256.Size]byte]cachedToken),
+	}
+}
+
+// Verify calls GET /api/auth/verify and /api/auth/access with the token and returns who it
+// belongs to and what they may do
+func (c *AuthClient) Verify(ctx context.Context, token string) (*TokenInfo, error) {
+	key := sha256.Sum256([]byte(token))
+	now := time.Now()
+
+	c.mu.Lock()
+	if cached, ok := c.cache[key]; ok && now.Before(cached.expires) {
+		c.mu.Unlock()
+		return cached.info, nil
+	}
+	c.mu.Unlock()
+
+	var result struct {
+		Valid bool `json:"valid"`
+		User  struct {
+			ID    int    `json:"id"`
+			Email string `json:"email"`
+			Role  string `json:"role"`
+		} `json:"user"`
+		Scopes []string `json:"scopes"`
+	}
+	if err := c.get(ctx, "/api/auth/verify", token, &result); err != nil {
+		return nil, err
+	}
+	if !result.Valid {
+		return nil, ErrTokenRejected
+	}
+
+	var access models.AccessGrant
+	if err := c.get(ctx, "/api/auth/access", token, &access); err != nil {
+		return nil, err
+	}
+
+	info := &TokenInfo{
+		UserID: result.User.ID,
+		Email:  result.User.Email,
+		Role:   result.User.Role,
+		Scopes: result.Scopes,
+		Access: &access,
+	}
+
+	c.mu.Lock()
+	for k, cached := range c.cache {
+		if now.After(cached.expires) {
+			delete(c.cache, k)
+		}
+	}
+	c.cache[key] = cachedToken{info: info, expires: now.Add(verifyCacheTTL)}
+	c.mu.Unlock()
+
+	return info, nil
+}
+
+// get calls an auth-service endpoint with the token and decodes the JSON response
+func (c *AuthClient) get(ctx context.Context, path, token string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return ErrTokenRejected
+	}
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers carrying the shared-secret signature of a Claude CLI proxy request
+const (
+	ProxyTimestampHeader = "X-Proxy-Timestamp"
+	ProxySignatureHeader = "X-Proxy-Signature"
+)
+
+// ClaudeProxyRequest asks the proxy to run the Claude CLI in a workspace folder
+type ClaudeProxyRequest struct {
+	WorkspacePath    string `json:"workspacePath"`
+	Command          string `json:"command"`
+	AdditionalPrompt string `json:"additionalPrompt,omitempty"`
+	RequestedBy      string `json:"requestedBy,omitempty"` // Recorded in the proxy's audit log
+	SessionID        string `json:"sessionId,omitempty"`   // Resumes an earlier conversation in the same workspace
+}
+
+// ClaudeProxyResponse is the CLI output, or why it did not run
+type ClaudeProxyResponse struct {
+	Response  string `json:"response,omitempty"`
+	SessionID string `json:"sessionId,omitempty"` // Pass back to continue the conversation
+	Error     string `json:"error,omitempty"`
+}
+
+// Event types streamed by the Claude CLI proxy
+const (
+	ProxyEventSession    = "session"     // The CLI started or resumed a session
+	ProxyEventText       = "text"        // Assistant text
+	ProxyEventToolUse    = "tool_use"    // The CLI called a tool
+	ProxyEventToolResult = "tool_result" // A tool returned
+	ProxyEventFileEdit   = "file_edit"   // A tool wrote or edited a file
+	ProxyEventResult     = "result"      // The run finished; Text is the final response
+	ProxyEventError      = "error"       // The run failed
+)
+
+// ClaudeProxyEvent is one step of a streamed CLI run
+type ClaudeProxyEvent struct {
+	Type      string  `json:"type"`
+	SessionID string  `json:"sessionId,omitempty"`
+	Text      string  `json:"text,omitempty"` // Assistant text, tool output or the final response
+	Tool      string  `json:"tool,omitempty"`
+	ToolUseID string  `json:"toolUseId,omitempty"`
+	Input     string  `json:"input,omitempty"` // What the tool acted on: a file, command or pattern
+	Path      string  `json:"path,omitempty"`  // Edited file, relative to the workspace
+	IsError   bool    `json:"isError,omitempty"`
+	Error     string  `json:"error,omitempty"`
+	Status    int     `json:"status,omitempty"` // HTTP status of an error event
+	CostUSD   float64 `json:"costUsd,omitempty"`
+	Turns     int     `json:"turns,omitempty"`
+
+	Usage *ClaudeProxyUsage `json:"usage,omitempty"` // Tokens of the whole run, on the result event
+}
+
+// ClaudeProxyUsage is the token usage the Claude CLI reports for a run
+type ClaudeProxyUsage struct {
+	InputTokens              int `json:"inputTokens"`
+	OutputTokens             int `json:"outputTokens"`
+	CacheCreationInputTokens int `json:"cacheCreationInputTokens,omitempty"`
+	CacheReadInputTokens     int `json:"cacheReadInputTokens,omitempty"`
+}
+
+// SignProxyRequest returns the hex HMAC-SHA256 of a request's timestamp, method, path and
+// body hash under the shared secret
+func SignProxyRequest(secret, timestamp, method, path string, body []byte) string {
+	sum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s", timestamp, method, path, hex.EncodeToString(sum[:]))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ClaudeProxyClient calls the Claude CLI proxy running on the host
+type ClaudeProxyClient struct {
+	baseURL    string
+	secret     string
+	httpClient *http.Client
+}
+
+// NewClaudeProxyClient creates a client that signs requests with secret. CLI runs take
+// minutes, so the timeout only backstops the proxy's own execution timeout.
+func NewClaudeProxyClient(baseURL, secret string) *ClaudeProxyClient {
+	return &ClaudeProxyClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		secret:  secret,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Minute,
+		},
+	}
+}
+
+// EnableTLS presents a client certificate to the proxy and trusts only caFile for its
+// server certificate
+func (c *ClaudeProxyClient) EnableTLS(certFile, keyFile, caFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load client certificate: %w", err)
+	}
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		return fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return fmt.Errorf("no certificates found in %s", caFile)
+	}
+
+	c.httpClient.Transport = &http.Transport{
+		TLSClientConfig: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			RootCAs:      pool,
+			MinVersion:   tls.VersionTLS12,
+		},
+	}
+	return nil
+}
+
+// Execute runs the Claude CLI through POST /execute. Failures reported by the proxy come
+// back in the response's Error field; the error is for transport failures.
+func (c *ClaudeProxyClient) Execute(ctx context.Context, execReq ClaudeProxyRequest) (*ClaudeProxyResponse, error) {
+	resp, err := c.execute(ctx, execReq, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return decodeProxyResponse(resp)
+}
+
+// Stream runs the Claude CLI like Execute and calls onEvent for each event as the CLI
+// works. The returned response is assembled from the final result or error event.
+func (c *ClaudeProxyClient) Stream(ctx context.Context, execReq ClaudeProxyRequest, onEvent func(ClaudeProxyEvent)) (*ClaudeProxyResponse, error) {
+	resp, err := c.execute(ctx, execReq, "text/event-stream")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Requests rejected before the CLI starts get a plain JSON response
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return decodeProxyResponse(resp)
+	}
+
+	var result ClaudeProxyResponse
+	var data strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			data.WriteString(strings.TrimPrefix(value, " "))
+			continue
+		}
+		if line != "" || data.Len() == 0 {
+			continue
+		}
+
+		var event ClaudeProxyEvent
+		err := json.Unmarshal([]byte(data.String()), &event)
+		data.Reset()
+		if err != nil {
+			continue
+		}
+		switch event.Type {
+		case ProxyEventSession:
+			result.SessionID = event.SessionID
+		case ProxyEventResult:
+			result.Response = event.Text
+			if event.SessionID != "" {
+				result.SessionID = event.SessionID
+			}
+		case ProxyEventError:
+			result.Error = event.Error
+		}
+		if onEvent != nil {
+			onEvent(event)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read event stream: %w", err)
+	}
+	if result.Response == "" && result.Error == "" {
+		result.Error = "proxy stream ended without a result"
+	}
+	return &result, nil
+}
+
+// execute sends a signed POST /execute asking for the given response type
+func (c *ClaudeProxyClient) execute(ctx context.Context, execReq ClaudeProxyRequest, accept string) (*http.Response, error) {
+	body, err := json.Marshal(execReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/execute", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", accept)
+	if c.secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(ProxyTimestampHeader, timestamp)
+		req.Header.Set(ProxySignatureHeader, SignProxyRequest(c.secret, timestamp, req.Method, req.URL.Path, body))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	return resp, nil
+}
+
+func decodeProxyResponse(resp *http.Response) (*ClaudeProxyResponse, error) {
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var result ClaudeProxyResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+	if resp.StatusCode != http.StatusOK && result.Error == "" {
+		result.Error = fmt.Sprintf("proxy returned status %d", resp.StatusCode)
+	}
+	return &result, nil
+}
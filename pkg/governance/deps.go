@@ -0,0 +1,89 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package governance
+
+import (
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+)
+
+// dependencies returns the packages a dependency manifest lists: go.mod, package.json or
+// requirements.txt. Other files list none.
+func dependencies(p, content string) []string {
+	switch path.Base(p) {
+	case "go.mod":
+		return goModules(content)
+	case "package.json":
+		return npmPackages(content)
+	case "requirements.txt":
+		return pythonPackages(content)
+	}
+	return nil
+}
+
+// goModules reads the require directives of a go.mod file
+func goModules(content string) []string {
+	var modules []string
+	inBlock := false
+	for _, line := range strings.Split(content, "\n") {
+		line, _, _ = strings.Cut(line, "//")
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case inBlock && fields[0] == ")":
+			inBlock = false
+		case inBlock:
+			modules = append(modules, fields[0])
+		case fields[0] == "require" && len(fields) > 1 && fields[1] == "(":
+			inBlock = true
+		case fields[0] == "require" && len(fields) > 1:
+			modules = append(modules, fields[1])
+		}
+	}
+	return modules
+}
+
+// npmPackages reads the dependency sections of a package.json file
+func npmPackages(content string) []string {
+	var manifest map[string]json.RawMessage
+	if json.Unmarshal([]byte(content), &manifest) != nil {
+		return nil
+	}
+	var packages []string
+	for _, section := range []string{"dependencies", "devDependencies", "peerDependencies", "optionalDependencies"} {
+		var deps map[string]string
+		if json.Unmarshal(manifest[section], &deps) != nil {
+			continue
+		}
+		for name := range deps {
+			packages = append(packages, name)
+		}
+	}
+	sort.Strings(packages)
+	return packages
+}
+
+// pythonPackages reads the requirement lines of a requirements.txt file
+func pythonPackages(content string) []string {
+	var packages []string
+	for _, line := range strings.Split(content, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "-") {
+			continue // Options such as -r other.txt
+		}
+		if i := strings.IndexAny(line, "<>=!~;[ @"); i >= 0 {
+			line = line[:i]
+		}
+		packages = append(packages, strings.ToLower(line))
+	}
+	return packages
+}
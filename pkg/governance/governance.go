@@ -0,0 +1,241 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+// Package governance checks the files an AI run changes against the rule set of an AI
+// policy preset: forbidden paths, file size, license headers, banned dependencies and
+// test coverage.
+package governance
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+// RulesFile is the file in a workspace folder that adds to its preset's rules. The AI may
+// never write it.
+const RulesFile = ".ubegovernance.json"
+
+// headerLines is how far into a source file the license header is looked for
+const headerLines = 20
+
+// protectedPaths are forbidden under every rule set
+var protectedPaths = []string{".git/**", RulesFile}
+
+// sourceExts are the code files test coverage and license headers apply to
+var sourceExts = map[string]bool{
+	".go": true, ".js": true, ".jsx": true, ".ts": true, ".tsx": true, ".mjs": true,
+	".py": true, ".java": true, ".kt": true, ".rs": true, ".rb": true, ".php": true,
+	".cs": true, ".c": true, ".cc": true, ".cpp": true, ".h": true, ".swift": true,
+}
+
+// Change is a file an AI run writes
+type Change struct {
+	Path    string // Relative to the workspace, slash-separated
+	Content string
+}
+
+// CheckFile returns the rules a single file change breaks
+func CheckFile(rules *models.AIRuleSet, c Change) []models.AIViolation {
+	var violations []models.AIViolation
+	add := func(rule, format string, args ...interface{}) {
+		violations = append(violations, models.AIViolation{Rule: rule, Path: c.Path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if pattern := ForbiddenPath(rules, c.Path); pattern != "" {
+		add(models.AIRuleForbiddenPath, "%s matches the forbidden path %s", c.Path, pattern)
+		return violations
+	}
+	if rules.MaxFileBytes > 0 && len(c.Content) > rules.MaxFileBytes {
+		add(models.AIRuleMaxFileSize, "%s is %d bytes, more than the %d allowed", c.Path, len(c.Content), rules.MaxFileBytes)
+	}
+	if rules.LicenseHeader != "" && sourceExts[path.Ext(c.Path)] && !hasHeader(c.Content, rules.LicenseHeader) {
+		add(models.AIRuleLicenseHeader, "%s does not start with a license header containing %q", c.Path, rules.LicenseHeader)
+	}
+	for _, dep := range dependencies(c.Path, c.Content) {
+		if pattern := matchAny(rules.BannedDependencies, dep); pattern != "" {
+			add(models.AIRuleBannedDependency, "%s lists the banned dependency %s", c.Path, dep)
+		}
+	}
+	return violations
+}
+
+// CheckPlan returns the rules a set of changes breaks: those of each file, and the test
+// coverage of the source files changed. exists reports whether a file is already in the
+// workspace, so a change to a file with an existing test counts as covered.
+func CheckPlan(rules *models.AIRuleSet, changes []Change, exists func(path string) bool) []models.AIViolation {
+	var violations []models.AIViolation
+	for _, c := range changes {
+		violations = append(violations, CheckFile(rules, c)...)
+	}
+	return append(violations, CheckCoverage(rules, changes, exists)...)
+}
+
+// CheckCoverage returns a violation when too few of the source files changed have a test,
+// either among the changes or next to them in the workspace
+func CheckCoverage(rules *models.AIRuleSet, changes []Change, exists func(path string) bool) []models.AIViolation {
+	if rules.MinTestCoverage <= 0 {
+		return nil
+	}
+	tested := map[string]bool{}
+	var sources []string
+	for _, c := range changes {
+		if subject, ok := testSubject(c.Path); ok {
+			tested[subject] = true
+		} else if isSource(c.Path) {
+			sources = append(sources, c.Path)
+		}
+	}
+	if len(sources) == 0 {
+		return nil
+	}
+
+	var untested []string
+	for _, p := range sources {
+		if !tested[stem(p)] && !hasTestFile(p, exists) {
+			untested = append(untested, p)
+		}
+	}
+	coverage := float64(len(sources)-len(untested)) / float64(len(sources))
+	if coverage >= rules.MinTestCoverage {
+		return nil
+	}
+	sort.Strings(untested)
+	return []models.AIViolation{{
+		Rule: models.AIRuleTestCoverage,
+		Message: fmt.Sprintf("%d of %d changed source files have tests (%.0f%%, %.0f%% required); untested: %s",
+			len(sources)-len(untested), len(sources), coverage*100, rules.MinTestCoverage*100, strings.Join(untested, ", ")),
+	}}
+}
+
+// ForbiddenPath returns the forbidden path pattern p matches, or ""
+func ForbiddenPath(rules *models.AIRuleSet, p string) string {
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if pattern := matchAny(protectedPaths, p); pattern != "" {
+		return pattern
+	}
+	for _, pattern := range rules.ForbiddenPaths {
+		if matchPath(pattern, p) {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// matchAny returns the first pattern name matches, or ""
+func matchAny(patterns []string, name string) string {
+	for _, pattern := range patterns {
+		if matchPath(pattern, name) {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// matchPath matches a slash-separated path against a glob in which ** stands for any
+// number of directories. A pattern without a slash matches a file name in any directory.
+func matchPath(pattern, p string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(p))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(p, "/"))
+}
+
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+func isSource(p string) bool {
+	_, isTest := testSubject(p)
+	return sourceExts[path.Ext(p)] && !isTest
+}
+
+// hasHeader reports whether the first lines of a file contain the header text
+func hasHeader(content, header string) bool {
+	lines := strings.SplitN(content, "\n", headerLines+1)
+	if len(lines) > headerLines {
+		lines = lines[:headerLines]
+	}
+	return strings.Contains(strings.ToLower(strings.Join(lines, "\n")), strings.ToLower(header))
+}
+
+// stem is a file's name without directory and extension
+func stem(p string) string {
+	base := path.Base(p)
+	return strings.ToLower(strings.TrimSuffix(base, path.Ext(base)))
+}
+
+// testSubject returns the stem of the file a test file tests, e.g. "cart" for
+// cart_test.go, cart.test.ts, test_cart.py or __tests__/cart.js
+func testSubject(p string) (string, bool) {
+	if !sourceExts[path.Ext(p)] {
+		return "", false
+	}
+	name := stem(p)
+	suffixes := []string{"_test", ".test", ".spec"}
+	if ext := path.Ext(p); ext == ".java" || ext == ".kt" {
+		suffixes = append(suffixes, "test") // CartTest.java
+	}
+	for _, suffix := range suffixes {
+		if s, ok := strings.CutSuffix(name, suffix); ok && s != "" {
+			return s, true
+		}
+	}
+	if s, ok := strings.CutPrefix(name, "test_"); ok {
+		return s, true
+	}
+	for _, dir := range strings.Split(path.Dir(p), "/") {
+		if dir == "__tests__" || dir == "tests" || dir == "test" {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// hasTestFile reports whether a source file has a test next to it in the workspace
+func hasTestFile(p string, exists func(string) bool) bool {
+	if exists == nil {
+		return false
+	}
+	dir, ext := path.Dir(p), path.Ext(p)
+	original := strings.TrimSuffix(path.Base(p), ext)
+	for _, candidate := range []string{
+		original + "_test" + ext,
+		original + ".test" + ext,
+		original + ".spec" + ext,
+		"test_" + original + ext,
+		original + "Test" + ext,
+		"__tests__/" + original + ext,
+	} {
+		if exists(path.Join(dir, candidate)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package governance
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+func TestCheckFile(t *testing.T) {
+	rules := &models.AIRuleSet{
+		ForbiddenPaths:     []string{".env", "**/secrets/**", "deploy/*.yml"},
+		LicenseHeader:      "Copyright",
+		BannedDependencies: []string{"event-stream", "github.com/evil/*"},
+		MaxFileBytes:       100,
+	}
+	header := "// Copyright 2025 Acme\n\n"
+
+	tests := []struct {
+		name   string
+		change Change
+		rules  []string
+	}{
+		{"allowed", Change{"code/cart.go", header + "package cart\n"}, nil},
+		{"dotenv in a subdirectory", Change{"code/.env", "KEY=1"}, []string{models.AIRuleForbiddenPath}},
+		{"nested secrets", Change{"code/config/secrets/db.txt", "pw"}, []string{models.AIRuleForbiddenPath}},
+		{"anchored glob", Change{"deploy/prod.yml", ""}, []string{models.AIRuleForbiddenPath}},
+		{"anchored glob elsewhere", Change{"code/deploy/prod.yml", ""}, nil},
+		{"git", Change{"./.git/config", ""}, []string{models.AIRuleForbiddenPath}},
+		{"rules file", Change{RulesFile, "{}"}, []string{models.AIRuleForbiddenPath}},
+		{"too large", Change{"README.md", strings.Repeat("x", 101)}, []string{models.AIRuleMaxFileSize}},
+		{"missing header", Change{"code/cart.ts", "export {}\n"}, []string{models.AIRuleLicenseHeader}},
+		{"header only on source", Change{"code/cart.css", "body {}\n"}, nil},
+		{"header on test", Change{"code/cart_test.go", "package cart\n"}, []string{models.AIRuleLicenseHeader}},
+		{"npm package", Change{"package.json", `{"dependencies": {"event-stream": "3.3.6", "react": "18"}}`}, []string{models.AIRuleBannedDependency}},
+		{"go module", Change{"go.mod", "module acme\n\nrequire (\n\tgithub.com/evil/pkg v1.0.0 // indirect\n\tgolang.org/x/text v0.3.0\n)\n"}, []string{models.AIRuleBannedDependency}},
+		{"python requirement", Change{"requirements.txt", "# deps\nEvent-Stream>=1.0\nflask\n"}, []string{models.AIRuleBannedDependency}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := CheckFile(rules, tt.change)
+			if len(violations) != len(tt.rules) {
+				t.Fatalf("expected %v violations, got %+v", tt.rules, violations)
+			}
+			for i, rule := range tt.rules {
+				if violations[i].Rule != rule || violations[i].Path != tt.change.Path {
+					t.Errorf("expected a %s violation of %s, got %+v", rule, tt.change.Path, violations[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCheckCoverage(t *testing.T) {
+	rules := &models.AIRuleSet{MinTestCoverage: 0.6}
+	existing := map[string]bool{"code/tax_test.go": true}
+	exists := func(p string) bool { return existing[p] }
+
+	tests := []struct {
+		name    string
+		changes []string
+		wantErr bool
+	}{
+		{"no source files", []string{"README.md", "code/style.css"}, false},
+		{"test in the plan", []string{"code/cart.go", "code/cart_test.go"}, false},
+		{"existing test", []string{"code/tax.go"}, false},
+		{"js spec elsewhere", []string{"src/Cart.tsx", "src/__tests__/cart.spec.tsx"}, false},
+		{"python", []string{"app/cart.py", "tests/test_cart.py"}, false},
+		{"java", []string{"src/Cart.java", "src/CartTest.java"}, false},
+		{"untested", []string{"code/cart.go", "code/checkout.go"}, true},
+		{"half tested", []string{"code/cart.go", "code/cart_test.go", "code/checkout.go"}, true},
+		{"enough tested", []string{"code/cart.go", "code/cart_test.go", "code/tax.go", "code/checkout.go"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := make([]Change, len(tt.changes))
+			for i, p := range tt.changes {
+				changes[i] = Change{Path: p}
+			}
+			violations := CheckCoverage(rules, changes, exists)
+			if tt.wantErr != (len(violations) == 1) || len(violations) > 1 {
+				t.Fatalf("expected a coverage violation: %v, got %+v", tt.wantErr, violations)
+			}
+			if tt.wantErr && !strings.Contains(violations[0].Message, "code/checkout.go") {
+				t.Errorf("expected the untested files to be named, got %q", violations[0].Message)
+			}
+		})
+	}
+}
+
+func TestPresets(t *testing.T) {
+	previous := -1
+	for n := 1; n <= 5; n++ {
+		rules, err := Preset(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rules.Preset != n || strictness(rules.Enforcement) < previous {
+			t.Errorf("preset %d enforces less strictly than the one before", n)
+		}
+		previous = strictness(rules.Enforcement)
+	}
+	if _, err := Preset(6); !errors.Is(err, ErrUnknownPreset) {
+		t.Errorf("expected ErrUnknownPreset, got %v", err)
+	}
+
+	// Changing a copy leaves the preset alone
+	rules, _ := Preset(2)
+	rules.ForbiddenPaths[0] = "changed"
+	if again, _ := Preset(2); again.ForbiddenPaths[0] == "changed" {
+		t.Error("expected Preset to return a copy")
+	}
+}
+
+func TestTighten(t *testing.T) {
+	rules, _ := Preset(3)
+	Tighten(rules, models.AIRuleSet{
+		Enforcement:        models.AIEnforcementAdvisory,
+		ForbiddenPaths:     []string{"migrations/**", ".env"},
+		MinTestCoverage:    0.2,
+		MaxFileBytes:       1 << 30,
+		LicenseHeader:      "SPDX-License-Identifier",
+		BannedDependencies: []string{"lodash"},
+	})
+
+	if rules.Enforcement != models.AIEnforcementBlock {
+		t.Errorf("expected the workspace not to loosen enforcement, got %s", rules.Enforcement)
+	}
+	if rules.MinTestCoverage != 0.5 || rules.MaxFileBytes != 256<<10 || !rules.HumanReview {
+		t.Errorf("expected the workspace not to loosen limits, got %+v", rules)
+	}
+	if rules.LicenseHeader != "SPDX-License-Identifier" {
+		t.Errorf("expected the workspace to add a license header, got %q", rules.LicenseHeader)
+	}
+	if n := strings.Count(strings.Join(rules.ForbiddenPaths, " "), ".env "); n != 1 {
+		t.Errorf("expected forbidden paths without duplicates, got %v", rules.ForbiddenPaths)
+	}
+	if ForbiddenPath(rules, "migrations/020.sql") == "" || rules.BannedDependencies[len(rules.BannedDependencies)-1] != "lodash" {
+		t.Errorf("expected the workspace's paths and dependencies to be added, got %+v", rules)
+	}
+}
@@ -0,0 +1,140 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package governance
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+// ErrUnknownPreset is returned for a preset number other than 1 to 5
+var ErrUnknownPreset = errors.New("AI policy preset must be between 1 and 5")
+
+// secretPaths are files no preset above the first lets the AI write
+var secretPaths = []string{".env", ".env.*", "*.pem", "*.key", "id_rsa*", "**/secrets/**"}
+
+// compromisedPackages are packages that shipped malicious releases
+var compromisedPackages = []string{"event-stream", "flatmap-stream", "node-ipc"}
+
+// presets follow the five levels of AI_GOVERNANCE_FRAMEWORK.md, from advisory awareness
+// to zero-tolerance termination
+var presets = []models.AIRuleSet{
+	{
+		Preset:       1,
+		Name:         "Awareness",
+		Enforcement:  models.AIEnforcementAdvisory,
+		MaxFileBytes: 1 << 20,
+	},
+	{
+		Preset:             2,
+		Name:               "Guided Recommendations",
+		Enforcement:        models.AIEnforcementAdvisory,
+		ForbiddenPaths:     secretPaths,
+		MinTestCoverage:    0.5,
+		BannedDependencies: compromisedPackages,
+		MaxFileBytes:       512 << 10,
+	},
+	{
+		Preset:             3,
+		Name:               "Enforced with Warnings",
+		Enforcement:        models.AIEnforcementBlock,
+		ForbiddenPaths:     append(append([]string(nil), secretPaths...), ".github/workflows/**"),
+		MinTestCoverage:    0.5,
+		BannedDependencies: compromisedPackages,
+		MaxFileBytes:       256 << 10,
+		HumanReview:        true,
+	},
+	{
+		Preset:             4,
+		Name:               "Strict Enforcement",
+		Enforcement:        models.AIEnforcementBlock,
+		ForbiddenPaths:     append(append([]string(nil), secretPaths...), ".github/workflows/**", "Dockerfile", "docker-compose*.yml"),
+		MinTestCoverage:    0.8,
+		LicenseHeader:      "Copyright",
+		BannedDependencies: compromisedPackages,
+		MaxFileBytes:       128 << 10,
+		HumanReview:        true,
+	},
+	{
+		Preset:             5,
+		Name:               "Zero-Tolerance Termination",
+		Enforcement:        models.AIEnforcementTerminate,
+		ForbiddenPaths:     append(append([]string(nil), secretPaths...), ".github/workflows/**", "Dockerfile", "docker-compose*.yml"),
+		MinTestCoverage:    0.8,
+		LicenseHeader:      "Copyright",
+		BannedDependencies: compromisedPackages,
+		MaxFileBytes:       128 << 10,
+		HumanReview:        true,
+	},
+}
+
+// Preset returns a copy of the rule set of an AI policy preset
+func Preset(n int) (*models.AIRuleSet, error) {
+	if n < 1 || n > len(presets) {
+		return nil, fmt.Errorf("%w, not %d", ErrUnknownPreset, n)
+	}
+	rules := presets[n-1]
+	rules.ForbiddenPaths = append([]string(nil), rules.ForbiddenPaths...)
+	rules.BannedDependencies = append([]string(nil), rules.BannedDependencies...)
+	return &rules, nil
+}
+
+// Tighten adds a workspace's rules to a preset's. A workspace can only make the rules
+// stricter: lists are added to, limits lowered, coverage raised and review switched on.
+// Its preset, name and enforcement are ignored unless they enforce more strictly.
+func Tighten(rules *models.AIRuleSet, extra models.AIRuleSet) {
+	rules.ForbiddenPaths = appendNew(rules.ForbiddenPaths, extra.ForbiddenPaths)
+	rules.BannedDependencies = appendNew(rules.BannedDependencies, extra.BannedDependencies)
+	if extra.MinTestCoverage > rules.MinTestCoverage {
+		rules.MinTestCoverage = min(extra.MinTestCoverage, 1)
+	}
+	if extra.MaxFileBytes > 0 && (rules.MaxFileBytes == 0 || extra.MaxFileBytes < rules.MaxFileBytes) {
+		rules.MaxFileBytes = extra.MaxFileBytes
+	}
+	if rules.LicenseHeader == "" {
+		rules.LicenseHeader = extra.LicenseHeader
+	}
+	rules.HumanReview = rules.HumanReview || extra.HumanReview
+	if strictness(extra.Enforcement) > strictness(rules.Enforcement) {
+		rules.Enforcement = extra.Enforcement
+	}
+}
+
+func strictness(enforcement string) int {
+	switch enforcement {
+	case models.AIEnforcementBlock:
+		return 1
+	case models.AIEnforcementTerminate:
+		return 2
+	}
+	return 0
+}
+
+// Blocks reports whether changes that break the rules are refused
+func Blocks(rules *models.AIRuleSet) bool {
+	return strictness(rules.Enforcement) > 0
+}
+
+func appendNew(list, extra []string) []string {
+	for _, item := range extra {
+		found := false
+		for _, existing := range list {
+			if existing == item {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, item)
+		}
+	}
+	return list
+}
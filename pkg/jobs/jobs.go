@@ -0,0 +1,437 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+// Func runs one attempt of a job and returns its result, which is stored as JSON
+type Func func(ctx context.Context, t *Task) (interface{}, error)
+
+// RetryPolicy says how many attempts a job gets and how long to wait between them
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration // Doubles after each failed attempt
+}
+
+// Kind is a registered type of job
+type Kind struct {
+	Name  string
+	Run   Func
+	Retry RetryPolicy
+}
+
+// Store persists jobs and their logs; repository.JobRepository implements it
+type Store interface {
+	Create(job *models.Job) error
+	Get(id int) (*models.Job, error)
+	// Claim marks the oldest due job as running and counts the attempt; nil when none is due
+	Claim(workerID string) (*models.Job, error)
+	// Heartbeat records that the job is still running and reports whether cancellation was requested
+	Heartbeat(id int) (bool, error)
+	SetProgress(id, percent int, message string) error
+	AppendLog(id int, level, message string) error
+	Finish(id int, status string, result json.RawMessage, errMsg string) error
+	Requeue(id int, runAfter time.Time, errMsg string) error
+	// RequestCancel cancels a queued job outright and flags a running one
+	RequestCancel(id int) (*models.Job, error)
+	// RecoverStale requeues or fails running jobs whose heartbeat is older than before
+	RecoverStale(before time.Time) (int, error)
+}
+
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error that retrying cannot fix, such as invalid parameters
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// runningJob is a job executing in this process
+type runningJob struct {
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+// Manager runs registered job kinds on a pool of workers. Secrets handed to Submit stay in
+// memory; a job picked up by another process, or after a restart, runs without them.
+type Manager struct {
+	store    Store
+	kinds    map[string]Kind
+	workers  int
+	workerID string
+
+	pollInterval      time.Duration
+	heartbeatInterval time.Duration
+	staleAfter        time.Duration
+
+	wake   chan struct{}
+	stop   context.CancelFunc
+	stopWg sync.WaitGroup
+
+	mu       sync.Mutex
+	running  map[int]*runningJob
+	secrets  map[int]string
+	finished chan struct{} // Closed and replaced whenever a job finishes here
+}
+
+// NewManager creates a manager with the given number of workers
+func NewManager(store Store, workers int) *Manager {
+	if workers < 1 {
+		workers = 1
+	}
+	host, _ := os.Hostname()
+	return &Manager{
+		store:             store,
+		kinds:             make(map[string]Kind),
+		workers:           workers,
+		workerID:          fmt.Sprintf("%s-%d", host, os.Getpid()),
+		pollInterval:      2 * time.Second,
+		heartbeatInterval: 15 * time.Second,
+		staleAfter:        2 * time.Minute,
+		wake:              make(chan struct{}, 1),
+		running:           make(map[int]*runningJob),
+		secrets:           make(map[int]string),
+		finished:          make(chan struct{}),
+	}
+}
+
+// Register adds a job kind; call it before Start
+func (m *Manager) Register(kind Kind) {
+	if kind.Retry.MaxAttempts < 1 {
+		kind.Retry.MaxAttempts = 1
+	}
+	m.kinds[kind.Name] = kind
+}
+
+// Submit queues a job. secret (an API key) is kept in memory for the job's workers only.
+func (m *Manager) Submit(job *models.Job, secret string) error {
+	kind, ok := m.kinds[job.Kind]
+	if !ok {
+		return fmt.Errorf("unknown job kind %q", job.Kind)
+	}
+	job.Status = models.JobQueued
+	job.MaxAttempts = kind.Retry.MaxAttempts
+	if len(job.Params) == 0 {
+		job.Params = json.RawMessage("{}")
+	}
+
+	// Hold the lock until the secret is recorded so a worker cannot claim the job first
+	m.mu.Lock()
+	if err := m.store.Create(job); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	if secret != "" {
+		m.secrets[job.ID] = secret
+	}
+	m.mu.Unlock()
+
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Get returns a job
+func (m *Manager) Get(id int) (*models.Job, error) {
+	return m.store.Get(id)
+}
+
+// Cancel stops a queued or running job. Jobs running in another process notice at their
+// next heartbeat.
+func (m *Manager) Cancel(id int) (*models.Job, error) {
+	job, err := m.store.RequestCancel(id)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	if rj, ok := m.running[id]; ok {
+		rj.cancelled = true
+		rj.cancel()
+	}
+	if job.Status == models.JobCancelled {
+		delete(m.secrets, id)
+	}
+	m.mu.Unlock()
+	return job, nil
+}
+
+// Await blocks until a job reaches a final status or ctx is done
+func (m *Manager) Await(ctx context.Context, id int) (*models.Job, error) {
+	for {
+		m.mu.Lock()
+		finished := m.finished
+		m.mu.Unlock()
+
+		job, err := m.store.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		if job.Finished() {
+			return job, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-finished:
+		case <-time.After(m.pollInterval):
+		}
+	}
+}
+
+// Start recovers jobs abandoned by a stopped process and starts the workers
+func (m *Manager) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.stop = cancel
+
+	m.recoverStale()
+	m.stopWg.Add(m.workers + 1)
+	for i := 0; i < m.workers; i++ {
+		go m.work(ctx)
+	}
+	go func() {
+		defer m.stopWg.Done()
+		ticker := time.NewTicker(m.staleAfter)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.recoverStale()
+			}
+		}
+	}()
+}
+
+// Stop interrupts running jobs, which are requeued if they have attempts left, and waits
+// for the workers to exit
+func (m *Manager) Stop() {
+	if m.stop != nil {
+		m.stop()
+		m.stopWg.Wait()
+	}
+}
+
+func (m *Manager) recoverStale() {
+	n, err := m.store.RecoverStale(time.Now().Add(-m.staleAfter))
+	if err != nil {
+		log.Printf("Jobs: failed to recover stale jobs: %v", err)
+	} else if n > 0 {
+		log.Printf("Jobs: recovered %d job(s) abandoned by a stopped worker", n)
+	}
+}
+
+func (m *Manager) work(ctx context.Context) {
+	defer m.stopWg.Done()
+	for {
+		job, err := m.store.Claim(m.workerID)
+		if err != nil {
+			log.Printf("Jobs: failed to claim a job: %v", err)
+		}
+		if job != nil {
+			m.execute(ctx, job)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.wake:
+		case <-time.After(m.pollInterval):
+		}
+	}
+}
+
+func (m *Manager) execute(ctx context.Context, job *models.Job) {
+	kind, ok := m.kinds[job.Kind]
+	if !ok {
+		m.finish(job.ID, models.JobFailed, nil, fmt.Sprintf("unknown job kind %q", job.Kind))
+		return
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	rj := &runningJob{cancel: cancel}
+	m.mu.Lock()
+	m.running[job.ID] = rj
+	secret := m.secrets[job.ID]
+	m.mu.Unlock()
+
+	heartbeatDone := make(chan struct{})
+	go m.heartbeat(jobCtx, job.ID, rj, heartbeatDone)
+
+	task := &Task{Job: job, store: m.store, secret: secret}
+	result, err := runSafely(jobCtx, kind.Run, task)
+	cancel()
+	<-heartbeatDone
+
+	m.mu.Lock()
+	delete(m.running, job.ID)
+	cancelled := rj.cancelled
+	m.mu.Unlock()
+
+	switch {
+	case err == nil:
+		data, mErr := json.Marshal(result)
+		if mErr != nil {
+			m.finish(job.ID, models.JobFailed, nil, fmt.Sprintf("failed to encode result: %v", mErr))
+			return
+		}
+		m.finish(job.ID, models.JobSucceeded, data, "")
+	case cancelled:
+		task.Logf("Cancelled")
+		m.finish(job.ID, models.JobCancelled, nil, "cancelled")
+	case ctx.Err() != nil:
+		m.retryOrFail(task, kind, errors.New("interrupted by shutdown"), 0)
+	default:
+		m.retryOrFail(task, kind, err, kind.Retry.Backoff<<(job.Attempts-1))
+	}
+}
+
+// runSafely turns a panic in a job into a permanent failure
+func runSafely(ctx context.Context, run Func, t *Task) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = Permanent(fmt.Errorf("job panicked: %v", r))
+		}
+	}()
+	return run(ctx, t)
+}
+
+func (m *Manager) heartbeat(ctx context.Context, id int, rj *runningJob, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(m.heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cancelRequested, err := m.store.Heartbeat(id)
+			if err != nil {
+				log.Printf("Jobs: heartbeat for job %d failed: %v", id, err)
+				continue
+			}
+			if cancelRequested {
+				m.mu.Lock()
+				rj.cancelled = true
+				m.mu.Unlock()
+				rj.cancel()
+				return
+			}
+		}
+	}
+}
+
+func (m *Manager) retryOrFail(t *Task, kind Kind, err error, backoff time.Duration) {
+	job := t.Job
+	if IsPermanent(err) || job.Attempts >= job.MaxAttempts {
+		t.Warnf("Attempt %d of %d failed: %v", job.Attempts, job.MaxAttempts, err)
+		m.finish(job.ID, models.JobFailed, nil, err.Error())
+		return
+	}
+	t.Warnf("Attempt %d of %d failed, retrying in %s: %v", job.Attempts, job.MaxAttempts, backoff, err)
+	if rErr := m.store.Requeue(job.ID, time.Now().Add(backoff), err.Error()); rErr != nil {
+		log.Printf("Jobs: failed to requeue job %d: %v", job.ID, rErr)
+	}
+}
+
+func (m *Manager) finish(id int, status string, result json.RawMessage, errMsg string) {
+	if err := m.store.Finish(id, status, result, errMsg); err != nil {
+		log.Printf("Jobs: failed to record the end of job %d: %v", id, err)
+	}
+	m.mu.Lock()
+	delete(m.secrets, id)
+	close(m.finished)
+	m.finished = make(chan struct{})
+	m.mu.Unlock()
+}
+
+// Task is the running job handed to a Func
+type Task struct {
+	Job    *models.Job
+	store  Store
+	secret string
+}
+
+// NewTask returns a task that is not backed by a store, for running a Func inline
+func NewTask(job *models.Job, secret string) *Task {
+	return &Task{Job: job, secret: secret}
+}
+
+// Secret returns the API key given at submission, or "" when this process does not hold it
+func (t *Task) Secret() string {
+	return t.secret
+}
+
+// FinalAttempt reports whether a failure now fails the job instead of retrying it
+func (t *Task) FinalAttempt() bool {
+	return t.store == nil || t.Job.Attempts >= t.Job.MaxAttempts
+}
+
+// Params decodes the job's parameters into v
+func (t *Task) Params(v interface{}) error {
+	if err := json.Unmarshal(t.Job.Params, v); err != nil {
+		return Permanent(fmt.Errorf("invalid job parameters: %w", err))
+	}
+	return nil
+}
+
+// Progress records how far the job has got, in percent
+func (t *Task) Progress(percent int, message string) {
+	if t.store == nil {
+		return
+	}
+	if err := t.store.SetProgress(t.Job.ID, percent, message); err != nil {
+		log.Printf("Jobs: failed to record progress of job %d: %v", t.Job.ID, err)
+	}
+}
+
+// Logf appends an info line to the job's log
+func (t *Task) Logf(format string, args ...interface{}) {
+	t.log("info", fmt.Sprintf(format, args...))
+}
+
+// Warnf appends a warning to the job's log
+func (t *Task) Warnf(format string, args ...interface{}) {
+	t.log("warn", fmt.Sprintf(format, args...))
+}
+
+func (t *Task) log(level, message string) {
+	if t.store == nil {
+		log.Printf("[%s] %s", t.Job.Kind, message)
+		return
+	}
+	if err := t.store.AppendLog(t.Job.ID, level, message); err != nil {
+		log.Printf("Jobs: failed to log for job %d: %v", t.Job.ID, err)
+	}
+}
@@ -0,0 +1,318 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+// memoryStore is an in-memory Store with the same semantics as the job repository
+type memoryStore struct {
+	mu        sync.Mutex
+	jobs      map[int]*models.Job
+	logs      map[int][]string
+	nextID    int
+	recovered int
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{jobs: make(map[int]*models.Job), logs: make(map[int][]string)}
+}
+
+func (s *memoryStore) Create(job *models.Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	job.ID = s.nextID
+	job.RunAfter = time.Now()
+	copy := *job
+	s.jobs[job.ID] = &copy
+	return nil
+}
+
+func (s *memoryStore) Get(id int) (*models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, errors.New("job not found")
+	}
+	copy := *job
+	return &copy, nil
+}
+
+func (s *memoryStore) Claim(workerID string) (*models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id := 1; id <= s.nextID; id++ {
+		job := s.jobs[id]
+		if job.Status == models.JobQueued && !job.RunAfter.After(time.Now()) {
+			job.Status = models.JobRunning
+			job.Attempts++
+			copy := *job
+			return &copy, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *memoryStore) Heartbeat(id int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[id].CancelRequested, nil
+}
+
+func (s *memoryStore) SetProgress(id, percent int, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[id].Progress, s.jobs[id].ProgressMessage = percent, message
+	return nil
+}
+
+func (s *memoryStore) AppendLog(id int, level, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logs[id] = append(s.logs[id], level+": "+message)
+	return nil
+}
+
+func (s *memoryStore) Finish(id int, status string, result json.RawMessage, errMsg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := s.jobs[id]
+	job.Status, job.Result, job.Error = status, result, errMsg
+	return nil
+}
+
+func (s *memoryStore) Requeue(id int, runAfter time.Time, errMsg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := s.jobs[id]
+	job.Status, job.RunAfter, job.Error = models.JobQueued, runAfter, errMsg
+	if job.CancelRequested {
+		job.Status = models.JobCancelled
+	}
+	return nil
+}
+
+func (s *memoryStore) RequestCancel(id int) (*models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := s.jobs[id]
+	switch job.Status {
+	case models.JobQueued:
+		job.Status, job.Error, job.CancelRequested = models.JobCancelled, "cancelled", true
+	case models.JobRunning:
+		job.CancelRequested = true
+	}
+	copy := *job
+	return &copy, nil
+}
+
+func (s *memoryStore) RecoverStale(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recovered++
+	return 0, nil
+}
+
+func (s *memoryStore) logLines(id int) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.logs[id]...)
+}
+
+func newTestManager(store Store) *Manager {
+	m := NewManager(store, 2)
+	m.pollInterval = 10 * time.Millisecond
+	m.heartbeatInterval = 10 * time.Millisecond
+	m.staleAfter = time.Hour
+	return m
+}
+
+func await(t *testing.T, m *Manager, id int) *models.Job {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	job, err := m.Await(ctx, id)
+	if err != nil {
+		t.Fatalf("job %d did not finish: %v", id, err)
+	}
+	return job
+}
+
+func TestManagerRunsJobs(t *testing.T) {
+	tests := []struct {
+		name         string
+		retry        RetryPolicy
+		failures     int
+		err          error
+		wantStatus   string
+		wantAttempts int
+		wantError    string
+	}{
+		{"success", RetryPolicy{MaxAttempts: 3}, 0, nil, models.JobSucceeded, 1, ""},
+		{"retried until success", RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}, 2, errors.New("overloaded"), models.JobSucceeded, 3, ""},
+		{"attempts exhausted", RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond}, 5, errors.New("overloaded"), models.JobFailed, 2, "overloaded"},
+		{"permanent failure", RetryPolicy{MaxAttempts: 3}, 5, Permanent(errors.New("bad input")), models.JobFailed, 1, "bad input"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryStore()
+			m := newTestManager(store)
+			var mu sync.Mutex
+			calls := 0
+			m.Register(Kind{Name: "echo", Retry: tt.retry, Run: func(ctx context.Context, task *Task) (interface{}, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				calls++
+				if calls <= tt.failures {
+					return nil, tt.err
+				}
+				var params map[string]string
+				if err := task.Params(&params); err != nil {
+					return nil, err
+				}
+				task.Progress(50, "halfway")
+				return map[string]string{"echo": params["value"]}, nil
+			}})
+			m.Start()
+			defer m.Stop()
+
+			job := &models.Job{Kind: "echo", Params: json.RawMessage(`{"value":"hi"}`)}
+			if err := m.Submit(job, ""); err != nil {
+				t.Fatal(err)
+			}
+			job = await(t, m, job.ID)
+
+			if job.Status != tt.wantStatus {
+				t.Errorf("expected status %s, got %s (%s)", tt.wantStatus, job.Status, job.Error)
+			}
+			if job.Attempts != tt.wantAttempts {
+				t.Errorf("expected %d attempts, got %d", tt.wantAttempts, job.Attempts)
+			}
+			if tt.wantError != "" && job.Error != tt.wantError {
+				t.Errorf("expected error %q, got %q", tt.wantError, job.Error)
+			}
+			if tt.wantStatus == models.JobSucceeded && string(job.Result) != `{"echo":"hi"}` {
+				t.Errorf("unexpected result %s", job.Result)
+			}
+		})
+	}
+}
+
+func TestManagerCancelsRunningJob(t *testing.T) {
+	store := newMemoryStore()
+	m := newTestManager(store)
+	started := make(chan struct{})
+	m.Register(Kind{Name: "wait", Retry: RetryPolicy{MaxAttempts: 3}, Run: func(ctx context.Context, task *Task) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}})
+	m.Start()
+	defer m.Stop()
+
+	job := &models.Job{Kind: "wait"}
+	if err := m.Submit(job, ""); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if _, err := m.Cancel(job.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	job = await(t, m, job.ID)
+	if job.Status != models.JobCancelled {
+		t.Errorf("expected cancelled, got %s", job.Status)
+	}
+	if job.Attempts != 1 {
+		t.Errorf("a cancelled job must not be retried, got %d attempts", job.Attempts)
+	}
+}
+
+func TestManagerCancelsQueuedJob(t *testing.T) {
+	store := newMemoryStore()
+	m := newTestManager(store)
+	m.Register(Kind{Name: "never", Run: func(ctx context.Context, task *Task) (interface{}, error) {
+		t.Error("a cancelled job must not run")
+		return nil, nil
+	}})
+
+	// Not started, so the job stays queued
+	job := &models.Job{Kind: "never"}
+	if err := m.Submit(job, "key"); err != nil {
+		t.Fatal(err)
+	}
+	cancelled, err := m.Cancel(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.Status != models.JobCancelled {
+		t.Errorf("expected cancelled, got %s", cancelled.Status)
+	}
+	if _, ok := m.secrets[job.ID]; ok {
+		t.Error("the secret of a cancelled job should be dropped")
+	}
+
+	m.Start()
+	m.Stop()
+}
+
+func TestManagerKeepsSecretsOutOfStore(t *testing.T) {
+	store := newMemoryStore()
+	m := newTestManager(store)
+	var got string
+	m.Register(Kind{Name: "secret", Run: func(ctx context.Context, task *Task) (interface{}, error) {
+		got = task.Secret()
+		task.Logf("using the key")
+		return "ok", nil
+	}})
+	m.Start()
+	defer m.Stop()
+
+	job := &models.Job{Kind: "secret"}
+	if err := m.Submit(job, "sk-test"); err != nil {
+		t.Fatal(err)
+	}
+	job = await(t, m, job.ID)
+
+	if got != "sk-test" {
+		t.Errorf("expected the job to receive the secret, got %q", got)
+	}
+	data, _ := json.Marshal(job)
+	if strings.Contains(string(data), "sk-test") {
+		t.Errorf("secret persisted with the job: %s", data)
+	}
+	if _, ok := m.secrets[job.ID]; ok {
+		t.Error("the secret should be dropped once the job finishes")
+	}
+	if logs := store.logLines(job.ID); len(logs) != 1 || logs[0] != "info: using the key" {
+		t.Errorf("unexpected logs %v", logs)
+	}
+	if store.recovered == 0 {
+		t.Error("expected Start to recover stale jobs")
+	}
+}
+
+func TestManagerRejectsUnknownKind(t *testing.T) {
+	m := newTestManager(newMemoryStore())
+	if err := m.Submit(&models.Job{Kind: "missing"}, ""); err == nil {
+		t.Error("expected an error for an unregistered kind")
+	}
+}
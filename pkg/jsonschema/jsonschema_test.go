@@ -0,0 +1,157 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package jsonschema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type base struct {
+	ID string `json:"id"`
+}
+
+type suggestion struct {
+	base
+	Name       string            `json:"name"`
+	Kind       string            `json:"kind" jsonschema:"enum=capability|enabler"`
+	Confidence float64           `json:"confidence" jsonschema:"minimum=0,maximum=1"`
+	Rank       int               `json:"rank,omitempty"`
+	Tags       []string          `json:"tags,omitempty"`
+	Links      map[string]string `json:"links,omitempty"`
+	Extra      json.RawMessage   `json:"extra,omitempty"`
+	Parent     *base             `json:"parent,omitempty"`
+	Internal   string            `json:"-"`
+	private    string
+}
+
+type result struct {
+	Suggestions []suggestion `json:"suggestions"`
+}
+
+func TestFor(t *testing.T) {
+	data, err := json.Marshal(For(&result{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"type":"object","properties":{"suggestions":{"type":"array","items":{"type":"object",` +
+		`"properties":{"confidence":{"type":"number","minimum":0,"maximum":1},"extra":{},"id":{"type":"string"},` +
+		`"kind":{"type":"string","enum":["capability","enabler"]},"links":{"type":"object","additionalProperties":{"type":"string"}},` +
+		`"name":{"type":"string"},"parent":{"type":"object","properties":{"id":{"type":"string"}},"required":["id"]},` +
+		`"rank":{"type":"integer"},"tags":{"type":"array","items":{"type":"string"}}},` +
+		`"required":["id","name","kind","confidence"]}}},"required":["suggestions"]}`
+	if string(data) != want {
+		t.Errorf("unexpected schema\n got: %s\nwant: %s", data, want)
+	}
+}
+
+func TestForPanics(t *testing.T) {
+	type node struct {
+		Children []node `json:"children"`
+	}
+	type badTag struct {
+		N int `jsonschema:"minimum=low"`
+	}
+
+	tests := []struct {
+		name string
+		v    interface{}
+	}{
+		{"recursive type", node{}},
+		{"channel", struct{ C chan int }{}},
+		{"bad tag", badTag{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic")
+				}
+			}()
+			For(tt.v)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s := For(result{})
+
+	tests := []struct {
+		name     string
+		data     string
+		problems []string
+	}{
+		{
+			name: "valid",
+			data: `{"suggestions": [{"id": "1", "name": "Search", "kind": "capability", "confidence": 0.8, "rank": 2, "extra": [1]}]}`,
+		},
+		{
+			name:     "not JSON",
+			data:     `{"suggestions": [`,
+			problems: []string{"$: not valid JSON"},
+		},
+		{
+			name:     "two values",
+			data:     `{} {}`,
+			problems: []string{"$: more than one JSON value"},
+		},
+		{
+			name:     "missing property",
+			data:     `{}`,
+			problems: []string{`$: missing required property "suggestions"`},
+		},
+		{
+			name:     "wrong type",
+			data:     `{"suggestions": {"id": "1"}}`,
+			problems: []string{"$.suggestions: must be an array, not an object"},
+		},
+		{
+			name: "item problems",
+			data: `{"suggestions": [{"id": 1, "name": "Search", "kind": "feature", "confidence": 1.5, "rank": 1.5}]}`,
+			problems: []string{
+				"$.suggestions[0].confidence: must be at most 1, not 1.5",
+				"$.suggestions[0].id: must be a string, not the number 1",
+				`$.suggestions[0].kind: must be one of capability, enabler, not "feature"`,
+				"$.suggestions[0].rank: must be an integer, not the number 1.5",
+			},
+		},
+		{
+			name:     "null",
+			data:     `{"suggestions": null}`,
+			problems: []string{"$.suggestions: must be an array, not null"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := Validate(s, []byte(tt.data))
+			if len(problems) != len(tt.problems) {
+				t.Fatalf("expected %d problems, got %q", len(tt.problems), problems)
+			}
+			for i, want := range tt.problems {
+				if !strings.HasPrefix(problems[i], want) {
+					t.Errorf("expected problem %q, got %q", want, problems[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateCapsProblems(t *testing.T) {
+	items := make([]string, 30)
+	for i := range items {
+		items[i] = "{}"
+	}
+	problems := Validate(For(result{}), []byte(`{"suggestions": [`+strings.Join(items, ",")+`]}`))
+	if len(problems) != maxProblems+1 || !strings.HasPrefix(problems[maxProblems], "and ") {
+		t.Errorf("expected %d problems and a count of the rest, got %d", maxProblems, len(problems))
+	}
+}
@@ -0,0 +1,156 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+// Package jsonschema generates JSON Schemas from Go types and validates JSON against them.
+// It covers the subset of JSON Schema that describes the AI services' structured outputs:
+// objects, arrays, maps, scalars, required properties, enums and numeric bounds.
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Schema is a JSON Schema
+type Schema struct {
+	Type                 string             `json:"type,omitempty"` // Empty accepts any value
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+}
+
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// For returns the schema of the JSON that encoding/json reads into v's type. Struct fields
+// follow their json tags; fields without omitempty are required. A jsonschema tag narrows a
+// field further:
+//
+//	Type       string  `json:"type" jsonschema:"enum=capability|feature|enabler"`
+//	Confidence float64 `json:"confidence" jsonschema:"minimum=0,maximum=1"`
+//
+// It panics on types JSON cannot hold, such as channels and funcs, and on recursive types.
+func For(v interface{}) *Schema {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return generate(t, map[reflect.Type]bool{})
+}
+
+func generate(t reflect.Type, seen map[reflect.Type]bool) *Schema {
+	if t == nil || t == rawMessageType {
+		return &Schema{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return generate(t.Elem(), seen)
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string"} // []byte is base64
+		}
+		return &Schema{Type: "array", Items: generate(t.Elem(), seen)}
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			panic(fmt.Sprintf("jsonschema: map key of %s is not a string", t))
+		}
+		return &Schema{Type: "object", AdditionalProperties: generate(t.Elem(), seen)}
+	case reflect.Struct:
+		if seen[t] {
+			panic(fmt.Sprintf("jsonschema: %s is recursive", t))
+		}
+		seen[t] = true
+		defer delete(seen, t)
+
+		s := &Schema{Type: "object", Properties: map[string]*Schema{}, Required: []string{}}
+		addFields(s, t, seen)
+		return s
+	}
+	panic(fmt.Sprintf("jsonschema: %s cannot be represented in JSON", t))
+}
+
+// addFields adds the properties of a struct's fields, including those of embedded structs
+func addFields(s *Schema, t reflect.Type, seen map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				addFields(s, ft, seen)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop := generate(f.Type, seen)
+		if err := applyTag(prop, f.Tag.Get("jsonschema")); err != nil {
+			panic(fmt.Sprintf("jsonschema: field %s of %s: %v", f.Name, t, err))
+		}
+		s.Properties[name] = prop
+		if !strings.Contains(","+opts+",", ",omitempty,") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// applyTag applies the options of a jsonschema struct tag
+func applyTag(s *Schema, tag string) error {
+	if tag == "" {
+		return nil
+	}
+	for _, opt := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(opt, "=")
+		switch key {
+		case "enum":
+			s.Enum = strings.Split(value, "|")
+		case "minimum", "maximum":
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("%s is not a number: %q", key, value)
+			}
+			if key == "minimum" {
+				s.Minimum = &n
+			} else {
+				s.Maximum = &n
+			}
+		default:
+			return fmt.Errorf("unknown option %q", key)
+		}
+	}
+	return nil
+}
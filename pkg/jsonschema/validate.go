@@ -0,0 +1,149 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxProblems caps the problems Validate reports, so a badly wrong document does not
+// produce a message longer than the document
+const maxProblems = 20
+
+// Validate checks a JSON document against a schema. It returns what is wrong, each
+// problem prefixed with the JSON path of the value, e.g.
+// "$.suggestions[0].type: must be one of capability, feature, enabler". A document
+// that is not JSON has a single problem.
+func Validate(s *Schema, data []byte) []string {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return []string{fmt.Sprintf("$: not valid JSON: %v", err)}
+	}
+	if dec.More() {
+		return []string{"$: more than one JSON value"}
+	}
+
+	var problems []string
+	validate(s, v, "$", &problems)
+	if len(problems) > maxProblems {
+		problems = append(problems[:maxProblems], fmt.Sprintf("and %d more problems", len(problems)-maxProblems))
+	}
+	return problems
+}
+
+func validate(s *Schema, v interface{}, path string, problems *[]string) {
+	add := func(format string, args ...interface{}) {
+		*problems = append(*problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if s.Type != "" && !hasType(v, s.Type) {
+		add("must be %s, not %s", article(s.Type), describe(v))
+		return
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				add("missing required property %q", name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if prop, ok := s.Properties[name]; ok {
+				validate(prop, v[name], path+"."+name, problems)
+			} else if s.AdditionalProperties != nil {
+				validate(s.AdditionalProperties, v[name], path+"."+name, problems)
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+	case string:
+		if len(s.Enum) > 0 && !contains(s.Enum, v) {
+			add("must be one of %s, not %q", strings.Join(s.Enum, ", "), v)
+		}
+	case json.Number:
+		n, _ := v.Float64()
+		if s.Minimum != nil && n < *s.Minimum {
+			add("must be at least %g, not %s", *s.Minimum, v)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			add("must be at most %g, not %s", *s.Maximum, v)
+		}
+	}
+}
+
+// hasType reports whether a decoded JSON value is of a JSON Schema type
+func hasType(v interface{}, typ string) bool {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return typ == "object"
+	case []interface{}:
+		return typ == "array"
+	case string:
+		return typ == "string"
+	case bool:
+		return typ == "boolean"
+	case json.Number:
+		if typ == "number" {
+			return true
+		}
+		_, err := v.Int64()
+		return typ == "integer" && err == nil
+	}
+	return typ == "null"
+}
+
+// describe names the JSON type of a decoded value for a problem message
+func describe(v interface{}) string {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case json.Number:
+		return "the number " + v.String()
+	}
+	return "null"
+}
+
+func article(typ string) string {
+	switch typ {
+	case "object", "array", "integer":
+		return "an " + typ
+	}
+	return "a " + typ
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -16,7 +16,7 @@ import (
 	"github.com/jareynolds/ubecode/internal/auth"
 )
 
-// AuthMiddleware creates middleware that validates JWT tokens
+// AuthMiddleware creates middleware that validates JWTs and personal access tokens
 func AuthMiddleware(service *auth.Service) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -60,10 +60,62 @@ func AdminOnlyMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// Admin users' API tokens need the admin scope to manage users
+		if !claims.HasScope(auth.ScopeAdmin) {
+			http.Error(w, `{"error":"Token lacks the admin scope"}`, http.StatusForbidden)
+			return
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
 
+// RequireScope creates middleware that rejects API tokens lacking scope. Session tokens pass.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value("claims").(*auth.Claims)
+			if !ok {
+				http.Error(w, `{"error":"Unauthorized"}`, http.StatusUnauthorized)
+				return
+			}
+
+			if !claims.HasScope(scope) {
+				http.Error(w, `{"error":"Token lacks required scope: `+scope+`"}`, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireAdminScope creates middleware for admin-only endpoints that an admin's API token
+// may reach with scope instead of the full admin scope
+func RequireAdminScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value("claims").(*auth.Claims)
+			if !ok {
+				http.Error(w, `{"error":"Unauthorized"}`, http.StatusUnauthorized)
+				return
+			}
+
+			if claims.Role != "admin" {
+				http.Error(w, `{"error":"Admin access required"}`, http.StatusForbidden)
+				return
+			}
+
+			if !claims.HasScope(scope) {
+				http.Error(w, `{"error":"Token lacks required scope: `+scope+`"}`, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // CORS middleware to handle cross-origin requests
 func CORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
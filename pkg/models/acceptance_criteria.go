@@ -88,6 +88,8 @@ type AcceptanceCriteriaSummary struct {
 	BlockedCount int   `json:"blocked_count"`
 	SkippedCount int   `json:"skipped_count"`
 	Percentage   float64 `json:"percentage"` // % of passed criteria
+	MustCount       int  `json:"must_count"`
+	MustPassedCount int  `json:"must_passed_count"`
 }
 
 // Entity type constants
@@ -0,0 +1,90 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package models
+
+import "time"
+
+// What happens to AI changes that break a rule
+const (
+	AIEnforcementAdvisory  = "advisory"  // Changes are made and the violations recorded
+	AIEnforcementBlock     = "block"     // Changes that break a rule are refused
+	AIEnforcementTerminate = "terminate" // The first violation also stops the AI run
+)
+
+// Rules an AI change can break
+const (
+	AIRuleForbiddenPath    = "forbidden_path"
+	AIRuleMaxFileSize      = "max_file_size"
+	AIRuleLicenseHeader    = "license_header"
+	AIRuleBannedDependency = "banned_dependency"
+	AIRuleTestCoverage     = "test_coverage"
+)
+
+// Human review of an audited AI change
+const (
+	AIReviewPending  = "pending"
+	AIReviewApproved = "approved"
+	AIReviewRejected = "rejected"
+)
+
+// AIRuleSet is the machine-checkable form of an AI policy preset. A workspace may add to
+// its preset's rules in a .ubegovernance.json file.
+type AIRuleSet struct {
+	Preset             int      `json:"preset"`
+	Name               string   `json:"name"`
+	Enforcement        string   `json:"enforcement"`
+	ForbiddenPaths     []string `json:"forbiddenPaths,omitempty"`     // Globs the AI may not write; ** matches any directories
+	MinTestCoverage    float64  `json:"minTestCoverage,omitempty"`    // Share of changed source files that need a test, 0 to 1
+	LicenseHeader      string   `json:"licenseHeader,omitempty"`      // Text every source file must start with
+	BannedDependencies []string `json:"bannedDependencies,omitempty"` // Packages the AI may not add to a manifest
+	MaxFileBytes       int      `json:"maxFileBytes,omitempty"`
+	HumanReview        bool     `json:"humanReview,omitempty"` // AI changes wait for a reviewer's approval
+}
+
+// AIViolation is a rule an AI change broke
+type AIViolation struct {
+	Rule    string `json:"rule"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+// AIAuditEntry records an AI run that changed, or tried to change, workspace files under
+// a rule set
+type AIAuditEntry struct {
+	ID            int64         `json:"id"`
+	WorkspaceID   *int          `json:"workspace_id,omitempty"`
+	UserID        *int          `json:"user_id,omitempty"`
+	Endpoint      string        `json:"endpoint"` // e.g. /ai-chat, or the job kind for background jobs
+	WorkspacePath string        `json:"workspace_path"`
+	Preset        int           `json:"preset"`
+	Enforcement   string        `json:"enforcement"`
+	Files         []string      `json:"files"` // Files changed
+	Violations    []AIViolation `json:"violations"`
+	Blocked       bool          `json:"blocked"` // Changes were refused or the run was stopped
+	ReviewStatus  string        `json:"review_status,omitempty"`
+	ReviewedBy    *int          `json:"reviewed_by,omitempty"`
+	ReviewComment string        `json:"review_comment,omitempty"`
+	ReviewedAt    *time.Time    `json:"reviewed_at,omitempty"`
+	CreatedAt     time.Time     `json:"created_at"`
+}
+
+// AIAuditFilter selects audit entries, newest first
+type AIAuditFilter struct {
+	WorkspaceID    *int
+	UserID         *int
+	ReviewStatus   string
+	WithViolations bool
+	Limit          int
+}
+
+// ReviewAIAuditRequest approves or rejects an audited AI change
+type ReviewAIAuditRequest struct {
+	Status  string `json:"status"` // approved, rejected
+	Comment string `json:"comment,omitempty"`
+}
@@ -0,0 +1,105 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package models
+
+import "time"
+
+// What an AI budget applies to
+const (
+	BudgetScopeWorkspace = "workspace"
+	BudgetScopeUser      = "user"
+)
+
+// How often an AI budget resets
+const (
+	BudgetDaily   = "daily"
+	BudgetMonthly = "monthly"
+)
+
+// Where spend stands against a budget
+const (
+	BudgetOK       = "ok"
+	BudgetWarning  = "warning"  // At or over the soft limit
+	BudgetExceeded = "exceeded" // At or over the hard limit; AI calls are refused
+)
+
+// AIUsage is one call to a model
+type AIUsage struct {
+	ID                  int64     `json:"id"`
+	WorkspaceID         *int      `json:"workspace_id,omitempty"`
+	UserID              *int      `json:"user_id,omitempty"`
+	Endpoint            string    `json:"endpoint"`
+	Model               string    `json:"model"`
+	InputTokens         int       `json:"input_tokens"`
+	OutputTokens        int       `json:"output_tokens"`
+	CacheCreationTokens int       `json:"cache_creation_tokens"`
+	CacheReadTokens     int       `json:"cache_read_tokens"`
+	CostUSD             float64   `json:"cost_usd"`
+	LatencyMs           int64     `json:"latency_ms"`
+	PromptTemplate      string    `json:"prompt_template,omitempty"` // name@version:hash of the prompt template used
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+// AIUsageFilter selects the usage a report covers. From is inclusive, To exclusive.
+type AIUsageFilter struct {
+	WorkspaceID *int
+	UserID      *int
+	From        time.Time
+	To          time.Time
+	GroupBy     string // workspace, user, model, endpoint or prompt
+}
+
+// AIUsageDay is the usage of one group, e.g. a workspace, on one day
+type AIUsageDay struct {
+	Day                 string  `json:"day,omitempty"` // YYYY-MM-DD
+	Key                 string  `json:"key"`           // Workspace ID, user ID, model, endpoint or prompt; empty when unknown
+	Calls               int     `json:"calls"`
+	InputTokens         int64   `json:"input_tokens"`
+	OutputTokens        int64   `json:"output_tokens"`
+	CacheCreationTokens int64   `json:"cache_creation_tokens"`
+	CacheReadTokens     int64   `json:"cache_read_tokens"`
+	CostUSD             float64 `json:"cost_usd"`
+}
+
+// AIUsageReport is the daily usage of each group over a period and the group totals
+type AIUsageReport struct {
+	From    string       `json:"from"`
+	To      string       `json:"to"`
+	GroupBy string       `json:"group_by"`
+	Days    []AIUsageDay `json:"days"`
+	Totals  []AIUsageDay `json:"totals"` // One entry per group, without a day
+	CostUSD float64      `json:"cost_usd"`
+}
+
+// AIBudget limits what a workspace or user may spend on AI per period. Either limit may
+// be left unset.
+type AIBudget struct {
+	ID           int       `json:"id"`
+	Scope        string    `json:"scope"`    // workspace, user
+	ScopeID      int       `json:"scope_id"` // Workspace or user ID
+	Period       string    `json:"period"`   // daily, monthly
+	SoftLimitUSD *float64  `json:"soft_limit_usd,omitempty"`
+	HardLimitUSD *float64  `json:"hard_limit_usd,omitempty"`
+	CreatedBy    *int      `json:"created_by,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+
+	// Filled in when budgets are listed
+	SpentUSD float64 `json:"spent_usd"`
+	Status   string  `json:"status,omitempty"`
+}
+
+// SetAIBudgetRequest creates or replaces the budget of a workspace or user
+type SetAIBudgetRequest struct {
+	Scope        string   `json:"scope"`
+	ScopeID      int      `json:"scopeId"`
+	Period       string   `json:"period"`
+	SoftLimitUSD *float64 `json:"softLimitUsd"`
+	HardLimitUSD *float64 `json:"hardLimitUsd"`
+}
@@ -71,6 +71,13 @@ type CapabilityApproval struct {
 	DeciderName  string     `json:"decider_name,omitempty"` // Joined from users table
 	Feedback     *string    `json:"feedback,omitempty"`
 
+	// SLA tracking
+	RemindersSent     int        `json:"reminders_sent"`
+	LastReminderAt    *time.Time `json:"last_reminder_at,omitempty"`
+	EscalatedAt       *time.Time `json:"escalated_at,omitempty"`
+	EscalatedToRole   *string    `json:"escalated_to_role,omitempty"`
+	EscalatedToUserID *int       `json:"escalated_to_user_id,omitempty"`
+
 	// Timestamps
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
@@ -93,7 +100,7 @@ type ApprovalAuditLog struct {
 	ID           int             `json:"id"`
 	ApprovalID   *int            `json:"approval_id,omitempty"`
 	CapabilityID int             `json:"capability_id"`
-	Action       string          `json:"action"` // 'requested', 'approved', 'rejected', 'withdrawn'
+	Action       string          `json:"action"` // 'requested', 'approved', 'rejected', 'withdrawn', 'escalated'
 	Stage        string          `json:"stage"`
 	PerformedBy  int             `json:"performed_by"`
 	PerformerName string         `json:"performer_name,omitempty"` // Joined from users table
@@ -128,6 +135,7 @@ type ApprovalResponse struct {
 	CanApprove     bool                `json:"can_approve"`
 	CanReject      bool                `json:"can_reject"`
 	CanWithdraw    bool                `json:"can_withdraw"`
+	SLA            *ApprovalSLAStatus  `json:"sla,omitempty"`
 }
 
 // PendingApprovalsResponse lists pending approvals with counts
@@ -147,6 +155,38 @@ type ApprovalHistoryResponse struct {
 	AuditLog       []ApprovalAuditLog   `json:"audit_log"`
 }
 
+// ApprovalSLARule defines how long a stage may wait for a decision
+type ApprovalSLARule struct {
+	ID               int       `json:"id"`
+	Stage            string    `json:"stage"`
+	SLAHours         int       `json:"sla_hours"`
+	ReminderHours    []int     `json:"reminder_hours"` // Ages (in hours) at which approvers are reminded
+	EscalationRole   string    `json:"escalation_role,omitempty"`
+	EscalationUserID *int      `json:"escalation_user_id,omitempty"`
+	IsActive         bool      `json:"is_active"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// UpdateApprovalSLARuleRequest is the request body for saving a stage SLA
+type UpdateApprovalSLARuleRequest struct {
+	SLAHours         int    `json:"sla_hours"`
+	ReminderHours    []int  `json:"reminder_hours"`
+	EscalationRole   string `json:"escalation_role,omitempty"`
+	EscalationUserID *int   `json:"escalation_user_id,omitempty"`
+	IsActive         *bool  `json:"is_active,omitempty"`
+}
+
+// ApprovalSLAStatus describes where a pending approval stands against its SLA
+type ApprovalSLAStatus struct {
+	AgeHours      float64    `json:"age_hours"`
+	SLAHours      int        `json:"sla_hours,omitempty"`
+	DueAt         *time.Time `json:"due_at,omitempty"`
+	Breached      bool       `json:"breached"`
+	RemindersSent int        `json:"reminders_sent"`
+	Escalated     bool       `json:"escalated"`
+}
+
 // StageTransition represents a valid stage transition
 type StageTransition struct {
 	FromStage WorkflowStage
@@ -23,6 +23,7 @@ type Capability struct {
 	UpdatedAt           time.Time `json:"updated_at"`
 	CreatedBy           *int      `json:"created_by"`
 	IsActive            bool      `json:"is_active"`
+	WorkspaceID         *int      `json:"workspace_id,omitempty"`
 	// Approval workflow fields
 	WorkflowStage  *string `json:"workflow_stage,omitempty"`
 	ApprovalStatus *string `json:"approval_status,omitempty"`
@@ -70,6 +71,7 @@ type CreateCapabilityRequest struct {
 	UpstreamDependencies []int   `json:"upstream_dependencies"`
 	DownstreamDependencies []int `json:"downstream_dependencies"`
 	Assets              []CreateAssetRequest `json:"assets"`
+	WorkspaceID         *int                 `json:"workspace_id,omitempty"`
 }
 
 // CreateAssetRequest represents the request to create a capability asset
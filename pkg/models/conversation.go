@@ -0,0 +1,88 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Artifacts a conversation can be scoped to
+const (
+	ArtifactCapability = "capability"
+	ArtifactEnabler    = "enabler"
+	ArtifactStory      = "story"
+)
+
+// Conversation is an AI chat thread in a workspace, optionally about a single capability,
+// enabler or story
+type Conversation struct {
+	ID                int                   `json:"id"`
+	WorkspaceID       int                   `json:"workspace_id"`
+	ArtifactType      string                `json:"artifact_type,omitempty"`
+	ArtifactID        string                `json:"artifact_id,omitempty"`
+	Title             string                `json:"title"`
+	Model             string                `json:"model,omitempty"`
+	Summary           string                `json:"summary,omitempty"`
+	SummarizedThrough *int64                `json:"summarized_through,omitempty"` // Last message covered by Summary
+	ForkedFrom        *int                  `json:"forked_from,omitempty"`
+	MessageCount      int                   `json:"message_count"`
+	InputTokens       int                   `json:"input_tokens"`
+	OutputTokens      int                   `json:"output_tokens"`
+	CreatedBy         *int                  `json:"created_by,omitempty"`
+	CreatedAt         time.Time             `json:"created_at"`
+	UpdatedAt         time.Time             `json:"updated_at"`
+	Messages          []ConversationMessage `json:"messages,omitempty"`
+}
+
+// ConversationMessage is a message of a conversation. Assistant replies carry the tool
+// calls the model made and the files it changed.
+type ConversationMessage struct {
+	ID             int64           `json:"id"`
+	ConversationID int             `json:"conversation_id"`
+	Role           string          `json:"role"` // user, assistant
+	Content        string          `json:"content"`
+	ToolCalls      json.RawMessage `json:"tool_calls,omitempty"`
+	FileChanges    []FileChange    `json:"file_changes,omitempty"`
+	Model          string          `json:"model,omitempty"`
+	InputTokens    int             `json:"input_tokens"`
+	OutputTokens   int             `json:"output_tokens"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// FileChange is a file an AI reply created or modified
+type FileChange struct {
+	Path   string `json:"path"`   // Relative to the workspace
+	Action string `json:"action"` // create, modify
+	Bytes  int    `json:"bytes"`
+	SpecID string `json:"spec_id,omitempty"` // ID declared by a written spec file
+}
+
+// ConversationFilter narrows a conversation listing; zero values match everything
+type ConversationFilter struct {
+	WorkspaceID  int
+	ArtifactType string
+	ArtifactID   string // Also matches threads that wrote the spec with this ID
+	Query        string // Searched in titles, summaries and messages
+	Limit        int
+}
+
+// CreateConversationRequest is the body of POST /conversations
+type CreateConversationRequest struct {
+	WorkspaceID  int    `json:"workspaceId"`
+	ArtifactType string `json:"artifactType,omitempty"`
+	ArtifactID   string `json:"artifactId,omitempty"`
+	Title        string `json:"title,omitempty"`
+}
+
+// ForkConversationRequest is the body of POST /conversations/{id}/fork
+type ForkConversationRequest struct {
+	MessageID int64  `json:"messageId,omitempty"` // Last message to keep; 0 keeps them all
+	Title     string `json:"title,omitempty"`
+}
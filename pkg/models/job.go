@@ -0,0 +1,76 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Job statuses
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Job kinds run by the integration service
+const (
+	JobGenerateCode          = "generate_code"
+	JobGenerateCodeCLI       = "generate_code_cli"
+	JobAnalyzeApplication    = "analyze_application"
+	JobAnalyzeSpecifications = "analyze_specifications"
+)
+
+// Job is a long-running operation executed by a background worker. Params never hold
+// API keys; those stay in the memory of the process that accepted the job.
+type Job struct {
+	ID              int             `json:"id"`
+	Kind            string          `json:"kind"`
+	Status          string          `json:"status"`
+	WorkspacePath   string          `json:"workspace_path,omitempty"`
+	CreatedBy       *int            `json:"created_by,omitempty"`
+	Params          json.RawMessage `json:"params"`
+	Result          json.RawMessage `json:"result,omitempty"`
+	Error           string          `json:"error,omitempty"`
+	Progress        int             `json:"progress"` // Percent
+	ProgressMessage string          `json:"progress_message,omitempty"`
+	Attempts        int             `json:"attempts"`
+	MaxAttempts     int             `json:"max_attempts"`
+	RunAfter        time.Time       `json:"run_after"`
+	CancelRequested bool            `json:"cancel_requested"`
+	CreatedAt       time.Time       `json:"created_at"`
+	StartedAt       *time.Time      `json:"started_at,omitempty"`
+	FinishedAt      *time.Time      `json:"finished_at,omitempty"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+}
+
+// Finished reports whether the job has reached a final status
+func (j *Job) Finished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobCancelled
+}
+
+// JobLog is a line of a job's log
+type JobLog struct {
+	ID        int64     `json:"id"`
+	JobID     int       `json:"job_id"`
+	Level     string    `json:"level"` // info, warn, error
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// JobFilter narrows a job listing; zero values match everything
+type JobFilter struct {
+	Status    string
+	Kind      string
+	CreatedBy *int
+	Limit     int
+}
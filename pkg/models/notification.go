@@ -0,0 +1,153 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// NotificationEventType identifies what happened
+type NotificationEventType string
+
+const (
+	EventApprovalRequested    NotificationEventType = "approval_requested"
+	EventApprovalDecided      NotificationEventType = "approval_decided"
+	EventCriteriaFailed       NotificationEventType = "criteria_failed"
+	EventAIGenerationFinished NotificationEventType = "ai_generation_finished"
+	EventApprovalDigest       NotificationEventType = "approval_digest"
+	EventApprovalReminder     NotificationEventType = "approval_reminder"
+	EventApprovalEscalated    NotificationEventType = "approval_escalated"
+)
+
+// ValidNotificationEventTypes returns all valid notification event types
+func ValidNotificationEventTypes() []NotificationEventType {
+	return []NotificationEventType{
+		EventApprovalRequested,
+		EventApprovalDecided,
+		EventCriteriaFailed,
+		EventAIGenerationFinished,
+		EventApprovalDigest,
+		EventApprovalReminder,
+		EventApprovalEscalated,
+	}
+}
+
+// IsValidNotificationEventType checks if an event type string is valid
+func IsValidNotificationEventType(eventType string) bool {
+	for _, t := range ValidNotificationEventTypes() {
+		if string(t) == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// NotificationChannel identifies a delivery channel
+type NotificationChannel string
+
+const (
+	ChannelInApp NotificationChannel = "in_app"
+	ChannelEmail NotificationChannel = "email"
+	ChannelSlack NotificationChannel = "slack"
+	ChannelTeams NotificationChannel = "teams"
+)
+
+// Notification represents an in-app inbox entry
+type Notification struct {
+	ID         int                   `json:"id"`
+	UserID     int                   `json:"user_id"`
+	EventType  NotificationEventType `json:"event_type"`
+	Title      string                `json:"title"`
+	Body       string                `json:"body"`
+	Link       string                `json:"link,omitempty"`
+	EntityType string                `json:"entity_type,omitempty"`
+	EntityID   *int                  `json:"entity_id,omitempty"`
+	Metadata   json.RawMessage       `json:"metadata,omitempty"`
+	ReadAt     *time.Time            `json:"read_at,omitempty"`
+	CreatedAt  time.Time             `json:"created_at"`
+}
+
+// NotificationPreference holds a user's channel choices for one event type
+type NotificationPreference struct {
+	UserID       int                   `json:"user_id"`
+	EventType    NotificationEventType `json:"event_type"`
+	InAppEnabled bool                  `json:"in_app_enabled"`
+	EmailEnabled bool                  `json:"email_enabled"`
+	SlackEnabled bool                  `json:"slack_enabled"`
+	TeamsEnabled bool                  `json:"teams_enabled"`
+}
+
+// DefaultNotificationPreference returns the preference used when a user has not saved one
+func DefaultNotificationPreference(userID int, eventType NotificationEventType) NotificationPreference {
+	return NotificationPreference{
+		UserID:       userID,
+		EventType:    eventType,
+		InAppEnabled: true,
+		EmailEnabled: true,
+	}
+}
+
+// Enabled reports whether the preference allows delivery on a channel
+func (p NotificationPreference) Enabled(channel NotificationChannel) bool {
+	switch channel {
+	case ChannelInApp:
+		return p.InAppEnabled
+	case ChannelEmail:
+		return p.EmailEnabled
+	case ChannelSlack:
+		return p.SlackEnabled
+	case ChannelTeams:
+		return p.TeamsEnabled
+	default:
+		return false
+	}
+}
+
+// NotificationTemplate is a stored override for a built-in template
+type NotificationTemplate struct {
+	EventType       NotificationEventType `json:"event_type"`
+	Channel         string                `json:"channel"`
+	SubjectTemplate string                `json:"subject_template"`
+	BodyTemplate    string                `json:"body_template"`
+}
+
+// NotificationRecipient is the contact information for a user
+type NotificationRecipient struct {
+	UserID int    `json:"user_id"`
+	Email  string `json:"email"`
+	Name   string `json:"name"`
+	Role   string `json:"role"`
+}
+
+// NotificationEvent is published by services when something noteworthy happens
+type NotificationEvent struct {
+	Type       NotificationEventType  `json:"type"`
+	UserIDs    []int                  `json:"user_ids,omitempty"`
+	Roles      []string               `json:"roles,omitempty"`
+	EntityType string                 `json:"entity_type,omitempty"`
+	EntityID   int                    `json:"entity_id,omitempty"`
+	Link       string                 `json:"link,omitempty"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+}
+
+// NotificationListResponse wraps a user's inbox
+type NotificationListResponse struct {
+	Notifications []Notification `json:"notifications"`
+	UnreadCount   int            `json:"unread_count"`
+}
+
+// UpdateNotificationPreferenceRequest is the request body for saving a preference
+type UpdateNotificationPreferenceRequest struct {
+	EventType    string `json:"event_type"`
+	InAppEnabled bool   `json:"in_app_enabled"`
+	EmailEnabled bool   `json:"email_enabled"`
+	SlackEnabled bool   `json:"slack_enabled"`
+	TeamsEnabled bool   `json:"teams_enabled"`
+}
@@ -0,0 +1,196 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package models
+
+import "time"
+
+// Permissions granted by roles. They share their names with API token scopes.
+const (
+	PermCapabilitiesRead     = "capabilities:read"
+	PermCapabilitiesWrite    = "capabilities:write"
+	PermApprovalsRead        = "approvals:read"
+	PermApprovalsWrite       = "approvals:write"
+	PermApprovalsManage      = "approvals:manage"
+	PermNotificationsRead    = "notifications:read"
+	PermNotificationsWrite   = "notifications:write"
+	PermNotificationsPublish = "notifications:publish"
+	PermSearchRead           = "search:read"
+	PermSearchWrite          = "search:write"
+	PermSpecificationsRead   = "specifications:read"
+	PermSpecificationsWrite  = "specifications:write"
+	PermAIGenerate           = "ai:generate"
+	PermWorkspacesShared     = "workspaces:shared"
+	PermWorkspacesAdmin      = "workspaces:admin"
+)
+
+// PermissionInfo describes a permission for role editors
+type PermissionInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// AllPermissions lists every permission a role can hold
+var AllPermissions = []PermissionInfo{
+	{PermCapabilitiesRead, "View capabilities, enablers, requirements and acceptance criteria"},
+	{PermCapabilitiesWrite, "Create, edit, verify and delete capabilities and their children"},
+	{PermApprovalsRead, "View approvals, history and readiness"},
+	{PermApprovalsWrite, "Request, approve, reject and withdraw approvals, subject to stage rules"},
+	{PermApprovalsManage, "Edit stage gates, SLA rules and run approval jobs"},
+	{PermNotificationsRead, "Read own notifications"},
+	{PermNotificationsWrite, "Manage own notifications"},
+	{PermNotificationsPublish, "Publish notification events to any user or role"},
+	{PermSearchRead, "Search specifications and records"},
+	{PermSearchWrite, "Update the search index"},
+	{PermSpecificationsRead, "Read workspace files"},
+	{PermSpecificationsWrite, "Create, edit and delete workspace files"},
+	{PermAIGenerate, "Run AI analysis, chat and code generation"},
+	{PermWorkspacesShared, "Use the global role in shared workspaces"},
+	{PermWorkspacesAdmin, "Use the global role in every workspace"},
+}
+
+// IsKnownPermission reports whether name is a defined permission
+func IsKnownPermission(name string) bool {
+	for _, p := range AllPermissions {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Role is a named set of permissions
+type Role struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	IsSystem    bool      `json:"is_system"`
+	RequireMFA  bool      `json:"require_mfa"` // Users with this role must sign in with a second factor
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// RoleRequest creates or updates a role
+type RoleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	RequireMFA  bool     `json:"require_mfa"`
+	Permissions []string `json:"permissions"`
+}
+
+// WorkspaceMember ties a user to a workspace with a role
+type WorkspaceMember struct {
+	ID          int       `json:"id"`
+	WorkspaceID int       `json:"workspace_id"`
+	UserID      int       `json:"user_id"`
+	UserName    string    `json:"user_name"`
+	UserEmail   string    `json:"user_email"`
+	RoleID      int       `json:"role_id"`
+	RoleName    string    `json:"role_name"`
+	AddedBy     *int      `json:"added_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// WorkspaceMemberRequest adds a member or changes their role
+type WorkspaceMemberRequest struct {
+	UserID int    `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+// WorkspaceAccess is what a user may do inside one workspace
+type WorkspaceAccess struct {
+	WorkspaceID int      `json:"workspace_id"`
+	Name        string   `json:"name"`
+	Folder      string   `json:"folder,omitempty"`
+	Permissions []string `json:"permissions"`
+}
+
+// AccessGrant is a user's effective permissions. Permissions apply to records that belong
+// to no workspace (and to workspace folders not registered in the database); Workspaces
+// lists every workspace the user can see.
+type AccessGrant struct {
+	UserID      int               `json:"user_id"`
+	Role        string            `json:"role"`
+	Permissions []string          `json:"permissions"`
+	Workspaces  []WorkspaceAccess `json:"workspaces"`
+	// Every registered workspace folder, so unregistered folders can be told apart
+	KnownFolders []string `json:"known_folders,omitempty"`
+}
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Can reports whether the grant holds permission outside any workspace
+func (g *AccessGrant) Can(permission string) bool {
+	return permission == "" || containsString(g.Permissions, permission)
+}
+
+// CanAnywhere reports whether permission is held globally or in at least one workspace
+func (g *AccessGrant) CanAnywhere(permission string) bool {
+	if g.Can(permission) {
+		return true
+	}
+	for _, ws := range g.Workspaces {
+		if containsString(ws.Permissions, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanInWorkspace reports whether permission is held for a record in workspaceID, where nil
+// means the record belongs to no workspace
+func (g *AccessGrant) CanInWorkspace(permission string, workspaceID *int) bool {
+	if permission == "" {
+		return true
+	}
+	if workspaceID == nil {
+		return g.Can(permission)
+	}
+	for _, ws := range g.Workspaces {
+		if ws.WorkspaceID == *workspaceID {
+			return containsString(ws.Permissions, permission)
+		}
+	}
+	return false
+}
+
+// CanInFolder reports whether permission is held for files in a workspace folder. Folders
+// that no workspace row claims fall back to the global permissions.
+func (g *AccessGrant) CanInFolder(permission, folder string) bool {
+	if permission == "" {
+		return true
+	}
+	for _, ws := range g.Workspaces {
+		if ws.Folder != "" && ws.Folder == folder {
+			return containsString(ws.Permissions, permission)
+		}
+	}
+	if containsString(g.KnownFolders, folder) {
+		return false
+	}
+	return g.Can(permission)
+}
+
+// WorkspaceIDsWith returns the workspaces in which permission is held
+func (g *AccessGrant) WorkspaceIDsWith(permission string) []int {
+	ids := []int{}
+	for _, ws := range g.Workspaces {
+		if containsString(ws.Permissions, permission) {
+			ids = append(ids, ws.WorkspaceID)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,87 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Search document sources
+const (
+	SearchSourceSpec = "spec"
+	SearchSourceDB   = "db"
+)
+
+// SearchFacetFields are the fields a search can be filtered and faceted by
+var SearchFacetFields = []string{"type", "status", "stage", "priority", "owner"}
+
+// SearchDocument is one indexed spec file or database record
+type SearchDocument struct {
+	ID         int             `json:"id,omitempty"`
+	Source     string          `json:"source"`
+	DocType    string          `json:"doc_type"`
+	Ref        string          `json:"ref"`
+	RecordID   *int            `json:"record_id,omitempty"`
+	Workspace  string          `json:"workspace,omitempty"`
+	ExternalID string          `json:"external_id,omitempty"`
+	Title      string          `json:"title"`
+	Body       string          `json:"body,omitempty"`
+	Status     string          `json:"status,omitempty"`
+	Stage      string          `json:"stage,omitempty"`
+	Priority   string          `json:"priority,omitempty"`
+	Owner      string          `json:"owner,omitempty"`
+	Metadata   json.RawMessage `json:"metadata,omitempty"`
+	UpdatedAt  time.Time       `json:"updated_at,omitempty"`
+}
+
+// SearchQuery holds a free-text query plus facet filters
+type SearchQuery struct {
+	Text      string
+	Source    string
+	Workspace string
+	// Filters maps a facet field (see SearchFacetFields) to the accepted values
+	Filters map[string][]string
+	Limit   int
+	Offset  int
+	// Access restrictions from the caller's role: documents in HiddenWorkspaces never match,
+	// and a non-nil OnlyWorkspaces limits results to those workspaces
+	HiddenWorkspaces []string
+	OnlyWorkspaces   []string
+}
+
+// SearchHit is a ranked result with a highlighted snippet
+type SearchHit struct {
+	SearchDocument
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+// SearchFacetValue is one bucket of a facet
+type SearchFacetValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// SearchResponse is returned by GET /search
+type SearchResponse struct {
+	Query  string                        `json:"query"`
+	Total  int                           `json:"total"`
+	Hits   []SearchHit                   `json:"hits"`
+	Facets map[string][]SearchFacetValue `json:"facets"`
+}
+
+// IndexDocumentsRequest upserts or removes spec documents in the search index
+type IndexDocumentsRequest struct {
+	Documents []SearchDocument `json:"documents,omitempty"`
+	// RemoveRefs lists spec refs (workspace-relative paths) to drop from the index
+	RemoveRefs []string `json:"remove_refs,omitempty"`
+	// ReplaceWorkspace drops every spec document of the workspace before indexing
+	ReplaceWorkspace string `json:"replace_workspace,omitempty"`
+}
@@ -0,0 +1,98 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Gate check types
+const (
+	GateCheckValidTransition     = "valid_transition"
+	GateCheckMinEnablers         = "min_enablers"
+	GateCheckMustCriteriaWritten = "must_criteria_written"
+	GateCheckUIAssetsLinked      = "ui_assets_linked"
+	GateCheckMustCriteriaPassed  = "must_criteria_passed"
+)
+
+// Gate phases - when a rule is evaluated
+const (
+	GatePhaseRequest  = "request"
+	GatePhaseApproval = "approval"
+	GatePhaseBoth     = "both"
+)
+
+// ValidGateCheckTypes returns all supported gate check types
+func ValidGateCheckTypes() []string {
+	return []string{
+		GateCheckValidTransition,
+		GateCheckMinEnablers,
+		GateCheckMustCriteriaWritten,
+		GateCheckUIAssetsLinked,
+		GateCheckMustCriteriaPassed,
+	}
+}
+
+// IsValidGateCheckType checks if a check type string is supported
+func IsValidGateCheckType(checkType string) bool {
+	for _, t := range ValidGateCheckTypes() {
+		if t == checkType {
+			return true
+		}
+	}
+	return false
+}
+
+// StageGateRule is a readiness condition a capability must meet for a stage
+type StageGateRule struct {
+	ID          int             `json:"id"`
+	Stage       string          `json:"stage"`
+	CheckType   string          `json:"check_type"`
+	Description string          `json:"description"`
+	Params      json.RawMessage `json:"params,omitempty"`
+	AppliesTo   string          `json:"applies_to"` // request, approval, both
+	IsActive    bool            `json:"is_active"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// AppliesToPhase reports whether the rule is evaluated in the given phase
+func (r StageGateRule) AppliesToPhase(phase string) bool {
+	return r.AppliesTo == GatePhaseBoth || r.AppliesTo == phase
+}
+
+// SaveStageGateRuleRequest is the request body for creating or updating a gate rule
+type SaveStageGateRuleRequest struct {
+	Stage       string          `json:"stage"`
+	CheckType   string          `json:"check_type"`
+	Description string          `json:"description"`
+	Params      json.RawMessage `json:"params,omitempty"`
+	AppliesTo   string          `json:"applies_to"`
+	IsActive    *bool           `json:"is_active,omitempty"`
+}
+
+// GateCheckResult is the outcome of one gate rule
+type GateCheckResult struct {
+	RuleID      int    `json:"rule_id"`
+	CheckType   string `json:"check_type"`
+	Description string `json:"description"`
+	Passed      bool   `json:"passed"`
+	Message     string `json:"message"`
+}
+
+// ReadinessReport lists every gate condition for a capability/stage and whether it is met
+type ReadinessReport struct {
+	CapabilityID int               `json:"capability_id"`
+	Stage        string            `json:"stage"`
+	Phase        string            `json:"phase"`
+	Ready        bool              `json:"ready"`
+	Checks       []GateCheckResult `json:"checks"`
+	Unmet        []GateCheckResult `json:"unmet"`
+}
@@ -0,0 +1,114 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package models
+
+import "time"
+
+// WorkspacesDir is the folder, relative to the integration-service, holding every workspace
+const WorkspacesDir = "workspaces"
+
+// Workspace types, matching the web UI's choices
+var WorkspaceTypes = []string{"new", "refactor", "enhance", "reverse-engineer"}
+
+// Workspace is a registered workspace folder
+type Workspace struct {
+	ID            int                    `json:"id"`
+	Name          string                 `json:"name"`
+	Description   string                 `json:"description"`
+	FolderName    string                 `json:"folder_name"`
+	Path          string                 `json:"path"` // workspaces/<folder_name>
+	WorkspaceType string                 `json:"workspace_type"`
+	FigmaFileURL  string                 `json:"figma_file_url,omitempty"`
+	OwnerID       *int                   `json:"owner_id,omitempty"`
+	OwnerName     string                 `json:"owner_name,omitempty"`
+	OwnerEmail    string                 `json:"owner_email,omitempty"`
+	IsShared      bool                   `json:"is_shared"`
+	ConfigID      string                 `json:"config_id,omitempty"`
+	Settings      map[string]interface{} `json:"settings"`
+	MemberCount   int                    `json:"member_count"`
+	ArchivedAt    *time.Time             `json:"archived_at,omitempty"`
+	MissingSince  *time.Time             `json:"missing_since,omitempty"`
+	CreatedAt     time.Time              `json:"created_at"`
+	UpdatedAt     time.Time              `json:"updated_at"`
+}
+
+// IsArchived reports whether the workspace is read-only
+func (w *Workspace) IsArchived() bool {
+	return w.ArchivedAt != nil
+}
+
+// CreateWorkspaceRequest registers a workspace; the folder is derived from the name when empty
+type CreateWorkspaceRequest struct {
+	Name          string                    `json:"name"`
+	Description   string                    `json:"description"`
+	FolderName    string                    `json:"folder_name,omitempty"`
+	WorkspaceType string                    `json:"workspace_type,omitempty"`
+	FigmaFileURL  string                    `json:"figma_file_url,omitempty"`
+	IsShared      bool                      `json:"is_shared"`
+	ConfigID      string                    `json:"config_id,omitempty"`
+	Settings      map[string]interface{}    `json:"settings,omitempty"`
+	Template      *WorkspaceTemplateRequest `json:"template,omitempty"`
+}
+
+// WorkspaceTemplateRequest picks the catalog template a new workspace is scaffolded from
+type WorkspaceTemplateRequest struct {
+	ID         string            `json:"id"`
+	Version    string            `json:"version,omitempty"` // Newest version when empty
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// UpdateWorkspaceRequest changes a workspace; the folder cannot be renamed
+type UpdateWorkspaceRequest struct {
+	Name          *string                 `json:"name,omitempty"`
+	Description   *string                 `json:"description,omitempty"`
+	WorkspaceType *string                 `json:"workspace_type,omitempty"`
+	FigmaFileURL  *string                 `json:"figma_file_url,omitempty"`
+	IsShared      *bool                   `json:"is_shared,omitempty"`
+	Settings      *map[string]interface{} `json:"settings,omitempty"`
+}
+
+// TransferWorkspaceRequest hands a workspace to another user
+type TransferWorkspaceRequest struct {
+	OwnerID int `json:"owner_id"`
+}
+
+// WorkspaceIntegration links a workspace to a resource in an external integration
+type WorkspaceIntegration struct {
+	ID               int                    `json:"id"`
+	WorkspaceID      int                    `json:"workspace_id"`
+	IntegrationName  string                 `json:"integration_name"`
+	ResourceType     string                 `json:"resource_type"`
+	ResourceID       string                 `json:"resource_id"`
+	ResourceName     string                 `json:"resource_name"`
+	ResourceMetadata map[string]interface{} `json:"resource_metadata,omitempty"`
+	IsActive         bool                   `json:"is_active"`
+	CreatedBy        *int                   `json:"created_by,omitempty"`
+	CreatedAt        time.Time              `json:"created_at"`
+	UpdatedAt        time.Time              `json:"updated_at"`
+}
+
+// WorkspaceIntegrationRequest links a resource, or updates an existing link
+type WorkspaceIntegrationRequest struct {
+	IntegrationName  string                 `json:"integration_name"`
+	ResourceType     string                 `json:"resource_type"`
+	ResourceID       string                 `json:"resource_id"`
+	ResourceName     string                 `json:"resource_name"`
+	ResourceMetadata map[string]interface{} `json:"resource_metadata,omitempty"`
+	IsActive         *bool                  `json:"is_active,omitempty"`
+}
+
+// WorkspaceReconcileResult summarises a reconciliation of the registry with the disk
+type WorkspaceReconcileResult struct {
+	Registered []string `json:"registered"` // Folders found on disk and added to the registry
+	Updated    []string `json:"updated"`    // Rows refreshed from their .ubeworkspace file
+	Created    []string `json:"created"`    // Folders created for rows that had none
+	Missing    []string `json:"missing"`    // Rows whose folder is gone
+	Restored   []string `json:"restored"`   // Rows whose folder came back
+	Errors     []string `json:"errors,omitempty"`
+}
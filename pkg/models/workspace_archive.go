@@ -0,0 +1,95 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package models
+
+import (
+	"regexp"
+	"time"
+)
+
+// WorkspaceArchiveSchemaVersion is the archive layout written by export; import accepts
+// this version and older ones
+const WorkspaceArchiveSchemaVersion = 1
+
+// Conflict resolutions for workspace import
+const (
+	ImportConflictFail   = "fail"   // Refuse the import
+	ImportConflictRename = "rename" // Give clashing records and folders new identifiers
+)
+
+// WorkspaceArchiveManifest is the manifest.json at the root of a workspace archive
+type WorkspaceArchiveManifest struct {
+	SchemaVersion int                    `json:"schema_version"`
+	ExportedAt    time.Time              `json:"exported_at"`
+	Workspace     CreateWorkspaceRequest `json:"workspace"`
+	Files         []WorkspaceArchiveFile `json:"files"` // Every other entry in the archive
+	RecordCounts  map[string]int         `json:"record_counts"`
+}
+
+// WorkspaceArchiveFile is a checksummed entry in a workspace archive
+type WorkspaceArchiveFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// WorkspaceRecords holds a workspace's database rows, one JSON object per row keyed by
+// column. User columns hold IDs from the exporting install; Users maps them to emails.
+type WorkspaceRecords struct {
+	Users  map[string]string                   `json:"users"`
+	Tables map[string][]map[string]interface{} `json:"tables"`
+}
+
+// WorkspaceImportRequest controls how an archive is imported
+type WorkspaceImportRequest struct {
+	Name       string // Overrides the archived name
+	FolderName string // Overrides the archived folder
+	OnConflict string // ImportConflictFail or ImportConflictRename
+	DryRun     bool
+}
+
+// WorkspaceImportConflict is an identifier in the archive that is already taken here
+type WorkspaceImportConflict struct {
+	Table      string `json:"table"`
+	Column     string `json:"column"`
+	Value      string `json:"value"`
+	Resolution string `json:"resolution,omitempty"` // New value when renamed
+}
+
+// WorkspaceImportReport describes an import, or what an import would do on a dry run
+type WorkspaceImportReport struct {
+	DryRun        bool                      `json:"dry_run"`
+	SchemaVersion int                       `json:"schema_version"`
+	Name          string                    `json:"name"`
+	FolderName    string                    `json:"folder_name"`
+	Files         int                       `json:"files"`
+	Records       map[string]int            `json:"records"`
+	Conflicts     []WorkspaceImportConflict `json:"conflicts"`
+	Warnings      []string                  `json:"warnings"`
+	Workspace     *Workspace                `json:"workspace,omitempty"`
+}
+
+var secretKey = regexp.MustCompile(`(?i)(token|secret|password|passwd|api[_-]?key|credential|private[_-]?key)`)
+
+// RedactSecrets removes credential-like keys from values and any nested objects, returning
+// how many were removed
+func RedactSecrets(values map[string]interface{}) int {
+	removed := 0
+	for key, value := range values {
+		if secretKey.MatchString(key) {
+			delete(values, key)
+			removed++
+			continue
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			removed += RedactSecrets(nested)
+		}
+	}
+	return removed
+}
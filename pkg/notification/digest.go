@@ -0,0 +1,87 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package notification
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+// GroupPendingByRole buckets pending approvals under every role that may approve them
+func GroupPendingByRole(rules []models.ApprovalWorkflowRule, pending []models.ApprovalResponse) map[string][]models.ApprovalResponse {
+	grouped := make(map[string][]models.ApprovalResponse)
+	for _, p := range pending {
+		if p.Approval == nil {
+			continue
+		}
+		for _, role := range ApproverRoles(rules, string(p.Approval.Stage)) {
+			grouped[role] = append(grouped[role], p)
+		}
+	}
+	return grouped
+}
+
+// SendApprovalDigest sends one digest per approver role listing the approvals waiting on it
+func (n *Notifier) SendApprovalDigest(ctx context.Context, rules []models.ApprovalWorkflowRule, pending []models.ApprovalResponse) error {
+	grouped := GroupPendingByRole(rules, pending)
+
+	roles := make([]string, 0, len(grouped))
+	for role := range grouped {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+
+	var errs []error
+	for _, role := range roles {
+		err := n.Publish(ctx, models.NotificationEvent{
+			Type:  models.EventApprovalDigest,
+			Roles: []string{role},
+			Link:  "/approvals",
+			Data: map[string]interface{}{
+				"role":      role,
+				"approvals": grouped[role],
+			},
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RunDaily calls fn once a day at the given local hour until ctx is cancelled
+func RunDaily(ctx context.Context, hour int, fn func(ctx context.Context)) {
+	for {
+		wait := time.Until(nextRun(time.Now(), hour))
+		log.Printf("Next approval digest in %s", wait.Round(time.Minute))
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			fn(ctx)
+		}
+	}
+}
+
+// nextRun returns the next occurrence of hour:00 strictly after now
+func nextRun(now time.Time, hour int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
@@ -0,0 +1,270 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+func TestRenderDefaultTemplates(t *testing.T) {
+	tests := []struct {
+		name            string
+		eventType       models.NotificationEventType
+		data            map[string]interface{}
+		expectedSubject string
+		bodyContains    []string
+		bodyExcludes    []string
+	}{
+		{
+			name:      "Approval requested",
+			eventType: models.EventApprovalRequested,
+			data: map[string]interface{}{
+				"capability_name": "User Login",
+				"stage":           "design",
+				"requester_name":  "Ada",
+			},
+			expectedSubject: "Approval requested: User Login (design)",
+			bodyContains:    []string{"Ada requested approval", "http://app/approvals"},
+		},
+		{
+			name:      "Approval rejected with feedback",
+			eventType: models.EventApprovalDecided,
+			data: map[string]interface{}{
+				"capability_name": "User Login",
+				"stage":           "design",
+				"decider_name":    "Grace",
+				"decision":        "rejected",
+				"feedback":        "Missing error states",
+			},
+			expectedSubject: "Approval rejected: User Login (design)",
+			bodyContains:    []string{"Grace rejected", "Feedback: Missing error states"},
+		},
+		{
+			name:      "Approval approved without feedback",
+			eventType: models.EventApprovalDecided,
+			data: map[string]interface{}{
+				"capability_name": "User Login",
+				"stage":           "design",
+				"decider_name":    "Grace",
+				"decision":        "approved",
+			},
+			expectedSubject: "Approval approved: User Login (design)",
+			bodyExcludes:    []string{"Feedback:", "<no value>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, ok := DefaultTemplate(tt.eventType)
+			if !ok {
+				t.Fatalf("no default template for %s", tt.eventType)
+			}
+
+			msg, err := Render(tmpl, TemplateData{Data: tt.data, Link: "http://app/approvals"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if msg.Subject != tt.expectedSubject {
+				t.Errorf("expected subject %q, got %q", tt.expectedSubject, msg.Subject)
+			}
+			for _, s := range tt.bodyContains {
+				if !strings.Contains(msg.Body, s) {
+					t.Errorf("expected body to contain %q, got %q", s, msg.Body)
+				}
+			}
+			for _, s := range tt.bodyExcludes {
+				if strings.Contains(msg.Body, s) {
+					t.Errorf("expected body not to contain %q, got %q", s, msg.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderDigestTemplate(t *testing.T) {
+	tmpl, _ := DefaultTemplate(models.EventApprovalDigest)
+	requested := time.Date(2025, 3, 4, 9, 0, 0, 0, time.UTC)
+
+	msg, err := Render(tmpl, TemplateData{
+		Recipient: models.NotificationRecipient{Name: "Grace"},
+		Data: map[string]interface{}{
+			"role": "product_owner",
+			"approvals": []models.ApprovalResponse{
+				{
+					Approval:       &models.CapabilityApproval{Stage: models.StageDesign, RequesterName: "Ada", RequestedAt: requested},
+					CapabilityName: "User Login",
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if msg.Subject != "1 pending approval(s) for product_owner" {
+		t.Errorf("unexpected subject %q", msg.Subject)
+	}
+	if !strings.Contains(msg.Body, "User Login (design) requested by Ada on 2025-03-04") {
+		t.Errorf("unexpected body %q", msg.Body)
+	}
+}
+
+func TestGroupPendingByRole(t *testing.T) {
+	rules := []models.ApprovalWorkflowRule{
+		{Role: "admin", Stage: "all", CanApprove: true},
+		{Role: "designer", Stage: "design", CanApprove: true},
+		{Role: "designer", Stage: "execution", CanApprove: false},
+		{Role: "developer", Stage: "all", CanApprove: false},
+	}
+	pending := []models.ApprovalResponse{
+		{Approval: &models.CapabilityApproval{ID: 1, Stage: models.StageDesign}},
+		{Approval: &models.CapabilityApproval{ID: 2, Stage: models.StageExecution}},
+	}
+
+	grouped := GroupPendingByRole(rules, pending)
+
+	if len(grouped["admin"]) != 2 {
+		t.Errorf("expected admin to see 2 approvals, got %d", len(grouped["admin"]))
+	}
+	if len(grouped["designer"]) != 1 || grouped["designer"][0].Approval.ID != 1 {
+		t.Errorf("expected designer to see only approval 1, got %+v", grouped["designer"])
+	}
+	if _, ok := grouped["developer"]; ok {
+		t.Error("expected developer to have no digest")
+	}
+}
+
+func TestWebhookSenderPayloads(t *testing.T) {
+	tests := []struct {
+		name    string
+		channel models.NotificationChannel
+		check   func(t *testing.T, body map[string]interface{})
+	}{
+		{
+			name:    "Slack",
+			channel: models.ChannelSlack,
+			check: func(t *testing.T, body map[string]interface{}) {
+				text, _ := body["text"].(string)
+				if !strings.HasPrefix(text, "*Subject*\nBody") || !strings.Contains(text, "<http://app/x|Open in UbeCode>") {
+					t.Errorf("unexpected slack text %q", text)
+				}
+			},
+		},
+		{
+			name:    "Teams",
+			channel: models.ChannelTeams,
+			check: func(t *testing.T, body map[string]interface{}) {
+				if body["@type"] != "MessageCard" || body["title"] != "Subject" || body["text"] != "Body" {
+					t.Errorf("unexpected teams card %v", body)
+				}
+				if _, ok := body["potentialAction"]; !ok {
+					t.Error("expected teams card to include an OpenUri action")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Content-Type") != "application/json" {
+					t.Errorf("expected JSON content type, got %q", r.Header.Get("Content-Type"))
+				}
+				json.NewDecoder(r.Body).Decode(&received)
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			sender := NewWebhookSender(tt.channel, server.URL)
+			if err := sender.Send(context.Background(), Message{Subject: "Subject", Body: "Body", Link: "http://app/x"}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			tt.check(t, received)
+		})
+	}
+}
+
+func TestWebhookSenderError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("invalid_token"))
+	}))
+	defer server.Close()
+
+	err := NewWebhookSender(models.ChannelSlack, server.URL).Send(context.Background(), Message{Subject: "s"})
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("expected 403 error, got %v", err)
+	}
+}
+
+func TestEmailSenderMessage(t *testing.T) {
+	sender := NewEmailSender("smtp.example.com", "", "", "", "ubecode@example.com")
+
+	var gotAddr string
+	var gotMsg []byte
+	sender.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		gotAddr = addr
+		gotMsg = msg
+		return nil
+	}
+
+	err := sender.Send(context.Background(),
+		models.NotificationRecipient{UserID: 1, Email: "ada@example.com"},
+		Message{Subject: "Hello\r\nBcc: evil@example.com", Body: "Line one\nLine two"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if gotAddr != "smtp.example.com:587" {
+		t.Errorf("expected default port 587, got %s", gotAddr)
+	}
+	msg := string(gotMsg)
+	if strings.Contains(msg, "\r\nBcc:") {
+		t.Error("subject newline allowed header injection")
+	}
+	if !strings.Contains(msg, "Line one\r\nLine two") {
+		t.Errorf("expected CRLF line endings in body, got %q", msg)
+	}
+
+	if err := sender.Send(context.Background(), models.NotificationRecipient{UserID: 2}, Message{}); err == nil {
+		t.Error("expected error for recipient without email")
+	}
+}
+
+func TestNextRun(t *testing.T) {
+	loc := time.UTC
+	tests := []struct {
+		name     string
+		now      time.Time
+		hour     int
+		expected time.Time
+	}{
+		{"Before hour", time.Date(2025, 1, 1, 6, 30, 0, 0, loc), 8, time.Date(2025, 1, 1, 8, 0, 0, 0, loc)},
+		{"Exactly on hour", time.Date(2025, 1, 1, 8, 0, 0, 0, loc), 8, time.Date(2025, 1, 2, 8, 0, 0, 0, loc)},
+		{"After hour", time.Date(2025, 1, 31, 9, 0, 0, 0, loc), 8, time.Date(2025, 2, 1, 8, 0, 0, 0, loc)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextRun(tt.now, tt.hour); !got.Equal(tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
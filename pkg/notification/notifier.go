@@ -0,0 +1,260 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/jareynolds/ubecode/pkg/repository"
+)
+
+// Config holds delivery settings for the notifier
+type Config struct {
+	SMTPHost        string
+	SMTPPort        string
+	SMTPUsername    string
+	SMTPPassword    string
+	SMTPFrom        string
+	SlackWebhookURL string
+	TeamsWebhookURL string
+	// AppBaseURL is prefixed to relative notification links, e.g. http://localhost:6173
+	AppBaseURL string
+}
+
+// ConfigFromEnv reads notifier settings from environment variables
+func ConfigFromEnv() Config {
+	return Config{
+		SMTPHost:        os.Getenv("SMTP_HOST"),
+		SMTPPort:        os.Getenv("SMTP_PORT"),
+		SMTPUsername:    os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:    os.Getenv("SMTP_PASSWORD"),
+		SMTPFrom:        os.Getenv("SMTP_FROM"),
+		SlackWebhookURL: os.Getenv("SLACK_WEBHOOK_URL"),
+		TeamsWebhookURL: os.Getenv("TEAMS_WEBHOOK_URL"),
+		AppBaseURL:      strings.TrimSuffix(os.Getenv("APP_BASE_URL"), "/"),
+	}
+}
+
+// Notifier renders events and delivers them to the in-app inbox, email and chat webhooks
+type Notifier struct {
+	repo     *repository.NotificationRepository
+	email    *EmailSender
+	webhooks []*WebhookSender
+	baseURL  string
+}
+
+// NewNotifier creates a notifier. Channels without configuration are skipped.
+func NewNotifier(repo *repository.NotificationRepository, cfg Config) *Notifier {
+	n := &Notifier{
+		repo:    repo,
+		baseURL: cfg.AppBaseURL,
+	}
+
+	if cfg.SMTPHost != "" {
+		from := cfg.SMTPFrom
+		if from == "" {
+			from = "ubecode@localhost"
+		}
+		n.email = NewEmailSender(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, from)
+	}
+	if cfg.SlackWebhookURL != "" {
+		n.webhooks = append(n.webhooks, NewWebhookSender(models.ChannelSlack, cfg.SlackWebhookURL))
+	}
+	if cfg.TeamsWebhookURL != "" {
+		n.webhooks = append(n.webhooks, NewWebhookSender(models.ChannelTeams, cfg.TeamsWebhookURL))
+	}
+
+	return n
+}
+
+// PublishAsync delivers an event in the background, logging any failure.
+// Handlers use this so a slow SMTP server never delays an API response.
+func (n *Notifier) PublishAsync(event models.NotificationEvent) {
+	if n == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+		if err := n.Publish(ctx, event); err != nil {
+			log.Printf("Notification %s failed: %v", event.Type, err)
+		}
+	}()
+}
+
+// Publish resolves an event's recipients and delivers it on every channel they have enabled
+func (n *Notifier) Publish(ctx context.Context, event models.NotificationEvent) error {
+	if !models.IsValidNotificationEventType(string(event.Type)) {
+		return fmt.Errorf("invalid notification event type: %s", event.Type)
+	}
+
+	recipients, err := n.resolveRecipients(event)
+	if err != nil {
+		return err
+	}
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	link := n.absoluteLink(event.Link)
+	var errs []error
+	webhookWanted := make(map[models.NotificationChannel]TemplateData)
+
+	for _, rc := range recipients {
+		pref, err := n.repo.GetPreference(rc.UserID, event.Type)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		data := TemplateData{Recipient: rc, Event: event, Data: event.Data, Link: link}
+
+		if pref.Enabled(models.ChannelInApp) {
+			if err := n.deliverInApp(event, data); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		if pref.Enabled(models.ChannelEmail) && n.email != nil {
+			msg, err := n.render(event.Type, models.ChannelEmail, data)
+			if err == nil {
+				err = n.email.Send(ctx, rc, msg)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("email to user %d: %w", rc.UserID, err))
+			}
+		}
+
+		// Webhooks post to a shared channel, so send once per event rather than once per recipient
+		for _, wh := range n.webhooks {
+			if _, done := webhookWanted[wh.Channel()]; !done && pref.Enabled(wh.Channel()) {
+				webhookWanted[wh.Channel()] = data
+			}
+		}
+	}
+
+	for _, wh := range n.webhooks {
+		data, ok := webhookWanted[wh.Channel()]
+		if !ok {
+			continue
+		}
+		msg, err := n.render(event.Type, wh.Channel(), data)
+		if err == nil {
+			err = wh.Send(ctx, msg)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// deliverInApp stores the rendered notification in the recipient's inbox
+func (n *Notifier) deliverInApp(event models.NotificationEvent, data TemplateData) error {
+	msg, err := n.render(event.Type, models.ChannelInApp, data)
+	if err != nil {
+		return err
+	}
+
+	notification := &models.Notification{
+		UserID:     data.Recipient.UserID,
+		EventType:  event.Type,
+		Title:      msg.Subject,
+		Body:       msg.Body,
+		Link:       event.Link,
+		EntityType: event.EntityType,
+	}
+	if event.EntityID != 0 {
+		id := event.EntityID
+		notification.EntityID = &id
+	}
+	if len(event.Data) > 0 && event.Type != models.EventApprovalDigest {
+		if metadata, err := json.Marshal(event.Data); err == nil {
+			notification.Metadata = metadata
+		}
+	}
+
+	return n.repo.Create(notification)
+}
+
+// render picks the stored override for the event/channel, falling back to the built-in template
+func (n *Notifier) render(eventType models.NotificationEventType, channel models.NotificationChannel, data TemplateData) (Message, error) {
+	tmpl, ok := DefaultTemplate(eventType)
+	if !ok {
+		return Message{}, fmt.Errorf("no template for event type %s", eventType)
+	}
+
+	override, err := n.repo.GetTemplate(eventType, string(channel))
+	if err != nil {
+		log.Printf("Falling back to built-in %s template: %v", eventType, err)
+	} else if override != nil {
+		tmpl = Template{Subject: override.SubjectTemplate, Body: override.BodyTemplate}
+	}
+
+	return Render(tmpl, data)
+}
+
+// resolveRecipients merges explicit user IDs and role members, de-duplicated
+func (n *Notifier) resolveRecipients(event models.NotificationEvent) ([]models.NotificationRecipient, error) {
+	byID, err := n.repo.GetRecipients(event.UserIDs)
+	if err != nil {
+		return nil, err
+	}
+	byRole, err := n.repo.GetRecipientsByRoles(event.Roles)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int]bool)
+	var recipients []models.NotificationRecipient
+	for _, rc := range append(byID, byRole...) {
+		if seen[rc.UserID] {
+			continue
+		}
+		seen[rc.UserID] = true
+		recipients = append(recipients, rc)
+	}
+	return recipients, nil
+}
+
+// absoluteLink prefixes relative links with the configured frontend URL
+func (n *Notifier) absoluteLink(link string) string {
+	if link == "" || n.baseURL == "" || strings.Contains(link, "://") {
+		return link
+	}
+	if !strings.HasPrefix(link, "/") {
+		link = "/" + link
+	}
+	return n.baseURL + link
+}
+
+// ApproverRoles returns the roles allowed to approve a stage according to the workflow rules
+func ApproverRoles(rules []models.ApprovalWorkflowRule, stage string) []string {
+	seen := make(map[string]bool)
+	var roles []string
+	for _, rule := range rules {
+		if !rule.CanApprove || (rule.Stage != stage && rule.Stage != "all") {
+			continue
+		}
+		if !seen[rule.Role] {
+			seen[rule.Role] = true
+			roles = append(roles, rule.Role)
+		}
+	}
+	return roles
+}
@@ -0,0 +1,166 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+// EmailSender delivers notifications over SMTP
+type EmailSender struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewEmailSender creates a new SMTP sender
+func NewEmailSender(host, port, username, password, from string) *EmailSender {
+	if port == "" {
+		port = "587"
+	}
+	return &EmailSender{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		from:     from,
+		sendMail: smtp.SendMail,
+	}
+}
+
+// Send emails a rendered message to a single recipient
+func (s *EmailSender) Send(ctx context.Context, to models.NotificationRecipient, msg Message) error {
+	if to.Email == "" {
+		return fmt.Errorf("recipient %d has no email address", to.UserID)
+	}
+
+	var auth smtp.Auth
+	if s.username != "" {
+		auth = smtp.PlainAuth("", s.username, s.password, s.host)
+	}
+
+	body := msg.Body
+	if msg.Link != "" && !strings.Contains(body, msg.Link) {
+		body += "\n\n" + msg.Link
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", s.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", to.Email)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", sanitizeHeader(msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	if err := s.sendMail(s.host+":"+s.port, auth, s.from, []string{to.Email}, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// sanitizeHeader keeps user-controlled text from injecting extra headers
+func sanitizeHeader(value string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+}
+
+// WebhookSender posts notifications to a Slack or Microsoft Teams incoming webhook
+type WebhookSender struct {
+	channel    models.NotificationChannel
+	url        string
+	httpClient *http.Client
+}
+
+// NewWebhookSender creates a webhook sender for the slack or teams channel
+func NewWebhookSender(channel models.NotificationChannel, url string) *WebhookSender {
+	return &WebhookSender{
+		channel: channel,
+		url:     url,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// Channel returns the channel this webhook delivers to
+func (s *WebhookSender) Channel() models.NotificationChannel {
+	return s.channel
+}
+
+// Send posts a rendered message to the webhook
+func (s *WebhookSender) Send(ctx context.Context, msg Message) error {
+	payload, err := json.Marshal(s.payload(msg))
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s webhook failed with status %d: %s", s.channel, resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// payload builds the JSON body expected by the target chat product
+func (s *WebhookSender) payload(msg Message) interface{} {
+	if s.channel == models.ChannelTeams {
+		card := map[string]interface{}{
+			"@type":      "MessageCard",
+			"@context":   "http://schema.org/extensions",
+			"summary":    msg.Subject,
+			"title":      msg.Subject,
+			"text":       msg.Body,
+			"themeColor": "0076D7",
+		}
+		if msg.Link != "" {
+			card["potentialAction"] = []map[string]interface{}{
+				{
+					"@type": "OpenUri",
+					"name":  "Open in UbeCode",
+					"targets": []map[string]string{
+						{"os": "default", "uri": msg.Link},
+					},
+				},
+			}
+		}
+		return card
+	}
+
+	text := fmt.Sprintf("*%s*\n%s", msg.Subject, msg.Body)
+	if msg.Link != "" && !strings.Contains(msg.Body, msg.Link) {
+		text += fmt.Sprintf("\n<%s|Open in UbeCode>", msg.Link)
+	}
+	return map[string]string{"text": text}
+}
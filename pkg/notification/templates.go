@@ -0,0 +1,139 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package notification
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+// Template is a subject/body pair written in Go text/template syntax
+type Template struct {
+	Subject string
+	Body    string
+}
+
+// TemplateData is the value templates are executed against
+type TemplateData struct {
+	Recipient models.NotificationRecipient
+	Event     models.NotificationEvent
+	Data      map[string]interface{}
+	Link      string
+}
+
+// Message is a rendered notification ready for delivery
+type Message struct {
+	Subject string
+	Body    string
+	Link    string
+}
+
+// defaultTemplates are used when no override is stored in notification_templates
+var defaultTemplates = map[models.NotificationEventType]Template{
+	models.EventApprovalRequested: {
+		Subject: `Approval requested: {{.Data.capability_name}} ({{.Data.stage}})`,
+		Body: `{{.Data.requester_name}} requested approval for the {{.Data.stage}} stage of "{{.Data.capability_name}}".
+{{- if .Link}}
+
+Review it here: {{.Link}}{{end}}`,
+	},
+	models.EventApprovalDecided: {
+		Subject: `Approval {{.Data.decision}}: {{.Data.capability_name}} ({{.Data.stage}})`,
+		Body: `{{.Data.decider_name}} {{.Data.decision}} the {{.Data.stage}} stage of "{{.Data.capability_name}}".
+{{- with .Data.feedback}}
+
+Feedback: {{.}}{{end}}
+{{- if .Link}}
+
+View it here: {{.Link}}{{end}}`,
+	},
+	models.EventCriteriaFailed: {
+		Subject: `Acceptance criteria failed: {{.Data.criteria_id}} {{.Data.criteria_title}}`,
+		Body: `Acceptance criteria "{{.Data.criteria_title}}" on {{.Event.EntityType}} #{{.Event.EntityID}} was marked as failed.
+{{- with .Data.verification_notes}}
+
+Notes: {{.}}{{end}}
+{{- if .Link}}
+
+View it here: {{.Link}}{{end}}`,
+	},
+	models.EventAIGenerationFinished: {
+		Subject: `AI generation finished: {{.Data.workspace}}`,
+		Body: `{{.Data.summary}}
+{{- with .Data.error}}
+
+Error: {{.}}{{end}}`,
+	},
+	models.EventApprovalReminder: {
+		Subject: `Reminder: {{.Data.capability_name}} ({{.Data.stage}}) has been waiting {{.Data.age_hours}}h`,
+		Body: `The {{.Data.stage}} approval for "{{.Data.capability_name}}" requested by {{.Data.requester_name}} is still pending.
+{{- with .Data.due_at}}
+It is due by {{.}}.{{end}}
+{{- if .Link}}
+
+Review it here: {{.Link}}{{end}}`,
+	},
+	models.EventApprovalEscalated: {
+		Subject: `Escalated: {{.Data.capability_name}} ({{.Data.stage}}) missed its {{.Data.sla_hours}}h SLA`,
+		Body: `The {{.Data.stage}} approval for "{{.Data.capability_name}}" requested by {{.Data.requester_name}} has been pending for {{.Data.age_hours}} hours and was escalated to you.
+{{- if .Link}}
+
+Review it here: {{.Link}}{{end}}`,
+	},
+	models.EventApprovalDigest: {
+		Subject: `{{len .Data.approvals}} pending approval(s) for {{.Data.role}}`,
+		Body: `Good morning {{.Recipient.Name}}, the following approvals are waiting on the {{.Data.role}} role:
+{{range .Data.approvals}}
+  - {{.CapabilityName}} ({{.Approval.Stage}}) requested by {{.Approval.RequesterName}} on {{.Approval.RequestedAt.Format "2006-01-02"}}
+{{- end}}`,
+	},
+}
+
+// DefaultTemplate returns the built-in template for an event type
+func DefaultTemplate(eventType models.NotificationEventType) (Template, bool) {
+	t, ok := defaultTemplates[eventType]
+	return t, ok
+}
+
+// Render executes a template against the given data
+func Render(t Template, data TemplateData) (Message, error) {
+	subject, err := execute("subject", t.Subject, data)
+	if err != nil {
+		return Message{}, err
+	}
+	body, err := execute("body", t.Body, data)
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		Subject: strings.TrimSpace(subject),
+		Body:    strings.TrimSpace(body),
+		Link:    data.Link,
+	}, nil
+}
+
+func execute(name, text string, data TemplateData) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s template: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render %s template: %w", name, err)
+	}
+
+	// missingkey=zero renders absent map keys as "<no value>"
+	return strings.ReplaceAll(buf.String(), "<no value>", ""), nil
+}
@@ -0,0 +1,229 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package prompts
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// builtin holds the prompts the services ship with, as library/<name>/v<N>.tmpl
+//
+//go:embed library
+var builtin embed.FS
+
+// WorkspaceDir is the folder of a workspace holding its prompt overrides, one <name>.tmpl each
+const WorkspaceDir = ".ubeprompts"
+
+// versionFile matches the file of a numbered prompt version
+var versionFile = regexp.MustCompile(`^v([1-9][0-9]*)\.tmpl$`)
+
+// Library is the set of prompt templates: the builtin versions plus those in a directory
+// laid out the same way (<dir>/<name>/v<N>.tmpl). Files are read on every lookup, so a new
+// version takes effect as soon as it is saved. A directory version replaces the builtin
+// version with the same number, and the highest version of a prompt is the one used.
+type Library struct {
+	dir string
+	mu  sync.Mutex // Serialises saves
+}
+
+// NewLibrary creates a library reading from dir; with an empty dir only builtin prompts exist
+func NewLibrary(dir string) *Library {
+	return &Library{dir: dir}
+}
+
+// Dir returns the library directory
+func (l *Library) Dir() string {
+	return l.dir
+}
+
+// Names returns every prompt name in the library, sorted
+func (l *Library) Names() ([]string, error) {
+	seen := map[string]bool{}
+	entries, err := fs.ReadDir(builtin, "library")
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			seen[e.Name()] = true
+		}
+	}
+	if l.dir != "" {
+		entries, err := os.ReadDir(l.dir)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read prompt library: %w", err)
+		}
+		for _, e := range entries {
+			if e.IsDir() && validName.MatchString(e.Name()) {
+				seen[e.Name()] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Versions returns every version of a prompt, newest first. Files that cannot be parsed
+// are logged and left out.
+func (l *Library) Versions(name string) ([]*Prompt, error) {
+	if !validName.MatchString(name) {
+		return nil, ErrPromptNotFound
+	}
+
+	byNumber := map[int]*Prompt{}
+	read := func(fsys fs.FS, dir, source string) error {
+		entries, err := fs.ReadDir(fsys, dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read prompt %s: %w", name, err)
+		}
+		for _, e := range entries {
+			m := versionFile.FindStringSubmatch(e.Name())
+			if e.IsDir() || m == nil {
+				continue
+			}
+			data, err := fs.ReadFile(fsys, dir+"/"+e.Name())
+			if err != nil {
+				return fmt.Errorf("failed to read prompt %s: %w", name, err)
+			}
+			version := "v" + m[1]
+			p, err := Parse(name, version, source, data)
+			if err != nil {
+				log.Printf("Skipping prompt %s %s: %v", name, version, err)
+				continue
+			}
+			n, _ := strconv.Atoi(m[1])
+			byNumber[n] = p
+		}
+		return nil
+	}
+
+	if err := read(builtin, "library/"+name, SourceBuiltin); err != nil {
+		return nil, err
+	}
+	if l.dir != "" {
+		if err := read(os.DirFS(l.dir), name, SourceLibrary); err != nil {
+			return nil, err
+		}
+	}
+	if len(byNumber) == 0 {
+		return nil, ErrPromptNotFound
+	}
+
+	numbers := make([]int, 0, len(byNumber))
+	for n := range byNumber {
+		numbers = append(numbers, n)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(numbers)))
+	versions := make([]*Prompt, len(numbers))
+	for i, n := range numbers {
+		versions[i] = byNumber[n]
+	}
+	return versions, nil
+}
+
+// Get returns a version of a prompt, or its newest version when version is empty
+func (l *Library) Get(name, version string) (*Prompt, error) {
+	versions, err := l.Versions(name)
+	if err != nil {
+		return nil, err
+	}
+	if version == "" {
+		return versions[0], nil
+	}
+	for _, p := range versions {
+		if p.Version == version {
+			return p, nil
+		}
+	}
+	return nil, ErrPromptNotFound
+}
+
+// Resolve returns the prompt to use in a workspace: its override in .ubeprompts/<name>.tmpl
+// when it has one, else the newest library version. An override without a header takes the
+// variables and output schema of the library version.
+func (l *Library) Resolve(name, workspacePath string) (*Prompt, error) {
+	latest, err := l.Get(name, "")
+	if err != nil {
+		return nil, err
+	}
+	if workspacePath == "" {
+		return latest, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(workspacePath, WorkspaceDir, name+TemplateSuffix))
+	if errors.Is(err, fs.ErrNotExist) {
+		return latest, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workspace prompt %s: %w", name, err)
+	}
+	p, err := Parse(name, WorkspaceVersion, SourceWorkspace, data)
+	if err != nil {
+		return nil, err
+	}
+	if p.Description == "" && len(p.Variables) == 0 && len(p.OutputSchema) == 0 {
+		p.Description, p.Variables, p.OutputSchema = latest.Description, latest.Variables, latest.OutputSchema
+	}
+	return p, nil
+}
+
+// Save validates a prompt file and adds it to the library directory as the next version
+func (l *Library) Save(name string, data []byte) (*Prompt, error) {
+	if l.dir == "" {
+		return nil, fmt.Errorf("no prompt library directory is configured")
+	}
+	if !validName.MatchString(name) {
+		return nil, fmt.Errorf("%w: name must be lower case letters, digits and dashes", ErrInvalidPrompt)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	next := 1
+	versions, err := l.Versions(name)
+	if err != nil && !errors.Is(err, ErrPromptNotFound) {
+		return nil, err
+	}
+	if len(versions) > 0 {
+		newest, _ := strconv.Atoi(versions[0].Version[1:])
+		next = newest + 1
+	}
+
+	version := "v" + strconv.Itoa(next)
+	p, err := Parse(name, version, SourceLibrary, data)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(l.dir, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create prompt folder: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, version+TemplateSuffix), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to save prompt: %w", err)
+	}
+	return p, nil
+}
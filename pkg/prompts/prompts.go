@@ -0,0 +1,154 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package prompts
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+const (
+	// TemplateSuffix ends every prompt file
+	TemplateSuffix = ".tmpl"
+	// WorkspaceVersion is the version of a prompt overridden by a workspace
+	WorkspaceVersion = "workspace"
+)
+
+// Where a prompt version was read from
+const (
+	SourceBuiltin   = "builtin"   // Compiled into the service
+	SourceLibrary   = "library"   // The prompt library directory
+	SourceWorkspace = "workspace" // A workspace's .ubeprompts folder
+)
+
+var (
+	ErrPromptNotFound = errors.New("prompt not found")
+	ErrInvalidPrompt  = errors.New("invalid prompt")
+
+	validName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+)
+
+// headerEnd separates a prompt file's JSON header from its template
+const headerEnd = "\n---\n"
+
+// Variable is a value a prompt's template is rendered with
+type Variable struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// Prompt is one version of a prompt template
+type Prompt struct {
+	Name         string          `json:"name"`
+	Version      string          `json:"version"` // v1, v2, ... or "workspace"
+	Source       string          `json:"source"`
+	Description  string          `json:"description,omitempty"`
+	Variables    []Variable      `json:"variables"`
+	OutputSchema json.RawMessage `json:"outputSchema,omitempty"` // JSON Schema of the answer, for prompts that ask for JSON
+	Hash         string          `json:"hash"`                   // Short SHA-256 of the file, so edits without a new version still show
+	Template     string          `json:"template"`
+
+	tmpl *template.Template
+}
+
+type header struct {
+	Description  string          `json:"description"`
+	Variables    []Variable      `json:"variables"`
+	OutputSchema json.RawMessage `json:"outputSchema"`
+}
+
+// funcs are available to every prompt template
+var funcs = template.FuncMap{
+	"join": strings.Join,
+	"inc":  func(i int) int { return i + 1 },
+	"json": func(v interface{}) (string, error) {
+		data, err := json.MarshalIndent(v, "", "  ")
+		return string(data), err
+	},
+}
+
+// Parse reads a prompt file: an optional JSON header describing the prompt, a line holding
+// only ---, then the text/template body. The file's final newline is not part of the prompt.
+func Parse(name, version, source string, data []byte) (*Prompt, error) {
+	sum := sha256.Sum256(data)
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+
+	var h header
+	if trimmed := strings.TrimSpace(text); strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "{{") {
+		head, body, ok := strings.Cut(text, headerEnd)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s %s has a header but no --- line after it", ErrInvalidPrompt, name, version)
+		}
+		if err := json.Unmarshal([]byte(head), &h); err != nil {
+			return nil, fmt.Errorf("%w: %s %s header: %v", ErrInvalidPrompt, name, version, err)
+		}
+		text = body
+	}
+	text = strings.TrimSuffix(text, "\n")
+
+	for _, v := range h.Variables {
+		if v.Name == "" {
+			return nil, fmt.Errorf("%w: %s %s declares a variable without a name", ErrInvalidPrompt, name, version)
+		}
+	}
+	if len(h.OutputSchema) > 0 && !json.Valid(h.OutputSchema) {
+		return nil, fmt.Errorf("%w: %s %s output schema is not valid JSON", ErrInvalidPrompt, name, version)
+	}
+
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPrompt, err)
+	}
+
+	variables := h.Variables
+	if variables == nil {
+		variables = []Variable{}
+	}
+	return &Prompt{
+		Name:         name,
+		Version:      version,
+		Source:       source,
+		Description:  h.Description,
+		Variables:    variables,
+		OutputSchema: h.OutputSchema,
+		Hash:         hex.EncodeToString(sum[:4]),
+		Template:     text,
+		tmpl:         tmpl,
+	}, nil
+}
+
+// Ref identifies exactly which template text a prompt came from, e.g.
+// storyboard-analysis@v2:1a2b3c4d
+func (p *Prompt) Ref() string {
+	return p.Name + "@" + p.Version + ":" + p.Hash
+}
+
+// Render executes the template with data. Every required variable must be in data, and
+// the template may not reference a variable missing from it.
+func (p *Prompt) Render(data map[string]interface{}) (string, error) {
+	for _, v := range p.Variables {
+		if _, ok := data[v.Name]; v.Required && !ok {
+			return "", fmt.Errorf("prompt %s needs variable %s", p.Ref(), v.Name)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := p.tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt %s: %w", p.Ref(), err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,286 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package prompts
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type file struct {
+	Filename string
+	Content  string
+}
+
+type item struct {
+	ID   string
+	Name string
+}
+
+// builtinData renders every builtin prompt
+var builtinData = map[string]map[string]interface{}{
+	"integration-analysis": {"ProviderName": "Figma", "Documentation": "GET /v1/files/:key"},
+	"resource-suggestion": {
+		"WorkspaceName": "shop", "WorkspaceDescription": "", "IntegrationName": "GitHub", "Resources": "[]",
+	},
+	"specification-relationships": {
+		"Capabilities": []item{{"CAP-001", "Checkout"}},
+		"Enablers":     []item{{"ENB-001", "Payments API"}},
+		"Files":        []file{{"CAP-001.md", "# Checkout"}},
+	},
+	"specification-analysis": {"Files": []file{{"a.md", "# A"}, {"b.md", "# B"}}},
+	"capability-suggestion":  {"Specifications": "## File: a.md\n\n# A\n\n---\n\n", "ExistingCapabilities": []string{"Checkout"}},
+	"storyboard-analysis":    {"Files": "=== STORY-1.md ===\nLog in\n"},
+	"diagram-generation": {
+		"Files": []file{{"a.md", "# A"}}, "DiagramType": "sequence", "Instructions": "Draw a sequence diagram",
+	},
+	"application-analysis": {"Prompt": "Add a login page", "WorkspaceName": "shop", "Specifications": "# A"},
+	"code-generation": {
+		"AIPreset": 2, "AIPrinciples": "Be careful", "UIFramework": "", "Specifications": "# A",
+		"AdditionalInstructions": "",
+	},
+	"chat-system": {"WorkspacePath": "/workspaces/shop", "Files": []string{"README.md", "specifications/CAP-001.md"}},
+}
+
+func TestBuiltinPrompts(t *testing.T) {
+	lib := NewLibrary("")
+	names, err := lib.Names()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != len(builtinData) {
+		t.Errorf("expected %d builtin prompts, got %v", len(builtinData), names)
+	}
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			p, err := lib.Get(name, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Source != SourceBuiltin || p.Description == "" {
+				t.Errorf("expected a described builtin prompt, got %+v", p)
+			}
+			data, ok := builtinData[name]
+			if !ok {
+				t.Fatalf("no test data for prompt %s", name)
+			}
+			text, err := p.Render(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(text, "<no value>") || strings.HasSuffix(text, "\n") {
+				t.Errorf("unexpected rendering: %q", text)
+			}
+		})
+	}
+}
+
+func TestRenderMatchesInlinePrompt(t *testing.T) {
+	p, err := NewLibrary("").Get("code-generation", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		framework string
+		extra     string
+		want      string
+		notWant   string
+	}{
+		{"without framework", "", "", "Be careful\n\n## SPECIFICATION FILES", "UI FRAMEWORK"},
+		{"with framework", "Material", "", "Be careful\n\n## UI FRAMEWORK\n\nApply the following UI Framework: Material\n\n## SPECIFICATION FILES", ""},
+		{"with instructions", "", "Use Go", "[/FILE] tags.\n\n## ADDITIONAL INSTRUCTIONS\n\nUse Go", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, err := p.Render(map[string]interface{}{
+				"AIPreset": 1, "AIPrinciples": "Be careful", "UIFramework": tt.framework,
+				"Specifications": "# A", "AdditionalInstructions": tt.extra,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(text, tt.want) {
+				t.Errorf("expected %q in %q", tt.want, text)
+			}
+			if tt.notWant != "" && strings.Contains(text, tt.notWant) {
+				t.Errorf("expected no %q in %q", tt.notWant, text)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{"plain template", "Hello {{.Name}}\n", false},
+		{"template starting with an action", "{{.Name}}, hello", false},
+		{"header", `{"variables": [{"name": "Name", "required": true}]}` + "\n---\nHello {{.Name}}", false},
+		{"header without separator", `{"description": "greeting"}` + "\nHello", true},
+		{"bad header", "{not json\n---\nHello", true},
+		{"unnamed variable", `{"variables": [{"required": true}]}` + "\n---\nHello", true},
+		{"bad template", "Hello {{.Name", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse("greeting", "v1", SourceLibrary, []byte(tt.data))
+			if tt.wantErr && !errors.Is(err, ErrInvalidPrompt) {
+				t.Errorf("expected ErrInvalidPrompt, got %v", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestRenderVariables(t *testing.T) {
+	p, err := Parse("greeting", "v1", SourceLibrary,
+		[]byte(`{"variables": [{"name": "Name", "required": true}, {"name": "Title"}]}`+"\n---\nHello {{.Title}}{{.Name}}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		data    map[string]interface{}
+		want    string
+		wantErr bool
+	}{
+		{"all variables", map[string]interface{}{"Name": "Ada", "Title": "Dr "}, "Hello Dr Ada", false},
+		{"missing required variable", map[string]interface{}{"Title": "Dr "}, "", true},
+		{"missing optional variable used by the template", map[string]interface{}{"Name": "Ada"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.Render(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLibraryVersions(t *testing.T) {
+	dir := t.TempDir()
+	lib := NewLibrary(dir)
+
+	saved, err := lib.Save("chat-system", []byte("You are a terse assistant for {{.WorkspacePath}}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Version != "v2" || saved.Source != SourceLibrary {
+		t.Errorf("expected library version v2, got %s from %s", saved.Version, saved.Source)
+	}
+	if _, err := lib.Save("greeting", []byte("Hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lib.Save("Bad Name", []byte("Hello")); !errors.Is(err, ErrInvalidPrompt) {
+		t.Errorf("expected ErrInvalidPrompt for a bad name, got %v", err)
+	}
+
+	// A library file replaces the builtin version with the same number
+	os.WriteFile(filepath.Join(dir, "chat-system", "v1.tmpl"), []byte("Replaced"), 0644)
+	// Unparseable versions are skipped
+	os.WriteFile(filepath.Join(dir, "chat-system", "v3.tmpl"), []byte("{{.Broken"), 0644)
+
+	tests := []struct {
+		name     string
+		prompt   string
+		versions []string
+		source   string
+	}{
+		{"builtin with a new version", "chat-system", []string{"v2", "v1"}, SourceLibrary},
+		{"library only", "greeting", []string{"v1"}, SourceLibrary},
+		{"builtin only", "storyboard-analysis", []string{"v1"}, SourceBuiltin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			versions, err := lib.Versions(tt.prompt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, v := range versions {
+				got = append(got, v.Version)
+				if v.Source != tt.source {
+					t.Errorf("expected %s from %s, got %s", v.Version, tt.source, v.Source)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.versions, ",") {
+				t.Errorf("expected versions %v, got %v", tt.versions, got)
+			}
+		})
+	}
+
+	if _, err := lib.Get("missing", ""); !errors.Is(err, ErrPromptNotFound) {
+		t.Errorf("expected ErrPromptNotFound, got %v", err)
+	}
+}
+
+func TestResolveWorkspaceOverride(t *testing.T) {
+	lib := NewLibrary("")
+	workspace := t.TempDir()
+	overrides := filepath.Join(workspace, WorkspaceDir)
+	os.MkdirAll(overrides, 0755)
+	os.WriteFile(filepath.Join(overrides, "chat-system.tmpl"), []byte("Only answer questions about {{.WorkspacePath}}\n"), 0644)
+
+	tests := []struct {
+		name      string
+		prompt    string
+		workspace string
+		version   string
+	}{
+		{"override", "chat-system", workspace, WorkspaceVersion},
+		{"no override", "storyboard-analysis", workspace, "v1"},
+		{"no workspace", "chat-system", "", "v1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := lib.Resolve(tt.prompt, tt.workspace)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Version != tt.version {
+				t.Errorf("expected version %s, got %s", tt.version, p.Version)
+			}
+			if len(p.Variables) == 0 {
+				t.Error("expected the prompt's variables")
+			}
+		})
+	}
+
+	p, _ := lib.Resolve("chat-system", workspace)
+	text, err := p.Render(map[string]interface{}{"WorkspacePath": "/w", "Files": []string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "Only answer questions about /w" {
+		t.Errorf("unexpected rendering: %q", text)
+	}
+	if !strings.HasPrefix(p.Ref(), "chat-system@workspace:") {
+		t.Errorf("unexpected ref %s", p.Ref())
+	}
+}
@@ -236,12 +236,15 @@ func (r *AcceptanceCriteriaRepository) GetSummary(entityType string, entityID in
 			COUNT(*) FILTER (WHERE status = 'failed') as failed,
 			COUNT(*) FILTER (WHERE status = 'pending') as pending,
 			COUNT(*) FILTER (WHERE status = 'blocked') as blocked,
-			COUNT(*) FILTER (WHERE status = 'skipped') as skipped
+			COUNT(*) FILTER (WHERE status = 'skipped') as skipped,
+			COUNT(*) FILTER (WHERE priority = 'must') as must_total,
+			COUNT(*) FILTER (WHERE priority = 'must' AND status = 'passed') as must_passed
 		FROM acceptance_criteria
 		WHERE entity_type = $1 AND entity_id = $2
 	`, entityType, entityID).Scan(
 		&summary.TotalCount, &summary.PassedCount, &summary.FailedCount,
 		&summary.PendingCount, &summary.BlockedCount, &summary.SkippedCount,
+		&summary.MustCount, &summary.MustPassedCount,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get summary: %w", err)
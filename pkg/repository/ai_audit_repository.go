@@ -0,0 +1,141 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+var ErrAuditEntryNotFound = errors.New("AI audit entry not found")
+
+// defaultAuditLimit is how many entries List returns when the filter sets no limit
+const defaultAuditLimit = 100
+
+const auditColumns = `id, workspace_id, user_id, endpoint, workspace_path, preset, enforcement, files, violations,
+	blocked, COALESCE(review_status, ''), reviewed_by, COALESCE(review_comment, ''), reviewed_at, created_at`
+
+// AIAuditRepository stores the audit log of AI changes checked against governance rules
+type AIAuditRepository struct {
+	db *sql.DB
+}
+
+// NewAIAuditRepository creates a new AI audit repository
+func NewAIAuditRepository(db *sql.DB) *AIAuditRepository {
+	return &AIAuditRepository{db: db}
+}
+
+func scanAuditEntry(row interface{ Scan(...interface{}) error }) (*models.AIAuditEntry, error) {
+	var e models.AIAuditEntry
+	var files, violations []byte
+	err := row.Scan(&e.ID, &e.WorkspaceID, &e.UserID, &e.Endpoint, &e.WorkspacePath, &e.Preset, &e.Enforcement,
+		&files, &violations, &e.Blocked, &e.ReviewStatus, &e.ReviewedBy, &e.ReviewComment, &e.ReviewedAt, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(files, &e.Files); err != nil {
+		return nil, fmt.Errorf("failed to parse audited files: %w", err)
+	}
+	if err := json.Unmarshal(violations, &e.Violations); err != nil {
+		return nil, fmt.Errorf("failed to parse violations: %w", err)
+	}
+	return &e, nil
+}
+
+// Record stores an audit entry
+func (r *AIAuditRepository) Record(e *models.AIAuditEntry) error {
+	if e.Files == nil {
+		e.Files = []string{}
+	}
+	if e.Violations == nil {
+		e.Violations = []models.AIViolation{}
+	}
+	files, err := json.Marshal(e.Files)
+	if err != nil {
+		return fmt.Errorf("failed to encode audited files: %w", err)
+	}
+	violations, err := json.Marshal(e.Violations)
+	if err != nil {
+		return fmt.Errorf("failed to encode violations: %w", err)
+	}
+	err = r.db.QueryRow(`
+		INSERT INTO ai_audit_log (workspace_id, user_id, endpoint, workspace_path, preset, enforcement,
+			files, violations, blocked, review_status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''))
+		RETURNING id, created_at
+	`, e.WorkspaceID, e.UserID, e.Endpoint, e.WorkspacePath, e.Preset, e.Enforcement,
+		files, violations, e.Blocked, e.ReviewStatus).Scan(&e.ID, &e.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record AI audit entry: %w", err)
+	}
+	return nil
+}
+
+// Get retrieves an audit entry by ID
+func (r *AIAuditRepository) Get(id int64) (*models.AIAuditEntry, error) {
+	e, err := scanAuditEntry(r.db.QueryRow(`SELECT `+auditColumns+` FROM ai_audit_log WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrAuditEntryNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get AI audit entry: %w", err)
+	}
+	return e, nil
+}
+
+// List returns the audit entries matching filter, newest first
+func (r *AIAuditRepository) List(filter models.AIAuditFilter) ([]models.AIAuditEntry, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+	rows, err := r.db.Query(`
+		SELECT `+auditColumns+` FROM ai_audit_log
+		WHERE ($1::int IS NULL OR workspace_id = $1)
+			AND ($2::int IS NULL OR user_id = $2)
+			AND ($3 = '' OR review_status = $3)
+			AND (NOT $4 OR jsonb_array_length(violations) > 0)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $5
+	`, filter.WorkspaceID, filter.UserID, filter.ReviewStatus, filter.WithViolations, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list AI audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.AIAuditEntry{}
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan AI audit entry: %w", err)
+		}
+		entries = append(entries, *e)
+	}
+	return entries, rows.Err()
+}
+
+// Review records a reviewer's decision on an entry that is waiting for review
+func (r *AIAuditRepository) Review(id int64, status, comment string, by *int) (*models.AIAuditEntry, error) {
+	e, err := scanAuditEntry(r.db.QueryRow(`
+		UPDATE ai_audit_log SET review_status = $2, review_comment = NULLIF($3, ''), reviewed_by = $4,
+			reviewed_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND review_status IS NOT NULL
+		RETURNING `+auditColumns, id, status, comment, by))
+	if err == sql.ErrNoRows {
+		return nil, ErrAuditEntryNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to review AI audit entry: %w", err)
+	}
+	return e, nil
+}
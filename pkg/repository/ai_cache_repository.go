@@ -0,0 +1,87 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/aicache"
+)
+
+// AICacheRepository keeps cached AI answers in Postgres. It implements aicache.Store.
+type AICacheRepository struct {
+	db *sql.DB
+}
+
+// NewAICacheRepository creates a new AI cache repository
+func NewAICacheRepository(db *sql.DB) *AICacheRepository {
+	return &AICacheRepository{db: db}
+}
+
+// Hit implements aicache.Store
+func (r *AICacheRepository) Hit(key string, now time.Time) (*aicache.Entry, error) {
+	var e aicache.Entry
+	var value []byte
+	err := r.db.QueryRow(`
+		UPDATE ai_response_cache SET hits = hits + 1, last_hit_at = $2
+		WHERE cache_key = $1 AND expires_at > $2
+		RETURNING cache_key, prompt, model, value, cost_usd, hits, created_at, expires_at, last_hit_at
+	`, key, now).Scan(&e.Key, &e.Prompt, &e.Model, &value, &e.CostUSD, &e.Hits, &e.CreatedAt, &e.ExpiresAt, &e.LastHitAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cached answer: %w", err)
+	}
+	e.Value = value
+	return &e, nil
+}
+
+// Put implements aicache.Store
+func (r *AICacheRepository) Put(e *aicache.Entry) error {
+	_, err := r.db.Exec(`
+		INSERT INTO ai_response_cache (cache_key, prompt, model, value, cost_usd, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (cache_key) DO UPDATE SET
+			prompt = EXCLUDED.prompt,
+			model = EXCLUDED.model,
+			value = EXCLUDED.value,
+			cost_usd = EXCLUDED.cost_usd,
+			hits = 0,
+			created_at = EXCLUDED.created_at,
+			expires_at = EXCLUDED.expires_at,
+			last_hit_at = NULL
+	`, e.Key, e.Prompt, e.Model, []byte(e.Value), e.CostUSD, e.CreatedAt, e.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to save cached answer: %w", err)
+	}
+	return nil
+}
+
+// Purge implements aicache.Store
+func (r *AICacheRepository) Purge(now time.Time) (int, error) {
+	result, err := r.db.Exec(`DELETE FROM ai_response_cache WHERE expires_at <= $1`, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge cached answers: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return int(n), nil
+}
+
+// Clear implements aicache.Store
+func (r *AICacheRepository) Clear() (int, error) {
+	result, err := r.db.Exec(`DELETE FROM ai_response_cache`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear cached answers: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return int(n), nil
+}
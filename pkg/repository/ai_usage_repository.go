@@ -0,0 +1,184 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+var ErrBudgetNotFound = errors.New("AI budget not found")
+
+// usageGroups are the columns a usage report can be grouped by
+var usageGroups = map[string]string{
+	"workspace": "COALESCE(workspace_id::text, '')",
+	"user":      "COALESCE(user_id::text, '')",
+	"model":     "model",
+	"endpoint":  "endpoint",
+	"prompt":    "COALESCE(prompt_template, '')",
+}
+
+// AIUsageRepository stores what AI calls cost and the budgets that cap it
+type AIUsageRepository struct {
+	db *sql.DB
+}
+
+// NewAIUsageRepository creates a new AI usage repository
+func NewAIUsageRepository(db *sql.DB) *AIUsageRepository {
+	return &AIUsageRepository{db: db}
+}
+
+// Record stores a model call
+func (r *AIUsageRepository) Record(u *models.AIUsage) error {
+	err := r.db.QueryRow(`
+		INSERT INTO ai_usage (workspace_id, user_id, endpoint, model, input_tokens, output_tokens,
+			cache_creation_tokens, cache_read_tokens, cost_usd, latency_ms, prompt_template)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, ''))
+		RETURNING id, created_at
+	`, u.WorkspaceID, u.UserID, u.Endpoint, u.Model, u.InputTokens, u.OutputTokens,
+		u.CacheCreationTokens, u.CacheReadTokens, u.CostUSD, u.LatencyMs, u.PromptTemplate).Scan(&u.ID, &u.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record AI usage: %w", err)
+	}
+	return nil
+}
+
+// Spent returns what a workspace or user has spent since the given time
+func (r *AIUsageRepository) Spent(scope string, scopeID int, since time.Time) (float64, error) {
+	column := "workspace_id"
+	if scope == models.BudgetScopeUser {
+		column = "user_id"
+	}
+	var spent float64
+	err := r.db.QueryRow(`
+		SELECT COALESCE(SUM(cost_usd), 0)::float8 FROM ai_usage
+		WHERE `+column+` = $1 AND created_at >= $2
+	`, scopeID, since).Scan(&spent)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum AI usage: %w", err)
+	}
+	return spent, nil
+}
+
+// Daily returns the usage matching filter per day and group, oldest day first
+func (r *AIUsageRepository) Daily(filter models.AIUsageFilter) ([]models.AIUsageDay, error) {
+	group, ok := usageGroups[filter.GroupBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown usage grouping %q", filter.GroupBy)
+	}
+	rows, err := r.db.Query(`
+		SELECT to_char(created_at, 'YYYY-MM-DD') AS day, `+group+` AS key, COUNT(*),
+			COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0),
+			COALESCE(SUM(cache_creation_tokens), 0), COALESCE(SUM(cache_read_tokens), 0),
+			COALESCE(SUM(cost_usd), 0)::float8
+		FROM ai_usage
+		WHERE created_at >= $1 AND created_at < $2
+			AND ($3::int IS NULL OR workspace_id = $3)
+			AND ($4::int IS NULL OR user_id = $4)
+		GROUP BY day, key
+		ORDER BY day, key
+	`, filter.From, filter.To, filter.WorkspaceID, filter.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to report AI usage: %w", err)
+	}
+	defer rows.Close()
+
+	days := []models.AIUsageDay{}
+	for rows.Next() {
+		var d models.AIUsageDay
+		if err := rows.Scan(&d.Day, &d.Key, &d.Calls, &d.InputTokens, &d.OutputTokens,
+			&d.CacheCreationTokens, &d.CacheReadTokens, &d.CostUSD); err != nil {
+			return nil, fmt.Errorf("failed to scan AI usage: %w", err)
+		}
+		days = append(days, d)
+	}
+	return days, rows.Err()
+}
+
+const budgetColumns = `id, scope, scope_id, period, soft_limit_usd::float8, hard_limit_usd::float8, created_by, created_at, updated_at`
+
+func scanBudget(row interface{ Scan(...interface{}) error }) (*models.AIBudget, error) {
+	var b models.AIBudget
+	err := row.Scan(&b.ID, &b.Scope, &b.ScopeID, &b.Period, &b.SoftLimitUSD, &b.HardLimitUSD,
+		&b.CreatedBy, &b.CreatedAt, &b.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// SetBudget creates the budget of a workspace or user, or replaces the one it has
+func (r *AIUsageRepository) SetBudget(b *models.AIBudget) error {
+	saved, err := scanBudget(r.db.QueryRow(`
+		INSERT INTO ai_budgets (scope, scope_id, period, soft_limit_usd, hard_limit_usd, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (scope, scope_id) DO UPDATE SET
+			period = EXCLUDED.period,
+			soft_limit_usd = EXCLUDED.soft_limit_usd,
+			hard_limit_usd = EXCLUDED.hard_limit_usd
+		RETURNING `+budgetColumns,
+		b.Scope, b.ScopeID, b.Period, b.SoftLimitUSD, b.HardLimitUSD, b.CreatedBy))
+	if err != nil {
+		return fmt.Errorf("failed to save AI budget: %w", err)
+	}
+	*b = *saved
+	return nil
+}
+
+// GetBudget returns a budget by ID
+func (r *AIUsageRepository) GetBudget(id int) (*models.AIBudget, error) {
+	b, err := scanBudget(r.db.QueryRow(`SELECT `+budgetColumns+` FROM ai_budgets WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrBudgetNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get AI budget: %w", err)
+	}
+	return b, nil
+}
+
+// ListBudgets returns the budgets of a scope, or all budgets when scope is empty. A nil
+// scopeID matches every workspace or user of the scope.
+func (r *AIUsageRepository) ListBudgets(scope string, scopeID *int) ([]models.AIBudget, error) {
+	rows, err := r.db.Query(`
+		SELECT `+budgetColumns+` FROM ai_budgets
+		WHERE ($1 = '' OR scope = $1) AND ($2::int IS NULL OR scope_id = $2)
+		ORDER BY scope, scope_id
+	`, scope, scopeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list AI budgets: %w", err)
+	}
+	defer rows.Close()
+
+	budgets := []models.AIBudget{}
+	for rows.Next() {
+		b, err := scanBudget(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan AI budget: %w", err)
+		}
+		budgets = append(budgets, *b)
+	}
+	return budgets, rows.Err()
+}
+
+// DeleteBudget removes a budget
+func (r *AIUsageRepository) DeleteBudget(id int) error {
+	result, err := r.db.Exec(`DELETE FROM ai_budgets WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete AI budget: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrBudgetNotFound
+	}
+	return nil
+}
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/lib/pq"
 )
 
 // ApprovalRepository handles database operations for approvals
@@ -331,7 +332,8 @@ func (r *ApprovalRepository) GetPendingApprovals() ([]models.CapabilityApproval,
 	rows, err := r.db.Query(`
 		SELECT ca.id, ca.capability_id, ca.stage, ca.status, ca.requested_by, ca.requested_at,
 		       ca.decided_by, ca.decided_at, ca.feedback, ca.created_at, ca.updated_at,
-		       u.name as requester_name
+		       u.name as requester_name, COALESCE(ca.reminders_sent, 0), ca.last_reminder_at,
+		       ca.escalated_at, ca.escalated_to_role, ca.escalated_to_user_id
 		FROM capability_approvals ca
 		LEFT JOIN users u ON ca.requested_by = u.id
 		WHERE ca.status = 'pending_approval'
@@ -348,7 +350,8 @@ func (r *ApprovalRepository) GetPendingApprovals() ([]models.CapabilityApproval,
 		err := rows.Scan(
 			&a.ID, &a.CapabilityID, &a.Stage, &a.Status, &a.RequestedBy, &a.RequestedAt,
 			&a.DecidedBy, &a.DecidedAt, &a.Feedback, &a.CreatedAt, &a.UpdatedAt,
-			&a.RequesterName,
+			&a.RequesterName, &a.RemindersSent, &a.LastReminderAt,
+			&a.EscalatedAt, &a.EscalatedToRole, &a.EscalatedToUserID,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan approval: %w", err)
@@ -401,7 +404,8 @@ func (r *ApprovalRepository) GetApprovalHistory(capabilityID int) ([]models.Capa
 func (r *ApprovalRepository) GetAuditLog(capabilityID int) ([]models.ApprovalAuditLog, error) {
 	rows, err := r.db.Query(`
 		SELECT al.id, al.approval_id, al.capability_id, al.action, al.stage,
-		       al.performed_by, al.performed_at, al.details, u.name as performer_name
+		       COALESCE(al.performed_by, 0), al.performed_at, al.details,
+		       COALESCE(u.name, 'System') as performer_name
 		FROM approval_audit_log al
 		LEFT JOIN users u ON al.performed_by = u.id
 		WHERE al.capability_id = $1
@@ -525,6 +529,216 @@ func (r *ApprovalRepository) GetApprovalByID(id int) (*models.CapabilityApproval
 	return &approval, nil
 }
 
+// GetSLARules returns the SLA definition for every stage that has one
+func (r *ApprovalRepository) GetSLARules() ([]models.ApprovalSLARule, error) {
+	rows, err := r.db.Query(`
+		SELECT id, stage, sla_hours, reminder_hours, COALESCE(escalation_role, ''),
+		       escalation_user_id, is_active, created_at, updated_at
+		FROM approval_sla_rules
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query SLA rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []models.ApprovalSLARule
+	for rows.Next() {
+		var rule models.ApprovalSLARule
+		var reminders pq.Int64Array
+		err := rows.Scan(
+			&rule.ID, &rule.Stage, &rule.SLAHours, &reminders, &rule.EscalationRole,
+			&rule.EscalationUserID, &rule.IsActive, &rule.CreatedAt, &rule.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan SLA rule: %w", err)
+		}
+		rule.ReminderHours = make([]int, len(reminders))
+		for i, h := range reminders {
+			rule.ReminderHours[i] = int(h)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// SaveSLARule creates or replaces the SLA definition for a stage
+func (r *ApprovalRepository) SaveSLARule(stage string, req models.UpdateApprovalSLARuleRequest) (*models.ApprovalSLARule, error) {
+	isActive := true
+	if req.IsActive != nil {
+		isActive = *req.IsActive
+	}
+	reminders := make(pq.Int64Array, len(req.ReminderHours))
+	for i, h := range req.ReminderHours {
+		reminders[i] = int64(h)
+	}
+
+	var rule models.ApprovalSLARule
+	var saved pq.Int64Array
+	err := r.db.QueryRow(`
+		INSERT INTO approval_sla_rules (stage, sla_hours, reminder_hours, escalation_role, escalation_user_id, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (stage)
+		DO UPDATE SET sla_hours = $2, reminder_hours = $3, escalation_role = $4, escalation_user_id = $5, is_active = $6
+		RETURNING id, stage, sla_hours, reminder_hours, COALESCE(escalation_role, ''),
+		          escalation_user_id, is_active, created_at, updated_at
+	`, stage, req.SLAHours, reminders, nullIfEmpty(req.EscalationRole), req.EscalationUserID, isActive).Scan(
+		&rule.ID, &rule.Stage, &rule.SLAHours, &saved, &rule.EscalationRole,
+		&rule.EscalationUserID, &rule.IsActive, &rule.CreatedAt, &rule.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save SLA rule: %w", err)
+	}
+	rule.ReminderHours = make([]int, len(saved))
+	for i, h := range saved {
+		rule.ReminderHours[i] = int(h)
+	}
+
+	return &rule, nil
+}
+
+// RecordReminder notes that approvers were reminded about a pending approval
+func (r *ApprovalRepository) RecordReminder(approvalID int) error {
+	_, err := r.db.Exec(`
+		UPDATE capability_approvals
+		SET reminders_sent = COALESCE(reminders_sent, 0) + 1, last_reminder_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'pending_approval'
+	`, approvalID)
+	if err != nil {
+		return fmt.Errorf("failed to record reminder: %w", err)
+	}
+	return nil
+}
+
+// Escalate marks an overdue approval as escalated to a fallback role or user and
+// records an 'escalated' entry in the audit log. The action has no performing user.
+func (r *ApprovalRepository) Escalate(approvalID int, role string, userID *int, details map[string]interface{}) (*models.CapabilityApproval, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var approval models.CapabilityApproval
+	err = tx.QueryRow(`
+		UPDATE capability_approvals
+		SET escalated_at = CURRENT_TIMESTAMP, escalated_to_role = $1, escalated_to_user_id = $2
+		WHERE id = $3 AND status = 'pending_approval' AND escalated_at IS NULL
+		RETURNING id, capability_id, stage, status, requested_by, requested_at,
+		          COALESCE(reminders_sent, 0), escalated_at, escalated_to_role, escalated_to_user_id,
+		          created_at, updated_at
+	`, nullIfEmpty(role), userID, approvalID).Scan(
+		&approval.ID, &approval.CapabilityID, &approval.Stage, &approval.Status,
+		&approval.RequestedBy, &approval.RequestedAt, &approval.RemindersSent,
+		&approval.EscalatedAt, &approval.EscalatedToRole, &approval.EscalatedToUserID,
+		&approval.CreatedAt, &approval.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("approval is not pending or was already escalated")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to escalate approval: %w", err)
+	}
+
+	detailsJSON, _ := json.Marshal(details)
+	_, err = tx.Exec(`
+		INSERT INTO approval_audit_log (approval_id, capability_id, action, stage, performed_by, details)
+		VALUES ($1, $2, 'escalated', $3, NULL, $4)
+	`, approval.ID, approval.CapabilityID, approval.Stage, detailsJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create audit log: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	r.enrichApprovalWithNames(&approval)
+	return &approval, nil
+}
+
+// ReassignPendingApprovals hands a departing user's pending approvals to a successor. Requests
+// they made move to toUserID; escalations assigned to them move to toUserID or, when it is
+// nil, to the stage's escalation role (admin if none). SLA rules naming the user follow too.
+// Each moved approval gets a 'reassigned' audit entry. It returns how many approvals moved.
+func (r *ApprovalRepository) ReassignPendingApprovals(fromUserID int, toUserID *int, reason string) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	type moved struct {
+		id, capabilityID int
+		stage, field     string
+	}
+	var reassigned []moved
+	collect := func(field string, rows *sql.Rows, err error) error {
+		if err != nil {
+			return fmt.Errorf("failed to reassign approvals: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			m := moved{field: field}
+			if err := rows.Scan(&m.id, &m.capabilityID, &m.stage); err != nil {
+				return fmt.Errorf("failed to scan approval: %w", err)
+			}
+			reassigned = append(reassigned, m)
+		}
+		return rows.Err()
+	}
+
+	if toUserID != nil {
+		rows, err := tx.Query(`
+			UPDATE capability_approvals SET requested_by = $2
+			WHERE requested_by = $1 AND status = 'pending_approval'
+			RETURNING id, capability_id, stage
+		`, fromUserID, *toUserID)
+		if err := collect("requested_by", rows, err); err != nil {
+			return 0, err
+		}
+	}
+
+	rows, err := tx.Query(`
+		UPDATE capability_approvals ca
+		SET escalated_to_user_id = $2::int,
+		    escalated_to_role = CASE WHEN $2::int IS NULL
+		        THEN COALESCE(ca.escalated_to_role, (SELECT escalation_role FROM approval_sla_rules WHERE stage = ca.stage), 'admin')
+		        ELSE ca.escalated_to_role END
+		WHERE ca.escalated_to_user_id = $1 AND ca.status = 'pending_approval'
+		RETURNING ca.id, ca.capability_id, ca.stage
+	`, fromUserID, toUserID)
+	if err := collect("escalated_to_user_id", rows, err); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`UPDATE approval_sla_rules SET escalation_user_id = $2 WHERE escalation_user_id = $1`, fromUserID, toUserID); err != nil {
+		return 0, fmt.Errorf("failed to reassign SLA escalations: %w", err)
+	}
+
+	for _, m := range reassigned {
+		detailsJSON, _ := json.Marshal(map[string]interface{}{
+			"field":  m.field,
+			"from":   fromUserID,
+			"to":     toUserID,
+			"reason": reason,
+		})
+		_, err = tx.Exec(`
+			INSERT INTO approval_audit_log (approval_id, capability_id, action, stage, performed_by, details)
+			VALUES ($1, $2, 'reassigned', $3, NULL, $4)
+		`, m.id, m.capabilityID, m.stage, detailsJSON)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create audit log: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return len(reassigned), nil
+}
+
 // enrichApprovalWithNames adds user names to an approval
 func (r *ApprovalRepository) enrichApprovalWithNames(approval *models.CapabilityApproval) {
 	// Get requester name
@@ -10,11 +10,15 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 
 	"github.com/jareynolds/ubecode/pkg/models"
 )
 
+// ErrCapabilityNotFound is returned when no capability has the requested ID
+var ErrCapabilityNotFound = errors.New("capability not found")
+
 // CapabilityRepository handles database operations for capabilities
 type CapabilityRepository struct {
 	db *sql.DB
@@ -36,10 +40,10 @@ func (r *CapabilityRepository) Create(req models.CreateCapabilityRequest, userID
 	// Insert capability
 	var capability models.Capability
 	err = tx.QueryRow(`
-		INSERT INTO capabilities (capability_id, name, status, description, purpose, storyboard_reference, created_by)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO capabilities (capability_id, name, status, description, purpose, storyboard_reference, created_by, workspace_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING id, capability_id, name, status, description, purpose, storyboard_reference, created_at, updated_at, created_by, is_active
-	`, req.CapabilityID, req.Name, req.Status, req.Description, req.Purpose, req.StoryboardReference, userID).Scan(
+	`, req.CapabilityID, req.Name, req.Status, req.Description, req.Purpose, req.StoryboardReference, userID, req.WorkspaceID).Scan(
 		&capability.ID, &capability.CapabilityID, &capability.Name, &capability.Status,
 		&capability.Description, &capability.Purpose, &capability.StoryboardReference,
 		&capability.CreatedAt, &capability.UpdatedAt, &capability.CreatedBy, &capability.IsActive,
@@ -93,7 +97,7 @@ func (r *CapabilityRepository) Create(req models.CreateCapabilityRequest, userID
 func (r *CapabilityRepository) GetAll() ([]models.Capability, error) {
 	rows, err := r.db.Query(`
 		SELECT id, capability_id, name, status, description, purpose, storyboard_reference,
-		       created_at, updated_at, created_by, is_active, current_stage, approval_status
+		       created_at, updated_at, created_by, is_active, current_stage, approval_status, workspace_id
 		FROM capabilities
 		WHERE is_active = true
 		ORDER BY created_at DESC
@@ -109,7 +113,7 @@ func (r *CapabilityRepository) GetAll() ([]models.Capability, error) {
 		err := rows.Scan(
 			&cap.ID, &cap.CapabilityID, &cap.Name, &cap.Status, &cap.Description,
 			&cap.Purpose, &cap.StoryboardReference, &cap.CreatedAt, &cap.UpdatedAt,
-			&cap.CreatedBy, &cap.IsActive, &cap.WorkflowStage, &cap.ApprovalStatus,
+			&cap.CreatedBy, &cap.IsActive, &cap.WorkflowStage, &cap.ApprovalStatus, &cap.WorkspaceID,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan capability: %w", err)
@@ -127,14 +131,17 @@ func (r *CapabilityRepository) GetByID(id int) (*models.CapabilityWithDetails, e
 	// Get capability
 	err := r.db.QueryRow(`
 		SELECT id, capability_id, name, status, description, purpose, storyboard_reference,
-		       created_at, updated_at, created_by, is_active, current_stage, approval_status
+		       created_at, updated_at, created_by, is_active, current_stage, approval_status, workspace_id
 		FROM capabilities
 		WHERE id = $1
 	`, id).Scan(
 		&cap.ID, &cap.CapabilityID, &cap.Name, &cap.Status, &cap.Description,
 		&cap.Purpose, &cap.StoryboardReference, &cap.CreatedAt, &cap.UpdatedAt,
-		&cap.CreatedBy, &cap.IsActive, &cap.WorkflowStage, &cap.ApprovalStatus,
+		&cap.CreatedBy, &cap.IsActive, &cap.WorkflowStage, &cap.ApprovalStatus, &cap.WorkspaceID,
 	)
+	if err == sql.ErrNoRows {
+		return nil, ErrCapabilityNotFound
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get capability: %w", err)
 	}
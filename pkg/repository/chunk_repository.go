@@ -0,0 +1,152 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jareynolds/ubecode/pkg/retrieval"
+)
+
+// ChunkRepository keeps retrieval chunk vectors in Postgres with pgvector. It implements
+// retrieval.Store.
+type ChunkRepository struct {
+	db *sql.DB
+}
+
+// NewChunkRepository creates a new chunk repository
+func NewChunkRepository(db *sql.DB) *ChunkRepository {
+	return &ChunkRepository{db: db}
+}
+
+// Check reports an error when the retrieval tables are missing, which is the case when
+// migration 018 ran on a server without pgvector
+func (r *ChunkRepository) Check() error {
+	var exists bool
+	err := r.db.QueryRow(`SELECT to_regclass('retrieval_chunks') IS NOT NULL`).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check retrieval tables: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("retrieval tables not found; pgvector must be installed before migration 018 runs")
+	}
+	return nil
+}
+
+// vectorLiteral formats a vector the way pgvector parses it: [1,2,3]
+func vectorLiteral(v []float32) string {
+	parts := make([]string, len(v))
+	for i, x := range v {
+		parts[i] = strconv.FormatFloat(float64(x), 'g', -1, 32)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+// FileHashes implements retrieval.Store
+func (r *ChunkRepository) FileHashes(workspace, embedder string) (map[string]string, error) {
+	rows, err := r.db.Query(`
+		SELECT path, content_hash FROM retrieval_files WHERE workspace = $1 AND embedder = $2
+	`, workspace, embedder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexed files: %w", err)
+	}
+	defer rows.Close()
+
+	hashes := map[string]string{}
+	for rows.Next() {
+		var path, hash string
+		if err := rows.Scan(&path, &hash); err != nil {
+			return nil, fmt.Errorf("failed to scan indexed file: %w", err)
+		}
+		hashes[path] = hash
+	}
+	return hashes, rows.Err()
+}
+
+// Update implements retrieval.Store
+func (r *ChunkRepository) Update(workspace, embedder string, files []retrieval.FileChunks, removed []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, path := range removed {
+		_, err := tx.Exec(`
+			DELETE FROM retrieval_files WHERE workspace = $1 AND embedder = $2 AND path = $3
+		`, workspace, embedder, path)
+		if err != nil {
+			return fmt.Errorf("failed to remove indexed file: %w", err)
+		}
+	}
+
+	for _, f := range files {
+		var fileID int
+		err := tx.QueryRow(`
+			INSERT INTO retrieval_files (workspace, embedder, path, content_hash)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (workspace, embedder, path) DO UPDATE SET
+				content_hash = EXCLUDED.content_hash,
+				indexed_at = CURRENT_TIMESTAMP
+			RETURNING id
+		`, workspace, embedder, f.Path, f.Hash).Scan(&fileID)
+		if err != nil {
+			return fmt.Errorf("failed to save indexed file: %w", err)
+		}
+		if _, err := tx.Exec(`DELETE FROM retrieval_chunks WHERE file_id = $1`, fileID); err != nil {
+			return fmt.Errorf("failed to replace chunks: %w", err)
+		}
+		for _, c := range f.Chunks {
+			_, err := tx.Exec(`
+				INSERT INTO retrieval_chunks (file_id, kind, heading, start_line, end_line, content, tokens, embedding)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8::vector)
+			`, fileID, c.Kind, c.Heading, c.StartLine, c.EndLine, c.Text, c.Tokens, vectorLiteral(c.Vector))
+			if err != nil {
+				return fmt.Errorf("failed to save chunk: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Search implements retrieval.Store. <=> is pgvector's cosine distance.
+func (r *ChunkRepository) Search(workspace, embedder, kind string, vector []float32, limit int) ([]retrieval.Match, error) {
+	rows, err := r.db.Query(`
+		SELECT f.path, c.kind, COALESCE(c.heading, ''), c.start_line, c.end_line, c.content, c.tokens,
+			1 - (c.embedding <=> $3::vector) AS score
+		FROM retrieval_chunks c
+		JOIN retrieval_files f ON f.id = c.file_id
+		WHERE f.workspace = $1 AND f.embedder = $2 AND ($4 = '' OR c.kind = $4)
+			AND vector_dims(c.embedding) = $5
+		ORDER BY c.embedding <=> $3::vector, f.path, c.start_line
+		LIMIT $6
+	`, workspace, embedder, vectorLiteral(vector), kind, len(vector), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search chunks: %w", err)
+	}
+	defer rows.Close()
+
+	matches := []retrieval.Match{}
+	for rows.Next() {
+		var m retrieval.Match
+		if err := rows.Scan(&m.Path, &m.Kind, &m.Heading, &m.StartLine, &m.EndLine, &m.Text,
+			&m.Tokens, &m.Score); err != nil {
+			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
@@ -0,0 +1,313 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+var (
+	ErrConversationNotFound = errors.New("conversation not found")
+	ErrMessageNotFound      = errors.New("message is not part of the conversation")
+)
+
+// ConversationRepository stores AI chat threads and their messages
+type ConversationRepository struct {
+	db *sql.DB
+}
+
+// NewConversationRepository creates a new conversation repository
+func NewConversationRepository(db *sql.DB) *ConversationRepository {
+	return &ConversationRepository{db: db}
+}
+
+const conversationColumns = `
+	id, workspace_id, COALESCE(artifact_type, ''), COALESCE(artifact_id, ''), title, COALESCE(model, ''),
+	COALESCE(summary, ''), summarized_through, forked_from, message_count, input_tokens, output_tokens,
+	created_by, created_at, updated_at`
+
+func scanConversation(row interface{ Scan(...interface{}) error }) (*models.Conversation, error) {
+	var c models.Conversation
+	err := row.Scan(&c.ID, &c.WorkspaceID, &c.ArtifactType, &c.ArtifactID, &c.Title, &c.Model,
+		&c.Summary, &c.SummarizedThrough, &c.ForkedFrom, &c.MessageCount, &c.InputTokens, &c.OutputTokens,
+		&c.CreatedBy, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Create starts a conversation
+func (r *ConversationRepository) Create(c *models.Conversation) error {
+	created, err := scanConversation(r.db.QueryRow(`
+		INSERT INTO conversations (workspace_id, artifact_type, artifact_id, title, model, created_by)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, NULLIF($5, ''), $6)
+		RETURNING `+conversationColumns,
+		c.WorkspaceID, c.ArtifactType, c.ArtifactID, c.Title, c.Model, c.CreatedBy))
+	if err != nil {
+		return fmt.Errorf("failed to create conversation: %w", err)
+	}
+	*c = *created
+	return nil
+}
+
+// Get returns a conversation by ID, without its messages
+func (r *ConversationRepository) Get(id int) (*models.Conversation, error) {
+	c, err := scanConversation(r.db.QueryRow(`SELECT `+conversationColumns+` FROM conversations WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrConversationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation: %w", err)
+	}
+	return c, nil
+}
+
+// List returns the most recently active conversations of a workspace matching filter
+func (r *ConversationRepository) List(filter models.ConversationFilter) ([]models.Conversation, error) {
+	if filter.Limit <= 0 || filter.Limit > 200 {
+		filter.Limit = 50
+	}
+	query := ""
+	if q := strings.TrimSpace(filter.Query); q != "" {
+		query = "%" + escapeLike(q) + "%"
+	}
+	rows, err := r.db.Query(`
+		SELECT `+conversationColumns+` FROM conversations c
+		WHERE c.workspace_id = $1
+			AND ($2 = '' OR c.artifact_type = $2)
+			AND ($3 = '' OR c.artifact_id = $3 OR EXISTS (
+				SELECT 1 FROM conversation_messages m, jsonb_array_elements(m.file_changes) fc
+				WHERE m.conversation_id = c.id AND fc->>'spec_id' = $3))
+			AND ($4 = '' OR c.title ILIKE $4 OR c.summary ILIKE $4 OR EXISTS (
+				SELECT 1 FROM conversation_messages m WHERE m.conversation_id = c.id AND m.content ILIKE $4))
+		ORDER BY c.updated_at DESC, c.id DESC
+		LIMIT $5
+	`, filter.WorkspaceID, filter.ArtifactType, filter.ArtifactID, query, filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversations: %w", err)
+	}
+	defer rows.Close()
+
+	conversations := []models.Conversation{}
+	for rows.Next() {
+		c, err := scanConversation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan conversation: %w", err)
+		}
+		conversations = append(conversations, *c)
+	}
+	return conversations, rows.Err()
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// Messages returns a conversation's messages, oldest first
+func (r *ConversationRepository) Messages(id int) ([]models.ConversationMessage, error) {
+	rows, err := r.db.Query(`
+		SELECT id, conversation_id, role, content, tool_calls, file_changes, COALESCE(model, ''),
+			input_tokens, output_tokens, created_at
+		FROM conversation_messages
+		WHERE conversation_id = $1
+		ORDER BY id
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []models.ConversationMessage{}
+	for rows.Next() {
+		var m models.ConversationMessage
+		var toolCalls, fileChanges []byte
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.Role, &m.Content, &toolCalls, &fileChanges, &m.Model,
+			&m.InputTokens, &m.OutputTokens, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan conversation message: %w", err)
+		}
+		if len(toolCalls) > 0 {
+			m.ToolCalls = json.RawMessage(toolCalls)
+		}
+		if len(fileChanges) > 0 {
+			if err := json.Unmarshal(fileChanges, &m.FileChanges); err != nil {
+				return nil, fmt.Errorf("failed to parse file changes: %w", err)
+			}
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// AppendMessages adds messages to a conversation and updates its totals
+func (r *ConversationRepository) AppendMessages(id int, messages ...*models.ConversationMessage) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	model := ""
+	inputTokens, outputTokens := 0, 0
+	for _, m := range messages {
+		var toolCalls, fileChanges interface{}
+		if len(m.ToolCalls) > 0 {
+			toolCalls = []byte(m.ToolCalls)
+		}
+		if len(m.FileChanges) > 0 {
+			data, err := json.Marshal(m.FileChanges)
+			if err != nil {
+				return fmt.Errorf("failed to encode file changes: %w", err)
+			}
+			fileChanges = data
+		}
+		err := tx.QueryRow(`
+			INSERT INTO conversation_messages (conversation_id, role, content, tool_calls, file_changes, model, input_tokens, output_tokens)
+			VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8)
+			RETURNING id, created_at
+		`, id, m.Role, m.Content, toolCalls, fileChanges, m.Model, m.InputTokens, m.OutputTokens).Scan(&m.ID, &m.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to add conversation message: %w", err)
+		}
+		m.ConversationID = id
+		if m.Model != "" {
+			model = m.Model
+		}
+		inputTokens += m.InputTokens
+		outputTokens += m.OutputTokens
+	}
+
+	result, err := tx.Exec(`
+		UPDATE conversations SET message_count = message_count + $2, input_tokens = input_tokens + $3,
+			output_tokens = output_tokens + $4, model = COALESCE(NULLIF($5, ''), model)
+		WHERE id = $1
+	`, id, len(messages), inputTokens, outputTokens, model)
+	if err != nil {
+		return fmt.Errorf("failed to update conversation: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrConversationNotFound
+	}
+	return tx.Commit()
+}
+
+// SetSummary records a summary of the conversation up to and including message through
+func (r *ConversationRepository) SetSummary(id int, summary string, through int64) error {
+	_, err := r.db.Exec(`UPDATE conversations SET summary = $2, summarized_through = $3 WHERE id = $1`, id, summary, through)
+	if err != nil {
+		return fmt.Errorf("failed to save conversation summary: %w", err)
+	}
+	return nil
+}
+
+// Fork copies a conversation into a new one owned by createdBy, keeping the messages up to
+// and including throughMessageID, or all of them when it is 0
+func (r *ConversationRepository) Fork(id int, throughMessageID int64, title string, createdBy *int) (*models.Conversation, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if throughMessageID == 0 {
+		err = tx.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM conversation_messages WHERE conversation_id = $1`, id).Scan(&throughMessageID)
+	} else {
+		var found bool
+		err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM conversation_messages WHERE conversation_id = $1 AND id = $2)`,
+			id, throughMessageID).Scan(&found)
+		if err == nil && !found {
+			return nil, ErrMessageNotFound
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fork conversation: %w", err)
+	}
+
+	// The summary only carries over when it covers no message that is left out
+	fork, err := scanConversation(tx.QueryRow(`
+		INSERT INTO conversations (workspace_id, artifact_type, artifact_id, title, model, summary, summarized_through,
+			forked_from, created_by)
+		SELECT workspace_id, artifact_type, artifact_id, COALESCE(NULLIF($3, ''), title), model,
+			CASE WHEN summarized_through <= $2 THEN summary END,
+			CASE WHEN summarized_through <= $2 THEN summarized_through END,
+			id, $4
+		FROM conversations WHERE id = $1
+		RETURNING `+conversationColumns, id, throughMessageID, title, createdBy))
+	if err == sql.ErrNoRows {
+		return nil, ErrConversationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fork conversation: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO conversation_messages (conversation_id, role, content, tool_calls, file_changes, model,
+			input_tokens, output_tokens, created_at)
+		SELECT $2, role, content, tool_calls, file_changes, model, input_tokens, output_tokens, created_at
+		FROM conversation_messages
+		WHERE conversation_id = $1 AND id <= $3
+		ORDER BY id
+	`, id, fork.ID, throughMessageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy conversation messages: %w", err)
+	}
+
+	// Copies get new IDs, so the summary has to point at the copy of its last message
+	var summarizedThrough *int64
+	if fork.SummarizedThrough != nil {
+		var position int
+		err = tx.QueryRow(`SELECT COUNT(*) FROM conversation_messages WHERE conversation_id = $1 AND id <= $2`,
+			id, *fork.SummarizedThrough).Scan(&position)
+		if err == nil && position > 0 {
+			var copyID int64
+			err = tx.QueryRow(`SELECT id FROM conversation_messages WHERE conversation_id = $1 ORDER BY id OFFSET $2 LIMIT 1`,
+				fork.ID, position-1).Scan(&copyID)
+			summarizedThrough = &copyID
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to fork conversation summary: %w", err)
+		}
+	}
+	fork, err = scanConversation(tx.QueryRow(`
+		UPDATE conversations SET
+			message_count = (SELECT COUNT(*) FROM conversation_messages WHERE conversation_id = $1),
+			input_tokens = (SELECT COALESCE(SUM(input_tokens), 0) FROM conversation_messages WHERE conversation_id = $1),
+			output_tokens = (SELECT COALESCE(SUM(output_tokens), 0) FROM conversation_messages WHERE conversation_id = $1),
+			summary = CASE WHEN $2::bigint IS NULL THEN NULL ELSE summary END,
+			summarized_through = $2
+		WHERE id = $1
+		RETURNING `+conversationColumns, fork.ID, summarizedThrough))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fork conversation: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit fork: %w", err)
+	}
+	return fork, nil
+}
+
+// Delete removes a conversation and its messages
+func (r *ConversationRepository) Delete(id int) error {
+	result, err := r.db.Exec(`DELETE FROM conversations WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete conversation: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrConversationNotFound
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+// JobRepository stores background jobs and their logs
+type JobRepository struct {
+	db *sql.DB
+}
+
+// NewJobRepository creates a new job repository
+func NewJobRepository(db *sql.DB) *JobRepository {
+	return &JobRepository{db: db}
+}
+
+const jobColumns = `
+	id, kind, status, COALESCE(workspace_path, ''), created_by, params, result, COALESCE(error, ''),
+	progress, COALESCE(progress_message, ''), attempts, max_attempts, run_after, cancel_requested,
+	created_at, started_at, finished_at, updated_at`
+
+func scanJob(row interface{ Scan(...interface{}) error }) (*models.Job, error) {
+	var job models.Job
+	var params, result []byte
+	err := row.Scan(&job.ID, &job.Kind, &job.Status, &job.WorkspacePath, &job.CreatedBy, &params, &result, &job.Error,
+		&job.Progress, &job.ProgressMessage, &job.Attempts, &job.MaxAttempts, &job.RunAfter, &job.CancelRequested,
+		&job.CreatedAt, &job.StartedAt, &job.FinishedAt, &job.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	job.Params = json.RawMessage(params)
+	if len(result) > 0 {
+		job.Result = json.RawMessage(result)
+	}
+	return &job, nil
+}
+
+// Create queues a job
+func (r *JobRepository) Create(job *models.Job) error {
+	created, err := scanJob(r.db.QueryRow(`
+		INSERT INTO jobs (kind, status, workspace_path, created_by, params, max_attempts)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6)
+		RETURNING `+jobColumns,
+		job.Kind, job.Status, job.WorkspacePath, job.CreatedBy, []byte(job.Params), job.MaxAttempts))
+	if err != nil {
+		return fmt.Errorf("failed to create job: %w", err)
+	}
+	*job = *created
+	return nil
+}
+
+// Get returns a job by ID
+func (r *JobRepository) Get(id int) (*models.Job, error) {
+	job, err := scanJob(r.db.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	return job, nil
+}
+
+// List returns the newest jobs matching filter
+func (r *JobRepository) List(filter models.JobFilter) ([]models.Job, error) {
+	if filter.Limit <= 0 || filter.Limit > 200 {
+		filter.Limit = 50
+	}
+	rows, err := r.db.Query(`
+		SELECT `+jobColumns+` FROM jobs
+		WHERE ($1 = '' OR status = $1) AND ($2 = '' OR kind = $2) AND ($3::int IS NULL OR created_by = $3)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4
+	`, filter.Status, filter.Kind, filter.CreatedBy, filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []models.Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+// Claim marks the oldest due queued job as running for workerID. Concurrent workers skip
+// rows another transaction has locked.
+func (r *JobRepository) Claim(workerID string) (*models.Job, error) {
+	job, err := scanJob(r.db.QueryRow(`
+		UPDATE jobs SET status = 'running', attempts = attempts + 1, worker_id = $1,
+			heartbeat_at = CURRENT_TIMESTAMP, started_at = COALESCE(started_at, CURRENT_TIMESTAMP)
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE status = 'queued' AND run_after <= CURRENT_TIMESTAMP
+			ORDER BY run_after, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+jobColumns, workerID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim job: %w", err)
+	}
+	return job, nil
+}
+
+// Heartbeat records that a running job is alive and reports whether it should stop
+func (r *JobRepository) Heartbeat(id int) (bool, error) {
+	var cancelRequested bool
+	err := r.db.QueryRow(`
+		UPDATE jobs SET heartbeat_at = CURRENT_TIMESTAMP WHERE id = $1 RETURNING cancel_requested
+	`, id).Scan(&cancelRequested)
+	if err == sql.ErrNoRows {
+		return false, ErrJobNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to record heartbeat: %w", err)
+	}
+	return cancelRequested, nil
+}
+
+// SetProgress records how far a running job has got
+func (r *JobRepository) SetProgress(id, percent int, message string) error {
+	if percent < 0 {
+		percent = 0
+	} else if percent > 100 {
+		percent = 100
+	}
+	_, err := r.db.Exec(`
+		UPDATE jobs SET progress = $2, progress_message = NULLIF($3, ''), heartbeat_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, id, percent, message)
+	if err != nil {
+		return fmt.Errorf("failed to record progress: %w", err)
+	}
+	return nil
+}
+
+// AppendLog adds a line to a job's log
+func (r *JobRepository) AppendLog(id int, level, message string) error {
+	_, err := r.db.Exec(`INSERT INTO job_logs (job_id, level, message) VALUES ($1, $2, $3)`, id, level, message)
+	if err != nil {
+		return fmt.Errorf("failed to append job log: %w", err)
+	}
+	return nil
+}
+
+// Logs returns a job's log lines after afterID, oldest first
+func (r *JobRepository) Logs(id int, afterID int64) ([]models.JobLog, error) {
+	rows, err := r.db.Query(`
+		SELECT id, job_id, level, message, created_at FROM job_logs
+		WHERE job_id = $1 AND id > $2
+		ORDER BY id
+		LIMIT 1000
+	`, id, afterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job logs: %w", err)
+	}
+	defer rows.Close()
+
+	logs := []models.JobLog{}
+	for rows.Next() {
+		var l models.JobLog
+		if err := rows.Scan(&l.ID, &l.JobID, &l.Level, &l.Message, &l.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan job log: %w", err)
+		}
+		logs = append(logs, l)
+	}
+	return logs, rows.Err()
+}
+
+// Finish records a job's final status and result
+func (r *JobRepository) Finish(id int, status string, result json.RawMessage, errMsg string) error {
+	var data interface{}
+	if len(result) > 0 {
+		data = []byte(result)
+	}
+	_, err := r.db.Exec(`
+		UPDATE jobs SET status = $2, result = $3, error = NULLIF($4, ''), worker_id = NULL,
+			progress = CASE WHEN $2 = 'succeeded' THEN 100 ELSE progress END,
+			finished_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, id, status, data, errMsg)
+	if err != nil {
+		return fmt.Errorf("failed to finish job: %w", err)
+	}
+	return nil
+}
+
+// Requeue schedules another attempt of a failed job. A cancellation requested meanwhile
+// wins.
+func (r *JobRepository) Requeue(id int, runAfter time.Time, errMsg string) error {
+	_, err := r.db.Exec(`
+		UPDATE jobs SET
+			status = CASE WHEN cancel_requested THEN 'cancelled' ELSE 'queued' END,
+			finished_at = CASE WHEN cancel_requested THEN CURRENT_TIMESTAMP END,
+			run_after = $2, error = NULLIF($3, ''), worker_id = NULL, heartbeat_at = NULL
+		WHERE id = $1
+	`, id, runAfter, errMsg)
+	if err != nil {
+		return fmt.Errorf("failed to requeue job: %w", err)
+	}
+	return nil
+}
+
+// RequestCancel cancels a queued job outright and flags a running one for its worker.
+// Finished jobs are returned unchanged.
+func (r *JobRepository) RequestCancel(id int) (*models.Job, error) {
+	job, err := scanJob(r.db.QueryRow(`
+		UPDATE jobs SET
+			cancel_requested = cancel_requested OR status IN ('queued', 'running'),
+			status = CASE WHEN status = 'queued' THEN 'cancelled' ELSE status END,
+			finished_at = CASE WHEN status = 'queued' THEN CURRENT_TIMESTAMP ELSE finished_at END,
+			error = CASE WHEN status = 'queued' THEN 'cancelled' ELSE error END
+		WHERE id = $1
+		RETURNING `+jobColumns, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel job: %w", err)
+	}
+	return job, nil
+}
+
+// RecoverStale handles running jobs whose worker stopped sending heartbeats before the
+// given time: they are requeued when attempts remain and failed otherwise
+func (r *JobRepository) RecoverStale(before time.Time) (int, error) {
+	result, err := r.db.Exec(`
+		UPDATE jobs SET
+			status = CASE
+				WHEN cancel_requested THEN 'cancelled'
+				WHEN attempts < max_attempts THEN 'queued'
+				ELSE 'failed' END,
+			error = CASE
+				WHEN cancel_requested THEN 'cancelled'
+				ELSE 'interrupted: the worker running this job stopped' END,
+			finished_at = CASE WHEN cancel_requested OR attempts >= max_attempts THEN CURRENT_TIMESTAMP END,
+			run_after = CURRENT_TIMESTAMP, worker_id = NULL, heartbeat_at = NULL
+		WHERE status = 'running' AND (heartbeat_at IS NULL OR heartbeat_at < $1)
+	`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to recover stale jobs: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	return int(rows), nil
+}
@@ -0,0 +1,270 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/lib/pq"
+)
+
+// NotificationRepository handles database operations for notifications
+type NotificationRepository struct {
+	db *sql.DB
+}
+
+// NewNotificationRepository creates a new notification repository
+func NewNotificationRepository(db *sql.DB) *NotificationRepository {
+	return &NotificationRepository{db: db}
+}
+
+// Create stores a notification in a user's inbox
+func (r *NotificationRepository) Create(n *models.Notification) error {
+	var metadata interface{}
+	if len(n.Metadata) > 0 {
+		metadata = []byte(n.Metadata)
+	}
+
+	err := r.db.QueryRow(`
+		INSERT INTO notifications (user_id, event_type, title, body, link, entity_type, entity_id, metadata)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`, n.UserID, n.EventType, n.Title, n.Body, nullIfEmpty(n.Link), nullIfEmpty(n.EntityType),
+		n.EntityID, metadata).Scan(&n.ID, &n.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create notification: %w", err)
+	}
+	return nil
+}
+
+// GetByUser retrieves a user's notifications, newest first
+func (r *NotificationRepository) GetByUser(userID int, unreadOnly bool, limit int) ([]models.Notification, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+
+	query := `
+		SELECT id, user_id, event_type, title, COALESCE(body, ''), COALESCE(link, ''),
+		       COALESCE(entity_type, ''), entity_id, metadata, read_at, created_at
+		FROM notifications
+		WHERE user_id = $1
+	`
+	if unreadOnly {
+		query += " AND read_at IS NULL"
+	}
+	query += " ORDER BY created_at DESC LIMIT $2"
+
+	rows, err := r.db.Query(query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notifications: %w", err)
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		var entityID sql.NullInt64
+		var metadata []byte
+		err := rows.Scan(
+			&n.ID, &n.UserID, &n.EventType, &n.Title, &n.Body, &n.Link,
+			&n.EntityType, &entityID, &metadata, &n.ReadAt, &n.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		if entityID.Valid {
+			id := int(entityID.Int64)
+			n.EntityID = &id
+		}
+		if len(metadata) > 0 {
+			n.Metadata = json.RawMessage(metadata)
+		}
+		notifications = append(notifications, n)
+	}
+
+	return notifications, nil
+}
+
+// CountUnread returns the number of unread notifications for a user
+func (r *NotificationRepository) CountUnread(userID int) (int, error) {
+	var count int
+	err := r.db.QueryRow(`
+		SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL
+	`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+	return count, nil
+}
+
+// MarkRead marks a single notification as read
+func (r *NotificationRepository) MarkRead(id int, userID int) error {
+	result, err := r.db.Exec(`
+		UPDATE notifications SET read_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2 AND read_at IS NULL
+	`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark notification as read: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		var exists bool
+		r.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM notifications WHERE id = $1 AND user_id = $2)`, id, userID).Scan(&exists)
+		if !exists {
+			return fmt.Errorf("notification not found")
+		}
+	}
+	return nil
+}
+
+// MarkAllRead marks every unread notification for a user as read
+func (r *NotificationRepository) MarkAllRead(userID int) (int, error) {
+	result, err := r.db.Exec(`
+		UPDATE notifications SET read_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND read_at IS NULL
+	`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications as read: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	return int(rows), nil
+}
+
+// GetPreferences returns a user's preferences for every event type, filling in defaults
+func (r *NotificationRepository) GetPreferences(userID int) ([]models.NotificationPreference, error) {
+	rows, err := r.db.Query(`
+		SELECT user_id, event_type, in_app_enabled, email_enabled, slack_enabled, teams_enabled
+		FROM notification_preferences
+		WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notification preferences: %w", err)
+	}
+	defer rows.Close()
+
+	saved := make(map[models.NotificationEventType]models.NotificationPreference)
+	for rows.Next() {
+		var p models.NotificationPreference
+		if err := rows.Scan(&p.UserID, &p.EventType, &p.InAppEnabled, &p.EmailEnabled, &p.SlackEnabled, &p.TeamsEnabled); err != nil {
+			return nil, fmt.Errorf("failed to scan notification preference: %w", err)
+		}
+		saved[p.EventType] = p
+	}
+
+	var prefs []models.NotificationPreference
+	for _, eventType := range models.ValidNotificationEventTypes() {
+		if p, ok := saved[eventType]; ok {
+			prefs = append(prefs, p)
+		} else {
+			prefs = append(prefs, models.DefaultNotificationPreference(userID, eventType))
+		}
+	}
+	return prefs, nil
+}
+
+// GetPreference returns a user's preference for one event type, or the default
+func (r *NotificationRepository) GetPreference(userID int, eventType models.NotificationEventType) (models.NotificationPreference, error) {
+	p := models.NotificationPreference{UserID: userID, EventType: eventType}
+	err := r.db.QueryRow(`
+		SELECT in_app_enabled, email_enabled, slack_enabled, teams_enabled
+		FROM notification_preferences
+		WHERE user_id = $1 AND event_type = $2
+	`, userID, eventType).Scan(&p.InAppEnabled, &p.EmailEnabled, &p.SlackEnabled, &p.TeamsEnabled)
+	if err == sql.ErrNoRows {
+		return models.DefaultNotificationPreference(userID, eventType), nil
+	}
+	if err != nil {
+		return p, fmt.Errorf("failed to get notification preference: %w", err)
+	}
+	return p, nil
+}
+
+// SavePreference creates or updates a user's preference for one event type
+func (r *NotificationRepository) SavePreference(p models.NotificationPreference) error {
+	_, err := r.db.Exec(`
+		INSERT INTO notification_preferences (user_id, event_type, in_app_enabled, email_enabled, slack_enabled, teams_enabled)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, event_type)
+		DO UPDATE SET in_app_enabled = $3, email_enabled = $4, slack_enabled = $5, teams_enabled = $6
+	`, p.UserID, p.EventType, p.InAppEnabled, p.EmailEnabled, p.SlackEnabled, p.TeamsEnabled)
+	if err != nil {
+		return fmt.Errorf("failed to save notification preference: %w", err)
+	}
+	return nil
+}
+
+// GetTemplate returns a stored template override, or nil if none exists.
+// A channel-specific override wins over the 'default' channel override.
+func (r *NotificationRepository) GetTemplate(eventType models.NotificationEventType, channel string) (*models.NotificationTemplate, error) {
+	var t models.NotificationTemplate
+	err := r.db.QueryRow(`
+		SELECT event_type, channel, subject_template, body_template
+		FROM notification_templates
+		WHERE event_type = $1 AND channel IN ($2, 'default')
+		ORDER BY CASE WHEN channel = $2 THEN 0 ELSE 1 END
+		LIMIT 1
+	`, eventType, channel).Scan(&t.EventType, &t.Channel, &t.SubjectTemplate, &t.BodyTemplate)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification template: %w", err)
+	}
+	return &t, nil
+}
+
+// GetRecipients returns contact details for active users by ID
+func (r *NotificationRepository) GetRecipients(userIDs []int) ([]models.NotificationRecipient, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	ids := make([]int64, len(userIDs))
+	for i, id := range userIDs {
+		ids[i] = int64(id)
+	}
+	return r.queryRecipients(`
+		SELECT id, email, name, role FROM users
+		WHERE id = ANY($1) AND is_active = true
+		ORDER BY id
+	`, pq.Array(ids))
+}
+
+// GetRecipientsByRoles returns contact details for active users holding any of the roles
+func (r *NotificationRepository) GetRecipientsByRoles(roles []string) ([]models.NotificationRecipient, error) {
+	if len(roles) == 0 {
+		return nil, nil
+	}
+	return r.queryRecipients(`
+		SELECT id, email, name, role FROM users
+		WHERE role = ANY($1) AND is_active = true
+		ORDER BY id
+	`, pq.Array(roles))
+}
+
+func (r *NotificationRepository) queryRecipients(query string, args ...interface{}) ([]models.NotificationRecipient, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recipients: %w", err)
+	}
+	defer rows.Close()
+
+	var recipients []models.NotificationRecipient
+	for rows.Next() {
+		var rc models.NotificationRecipient
+		if err := rows.Scan(&rc.UserID, &rc.Email, &rc.Name, &rc.Role); err != nil {
+			return nil, fmt.Errorf("failed to scan recipient: %w", err)
+		}
+		recipients = append(recipients, rc)
+	}
+	return recipients, nil
+}
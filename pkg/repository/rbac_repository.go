@@ -0,0 +1,539 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrRoleInUse         = errors.New("role is assigned to users or workspace members")
+	ErrSystemRole        = errors.New("built-in roles cannot be renamed or deleted")
+	ErrWorkspaceNotFound = errors.New("workspace not found")
+	ErrMemberNotFound    = errors.New("workspace member not found")
+)
+
+// Record types that can be resolved to a workspace
+const (
+	RecordCapability  = "capability"
+	RecordEnabler     = "enabler"
+	RecordRequirement = "requirement"
+	RecordCriteria    = "criteria"
+	RecordApproval    = "approval"
+)
+
+// RBACRepository handles roles, workspace membership and access resolution
+type RBACRepository struct {
+	db *sql.DB
+}
+
+// NewRBACRepository creates a new RBAC repository
+func NewRBACRepository(db *sql.DB) *RBACRepository {
+	return &RBACRepository{db: db}
+}
+
+const roleSelect = `
+	SELECT r.id, r.name, COALESCE(r.description, ''), r.is_system, r.require_mfa, r.created_at, r.updated_at,
+	       COALESCE(array_agg(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}')
+	FROM roles r
+	LEFT JOIN role_permissions rp ON rp.role_id = r.id`
+
+func scanRole(row interface{ Scan(...interface{}) error }) (*models.Role, error) {
+	var role models.Role
+	err := row.Scan(&role.ID, &role.Name, &role.Description, &role.IsSystem, &role.RequireMFA, &role.CreatedAt, &role.UpdatedAt, pq.Array(&role.Permissions))
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// ListRoles returns every role with its permissions
+func (r *RBACRepository) ListRoles() ([]models.Role, error) {
+	rows, err := r.db.Query(roleSelect + ` GROUP BY r.id ORDER BY r.is_system DESC, r.name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query roles: %w", err)
+	}
+	defer rows.Close()
+
+	roles := []models.Role{}
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan role: %w", err)
+		}
+		roles = append(roles, *role)
+	}
+	return roles, nil
+}
+
+// GetRole returns a role by ID
+func (r *RBACRepository) GetRole(id int) (*models.Role, error) {
+	role, err := scanRole(r.db.QueryRow(roleSelect+` WHERE r.id = $1 GROUP BY r.id`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrRoleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role: %w", err)
+	}
+	return role, nil
+}
+
+// GetRoleByName returns a role by name
+func (r *RBACRepository) GetRoleByName(name string) (*models.Role, error) {
+	role, err := scanRole(r.db.QueryRow(roleSelect+` WHERE r.name = $1 GROUP BY r.id`, name))
+	if err == sql.ErrNoRows {
+		return nil, ErrRoleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role: %w", err)
+	}
+	return role, nil
+}
+
+// CreateRole creates a custom role
+func (r *RBACRepository) CreateRole(req models.RoleRequest) (*models.Role, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO roles (name, description, require_mfa) VALUES ($1, $2, $3) RETURNING id
+	`, req.Name, req.Description, req.RequireMFA).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create role: %w", err)
+	}
+
+	if err := setRolePermissions(tx, id, req.Permissions); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return r.GetRole(id)
+}
+
+// UpdateRole replaces a role's description, MFA requirement and permissions. Built-in roles keep their name.
+func (r *RBACRepository) UpdateRole(id int, req models.RoleRequest) (*models.Role, error) {
+	existing, err := r.GetRole(id)
+	if err != nil {
+		return nil, err
+	}
+	if existing.IsSystem && req.Name != "" && req.Name != existing.Name {
+		return nil, ErrSystemRole
+	}
+	name := req.Name
+	if name == "" {
+		name = existing.Name
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE roles SET name = $1, description = $2, require_mfa = $3 WHERE id = $4`, name, req.Description, req.RequireMFA, id); err != nil {
+		return nil, fmt.Errorf("failed to update role: %w", err)
+	}
+	// Users reference global roles by name
+	if name != existing.Name {
+		if _, err := tx.Exec(`UPDATE users SET role = $1 WHERE role = $2`, name, existing.Name); err != nil {
+			return nil, fmt.Errorf("failed to rename user roles: %w", err)
+		}
+	}
+	if err := setRolePermissions(tx, id, req.Permissions); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return r.GetRole(id)
+}
+
+func setRolePermissions(tx *sql.Tx, roleID int, permissions []string) error {
+	if _, err := tx.Exec(`DELETE FROM role_permissions WHERE role_id = $1`, roleID); err != nil {
+		return fmt.Errorf("failed to clear role permissions: %w", err)
+	}
+	_, err := tx.Exec(`
+		INSERT INTO role_permissions (role_id, permission)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT DO NOTHING
+	`, roleID, pq.Array(permissions))
+	if err != nil {
+		return fmt.Errorf("failed to set role permissions: %w", err)
+	}
+	return nil
+}
+
+// DeleteRole removes a custom role that nobody holds
+func (r *RBACRepository) DeleteRole(id int) error {
+	role, err := r.GetRole(id)
+	if err != nil {
+		return err
+	}
+	if role.IsSystem {
+		return ErrSystemRole
+	}
+
+	var inUse bool
+	err = r.db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM users WHERE role = $1)
+		    OR EXISTS (SELECT 1 FROM workspace_members WHERE role_id = $2)
+	`, role.Name, id).Scan(&inUse)
+	if err != nil {
+		return fmt.Errorf("failed to check role usage: %w", err)
+	}
+	if inUse {
+		return ErrRoleInUse
+	}
+
+	if _, err := r.db.Exec(`DELETE FROM roles WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete role: %w", err)
+	}
+	return nil
+}
+
+// ListMembers returns a workspace's members
+func (r *RBACRepository) ListMembers(workspaceID int) ([]models.WorkspaceMember, error) {
+	if err := r.requireWorkspace(workspaceID); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(`
+		SELECT m.id, m.workspace_id, m.user_id, u.name, u.email, m.role_id, ro.name, m.added_by, m.created_at
+		FROM workspace_members m
+		JOIN users u ON u.id = m.user_id
+		JOIN roles ro ON ro.id = m.role_id
+		WHERE m.workspace_id = $1
+		ORDER BY u.name
+	`, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query workspace members: %w", err)
+	}
+	defer rows.Close()
+
+	members := []models.WorkspaceMember{}
+	for rows.Next() {
+		var m models.WorkspaceMember
+		err := rows.Scan(&m.ID, &m.WorkspaceID, &m.UserID, &m.UserName, &m.UserEmail, &m.RoleID, &m.RoleName, &m.AddedBy, &m.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan workspace member: %w", err)
+		}
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+// SetMember adds a user to a workspace or changes their role there
+func (r *RBACRepository) SetMember(workspaceID int, req models.WorkspaceMemberRequest, addedBy int) (*models.WorkspaceMember, error) {
+	if err := r.requireWorkspace(workspaceID); err != nil {
+		return nil, err
+	}
+	role, err := r.GetRoleByName(req.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = r.db.Exec(`
+		INSERT INTO workspace_members (workspace_id, user_id, role_id, added_by)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (workspace_id, user_id) DO UPDATE SET role_id = EXCLUDED.role_id
+	`, workspaceID, req.UserID, role.ID, addedBy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save workspace member: %w", err)
+	}
+
+	members, err := r.ListMembers(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range members {
+		if m.UserID == req.UserID {
+			return &m, nil
+		}
+	}
+	return nil, ErrMemberNotFound
+}
+
+// RemoveMember removes a user from a workspace
+func (r *RBACRepository) RemoveMember(workspaceID, userID int) error {
+	result, err := r.db.Exec(`DELETE FROM workspace_members WHERE workspace_id = $1 AND user_id = $2`, workspaceID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove workspace member: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrMemberNotFound
+	}
+	return nil
+}
+
+func (r *RBACRepository) requireWorkspace(id int) error {
+	var exists bool
+	if err := r.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM workspaces WHERE id = $1)`, id).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check workspace: %w", err)
+	}
+	if !exists {
+		return ErrWorkspaceNotFound
+	}
+	return nil
+}
+
+// GetAccessGrant resolves a user's effective permissions globally and per workspace.
+// Inside a workspace the user holds the union of:
+//   - their membership role's permissions
+//   - workspace_owner permissions and their global role's, if they own it
+//   - their global role's permissions, if it is shared and the role has workspaces:shared,
+//     or for every workspace if the role has workspaces:admin
+func (r *RBACRepository) GetAccessGrant(userID int) (*models.AccessGrant, error) {
+	rolePerms, err := r.rolePermissionsByName()
+	if err != nil {
+		return nil, err
+	}
+
+	grant := &models.AccessGrant{UserID: userID, Workspaces: []models.WorkspaceAccess{}}
+	err = r.db.QueryRow(`SELECT role FROM users WHERE id = $1 AND is_active = true`, userID).Scan(&grant.Role)
+	if err == sql.ErrNoRows {
+		grant.Permissions = []string{}
+		return grant, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user role: %w", err)
+	}
+	grant.Permissions = append([]string{}, rolePerms[grant.Role]...)
+
+	seesAll := grant.Can(models.PermWorkspacesAdmin)
+	usesShared := grant.Can(models.PermWorkspacesShared)
+
+	rows, err := r.db.Query(`
+		SELECT w.id, w.name, COALESCE(w.folder_name, ''), w.user_id = $1, COALESCE(w.is_shared, false),
+		       COALESCE(ro.name, '')
+		FROM workspaces w
+		LEFT JOIN workspace_members m ON m.workspace_id = w.id AND m.user_id = $1
+		LEFT JOIN roles ro ON ro.id = m.role_id
+		ORDER BY w.name
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query workspaces: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ws models.WorkspaceAccess
+		var isOwner, isShared bool
+		var memberRole string
+		if err := rows.Scan(&ws.WorkspaceID, &ws.Name, &ws.Folder, &isOwner, &isShared, &memberRole); err != nil {
+			return nil, fmt.Errorf("failed to scan workspace: %w", err)
+		}
+		if ws.Folder != "" {
+			grant.KnownFolders = append(grant.KnownFolders, ws.Folder)
+		}
+
+		perms := map[string]bool{}
+		add := func(list []string) {
+			for _, p := range list {
+				perms[p] = true
+			}
+		}
+		if memberRole != "" {
+			add(rolePerms[memberRole])
+		}
+		if isOwner {
+			add(rolePerms["workspace_owner"])
+			add(grant.Permissions)
+		}
+		if seesAll || (isShared && usesShared) {
+			add(grant.Permissions)
+		}
+		if len(perms) == 0 {
+			continue
+		}
+
+		for p := range perms {
+			ws.Permissions = append(ws.Permissions, p)
+		}
+		sort.Strings(ws.Permissions)
+		grant.Workspaces = append(grant.Workspaces, ws)
+	}
+
+	return grant, rows.Err()
+}
+
+func (r *RBACRepository) rolePermissionsByName() (map[string][]string, error) {
+	rows, err := r.db.Query(`
+		SELECT ro.name, rp.permission
+		FROM roles ro
+		JOIN role_permissions rp ON rp.role_id = ro.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query role permissions: %w", err)
+	}
+	defer rows.Close()
+
+	perms := map[string][]string{}
+	for rows.Next() {
+		var role, permission string
+		if err := rows.Scan(&role, &permission); err != nil {
+			return nil, fmt.Errorf("failed to scan role permission: %w", err)
+		}
+		perms[role] = append(perms[role], permission)
+	}
+	return perms, nil
+}
+
+// recordWorkspaceQueries resolve a record to its capability's workspace
+var recordWorkspaceQueries = map[string]string{
+	RecordCapability: `SELECT c.workspace_id FROM capabilities c WHERE c.id = $1`,
+	RecordEnabler: `
+		SELECT c.workspace_id FROM enablers e
+		JOIN capabilities c ON c.id = e.capability_id
+		WHERE e.id = $1`,
+	RecordRequirement: `
+		SELECT c.workspace_id FROM enabler_requirements r
+		JOIN enablers e ON e.id = r.enabler_id
+		JOIN capabilities c ON c.id = e.capability_id
+		WHERE r.id = $1`,
+	RecordCriteria: `
+		SELECT c.workspace_id FROM acceptance_criteria ac
+		LEFT JOIN enabler_requirements r ON ac.entity_type = 'requirement' AND r.id = ac.entity_id
+		LEFT JOIN enablers e ON e.id = CASE ac.entity_type
+			WHEN 'enabler' THEN ac.entity_id
+			WHEN 'requirement' THEN r.enabler_id
+		END
+		JOIN capabilities c ON c.id = CASE ac.entity_type
+			WHEN 'capability' THEN ac.entity_id
+			ELSE e.capability_id
+		END
+		WHERE ac.id = $1`,
+	RecordApproval: `
+		SELECT c.workspace_id FROM capability_approvals a
+		JOIN capabilities c ON c.id = a.capability_id
+		WHERE a.id = $1`,
+}
+
+// RecordWorkspace returns the workspace a record belongs to (nil for none). found is false
+// when the record does not exist.
+func (r *RBACRepository) RecordWorkspace(recordType string, id int) (workspaceID *int, found bool, err error) {
+	query, ok := recordWorkspaceQueries[recordType]
+	if !ok {
+		return nil, false, fmt.Errorf("unknown record type %q", recordType)
+	}
+	err = r.db.QueryRow(query, id).Scan(&workspaceID)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to resolve %s workspace: %w", recordType, err)
+	}
+	return workspaceID, true, nil
+}
+
+// RecordWorkspaces maps records to their capability's workspace, for filtering lists
+type RecordWorkspaces struct {
+	Capabilities map[int]*int // capability ID -> workspace ID
+	Enablers     map[int]int  // enabler ID -> capability ID
+	Requirements map[int]int  // requirement ID -> enabler ID
+}
+
+// CapabilityWorkspace returns the workspace of a capability
+func (rw *RecordWorkspaces) CapabilityWorkspace(capabilityID int) *int {
+	return rw.Capabilities[capabilityID]
+}
+
+// EntityWorkspace returns the workspace of a capability, enabler or requirement
+func (rw *RecordWorkspaces) EntityWorkspace(entityType string, entityID int) *int {
+	switch entityType {
+	case RecordCapability:
+		return rw.Capabilities[entityID]
+	case RecordEnabler:
+		return rw.Capabilities[rw.Enablers[entityID]]
+	case RecordRequirement:
+		return rw.Capabilities[rw.Enablers[rw.Requirements[entityID]]]
+	}
+	return nil
+}
+
+// GetRecordWorkspaces loads the record-to-workspace mapping
+func (r *RBACRepository) GetRecordWorkspaces() (*RecordWorkspaces, error) {
+	rw := &RecordWorkspaces{
+		Capabilities: map[int]*int{},
+		Enablers:     map[int]int{},
+		Requirements: map[int]int{},
+	}
+
+	rows, err := r.db.Query(`SELECT id, workspace_id FROM capabilities`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query capability workspaces: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var workspaceID *int
+		if err := rows.Scan(&id, &workspaceID); err != nil {
+			return nil, fmt.Errorf("failed to scan capability workspace: %w", err)
+		}
+		rw.Capabilities[id] = workspaceID
+	}
+
+	for query, target := range map[string]map[int]int{
+		`SELECT id, capability_id FROM enablers`:          rw.Enablers,
+		`SELECT id, enabler_id FROM enabler_requirements`: rw.Requirements,
+	} {
+		if err := r.scanIDPairs(query, target); err != nil {
+			return nil, err
+		}
+	}
+
+	return rw, nil
+}
+
+func (r *RBACRepository) scanIDPairs(query string, target map[int]int) error {
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return fmt.Errorf("failed to query record parents: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, parent int
+		if err := rows.Scan(&id, &parent); err != nil {
+			return fmt.Errorf("failed to scan record parent: %w", err)
+		}
+		target[id] = parent
+	}
+	return nil
+}
+
+// WorkspaceSearchKeys maps every workspace ID to its key in the search index
+func (r *RBACRepository) WorkspaceSearchKeys() (map[int]string, error) {
+	rows, err := r.db.Query(`SELECT id, COALESCE(folder_name, '') FROM workspaces`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query workspaces: %w", err)
+	}
+	defer rows.Close()
+
+	keys := map[int]string{}
+	for rows.Next() {
+		var id int
+		var folder string
+		if err := rows.Scan(&id, &folder); err != nil {
+			return nil, fmt.Errorf("failed to scan workspace: %w", err)
+		}
+		keys[id] = WorkspaceSearchKey(id, folder)
+	}
+	return keys, nil
+}
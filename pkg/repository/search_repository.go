@@ -0,0 +1,385 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/lib/pq"
+)
+
+// SearchRepository maintains the search_documents index and runs queries against it
+type SearchRepository struct {
+	db *sql.DB
+}
+
+// NewSearchRepository creates a new search repository
+func NewSearchRepository(db *sql.DB) *SearchRepository {
+	return &SearchRepository{db: db}
+}
+
+// Record types indexed from the database
+const (
+	SearchRecordCapability  = "capability"
+	SearchRecordEnabler     = "enabler"
+	SearchRecordRequirement = "requirement"
+	SearchRecordCriteria    = "criteria"
+)
+
+// searchFacetColumns maps facet names to search_documents columns
+var searchFacetColumns = map[string]string{
+	"type":     "doc_type",
+	"status":   "status",
+	"stage":    "stage",
+	"priority": "priority",
+	"owner":    "owner",
+}
+
+// WorkspaceSearchKey is the search_documents.workspace value of records in a workspace:
+// its folder when it has one, so records and spec files of a workspace share a key
+func WorkspaceSearchKey(workspaceID int, folder string) string {
+	if folder != "" {
+		return folder
+	}
+	return fmt.Sprintf("workspace-%d", workspaceID)
+}
+
+// workspaceKeyFor returns SQL computing WorkspaceSearchKey for a capability ID expression
+func workspaceKeyFor(capabilityID string) string {
+	return `(SELECT COALESCE(w.folder_name, 'workspace-' || w.id)
+		        FROM capabilities wc JOIN workspaces w ON w.id = wc.workspace_id
+		        WHERE wc.id = ` + capabilityID + `)`
+}
+
+// recordIndexQueries copy a database record into search_documents. %s is replaced by an
+// optional filter on the record's primary key.
+var recordIndexQueries = map[string]string{
+	SearchRecordCapability: `
+		SELECT 'capability', 'capability:' || c.id, c.id, c.capability_id, c.name,
+		       concat_ws(' ', c.description, c.purpose, c.storyboard_reference),
+		       c.status, c.current_stage, NULL, u.name, '{}'::jsonb, ` + workspaceKeyFor("c.id") + `
+		FROM capabilities c
+		LEFT JOIN users u ON u.id = c.created_by
+		WHERE c.is_active = true %s`,
+	SearchRecordEnabler: `
+		SELECT 'enabler', 'enabler:' || e.id, e.id, e.enabler_id, e.name,
+		       concat_ws(' ', e.purpose, e.technical_specs::text),
+		       e.status, e.workflow_stage, e.priority, e.owner,
+		       jsonb_build_object('capability_id', e.capability_id), ` + workspaceKeyFor("e.capability_id") + `
+		FROM enablers e
+		WHERE e.is_active = true %s`,
+	SearchRecordRequirement: `
+		SELECT 'requirement', 'requirement:' || r.id, r.id, r.requirement_id, r.name,
+		       concat_ws(' ', r.description, r.requirement_type, r.nfr_category, r.notes),
+		       r.status, e.workflow_stage, r.priority, e.owner,
+		       jsonb_build_object('enabler_id', r.enabler_id), ` + workspaceKeyFor("e.capability_id") + `
+		FROM enabler_requirements r
+		JOIN enablers e ON e.id = r.enabler_id
+		WHERE e.is_active = true %s`,
+	SearchRecordCriteria: `
+		SELECT 'criteria', 'criteria:' || ac.id, ac.id, ac.criteria_id, ac.title,
+		       concat_ws(' ', ac.description, ac.given_clause, ac.when_clause, ac.then_clause,
+		                 ac.metric_name, ac.metric_target, ac.verification_notes),
+		       ac.status, NULL, ac.priority, NULL,
+		       jsonb_build_object('entity_type', ac.entity_type, 'entity_id', ac.entity_id),
+		       ` + workspaceKeyFor(`CASE ac.entity_type
+		           WHEN 'capability' THEN ac.entity_id
+		           WHEN 'enabler' THEN (SELECT capability_id FROM enablers WHERE id = ac.entity_id)
+		           ELSE (SELECT e2.capability_id FROM enabler_requirements r2
+		                 JOIN enablers e2 ON e2.id = r2.enabler_id WHERE r2.id = ac.entity_id)
+		       END`) + `
+		FROM acceptance_criteria ac
+		WHERE true %s`,
+}
+
+// recordKeyColumns is the primary key column used to index a single record
+var recordKeyColumns = map[string]string{
+	SearchRecordCapability:  "c.id",
+	SearchRecordEnabler:     "e.id",
+	SearchRecordRequirement: "r.id",
+	SearchRecordCriteria:    "ac.id",
+}
+
+const upsertRecordPrefix = `
+	INSERT INTO search_documents (source, doc_type, ref, record_id, external_id, title, body,
+	                              status, stage, priority, owner, metadata, workspace)
+	SELECT 'db', src.* FROM (`
+
+const upsertDocumentSuffix = `
+	ON CONFLICT (source, ref) DO UPDATE SET
+		doc_type = EXCLUDED.doc_type, record_id = EXCLUDED.record_id, workspace = EXCLUDED.workspace,
+		external_id = EXCLUDED.external_id, title = EXCLUDED.title, body = EXCLUDED.body,
+		status = EXCLUDED.status, stage = EXCLUDED.stage, priority = EXCLUDED.priority,
+		owner = EXCLUDED.owner, metadata = EXCLUDED.metadata`
+
+// IndexRecord refreshes the index entry of one database record, removing it when the
+// record no longer exists or is inactive
+func (r *SearchRepository) IndexRecord(recordType string, id int) error {
+	query, ok := recordIndexQueries[recordType]
+	if !ok {
+		return fmt.Errorf("unknown search record type %q", recordType)
+	}
+
+	filter := fmt.Sprintf("AND %s = $1", recordKeyColumns[recordType])
+	stmt := upsertRecordPrefix + fmt.Sprintf(query, filter) + `) src` + upsertDocumentSuffix
+	result, err := r.db.Exec(stmt, id)
+	if err != nil {
+		return fmt.Errorf("failed to index %s %d: %w", recordType, id, err)
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return r.RemoveRecord(recordType, id)
+	}
+	return nil
+}
+
+// RemoveRecord drops a database record from the index
+func (r *SearchRepository) RemoveRecord(recordType string, id int) error {
+	_, err := r.db.Exec(`DELETE FROM search_documents WHERE source = 'db' AND ref = $1`,
+		fmt.Sprintf("%s:%d", recordType, id))
+	if err != nil {
+		return fmt.Errorf("failed to remove %s %d from search index: %w", recordType, id, err)
+	}
+	return nil
+}
+
+// ReindexRecords rebuilds every database document and returns how many were indexed
+func (r *SearchRepository) ReindexRecords() (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM search_documents WHERE source = 'db'`); err != nil {
+		return 0, fmt.Errorf("failed to clear record index: %w", err)
+	}
+
+	total := 0
+	for _, recordType := range []string{SearchRecordCapability, SearchRecordEnabler, SearchRecordRequirement, SearchRecordCriteria} {
+		stmt := upsertRecordPrefix + fmt.Sprintf(recordIndexQueries[recordType], "") + `) src` + upsertDocumentSuffix
+		result, err := tx.Exec(stmt)
+		if err != nil {
+			return 0, fmt.Errorf("failed to index %s records: %w", recordType, err)
+		}
+		rows, _ := result.RowsAffected()
+		total += int(rows)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit reindex: %w", err)
+	}
+	return total, nil
+}
+
+// ApplySpecChanges upserts and removes spec documents in one transaction
+func (r *SearchRepository) ApplySpecChanges(req models.IndexDocumentsRequest) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if req.ReplaceWorkspace != "" {
+		if _, err := tx.Exec(`DELETE FROM search_documents WHERE source = 'spec' AND workspace = $1`, req.ReplaceWorkspace); err != nil {
+			return fmt.Errorf("failed to clear workspace index: %w", err)
+		}
+	}
+
+	if len(req.RemoveRefs) > 0 {
+		if _, err := tx.Exec(`DELETE FROM search_documents WHERE source = 'spec' AND ref = ANY($1)`, pq.Array(req.RemoveRefs)); err != nil {
+			return fmt.Errorf("failed to remove spec documents: %w", err)
+		}
+	}
+
+	for _, doc := range req.Documents {
+		metadata := "{}"
+		if len(doc.Metadata) > 0 {
+			metadata = string(doc.Metadata)
+		}
+		_, err := tx.Exec(`
+			INSERT INTO search_documents (source, doc_type, ref, record_id, workspace, external_id, title, body,
+			                              status, stage, priority, owner, metadata)
+			VALUES ('spec', $1, $2, NULL, NULLIF($3, ''), NULLIF($4, ''), $5, $6,
+			        NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, ''), NULLIF($10, ''), $11)
+		`+upsertDocumentSuffix,
+			doc.DocType, doc.Ref, doc.Workspace, doc.ExternalID, doc.Title, doc.Body,
+			doc.Status, doc.Stage, doc.Priority, doc.Owner, metadata)
+		if err != nil {
+			return fmt.Errorf("failed to index %s: %w", doc.Ref, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit spec index changes: %w", err)
+	}
+	return nil
+}
+
+// buildSearchWhere turns a query into a WHERE clause. The facet named by skipFacet is left
+// unfiltered so its counts show the alternatives to the current selection.
+func buildSearchWhere(q models.SearchQuery, skipFacet string) (string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+
+	if strings.TrimSpace(q.Text) != "" {
+		args = append(args, q.Text)
+		conditions = append(conditions, fmt.Sprintf("search_vector @@ websearch_to_tsquery('english', $%d)", len(args)))
+	}
+	if q.Source != "" {
+		args = append(args, q.Source)
+		conditions = append(conditions, fmt.Sprintf("source = $%d", len(args)))
+	}
+	if q.Workspace != "" {
+		// Database records outside any workspace always match
+		args = append(args, q.Workspace)
+		conditions = append(conditions, fmt.Sprintf("(workspace = $%d OR (source = 'db' AND workspace IS NULL))", len(args)))
+	}
+	if len(q.HiddenWorkspaces) > 0 {
+		args = append(args, pq.Array(q.HiddenWorkspaces))
+		conditions = append(conditions, fmt.Sprintf("(workspace IS NULL OR NOT workspace = ANY($%d))", len(args)))
+	}
+	if q.OnlyWorkspaces != nil {
+		args = append(args, pq.Array(q.OnlyWorkspaces))
+		conditions = append(conditions, fmt.Sprintf("workspace = ANY($%d)", len(args)))
+	}
+	for _, facet := range models.SearchFacetFields {
+		values := q.Filters[facet]
+		if facet == skipFacet || len(values) == 0 {
+			continue
+		}
+		args = append(args, pq.Array(values))
+		conditions = append(conditions, fmt.Sprintf("%s = ANY($%d)", searchFacetColumns[facet], len(args)))
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// Search returns ranked hits with highlighted snippets plus facet counts
+func (r *SearchRepository) Search(q models.SearchQuery) (*models.SearchResponse, error) {
+	if q.Limit <= 0 || q.Limit > 100 {
+		q.Limit = 20
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+
+	where, args := buildSearchWhere(q, "")
+	hasText := strings.TrimSpace(q.Text) != ""
+
+	response := &models.SearchResponse{
+		Query:  q.Text,
+		Hits:   []models.SearchHit{},
+		Facets: map[string][]models.SearchFacetValue{},
+	}
+
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM search_documents`+where, args...).Scan(&response.Total); err != nil {
+		return nil, fmt.Errorf("failed to count search results: %w", err)
+	}
+
+	// Without a query, browse by recency with the start of the body as snippet
+	rank := "0::float8"
+	snippet := "left(coalesce(nullif(body, ''), title), 200)"
+	order := "updated_at DESC"
+	if hasText {
+		// $1 is always the query text when present; normalization 32 maps rank into [0,1)
+		// so spec files and records compete on the same scale
+		rank = "ts_rank_cd(search_vector, websearch_to_tsquery('english', $1), 32)"
+		snippet = `ts_headline('english', coalesce(nullif(body, ''), title), websearch_to_tsquery('english', $1),
+		           'StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=" … "')`
+		order = "rank DESC, updated_at DESC"
+	}
+
+	limitArgs := append(append([]interface{}{}, args...), q.Limit, q.Offset)
+	rows, err := r.db.Query(fmt.Sprintf(`
+		SELECT id, source, doc_type, ref, record_id, COALESCE(workspace, ''), COALESCE(external_id, ''),
+		       title, COALESCE(status, ''), COALESCE(stage, ''), COALESCE(priority, ''), COALESCE(owner, ''),
+		       metadata, updated_at, %s AS rank, %s AS snippet
+		FROM search_documents%s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d
+	`, rank, snippet, where, order, len(args)+1, len(args)+2), limitArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search documents: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hit models.SearchHit
+		var recordID sql.NullInt64
+		var metadata []byte
+		err := rows.Scan(
+			&hit.ID, &hit.Source, &hit.DocType, &hit.Ref, &recordID, &hit.Workspace, &hit.ExternalID,
+			&hit.Title, &hit.Status, &hit.Stage, &hit.Priority, &hit.Owner,
+			&metadata, &hit.UpdatedAt, &hit.Rank, &hit.Snippet,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan search hit: %w", err)
+		}
+		if recordID.Valid {
+			id := int(recordID.Int64)
+			hit.RecordID = &id
+		}
+		hit.Metadata = metadata
+		response.Hits = append(response.Hits, hit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read search hits: %w", err)
+	}
+
+	for _, facet := range models.SearchFacetFields {
+		values, err := r.facetCounts(q, facet)
+		if err != nil {
+			return nil, err
+		}
+		response.Facets[facet] = values
+	}
+
+	return response, nil
+}
+
+// facetCounts returns value counts for one facet under the query's other filters
+func (r *SearchRepository) facetCounts(q models.SearchQuery, facet string) ([]models.SearchFacetValue, error) {
+	column := searchFacetColumns[facet]
+	where, args := buildSearchWhere(q, facet)
+	if where == "" {
+		where = " WHERE "
+	} else {
+		where += " AND "
+	}
+	where += fmt.Sprintf("%s IS NOT NULL AND %s <> ''", column, column)
+
+	rows, err := r.db.Query(fmt.Sprintf(`
+		SELECT %s, COUNT(*)
+		FROM search_documents%s
+		GROUP BY %s
+		ORDER BY COUNT(*) DESC, %s
+		LIMIT 50
+	`, column, where, column, column), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count %s facet: %w", facet, err)
+	}
+	defer rows.Close()
+
+	values := []models.SearchFacetValue{}
+	for rows.Next() {
+		var v models.SearchFacetValue
+		if err := rows.Scan(&v.Value, &v.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan %s facet: %w", facet, err)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
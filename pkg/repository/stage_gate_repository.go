@@ -0,0 +1,142 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+// StageGateRepository handles database operations for stage gate rules
+type StageGateRepository struct {
+	db *sql.DB
+}
+
+// NewStageGateRepository creates a new stage gate repository
+func NewStageGateRepository(db *sql.DB) *StageGateRepository {
+	return &StageGateRepository{db: db}
+}
+
+// GetRules returns gate rules, optionally limited to one stage
+func (r *StageGateRepository) GetRules(stage string) ([]models.StageGateRule, error) {
+	query := `
+		SELECT id, stage, check_type, COALESCE(description, ''), params, applies_to,
+		       is_active, created_at, updated_at
+		FROM stage_gate_rules
+	`
+	args := []interface{}{}
+	if stage != "" {
+		query += " WHERE stage = $1"
+		args = append(args, stage)
+	}
+	query += " ORDER BY stage, id"
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stage gate rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []models.StageGateRule{}
+	for rows.Next() {
+		var rule models.StageGateRule
+		var params []byte
+		err := rows.Scan(
+			&rule.ID, &rule.Stage, &rule.CheckType, &rule.Description, &params,
+			&rule.AppliesTo, &rule.IsActive, &rule.CreatedAt, &rule.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan stage gate rule: %w", err)
+		}
+		rule.Params = params
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// Create adds a gate rule
+func (r *StageGateRepository) Create(req models.SaveStageGateRuleRequest) (*models.StageGateRule, error) {
+	isActive := true
+	if req.IsActive != nil {
+		isActive = *req.IsActive
+	}
+
+	var id int
+	err := r.db.QueryRow(`
+		INSERT INTO stage_gate_rules (stage, check_type, description, params, applies_to, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, req.Stage, req.CheckType, req.Description, paramsOrEmpty(req.Params), req.AppliesTo, isActive).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stage gate rule: %w", err)
+	}
+
+	return r.GetByID(id)
+}
+
+// Update replaces a gate rule's settings
+func (r *StageGateRepository) Update(id int, req models.SaveStageGateRuleRequest) (*models.StageGateRule, error) {
+	isActive := true
+	if req.IsActive != nil {
+		isActive = *req.IsActive
+	}
+
+	result, err := r.db.Exec(`
+		UPDATE stage_gate_rules
+		SET stage = $1, check_type = $2, description = $3, params = $4, applies_to = $5, is_active = $6
+		WHERE id = $7
+	`, req.Stage, req.CheckType, req.Description, paramsOrEmpty(req.Params), req.AppliesTo, isActive, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update stage gate rule: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, fmt.Errorf("stage gate rule not found")
+	}
+
+	return r.GetByID(id)
+}
+
+// Delete removes a gate rule
+func (r *StageGateRepository) Delete(id int) error {
+	_, err := r.db.Exec(`DELETE FROM stage_gate_rules WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete stage gate rule: %w", err)
+	}
+	return nil
+}
+
+// GetByID returns a single gate rule
+func (r *StageGateRepository) GetByID(id int) (*models.StageGateRule, error) {
+	var rule models.StageGateRule
+	var params []byte
+	err := r.db.QueryRow(`
+		SELECT id, stage, check_type, COALESCE(description, ''), params, applies_to,
+		       is_active, created_at, updated_at
+		FROM stage_gate_rules
+		WHERE id = $1
+	`, id).Scan(
+		&rule.ID, &rule.Stage, &rule.CheckType, &rule.Description, &params,
+		&rule.AppliesTo, &rule.IsActive, &rule.CreatedAt, &rule.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stage gate rule: %w", err)
+	}
+	rule.Params = params
+	return &rule, nil
+}
+
+func paramsOrEmpty(params []byte) string {
+	if len(params) == 0 {
+		return "{}"
+	}
+	return string(params)
+}
@@ -0,0 +1,470 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/lib/pq"
+)
+
+// archiveTable describes how a table's rows travel in a workspace archive
+type archiveTable struct {
+	name   string
+	where  string            // Selects the workspace's rows; $1 is the workspace ID
+	refs   map[string]string // Columns holding IDs of rows in other archived tables
+	users  []string          // Columns holding user IDs
+	key    string            // Column holding an identifier unique across workspaces, e.g. CAP-582341
+	entity bool              // entity_type/entity_id point at a capability, enabler or requirement
+}
+
+const (
+	archivedCapabilities = `SELECT id FROM capabilities WHERE workspace_id = $1`
+	archivedEnablers     = `SELECT id FROM enablers WHERE capability_id IN (` + archivedCapabilities + `)`
+	archivedRequirements = `SELECT id FROM enabler_requirements WHERE enabler_id IN (` + archivedEnablers + `)`
+)
+
+// archiveTables lists the archived tables in insert order, parents first
+var archiveTables = []archiveTable{
+	{
+		name:  "capabilities",
+		where: `workspace_id = $1`,
+		refs:  map[string]string{"workspace_id": "workspaces"},
+		users: []string{"created_by", "approved_by"},
+		key:   "capability_id",
+	},
+	{
+		name:  "capability_dependencies",
+		where: `capability_id IN (` + archivedCapabilities + `) AND depends_on_id IN (` + archivedCapabilities + `)`,
+		refs:  map[string]string{"capability_id": "capabilities", "depends_on_id": "capabilities"},
+	},
+	{
+		name:  "capability_assets",
+		where: `capability_id IN (` + archivedCapabilities + `)`,
+		refs:  map[string]string{"capability_id": "capabilities"},
+		users: []string{"created_by"},
+	},
+	{
+		name:  "enablers",
+		where: `capability_id IN (` + archivedCapabilities + `)`,
+		refs:  map[string]string{"capability_id": "capabilities"},
+		users: []string{"created_by"},
+		key:   "enabler_id",
+	},
+	{
+		name: "enabler_dependencies",
+		where: `enabler_id IN (` + archivedEnablers + `) AND (depends_on_enabler_id IN (` + archivedEnablers + `)
+			OR depends_on_capability_id IN (` + archivedCapabilities + `))`,
+		refs: map[string]string{"enabler_id": "enablers", "depends_on_enabler_id": "enablers", "depends_on_capability_id": "capabilities"},
+	},
+	{
+		name:  "enabler_requirements",
+		where: `enabler_id IN (` + archivedEnablers + `)`,
+		refs:  map[string]string{"enabler_id": "enablers"},
+		users: []string{"created_by", "verified_by"},
+		key:   "requirement_id",
+	},
+	{
+		name: "acceptance_criteria",
+		where: `(entity_type = 'capability' AND entity_id IN (` + archivedCapabilities + `))
+			OR (entity_type = 'enabler' AND entity_id IN (` + archivedEnablers + `))
+			OR (entity_type = 'requirement' AND entity_id IN (` + archivedRequirements + `))`,
+		users:  []string{"created_by", "verified_by"},
+		key:    "criteria_id",
+		entity: true,
+	},
+	{
+		name:  "capability_approvals",
+		where: `capability_id IN (` + archivedCapabilities + `)`,
+		refs:  map[string]string{"capability_id": "capabilities"},
+		users: []string{"requested_by", "decided_by", "escalated_to_user_id"},
+	},
+	{
+		name:  "enabler_approvals",
+		where: `enabler_id IN (` + archivedEnablers + `)`,
+		refs:  map[string]string{"enabler_id": "enablers"},
+		users: []string{"requested_by", "decided_by"},
+	},
+	{
+		name:  "approval_audit_log",
+		where: `capability_id IN (` + archivedCapabilities + `)`,
+		refs:  map[string]string{"approval_id": "capability_approvals", "capability_id": "capabilities"},
+		users: []string{"performed_by"},
+	},
+	{
+		name:  "workspace_integrations",
+		where: `workspace_id = $1`,
+		refs:  map[string]string{"workspace_id": "workspaces"},
+		users: []string{"created_by"},
+	},
+}
+
+// entityTables maps acceptance_criteria.entity_type to the table entity_id points into
+var entityTables = map[string]string{
+	"capability":  "capabilities",
+	"enabler":     "enablers",
+	"requirement": "enabler_requirements",
+}
+
+// recordID reads an ID column from a row decoded from JSON
+func recordID(value interface{}) (int, bool) {
+	if f, ok := value.(float64); ok && f == float64(int(f)) {
+		return int(f), true
+	}
+	return 0, false
+}
+
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// tableColumns returns a table's columns and whether each accepts NULL; a table that does
+// not exist has none. Installs that skipped an optional migration lack some tables.
+func tableColumns(q queryer, table string) (map[string]bool, error) {
+	rows, err := q.Query(`
+		SELECT column_name, is_nullable = 'YES' FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1
+	`, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	columns := map[string]bool{}
+	for rows.Next() {
+		var name string
+		var nullable bool
+		if err := rows.Scan(&name, &nullable); err != nil {
+			return nil, err
+		}
+		columns[name] = nullable
+	}
+	return columns, rows.Err()
+}
+
+// ExportRecords reads a workspace's capabilities, enablers, requirements, acceptance
+// criteria, approval history and integration links. Credential-like keys are removed from
+// integration metadata.
+func (r *WorkspaceRepository) ExportRecords(workspaceID int) (*models.WorkspaceRecords, error) {
+	records := &models.WorkspaceRecords{
+		Users:  map[string]string{},
+		Tables: map[string][]map[string]interface{}{},
+	}
+	userIDs := map[int]bool{}
+
+	for _, t := range archiveTables {
+		columns, err := tableColumns(r.db, t.name)
+		if err != nil {
+			return nil, err
+		}
+		if len(columns) == 0 {
+			continue
+		}
+
+		rows, err := r.db.Query(`SELECT to_jsonb(t) FROM `+t.name+` t WHERE `+t.where+` ORDER BY t.id`, workspaceID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export %s: %w", t.name, err)
+		}
+		list := []map[string]interface{}{}
+		for rows.Next() {
+			var data []byte
+			if err := rows.Scan(&data); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			var row map[string]interface{}
+			if err := json.Unmarshal(data, &row); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if meta, ok := row["resource_metadata"].(map[string]interface{}); ok {
+				models.RedactSecrets(meta)
+			}
+			for _, column := range t.users {
+				if id, ok := recordID(row[column]); ok {
+					userIDs[id] = true
+				}
+			}
+			list = append(list, row)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to export %s: %w", t.name, err)
+		}
+		records.Tables[t.name] = list
+	}
+
+	if len(userIDs) == 0 {
+		return records, nil
+	}
+	ids := make([]int64, 0, len(userIDs))
+	for id := range userIDs {
+		ids = append(ids, int64(id))
+	}
+	rows, err := r.db.Query(`SELECT id, email FROM users WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to export users: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var email string
+		if err := rows.Scan(&id, &email); err != nil {
+			return nil, err
+		}
+		records.Users[strconv.Itoa(id)] = email
+	}
+	return records, rows.Err()
+}
+
+// RecordConflicts returns the archived identifiers (capability, enabler, requirement and
+// criteria IDs) that already exist in this database
+func (r *WorkspaceRepository) RecordConflicts(records *models.WorkspaceRecords) ([]models.WorkspaceImportConflict, error) {
+	conflicts := []models.WorkspaceImportConflict{}
+	for _, t := range archiveTables {
+		if t.key == "" || len(records.Tables[t.name]) == 0 {
+			continue
+		}
+		values := []string{}
+		for _, row := range records.Tables[t.name] {
+			if value, ok := row[t.key].(string); ok {
+				values = append(values, value)
+			}
+		}
+
+		columns, err := tableColumns(r.db, t.name)
+		if err != nil {
+			return nil, err
+		}
+		if len(columns) == 0 {
+			continue
+		}
+		rows, err := r.db.Query(`SELECT `+t.key+` FROM `+t.name+` WHERE `+t.key+` = ANY($1) ORDER BY 1`, pq.Array(values))
+		if err != nil {
+			return nil, fmt.Errorf("failed to check %s for conflicts: %w", t.name, err)
+		}
+		for rows.Next() {
+			var value string
+			if err := rows.Scan(&value); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			conflicts = append(conflicts, models.WorkspaceImportConflict{Table: t.name, Column: t.key, Value: value})
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return conflicts, nil
+}
+
+// RenameRecords replaces archived identifiers, as found by RecordConflicts, with new values
+func RenameRecords(records *models.WorkspaceRecords, renamed map[string]string) {
+	for _, t := range archiveTables {
+		if t.key == "" {
+			continue
+		}
+		for _, row := range records.Tables[t.name] {
+			if value, ok := row[t.key].(string); ok {
+				if to, ok := renamed[value]; ok {
+					row[t.key] = to
+				}
+			}
+		}
+	}
+}
+
+// ImportRecords registers a workspace and inserts its archived records in one transaction.
+// Row IDs are remapped to the new rows, and users are matched by email; unknown users
+// become NULL, or the importing user where a column requires one. Columns this database
+// does not have are dropped. It returns the workspace, the rows inserted per table and
+// warnings about anything left out.
+func (r *WorkspaceRepository) ImportRecords(req models.CreateWorkspaceRequest, records *models.WorkspaceRecords, importerID *int) (*models.Workspace, map[string]int, []string, error) {
+	settings, err := marshalSettings(req.Settings)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if req.WorkspaceType == "" {
+		req.WorkspaceType = "new"
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to begin import: %w", err)
+	}
+	defer tx.Rollback()
+
+	var workspaceID int
+	err = tx.QueryRow(`
+		INSERT INTO workspaces (user_id, name, description, folder_name, workspace_type, figma_file_url, is_shared, config_id, settings)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, NULLIF($6, ''), $7, NULLIF($8, ''), $9)
+		RETURNING id
+	`, importerID, req.Name, req.Description, req.FolderName, req.WorkspaceType, req.FigmaFileURL, req.IsShared, req.ConfigID, settings).Scan(&workspaceID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, nil, nil, ErrWorkspaceFolderTaken
+		}
+		return nil, nil, nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+
+	warnings := []string{}
+	users := map[string]int{}
+	for oldID, email := range records.Users {
+		var id int
+		err := tx.QueryRow(`SELECT id FROM users WHERE LOWER(email) = LOWER($1)`, email).Scan(&id)
+		if err == sql.ErrNoRows {
+			warnings = append(warnings, fmt.Sprintf("user %s does not exist here; their records are unattributed or attributed to the importer", email))
+			continue
+		}
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to look up user: %w", err)
+		}
+		users[oldID] = id
+	}
+	sort.Strings(warnings)
+
+	ids := map[string]map[int]int{}
+	counts := map[string]int{}
+	for _, t := range archiveTables {
+		rows := records.Tables[t.name]
+		if len(rows) == 0 {
+			continue
+		}
+		columns, err := tableColumns(tx, t.name)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if len(columns) == 0 {
+			warnings = append(warnings, fmt.Sprintf("%s does not exist here; %d rows were left out", t.name, len(rows)))
+			continue
+		}
+
+		ids[t.name] = map[int]int{}
+		dropped := map[string]bool{}
+		skipped := 0
+		for _, row := range rows {
+			oldID, _ := recordID(row["id"])
+			if !remapRow(t, row, columns, ids, workspaceID, users, importerID) {
+				skipped++
+				continue
+			}
+
+			names := []string{}
+			for column := range row {
+				if column == "id" {
+					continue
+				}
+				if _, ok := columns[column]; !ok {
+					dropped[column] = true
+					continue
+				}
+				names = append(names, pq.QuoteIdentifier(column))
+			}
+			sort.Strings(names)
+			data, err := json.Marshal(row)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+
+			list := strings.Join(names, ", ")
+			var newID int
+			err = tx.QueryRow(`INSERT INTO `+t.name+` (`+list+`) SELECT `+list+
+				` FROM jsonb_populate_record(NULL::`+t.name+`, $1) RETURNING id`, data).Scan(&newID)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("failed to import %s row %d: %w", t.name, oldID, err)
+			}
+			ids[t.name][oldID] = newID
+			counts[t.name]++
+		}
+
+		if skipped > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s: %d rows referring to records or users that could not be imported were left out", t.name, skipped))
+		}
+		if len(dropped) > 0 {
+			names := make([]string, 0, len(dropped))
+			for column := range dropped {
+				names = append(names, column)
+			}
+			sort.Strings(names)
+			warnings = append(warnings, fmt.Sprintf("%s: columns %s do not exist here and were dropped", t.name, strings.Join(names, ", ")))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to commit import: %w", err)
+	}
+	ws, err := r.Get(workspaceID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return ws, counts, warnings, nil
+}
+
+// remapRow points a row's references at the imported rows and users. It reports false
+// when a required reference has no imported row or user to point at.
+func remapRow(t archiveTable, row map[string]interface{}, columns map[string]bool, ids map[string]map[int]int, workspaceID int, users map[string]int, importerID *int) bool {
+	refs := t.refs
+	if t.entity {
+		entityType, _ := row["entity_type"].(string)
+		refs = map[string]string{"entity_id": entityTables[entityType]}
+	}
+
+	for column, target := range refs {
+		old, ok := recordID(row[column])
+		if !ok {
+			continue
+		}
+		if target == "workspaces" {
+			row[column] = workspaceID
+			continue
+		}
+		if id, ok := ids[target][old]; ok {
+			row[column] = id
+			continue
+		}
+		if !columns[column] {
+			return false
+		}
+		row[column] = nil
+	}
+
+	for _, column := range t.users {
+		old, ok := recordID(row[column])
+		if !ok {
+			continue
+		}
+		switch id, ok := users[strconv.Itoa(old)]; {
+		case ok:
+			row[column] = id
+		case columns[column]:
+			row[column] = nil
+		case importerID != nil:
+			row[column] = *importerID
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// IsImportConflict reports whether an import failed on an identifier that is already taken
+func IsImportConflict(err error) bool {
+	return isUniqueViolation(err) || errors.Is(err, ErrWorkspaceFolderTaken)
+}
@@ -0,0 +1,373 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrWorkspaceFolderTaken = errors.New("another workspace already uses this folder")
+	ErrWorkspaceOwner       = errors.New("new owner must be an active user")
+	ErrIntegrationNotFound  = errors.New("workspace integration not found")
+)
+
+// WorkspaceRepository handles the workspace registry and its integration links
+type WorkspaceRepository struct {
+	db *sql.DB
+}
+
+// NewWorkspaceRepository creates a new workspace repository
+func NewWorkspaceRepository(db *sql.DB) *WorkspaceRepository {
+	return &WorkspaceRepository{db: db}
+}
+
+const workspaceSelect = `
+	SELECT w.id, w.name, COALESCE(w.description, ''), COALESCE(w.folder_name, ''), w.workspace_type,
+	       COALESCE(w.figma_file_url, ''), w.user_id, COALESCE(u.name, ''), COALESCE(u.email, ''), COALESCE(w.is_shared, false),
+	       COALESCE(w.config_id, ''), w.settings, w.archived_at, w.missing_since, w.created_at, w.updated_at,
+	       (SELECT COUNT(*) FROM workspace_members m WHERE m.workspace_id = w.id)
+	FROM workspaces w
+	LEFT JOIN users u ON u.id = w.user_id`
+
+func scanWorkspace(row interface{ Scan(...interface{}) error }) (*models.Workspace, error) {
+	var ws models.Workspace
+	var settings []byte
+	err := row.Scan(&ws.ID, &ws.Name, &ws.Description, &ws.FolderName, &ws.WorkspaceType,
+		&ws.FigmaFileURL, &ws.OwnerID, &ws.OwnerName, &ws.OwnerEmail, &ws.IsShared,
+		&ws.ConfigID, &settings, &ws.ArchivedAt, &ws.MissingSince, &ws.CreatedAt, &ws.UpdatedAt,
+		&ws.MemberCount)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(settings, &ws.Settings); err != nil || ws.Settings == nil {
+		ws.Settings = map[string]interface{}{}
+	}
+	if ws.FolderName != "" {
+		ws.Path = path.Join(models.WorkspacesDir, ws.FolderName)
+	}
+	return &ws, nil
+}
+
+func (r *WorkspaceRepository) queryWorkspaces(query string, args ...interface{}) ([]models.Workspace, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query workspaces: %w", err)
+	}
+	defer rows.Close()
+
+	workspaces := []models.Workspace{}
+	for rows.Next() {
+		ws, err := scanWorkspace(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan workspace: %w", err)
+		}
+		workspaces = append(workspaces, *ws)
+	}
+	return workspaces, rows.Err()
+}
+
+// List returns every workspace, leaving out archived ones unless includeArchived is set
+func (r *WorkspaceRepository) List(includeArchived bool) ([]models.Workspace, error) {
+	return r.queryWorkspaces(workspaceSelect+` WHERE $1 OR w.archived_at IS NULL ORDER BY LOWER(w.name), w.id`, includeArchived)
+}
+
+// Get returns a workspace by ID
+func (r *WorkspaceRepository) Get(id int) (*models.Workspace, error) {
+	ws, err := scanWorkspace(r.db.QueryRow(workspaceSelect+` WHERE w.id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrWorkspaceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace: %w", err)
+	}
+	return ws, nil
+}
+
+// GetByFolder returns the workspace registered for a folder under workspaces/
+func (r *WorkspaceRepository) GetByFolder(folder string) (*models.Workspace, error) {
+	ws, err := scanWorkspace(r.db.QueryRow(workspaceSelect+` WHERE w.folder_name = $1`, folder))
+	if err == sql.ErrNoRows {
+		return nil, ErrWorkspaceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace: %w", err)
+	}
+	return ws, nil
+}
+
+func marshalSettings(settings map[string]interface{}) ([]byte, error) {
+	if settings == nil {
+		settings = map[string]interface{}{}
+	}
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return nil, fmt.Errorf("invalid settings: %w", err)
+	}
+	return data, nil
+}
+
+// isUniqueViolation reports whether err is a unique constraint violation; on workspaces
+// only the folder index is unique
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// Create registers a workspace. req.FolderName must already be validated.
+func (r *WorkspaceRepository) Create(req models.CreateWorkspaceRequest, ownerID *int) (*models.Workspace, error) {
+	settings, err := marshalSettings(req.Settings)
+	if err != nil {
+		return nil, err
+	}
+	if req.WorkspaceType == "" {
+		req.WorkspaceType = "new"
+	}
+
+	var id int
+	err = r.db.QueryRow(`
+		INSERT INTO workspaces (user_id, name, description, folder_name, workspace_type, figma_file_url, is_shared, config_id, settings)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, NULLIF($6, ''), $7, NULLIF($8, ''), $9)
+		RETURNING id
+	`, ownerID, req.Name, req.Description, req.FolderName, req.WorkspaceType, req.FigmaFileURL, req.IsShared, req.ConfigID, settings).Scan(&id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrWorkspaceFolderTaken
+		}
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	return r.Get(id)
+}
+
+// Update changes the given fields of a workspace
+func (r *WorkspaceRepository) Update(id int, req models.UpdateWorkspaceRequest) (*models.Workspace, error) {
+	var settings interface{}
+	if req.Settings != nil {
+		data, err := marshalSettings(*req.Settings)
+		if err != nil {
+			return nil, err
+		}
+		settings = data
+	}
+
+	result, err := r.db.Exec(`
+		UPDATE workspaces SET
+			name = COALESCE($2, name),
+			description = COALESCE($3, description),
+			workspace_type = COALESCE($4, workspace_type),
+			figma_file_url = COALESCE($5, figma_file_url),
+			is_shared = COALESCE($6, is_shared),
+			settings = COALESCE($7, settings)
+		WHERE id = $1
+	`, id, req.Name, req.Description, req.WorkspaceType, req.FigmaFileURL, req.IsShared, settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update workspace: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, ErrWorkspaceNotFound
+	}
+	return r.Get(id)
+}
+
+// SetArchived archives or restores a workspace
+func (r *WorkspaceRepository) SetArchived(id int, archived bool, by *int) (*models.Workspace, error) {
+	result, err := r.db.Exec(`
+		UPDATE workspaces SET
+			archived_at = CASE WHEN $2 THEN COALESCE(archived_at, CURRENT_TIMESTAMP) END,
+			archived_by = CASE WHEN $2 THEN COALESCE(archived_by, $3) END
+		WHERE id = $1
+	`, id, archived, by)
+	if err != nil {
+		return nil, fmt.Errorf("failed to archive workspace: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, ErrWorkspaceNotFound
+	}
+	return r.Get(id)
+}
+
+// TransferOwnership makes another active user the owner. The previous owner keeps access
+// only through a membership or sharing.
+func (r *WorkspaceRepository) TransferOwnership(id, ownerID int) (*models.Workspace, error) {
+	var active bool
+	err := r.db.QueryRow(`SELECT is_active FROM users WHERE id = $1`, ownerID).Scan(&active)
+	if err == sql.ErrNoRows || (err == nil && !active) {
+		return nil, ErrWorkspaceOwner
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to check user: %w", err)
+	}
+
+	result, err := r.db.Exec(`UPDATE workspaces SET user_id = $2 WHERE id = $1`, id, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transfer workspace: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, ErrWorkspaceNotFound
+	}
+	return r.Get(id)
+}
+
+// Delete removes a workspace from the registry. Capabilities keep existing outside any
+// workspace; the folder on disk is left alone.
+func (r *WorkspaceRepository) Delete(id int) error {
+	result, err := r.db.Exec(`DELETE FROM workspaces WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete workspace: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrWorkspaceNotFound
+	}
+	return nil
+}
+
+// UserIDByEmail resolves a .ubeworkspace owner, which the web UI records by email
+func (r *WorkspaceRepository) UserIDByEmail(email string) (*int, error) {
+	var id int
+	err := r.db.QueryRow(`SELECT id FROM users WHERE LOWER(email) = LOWER($1)`, email).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up user: %w", err)
+	}
+	return &id, nil
+}
+
+// SyncFromConfig refreshes a row from its .ubeworkspace file and clears missing_since.
+// Only fields that differ are written so updated_at reflects real changes.
+func (r *WorkspaceRepository) SyncFromConfig(id int, name, description, workspaceType, configID string, isShared bool, settings map[string]interface{}) (bool, error) {
+	data, err := marshalSettings(settings)
+	if err != nil {
+		return false, err
+	}
+	result, err := r.db.Exec(`
+		UPDATE workspaces SET name = $2, description = NULLIF($3, ''), workspace_type = $4,
+			config_id = NULLIF($5, ''), is_shared = $6, settings = $7, missing_since = NULL
+		WHERE id = $1 AND (name IS DISTINCT FROM $2 OR COALESCE(description, '') IS DISTINCT FROM $3
+			OR workspace_type IS DISTINCT FROM $4 OR COALESCE(config_id, '') IS DISTINCT FROM $5
+			OR COALESCE(is_shared, false) IS DISTINCT FROM $6 OR settings IS DISTINCT FROM $7::jsonb
+			OR missing_since IS NOT NULL)
+	`, id, name, description, workspaceType, configID, isShared, data)
+	if err != nil {
+		return false, fmt.Errorf("failed to sync workspace: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// SetFolder assigns a folder to a workspace registered without one
+func (r *WorkspaceRepository) SetFolder(id int, folder string) error {
+	if _, err := r.db.Exec(`UPDATE workspaces SET folder_name = $2 WHERE id = $1`, id, folder); err != nil {
+		if isUniqueViolation(err) {
+			return ErrWorkspaceFolderTaken
+		}
+		return fmt.Errorf("failed to set workspace folder: %w", err)
+	}
+	return nil
+}
+
+// SetMissing records whether a workspace's folder exists; it returns true when the state
+// changed
+func (r *WorkspaceRepository) SetMissing(id int, missing bool) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE workspaces SET missing_since = CASE WHEN $2 THEN CURRENT_TIMESTAMP END
+		WHERE id = $1 AND (missing_since IS NOT NULL) <> $2
+	`, id, missing)
+	if err != nil {
+		return false, fmt.Errorf("failed to update workspace: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+const integrationSelect = `
+	SELECT id, workspace_id, integration_name, resource_type, resource_id, COALESCE(resource_name, ''),
+	       resource_metadata, COALESCE(is_active, true), created_by, created_at, updated_at
+	FROM workspace_integrations`
+
+func scanIntegration(row interface{ Scan(...interface{}) error }) (*models.WorkspaceIntegration, error) {
+	var wi models.WorkspaceIntegration
+	var metadata []byte
+	err := row.Scan(&wi.ID, &wi.WorkspaceID, &wi.IntegrationName, &wi.ResourceType, &wi.ResourceID, &wi.ResourceName,
+		&metadata, &wi.IsActive, &wi.CreatedBy, &wi.CreatedAt, &wi.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if len(metadata) > 0 {
+		json.Unmarshal(metadata, &wi.ResourceMetadata)
+	}
+	return &wi, nil
+}
+
+// ListIntegrations returns the resources linked to a workspace
+func (r *WorkspaceRepository) ListIntegrations(workspaceID int) ([]models.WorkspaceIntegration, error) {
+	rows, err := r.db.Query(integrationSelect+` WHERE workspace_id = $1 ORDER BY integration_name, resource_type, resource_name`, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query workspace integrations: %w", err)
+	}
+	defer rows.Close()
+
+	links := []models.WorkspaceIntegration{}
+	for rows.Next() {
+		wi, err := scanIntegration(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan workspace integration: %w", err)
+		}
+		links = append(links, *wi)
+	}
+	return links, rows.Err()
+}
+
+// LinkIntegration links a resource to a workspace, updating the link if it exists
+func (r *WorkspaceRepository) LinkIntegration(workspaceID int, req models.WorkspaceIntegrationRequest, by *int) (*models.WorkspaceIntegration, error) {
+	var metadata interface{}
+	if req.ResourceMetadata != nil {
+		data, err := json.Marshal(req.ResourceMetadata)
+		if err != nil {
+			return nil, fmt.Errorf("invalid resource metadata: %w", err)
+		}
+		metadata = data
+	}
+	active := req.IsActive == nil || *req.IsActive
+
+	wi, err := scanIntegration(r.db.QueryRow(`
+		INSERT INTO workspace_integrations (workspace_id, integration_name, resource_type, resource_id, resource_name, resource_metadata, is_active, created_by)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8)
+		ON CONFLICT (workspace_id, integration_name, resource_type, resource_id) DO UPDATE SET
+			resource_name = EXCLUDED.resource_name,
+			resource_metadata = COALESCE(EXCLUDED.resource_metadata, workspace_integrations.resource_metadata),
+			is_active = EXCLUDED.is_active
+		RETURNING id, workspace_id, integration_name, resource_type, resource_id, COALESCE(resource_name, ''),
+		          resource_metadata, is_active, created_by, created_at, updated_at
+	`, workspaceID, req.IntegrationName, req.ResourceType, req.ResourceID, req.ResourceName, metadata, active, by))
+	if err != nil {
+		return nil, fmt.Errorf("failed to link integration: %w", err)
+	}
+	return wi, nil
+}
+
+// UnlinkIntegration removes a resource link from a workspace
+func (r *WorkspaceRepository) UnlinkIntegration(workspaceID, linkID int) error {
+	result, err := r.db.Exec(`DELETE FROM workspace_integrations WHERE id = $1 AND workspace_id = $2`, linkID, workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to unlink integration: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrIntegrationNotFound
+	}
+	return nil
+}
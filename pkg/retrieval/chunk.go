@@ -0,0 +1,177 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package retrieval
+
+import (
+	"bytes"
+	"path"
+	"strings"
+)
+
+// What a chunk was cut from
+const (
+	KindSpec = "spec" // Markdown
+	KindCode = "code"
+)
+
+// ChunkTokens is the size chunks are cut to
+const ChunkTokens = 400
+
+// maxFileSize skips generated and vendored files too large to be useful context
+const maxFileSize = 512 * 1024
+
+// SkipDirs are never indexed (dependency, build and VCS folders)
+var SkipDirs = map[string]bool{
+	".git": true, "node_modules": true, "vendor": true, "dist": true,
+	"build": true, ".next": true, "__pycache__": true, "target": true,
+}
+
+// codeExtensions are the source files indexed besides markdown
+var codeExtensions = map[string]bool{
+	".go": true, ".js": true, ".jsx": true, ".ts": true, ".tsx": true, ".py": true,
+	".java": true, ".kt": true, ".rb": true, ".rs": true, ".cs": true, ".php": true,
+	".swift": true, ".c": true, ".h": true, ".cpp": true, ".hpp": true, ".sql": true,
+	".css": true, ".scss": true, ".html": true, ".vue": true, ".svelte": true,
+	".yaml": true, ".yml": true, ".json": true, ".toml": true, ".sh": true,
+}
+
+// Chunk is a piece of a workspace file small enough to be embedded and quoted
+type Chunk struct {
+	Path      string    `json:"path"` // Workspace-relative, slash separated
+	Kind      string    `json:"kind"`
+	Heading   string    `json:"heading,omitempty"` // Nearest markdown heading above the chunk
+	StartLine int       `json:"startLine"`         // 1-based, inclusive
+	EndLine   int       `json:"endLine"`
+	Text      string    `json:"text"`
+	Tokens    int       `json:"tokens"`
+	Vector    []float32 `json:"vector,omitempty"`
+}
+
+// EstimateTokens approximates the model tokens of a text at four characters per token
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// KindOf returns the chunk kind of a workspace-relative path, or "" when the file is not indexed
+func KindOf(relPath string) string {
+	relPath = strings.ReplaceAll(relPath, "\\", "/")
+	for _, dir := range strings.Split(path.Dir(relPath), "/") {
+		if SkipDirs[dir] || (strings.HasPrefix(dir, ".") && dir != ".") {
+			return ""
+		}
+	}
+	if strings.HasPrefix(path.Base(relPath), ".") {
+		return ""
+	}
+	ext := strings.ToLower(path.Ext(relPath))
+	switch {
+	case ext == ".md":
+		return KindSpec
+	case codeExtensions[ext]:
+		return KindCode
+	}
+	return ""
+}
+
+// IsText reports whether file content is worth indexing: not too large and not binary
+func IsText(content []byte) bool {
+	if len(content) > maxFileSize {
+		return false
+	}
+	head := content
+	if len(head) > 8000 {
+		head = head[:8000]
+	}
+	return bytes.IndexByte(head, 0) == -1
+}
+
+// ChunkFile cuts a file into chunks of about ChunkTokens. Markdown is cut at headings
+// first so a chunk never straddles two sections; code is cut at blank lines where it can be.
+func ChunkFile(relPath, kind, content string) []Chunk {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+
+	var chunks []Chunk
+	if kind != KindSpec {
+		for _, c := range packLines(lines, 0, "") {
+			c.Path, c.Kind = relPath, kind
+			chunks = append(chunks, c)
+		}
+		return chunks
+	}
+
+	// Split into sections at headings, ignoring '#' lines inside fenced code
+	start, heading, inFence := 0, "", false
+	flush := func(end int) {
+		for _, c := range packLines(lines[start:end], start, heading) {
+			c.Path, c.Kind = relPath, kind
+			chunks = append(chunks, c)
+		}
+	}
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if inFence || !strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		rest := strings.TrimLeft(trimmed, "#")
+		title := strings.TrimSpace(rest)
+		if title == "" || !strings.HasPrefix(rest, " ") || len(trimmed)-len(rest) > 6 {
+			continue
+		}
+		flush(i)
+		start, heading = i, title
+	}
+	flush(len(lines))
+	return chunks
+}
+
+// packLines groups lines into chunks of at most ChunkTokens, preferring to cut after a
+// blank line in the second half of a chunk. offset is the index of the first line in the file.
+func packLines(lines []string, offset int, heading string) []Chunk {
+	var chunks []Chunk
+	emit := func(from, to int) {
+		text := strings.TrimSpace(strings.Join(lines[from:to], "\n"))
+		if text == "" {
+			return
+		}
+		chunks = append(chunks, Chunk{
+			Heading:   heading,
+			StartLine: offset + from + 1,
+			EndLine:   offset + to,
+			Text:      text,
+			Tokens:    EstimateTokens(text),
+		})
+	}
+
+	from, tokens, lastBlank := 0, 0, -1
+	for i, line := range lines {
+		lineTokens := EstimateTokens(line) + 1
+		if tokens+lineTokens > ChunkTokens && i > from {
+			cut := i
+			if lastBlank > from && lastBlank-from >= (i-from)/2 {
+				cut = lastBlank + 1
+			}
+			emit(from, cut)
+			from, lastBlank = cut, -1
+			tokens = 0
+			for _, l := range lines[from:i] {
+				tokens += EstimateTokens(l) + 1
+			}
+		}
+		tokens += lineTokens
+		if strings.TrimSpace(line) == "" {
+			lastBlank = i
+		}
+	}
+	emit(from, len(lines))
+	return chunks
+}
@@ -0,0 +1,255 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package retrieval
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// updateBatchFiles is how many changed files are embedded and stored at a time
+const updateBatchFiles = 50
+
+// Index chunks workspace files, embeds the chunks and finds the ones relevant to a query
+type Index struct {
+	embedder Embedder
+	store    Store
+}
+
+// NewIndex creates an index that embeds with embedder and keeps vectors in store
+func NewIndex(embedder Embedder, store Store) *Index {
+	return &Index{embedder: embedder, store: store}
+}
+
+// Embedder returns the name of the embedder vectors are computed with
+func (ix *Index) Embedder() string {
+	return ix.embedder.Name()
+}
+
+// IndexStats counts what a workspace index run did
+type IndexStats struct {
+	Files     int `json:"files"`     // Files (re)embedded
+	Chunks    int `json:"chunks"`    // Chunks embedded
+	Unchanged int `json:"unchanged"` // Files skipped because their content hash matched
+	Removed   int `json:"removed"`   // Files dropped because they were deleted
+}
+
+// IndexWorkspace brings the index of a workspace in line with the files under root. Only
+// files whose content changed since the last run are embedded again.
+func (ix *Index) IndexWorkspace(ctx context.Context, workspace, root string) (IndexStats, error) {
+	var stats IndexStats
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return stats, fmt.Errorf("workspace folder not found: %s", root)
+	}
+	hashes, err := ix.store.FileHashes(workspace, ix.Embedder())
+	if err != nil {
+		return stats, err
+	}
+
+	seen := map[string]bool{}
+	var pending []FileChunks
+	err = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && (SkipDirs[d.Name()] || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		f, ok := readFile(root, rel)
+		if !ok {
+			return nil
+		}
+		seen[rel] = true
+		if hashes[rel] == f.Hash {
+			stats.Unchanged++
+			return nil
+		}
+
+		pending = append(pending, f)
+		if len(pending) < updateBatchFiles {
+			return nil
+		}
+		if err := ix.update(ctx, workspace, pending, nil, &stats); err != nil {
+			return err
+		}
+		pending = nil
+		return ctx.Err()
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	var removed []string
+	for path := range hashes {
+		if !seen[path] {
+			removed = append(removed, path)
+		}
+	}
+	stats.Removed = len(removed)
+	if len(pending) > 0 || len(removed) > 0 {
+		if err := ix.update(ctx, workspace, pending, removed, &stats); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// IndexFile re-indexes one workspace file after it changed, or drops it when it was
+// deleted or is not indexable
+func (ix *Index) IndexFile(ctx context.Context, workspace, root, relPath string) error {
+	relPath = filepath.ToSlash(relPath)
+	f, ok := readFile(root, relPath)
+	if !ok {
+		return ix.store.Update(workspace, ix.Embedder(), nil, []string{relPath})
+	}
+
+	hashes, err := ix.store.FileHashes(workspace, ix.Embedder())
+	if err != nil {
+		return err
+	}
+	if hashes[relPath] == f.Hash {
+		return nil
+	}
+	var stats IndexStats
+	return ix.update(ctx, workspace, []FileChunks{f}, nil, &stats)
+}
+
+// readFile chunks a workspace file; ok is false when the file is missing or not indexable
+func readFile(root, relPath string) (FileChunks, bool) {
+	kind := KindOf(relPath)
+	if kind == "" {
+		return FileChunks{}, false
+	}
+	content, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(relPath)))
+	if err != nil || !IsText(content) {
+		return FileChunks{}, false
+	}
+	sum := sha256.Sum256(content)
+	return FileChunks{
+		Path:   relPath,
+		Hash:   hex.EncodeToString(sum[:]),
+		Chunks: ChunkFile(relPath, kind, string(content)),
+	}, true
+}
+
+// update embeds the chunks of files and stores them
+func (ix *Index) update(ctx context.Context, workspace string, files []FileChunks, removed []string, stats *IndexStats) error {
+	var texts []string
+	for _, f := range files {
+		for _, c := range f.Chunks {
+			texts = append(texts, embedText(c))
+		}
+	}
+	if len(texts) > 0 {
+		vectors, err := ix.embedder.Embed(ctx, texts)
+		if err != nil {
+			return fmt.Errorf("failed to embed chunks: %w", err)
+		}
+		i := 0
+		for _, f := range files {
+			for j := range f.Chunks {
+				f.Chunks[j].Vector = vectors[i]
+				i++
+			}
+		}
+	}
+
+	if err := ix.store.Update(workspace, ix.Embedder(), files, removed); err != nil {
+		return err
+	}
+	stats.Files += len(files)
+	stats.Chunks += len(texts)
+	return nil
+}
+
+// embedText is what gets embedded for a chunk: its location helps match queries that
+// name a file or section
+func embedText(c Chunk) string {
+	return c.Path + "\n" + c.Heading + "\n" + c.Text
+}
+
+// Search returns the limit chunks of the given kind ("" for any) most relevant to query
+func (ix *Index) Search(ctx context.Context, workspace, kind, query string, limit int) ([]Match, error) {
+	vectors, err := ix.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	return ix.store.Search(workspace, ix.Embedder(), kind, vectors[0], limit)
+}
+
+// Context returns the chunks most relevant to query that fit in budget tokens, formatted
+// for a prompt
+func (ix *Index) Context(ctx context.Context, workspace, kind, query string, budget int) (string, error) {
+	// Fetch more than fits so chunks too large for what is left can be skipped
+	matches, err := ix.Search(ctx, workspace, kind, query, 2*budget/ChunkTokens+5)
+	if err != nil {
+		return "", err
+	}
+	return Format(Assemble(matches, budget)), nil
+}
+
+// Assemble picks the best matches whose tokens add up to at most budget. Matches that
+// share no vocabulary with the query (score <= 0) are never picked.
+func Assemble(matches []Match, budget int) []Match {
+	var picked []Match
+	used := 0
+	for _, m := range matches {
+		if m.Score <= 0 || used+m.Tokens > budget {
+			continue
+		}
+		picked = append(picked, m)
+		used += m.Tokens
+	}
+	return picked
+}
+
+// Format renders chunks for a prompt in file and line order so related passages read
+// in sequence
+func Format(matches []Match) string {
+	sorted := append([]Match(nil), matches...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Path != sorted[j].Path {
+			return sorted[i].Path < sorted[j].Path
+		}
+		return sorted[i].StartLine < sorted[j].StartLine
+	})
+
+	parts := make([]string, len(sorted))
+	for i, m := range sorted {
+		parts[i] = fmt.Sprintf("### File: %s (lines %d-%d)\n\n%s", m.Path, m.StartLine, m.EndLine, m.Text)
+	}
+	return strings.Join(parts, "\n\n---\n\n")
+}
+
+// Truncate cuts text to about tokens, at a line break where possible
+func Truncate(text string, tokens int) string {
+	max := tokens * 4
+	if len(text) <= max {
+		return text
+	}
+	cut := text[:max]
+	if i := strings.LastIndexByte(cut, '\n'); i > max/2 {
+		cut = cut[:i]
+	}
+	return cut + "\n\n[... truncated ...]"
+}
@@ -0,0 +1,186 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package retrieval
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"specifications/CAP-001-login.md", KindSpec},
+		{"README.md", KindSpec},
+		{"code/src/App.tsx", KindCode},
+		{"code/main.go", KindCode},
+		{"code/node_modules/react/index.js", ""},
+		{".git/config", ""},
+		{"code/.env", ""},
+		{"assets/logo.png", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := KindOf(tt.path); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestChunkFileSplitsMarkdownAtHeadings(t *testing.T) {
+	content := "# Login\n\nUsers sign in.\n\n## Acceptance\n\n```bash\n# not a heading\n```\n- works\n"
+	chunks := ChunkFile("CAP-001.md", KindSpec, content)
+
+	if len(chunks) != 2 {
+		t.Fatalf("expected 2 chunks, got %d: %+v", len(chunks), chunks)
+	}
+	if chunks[0].Heading != "Login" || chunks[0].StartLine != 1 || chunks[0].EndLine != 4 {
+		t.Errorf("unexpected first chunk %+v", chunks[0])
+	}
+	if chunks[1].Heading != "Acceptance" || chunks[1].StartLine != 5 {
+		t.Errorf("unexpected second chunk %+v", chunks[1])
+	}
+	if !strings.Contains(chunks[1].Text, "# not a heading") {
+		t.Errorf("expected fenced code to stay in its section, got %q", chunks[1].Text)
+	}
+}
+
+func TestChunkFileBoundsChunkSize(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 400; i++ {
+		b.WriteString("func handler() { return something useful here }\n")
+		if i%10 == 9 {
+			b.WriteString("\n")
+		}
+	}
+	chunks := ChunkFile("code/main.go", KindCode, b.String())
+
+	if len(chunks) < 5 {
+		t.Fatalf("expected the file to be split, got %d chunks", len(chunks))
+	}
+	for i, c := range chunks {
+		if c.Tokens > ChunkTokens {
+			t.Errorf("chunk %d has %d tokens, more than %d", i, c.Tokens, ChunkTokens)
+		}
+		if i > 0 && c.StartLine != chunks[i-1].EndLine+1 {
+			t.Errorf("chunk %d starts at line %d, expected %d", i, c.StartLine, chunks[i-1].EndLine+1)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	got := tokenize("The userLogin handler calls save_session() in a loop")
+	want := []string{"user", "login", "handler", "calls", "save", "session", "loop"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestHashEmbedderRanksRelatedTextFirst(t *testing.T) {
+	e := NewHashEmbedder(256)
+	vectors, err := e.Embed(context.Background(), []string{
+		"user login with password and session tokens",
+		"invoice totals are rounded to two decimals",
+		"how does password login work",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	related := Cosine(vectors[2], vectors[0])
+	unrelated := Cosine(vectors[2], vectors[1])
+	if related <= unrelated {
+		t.Errorf("expected the login passage to score higher: %v vs %v", related, unrelated)
+	}
+	if e.Name() != "hash-256" {
+		t.Errorf("unexpected embedder name %s", e.Name())
+	}
+}
+
+func TestAssemble(t *testing.T) {
+	matches := []Match{
+		{Chunk: Chunk{Path: "a.md", Tokens: 300}, Score: 0.9},
+		{Chunk: Chunk{Path: "b.md", Tokens: 400}, Score: 0.8},
+		{Chunk: Chunk{Path: "c.md", Tokens: 150}, Score: 0.7},
+		{Chunk: Chunk{Path: "d.md", Tokens: 10}, Score: 0},
+	}
+
+	var got []string
+	for _, m := range Assemble(matches, 500) {
+		got = append(got, m.Path)
+	}
+	if want := []string{"a.md", "c.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestIndexWorkspace(t *testing.T) {
+	root := t.TempDir()
+	write := func(rel, content string) {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("specifications/CAP-001.md", "# Payments\n\nCustomers pay invoices by credit card.\n")
+	write("specifications/CAP-002.md", "# Login\n\nUsers sign in with email and password.\n")
+	write("code/auth.go", "package auth\n\nfunc CheckPassword(email, password string) bool { return false }\n")
+	write("code/node_modules/x/index.js", "module.exports = {}\n")
+
+	ctx := context.Background()
+	store := NewDiskStore(filepath.Join(t.TempDir(), "index"))
+	ix := NewIndex(NewHashEmbedder(0), store)
+
+	stats, err := ix.IndexWorkspace(ctx, "demo", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Files != 3 || stats.Unchanged != 0 {
+		t.Errorf("unexpected first run stats %+v", stats)
+	}
+
+	matches, err := ix.Search(ctx, "demo", KindSpec, "how do users sign in with a password", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0].Path != "specifications/CAP-002.md" {
+		t.Errorf("expected the login spec, got %+v", matches)
+	}
+
+	// Only changed files are embedded again and deleted files are dropped
+	write("specifications/CAP-001.md", "# Payments\n\nCustomers pay invoices by bank transfer.\n")
+	os.Remove(filepath.Join(root, "code/auth.go"))
+	stats, err = ix.IndexWorkspace(ctx, "demo", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Files != 1 || stats.Unchanged != 1 || stats.Removed != 1 {
+		t.Errorf("unexpected second run stats %+v", stats)
+	}
+
+	// The index survives a restart
+	hashes, err := NewDiskStore(store.dir).FileHashes("demo", ix.Embedder())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 2 {
+		t.Errorf("expected 2 indexed files after reload, got %v", hashes)
+	}
+}
@@ -0,0 +1,201 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package retrieval
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// FileChunks are the chunks of one version of a file
+type FileChunks struct {
+	Path   string
+	Hash   string // Content hash, so unchanged files are not embedded again
+	Chunks []Chunk
+}
+
+// Match is a chunk found by a search with its cosine similarity to the query
+type Match struct {
+	Chunk
+	Score float64 `json:"score"`
+}
+
+// Store keeps chunk vectors per workspace and embedder; DiskStore and
+// repository.ChunkRepository (pgvector) implement it
+type Store interface {
+	// FileHashes returns the content hash of every indexed file of a workspace
+	FileHashes(workspace, embedder string) (map[string]string, error)
+	// Update replaces the chunks of the given files and drops the removed paths
+	Update(workspace, embedder string, files []FileChunks, removed []string) error
+	// Search returns the limit chunks of the given kind ("" for any) most similar to
+	// vector, best first
+	Search(workspace, embedder, kind string, vector []float32, limit int) ([]Match, error)
+}
+
+// DiskStore keeps each workspace's vectors in a JSON file and searches them by brute
+// force, which is fast enough for the few thousand chunks a workspace has
+type DiskStore struct {
+	dir    string
+	mu     sync.Mutex
+	loaded map[string]*diskIndex
+}
+
+type diskIndex struct {
+	Files map[string]diskFile `json:"files"`
+}
+
+type diskFile struct {
+	Hash   string  `json:"hash"`
+	Chunks []Chunk `json:"chunks"`
+}
+
+// NewDiskStore creates a store that writes its index files under dir
+func NewDiskStore(dir string) *DiskStore {
+	return &DiskStore{dir: dir, loaded: map[string]*diskIndex{}}
+}
+
+// file returns where the index of a workspace and embedder is kept. Names are hashed so
+// any workspace or model name makes a safe file name.
+func (s *DiskStore) file(workspace, embedder string) string {
+	sum := sha256.Sum256([]byte(workspace + "\x00" + embedder))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:8])+".json")
+}
+
+// load returns the index of a workspace, reading it from disk on first use. s.mu must be held.
+func (s *DiskStore) load(workspace, embedder string) (*diskIndex, error) {
+	path := s.file(workspace, embedder)
+	if idx, ok := s.loaded[path]; ok {
+		return idx, nil
+	}
+
+	idx := &diskIndex{Files: map[string]diskFile{}}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read retrieval index: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, idx); err != nil {
+			return nil, fmt.Errorf("failed to parse retrieval index %s: %w", path, err)
+		}
+	}
+	s.loaded[path] = idx
+	return idx, nil
+}
+
+// FileHashes implements Store
+func (s *DiskStore) FileHashes(workspace, embedder string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx, err := s.load(workspace, embedder)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[string]string, len(idx.Files))
+	for path, f := range idx.Files {
+		hashes[path] = f.Hash
+	}
+	return hashes, nil
+}
+
+// Update implements Store
+func (s *DiskStore) Update(workspace, embedder string, files []FileChunks, removed []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx, err := s.load(workspace, embedder)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		idx.Files[f.Path] = diskFile{Hash: f.Hash, Chunks: f.Chunks}
+	}
+	for _, path := range removed {
+		delete(idx.Files, path)
+	}
+
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return fmt.Errorf("failed to marshal retrieval index: %w", err)
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create retrieval index directory: %w", err)
+	}
+	// Write then rename so a crash never leaves a truncated index behind
+	path := s.file(workspace, embedder)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("failed to write retrieval index: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to write retrieval index: %w", err)
+	}
+	return nil
+}
+
+// Search implements Store
+func (s *DiskStore) Search(workspace, embedder, kind string, vector []float32, limit int) ([]Match, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx, err := s.load(workspace, embedder)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []Match{}
+	for _, f := range idx.Files {
+		for _, c := range f.Chunks {
+			if len(c.Vector) != len(vector) || (kind != "" && c.Kind != kind) {
+				continue
+			}
+			match := Match{Chunk: c, Score: Cosine(vector, c.Vector)}
+			match.Vector = nil
+			matches = append(matches, match)
+		}
+	}
+	SortMatches(matches)
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// Cosine returns the cosine similarity of two vectors of equal length
+func Cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// SortMatches orders matches best first, breaking ties by position so results are stable
+func SortMatches(matches []Match) {
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		if matches[i].Path != matches[j].Path {
+			return matches[i].Path < matches[j].Path
+		}
+		return matches[i].StartLine < matches[j].StartLine
+	})
+}
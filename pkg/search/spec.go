@@ -0,0 +1,255 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package search
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+// SpecFolders are the workspace folders whose markdown files are indexed
+var SpecFolders = []string{"specifications", "conception", "definition", "design", "implementation"}
+
+// maxBodyLength caps the indexed text of a single spec file
+const maxBodyLength = 200000
+
+// specPrefixes maps file name prefixes to document types, longest prefixes first
+var specPrefixes = []struct {
+	prefix  string
+	docType string
+}{
+	{"VISION-", "vision"},
+	{"STORY-", "story"},
+	{"THEME-", "theme"},
+	{"STRAT-", "strategy"},
+	{"STATE-", "design"},
+	{"EPIC-", "epic"},
+	{"FEAT-", "feature"},
+	{"IDEA-", "ideation"},
+	{"DATA-", "design"},
+	{"CAP-", "capability"},
+	{"ENB-", "enabler"},
+	{"VIS-", "vision"},
+	{"MKT-", "market"},
+	{"SEQ-", "design"},
+	{"SB-", "storyboard"},
+	{"UI-", "design"},
+}
+
+// metadataLine matches "- **Key**: value", "**Key:** value" and similar spec metadata lines
+var metadataLine = regexp.MustCompile(`^\s*(?:[-*]\s+)?\*\*([^*]+?):?\*\*:?\s*(.*)$`)
+
+var (
+	codeFence  = regexp.MustCompile("(?s)```.*?```")
+	mdLink     = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	mdNoise    = regexp.MustCompile("[#*|`>_~]+")
+	whitespace = regexp.MustCompile(`\s+`)
+)
+
+// IsSpecFile reports whether a workspace-relative path is an indexable spec file
+func IsSpecFile(path string) bool {
+	if !strings.EqualFold(filepath.Ext(path), ".md") {
+		return false
+	}
+	// Only the top-level folders of a workspace count, so code/docs/design/README.md is skipped
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	top := ""
+	for i, part := range parts {
+		if part == "workspaces" && i+2 < len(parts) {
+			top = parts[i+2]
+			break
+		}
+	}
+	for _, folder := range SpecFolders {
+		if top == folder {
+			return true
+		}
+	}
+	return false
+}
+
+// WorkspaceFromRef returns the workspace folder name of a path below "workspaces/"
+func WorkspaceFromRef(ref string) string {
+	ref = filepath.ToSlash(ref)
+	idx := strings.Index(ref, "workspaces/")
+	if idx == -1 {
+		return ""
+	}
+	rest := ref[idx+len("workspaces/"):]
+	if slash := strings.Index(rest, "/"); slash != -1 {
+		return rest[:slash]
+	}
+	return ""
+}
+
+// ParseMetadata extracts the bold key/value metadata lines of a spec file, keyed in lower case
+func ParseMetadata(content string) map[string]string {
+	fields := map[string]string{}
+	inFence := false
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		m := metadataLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(m[1]))
+		value := strings.TrimSpace(m[2])
+		if key == "" || value == "" {
+			continue
+		}
+		if _, exists := fields[key]; !exists {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// DocTypeFor infers the document type from the metadata Type field or the file name prefix
+func DocTypeFor(fileName string, fields map[string]string) string {
+	if t := strings.ToLower(fields["type"]); t != "" {
+		switch {
+		case strings.Contains(t, "capability"):
+			return "capability"
+		case strings.Contains(t, "enabler"):
+			return "enabler"
+		case strings.Contains(t, "story"):
+			return "story"
+		case strings.Contains(t, "epic"):
+			return "epic"
+		case strings.Contains(t, "theme"):
+			return "theme"
+		case strings.Contains(t, "feature"):
+			return "feature"
+		}
+	}
+
+	upper := strings.ToUpper(filepath.Base(fileName))
+	for _, p := range specPrefixes {
+		if strings.HasPrefix(upper, p.prefix) {
+			return p.docType
+		}
+	}
+	return "document"
+}
+
+// PlainText reduces markdown to searchable text: code blocks, link targets and markup are dropped
+func PlainText(content string) string {
+	text := codeFence.ReplaceAllString(content, " ")
+	text = mdLink.ReplaceAllString(text, "$1")
+	text = mdNoise.ReplaceAllString(text, " ")
+	text = strings.TrimSpace(whitespace.ReplaceAllString(text, " "))
+	if len(text) > maxBodyLength {
+		text = text[:maxBodyLength]
+	}
+	return text
+}
+
+// ParseSpecDocument builds the search document for a spec file. ref is the path
+// relative to the service working directory, e.g. workspaces/demo/specifications/CAP-1.md.
+func ParseSpecDocument(ref string, content []byte) models.SearchDocument {
+	ref = filepath.ToSlash(ref)
+	text := string(content)
+	fields := ParseMetadata(text)
+
+	title := fields["name"]
+	if title == "" {
+		for _, line := range strings.Split(text, "\n") {
+			if strings.HasPrefix(line, "# ") {
+				title = strings.TrimSpace(strings.TrimPrefix(line, "# "))
+				break
+			}
+		}
+	}
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(ref), filepath.Ext(ref))
+	}
+
+	stage := fields["stage"]
+	if stage == "" {
+		stage = fields["workflow stage"]
+	}
+
+	doc := models.SearchDocument{
+		Source:     models.SearchSourceSpec,
+		DocType:    DocTypeFor(ref, fields),
+		Ref:        ref,
+		Workspace:  WorkspaceFromRef(ref),
+		ExternalID: fields["id"],
+		Title:      title,
+		Body:       PlainText(text),
+		Status:     strings.ToLower(fields["status"]),
+		Stage:      strings.ToLower(stage),
+		Priority:   strings.ToLower(fields["priority"]),
+		Owner:      fields["owner"],
+	}
+	if len(fields) > 0 {
+		if metadata, err := json.Marshal(fields); err == nil {
+			doc.Metadata = metadata
+		}
+	}
+	return doc
+}
+
+// ParseSpecFile reads and parses one spec file
+func ParseSpecFile(root, ref string) (models.SearchDocument, error) {
+	content, err := os.ReadFile(filepath.Join(root, ref))
+	if err != nil {
+		return models.SearchDocument{}, err
+	}
+	return ParseSpecDocument(ref, content), nil
+}
+
+// WalkWorkspace parses every spec file of a workspace. workspaceRef is relative to root,
+// e.g. workspaces/demo; returned refs are relative to root as well.
+func WalkWorkspace(root, workspaceRef string) ([]models.SearchDocument, error) {
+	docs := []models.SearchDocument{}
+	for _, folder := range SpecFolders {
+		dir := filepath.Join(root, workspaceRef, folder)
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			continue
+		}
+
+		err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if name := d.Name(); path != dir && (strings.HasPrefix(name, ".") || name == "node_modules") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil || !IsSpecFile(rel) {
+				return nil
+			}
+			doc, err := ParseSpecFile(root, rel)
+			if err != nil {
+				return nil
+			}
+			docs = append(docs, doc)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
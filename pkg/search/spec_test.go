@@ -0,0 +1,129 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const capabilitySpec = "# Technical Specifications (Template)\n\n" +
+	"## Metadata\n" +
+	"- **Name**: Combat System\n" +
+	"- **Type**: Capability\n" +
+	"- **ID**: CAP-582341\n" +
+	"- **Owner**: Product Team\n" +
+	"- **Status**: In Progress\n" +
+	"- **Priority**: High\n\n" +
+	"## Purpose\n" +
+	"Handles **fighting** mechanics between [stick figures](./STORY-1.md).\n\n" +
+	"```mermaid\nflowchart TD\n  A[\"**Name**: not metadata\"]\n```\n"
+
+func TestParseSpecDocument(t *testing.T) {
+	doc := ParseSpecDocument("workspaces/stickfigures/specifications/CAP-582341.md", []byte(capabilitySpec))
+
+	tests := []struct {
+		field    string
+		got      string
+		expected string
+	}{
+		{"source", doc.Source, "spec"},
+		{"doc_type", doc.DocType, "capability"},
+		{"workspace", doc.Workspace, "stickfigures"},
+		{"title", doc.Title, "Combat System"},
+		{"external_id", doc.ExternalID, "CAP-582341"},
+		{"status", doc.Status, "in progress"},
+		{"priority", doc.Priority, "high"},
+		{"owner", doc.Owner, "Product Team"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.expected {
+			t.Errorf("expected %s %q, got %q", tt.field, tt.expected, tt.got)
+		}
+	}
+
+	if strings.Contains(doc.Body, "**") || strings.Contains(doc.Body, "flowchart") || strings.Contains(doc.Body, "./STORY-1.md") {
+		t.Errorf("expected markup, code blocks and link targets stripped, got %q", doc.Body)
+	}
+	if !strings.Contains(doc.Body, "fighting mechanics between stick figures") {
+		t.Errorf("expected prose preserved, got %q", doc.Body)
+	}
+}
+
+func TestParseSpecDocumentFallbacks(t *testing.T) {
+	content := "# Login Story\n\n**Status:** pending\n\n**Description:** Player signs in\n"
+	doc := ParseSpecDocument("workspaces/demo/conception/STORY-LOGIN-1.md", []byte(content))
+
+	if doc.DocType != "story" {
+		t.Errorf("expected type from file prefix, got %q", doc.DocType)
+	}
+	if doc.Title != "Login Story" {
+		t.Errorf("expected title from heading, got %q", doc.Title)
+	}
+	if doc.Status != "pending" {
+		t.Errorf("expected status from bold-colon line, got %q", doc.Status)
+	}
+
+	untitled := ParseSpecDocument("workspaces/demo/definition/notes.md", []byte("plain text"))
+	if untitled.Title != "notes" || untitled.DocType != "document" {
+		t.Errorf("expected file name title and generic type, got %q / %q", untitled.Title, untitled.DocType)
+	}
+}
+
+func TestIsSpecFile(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"workspaces/demo/specifications/CAP-1.md", true},
+		{"workspaces/demo/conception/nested/STORY-1.md", true},
+		{"workspaces/demo/code/design/README.md", false},
+		{"workspaces/demo/specifications/diagram.png", false},
+		{"workspaces/demo/README.md", false},
+	}
+	for _, tt := range tests {
+		if got := IsSpecFile(tt.path); got != tt.expected {
+			t.Errorf("IsSpecFile(%q) = %v, expected %v", tt.path, got, tt.expected)
+		}
+	}
+}
+
+func TestWalkWorkspace(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"workspaces/demo/specifications/CAP-1.md":  capabilitySpec,
+		"workspaces/demo/conception/EPIC-1.md":     "# Onboarding\n",
+		"workspaces/demo/code/README.md":           "# Not a spec\n",
+		"workspaces/demo/specifications/image.png": "png",
+	}
+	for rel, content := range files {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	docs, err := WalkWorkspace(root, "workspaces/demo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(docs) != 2 {
+		t.Fatalf("expected 2 spec documents, got %d", len(docs))
+	}
+	for _, doc := range docs {
+		if doc.Workspace != "demo" || !strings.HasPrefix(doc.Ref, "workspaces/demo/") {
+			t.Errorf("unexpected document ref %q workspace %q", doc.Ref, doc.Workspace)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package templates
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MaxZipSize caps the size of a template archive
+const MaxZipSize = 50 << 20
+
+var (
+	ErrTemplateNotFound = errors.New("template not found")
+	ErrTemplateExists   = errors.New("template version already exists in the catalog")
+	ErrInvalidTemplate  = errors.New("invalid template")
+)
+
+// Catalog is a directory of templates. Each entry is either a folder or a .zip archive
+// holding a template.json, at its root or inside a single top-level folder.
+type Catalog struct {
+	dir string
+	mu  sync.Mutex // Serialises imports
+}
+
+// NewCatalog creates a catalog reading from dir
+func NewCatalog(dir string) *Catalog {
+	return &Catalog{dir: dir}
+}
+
+// Dir returns the catalog directory
+func (c *Catalog) Dir() string {
+	return c.dir
+}
+
+// OpenZip reads a template from a zip archive held in memory
+func OpenZip(data []byte, source string) (*Template, error) {
+	if len(data) > MaxZipSize {
+		return nil, fmt.Errorf("template archive exceeds %d MB", MaxZipSize>>20)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip archive: %w", err)
+	}
+	for _, f := range zr.File {
+		if !fs.ValidPath(strings.TrimSuffix(f.Name, "/")) {
+			return nil, fmt.Errorf("invalid path in archive: %s", f.Name)
+		}
+	}
+
+	fsys, err := templateRoot(zr)
+	if err != nil {
+		return nil, err
+	}
+	return Open(fsys, source)
+}
+
+// templateRoot finds the folder holding template.json: the archive root, or its only
+// top-level folder (as produced by zipping a template folder)
+func templateRoot(fsys fs.FS) (fs.FS, error) {
+	if _, err := fs.Stat(fsys, ManifestFile); err == nil {
+		return fsys, nil
+	}
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		sub, err := fs.Sub(fsys, entries[0].Name())
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fs.Stat(sub, ManifestFile); err == nil {
+			return sub, nil
+		}
+	}
+	return nil, fmt.Errorf("archive has no %s", ManifestFile)
+}
+
+// List returns every template version in the catalog, ordered by ID and newest version
+// first. Entries that cannot be read are logged and left out.
+func (c *Catalog) List() ([]*Template, error) {
+	entries, err := os.ReadDir(c.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []*Template{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template catalog: %w", err)
+	}
+
+	seen := map[Ref]string{}
+	list := []*Template{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		var t *Template
+		switch {
+		case entry.IsDir():
+			t, err = Open(os.DirFS(filepath.Join(c.dir, name)), name)
+		case strings.EqualFold(filepath.Ext(name), ".zip"):
+			var data []byte
+			if data, err = os.ReadFile(filepath.Join(c.dir, name)); err == nil {
+				t, err = OpenZip(data, name)
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			log.Printf("Skipping template %s: %v", name, err)
+			continue
+		}
+		if other, ok := seen[t.Ref()]; ok {
+			log.Printf("Skipping template %s: %s %s is already provided by %s", name, t.ID, t.Version, other)
+			continue
+		}
+		seen[t.Ref()] = name
+		list = append(list, t)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].ID != list[j].ID {
+			return list[i].ID < list[j].ID
+		}
+		return compareVersions(list[i].Version, list[j].Version) > 0
+	})
+	return list, nil
+}
+
+// Get returns a template version, or its newest version when version is empty
+func (c *Catalog) Get(id, version string) (*Template, error) {
+	list, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range list {
+		if t.ID == id && (version == "" || t.Version == version) {
+			return t, nil
+		}
+	}
+	return nil, ErrTemplateNotFound
+}
+
+// Import validates a template archive and adds it to the catalog as <id>-<version>.zip
+func (c *Catalog) Import(data []byte) (*Template, error) {
+	t, err := OpenZip(data, "")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.Get(t.ID, t.Version); err == nil {
+		return nil, ErrTemplateExists
+	} else if !errors.Is(err, ErrTemplateNotFound) {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create template catalog: %w", err)
+	}
+	t.Source = fmt.Sprintf("%s-%s.zip", t.ID, t.Version)
+	if err := os.WriteFile(filepath.Join(c.dir, t.Source), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to save template: %w", err)
+	}
+	return t, nil
+}
@@ -0,0 +1,354 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// ManifestFile describes a template and sits at its root
+	ManifestFile = "template.json"
+	// FilesDir holds the files copied into new workspaces
+	FilesDir = "files"
+	// TemplateSuffix marks files rendered with the template parameters; the suffix is dropped
+	TemplateSuffix = ".tmpl"
+)
+
+var (
+	validID        = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+	validVersion   = regexp.MustCompile(`^\d+(\.\d+){0,2}([-+][0-9A-Za-z.-]+)?$`)
+	validParamName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Parameter is a value asked for when a workspace is created from the template
+type Parameter struct {
+	Name        string   `json:"name"`
+	Label       string   `json:"label,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Default     string   `json:"default,omitempty"`
+	Options     []string `json:"options,omitempty"` // Allowed values, when the choice is closed
+	Required    bool     `json:"required,omitempty"`
+}
+
+// Condition includes a file or folder under files/ only when a parameter has one of the
+// given values, e.g. code/go only for the go stacks
+type Condition struct {
+	Path   string   `json:"path"`
+	Param  string   `json:"param"`
+	Equals []string `json:"equals"`
+}
+
+// WorkspaceDefaults are the .ubeworkspace settings a new workspace starts with
+type WorkspaceDefaults struct {
+	WorkspaceType  string                 `json:"workspaceType,omitempty"`
+	Description    string                 `json:"description,omitempty"`
+	AIPreset       int                    `json:"aiPreset,omitempty"` // AI policy preset 1-5
+	UIFramework    string                 `json:"uiFramework,omitempty"`
+	UILayout       string                 `json:"uiLayout,omitempty"`
+	CustomSettings map[string]interface{} `json:"customSettings,omitempty"`
+}
+
+// Manifest is the template.json of a template
+type Manifest struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Version     string            `json:"version"`
+	Description string            `json:"description,omitempty"`
+	Folders     []string          `json:"folders,omitempty"` // Created in addition to the standard layout
+	Parameters  []Parameter       `json:"parameters,omitempty"`
+	Conditions  []Condition       `json:"conditions,omitempty"`
+	Workspace   WorkspaceDefaults `json:"workspace"`
+}
+
+// Ref records the template a workspace was created from
+type Ref struct {
+	ID      string `json:"id"`
+	Version string `json:"version"`
+}
+
+// Template is a manifest together with the files it scaffolds
+type Template struct {
+	Manifest
+	Source string `json:"source"` // Catalog entry the template was read from
+	fsys   fs.FS
+}
+
+// Ref returns the template's ID and version
+func (t *Template) Ref() Ref {
+	return Ref{ID: t.ID, Version: t.Version}
+}
+
+// Result lists what scaffolding wrote, relative to the workspace folder
+type Result struct {
+	Created []string `json:"created"`
+	Skipped []string `json:"skipped"` // Files that already existed and were left alone
+}
+
+// validRelPath reports whether p is a relative slash-separated path inside its root
+func validRelPath(p string) bool {
+	return p != "" && fs.ValidPath(p) && p != "."
+}
+
+// Validate checks a manifest for the mistakes that would break scaffolding
+func (m *Manifest) Validate() error {
+	if !validID.MatchString(m.ID) {
+		return fmt.Errorf("invalid template id %q", m.ID)
+	}
+	if m.Name == "" {
+		return errors.New("template name is required")
+	}
+	if !validVersion.MatchString(m.Version) {
+		return fmt.Errorf("invalid template version %q", m.Version)
+	}
+	for _, folder := range m.Folders {
+		if !validRelPath(folder) {
+			return fmt.Errorf("invalid folder %q", folder)
+		}
+	}
+
+	params := map[string]bool{}
+	for _, p := range m.Parameters {
+		if !validParamName.MatchString(p.Name) {
+			return fmt.Errorf("invalid parameter name %q", p.Name)
+		}
+		if params[p.Name] {
+			return fmt.Errorf("duplicate parameter %q", p.Name)
+		}
+		params[p.Name] = true
+		if p.Default != "" && len(p.Options) > 0 && !contains(p.Options, p.Default) {
+			return fmt.Errorf("default of parameter %q is not one of its options", p.Name)
+		}
+	}
+	for _, c := range m.Conditions {
+		if !validRelPath(c.Path) {
+			return fmt.Errorf("invalid condition path %q", c.Path)
+		}
+		if !params[c.Param] && !isBuiltin(c.Param) {
+			return fmt.Errorf("condition on unknown parameter %q", c.Param)
+		}
+	}
+	if m.Workspace.AIPreset < 0 || m.Workspace.AIPreset > 5 {
+		return fmt.Errorf("aiPreset must be between 1 and 5")
+	}
+	return nil
+}
+
+// Built-in parameters every template can use; projectName may be overridden
+var builtins = []string{"projectName", "workspaceName", "folderName", "date"}
+
+func isBuiltin(name string) bool {
+	return contains(builtins, name)
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Open reads a template rooted at fsys
+func Open(fsys fs.FS, source string) (*Template, error) {
+	data, err := fs.ReadFile(fsys, ManifestFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", ManifestFile, err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ManifestFile, err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return &Template{Manifest: m, Source: source, fsys: fsys}, nil
+}
+
+// Params resolves the values a workspace is scaffolded with. Declared parameters take the
+// given value, else their default; projectName defaults to the workspace name. Unknown
+// names, missing required values and values outside a parameter's options are errors.
+func (t *Template) Params(values map[string]string, workspaceName, folderName string) (map[string]string, error) {
+	params := map[string]string{
+		"projectName":   workspaceName,
+		"workspaceName": workspaceName,
+		"folderName":    folderName,
+		"date":          time.Now().Format("01/02/2006"),
+	}
+
+	declared := map[string]bool{}
+	for _, p := range t.Parameters {
+		declared[p.Name] = true
+		value := strings.TrimSpace(values[p.Name])
+		if value == "" {
+			value = p.Default
+		}
+		if value == "" {
+			value = params[p.Name]
+		}
+		if value == "" && p.Required {
+			return nil, fmt.Errorf("parameter %s is required", p.Name)
+		}
+		if value != "" && len(p.Options) > 0 && !contains(p.Options, value) {
+			return nil, fmt.Errorf("parameter %s must be one of %s", p.Name, strings.Join(p.Options, ", "))
+		}
+		params[p.Name] = value
+	}
+
+	for name, value := range values {
+		if declared[name] {
+			continue
+		}
+		if name != "projectName" {
+			return nil, fmt.Errorf("unknown parameter %s", name)
+		}
+		if value = strings.TrimSpace(value); value != "" {
+			params[name] = value
+		}
+	}
+	return params, nil
+}
+
+// included reports whether a file under files/ passes the template's conditions
+func (t *Template) included(rel string, params map[string]string) bool {
+	for _, c := range t.Conditions {
+		if (rel == c.Path || strings.HasPrefix(rel, c.Path+"/")) && !contains(c.Equals, params[c.Param]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Scaffold writes the template's folders and files into dest. Files ending in .tmpl are
+// rendered with params (e.g. {{.projectName}}); existing files are never overwritten.
+func (t *Template) Scaffold(dest string, params map[string]string) (*Result, error) {
+	result := &Result{Created: []string{}, Skipped: []string{}}
+
+	for _, folder := range t.Folders {
+		if err := os.MkdirAll(filepath.Join(dest, filepath.FromSlash(folder)), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create folder %s: %w", folder, err)
+		}
+	}
+
+	if _, err := fs.Stat(t.fsys, FilesDir); errors.Is(err, fs.ErrNotExist) {
+		return result, nil
+	}
+
+	err := fs.WalkDir(t.fsys, FilesDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == FilesDir {
+			return nil
+		}
+		rel := strings.TrimPrefix(p, FilesDir+"/")
+		if !validRelPath(rel) {
+			return fmt.Errorf("invalid file path %q", p)
+		}
+		if !t.included(rel, params) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(dest, filepath.FromSlash(rel)), 0755)
+		}
+
+		content, err := fs.ReadFile(t.fsys, p)
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(rel, TemplateSuffix) {
+			rel = strings.TrimSuffix(rel, TemplateSuffix)
+			if content, err = render(p, content, params); err != nil {
+				return err
+			}
+		}
+
+		target := filepath.Join(dest, filepath.FromSlash(rel))
+		if _, err := os.Stat(target); err == nil {
+			result.Skipped = append(result.Skipped, rel)
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, content, 0644); err != nil {
+			return err
+		}
+		result.Created = append(result.Created, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scaffold template %s: %w", t.ID, err)
+	}
+	return result, nil
+}
+
+func render(name string, content []byte, params map[string]string) ([]byte, error) {
+	tmpl, err := template.New(path.Base(name)).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("invalid template file %s: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, params); err != nil {
+		return nil, fmt.Errorf("failed to render %s: %w", name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// compareVersions orders dotted numeric versions, falling back to string order for
+// pre-release suffixes
+func compareVersions(a, b string) int {
+	coreA, preA, _ := strings.Cut(strings.SplitN(a, "+", 2)[0], "-")
+	coreB, preB, _ := strings.Cut(strings.SplitN(b, "+", 2)[0], "-")
+
+	partsA, partsB := strings.Split(coreA, "."), strings.Split(coreB, ".")
+	for i := 0; i < 3; i++ {
+		var x, y int
+		if i < len(partsA) {
+			x, _ = strconv.Atoi(partsA[i])
+		}
+		if i < len(partsB) {
+			y, _ = strconv.Atoi(partsB[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	// A release sorts after its pre-releases
+	switch {
+	case preA == preB:
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	}
+	return strings.Compare(preA, preB)
+}
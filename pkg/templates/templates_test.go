@@ -0,0 +1,277 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package templates
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"testing/fstest"
+)
+
+const testManifest = `{
+  "id": "starter",
+  "name": "Starter",
+  "version": "1.2.0",
+  "folders": ["docs/adr"],
+  "parameters": [
+    {"name": "stack", "default": "go", "options": ["go", "node"]},
+    {"name": "owner", "required": true}
+  ],
+  "conditions": [{"path": "code/go", "param": "stack", "equals": ["go"]}],
+  "workspace": {"workspaceType": "new", "aiPreset": 2}
+}`
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		ManifestFile:                        {Data: []byte(testManifest)},
+		"files/conception/VIS-1.md.tmpl":    {Data: []byte("# {{.projectName}} by {{.owner}}\n")},
+		"files/code/go/main.go":             {Data: []byte("package main\n")},
+		"files/code/README.md":              {Data: []byte("{{.left.alone}}\n")},
+		"files/definition/EPIC-1.md.tmpl":   {Data: []byte("stack: {{.stack}}\n")},
+		"files/implementation/existing.txt": {Data: []byte("from template\n")},
+	}
+}
+
+func TestParams(t *testing.T) {
+	tmpl, err := Open(testFS(), "starter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		values  map[string]string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"defaults", map[string]string{"owner": "ada"}, map[string]string{"projectName": "Acme", "stack": "go", "owner": "ada"}, false},
+		{"override project name", map[string]string{"owner": "ada", "projectName": "Billing"}, map[string]string{"projectName": "Billing"}, false},
+		{"chosen option", map[string]string{"owner": "ada", "stack": "node"}, map[string]string{"stack": "node"}, false},
+		{"missing required", map[string]string{}, nil, true},
+		{"value outside options", map[string]string{"owner": "ada", "stack": "rust"}, nil, true},
+		{"unknown parameter", map[string]string{"owner": "ada", "colour": "red"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := tmpl.Params(tt.values, "Acme", "acme")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Params() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for k, v := range tt.want {
+				if params[k] != v {
+					t.Errorf("params[%s] = %q, want %q", k, params[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestScaffold(t *testing.T) {
+	tmpl, err := Open(testFS(), "starter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dest, "implementation"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dest, "implementation", "existing.txt"), []byte("mine\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	params, err := tmpl.Params(map[string]string{"owner": "ada", "stack": "node"}, "Acme", "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := tmpl.Scaffold(dest, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created := append([]string(nil), result.Created...)
+	sort.Strings(created)
+	wantCreated := []string{"code/README.md", "conception/VIS-1.md", "definition/EPIC-1.md"}
+	if !reflect.DeepEqual(created, wantCreated) {
+		t.Errorf("created = %v, want %v", created, wantCreated)
+	}
+	if !reflect.DeepEqual(result.Skipped, []string{"implementation/existing.txt"}) {
+		t.Errorf("skipped = %v", result.Skipped)
+	}
+
+	read := func(rel string) string {
+		data, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(rel)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	if got := read("conception/VIS-1.md"); got != "# Acme by ada\n" {
+		t.Errorf("rendered vision = %q", got)
+	}
+	if got := read("code/README.md"); got != "{{.left.alone}}\n" {
+		t.Errorf("plain files should be copied as is, got %q", got)
+	}
+	if got := read("implementation/existing.txt"); got != "mine\n" {
+		t.Errorf("existing file was overwritten: %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "code", "go")); !os.IsNotExist(err) {
+		t.Errorf("code/go should be left out for the node stack")
+	}
+	if _, err := os.Stat(filepath.Join(dest, "docs", "adr")); err != nil {
+		t.Errorf("manifest folder not created: %v", err)
+	}
+}
+
+func TestManifestValidate(t *testing.T) {
+	valid := func() Manifest {
+		return Manifest{ID: "starter", Name: "Starter", Version: "1.0.0"}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(m *Manifest)
+	}{
+		{"bad id", func(m *Manifest) { m.ID = "../starter" }},
+		{"missing name", func(m *Manifest) { m.Name = "" }},
+		{"bad version", func(m *Manifest) { m.Version = "latest" }},
+		{"folder outside workspace", func(m *Manifest) { m.Folders = []string{"../etc"} }},
+		{"duplicate parameter", func(m *Manifest) { m.Parameters = []Parameter{{Name: "stack"}, {Name: "stack"}} }},
+		{"default outside options", func(m *Manifest) {
+			m.Parameters = []Parameter{{Name: "stack", Default: "rust", Options: []string{"go"}}}
+		}},
+		{"condition on unknown parameter", func(m *Manifest) { m.Conditions = []Condition{{Path: "code", Param: "stack"}} }},
+		{"ai preset out of range", func(m *Manifest) { m.Workspace.AIPreset = 6 }},
+	}
+
+	m := valid()
+	if err := m.Validate(); err != nil {
+		t.Fatalf("valid manifest rejected: %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := valid()
+			tt.modify(&m)
+			if err := m.Validate(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func zipTemplate(t *testing.T, prefix string, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := zw.Create(prefix + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestOpenZip(t *testing.T) {
+	manifest := `{"id":"starter","name":"Starter","version":"1.0.0"}`
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{"manifest at root", zipTemplate(t, "", map[string]string{ManifestFile: manifest}), false},
+		{"single top-level folder", zipTemplate(t, "starter/", map[string]string{ManifestFile: manifest}), false},
+		{"no manifest", zipTemplate(t, "", map[string]string{"files/README.md": "hi"}), true},
+		{"path traversal", zipTemplate(t, "", map[string]string{ManifestFile: manifest, "../evil": "x"}), true},
+		{"not a zip", []byte("hello"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := OpenZip(tt.data, "test.zip")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("OpenZip() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	dir := t.TempDir()
+	catalog := NewCatalog(dir)
+
+	folder := filepath.Join(dir, "starter")
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		t.Fatal(err)
+	}
+	manifest := `{"id":"starter","name":"Starter","version":"1.9.0"}`
+	if err := os.WriteFile(filepath.Join(folder, ManifestFile), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	newer := zipTemplate(t, "", map[string]string{ManifestFile: `{"id":"starter","name":"Starter","version":"1.10.0"}`})
+	imported, err := catalog.Import(newer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported.Source != "starter-1.10.0.zip" {
+		t.Errorf("imported source = %q", imported.Source)
+	}
+	if _, err := catalog.Import(newer); !errors.Is(err, ErrTemplateExists) {
+		t.Errorf("expected ErrTemplateExists, got %v", err)
+	}
+	if _, err := catalog.Import([]byte("not a zip")); !errors.Is(err, ErrInvalidTemplate) {
+		t.Errorf("expected ErrInvalidTemplate, got %v", err)
+	}
+
+	latest, err := catalog.Get("starter", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Version != "1.10.0" {
+		t.Errorf("latest version = %s, want 1.10.0", latest.Version)
+	}
+	if _, err := catalog.Get("starter", "1.9.0"); err != nil {
+		t.Errorf("pinned version not found: %v", err)
+	}
+	if _, err := catalog.Get("missing", ""); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("expected ErrTemplateNotFound, got %v", err)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"1.10.0", "1.9.0", 1},
+		{"1.0", "1.0.1", -1},
+		{"2", "1.9.9", 1},
+		{"1.0.0-beta", "1.0.0", -1},
+		{"1.0.0-alpha", "1.0.0-beta", -1},
+		{"1.0.0+build.5", "1.0.0", 0},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+// GateInput is the capability state the gate checks are evaluated against
+type GateInput struct {
+	Capability *models.CapabilityWithDetails
+	Enablers   []models.Enabler
+	// Criteria holds acceptance criteria for the capability and all of its enablers
+	Criteria []models.AcceptanceCriteria
+	// Summaries holds AcceptanceCriteriaRepository.GetSummary results for the same entities
+	Summaries []models.AcceptanceCriteriaSummary
+}
+
+// gateParams are the optional parameters a rule may carry in its params column
+type gateParams struct {
+	MinCount int `json:"min_count"`
+}
+
+// EvaluateReadiness runs every active rule for the stage and phase and reports unmet conditions
+func EvaluateReadiness(rules []models.StageGateRule, stage, phase string, in GateInput) models.ReadinessReport {
+	report := models.ReadinessReport{
+		Stage:  stage,
+		Phase:  phase,
+		Ready:  true,
+		Checks: []models.GateCheckResult{},
+		Unmet:  []models.GateCheckResult{},
+	}
+	if in.Capability != nil {
+		report.CapabilityID = in.Capability.ID
+	}
+
+	for _, rule := range rules {
+		if !rule.IsActive || rule.Stage != stage || !rule.AppliesToPhase(phase) {
+			continue
+		}
+
+		var params gateParams
+		if len(rule.Params) > 0 {
+			json.Unmarshal(rule.Params, &params)
+		}
+
+		passed, message := runCheck(rule.CheckType, stage, phase, params, in)
+		result := models.GateCheckResult{
+			RuleID:      rule.ID,
+			CheckType:   rule.CheckType,
+			Description: rule.Description,
+			Passed:      passed,
+			Message:     message,
+		}
+
+		report.Checks = append(report.Checks, result)
+		if !passed {
+			report.Ready = false
+			report.Unmet = append(report.Unmet, result)
+		}
+	}
+
+	return report
+}
+
+func runCheck(checkType, stage, phase string, params gateParams, in GateInput) (bool, string) {
+	switch checkType {
+	case models.GateCheckValidTransition:
+		return checkTransition(stage, phase, in)
+	case models.GateCheckMinEnablers:
+		return checkMinEnablers(params, in)
+	case models.GateCheckMustCriteriaWritten:
+		return checkMustCriteriaWritten(params, in)
+	case models.GateCheckUIAssetsLinked:
+		return checkUIAssets(params, in)
+	case models.GateCheckMustCriteriaPassed:
+		return checkMustCriteriaPassed(in)
+	default:
+		return false, fmt.Sprintf("Unknown gate check type %q", checkType)
+	}
+}
+
+// checkTransition uses models.CanTransition: a capability may stay in its current stage
+// (e.g. re-request after a rejection) or move to the next stage once the current one is approved.
+func checkTransition(stage, phase string, in GateInput) (bool, string) {
+	if in.Capability == nil {
+		return false, "Capability not found"
+	}
+
+	current := models.StageSpecification
+	if in.Capability.WorkflowStage != nil && *in.Capability.WorkflowStage != "" {
+		current = models.WorkflowStage(*in.Capability.WorkflowStage)
+	}
+	target := models.WorkflowStage(stage)
+
+	if current == target {
+		return true, fmt.Sprintf("Capability is in the %s stage", current)
+	}
+	if !models.CanTransition(current, target) {
+		return false, fmt.Sprintf("Cannot move from %s to %s", current, target)
+	}
+
+	approval := ""
+	if in.Capability.ApprovalStatus != nil {
+		approval = *in.Capability.ApprovalStatus
+	}
+	if phase == models.GatePhaseRequest && approval != string(models.ApprovalStatusApproved) {
+		return false, fmt.Sprintf("The %s stage must be approved before requesting %s (currently %s)", current, target, approvalLabel(approval))
+	}
+	return true, fmt.Sprintf("The %s stage is approved", current)
+}
+
+func approvalLabel(status string) string {
+	if status == "" {
+		return "draft"
+	}
+	return strings.ReplaceAll(status, "_", " ")
+}
+
+func checkMinEnablers(params gateParams, in GateInput) (bool, string) {
+	min := params.MinCount
+	if min <= 0 {
+		min = 1
+	}
+	if len(in.Enablers) < min {
+		return false, fmt.Sprintf("%d enabler(s) defined, at least %d required", len(in.Enablers), min)
+	}
+	return true, fmt.Sprintf("%d enabler(s) defined", len(in.Enablers))
+}
+
+// checkMustCriteriaWritten requires min_count must-priority criteria and that each one is complete for its format
+func checkMustCriteriaWritten(params gateParams, in GateInput) (bool, string) {
+	var must, incomplete []string
+	for _, c := range in.Criteria {
+		if c.Priority != models.CriteriaPriorityMust {
+			continue
+		}
+		must = append(must, c.CriteriaID)
+		if !criteriaWritten(c) {
+			incomplete = append(incomplete, c.CriteriaID)
+		}
+	}
+
+	if len(must) < params.MinCount {
+		return false, fmt.Sprintf("%d must-priority criteria written, at least %d required", len(must), params.MinCount)
+	}
+	if len(incomplete) > 0 {
+		return false, fmt.Sprintf("Must-priority criteria are incomplete: %s", strings.Join(incomplete, ", "))
+	}
+	return true, fmt.Sprintf("%d must-priority criteria written", len(must))
+}
+
+// criteriaWritten reports whether a criterion has the content its format requires
+func criteriaWritten(c models.AcceptanceCriteria) bool {
+	switch c.CriteriaFormat {
+	case models.CriteriaFormatGivenWhenThen:
+		return nonEmpty(c.GivenClause) && nonEmpty(c.WhenClause) && nonEmpty(c.ThenClause)
+	case models.CriteriaFormatMetric:
+		return nonEmpty(c.MetricName) && nonEmpty(c.MetricTarget)
+	default:
+		return strings.TrimSpace(c.Title) != "" && strings.TrimSpace(c.Description) != ""
+	}
+}
+
+func nonEmpty(s *string) bool {
+	return s != nil && strings.TrimSpace(*s) != ""
+}
+
+// uiAssetExtensions are file types treated as UI design assets
+var uiAssetExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".svg": true,
+	".webp": true, ".fig": true, ".sketch": true, ".xd": true, ".pdf": true,
+}
+
+// isUIAsset recognises images, design files and links to design tools
+func isUIAsset(a models.CapabilityAsset) bool {
+	if a.MimeType != nil && strings.HasPrefix(*a.MimeType, "image/") {
+		return true
+	}
+	url := strings.ToLower(a.AssetURL)
+	for _, host := range []string{"figma.com", "sketch.com", "miro.com", "xd.adobe.com"} {
+		if strings.Contains(url, host) {
+			return true
+		}
+	}
+	ext := strings.ToLower(path.Ext(a.AssetName))
+	if ext == "" {
+		ext = strings.ToLower(path.Ext(strings.SplitN(url, "?", 2)[0]))
+	}
+	return uiAssetExtensions[ext]
+}
+
+func checkUIAssets(params gateParams, in GateInput) (bool, string) {
+	if in.Capability == nil {
+		return false, "Capability not found"
+	}
+	min := params.MinCount
+	if min <= 0 {
+		min = 1
+	}
+
+	count := 0
+	for _, a := range in.Capability.Assets {
+		if isUIAsset(a) {
+			count++
+		}
+	}
+	if count < min {
+		return false, fmt.Sprintf("%d UI asset(s) linked, at least %d required", count, min)
+	}
+	return true, fmt.Sprintf("%d UI asset(s) linked", count)
+}
+
+// checkMustCriteriaPassed sums the must-priority counts from the criteria summaries
+func checkMustCriteriaPassed(in GateInput) (bool, string) {
+	total, passed := 0, 0
+	for _, s := range in.Summaries {
+		total += s.MustCount
+		passed += s.MustPassedCount
+	}
+
+	if total == 0 {
+		return false, "No must-priority acceptance criteria defined"
+	}
+	if passed < total {
+		return false, fmt.Sprintf("%d of %d must-priority criteria passed", passed, total)
+	}
+	return true, fmt.Sprintf("All %d must-priority criteria passed", total)
+}
@@ -0,0 +1,153 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package workflow
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+func strPtr(s string) *string { return &s }
+
+func capabilityIn(stage, approval string, assets ...models.CapabilityAsset) *models.CapabilityWithDetails {
+	c := &models.CapabilityWithDetails{Assets: assets}
+	c.ID = 7
+	c.WorkflowStage = strPtr(stage)
+	c.ApprovalStatus = strPtr(approval)
+	return c
+}
+
+func TestEvaluateReadiness(t *testing.T) {
+	rules := []models.StageGateRule{
+		{ID: 1, Stage: "definition", CheckType: models.GateCheckValidTransition, AppliesTo: models.GatePhaseRequest, IsActive: true},
+		{ID: 2, Stage: "definition", CheckType: models.GateCheckMinEnablers, Params: json.RawMessage(`{"min_count": 1}`), AppliesTo: models.GatePhaseBoth, IsActive: true},
+		{ID: 3, Stage: "definition", CheckType: models.GateCheckMustCriteriaWritten, Params: json.RawMessage(`{"min_count": 1}`), AppliesTo: models.GatePhaseBoth, IsActive: true},
+		{ID: 4, Stage: "design", CheckType: models.GateCheckUIAssetsLinked, AppliesTo: models.GatePhaseBoth, IsActive: true},
+		{ID: 5, Stage: "execution", CheckType: models.GateCheckMustCriteriaPassed, AppliesTo: models.GatePhaseApproval, IsActive: true},
+		{ID: 6, Stage: "execution", CheckType: models.GateCheckMinEnablers, AppliesTo: models.GatePhaseBoth, IsActive: false},
+	}
+
+	mustGWT := models.AcceptanceCriteria{CriteriaID: "AC-1", Priority: "must", CriteriaFormat: "given_when_then",
+		GivenClause: strPtr("a user"), WhenClause: strPtr("they log in"), ThenClause: strPtr("they see the dashboard")}
+	mustIncomplete := models.AcceptanceCriteria{CriteriaID: "AC-2", Priority: "must", CriteriaFormat: "metric", MetricName: strPtr("p95")}
+
+	tests := []struct {
+		name          string
+		stage         string
+		phase         string
+		in            GateInput
+		expectReady   bool
+		expectUnmet   []int
+		expectChecked int
+	}{
+		{
+			name:  "Definition requested before specification approved",
+			stage: "definition", phase: models.GatePhaseRequest,
+			in: GateInput{
+				Capability: capabilityIn("specification", "pending_approval"),
+				Enablers:   []models.Enabler{{ID: 1}},
+				Criteria:   []models.AcceptanceCriteria{mustGWT},
+			},
+			expectReady: false, expectUnmet: []int{1}, expectChecked: 3,
+		},
+		{
+			name:  "Definition ready",
+			stage: "definition", phase: models.GatePhaseRequest,
+			in: GateInput{
+				Capability: capabilityIn("specification", "approved"),
+				Enablers:   []models.Enabler{{ID: 1}},
+				Criteria:   []models.AcceptanceCriteria{mustGWT},
+			},
+			expectReady: true, expectChecked: 3,
+		},
+		{
+			name:  "Definition missing enablers and complete criteria",
+			stage: "definition", phase: models.GatePhaseApproval,
+			in: GateInput{
+				Capability: capabilityIn("definition", "pending_approval"),
+				Criteria:   []models.AcceptanceCriteria{mustGWT, mustIncomplete},
+			},
+			expectReady: false, expectUnmet: []int{2, 3}, expectChecked: 2,
+		},
+		{
+			name:  "Skipping a stage is rejected",
+			stage: "definition", phase: models.GatePhaseRequest,
+			in: GateInput{
+				Capability: capabilityIn("design", "approved"),
+				Enablers:   []models.Enabler{{ID: 1}},
+				Criteria:   []models.AcceptanceCriteria{mustGWT},
+			},
+			expectReady: false, expectUnmet: []int{1}, expectChecked: 3,
+		},
+		{
+			name:  "Design with a Figma link",
+			stage: "design", phase: models.GatePhaseRequest,
+			in: GateInput{
+				Capability: capabilityIn("definition", "approved",
+					models.CapabilityAsset{AssetType: "url", AssetURL: "https://www.figma.com/file/abc/Login"}),
+			},
+			expectReady: true, expectChecked: 1,
+		},
+		{
+			name:  "Design with only a text document",
+			stage: "design", phase: models.GatePhaseRequest,
+			in: GateInput{
+				Capability: capabilityIn("definition", "approved",
+					models.CapabilityAsset{AssetType: "file", AssetName: "notes.txt"}),
+			},
+			expectReady: false, expectUnmet: []int{4}, expectChecked: 1,
+		},
+		{
+			name:  "Execution approval with failing must criteria",
+			stage: "execution", phase: models.GatePhaseApproval,
+			in: GateInput{
+				Capability: capabilityIn("execution", "pending_approval"),
+				Summaries: []models.AcceptanceCriteriaSummary{
+					{MustCount: 2, MustPassedCount: 2},
+					{MustCount: 3, MustPassedCount: 1},
+				},
+			},
+			expectReady: false, expectUnmet: []int{5}, expectChecked: 1,
+		},
+		{
+			name:  "Execution request does not need passed criteria",
+			stage: "execution", phase: models.GatePhaseRequest,
+			in: GateInput{
+				Capability: capabilityIn("design", "approved"),
+			},
+			expectReady: true, expectChecked: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := EvaluateReadiness(rules, tt.stage, tt.phase, tt.in)
+
+			if report.Ready != tt.expectReady {
+				t.Errorf("expected ready=%v, got %v (%+v)", tt.expectReady, report.Ready, report.Unmet)
+			}
+			if len(report.Checks) != tt.expectChecked {
+				t.Errorf("expected %d checks, got %d", tt.expectChecked, len(report.Checks))
+			}
+			if len(report.Unmet) != len(tt.expectUnmet) {
+				t.Fatalf("expected unmet rules %v, got %+v", tt.expectUnmet, report.Unmet)
+			}
+			for i, id := range tt.expectUnmet {
+				if report.Unmet[i].RuleID != id {
+					t.Errorf("expected unmet rule %d, got %d", id, report.Unmet[i].RuleID)
+				}
+				if report.Unmet[i].Message == "" {
+					t.Error("expected unmet check to explain itself")
+				}
+			}
+		})
+	}
+}
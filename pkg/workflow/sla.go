@@ -0,0 +1,100 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package workflow
+
+import (
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+// SLAAction is what the scheduler should do for a pending approval
+type SLAAction int
+
+const (
+	SLAActionNone SLAAction = iota
+	SLAActionRemind
+	SLAActionEscalate
+)
+
+// IndexSLARules maps active SLA rules by stage
+func IndexSLARules(rules []models.ApprovalSLARule) map[string]*models.ApprovalSLARule {
+	byStage := make(map[string]*models.ApprovalSLARule)
+	for i := range rules {
+		if rules[i].IsActive {
+			byStage[rules[i].Stage] = &rules[i]
+		}
+	}
+	return byStage
+}
+
+// EvaluateSLA reports how a pending approval stands against its stage rule.
+// A nil rule means the stage has no SLA; only the age is reported.
+func EvaluateSLA(approval models.CapabilityApproval, rule *models.ApprovalSLARule, now time.Time) models.ApprovalSLAStatus {
+	age := now.Sub(approval.RequestedAt)
+	status := models.ApprovalSLAStatus{
+		AgeHours:      float64(int(age.Hours()*10)) / 10,
+		RemindersSent: approval.RemindersSent,
+		Escalated:     approval.EscalatedAt != nil,
+	}
+
+	if rule == nil || rule.SLAHours <= 0 {
+		return status
+	}
+
+	due := approval.RequestedAt.Add(time.Duration(rule.SLAHours) * time.Hour)
+	status.SLAHours = rule.SLAHours
+	status.DueAt = &due
+	status.Breached = !now.Before(due)
+	return status
+}
+
+// NextSLAAction decides whether a pending approval needs a reminder or an escalation now.
+// Escalation happens once; reminders stop after an approval has been escalated.
+func NextSLAAction(approval models.CapabilityApproval, rule *models.ApprovalSLARule, now time.Time) SLAAction {
+	if rule == nil || approval.Status != models.ApprovalStatusPending {
+		return SLAActionNone
+	}
+
+	status := EvaluateSLA(approval, rule, now)
+	if status.Breached && !status.Escalated {
+		return SLAActionEscalate
+	}
+	if status.Escalated {
+		return SLAActionNone
+	}
+
+	if approval.RemindersSent < RemindersDue(rule, now.Sub(approval.RequestedAt)) {
+		return SLAActionRemind
+	}
+	return SLAActionNone
+}
+
+// RemindersDue counts the reminder thresholds an approval of the given age has passed
+func RemindersDue(rule *models.ApprovalSLARule, age time.Duration) int {
+	due := 0
+	for _, h := range rule.ReminderHours {
+		if h > 0 && age >= time.Duration(h)*time.Hour {
+			due++
+		}
+	}
+	return due
+}
+
+// MatchesAgeFilter reports whether an approval passes the pending-list filters.
+// minAgeHours <= 0 disables the age filter; breached nil disables the breach filter.
+func MatchesAgeFilter(status models.ApprovalSLAStatus, minAgeHours float64, breached *bool) bool {
+	if minAgeHours > 0 && status.AgeHours < minAgeHours {
+		return false
+	}
+	if breached != nil && status.Breached != *breached {
+		return false
+	}
+	return true
+}
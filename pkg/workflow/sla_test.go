@@ -0,0 +1,129 @@
+// UbeCode — Copyright © 2025 James Reynolds
+//
+// This file is part of UbeCode.
+// You may use this file under either:
+//   • The AGPLv3 Open Source License, OR
+//   • The UbeCode Commercial License
+// See the LICENSE.AGPL and LICENSE.COMMERCIAL files for details.
+
+package workflow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jareynolds/ubecode/pkg/models"
+)
+
+func TestNextSLAAction(t *testing.T) {
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	rule := &models.ApprovalSLARule{Stage: "execution", SLAHours: 120, ReminderHours: []int{24, 72}, IsActive: true}
+	escalatedAt := now.Add(-time.Hour)
+
+	tests := []struct {
+		name     string
+		approval models.CapabilityApproval
+		rule     *models.ApprovalSLARule
+		expected SLAAction
+	}{
+		{
+			name:     "Fresh approval needs nothing",
+			approval: models.CapabilityApproval{Status: models.ApprovalStatusPending, RequestedAt: now.Add(-2 * time.Hour)},
+			rule:     rule,
+			expected: SLAActionNone,
+		},
+		{
+			name:     "First reminder due",
+			approval: models.CapabilityApproval{Status: models.ApprovalStatusPending, RequestedAt: now.Add(-25 * time.Hour)},
+			rule:     rule,
+			expected: SLAActionRemind,
+		},
+		{
+			name:     "First reminder already sent",
+			approval: models.CapabilityApproval{Status: models.ApprovalStatusPending, RequestedAt: now.Add(-30 * time.Hour), RemindersSent: 1},
+			rule:     rule,
+			expected: SLAActionNone,
+		},
+		{
+			name:     "Second reminder due",
+			approval: models.CapabilityApproval{Status: models.ApprovalStatusPending, RequestedAt: now.Add(-73 * time.Hour), RemindersSent: 1},
+			rule:     rule,
+			expected: SLAActionRemind,
+		},
+		{
+			name:     "Breached escalates",
+			approval: models.CapabilityApproval{Status: models.ApprovalStatusPending, RequestedAt: now.Add(-7 * 24 * time.Hour), RemindersSent: 2},
+			rule:     rule,
+			expected: SLAActionEscalate,
+		},
+		{
+			name:     "Escalated only once",
+			approval: models.CapabilityApproval{Status: models.ApprovalStatusPending, RequestedAt: now.Add(-7 * 24 * time.Hour), EscalatedAt: &escalatedAt},
+			rule:     rule,
+			expected: SLAActionNone,
+		},
+		{
+			name:     "No rule for stage",
+			approval: models.CapabilityApproval{Status: models.ApprovalStatusPending, RequestedAt: now.Add(-30 * 24 * time.Hour)},
+			rule:     nil,
+			expected: SLAActionNone,
+		},
+		{
+			name:     "Decided approval ignored",
+			approval: models.CapabilityApproval{Status: models.ApprovalStatusApproved, RequestedAt: now.Add(-30 * 24 * time.Hour)},
+			rule:     rule,
+			expected: SLAActionNone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NextSLAAction(tt.approval, tt.rule, now); got != tt.expected {
+				t.Errorf("expected action %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestEvaluateSLAAndFilter(t *testing.T) {
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	rule := &models.ApprovalSLARule{SLAHours: 48, IsActive: true}
+	approval := models.CapabilityApproval{RequestedAt: now.Add(-50 * time.Hour)}
+
+	status := EvaluateSLA(approval, rule, now)
+	if !status.Breached {
+		t.Error("expected approval to be breached")
+	}
+	if status.AgeHours != 50 {
+		t.Errorf("expected age 50h, got %v", status.AgeHours)
+	}
+	if status.DueAt == nil || !status.DueAt.Equal(now.Add(-2*time.Hour)) {
+		t.Errorf("unexpected due time %v", status.DueAt)
+	}
+
+	yes, no := true, false
+	if !MatchesAgeFilter(status, 48, &yes) {
+		t.Error("expected breached approval older than 48h to match")
+	}
+	if MatchesAgeFilter(status, 0, &no) {
+		t.Error("expected breached approval not to match breached=false")
+	}
+	if MatchesAgeFilter(status, 72, nil) {
+		t.Error("expected 50h approval not to match min age 72h")
+	}
+}
+
+func TestIndexSLARulesSkipsInactive(t *testing.T) {
+	rules := []models.ApprovalSLARule{
+		{Stage: "design", SLAHours: 72, IsActive: true},
+		{Stage: "execution", SLAHours: 120, IsActive: false},
+	}
+
+	byStage := IndexSLARules(rules)
+	if byStage["design"] == nil {
+		t.Error("expected design rule to be indexed")
+	}
+	if byStage["execution"] != nil {
+		t.Error("expected inactive execution rule to be skipped")
+	}
+}
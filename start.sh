@@ -229,6 +229,16 @@ echo ""
 
 cd "$ROOT_DIR"
 
+# Shared secret the integration service signs Claude CLI proxy requests with
+CLAUDE_PROXY_SECRET_FILE="$ROOT_DIR/.claude-proxy-secret"
+if [ -z "$CLAUDE_PROXY_SECRET" ]; then
+    if [ ! -f "$CLAUDE_PROXY_SECRET_FILE" ]; then
+        (umask 077 && openssl rand -hex 32 > "$CLAUDE_PROXY_SECRET_FILE")
+    fi
+    CLAUDE_PROXY_SECRET=$(cat "$CLAUDE_PROXY_SECRET_FILE")
+fi
+export CLAUDE_PROXY_SECRET
+
 if [ -n "$BUILD_FLAG" ]; then
     echo -e "${YELLOW}Building Docker containers...${NC}"
     docker compose build
@@ -300,7 +310,7 @@ echo ""
 
 # Build the proxy if needed
 CLAUDE_PROXY_BIN="$ROOT_DIR/cmd/claude-proxy/claude-proxy"
-if [ ! -f "$CLAUDE_PROXY_BIN" ] || [ "$ROOT_DIR/cmd/claude-proxy/main.go" -nt "$CLAUDE_PROXY_BIN" ]; then
+if [ ! -f "$CLAUDE_PROXY_BIN" ] || [ -n "$(find "$ROOT_DIR/cmd/claude-proxy" "$ROOT_DIR/pkg/client" -name '*.go' -newer "$CLAUDE_PROXY_BIN")" ]; then
     echo -e "${CYAN}Building Claude CLI Proxy...${NC}"
     cd "$ROOT_DIR"
     go build -o "$CLAUDE_PROXY_BIN" ./cmd/claude-proxy/
@@ -314,13 +324,20 @@ fi
 
 # Start the proxy
 if [ -f "$CLAUDE_PROXY_BIN" ]; then
-    echo -e "${CYAN}Starting Claude CLI Proxy (port 9085)...${NC}"
+    # Containers reach the host through the docker0 bridge on Linux, not loopback
+    if [ -z "$CLAUDE_PROXY_LISTEN" ] && [ "$(uname)" = "Linux" ]; then
+        DOCKER_BRIDGE_IP=$(ip -4 addr show docker0 2>/dev/null | awk '/inet / {sub(/\/.*/, "", $2); print $2}')
+        if [ -n "$DOCKER_BRIDGE_IP" ]; then
+            export CLAUDE_PROXY_LISTEN="$DOCKER_BRIDGE_IP:9085"
+        fi
+    fi
+    echo -e "${CYAN}Starting Claude CLI Proxy (${CLAUDE_PROXY_LISTEN:-127.0.0.1:9085})...${NC}"
     cd "$ROOT_DIR"
     "$CLAUDE_PROXY_BIN" > "$CLAUDE_PROXY_LOG" 2>&1 &
     echo $! > "$CLAUDE_PROXY_PID"
     sleep 1
 
-    if wait_for_service "http://localhost:9085/health" "Claude CLI Proxy"; then
+    if wait_for_service "http://${CLAUDE_PROXY_LISTEN:-127.0.0.1:9085}/health" "Claude CLI Proxy"; then
         echo -e "  ${GREEN}✓${NC} Claude CLI Proxy started (PID: $(cat $CLAUDE_PROXY_PID))"
     else
         echo -e "  ${YELLOW}⚠${NC} Claude CLI Proxy may not be running correctly"
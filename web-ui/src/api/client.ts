@@ -78,6 +78,28 @@ export const workspaceClient = createClient(BASE_URLS.workspace);
   });
 });
 
+/**
+ * fetch() with the session's auth token, for calls that need the raw Response (streams,
+ * status checks) rather than one of the axios clients above
+ */
+export function apiFetch(input: string, init: RequestInit = {}): Promise<Response> {
+  const headers = new Headers(init.headers);
+  const token = sessionStorage.getItem('auth_token');
+  if (token && !headers.has('Authorization')) {
+    headers.set('Authorization', `Bearer ${token}`);
+  }
+  return fetch(input, { ...init, headers });
+}
+
+/**
+ * Request fields naming a workspace for workspace-scoped integration-service endpoints.
+ * The server resolves the workspace by its registry ID; the folder is only used by
+ * servers running without a workspace registry.
+ */
+export function workspaceRef(workspace: { serverId?: number; projectFolder?: string }) {
+  return { workspaceId: workspace.serverId, workspacePath: workspace.projectFolder };
+}
+
 // Generic request wrapper with error handling
 export async function apiRequest<T>(
   client: AxiosInstance,
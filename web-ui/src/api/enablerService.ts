@@ -1,4 +1,4 @@
-import { capabilityClient, apiRequest, SPEC_URL } from './client';
+import { capabilityClient, apiRequest, SPEC_URL, apiFetch } from './client';
 
 // ========================
 // Enabler Types
@@ -806,7 +806,7 @@ const SPECIFICATION_API_URL = SPEC_URL;
  * Read enabler specifications from the specifications folder
  */
 export async function readEnablerSpecifications(workspacePath?: string): Promise<EnablerSpecificationsResponse> {
-  const response = await fetch(`${SPECIFICATION_API_URL}/api/read-enabler-specifications`, {
+  const response = await apiFetch(`${SPECIFICATION_API_URL}/api/read-enabler-specifications`, {
     method: 'POST',
     headers: {
       'Content-Type': 'application/json',
@@ -1,6 +1,6 @@
 import React, { useState, useEffect } from 'react';
 import { Button } from './Button';
-import { INTEGRATION_URL } from '../api/client';
+import { INTEGRATION_URL, apiFetch } from '../api/client';
 
 interface IntegrationFile {
   id: string;
@@ -68,7 +68,7 @@ export const AssetsPane: React.FC<AssetsPaneProps> = ({ workspaceId, onClose, on
             const updatedFiles = await Promise.all(
               figmaFiles.map(async (file) => {
                 try {
-                  const response = await fetch(`${INTEGRATION_URL}/fetch-file-meta`, {
+                  const response = await apiFetch(`${INTEGRATION_URL}/fetch-file-meta`, {
                     method: 'POST',
                     headers: { 'Content-Type': 'application/json' },
                     body: JSON.stringify({
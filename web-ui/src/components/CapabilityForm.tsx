@@ -8,7 +8,7 @@ import type {
 import { capabilityService } from '../api/services';
 import { Button } from './Button';
 import { useWorkspace } from '../context/WorkspaceContext';
-import { INTEGRATION_URL } from '../api/client';
+import { INTEGRATION_URL, workspaceRef, apiFetch } from '../api/client';
 
 interface StoryboardFile {
   fileName: string;
@@ -87,13 +87,13 @@ export const CapabilityForm: React.FC<CapabilityFormProps> = ({
     console.log('[CapabilityForm] Loading storyboard files from:', currentWorkspace.projectFolder);
     setLoadingStoryboards(true);
     try {
-      const response = await fetch(`${INTEGRATION_URL}/story-files`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/story-files`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
-          workspacePath: currentWorkspace.projectFolder,
+          ...workspaceRef(currentWorkspace),
         }),
       });
 
@@ -230,13 +230,13 @@ export const CapabilityForm: React.FC<CapabilityFormProps> = ({
       }
 
       // Save to definition folder
-      const response = await fetch(`${INTEGRATION_URL}/save-specifications`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/save-specifications`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
-          workspacePath: currentWorkspace.projectFolder,
+          ...workspaceRef(currentWorkspace),
           files: [{ fileName, content: markdown }],
           subfolder: 'definition'
         }),
@@ -0,0 +1,118 @@
+import React, { useEffect, useState } from 'react';
+import { useAuth, type MFAChallenge, type MFASetup } from '../context/AuthContext';
+
+export interface MFAStepProps {
+  challenge: MFAChallenge;
+  onComplete: () => void;
+  onCancel: () => void;
+}
+
+// Second login step: enter a TOTP or recovery code, or enroll when the role requires MFA
+export const MFAStep: React.FC<MFAStepProps> = ({ challenge, onComplete, onCancel }) => {
+  const { verifyMFA, setupMFA, enableMFA, isLoading } = useAuth();
+  const [code, setCode] = useState('');
+  const [error, setError] = useState<string | null>(null);
+  const [setup, setSetup] = useState<MFASetup | null>(null);
+  const [recoveryCodes, setRecoveryCodes] = useState<string[] | null>(null);
+
+  useEffect(() => {
+    if (challenge.enrollmentRequired) {
+      setupMFA(challenge.mfaToken)
+        .then(setSetup)
+        .catch((err) => setError(err instanceof Error ? err.message : 'Failed to start MFA setup'));
+    }
+  }, [challenge, setupMFA]);
+
+  const handleSubmit = async (e: React.FormEvent): Promise<void> => {
+    e.preventDefault();
+    setError(null);
+    try {
+      if (challenge.enrollmentRequired) {
+        setRecoveryCodes(await enableMFA(code, challenge.mfaToken));
+      } else {
+        await verifyMFA(challenge.mfaToken, code);
+        onComplete();
+      }
+    } catch (err) {
+      setError(err instanceof Error ? err.message : 'Verification failed');
+    }
+  };
+
+  if (recoveryCodes) {
+    return (
+      <div className="space-y-4">
+        <p className="text-sm text-grey-700">
+          Two-factor authentication is on. Save these recovery codes somewhere safe; each one can be
+          used once if you lose access to your authenticator app.
+        </p>
+        <div className="grid grid-cols-2 gap-2 p-3 rounded-lg bg-gray-50 border border-gray-200 font-mono text-sm">
+          {recoveryCodes.map((c) => (
+            <span key={c}>{c}</span>
+          ))}
+        </div>
+        <button type="button" className="btn btn-primary w-full" onClick={onComplete}>
+          Continue
+        </button>
+      </div>
+    );
+  }
+
+  return (
+    <form className="space-y-4" onSubmit={handleSubmit}>
+      {error && (
+        <div className="p-3 rounded-lg bg-red-50 border border-red-200 text-red-700 text-sm">
+          {error}
+        </div>
+      )}
+
+      {challenge.enrollmentRequired ? (
+        <div className="space-y-2 text-sm text-grey-700">
+          <p>Your role requires two-factor authentication. Add UbeCode to your authenticator app:</p>
+          {setup && (
+            <>
+              <a className="text-indigo-600 hover:text-indigo-500 break-all" href={setup.otpauthUrl}>
+                Open in authenticator app
+              </a>
+              <p>
+                Or enter this key manually: <code className="font-mono break-all">{setup.secret}</code>
+              </p>
+            </>
+          )}
+          <p>Then enter the 6-digit code it shows.</p>
+        </div>
+      ) : (
+        <p className="text-sm text-grey-700">
+          Enter the 6-digit code from your authenticator app, or one of your recovery codes.
+        </p>
+      )}
+
+      <div className="space-y-2">
+        <label className="label" htmlFor="mfa-code">
+          Authentication code
+        </label>
+        <input
+          type="text"
+          className="input"
+          id="mfa-code"
+          autoComplete="one-time-code"
+          autoFocus
+          required
+          value={code}
+          onChange={(e) => setCode(e.target.value)}
+          disabled={isLoading}
+        />
+      </div>
+
+      <button type="submit" className="btn btn-primary w-full" disabled={isLoading || !code}>
+        {isLoading ? 'Verifying...' : 'Verify'}
+      </button>
+      <button
+        type="button"
+        className="w-full text-sm text-indigo-600 hover:text-indigo-500 font-medium"
+        onClick={onCancel}
+      >
+        Back to sign in
+      </button>
+    </form>
+  );
+};
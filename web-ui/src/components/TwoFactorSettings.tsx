@@ -0,0 +1,138 @@
+import React, { useCallback, useEffect, useState } from 'react';
+import { Card } from './Card';
+import { Button } from './Button';
+import { Alert } from './Alert';
+import { useAuth, type MFASetup } from '../context/AuthContext';
+import { authClient } from '../api/client';
+
+interface MFAStatus {
+  enabled: boolean;
+  required: boolean;
+  recoveryCodesRemaining: number;
+}
+
+// Settings card for enrolling, disabling and re-issuing recovery codes for TOTP MFA
+export const TwoFactorSettings: React.FC = () => {
+  const { setupMFA, enableMFA } = useAuth();
+  const [status, setStatus] = useState<MFAStatus | null>(null);
+  const [setup, setSetup] = useState<MFASetup | null>(null);
+  const [code, setCode] = useState('');
+  const [recoveryCodes, setRecoveryCodes] = useState<string[] | null>(null);
+  const [error, setError] = useState<string | null>(null);
+
+  const loadStatus = useCallback(async () => {
+    try {
+      const response = await authClient.get('/api/auth/mfa');
+      setStatus(response.data);
+    } catch (err: any) {
+      setError(err.response?.data?.error || 'Failed to load two-factor status');
+    }
+  }, []);
+
+  useEffect(() => {
+    loadStatus();
+  }, [loadStatus]);
+
+  const run = async (action: () => Promise<void>): Promise<void> => {
+    setError(null);
+    try {
+      await action();
+      setCode('');
+      await loadStatus();
+    } catch (err: any) {
+      setError(err.response?.data?.error || err.message || 'Request failed');
+    }
+  };
+
+  const handleSetup = () => run(async () => {
+    setRecoveryCodes(null);
+    setSetup(await setupMFA());
+  });
+
+  const handleEnable = () => run(async () => {
+    setRecoveryCodes(await enableMFA(code));
+    setSetup(null);
+  });
+
+  const handleDisable = () => run(async () => {
+    await authClient.post('/api/auth/mfa/disable', { code });
+    setRecoveryCodes(null);
+  });
+
+  const handleRegenerate = () => run(async () => {
+    const response = await authClient.post('/api/auth/mfa/recovery-codes', { code });
+    setRecoveryCodes(response.data.recoveryCodes);
+  });
+
+  if (!status) {
+    return null;
+  }
+
+  return (
+    <Card>
+      <h3 className="mb-2">Two-Factor Authentication</h3>
+      <p className="text-sm text-grey-600 mb-6">
+        {status.enabled
+          ? `Enabled. ${status.recoveryCodesRemaining} recovery codes remaining.`
+          : 'Protect your account with a code from an authenticator app when you sign in.'}
+        {status.required && ' Your role requires two-factor authentication.'}
+      </p>
+
+      <div className="space-y-4">
+        {error && <Alert type="error">{error}</Alert>}
+
+        {recoveryCodes && (
+          <Alert type="success">
+            <p className="mb-2">Save these recovery codes somewhere safe. Each one works once.</p>
+            <div className="grid grid-cols-2 gap-2 font-mono text-sm">
+              {recoveryCodes.map((c) => (
+                <span key={c}>{c}</span>
+              ))}
+            </div>
+          </Alert>
+        )}
+
+        {setup && (
+          <div className="text-sm text-grey-700 space-y-2">
+            <a className="text-blue-600 hover:text-blue-700 underline break-all" href={setup.otpauthUrl}>
+              Open in authenticator app
+            </a>
+            <p>
+              Or enter this key manually: <code className="font-mono break-all">{setup.secret}</code>
+            </p>
+          </div>
+        )}
+
+        {(setup || status.enabled) && (
+          <input
+            type="text"
+            className="input"
+            placeholder={setup ? '6-digit code' : 'Authentication or recovery code'}
+            autoComplete="one-time-code"
+            value={code}
+            onChange={(e) => setCode(e.target.value)}
+          />
+        )}
+
+        <div className="flex gap-3">
+          {!status.enabled && !setup && (
+            <Button variant="primary" onClick={handleSetup}>Set Up</Button>
+          )}
+          {setup && (
+            <Button variant="primary" onClick={handleEnable} disabled={!code}>Enable</Button>
+          )}
+          {status.enabled && (
+            <>
+              <Button variant="secondary" onClick={handleRegenerate} disabled={!code}>
+                New Recovery Codes
+              </Button>
+              {!status.required && (
+                <Button variant="danger" onClick={handleDisable} disabled={!code}>Disable</Button>
+              )}
+            </>
+          )}
+        </div>
+      </div>
+    </Card>
+  );
+};
@@ -1,8 +1,7 @@
 import React, { useState, useEffect } from 'react';
-import axios from 'axios';
 import { Button } from './Button';
 import { Alert } from './Alert';
-import { INTEGRATION_URL } from '../api/client';
+import { integrationClient } from '../api/client';
 
 interface Workspace {
   id: string;
@@ -77,7 +76,7 @@ export const WorkspaceIntegrations: React.FC<WorkspaceIntegrationsProps> = ({ wo
       }
 
       // Fetch resources from integration
-      const response = await axios.post(`${INTEGRATION_URL}/fetch-resources`, {
+      const response = await integrationClient.post('/fetch-resources', {
         integration_name: integrationName,
         credentials: config.fields
       });
@@ -102,13 +101,13 @@ export const WorkspaceIntegrations: React.FC<WorkspaceIntegrationsProps> = ({ wo
         return;
       }
 
-      const response = await axios.post(`${INTEGRATION_URL}/suggest-resources`, {
+      const response = await integrationClient.post('/suggest-resources', {
         workspace_name: workspace.name,
         workspace_description: workspace.description || '',
         integration_name: integrationName,
         resources: resourcesList,
         anthropic_key: anthropicKey
-      });
+      }, { timeout: 0 });
 
       setSuggestions(response.data.suggestions);
 
@@ -172,7 +171,7 @@ export const WorkspaceIntegrations: React.FC<WorkspaceIntegrationsProps> = ({ wo
             for (const resource of dataToSave) {
               if (resource.type === 'user' || resource.type === 'team') {
                 console.log(`[WorkspaceIntegrations] Fetching files for ${resource.name}...`);
-                const response = await axios.post(`${INTEGRATION_URL}/fetch-team-files`, {
+                const response = await integrationClient.post('/fetch-team-files', {
                   integration_name: 'Figma API',
                   team_id: resource.id,
                   credentials: { access_token: config.fields.access_token }
@@ -46,3 +46,8 @@ export { AcceptanceCriteriaSection } from './AcceptanceCriteriaSection';
 
 export { ConfirmDialog } from './ConfirmDialog';
 export type { ConfirmDialogProps } from './ConfirmDialog';
+
+export { MFAStep } from './MFAStep';
+export type { MFAStepProps } from './MFAStep';
+
+export { TwoFactorSettings } from './TwoFactorSettings';
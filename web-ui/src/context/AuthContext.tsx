@@ -12,6 +12,25 @@ interface User {
   isActive: boolean;
 }
 
+export interface SSOProvider {
+  id: string;
+  name: string;
+  type: 'google' | 'oidc';
+}
+
+// Returned instead of tokens when a login still needs a second factor
+export interface MFAChallenge {
+  mfaRequired: boolean;
+  enrollmentRequired?: boolean;
+  mfaToken: string;
+  expiresAt: string;
+}
+
+export interface MFASetup {
+  secret: string;
+  otpauthUrl: string;
+}
+
 interface AuthState {
   user: User | null;
   token: string | null;
@@ -20,15 +39,30 @@ interface AuthState {
 }
 
 interface AuthContextType extends AuthState {
-  login: (email: string, password: string) => Promise<void>;
+  login: (email: string, password: string) => Promise<MFAChallenge | null>;
+  verifyMFA: (mfaToken: string, code: string) => Promise<void>;
+  setupMFA: (mfaToken?: string) => Promise<MFASetup>;
+  enableMFA: (code: string, mfaToken?: string) => Promise<string[]>;
+  requestPasswordReset: (email: string) => Promise<void>;
+  resetPassword: (token: string, password: string) => Promise<void>;
   loginWithGoogle: () => Promise<void>;
-  handleGoogleCallback: (code: string, state: string) => Promise<void>;
+  handleGoogleCallback: (code: string, state: string) => Promise<MFAChallenge | null>;
+  getSSOProviders: () => Promise<SSOProvider[]>;
+  loginWithSSO: (providerId: string) => Promise<void>;
+  handleSSOCallback: (providerId: string, code: string, state: string) => Promise<MFAChallenge | null>;
   logout: () => void;
   verifyToken: () => Promise<boolean>;
 }
 
 const AuthContext = createContext<AuthContextType | undefined>(undefined);
 
+// Enrollment runs either for the signed-in user or, with an MFA token, during a login
+// whose role requires MFA
+const mfaHeaders = (mfaToken?: string) => {
+  const token = sessionStorage.getItem('auth_token');
+  return !mfaToken && token ? { Authorization: `Bearer ${token}` } : undefined;
+};
+
 export const AuthProvider: React.FC<{ children: ReactNode }> = ({ children }) => {
   const [state, setState] = useState<AuthState>({
     user: null,
@@ -48,33 +82,115 @@ export const AuthProvider: React.FC<{ children: ReactNode }> = ({ children }) =>
     }
   }, []);
 
-  const login = async (email: string, password: string): Promise<void> => {
+  // Store a completed login, or hand back the MFA challenge when a second factor is needed
+  const completeLogin = useCallback((data: any): MFAChallenge | null => {
+    if (data.mfaRequired) {
+      setState((prev) => ({ ...prev, isLoading: false }));
+      return data as MFAChallenge;
+    }
+
+    const { token, refreshToken, user } = data;
+
+    // Use sessionStorage for tab-specific authentication (allows multiple users in different tabs)
+    sessionStorage.setItem('auth_token', token);
+    sessionStorage.setItem('refresh_token', refreshToken);
+    sessionStorage.setItem('user', JSON.stringify(user));
+
+    setState({
+      user,
+      token,
+      isAuthenticated: true,
+      isLoading: false,
+    });
+    return null;
+  }, []);
+
+  const login = async (email: string, password: string): Promise<MFAChallenge | null> => {
     try {
       setState((prev) => ({ ...prev, isLoading: true }));
 
       const response = await authClient.post('/api/auth/login', { email, password });
-      const { token, user } = response.data;
+      return completeLogin(response.data);
+    } catch (error: any) {
+      setState((prev) => ({ ...prev, isLoading: false }));
+      const message = error.response?.data?.error || 'Login failed. Please check your credentials.';
+      throw new Error(message);
+    }
+  };
 
-      // Use sessionStorage for tab-specific authentication (allows multiple users in different tabs)
-      sessionStorage.setItem('auth_token', token);
-      sessionStorage.setItem('user', JSON.stringify(user));
+  const verifyMFA = async (mfaToken: string, code: string): Promise<void> => {
+    try {
+      setState((prev) => ({ ...prev, isLoading: true }));
 
-      setState({
-        user,
-        token,
-        isAuthenticated: true,
-        isLoading: false,
-      });
+      const response = await authClient.post('/api/auth/mfa/verify', { mfaToken, code });
+      completeLogin(response.data);
     } catch (error: any) {
       setState((prev) => ({ ...prev, isLoading: false }));
-      const message = error.response?.data?.error || 'Login failed. Please check your credentials.';
+      const message = error.response?.data?.error || 'Verification failed';
+      throw new Error(message);
+    }
+  };
+
+  // Enrollment runs either for the signed-in user or, with an MFA token, during a login
+  // whose role requires MFA
+
+  const setupMFA = useCallback(async (mfaToken?: string): Promise<MFASetup> => {
+    try {
+      const response = await authClient.post('/api/auth/mfa/setup', mfaToken ? { mfaToken } : {}, {
+        headers: mfaHeaders(mfaToken),
+      });
+      return response.data;
+    } catch (error: any) {
+      const message = error.response?.data?.error || 'Failed to start MFA setup';
+      throw new Error(message);
+    }
+  }, []);
+
+  const enableMFA = async (code: string, mfaToken?: string): Promise<string[]> => {
+    try {
+      const response = await authClient.post('/api/auth/mfa/enable', { code, mfaToken }, {
+        headers: mfaHeaders(mfaToken),
+      });
+      if (response.data.login) {
+        completeLogin(response.data.login);
+      }
+      return response.data.recoveryCodes;
+    } catch (error: any) {
+      const message = error.response?.data?.error || 'Failed to enable MFA';
+      throw new Error(message);
+    }
+  };
+
+  const requestPasswordReset = async (email: string): Promise<void> => {
+    try {
+      await authClient.post('/api/auth/password/forgot', { email });
+    } catch (error: any) {
+      const message = error.response?.data?.error || 'Failed to request a password reset';
+      throw new Error(message);
+    }
+  };
+
+  const resetPassword = async (token: string, password: string): Promise<void> => {
+    try {
+      await authClient.post('/api/auth/password/reset', { token, password });
+    } catch (error: any) {
+      const message = error.response?.data?.error || 'Failed to reset password';
       throw new Error(message);
     }
   };
 
   const logout = (): void => {
+    // End the session server-side so the tokens cannot be reused
+    const token = sessionStorage.getItem('auth_token');
+    if (token) {
+      authClient
+        .post('/api/auth/logout', null, { headers: { Authorization: `Bearer ${token}` } })
+        .catch(() => undefined);
+    }
+
     // Use sessionStorage for tab-specific authentication
     sessionStorage.removeItem('auth_token');
+    sessionStorage.removeItem('refresh_token');
     sessionStorage.removeItem('user');
     setState({
       user: null,
@@ -84,19 +200,40 @@ export const AuthProvider: React.FC<{ children: ReactNode }> = ({ children }) =>
     });
   };
 
+  // Exchange the stored refresh token for a new token pair; access tokens are short-lived
+  const refreshSession = async (): Promise<string> => {
+    const refreshToken = sessionStorage.getItem('refresh_token');
+    if (!refreshToken) {
+      throw new Error('No refresh token');
+    }
+
+    const response = await authClient.post('/api/auth/refresh', { refreshToken });
+    sessionStorage.setItem('auth_token', response.data.token);
+    sessionStorage.setItem('refresh_token', response.data.refreshToken);
+    return response.data.token;
+  };
+
   const verifyToken = async (): Promise<boolean> => {
     try {
       // Use sessionStorage for tab-specific authentication
-      const token = sessionStorage.getItem('auth_token');
+      let token = sessionStorage.getItem('auth_token');
 
       if (!token) {
         setState((prev) => ({ ...prev, isLoading: false, isAuthenticated: false }));
         return false;
       }
 
-      const response = await authClient.get('/api/auth/verify', {
-        headers: { Authorization: `Bearer ${token}` },
-      });
+      let response;
+      try {
+        response = await authClient.get('/api/auth/verify', {
+          headers: { Authorization: `Bearer ${token}` },
+        });
+      } catch {
+        token = await refreshSession();
+        response = await authClient.get('/api/auth/verify', {
+          headers: { Authorization: `Bearer ${token}` },
+        });
+      }
 
       const { user } = response.data;
 
@@ -112,6 +249,7 @@ export const AuthProvider: React.FC<{ children: ReactNode }> = ({ children }) =>
       return true;
     } catch (error) {
       sessionStorage.removeItem('auth_token');
+      sessionStorage.removeItem('refresh_token');
       sessionStorage.removeItem('user');
       setState({
         user: null,
@@ -140,33 +278,62 @@ export const AuthProvider: React.FC<{ children: ReactNode }> = ({ children }) =>
     }
   };
 
-  const handleGoogleCallback = useCallback(async (code: string, state: string): Promise<void> => {
+  const handleGoogleCallback = useCallback(async (code: string, state: string): Promise<MFAChallenge | null> => {
     try {
       setState((prev) => ({ ...prev, isLoading: true }));
 
       // Send code and state to backend
-      const response = await authClient.get(`/api/auth/google/callback?code=${code}&state=${state}`);
-      const { token, user } = response.data;
+      const response = await authClient.get('/api/auth/google/callback', { params: { code, state } });
+      return completeLogin(response.data);
+    } catch (error: any) {
+      setState((prev) => ({ ...prev, isLoading: false }));
+      const message = error.response?.data?.error || 'Google login failed';
+      throw new Error(message);
+    }
+  }, [completeLogin]);
 
-      // Store token and user
-      sessionStorage.setItem('auth_token', token);
-      sessionStorage.setItem('user', JSON.stringify(user));
+  const getSSOProviders = useCallback(async (): Promise<SSOProvider[]> => {
+    try {
+      const response = await authClient.get('/api/auth/sso/providers');
+      return response.data;
+    } catch {
+      return [];
+    }
+  }, []);
 
-      setState({
-        user,
-        token,
-        isAuthenticated: true,
-        isLoading: false,
+  const loginWithSSO = async (providerId: string): Promise<void> => {
+    try {
+      setState((prev) => ({ ...prev, isLoading: true }));
+
+      // Get the identity provider login URL from backend
+      const response = await authClient.get(`/api/auth/sso/${encodeURIComponent(providerId)}/login`);
+      const { url } = response.data;
+
+      window.location.href = url;
+    } catch (error: any) {
+      setState((prev) => ({ ...prev, isLoading: false }));
+      const message = error.response?.data?.error || 'Failed to initiate single sign-on';
+      throw new Error(message);
+    }
+  };
+
+  const handleSSOCallback = useCallback(async (providerId: string, code: string, state: string): Promise<MFAChallenge | null> => {
+    try {
+      setState((prev) => ({ ...prev, isLoading: true }));
+
+      const response = await authClient.get(`/api/auth/sso/${encodeURIComponent(providerId)}/callback`, {
+        params: { code, state },
       });
+      return completeLogin(response.data);
     } catch (error: any) {
       setState((prev) => ({ ...prev, isLoading: false }));
-      const message = error.response?.data?.error || 'Google login failed';
+      const message = error.response?.data?.error || 'Single sign-on failed';
       throw new Error(message);
     }
-  }, []);
+  }, [completeLogin]);
 
   return (
-    <AuthContext.Provider value={{ ...state, login, loginWithGoogle, handleGoogleCallback, logout, verifyToken }}>
+    <AuthContext.Provider value={{ ...state, login, verifyMFA, setupMFA, enableMFA, requestPasswordReset, resetPassword, loginWithGoogle, handleGoogleCallback, getSSOProviders, loginWithSSO, handleSSOCallback, logout, verifyToken }}>
       {children}
     </AuthContext.Provider>
   );
@@ -1,7 +1,7 @@
 import React, { createContext, useContext, useState, useEffect, type ReactNode } from 'react';
 import { useAuth } from './AuthContext';
 import axios from 'axios';
-import { INTEGRATION_URL, WORKSPACE_URL } from '../api/client';
+import { INTEGRATION_URL, WORKSPACE_URL, integrationClient, apiFetch } from '../api/client';
 
 const SHARED_WORKSPACE_API = `${WORKSPACE_URL}/api`;
 
@@ -132,6 +132,7 @@ export interface Workspace {
   workspaceType?: WorkspaceType;
   figmaTeamUrl?: string;
   projectFolder?: string;
+  serverId?: number; // ID in the integration service's workspace registry
   aiPrinciples?: AIPrinciplesData;
   aiPrinciplesPresets?: AIPrinciplesPreset[];
   activeAIPreset?: number; // 1-5 representing which preset is active
@@ -389,6 +390,70 @@ export const WorkspaceProvider: React.FC<{ children: ReactNode }> = ({ children
       currentWorkspace,
       isLoading: false,
     }));
+
+    syncServerIds(workspaces);
+  };
+
+  // Attach workspace registry IDs so API calls can name workspaces by ID. The registry is
+  // optional; without it workspaces keep working by folder path.
+  const syncServerIds = async (workspaces: Workspace[]) => {
+    try {
+      const { data } = await integrationClient.get('/workspaces');
+      const ids = new Map<string, number>((data.workspaces || []).map((w: any) => [w.path, w.id]));
+
+      let changed = false;
+      const synced = workspaces.map(w => {
+        const serverId = w.projectFolder ? ids.get(w.projectFolder) : undefined;
+        if (serverId !== undefined && serverId !== w.serverId) {
+          changed = true;
+          return { ...w, serverId };
+        }
+        return w;
+      });
+      if (!changed) return;
+
+      saveWorkspaces(synced);
+      setState(prev => ({
+        ...prev,
+        workspaces: synced,
+        currentWorkspace: prev.currentWorkspace
+          ? synced.find(w => w.id === prev.currentWorkspace?.id) || prev.currentWorkspace
+          : null,
+      }));
+    } catch (error) {
+      console.warn('Workspace registry unavailable; using folder paths:', error);
+    }
+  };
+
+  // Register a workspace with the integration service, which creates its folder structure and
+  // .ubeworkspace file. A folder that is already registered (e.g. found on disk) is adopted.
+  // Returns undefined when the registry is not available.
+  const registerServerWorkspace = async (
+    workspace: Workspace,
+    folderName: string
+  ): Promise<{ id: number; path: string } | undefined> => {
+    try {
+      const { data } = await integrationClient.post('/workspaces', {
+        name: workspace.name,
+        description: workspace.description || '',
+        folder_name: folderName,
+        workspace_type: workspace.workspaceType || 'new',
+        config_id: workspace.id,
+        settings: workspace.figmaTeamUrl ? { figmaTeamUrl: workspace.figmaTeamUrl } : {},
+      });
+      return { id: data.id, path: data.path };
+    } catch (error) {
+      if (axios.isAxiosError(error) && error.response?.status === 409) {
+        try {
+          const { data } = await integrationClient.get('/workspaces');
+          const existing = (data.workspaces || []).find((w: any) => w.folder_name === folderName);
+          if (existing) return { id: existing.id, path: existing.path };
+        } catch (lookupError) {
+          console.error('Error looking up registered workspace:', lookupError);
+        }
+      }
+      return undefined;
+    }
   };
 
   const saveWorkspaces = (workspaces: Workspace[]) => {
@@ -425,44 +490,50 @@ export const WorkspaceProvider: React.FC<{ children: ReactNode }> = ({ children
       isShared: false,
     };
 
-    // Ensure workspace folder structure exists
-    try {
-      await fetch(`${INTEGRATION_URL}/folders/ensure-workspace-structure`, {
-        method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ workspacePath: projectFolder }),
-      });
-    } catch (error) {
-      console.error('Error ensuring workspace structure:', error);
-    }
+    const registered = await registerServerWorkspace(newWorkspace, safeFolderName);
+    if (registered) {
+      newWorkspace.serverId = registered.id;
+      newWorkspace.projectFolder = registered.path;
+    } else {
+      // Ensure workspace folder structure exists
+      try {
+        await apiFetch(`${INTEGRATION_URL}/folders/ensure-workspace-structure`, {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify({ workspacePath: projectFolder }),
+        });
+      } catch (error) {
+        console.error('Error ensuring workspace structure:', error);
+      }
 
-    // Save .ubeworkspace configuration file
-    try {
-      await fetch(`${INTEGRATION_URL}/workspace-config/save`, {
-        method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({
-          config: {
-            id: newWorkspace.id,
-            name: newWorkspace.name,
-            description: newWorkspace.description || '',
-            workspaceType: newWorkspace.workspaceType || 'new',
-            figmaTeamUrl: newWorkspace.figmaTeamUrl || '',
-            projectFolder: newWorkspace.projectFolder,
-            activeAIPreset: newWorkspace.activeAIPreset || 0,
-            selectedUIFramework: newWorkspace.selectedUIFramework || '',
-            selectedUILayout: newWorkspace.selectedUILayout || '',
-            ownerId: newWorkspace.ownerId,
-            ownerName: newWorkspace.ownerName || '',
-            isShared: newWorkspace.isShared,
-            createdAt: newWorkspace.createdAt.toISOString(),
-            updatedAt: newWorkspace.updatedAt.toISOString(),
-            version: '1.0',
-          },
-        }),
-      });
-    } catch (error) {
-      console.error('Error saving workspace configuration file:', error);
+      // Save .ubeworkspace configuration file
+      try {
+        await apiFetch(`${INTEGRATION_URL}/workspace-config/save`, {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify({
+            config: {
+              id: newWorkspace.id,
+              name: newWorkspace.name,
+              description: newWorkspace.description || '',
+              workspaceType: newWorkspace.workspaceType || 'new',
+              figmaTeamUrl: newWorkspace.figmaTeamUrl || '',
+              projectFolder: newWorkspace.projectFolder,
+              activeAIPreset: newWorkspace.activeAIPreset || 0,
+              selectedUIFramework: newWorkspace.selectedUIFramework || '',
+              selectedUILayout: newWorkspace.selectedUILayout || '',
+              ownerId: newWorkspace.ownerId,
+              ownerName: newWorkspace.ownerName || '',
+              isShared: newWorkspace.isShared,
+              createdAt: newWorkspace.createdAt.toISOString(),
+              updatedAt: newWorkspace.updatedAt.toISOString(),
+              version: '1.0',
+            },
+          }),
+        });
+      } catch (error) {
+        console.error('Error saving workspace configuration file:', error);
+      }
     }
 
     const updatedWorkspaces = [...state.workspaces, newWorkspace];
@@ -487,7 +558,7 @@ export const WorkspaceProvider: React.FC<{ children: ReactNode }> = ({ children
     const updatedWorkspace = updatedWorkspaces.find(w => w.id === id);
     if (updatedWorkspace?.projectFolder) {
       try {
-        await fetch(`${INTEGRATION_URL}/workspace-config/save`, {
+        await apiFetch(`${INTEGRATION_URL}/workspace-config/save`, {
           method: 'POST',
           headers: { 'Content-Type': 'application/json' },
           body: JSON.stringify({
@@ -4,13 +4,23 @@ import { Card } from '../components/Card';
 import { useWorkspace } from '../context/WorkspaceContext';
 import { AIPresetIndicator } from '../components/AIPresetIndicator';
 import { UIFrameworkIndicator } from '../components/UIFrameworkIndicator';
-import { INTEGRATION_URL } from '../api/client';
+import { INTEGRATION_URL, integrationClient, workspaceRef, apiFetch } from '../api/client';
+
+interface ToolCall {
+  id: string;
+  name: string;
+  input: Record<string, unknown>;
+  output: string;
+  isError?: boolean;
+  durationMs: number;
+}
 
 interface Message {
   id: string;
   role: 'user' | 'assistant';
   content: string;
   timestamp: Date;
+  toolCalls?: ToolCall[];
 }
 
 interface ChatHistory {
@@ -18,20 +28,85 @@ interface ChatHistory {
   content: string;
 }
 
+interface ConversationSummary {
+  id: number;
+  title: string;
+  artifact_id?: string;
+  updated_at: string;
+}
+
+interface StoredMessage {
+  id: number;
+  role: 'user' | 'assistant';
+  content: string;
+  tool_calls?: ToolCall[];
+  created_at: string;
+}
+
+const WELCOME_MESSAGE: Message = {
+  id: '1',
+  role: 'assistant',
+  content: 'Hello! I\'m your AI assistant for this workspace. I can help you with code generation, file operations, and answering questions about your project. I have access to read and write files within your workspace folder.',
+  timestamp: new Date(),
+};
+
 export const AIChat: React.FC = () => {
   const { currentWorkspace } = useWorkspace();
-  const [messages, setMessages] = useState<Message[]>([
-    {
-      id: '1',
-      role: 'assistant',
-      content: 'Hello! I\'m your AI assistant for this workspace. I can help you with code generation, file operations, and answering questions about your project. I have access to read and write files within your workspace folder.',
-      timestamp: new Date(),
-    },
-  ]);
+  const [messages, setMessages] = useState<Message[]>([WELCOME_MESSAGE]);
   const [input, setInput] = useState('');
   const [isLoading, setIsLoading] = useState(false);
   const [error, setError] = useState<string | null>(null);
+  // Stored threads are only available for workspaces in the server registry
+  const [conversations, setConversations] = useState<ConversationSummary[]>([]);
+  const [conversationId, setConversationId] = useState<number | null>(null);
   const messagesEndRef = useRef<HTMLDivElement>(null);
+  const workspaceId = currentWorkspace?.serverId;
+
+  const loadConversations = async () => {
+    if (!workspaceId) {
+      setConversations([]);
+      return;
+    }
+    try {
+      const { data } = await integrationClient.get('/conversations', { params: { workspaceId } });
+      setConversations(data.conversations || []);
+    } catch {
+      // Conversations are not stored without a database
+      setConversations([]);
+    }
+  };
+
+  useEffect(() => {
+    setConversationId(null);
+    setMessages([WELCOME_MESSAGE]);
+    loadConversations();
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, [workspaceId]);
+
+  const openConversation = async (id: number | null) => {
+    setError(null);
+    setConversationId(id);
+    if (id === null) {
+      setMessages([WELCOME_MESSAGE]);
+      return;
+    }
+    try {
+      const { data } = await integrationClient.get(`/conversations/${id}`, { params: { workspaceId } });
+      const stored: StoredMessage[] = data.messages || [];
+      setMessages([
+        WELCOME_MESSAGE,
+        ...stored.map((msg) => ({
+          id: `stored-${msg.id}`,
+          role: msg.role,
+          content: msg.content,
+          timestamp: new Date(msg.created_at),
+          toolCalls: msg.tool_calls,
+        })),
+      ]);
+    } catch (err) {
+      setError(`Failed to load conversation: ${err instanceof Error ? err.message : 'Unknown error'}`);
+    }
+  };
 
   const scrollToBottom = () => {
     messagesEndRef.current?.scrollIntoView({ behavior: 'smooth' });
@@ -71,20 +146,21 @@ export const AIChat: React.FC = () => {
     setIsLoading(true);
 
     try {
-      // Build chat history for context
-      const history: ChatHistory[] = messages.slice(1).map(msg => ({
+      // Build chat history for context; stored conversations keep their own
+      const history: ChatHistory[] = conversationId ? [] : messages.slice(1).map(msg => ({
         role: msg.role,
         content: msg.content,
       }));
 
-      const response = await fetch(`${INTEGRATION_URL}/ai-chat`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/ai-chat`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
           message: input,
-          workspacePath: currentWorkspace.projectFolder,
+          ...workspaceRef(currentWorkspace),
+          conversationId: conversationId || undefined,
           apiKey: apiKey,
           history: history,
           aiPreset: currentWorkspace.activeAIPreset || 0,
@@ -104,9 +180,14 @@ export const AIChat: React.FC = () => {
         role: 'assistant',
         content: data.response,
         timestamp: new Date(),
+        toolCalls: data.toolCalls,
       };
 
       setMessages((prev) => [...prev, aiResponse]);
+      if (data.conversationId && data.conversationId !== conversationId) {
+        setConversationId(data.conversationId);
+        loadConversations();
+      }
     } catch (err) {
       setError(`Failed to communicate with AI service: ${err instanceof Error ? err.message : 'Unknown error'}`);
     } finally {
@@ -179,6 +260,30 @@ export const AIChat: React.FC = () => {
     return parts.length > 0 ? parts : <p style={{ whiteSpace: 'pre-wrap' }}>{content}</p>;
   };
 
+  // Summarize a tool call's input by what it acted on; file contents are left out
+  const describeToolInput = (call: ToolCall) => {
+    const input = call.input || {};
+    const target = ['path', 'id', 'pattern'].map((key) => input[key]).find((value) => typeof value === 'string' && value);
+    return target ? String(target) : '';
+  };
+
+  const renderToolCalls = (toolCalls: ToolCall[]) => (
+    <details className="tool-calls">
+      <summary>{toolCalls.length} tool call{toolCalls.length === 1 ? '' : 's'}</summary>
+      {toolCalls.map((call) => (
+        <details key={call.id} className={`tool-call${call.isError ? ' tool-call-error' : ''}`}>
+          <summary>
+            <code>{call.name}</code> {describeToolInput(call)}
+            {call.isError ? ' (failed)' : ''}
+          </summary>
+          <pre className="code-block">
+            <code>{call.output}</code>
+          </pre>
+        </details>
+      ))}
+    </details>
+  );
+
   return (
     <div className="ai-chat-page" style={{ padding: '16px' }}>
       <AIPresetIndicator />
@@ -205,6 +310,24 @@ export const AIChat: React.FC = () => {
             ? `Working in: ${currentWorkspace.projectFolder}`
             : 'Select a workspace with a project folder to enable AI assistance'}
         </p>
+        {workspaceId && (
+          <div className="conversation-picker">
+            <select
+              value={conversationId ?? ''}
+              onChange={(e) => openConversation(e.target.value ? Number(e.target.value) : null)}
+              disabled={isLoading}
+              className="input"
+            >
+              <option value="">New conversation</option>
+              {conversations.map((conversation) => (
+                <option key={conversation.id} value={conversation.id}>
+                  {conversation.title}
+                  {conversation.artifact_id ? ` (${conversation.artifact_id})` : ''}
+                </option>
+              ))}
+            </select>
+          </div>
+        )}
       </div>
 
       {error && (
@@ -233,6 +356,7 @@ export const AIChat: React.FC = () => {
               </div>
 
               <div className="message-content">
+                {message.toolCalls && message.toolCalls.length > 0 && renderToolCalls(message.toolCalls)}
                 {renderMessageContent(message.content)}
               </div>
             </div>
@@ -303,6 +427,11 @@ export const AIChat: React.FC = () => {
           font-size: 14px;
         }
 
+        .conversation-picker {
+          margin-top: 12px;
+          max-width: 480px;
+        }
+
         .chat-container {
           height: calc(100vh - 360px);
           display: flex;
@@ -370,6 +499,24 @@ export const AIChat: React.FC = () => {
           line-height: 1.6;
         }
 
+        .tool-calls {
+          margin-bottom: 12px;
+          font-size: 13px;
+          color: var(--color-secondaryLabel);
+        }
+
+        .tool-calls summary {
+          cursor: pointer;
+        }
+
+        .tool-call {
+          margin: 6px 0 0 16px;
+        }
+
+        .tool-call-error summary {
+          color: var(--color-systemRed);
+        }
+
         .code-block-container {
           margin-top: 16px;
           border-radius: 8px;
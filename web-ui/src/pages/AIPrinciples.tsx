@@ -4,7 +4,7 @@ import { Button } from '../components/Button';
 import { useWorkspace } from '../context/WorkspaceContext';
 import { AIPresetIndicator } from '../components/AIPresetIndicator';
 import { UIFrameworkIndicator } from '../components/UIFrameworkIndicator';
-import { INTEGRATION_URL } from '../api/client';
+import { INTEGRATION_URL, workspaceRef, apiFetch } from '../api/client';
 
 const presetDescriptions = [
   {
@@ -93,13 +93,13 @@ export const AIPrinciples: React.FC = () => {
     try {
       // Copy the preset policy file to the workspace specifications folder
       if (currentWorkspace.projectFolder) {
-        const response = await fetch(`${INTEGRATION_URL}/activate-ai-preset`, {
+        const response = await apiFetch(`${INTEGRATION_URL}/activate-ai-preset`, {
           method: 'POST',
           headers: {
             'Content-Type': 'application/json',
           },
           body: JSON.stringify({
-            workspacePath: currentWorkspace.projectFolder,
+            ...workspaceRef(currentWorkspace),
             presetNumber: selectedPreset,
           }),
         });
@@ -5,7 +5,7 @@ import { ApprovalSection } from '../components/ApprovalSection';
 import { StageBadge, ApprovalStatusBadge } from '../components/ApprovalStatusBadge';
 import { useWorkspace } from '../context/WorkspaceContext';
 import { useApproval } from '../context/ApprovalContext';
-import { INTEGRATION_URL } from '../api/client';
+import { INTEGRATION_URL, workspaceRef, apiFetch } from '../api/client';
 import type {
   Capability,
   CapabilityWithDetails,
@@ -115,13 +115,13 @@ export const Capabilities: React.FC = () => {
 
     setLoadingFiles(true);
     try {
-      const response = await fetch(`${INTEGRATION_URL}/capability-files`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/capability-files`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
-          workspacePath: currentWorkspace.projectFolder,
+          ...workspaceRef(currentWorkspace),
         }),
       });
 
@@ -151,12 +151,13 @@ export const Capabilities: React.FC = () => {
 
     setSavingCapability(true);
     try {
-      const response = await fetch(`${INTEGRATION_URL}/save-capability`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/save-capability`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
+          workspaceId: currentWorkspace?.serverId,
           path: selectedFileCapability.path,
           name: editFormData.name,
           description: editFormData.description,
@@ -200,12 +201,13 @@ export const Capabilities: React.FC = () => {
 
     setDeletingCapability(true);
     try {
-      const response = await fetch(`${INTEGRATION_URL}/delete-capability`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/delete-capability`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
+          workspaceId: currentWorkspace?.serverId,
           path: cap.path,
         }),
       });
@@ -240,8 +242,10 @@ export const Capabilities: React.FC = () => {
 
     try {
       // First, get the list of specification files
-      const listUrl = `${INTEGRATION_URL}/specifications/list?workspace=${encodeURIComponent(currentWorkspace.projectFolder)}`;
-      const listResponse = await fetch(listUrl);
+      const listParams = new URLSearchParams({ workspace: currentWorkspace.projectFolder });
+      if (currentWorkspace.serverId) listParams.set('workspaceId', String(currentWorkspace.serverId));
+      const listUrl = `${INTEGRATION_URL}/specifications/list?${listParams}`;
+      const listResponse = await apiFetch(listUrl);
 
       if (!listResponse.ok) {
         throw new Error('Failed to list specifications');
@@ -264,7 +268,7 @@ export const Capabilities: React.FC = () => {
       }
 
       // Analyze with Claude to suggest capabilities
-      const response = await fetch(`${INTEGRATION_URL}/analyze-capabilities`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/analyze-capabilities`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
@@ -326,13 +330,13 @@ export const Capabilities: React.FC = () => {
     markdown += `- [ ] TODO: Define acceptance criteria\n`;
 
     try {
-      const response = await fetch(`${INTEGRATION_URL}/save-specifications`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/save-specifications`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
-          workspacePath: currentWorkspace.projectFolder,
+          ...workspaceRef(currentWorkspace),
           files: [{ fileName, content: markdown }],
           subfolder: 'definition'
         }),
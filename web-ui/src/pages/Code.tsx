@@ -4,7 +4,7 @@ import { Card } from '../components/Card';
 import { useWorkspace } from '../context/WorkspaceContext';
 import { AIPresetIndicator } from '../components/AIPresetIndicator';
 import { UIFrameworkIndicator } from '../components/UIFrameworkIndicator';
-import { INTEGRATION_URL } from '../api/client';
+import { INTEGRATION_URL, workspaceRef, apiFetch } from '../api/client';
 
 interface CodeFile {
   name: string;
@@ -43,8 +43,19 @@ export const Code: React.FC = () => {
     return saved ? JSON.parse(saved) : [];
   });
   const abortControllerRef = useRef<AbortController | null>(null);
+  const jobIdRef = useRef<number | null>(null);
   const logEndRef = useRef<HTMLDivElement>(null);
 
+  // The Claude CLI session of the last run in this workspace, so the next run can continue it
+  const sessionKey = `code_generation_session_${currentWorkspace?.projectFolder || ''}`;
+  const [sessionId, setSessionId] = useState<string>('');
+  const [continueSession, setContinueSession] = useState(false);
+
+  useEffect(() => {
+    setSessionId(localStorage.getItem(sessionKey) || '');
+    setContinueSession(false);
+  }, [sessionKey]);
+
   const addLog = (type: LogEntry['type'], message: string) => {
     const timestamp = new Date().toLocaleTimeString();
     setLogs(prev => {
@@ -63,17 +74,59 @@ export const Code: React.FC = () => {
     localStorage.removeItem('code_generation_logs');
   };
 
+  // Follows a job's Server-Sent Events, logging what the CLI does, and returns the job once
+  // it has finished
+  const followJob = async (jobId: number, signal: AbortSignal): Promise<any> => {
+    const response = await apiFetch(`${INTEGRATION_URL}/jobs/${jobId}/events`, { signal });
+    if (!response.ok || !response.body) {
+      throw new Error(`Failed to follow job ${jobId}: ${response.status} ${response.statusText}`);
+    }
+
+    const reader = response.body.getReader();
+    const decoder = new TextDecoder();
+    let buffer = '';
+    let job: any = null;
+    for (;;) {
+      const { done, value } = await reader.read();
+      if (done) break;
+      buffer += decoder.decode(value, { stream: true });
+
+      let end = buffer.indexOf('\n\n');
+      while (end !== -1) {
+        const message = buffer.slice(0, end);
+        buffer = buffer.slice(end + 2);
+        end = buffer.indexOf('\n\n');
+
+        let event = 'message';
+        let data = '';
+        for (const line of message.split('\n')) {
+          if (line.startsWith('event: ')) event = line.slice(7);
+          else if (line.startsWith('data: ')) data += line.slice(6);
+        }
+        if (!data) continue;
+
+        const payload = JSON.parse(data);
+        if (event === 'log') {
+          addLog(payload.level === 'info' ? 'info' : 'error', payload.message);
+        } else if (event === 'status') {
+          job = payload;
+        }
+      }
+    }
+    return job;
+  };
+
   const fetchCodeFiles = async () => {
     if (!currentWorkspace?.projectFolder) return;
 
     try {
-      const response = await fetch(`${INTEGRATION_URL}/code-files`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/code-files`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
-          workspacePath: currentWorkspace.projectFolder,
+          ...workspaceRef(currentWorkspace),
         }),
       });
 
@@ -184,22 +237,44 @@ export const Code: React.FC = () => {
       addLog('info', 'Sending request to /generate-code-cli endpoint...');
       addLog('info', 'Using Claude CLI for code generation (no API key required)');
 
-      const response = await fetch(`${INTEGRATION_URL}/generate-code-cli`, {
+      if (continueSession && sessionId) {
+        addLog('info', `Continuing Claude CLI session ${sessionId}`);
+      }
+
+      // Ask for the job back at once and follow its progress instead of waiting blind
+      const response = await apiFetch(`${INTEGRATION_URL}/generate-code-cli`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
+          'Prefer': 'respond-async',
         },
         body: JSON.stringify({
-          workspacePath: currentWorkspace.projectFolder,
+          ...workspaceRef(currentWorkspace),
           command: cliCommand,
           additionalPrompt: additionalPrompt || '',
+          sessionId: continueSession && sessionId ? sessionId : undefined,
         }),
         signal: abortControllerRef.current.signal,
       });
 
       addLog('info', `Response status: ${response.status} ${response.statusText}`);
 
-      const data = await response.json();
+      let data = await response.json();
+      if (response.status === 202) {
+        jobIdRef.current = data.id;
+        addLog('info', `Queued as job ${data.id}`);
+        const job = await followJob(data.id, abortControllerRef.current.signal);
+        if (job && job.status === 'succeeded') {
+          data = job.result || {};
+        } else {
+          data = { error: job?.error || 'Code generation did not finish.' };
+        }
+      }
+
+      if (data.sessionId) {
+        setSessionId(data.sessionId);
+        localStorage.setItem(sessionKey, data.sessionId);
+      }
 
       if (data.error) {
         setError(data.error);
@@ -223,10 +298,14 @@ export const Code: React.FC = () => {
     } finally {
       setIsGenerating(false);
       abortControllerRef.current = null;
+      jobIdRef.current = null;
     }
   };
 
   const handleStop = () => {
+    if (jobIdRef.current !== null) {
+      apiFetch(`${INTEGRATION_URL}/jobs/${jobIdRef.current}/cancel`, { method: 'POST' }).catch(() => undefined);
+    }
     if (abortControllerRef.current) {
       abortControllerRef.current.abort();
       addLog('info', 'Stopping code generation...');
@@ -305,6 +384,20 @@ export const Code: React.FC = () => {
             </p>
           </div>
 
+          {sessionId && (
+            <div className="mb-4">
+              <label className="flex items-center gap-2 text-sm">
+                <input
+                  type="checkbox"
+                  checked={continueSession}
+                  onChange={(e) => setContinueSession(e.target.checked)}
+                  disabled={isGenerating}
+                />
+                Continue the previous Claude CLI session, keeping its context
+              </label>
+            </div>
+          )}
+
           <div className="flex gap-4">
             <Button
               onClick={handleGenerateCode}
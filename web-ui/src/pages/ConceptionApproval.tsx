@@ -2,7 +2,7 @@ import React, { useState, useEffect } from 'react';
 import { useNavigate } from 'react-router-dom';
 import { Card, Alert, Button } from '../components';
 import { useWorkspace } from '../context/WorkspaceContext';
-import { INTEGRATION_URL } from '../api/client';
+import { INTEGRATION_URL, workspaceRef, apiFetch } from '../api/client';
 
 interface ConceptionItem {
   id: string;
@@ -86,10 +86,10 @@ export const ConceptionApproval: React.FC = () => {
     try {
       // Load vision items (using theme-files endpoint which handles VIS-*, VISION-*, THEME-* files)
       console.log('Fetching theme-files with workspacePath:', currentWorkspace.projectFolder);
-      const visionResponse = await fetch(`${INTEGRATION_URL}/theme-files`, {
+      const visionResponse = await apiFetch(`${INTEGRATION_URL}/theme-files`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ workspacePath: currentWorkspace.projectFolder }),
+        body: JSON.stringify(workspaceRef(currentWorkspace)),
       });
       const visionData = await visionResponse.json();
       console.log('Vision data received:', visionData);
@@ -104,10 +104,10 @@ export const ConceptionApproval: React.FC = () => {
       }));
 
       // Load ideation items (using ideation-files endpoint which handles IDEA-* files)
-      const ideationResponse = await fetch(`${INTEGRATION_URL}/ideation-files`, {
+      const ideationResponse = await apiFetch(`${INTEGRATION_URL}/ideation-files`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ workspacePath: currentWorkspace.projectFolder }),
+        body: JSON.stringify(workspaceRef(currentWorkspace)),
       });
       const ideationData = await ideationResponse.json();
       console.log('Ideation data received:', ideationData);
@@ -122,10 +122,10 @@ export const ConceptionApproval: React.FC = () => {
       }));
 
       // Load storyboard items (using story-files endpoint which handles story*, STORY*, SB-* files)
-      const storyboardResponse = await fetch(`${INTEGRATION_URL}/story-files`, {
+      const storyboardResponse = await apiFetch(`${INTEGRATION_URL}/story-files`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ workspacePath: currentWorkspace.projectFolder }),
+        body: JSON.stringify(workspaceRef(currentWorkspace)),
       });
       const storyboardData = await storyboardResponse.json();
       console.log('Storyboard data received:', storyboardData);
@@ -3,7 +3,7 @@ import { useNavigate } from 'react-router-dom';
 import { Card, Button } from '../components';
 import { useWorkspace, type Workspace } from '../context/WorkspaceContext';
 import { useAuth } from '../context/AuthContext';
-import { INTEGRATION_URL } from '../api/client';
+import { INTEGRATION_URL, workspaceRef, apiFetch } from '../api/client';
 
 interface FileCapability {
   filename: string;
@@ -77,10 +77,10 @@ export const Dashboard: React.FC = () => {
       }
 
       try {
-        const response = await fetch(`${INTEGRATION_URL}/capability-files`, {
+        const response = await apiFetch(`${INTEGRATION_URL}/capability-files`, {
           method: 'POST',
           headers: { 'Content-Type': 'application/json' },
-          body: JSON.stringify({ workspacePath: workspace.projectFolder }),
+          body: JSON.stringify(workspaceRef(workspace)),
         });
         const data = await response.json();
         const capabilities = data.capabilities || [];
@@ -2,7 +2,7 @@ import React, { useState, useEffect } from 'react';
 import { useNavigate } from 'react-router-dom';
 import { Card, Alert, Button } from '../components';
 import { useWorkspace } from '../context/WorkspaceContext';
-import { INTEGRATION_URL } from '../api/client';
+import { INTEGRATION_URL, workspaceRef, apiFetch } from '../api/client';
 
 interface DefinitionItem {
   id: string;
@@ -79,10 +79,10 @@ export const DefinitionApproval: React.FC = () => {
     setLoading(true);
     try {
       // Load capability items
-      const capabilityResponse = await fetch(`${INTEGRATION_URL}/capability-files`, {
+      const capabilityResponse = await apiFetch(`${INTEGRATION_URL}/capability-files`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ workspacePath: currentWorkspace.projectFolder }),
+        body: JSON.stringify(workspaceRef(currentWorkspace)),
       });
       const capabilityData = await capabilityResponse.json();
       const capabilityItems: DefinitionItem[] = (capabilityData.capabilities || []).map((c: any) => ({
@@ -96,10 +96,10 @@ export const DefinitionApproval: React.FC = () => {
       }));
 
       // Load enabler items
-      const enablerResponse = await fetch(`${INTEGRATION_URL}/enabler-files`, {
+      const enablerResponse = await apiFetch(`${INTEGRATION_URL}/enabler-files`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ workspacePath: currentWorkspace.projectFolder }),
+        body: JSON.stringify(workspaceRef(currentWorkspace)),
       });
       const enablerData = await enablerResponse.json();
       const enablerItems: DefinitionItem[] = (enablerData.enablers || []).map((e: any) => ({
@@ -3,7 +3,7 @@ import { useSearchParams } from 'react-router-dom';
 import { Card, Alert, Button, ConfirmDialog } from '../components';
 import { useEnabler } from '../context/EnablerContext';
 import { useWorkspace } from '../context/WorkspaceContext';
-import { INTEGRATION_URL } from '../api/client';
+import { INTEGRATION_URL, workspaceRef, apiFetch } from '../api/client';
 
 // File-based capability from workspace definition folder
 interface FileCapability {
@@ -255,13 +255,13 @@ export const Enablers: React.FC = () => {
 
     setLoadingCapabilities(true);
     try {
-      const response = await fetch(`${INTEGRATION_URL}/capability-files`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/capability-files`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
-          workspacePath: currentWorkspace.projectFolder,
+          ...workspaceRef(currentWorkspace),
         }),
       });
 
@@ -297,13 +297,13 @@ export const Enablers: React.FC = () => {
 
     setLoadingFileEnablers(true);
     try {
-      const response = await fetch(`${INTEGRATION_URL}/enabler-files`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/enabler-files`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
-          workspacePath: currentWorkspace.projectFolder,
+          ...workspaceRef(currentWorkspace),
         }),
       });
 
@@ -453,14 +453,14 @@ ${capabilityList}
 Which capability ID is the BEST match for this enabler?
 Respond with ONLY the capability ID (e.g., "CAP-123456") and nothing else. If no good match exists, respond with "NONE".`;
 
-      const response = await fetch(`${INTEGRATION_URL}/ai-chat`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/ai-chat`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
           message: prompt,
-          workspacePath: currentWorkspace.projectFolder,
+          ...workspaceRef(currentWorkspace),
           apiKey: localStorage.getItem('anthropic_api_key') || '',
         }),
       });
@@ -589,13 +589,13 @@ Respond with ONLY the capability ID (e.g., "CAP-123456") and nothing else. If no
       markdown += `## Acceptance Criteria\n_No acceptance criteria defined yet._\n`;
 
       // Save to definition folder
-      const response = await fetch(`${INTEGRATION_URL}/save-specifications`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/save-specifications`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
-          workspacePath: currentWorkspace.projectFolder,
+          ...workspaceRef(currentWorkspace),
           files: [{ fileName, content: markdown }],
           subfolder: 'definition'
         }),
@@ -629,12 +629,13 @@ Respond with ONLY the capability ID (e.g., "CAP-123456") and nothing else. If no
       onConfirm: async () => {
         closeConfirmDialog();
         try {
-          const response = await fetch(`${INTEGRATION_URL}/delete-specification`, {
+          const response = await apiFetch(`${INTEGRATION_URL}/delete-specification`, {
             method: 'POST',
             headers: {
               'Content-Type': 'application/json',
             },
             body: JSON.stringify({
+              workspaceId: currentWorkspace?.serverId,
               path: enabler.path,
             }),
           });
@@ -1,7 +1,7 @@
 import React, { useState, useEffect } from 'react';
 import { Card, Alert, Button, AIPresetIndicator } from '../components';
 import { useWorkspace } from '../context/WorkspaceContext';
-import { INTEGRATION_URL } from '../api/client';
+import { INTEGRATION_URL, workspaceRef, apiFetch } from '../api/client';
 
 interface FileFeature {
   filename: string;
@@ -51,13 +51,13 @@ export const Features: React.FC = () => {
 
     setLoading(true);
     try {
-      const response = await fetch(`${INTEGRATION_URL}/feature-files`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/feature-files`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
-          workspacePath: currentWorkspace.projectFolder,
+          ...workspaceRef(currentWorkspace),
         }),
       });
 
@@ -113,12 +113,13 @@ export const Features: React.FC = () => {
         path = `${currentWorkspace.projectFolder}/specifications/${fileName}`;
       }
 
-      const response = await fetch(`${INTEGRATION_URL}/save-feature`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/save-feature`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
+          workspaceId: currentWorkspace?.serverId,
           path,
           name: editFormData.name,
           description: editFormData.description,
@@ -152,12 +153,13 @@ export const Features: React.FC = () => {
 
     setDeletingFeature(true);
     try {
-      const response = await fetch(`${INTEGRATION_URL}/delete-feature`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/delete-feature`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
+          workspaceId: currentWorkspace?.serverId,
           path: feature.path,
         }),
       });
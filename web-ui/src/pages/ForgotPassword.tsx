@@ -0,0 +1,80 @@
+import React, { useState } from 'react';
+import { Link } from 'react-router-dom';
+import { useAuth } from '../context/AuthContext';
+
+export const ForgotPassword: React.FC = () => {
+  const [email, setEmail] = useState('');
+  const [error, setError] = useState<string | null>(null);
+  const [sent, setSent] = useState(false);
+  const [submitting, setSubmitting] = useState(false);
+  const { requestPasswordReset } = useAuth();
+
+  const handleSubmit = async (e: React.FormEvent): Promise<void> => {
+    e.preventDefault();
+    setError(null);
+    setSubmitting(true);
+    try {
+      await requestPasswordReset(email);
+      setSent(true);
+    } catch (err) {
+      setError(err instanceof Error ? err.message : 'Failed to request a password reset');
+    } finally {
+      setSubmitting(false);
+    }
+  };
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gradient-to-br from-indigo-50 via-white to-purple-50">
+      <div className="card w-full max-w-md mx-4">
+        <div className="flex flex-col space-y-1.5 p-6">
+          <h3 className="text-grey-900 text-center text-2xl font-semibold">Reset your password</h3>
+          <p className="text-sm text-grey-500 text-center">
+            Enter your account email and we'll send you a link to choose a new password.
+          </p>
+        </div>
+
+        <div className="p-6 pt-0">
+          {sent ? (
+            <div className="p-3 rounded-lg bg-green-50 border border-green-200 text-green-700 text-sm">
+              If an account exists for {email}, a reset link is on its way. The link expires in one hour.
+            </div>
+          ) : (
+            <form className="space-y-4" onSubmit={handleSubmit}>
+              {error && (
+                <div className="p-3 rounded-lg bg-red-50 border border-red-200 text-red-700 text-sm">
+                  {error}
+                </div>
+              )}
+
+              <div className="space-y-2">
+                <label className="label" htmlFor="email">
+                  Email
+                </label>
+                <input
+                  type="email"
+                  className="input"
+                  id="email"
+                  placeholder="designer@example.com"
+                  required
+                  value={email}
+                  onChange={(e) => setEmail(e.target.value)}
+                  disabled={submitting}
+                />
+              </div>
+
+              <button className="btn btn-primary w-full" type="submit" disabled={submitting || !email}>
+                {submitting ? 'Sending...' : 'Send reset link'}
+              </button>
+            </form>
+          )}
+
+          <div className="text-center mt-6">
+            <Link to="/login" className="text-sm text-indigo-600 hover:text-indigo-500 font-medium">
+              Back to sign in
+            </Link>
+          </div>
+        </div>
+      </div>
+    </div>
+  );
+};
@@ -35,7 +35,12 @@ export const GoogleCallback: React.FC = () => {
       }
 
       try {
-        await handleGoogleCallback(code, state);
+        const challenge = await handleGoogleCallback(code, state);
+        if (challenge) {
+          // The second factor is entered on the login page
+          navigate('/login', { state: { mfa: challenge } });
+          return;
+        }
         // Redirect to home page on success
         navigate('/');
       } catch (err) {
@@ -5,7 +5,7 @@ import { useCollaboration } from '../context/CollaborationContext';
 import RemoteCursors from '../components/RemoteCursors';
 import { AssetsPane, WorkspaceHeader, AIPresetIndicator } from '../components';
 import { Button } from '../components/Button';
-import { SPEC_URL } from '../api/client';
+import { SPEC_URL, apiFetch } from '../api/client';
 
 interface CardImage {
   id: string;
@@ -810,7 +810,7 @@ export const Ideation: React.FC = () => {
       }
 
       // Send to backend to save files in workspace conception folder
-      const response = await fetch(`${SPEC_URL}/save-specifications`, {
+      const response = await apiFetch(`${SPEC_URL}/save-specifications`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
@@ -848,7 +848,7 @@ export const Ideation: React.FC = () => {
   const handleAnalyzeIdeation = async (silent: boolean = false) => {
     try {
       // Read IDEA-*.md files from conception folder
-      const response = await fetch(`${SPEC_URL}/read-specifications`, {
+      const response = await apiFetch(`${SPEC_URL}/read-specifications`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
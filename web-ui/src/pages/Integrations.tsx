@@ -1,7 +1,6 @@
 import React, { useState } from 'react';
 import { Card, Alert, Button, AIPresetIndicator } from '../components';
-import axios from 'axios';
-import { INTEGRATION_URL } from '../api/client';
+import { integrationClient } from '../api/client';
 
 interface IntegrationConfig {
   name: string;
@@ -143,11 +142,11 @@ export const Integrations: React.FC = () => {
       }
 
       // Call the integration analysis endpoint
-      const response = await axios.post(`${INTEGRATION_URL}/analyze-integration`, {
+      const response = await integrationClient.post('/analyze-integration', {
         provider_url: url,
         provider_name: name,
         anthropic_key: anthropicKey
-      });
+      }, { timeout: 0 });
 
       // Cache the analysis
       localStorage.setItem(cacheKey, JSON.stringify(response.data));
@@ -1,14 +1,25 @@
-import React, { useState } from 'react';
-import { useNavigate } from 'react-router-dom';
-import { useAuth } from '../context/AuthContext';
+import React, { useEffect, useState } from 'react';
+import { Link, useLocation, useNavigate } from 'react-router-dom';
+import { useAuth, type MFAChallenge, type SSOProvider } from '../context/AuthContext';
+import { MFAStep } from '../components/MFAStep';
 
 export const Login: React.FC = () => {
   const [email, setEmail] = useState('');
   const [password, setPassword] = useState('');
   const [error, setError] = useState<string | null>(null);
-  const { login, loginWithGoogle, isLoading } = useAuth();
+  const [ssoProviders, setSSOProviders] = useState<SSOProvider[]>([]);
+  const location = useLocation();
+  // SSO callbacks hand over their MFA challenge through navigation state
+  const [challenge, setChallenge] = useState<MFAChallenge | null>(
+    (location.state as { mfa?: MFAChallenge } | null)?.mfa ?? null
+  );
+  const { login, loginWithGoogle, getSSOProviders, loginWithSSO, isLoading } = useAuth();
   const navigate = useNavigate();
 
+  useEffect(() => {
+    getSSOProviders().then((providers) => setSSOProviders(providers.filter((p) => p.type === 'oidc')));
+  }, [getSSOProviders]);
+
   const handleSubmit = async (e: React.FormEvent): Promise<void> => {
     e.preventDefault();
     setError(null);
@@ -30,7 +41,11 @@ export const Login: React.FC = () => {
     }
 
     try {
-      await login(email, password);
+      const mfa = await login(email, password);
+      if (mfa) {
+        setChallenge(mfa);
+        return;
+      }
       navigate('/');
     } catch (err) {
       setError(err instanceof Error ? err.message : 'Login failed');
@@ -47,6 +62,15 @@ export const Login: React.FC = () => {
     }
   };
 
+  const handleSSOLogin = async (providerId: string): Promise<void> => {
+    setError(null);
+    try {
+      await loginWithSSO(providerId);
+    } catch (err) {
+      setError(err instanceof Error ? err.message : 'Single sign-on failed');
+    }
+  };
+
   return (
     <div className="min-h-screen flex items-center justify-center bg-gradient-to-br from-indigo-50 via-white to-purple-50">
       <div className="card w-full max-w-md mx-4">
@@ -75,6 +99,13 @@ export const Login: React.FC = () => {
 
         {/* Card Content */}
         <div className="p-6 pt-0">
+          {challenge ? (
+            <MFAStep
+              challenge={challenge}
+              onComplete={() => navigate('/')}
+              onCancel={() => setChallenge(null)}
+            />
+          ) : (
           <form className="space-y-4" onSubmit={handleSubmit}>
             {error && (
               <div className="p-3 rounded-lg bg-red-50 border border-red-200 text-red-700 text-sm">
@@ -112,6 +143,11 @@ export const Login: React.FC = () => {
                 onChange={(e) => setPassword(e.target.value)}
                 disabled={isLoading}
               />
+              <div className="text-right">
+                <Link to="/forgot-password" className="text-sm text-indigo-600 hover:text-indigo-500 font-medium">
+                  Forgot password?
+                </Link>
+              </div>
             </div>
 
             <button
@@ -160,6 +196,28 @@ export const Login: React.FC = () => {
               </span>
             </button>
 
+            {ssoProviders.map((provider) => (
+              <button
+                key={provider.id}
+                type="button"
+                onClick={() => handleSSOLogin(provider.id)}
+                disabled={isLoading}
+                className="w-full mt-3 flex items-center justify-center gap-3 px-4 py-2 border border-gray-300 rounded-lg shadow-sm bg-white hover:bg-gray-50 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-indigo-500 transition-colors disabled:opacity-50 disabled:cursor-not-allowed"
+              >
+                <svg className="w-5 h-5 text-indigo-600" fill="none" stroke="currentColor" viewBox="0 0 24 24">
+                  <path
+                    strokeLinecap="round"
+                    strokeLinejoin="round"
+                    strokeWidth="2"
+                    d="M12 15v2m-6 4h12a2 2 0 002-2v-6a2 2 0 00-2-2H6a2 2 0 00-2 2v6a2 2 0 002 2zm10-10V7a4 4 0 00-8 0v4h8z"
+                  />
+                </svg>
+                <span className="text-sm font-medium text-gray-700">
+                  Sign in with {provider.name}
+                </span>
+              </button>
+            ))}
+
             <div className="text-center mt-6">
               <button
                 type="button"
@@ -169,6 +227,7 @@ export const Login: React.FC = () => {
               </button>
             </div>
           </form>
+          )}
         </div>
       </div>
     </div>
@@ -0,0 +1,139 @@
+import React, { useEffect, useState } from 'react';
+import { Link, useNavigate, useSearchParams } from 'react-router-dom';
+import { useAuth } from '../context/AuthContext';
+import { authClient } from '../api/client';
+
+interface PasswordPolicy {
+  minLength: number;
+  requireUpper: boolean;
+  requireLower: boolean;
+  requireDigit: boolean;
+  requireSymbol: boolean;
+}
+
+// describePolicy lists the rules shown under the password field
+const describePolicy = (policy: PasswordPolicy): string[] => {
+  const rules = [`At least ${policy.minLength} characters`];
+  if (policy.requireUpper) rules.push('An uppercase letter');
+  if (policy.requireLower) rules.push('A lowercase letter');
+  if (policy.requireDigit) rules.push('A digit');
+  if (policy.requireSymbol) rules.push('A symbol');
+  return rules;
+};
+
+export const ResetPassword: React.FC = () => {
+  const [searchParams] = useSearchParams();
+  const token = searchParams.get('token') || '';
+  const [password, setPassword] = useState('');
+  const [confirm, setConfirm] = useState('');
+  const [policy, setPolicy] = useState<PasswordPolicy | null>(null);
+  const [error, setError] = useState<string | null>(null);
+  const [submitting, setSubmitting] = useState(false);
+  const { resetPassword } = useAuth();
+  const navigate = useNavigate();
+
+  useEffect(() => {
+    authClient
+      .get('/api/auth/password/policy')
+      .then((response) => setPolicy(response.data))
+      .catch(() => setPolicy(null));
+  }, []);
+
+  const handleSubmit = async (e: React.FormEvent): Promise<void> => {
+    e.preventDefault();
+    setError(null);
+
+    if (password !== confirm) {
+      setError('Passwords do not match');
+      return;
+    }
+
+    setSubmitting(true);
+    try {
+      await resetPassword(token, password);
+      navigate('/login', { replace: true });
+    } catch (err) {
+      setError(err instanceof Error ? err.message : 'Failed to reset password');
+    } finally {
+      setSubmitting(false);
+    }
+  };
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gradient-to-br from-indigo-50 via-white to-purple-50">
+      <div className="card w-full max-w-md mx-4">
+        <div className="flex flex-col space-y-1.5 p-6">
+          <h3 className="text-grey-900 text-center text-2xl font-semibold">Choose a new password</h3>
+          <p className="text-sm text-grey-500 text-center">
+            Setting a new password signs you out of all other sessions.
+          </p>
+        </div>
+
+        <div className="p-6 pt-0">
+          {!token ? (
+            <div className="p-3 rounded-lg bg-red-50 border border-red-200 text-red-700 text-sm">
+              This reset link is incomplete. Request a new one from the sign-in page.
+            </div>
+          ) : (
+            <form className="space-y-4" onSubmit={handleSubmit}>
+              {error && (
+                <div className="p-3 rounded-lg bg-red-50 border border-red-200 text-red-700 text-sm">
+                  {error}
+                </div>
+              )}
+
+              <div className="space-y-2">
+                <label className="label" htmlFor="password">
+                  New password
+                </label>
+                <input
+                  type="password"
+                  className="input"
+                  id="password"
+                  autoComplete="new-password"
+                  required
+                  value={password}
+                  onChange={(e) => setPassword(e.target.value)}
+                  disabled={submitting}
+                />
+                {policy && (
+                  <ul className="text-xs text-grey-500 list-disc list-inside">
+                    {describePolicy(policy).map((rule) => (
+                      <li key={rule}>{rule}</li>
+                    ))}
+                  </ul>
+                )}
+              </div>
+
+              <div className="space-y-2">
+                <label className="label" htmlFor="confirm">
+                  Confirm password
+                </label>
+                <input
+                  type="password"
+                  className="input"
+                  id="confirm"
+                  autoComplete="new-password"
+                  required
+                  value={confirm}
+                  onChange={(e) => setConfirm(e.target.value)}
+                  disabled={submitting}
+                />
+              </div>
+
+              <button className="btn btn-primary w-full" type="submit" disabled={submitting}>
+                {submitting ? 'Saving...' : 'Set password'}
+              </button>
+            </form>
+          )}
+
+          <div className="text-center mt-6">
+            <Link to="/forgot-password" className="text-sm text-indigo-600 hover:text-indigo-500 font-medium">
+              Request a new link
+            </Link>
+          </div>
+        </div>
+      </div>
+    </div>
+  );
+};
@@ -4,7 +4,7 @@ import { Card } from '../components/Card';
 import { useWorkspace } from '../context/WorkspaceContext';
 import { AIPresetIndicator } from '../components/AIPresetIndicator';
 import { UIFrameworkIndicator } from '../components/UIFrameworkIndicator';
-import { INTEGRATION_URL } from '../api/client';
+import { INTEGRATION_URL, workspaceRef, apiFetch } from '../api/client';
 
 interface RunStep {
   step: number;
@@ -40,13 +40,13 @@ export const Run: React.FC = () => {
     ]);
 
     try {
-      const response = await fetch(`${INTEGRATION_URL}/run-app`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/run-app`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
-          workspacePath: currentWorkspace.projectFolder,
+          ...workspaceRef(currentWorkspace),
         }),
       });
 
@@ -95,13 +95,13 @@ export const Run: React.FC = () => {
     if (!currentWorkspace?.projectFolder) return;
 
     try {
-      const response = await fetch(`${INTEGRATION_URL}/stop-app`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/stop-app`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
-          workspacePath: currentWorkspace.projectFolder,
+          ...workspaceRef(currentWorkspace),
         }),
       });
 
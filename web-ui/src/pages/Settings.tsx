@@ -4,7 +4,7 @@ import { Button } from '../components/Button';
 import { useTheme } from '../context/ThemeContext';
 import { Alert } from '../components/Alert';
 import { useAuth } from '../context/AuthContext';
-import { AIPresetIndicator, ConfirmDialog } from '../components';
+import { AIPresetIndicator, ConfirmDialog, TwoFactorSettings } from '../components';
 
 export const Settings: React.FC = () => {
   const { currentTheme, availableThemes, setTheme } = useTheme();
@@ -383,6 +383,8 @@ export const Settings: React.FC = () => {
           </div>
         </Card>
 
+        <TwoFactorSettings />
+
         {/* Developer Tools */}
         <Card>
           <h3 className="mb-2">Developer Tools</h3>
@@ -6,7 +6,7 @@ import { useCollaboration } from '../context/CollaborationContext';
 import RemoteCursors from '../components/RemoteCursors';
 import { AssetsPane } from '../components/AssetsPane';
 import { AIPresetIndicator, ConfirmDialog } from '../components';
-import { INTEGRATION_URL, SPEC_URL } from '../api/client';
+import { INTEGRATION_URL, SPEC_URL, workspaceRef, apiFetch } from '../api/client';
 
 export const Storyboard: React.FC = () => {
   const { currentWorkspace, updateStoryboard } = useWorkspace();
@@ -211,13 +211,13 @@ export const Storyboard: React.FC = () => {
 
     try {
       // Fetch STORY-*.md files from conception folder
-      const response = await fetch(`${INTEGRATION_URL}/read-storyboard-files`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/read-storyboard-files`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
-          workspacePath: currentWorkspace.projectFolder,
+          ...workspaceRef(currentWorkspace),
         }),
       });
 
@@ -439,13 +439,13 @@ export const Storyboard: React.FC = () => {
 
     try {
       // First try to load from existing storyboards-full.md
-      let response = await fetch(`${INTEGRATION_URL}/analyze-storyboard`, {
+      let response = await apiFetch(`${INTEGRATION_URL}/analyze-storyboard`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
-          workspacePath: currentWorkspace.projectFolder,
+          ...workspaceRef(currentWorkspace),
           forceRegenerate: false,
         }),
       });
@@ -462,13 +462,13 @@ export const Storyboard: React.FC = () => {
         }
 
         // Generate new analysis from STORY*.md, dependencies.md, site-architecture.md
-        response = await fetch(`${INTEGRATION_URL}/analyze-storyboard`, {
+        response = await apiFetch(`${INTEGRATION_URL}/analyze-storyboard`, {
           method: 'POST',
           headers: {
             'Content-Type': 'application/json',
           },
           body: JSON.stringify({
-            workspacePath: currentWorkspace.projectFolder,
+            ...workspaceRef(currentWorkspace),
             apiKey: apiKey,
             forceRegenerate: true,
           }),
@@ -1095,7 +1095,7 @@ export const Storyboard: React.FC = () => {
         // If the card was loaded from a file, delete the file first
         if (hasSourceFile && card?.sourceFileName) {
           try {
-            const response = await fetch(`${SPEC_URL}/delete-specification`, {
+            const response = await apiFetch(`${SPEC_URL}/delete-specification`, {
               method: 'POST',
               headers: {
                 'Content-Type': 'application/json',
@@ -1387,13 +1387,13 @@ export const Storyboard: React.FC = () => {
         throw new Error('Workspace project folder not configured');
       }
 
-      const response = await fetch(`${INTEGRATION_URL}/save-specifications`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/save-specifications`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
-          workspacePath: currentWorkspace.projectFolder,
+          ...workspaceRef(currentWorkspace),
           files,
           subfolder: 'conception'
         }),
@@ -3,7 +3,7 @@ import mermaid from 'mermaid';
 import { Button } from '../components/Button';
 import { AIPresetIndicator } from '../components/AIPresetIndicator';
 import { useWorkspace, type SystemCapability, type SystemEnabler } from '../context/WorkspaceContext';
-import { INTEGRATION_URL } from '../api/client';
+import { INTEGRATION_URL, workspaceRef, apiFetch } from '../api/client';
 
 // Initialize mermaid
 mermaid.initialize({
@@ -413,13 +413,13 @@ export const System: React.FC = () => {
 
       // Save files to definition folder (same folder as Import reads from)
       try {
-        const response = await fetch(`${INTEGRATION_URL}/save-specifications`, {
+        const response = await apiFetch(`${INTEGRATION_URL}/save-specifications`, {
           method: 'POST',
           headers: {
             'Content-Type': 'application/json',
           },
           body: JSON.stringify({
-            workspacePath: currentWorkspace.projectFolder,
+            ...workspaceRef(currentWorkspace),
             files,
             subfolder: 'definition'
           }),
@@ -474,13 +474,13 @@ export const System: React.FC = () => {
     markdown += '\n```\n';
 
     try {
-      const response = await fetch(`${INTEGRATION_URL}/save-specifications`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/save-specifications`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
-          workspacePath: currentWorkspace.projectFolder,
+          ...workspaceRef(currentWorkspace),
           subfolder: 'implementation',
           files: [{ fileName, content: markdown }],
         }),
@@ -512,13 +512,13 @@ export const System: React.FC = () => {
     const fileName = 'STATE-STATE-DIAGRAM-1.md';
 
     try {
-      const response = await fetch(`${INTEGRATION_URL}/read-specification`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/read-specification`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
-          workspacePath: currentWorkspace.projectFolder,
+          ...workspaceRef(currentWorkspace),
           subfolder: 'implementation',
           fileName,
         }),
@@ -557,13 +557,13 @@ export const System: React.FC = () => {
     const fileName = 'SEQ-SEQUENCE-DIAGRAM-1.md';
 
     try {
-      const response = await fetch(`${INTEGRATION_URL}/read-specification`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/read-specification`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
-          workspacePath: currentWorkspace.projectFolder,
+          ...workspaceRef(currentWorkspace),
           subfolder: 'implementation',
           fileName,
         }),
@@ -601,13 +601,13 @@ export const System: React.FC = () => {
     const fileName = 'DATA-DATA-MODEL-1.md';
 
     try {
-      const response = await fetch(`${INTEGRATION_URL}/read-specification`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/read-specification`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
-          workspacePath: currentWorkspace.projectFolder,
+          ...workspaceRef(currentWorkspace),
           subfolder: 'implementation',
           fileName,
         }),
@@ -645,13 +645,13 @@ export const System: React.FC = () => {
     const fileName = 'CLASS-CLASS-DIAGRAM-1.md';
 
     try {
-      const response = await fetch(`${INTEGRATION_URL}/read-specification`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/read-specification`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
-          workspacePath: currentWorkspace.projectFolder,
+          ...workspaceRef(currentWorkspace),
           subfolder: 'implementation',
           fileName,
         }),
@@ -786,13 +786,13 @@ export const System: React.FC = () => {
 
       // Save capabilities and enablers to definition folder
       if (definitionFiles.length > 0) {
-        const defResponse = await fetch(`${INTEGRATION_URL}/save-specifications`, {
+        const defResponse = await apiFetch(`${INTEGRATION_URL}/save-specifications`, {
           method: 'POST',
           headers: {
             'Content-Type': 'application/json',
           },
           body: JSON.stringify({
-            workspacePath: currentWorkspace.projectFolder,
+            ...workspaceRef(currentWorkspace),
             subfolder: 'definition',
             files: definitionFiles,
           }),
@@ -807,13 +807,13 @@ export const System: React.FC = () => {
 
       // Save diagrams to implementation folder
       if (implementationFiles.length > 0) {
-        const implResponse = await fetch(`${INTEGRATION_URL}/save-specifications`, {
+        const implResponse = await apiFetch(`${INTEGRATION_URL}/save-specifications`, {
           method: 'POST',
           headers: {
             'Content-Type': 'application/json',
           },
           body: JSON.stringify({
-            workspacePath: currentWorkspace.projectFolder,
+            ...workspaceRef(currentWorkspace),
             subfolder: 'implementation',
             files: implementationFiles,
           }),
@@ -988,17 +988,17 @@ export const System: React.FC = () => {
       console.log('[System] Fetching capabilities and enablers from definition folder...');
 
       // Fetch capabilities from definition folder
-      const capResponse = await fetch(`${INTEGRATION_URL}/capability-files`, {
+      const capResponse = await apiFetch(`${INTEGRATION_URL}/capability-files`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ workspacePath: currentWorkspace.projectFolder }),
+        body: JSON.stringify(workspaceRef(currentWorkspace)),
       });
 
       // Fetch enablers from definition folder
-      const enbResponse = await fetch(`${INTEGRATION_URL}/enabler-files`, {
+      const enbResponse = await apiFetch(`${INTEGRATION_URL}/enabler-files`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ workspacePath: currentWorkspace.projectFolder }),
+        body: JSON.stringify(workspaceRef(currentWorkspace)),
       });
 
       const capData = await capResponse.json();
@@ -1335,16 +1335,16 @@ export const System: React.FC = () => {
 
     try {
       // Fetch capabilities and enablers from definition folder
-      const capResponse = await fetch(`${INTEGRATION_URL}/capability-files`, {
+      const capResponse = await apiFetch(`${INTEGRATION_URL}/capability-files`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ workspacePath: currentWorkspace.projectFolder }),
+        body: JSON.stringify(workspaceRef(currentWorkspace)),
       });
 
-      const enbResponse = await fetch(`${INTEGRATION_URL}/enabler-files`, {
+      const enbResponse = await apiFetch(`${INTEGRATION_URL}/enabler-files`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ workspacePath: currentWorkspace.projectFolder }),
+        body: JSON.stringify(workspaceRef(currentWorkspace)),
       });
 
       const capData = await capResponse.json();
@@ -1374,7 +1374,7 @@ export const System: React.FC = () => {
       console.log('[System] Sending', files.length, 'files to Claude for AI analysis...');
 
       // Send to AI for analysis
-      const analyzeResponse = await fetch(`${INTEGRATION_URL}/specifications/analyze`, {
+      const analyzeResponse = await apiFetch(`${INTEGRATION_URL}/specifications/analyze`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({
@@ -1628,17 +1628,17 @@ export const System: React.FC = () => {
       console.log('[System] Generating diagram - fetching from definition folder...');
 
       // Fetch capabilities from definition folder
-      const capResponse = await fetch(`${INTEGRATION_URL}/capability-files`, {
+      const capResponse = await apiFetch(`${INTEGRATION_URL}/capability-files`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ workspacePath: currentWorkspace.projectFolder }),
+        body: JSON.stringify(workspaceRef(currentWorkspace)),
       });
 
       // Fetch enablers from definition folder
-      const enbResponse = await fetch(`${INTEGRATION_URL}/enabler-files`, {
+      const enbResponse = await apiFetch(`${INTEGRATION_URL}/enabler-files`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ workspacePath: currentWorkspace.projectFolder }),
+        body: JSON.stringify(workspaceRef(currentWorkspace)),
       });
 
       const capData = await capResponse.json();
@@ -1718,7 +1718,7 @@ export const System: React.FC = () => {
       };
 
       // Call backend to generate diagram
-      const generateResponse = await fetch(`${INTEGRATION_URL}/specifications/generate-diagram`, {
+      const generateResponse = await apiFetch(`${INTEGRATION_URL}/specifications/generate-diagram`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
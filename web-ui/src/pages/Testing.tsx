@@ -1,7 +1,7 @@
 import React, { useState, useEffect, useCallback } from 'react';
 import { Card, Alert, Button, ConfirmDialog } from '../components';
 import { useWorkspace } from '../context/WorkspaceContext';
-import { INTEGRATION_URL } from '../api/client';
+import { INTEGRATION_URL, workspaceRef, apiFetch } from '../api/client';
 
 // Test Scenario interface
 interface TestScenario {
@@ -115,10 +115,10 @@ Scenario: [Scenario Name]
     setError(null);
 
     try {
-      const response = await fetch(`${INTEGRATION_URL}/enabler-files`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/enabler-files`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ workspacePath: currentWorkspace.projectFolder }),
+        body: JSON.stringify(workspaceRef(currentWorkspace)),
       });
 
       if (!response.ok) {
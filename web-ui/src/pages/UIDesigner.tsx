@@ -4,7 +4,7 @@ import { Button } from '../components/Button';
 import { useWorkspace } from '../context/WorkspaceContext';
 import { AIPresetIndicator } from '../components/AIPresetIndicator';
 import { UIFrameworkIndicator } from '../components/UIFrameworkIndicator';
-import { INTEGRATION_URL } from '../api/client';
+import { INTEGRATION_URL, workspaceRef, apiFetch } from '../api/client';
 
 type ComponentType = 'button' | 'card' | 'input' | 'alert' | 'navbar' | 'avatar' | 'progress' | 'toggle';
 type ImageFormat = 'png' | 'jpeg' | 'svg';
@@ -348,13 +348,13 @@ export const UIDesigner: React.FC = () => {
     markdown += '\n```\n';
 
     try {
-      const response = await fetch(`${INTEGRATION_URL}/save-specifications`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/save-specifications`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
-          workspacePath: currentWorkspace.projectFolder,
+          ...workspaceRef(currentWorkspace),
           files: [{ fileName, content: markdown }],
           subfolder: 'design'
         }),
@@ -519,13 +519,13 @@ ${xmlEscaped}
       });
 
       // Save via backend
-      const response = await fetch(`${INTEGRATION_URL}/save-image`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/save-image`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
-          workspacePath: currentWorkspace.projectFolder,
+          ...workspaceRef(currentWorkspace),
           fileName,
           imageData: base64,
           mimeType,
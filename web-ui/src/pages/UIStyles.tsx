@@ -2,8 +2,7 @@ import React, { useState, useEffect } from 'react';
 import { Button } from '../components/Button';
 import { AIPresetIndicator } from '../components/AIPresetIndicator';
 import { useWorkspace } from '../context/WorkspaceContext';
-import axios from 'axios';
-import { SPEC_URL } from '../api/client';
+import { specClient } from '../api/client';
 
 interface ColorConfig {
   name: string;
@@ -1604,7 +1603,7 @@ This UI Style specification should be used in conjunction with the active UI Fra
       const fileName = 'UI-STYLE.md';
 
       // Call backend API to save the file (port 4001 is the workspace server)
-      await axios.post(`${SPEC_URL}/save-specification`, {
+      await specClient.post('/save-specification', {
         fileName: fileName,
         content: specification,
         workspacePath: currentWorkspace.projectFolder,
@@ -2,7 +2,7 @@ import React, { useState, useEffect } from 'react';
 import { useSearchParams } from 'react-router-dom';
 import { Card, Alert, Button, AIPresetIndicator } from '../components';
 import { useWorkspace } from '../context/WorkspaceContext';
-import { INTEGRATION_URL } from '../api/client';
+import { INTEGRATION_URL, workspaceRef, apiFetch } from '../api/client';
 
 interface FileTheme {
   filename: string;
@@ -67,13 +67,13 @@ export const Vision: React.FC = () => {
 
     setLoading(true);
     try {
-      const response = await fetch(`${INTEGRATION_URL}/theme-files`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/theme-files`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
-          workspacePath: currentWorkspace.projectFolder,
+          ...workspaceRef(currentWorkspace),
         }),
       });
 
@@ -140,12 +140,13 @@ export const Vision: React.FC = () => {
         path = `${currentWorkspace.projectFolder}/conception/${fileName}`;
       }
 
-      const response = await fetch(`${INTEGRATION_URL}/save-theme`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/save-theme`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
+          workspaceId: currentWorkspace?.serverId,
           path,
           name: editFormData.name,
           description: editFormData.description,
@@ -181,12 +182,13 @@ export const Vision: React.FC = () => {
 
     setDeletingTheme(true);
     try {
-      const response = await fetch(`${INTEGRATION_URL}/delete-theme`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/delete-theme`, {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
+          workspaceId: currentWorkspace?.serverId,
           path: theme.path,
         }),
       });
@@ -3,7 +3,7 @@ import { useNavigate } from 'react-router-dom';
 import { Card, Button } from '../components';
 import { useWorkspace } from '../context/WorkspaceContext';
 import { useAuth } from '../context/AuthContext';
-import { INTEGRATION_URL } from '../api/client';
+import { INTEGRATION_URL, workspaceRef, apiFetch } from '../api/client';
 
 interface FileCapability {
   filename: string;
@@ -33,10 +33,10 @@ export const WorkspaceOverview: React.FC = () => {
 
     setLoading(true);
     try {
-      const response = await fetch(`${INTEGRATION_URL}/capability-files`, {
+      const response = await apiFetch(`${INTEGRATION_URL}/capability-files`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ workspacePath: currentWorkspace.projectFolder }),
+        body: JSON.stringify(workspaceRef(currentWorkspace)),
       });
       const data = await response.json();
       if (data.capabilities) {
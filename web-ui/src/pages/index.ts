@@ -1,5 +1,8 @@
 export { Login } from './Login';
 export { GoogleCallback } from './GoogleCallback';
+export { SSOCallback } from './SSOCallback';
+export { ForgotPassword } from './ForgotPassword';
+export { ResetPassword } from './ResetPassword';
 export { Dashboard } from './Dashboard';
 export { WorkspaceOverview } from './WorkspaceOverview';
 export { Ideation } from './Ideation';